@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"be03/models"
+	"be03/pkg/accountpurge"
+	"be03/pkg/apierr"
+	"be03/pkg/uploadfiles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- account deletion --------------------
+
+// deleteAccountHandler schedules deletion of the caller's account after confirming
+// the password. It answers 202 with a token for GET /account-deletions/:token.
+func deleteAccountHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, "password confirmation required", nil)
+		return
+	}
+	if !checkPassword(user.HashedPassword, req.Password) {
+		writeError(c, apierr.InvalidCredentials, "", nil)
+		return
+	}
+	job, err := accountpurge.Start(db, user.ID, "self")
+	if err != nil {
+		log.Printf("account deletion: start failed for user=%d: %v", user.ID, err)
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	if job.Status == models.PurgePending {
+		go func(j models.PurgeJob) {
+			if err := accountpurge.Run(db, &j, uploadfiles.Candidates); err != nil {
+				log.Printf("account deletion job=%d failed: %v", j.ID, err)
+			}
+			userCache.Invalidate(j.UserID)
+		}(*job)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"token": job.Token, "status": job.Status, "status_url": apiPrefix + "/account-deletions/" + job.Token})
+}
+
+// purgeStatusHandler reports a deletion job. It is unauthenticated because the
+// account no longer exists once the job completes; the token is unguessable.
+func purgeStatusHandler(c *gin.Context) {
+	var job models.PurgeJob
+	if err := db.Where("token = ?", c.Param("token")).First(&job).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":        job.Status,
+		"requested_at":  job.CreatedAt,
+		"finished_at":   job.FinishedAt,
+		"files_deleted": job.FilesDeleted,
+		"files_missing": job.FilesMissing,
+		"detail":        job.Error,
+	})
+}
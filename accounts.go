@@ -0,0 +1,291 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/accounts"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- accounts --------------------
+
+type accountView struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Institution    string `json:"institution"`
+	OpeningBalance int64  `json:"opening_balance"`
+	Archived       bool   `json:"archived"`
+	Balance        int64  `json:"balance"`
+	CatatanCount   int64  `json:"catatan_count"`
+}
+
+func viewAccount(a models.Account, t accounts.Total) accountView {
+	return accountView{
+		ID:             a.ID,
+		Name:           a.Name,
+		Type:           a.Type,
+		Institution:    a.Institution,
+		OpeningBalance: a.OpeningBalance,
+		Archived:       a.Archived,
+		Balance:        a.OpeningBalance + t.Total,
+		CatatanCount:   t.Count,
+	}
+}
+
+// accountRequest is shared by create (all fields) and update (any subset).
+type accountRequest struct {
+	Name           *string `json:"name"`
+	Type           *string `json:"type"`
+	Institution    *string `json:"institution"`
+	OpeningBalance *int64  `json:"opening_balance"`
+	Archived       *bool   `json:"archived"`
+}
+
+// apply copies the set fields onto a and validates the result.
+func (r accountRequest) apply(c *gin.Context, a *models.Account) bool {
+	if r.Name != nil {
+		a.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Type != nil {
+		a.Type = strings.ToLower(strings.TrimSpace(*r.Type))
+	}
+	if r.Institution != nil {
+		a.Institution = strings.TrimSpace(*r.Institution)
+	}
+	if r.OpeningBalance != nil {
+		a.OpeningBalance = *r.OpeningBalance
+	}
+	if r.Archived != nil {
+		a.Archived = *r.Archived
+	}
+	if a.Name == "" || len(a.Name) > 128 {
+		writeError(c, apierr.InvalidBody, "name is required (max 128 characters)", gin.H{"field": "name"})
+		return false
+	}
+	if !accounts.ValidType(a.Type) {
+		writeError(c, apierr.InvalidBody, "type must be cash, bank or ewallet", gin.H{"field": "type"})
+		return false
+	}
+	return true
+}
+
+// ownAccount loads account :id of the caller, writing not_found otherwise.
+func ownAccount(c *gin.Context, userID uint) (models.Account, bool) {
+	var a models.Account
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&a).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return a, false
+	}
+	return a, true
+}
+
+// checkAccountID validates an optional account_id from a catatan request.
+func checkAccountID(c *gin.Context, userID uint, id *uint) bool {
+	if id == nil {
+		return true
+	}
+	var n int64
+	db.Model(&models.Account{}).Where("id = ? AND user_id = ?", *id, userID).Count(&n)
+	if n == 0 {
+		writeError(c, apierr.InvalidBody, "unknown account", gin.H{"field": "account_id"})
+		return false
+	}
+	return true
+}
+
+// listAccountsHandler lists the caller's accounts with balances; archived
+// accounts are included only with ?archived=true.
+func listAccountsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	q := db.Where("user_id = ?", user.ID)
+	if c.Query("archived") != "true" {
+		q = q.Where("archived = ?", false)
+	}
+	var list []models.Account
+	if err := q.Order("id").Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	totals, err := accounts.Totals(db, user.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]accountView, 0, len(list))
+	for _, a := range list {
+		out = append(out, viewAccount(a, totals[a.ID]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func createAccountHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req accountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	a := models.Account{UserID: user.ID}
+	if !req.apply(c, &a) {
+		return
+	}
+	if err := db.Create(&a).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusCreated, viewAccount(a, accounts.Total{}))
+}
+
+func updateAccountHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	a, ok := ownAccount(c, user.ID)
+	if !ok {
+		return
+	}
+	var req accountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if !req.apply(c, &a) {
+		return
+	}
+	if err := db.Save(&a).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	totals, _ := accounts.Totals(db, user.ID)
+	c.JSON(http.StatusOK, viewAccount(a, totals[a.ID]))
+}
+
+// archiveOrDeleteAccountHandler deletes an unused account; one referenced by catatan is
+// archived instead so historical balances stay intact.
+func archiveOrDeleteAccountHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	a, ok := ownAccount(c, user.ID)
+	if !ok {
+		return
+	}
+	var used int64
+	db.Model(&models.CatatanKeuangan{}).Where("account_id = ?", a.ID).Count(&used)
+	if used > 0 {
+		a.Archived = true
+		if err := db.Save(&a).Error; err != nil {
+			writeError(c, apierr.CreateFailed, "", nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": a.ID, "archived": true, "catatan_count": used})
+		return
+	}
+	if err := db.Delete(&a).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	// goals saving into this account fall back to counting every catatan
+	db.Model(&models.Goal{}).Where("account_id = ?", a.ID).Update("account_id", nil)
+	c.Status(http.StatusNoContent)
+}
+
+// accountSummaryHandler reports the balance and per-month totals (in the user's
+// timezone) of one account, optionally limited by from / to (YYYY-MM-DD, inclusive).
+// With ?convert_to= the period and each month also carry a converted total.
+func accountSummaryHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	a, ok := ownAccount(c, user.ID)
+	if !ok {
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	from, to, ok := dateRange(c, loc)
+	if !ok {
+		return
+	}
+	conv, ok := converterFor(c, loc)
+	if !ok {
+		return
+	}
+	q := catatanarchive.Catatan(reportDB(c), from).Where("account_id = ? AND pending = ? AND split = ?", a.ID, false, false)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	rows, err := loadFXRows(q)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	type month struct {
+		Month     string         `json:"month"`
+		Total     int64          `json:"total"`
+		Count     int64          `json:"count"`
+		Converted *convertedView `json:"converted,omitempty"`
+	}
+	months := []month{}
+	var total int64
+	var converted *convertedView
+	if conv != nil {
+		converted = newConverted(conv)
+	}
+	for _, r := range rows {
+		key := r.Date.In(loc).Format("2006-01")
+		if len(months) == 0 || months[len(months)-1].Month != key {
+			months = append(months, month{Month: key})
+			if conv != nil {
+				months[len(months)-1].Converted = newConverted(conv)
+			}
+		}
+		m := &months[len(months)-1]
+		m.Total += r.Amount
+		m.Count++
+		total += r.Amount
+		if conv != nil {
+			m.Converted.add(conv, r, loc)
+			converted.add(conv, r, loc)
+		}
+	}
+	totals, _ := accounts.Totals(reportDB(c), user.ID)
+	out := gin.H{
+		"account":      viewAccount(a, totals[a.ID]),
+		"period_total": total,
+		"period_count": len(rows),
+		"months":       months,
+	}
+	if conv != nil {
+		if !checkConversion(c, conv) {
+			return
+		}
+		for _, m := range months {
+			m.Converted.round()
+		}
+		out["converted"] = converted.round()
+	}
+	c.JSON(http.StatusOK, out)
+}
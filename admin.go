@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"be03/models"
+	"be03/pkg/analytics"
+	"be03/pkg/apierr"
+	"be03/pkg/cleanup"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- admin --------------------
+
+// requireAdmin rejects callers without the administrator role.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "administrator" {
+			writeError(c, apierr.Forbidden, "administrator role required", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// recordAudit appends an audit row for the calling user; failures are only logged.
+func recordAudit(c *gin.Context, action string, detail any) {
+	entry := models.AuditLog{Action: action, IP: c.ClientIP()}
+	if user, ok := getUserFromContext(c); ok {
+		uid := user.ID
+		entry.UserID = &uid
+		entry.Username = user.Username
+	}
+	if detail != nil {
+		b, _ := json.Marshal(detail)
+		entry.Detail = string(b)
+		if len(entry.Detail) > 1024 {
+			entry.Detail = entry.Detail[:1024]
+		}
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("audit: failed to record %s: %v", action, err)
+	}
+}
+
+// adminCleanupHandler bulk-deletes catatan for a scope, unlinking their uploads.
+// It defaults to a dry run; a real run needs "dry_run": false, and a run without
+// any scope filter additionally needs "confirm_all": true.
+func adminCleanupHandler(c *gin.Context) {
+	var req struct {
+		Username       string `json:"username"`
+		From           string `json:"from"` // YYYY-MM-DD, inclusive
+		To             string `json:"to"`   // YYYY-MM-DD, inclusive
+		ZeroAmountOnly bool   `json:"zero_amount_only"`
+		FailedOnly     bool   `json:"failed_only"`
+		DryRun         *bool  `json:"dry_run"`
+		ConfirmAll     bool   `json:"confirm_all"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	scope := cleanup.Scope{Username: req.Username, ZeroAmountOnly: req.ZeroAmountOnly, FailedOnly: req.FailedOnly}
+	if req.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.From, time.Local)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "from must be YYYY-MM-DD", gin.H{"field": "from"})
+			return
+		}
+		scope.From = &t
+	}
+	if req.To != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.To, time.Local)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "to must be YYYY-MM-DD", gin.H{"field": "to"})
+			return
+		}
+		t = t.AddDate(0, 0, 1)
+		scope.To = &t
+	}
+	dryRun := req.DryRun == nil || *req.DryRun
+	if !dryRun && scope.Global() && !req.ConfirmAll {
+		writeError(c, apierr.InvalidBody, "cleanup without a scope deletes every catatan; set confirm_all", gin.H{"field": "confirm_all"})
+		return
+	}
+	res, err := cleanup.Run(db, scope, dryRun)
+	if err != nil {
+		if errors.Is(err, cleanup.ErrUserNotFound) {
+			writeError(c, apierr.NotFound, "user not found", gin.H{"field": "username"})
+			return
+		}
+		log.Printf("admin cleanup failed: %v", err)
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if !dryRun {
+		recordAudit(c, "admin.cleanup", gin.H{"scope": scope, "catatan": res.Catatan, "uploads_unlinked": res.UploadsUnlinked})
+	}
+	c.JSON(http.StatusOK, gin.H{"scope": scope, "result": res})
+}
+
+// adminAnalyticsHandler reports platform-wide metrics for ?from= / ?to=
+// (YYYY-MM-DD in UTC, inclusive; default the last 30 days, at most 366 days).
+func adminAnalyticsHandler(c *gin.Context) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+		add  int
+	}{{"from", &from, 0}, {"to", &to, 1}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, p.name+" must be YYYY-MM-DD", gin.H{"field": p.name})
+			return
+		}
+		*p.dst = t.AddDate(0, 0, p.add)
+	}
+	if !from.Before(to) || to.Sub(from) > 366*24*time.Hour {
+		writeError(c, apierr.InvalidBody, "range must be between 1 and 366 days", nil)
+		return
+	}
+	report, err := analytics.Compute(reportDB(c), from, to)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// adminDBStatsHandler reports the query counters and the connection pool.
+func adminDBStatsHandler(c *gin.Context) {
+	out := gin.H{"queries": queryLog.Stats()}
+	if sqlDB, err := db.DB(); err == nil {
+		s := sqlDB.Stats()
+		out["pool"] = gin.H{
+			"open":       s.OpenConnections,
+			"in_use":     s.InUse,
+			"idle":       s.Idle,
+			"wait_count": s.WaitCount,
+			"wait_ms":    s.WaitDuration.Milliseconds(),
+			"max_open":   s.MaxOpenConnections,
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// setUserDisabledHandler deactivates (disable) or reactivates a user by
+// username. Disabling revokes the user's refresh tokens and bumps the token
+// version, so every session ends for good; the user logs in again once
+// enabled.
+func setUserDisabledHandler(disable bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u models.User
+		if err := reqDB(c).Where("username = ?", c.Param("username")).First(&u).Error; err != nil {
+			writeError(c, apierr.NotFound, "user not found", nil)
+			return
+		}
+		if caller, ok := getUserFromContext(c); ok && caller.ID == u.ID && disable {
+			writeError(c, apierr.InvalidBody, "administrators cannot disable themselves", nil)
+			return
+		}
+		var at *time.Time
+		if disable {
+			now := time.Now()
+			at = &now
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if !disable {
+				return tx.Model(&u).Update("disabled_at", nil).Error
+			}
+			err := tx.Model(&u).Updates(map[string]any{"disabled_at": at, "token_version": gorm.Expr("token_version + 1")}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked = ?", u.ID, false).Update("revoked", true).Error
+		})
+		if err != nil {
+			log.Printf("admin: setting disabled=%v on user=%d: %v", disable, u.ID, err)
+			writeError(c, apierr.CreateFailed, "", nil)
+			return
+		}
+		userCache.Invalidate(u.ID)
+		action := "admin.user.enable"
+		if disable {
+			action = "admin.user.disable"
+		}
+		recordAudit(c, action, gin.H{"username": u.Username})
+		c.JSON(http.StatusOK, gin.H{"username": u.Username, "disabled": disable, "disabled_at": at})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/usernames"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- admin catatan --------------------
+
+// catatanStatuses are the ?status= filters of GET /admin/catatan.
+var catatanStatuses = map[string][]any{
+	"pending":   {"catatan_keuangans.pending = ?", true},
+	"suspect":   {"catatan_keuangans.pending = ? AND catatan_keuangans.suspect = ?", false, true},
+	"confirmed": {"catatan_keuangans.pending = ? AND catatan_keuangans.suspect = ?", false, false},
+}
+
+// adminCatatan is a catatan with its owner and receipt upload.
+type adminCatatan struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UserID        uint      `json:"user_id"`
+	Username      string    `json:"username"`
+	FileName      string    `json:"file_name"`
+	Amount        int64     `json:"amount"`
+	Date          time.Time `json:"date"`
+	Currency      string    `json:"currency"`
+	Category      string    `json:"category"`
+	Merchant      string    `json:"merchant"`
+	Pending       bool      `json:"pending"`
+	Suspect       bool      `json:"suspect"`
+	SuspectReason string    `json:"suspect_reason"`
+	Split         bool      `json:"split"`
+	ParentID      *uint     `json:"parent_id"`
+	AccountID     *uint     `json:"account_id"`
+	UploadID      *uint     `json:"upload_id"`
+	StorePath     *string   `json:"store_path"`
+	UploadFailed  *bool     `json:"upload_failed"`
+	UploadNotes   int64     `json:"upload_notes"`
+}
+
+// adminCatatanHandler lists the catatan of every user, newest first, each
+// with the owner's username and the upload it was read from (null fields for
+// manual entries) and the number of support notes on it. Filters: username (a former name is followed), status
+// (pending, suspect or confirmed) and from / to (YYYY-MM-DD in the caller's
+// timezone, inclusive); limit (1-500, default 100) and offset page through
+// them, and total counts every match.
+func adminCatatanHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	from, to, ok := dateRange(c, loadPreferences(user.ID).Location())
+	if !ok {
+		return
+	}
+	q := catatanarchive.Catatan(reqDB(c), from)
+	if v := c.Query("username"); v != "" {
+		owner, err := usernames.Resolve(reqDB(c), v)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(c, apierr.NotFound, "user not found", gin.H{"field": "username"})
+			return
+		}
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		q = q.Where("catatan_keuangans.user_id = ?", owner.ID)
+	}
+	if v := c.Query("status"); v != "" {
+		cond, ok := catatanStatuses[v]
+		if !ok {
+			writeError(c, apierr.InvalidBody, "unsupported status", gin.H{"field": "status", "allowed": []string{"pending", "suspect", "confirmed"}})
+			return
+		}
+		q = q.Where(cond[0], cond[1:]...)
+	}
+	if from != nil {
+		q = q.Where("catatan_keuangans.date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("catatan_keuangans.date < ?", to.UTC())
+	}
+	limit, offset := 100, 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(c, apierr.InvalidBody, "limit must be between 1 and 500", gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(c, apierr.InvalidBody, "offset must be >= 0", gin.H{"field": "offset"})
+			return
+		}
+		offset = n
+	}
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	items := []adminCatatan{}
+	// a catatan has at most one upload, but nothing enforces it: the first is
+	// joined so a stray second cannot duplicate the row
+	err := q.Select("catatan_keuangans.id, catatan_keuangans.created_at, catatan_keuangans.user_id, users.username, " +
+		"catatan_keuangans.file_name, catatan_keuangans.amount, catatan_keuangans.date, catatan_keuangans.currency, " +
+		"catatan_keuangans.category, catatan_keuangans.merchant, catatan_keuangans.pending, catatan_keuangans.suspect, " +
+		"catatan_keuangans.suspect_reason, catatan_keuangans.split, catatan_keuangans.parent_id, catatan_keuangans.account_id, " +
+		"uploads.id AS upload_id, uploads.store_path, uploads.failed AS upload_failed, " +
+		"(SELECT COUNT(*) FROM upload_notes WHERE upload_notes.upload_id = uploads.id) AS upload_notes").
+		Joins("JOIN users ON users.id = catatan_keuangans.user_id").
+		Joins("LEFT JOIN uploads ON uploads.id = (SELECT MIN(u.id) FROM uploads u WHERE u.keuangan_id = catatan_keuangans.id)").
+		Order("catatan_keuangans.id desc").Limit(limit).Offset(offset).Scan(&items).Error
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "limit": limit, "offset": offset, "items": items})
+}
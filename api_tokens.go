@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/apitokens"
+	"be03/pkg/roles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- personal access tokens --------------------
+
+// maxAPITokens caps the personal access tokens of one user.
+const maxAPITokens = 20
+
+// apiTokenAuth authenticates a request bearing a personal access token (see
+// jwtAuthMiddleware). Tokens reach only the routes their scopes admit.
+func apiTokenAuth(c *gin.Context, raw string) {
+	tok, err := apitokens.Lookup(db, raw, time.Now())
+	if authLookupFailed(c, err) {
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	route := strings.TrimPrefix(c.FullPath(), apiPrefix)
+	if !apitokens.Allows(tok.Scopes, c.Request.Method, route) {
+		writeError(c, apierr.Forbidden, "token scope does not allow this", gin.H{"scopes": apitokens.Split(tok.Scopes)})
+		return
+	}
+	user, err := userCache.Get(db, tok.UserID)
+	if authLookupFailed(c, err) {
+		return
+	}
+	if err != nil || wrongTenant(c, user) {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	if user.DisabledAt != nil {
+		writeError(c, apierr.AccountDisabled, "", nil)
+		return
+	}
+	role, err := roles.Of(db, user)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.Set("user", user)
+	c.Set("username", user.Username)
+	c.Set("role", role.Name)
+	c.Set("api_token_id", tok.ID)
+	c.Next()
+}
+
+type apiTokenView struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func viewAPIToken(t models.APIToken) apiTokenView {
+	return apiTokenView{ID: t.ID, Name: t.Name, Hint: t.Hint, Scopes: apitokens.Split(t.Scopes),
+		CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt, LastUsedAt: t.LastUsedAt}
+}
+
+// listAPITokensHandler lists the caller's personal access tokens, newest first.
+func listAPITokensHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var list []models.APIToken
+	if err := db.Where("user_id = ?", user.ID).Order("id desc").Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]apiTokenView, 0, len(list))
+	for _, t := range list {
+		out = append(out, viewAPIToken(t))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": out, "scopes": apitokens.All})
+}
+
+// createAPITokenHandler creates a personal access token with the given scopes,
+// expiring after expires_in_days (0 or omitted: never). The token is in the
+// response only; it cannot be shown again.
+func createAPITokenHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		writeError(c, apierr.InvalidBody, "name must be 1-128 characters", gin.H{"field": "name"})
+		return
+	}
+	scopes, err := apitokens.Normalize(req.Scopes)
+	if err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "scopes", "allowed": apitokens.All})
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 366 {
+		writeError(c, apierr.InvalidBody, "expires_in_days must be between 0 and 366", gin.H{"field": "expires_in_days"})
+		return
+	}
+	var n int64
+	db.Model(&models.APIToken{}).Where("user_id = ?", user.ID).Count(&n)
+	if n >= maxAPITokens {
+		writeError(c, apierr.QuotaExceeded, "too many api tokens", gin.H{"limit": maxAPITokens})
+		return
+	}
+	raw, hash := apitokens.Generate()
+	tok := models.APIToken{UserID: user.ID, Name: req.Name, TokenHash: hash, Hint: apitokens.Hint(raw), Scopes: scopes}
+	if req.ExpiresInDays > 0 {
+		exp := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		tok.ExpiresAt = &exp
+	}
+	if err := db.Create(&tok).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "api_token": viewAPIToken(tok)})
+}
+
+// deleteAPITokenHandler revokes one of the caller's personal access tokens.
+func deleteAPITokenHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.APIToken{})
+	if res.Error != nil {
+		writeError(c, apierr.RevokeFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
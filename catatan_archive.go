@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"be03/pkg/catatanarchive"
+	"be03/pkg/scheduler"
+)
+
+// -------------------- catatan archival --------------------
+
+// catatanArchiveYears is CATATAN_ARCHIVE_YEARS: catatan older than this many
+// years move into catatan_archives. Unset or 0 disables archival.
+func catatanArchiveYears() int {
+	years, _ := strconv.Atoi(os.Getenv("CATATAN_ARCHIVE_YEARS"))
+	return max(years, 0)
+}
+
+// archiveCatatan is the catatan_archive job.
+func archiveCatatan(years int) scheduler.Func {
+	return func(context.Context) (string, error) {
+		cutoff := catatanarchive.Cutoff(time.Now(), years)
+		n, err := catatanarchive.Run(db, cutoff, catatanarchive.DefaultBatch)
+		if err != nil {
+			return fmt.Sprintf("moved %d catatan", n), err
+		}
+		return fmt.Sprintf("moved %d catatan dated before %s", n, cutoff.Format("2006-01-02")), nil
+	}
+}
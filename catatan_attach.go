@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanstore"
+	"be03/pkg/exifmeta"
+	"be03/pkg/featureflags"
+	"be03/pkg/hooks"
+	"be03/pkg/logredact"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrexp"
+	"be03/pkg/ocrtext"
+	"be03/pkg/uploadfiles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- attach receipt --------------------
+
+// attachUploadHandler backs a manual catatan with a receipt image (multipart
+// "file"). The image is stored as an upload linked to the catatan and read by
+// OCR: a catatan still without an amount takes the one found, and stays
+// pending until the owner confirms it. Otherwise the catatan is left as it
+// is; the response carries the OCR result either way.
+func attachUploadHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var ct models.CatatanKeuangan
+	if err := reqDB(c).First(&ct, c.Param("id")).Error; err != nil || role != "administrator" && ct.UserID != user.ID {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if !checkPeriodOpen(c, ct) {
+		return
+	}
+	var linked int64
+	db.Model(&models.Upload{}).Where("keuangan_id = ?", ct.ID).Count(&linked)
+	if linked > 0 || ct.ContentHash != nil {
+		writeError(c, apierr.Duplicate, "catatan already has a receipt", gin.H{"id": ct.ID})
+		return
+	}
+	// the receipt is stored for the catatan's owner, who may not be the caller
+	var profile models.Profile
+	if err := db.Where("user_id = ?", ct.UserID).First(&profile).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	var owner models.User
+	db.First(&owner, ct.UserID)
+	if !checkUploadQuota(c, owner, profile) {
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		writeError(c, apierr.MissingFile, "file missing", nil)
+		return
+	}
+	if file.Size > maxUploadBytes {
+		writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
+		return
+	}
+	if !checkOrgQuota(c, owner, file.Size) {
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		writeError(c, apierr.OpenFailed, "", nil)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(src, maxUploadBytes+1))
+	src.Close()
+	if err != nil {
+		writeError(c, apierr.OpenFailed, "", nil)
+		return
+	}
+	// the same image may not back two catatan (see catatanstore)
+	stripped, _ := exifmeta.Strip(data)
+	hash := catatanstore.Hash(stripped)
+	var other models.CatatanKeuangan
+	if db.Where("user_id = ? AND content_hash = ?", ct.UserID, *hash).First(&other).Error == nil {
+		writeError(c, apierr.Duplicate, "receipt already recorded", gin.H{"id": other.ID})
+		return
+	}
+
+	// claim the image first: should the watcher pick the file up before the
+	// upload is linked, catatanstore links it to this catatan
+	if err := db.Model(&ct).Update("content_hash", *hash).Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	up, fullPath, err := storeIngestedFile(profile, filepath.Base(file.Filename), data)
+	if err != nil {
+		db.Model(&ct).Update("content_hash", nil)
+		switch err.Error() {
+		case "file too large":
+			writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
+		case "unsupported file type":
+			writeError(c, apierr.UnsupportedType, "File tidak dikenali, gunakan file lain!", gin.H{"allowed": uploadfiles.APITypes.List()})
+		case "already processed":
+			writeError(c, apierr.Duplicate, "file already recorded", nil)
+		default:
+			log.Printf("attach upload to catatan=%d: %v", ct.ID, err)
+			writeError(c, apierr.SaveFailed, "", nil)
+		}
+		return
+	}
+	up.KeuanganID, ct.ContentHash = &ct.ID, hash
+
+	res, err := extractOCR(fullPath)
+	ocrexp.Shadow(db, fullPath, res)
+	if err != nil && !errors.Is(err, ocr.ErrNoAmount) {
+		log.Printf("OCR: error on %s: %v", fullPath, err)
+		res = nil
+	}
+	if res != nil {
+		featureFlags.GateOCR(db, profile.UserID, res)
+		now, conf, raw := time.Now(), res.Confidence, res.RawConfidence
+		up.ProcessedAt, up.OCRConfidence = &now, &conf
+		up.OCRHeuristic, up.OCRRawConfidence, up.Reference = res.Heuristic, &raw, res.Reference
+		if err := ocrtext.SaveResult(db, up.ID, res); err != nil {
+			log.Printf("OCR: storing text for upload=%d: %v", up.ID, err)
+		}
+		if ct.Amount == 0 && res.Amount > 0 {
+			ct.Amount = res.Amount
+			ct.Pending = true
+			log.Printf("OCR: filled catatan id=%d amount=%s from upload=%d", ct.ID, logredact.Amount(res.Amount), up.ID)
+		}
+		if ct.Merchant == "" && res.QRIS != nil {
+			ct.Merchant = res.QRIS.Merchant
+		}
+		// unless another catatan already holds the reference
+		if ct.Reference == nil && res.Reference != "" &&
+			db.Where("user_id = ? AND reference = ?", ct.UserID, res.Reference).First(&models.CatatanKeuangan{}).Error != nil {
+			ct.Reference = &res.Reference
+		}
+		// tax lines are bounded by the catatan's amount, which may be the user's
+		if ct.Tax == 0 && ct.ServiceCharge == 0 && ct.Amount > 0 && featureFlags.On(db, featureflags.OCRTax, profile.UserID) {
+			ct.Tax, ct.ServiceCharge = ocr.DetectTax(res.Text, ct.Amount).Amounts()
+		}
+	}
+	if err := db.Save(up).Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	if err := db.Save(&ct).Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	if res != nil && res.Amount > 0 {
+		hooks.EmitAmountExtracted(c.Request.Context(), hooks.AmountExtracted{Upload: *up, UserID: ct.UserID, Amount: res.Amount, Confidence: res.Confidence, Source: hooks.SourceAPI})
+	}
+	c.JSON(http.StatusOK, gin.H{"catatan": ct, "upload_id": up.ID, "ocr": res})
+}
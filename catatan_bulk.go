@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/periodlock"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- bulk edit --------------------
+
+// maxBulkCatatan caps the catatan of one bulk edit.
+const maxBulkCatatan = 200
+
+type bulkResult struct {
+	ID      uint        `json:"id"`
+	Updated bool        `json:"updated"`
+	Error   apierr.Code `json:"error,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// bulkEditCatatanHandler applies one partial update, {category, merchant,
+// account_id} (account_id 0 clears it), to the catatan listed in ids, e.g. to
+// re-categorise a batch. It is all or nothing: every catatan is checked first
+// (found and the caller's, administrators excepted; its period open; the
+// account the owner's) and a single failure leaves them all unchanged. The
+// response lists the outcome per id.
+func bulkEditCatatanHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		IDs    []uint `json:"ids"`
+		Update struct {
+			Category  *string `json:"category"`
+			Merchant  *string `json:"merchant"`
+			AccountID *uint   `json:"account_id"`
+		} `json:"update"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	ids := make([]uint, 0, len(req.IDs))
+	seen := map[uint]bool{}
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxBulkCatatan {
+		writeError(c, apierr.InvalidBody, fmt.Sprintf("ids must list 1 to %d catatan", maxBulkCatatan), gin.H{"field": "ids"})
+		return
+	}
+	u := req.Update
+	updates := map[string]any{}
+	if u.Category != nil {
+		if !checkLabel(c, "category", u.Category, 64) {
+			return
+		}
+		updates["category"] = *u.Category
+	}
+	if u.Merchant != nil {
+		if !checkLabel(c, "merchant", u.Merchant, 128) {
+			return
+		}
+		updates["merchant"] = *u.Merchant
+	}
+	if u.AccountID != nil {
+		if *u.AccountID == 0 {
+			updates["account_id"] = nil
+		} else {
+			updates["account_id"] = *u.AccountID
+		}
+	}
+	if len(updates) == 0 {
+		writeError(c, apierr.InvalidBody, "update sets none of category, merchant or account_id", gin.H{"field": "update"})
+		return
+	}
+
+	var list []models.CatatanKeuangan
+	if err := reqDB(c).Where("id IN ?", ids).Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	byID := make(map[uint]models.CatatanKeuangan, len(list))
+	for _, ct := range list {
+		if role == "administrator" || ct.UserID == user.ID {
+			byID[ct.ID] = ct
+		}
+	}
+	results := make([]bulkResult, len(ids))
+	failed := 0
+	for i, id := range ids {
+		results[i] = bulkResult{ID: id}
+		ct, ok := byID[id]
+		if !ok {
+			results[i].Error = apierr.NotFound
+			failed++
+			continue
+		}
+		err := periodlock.Check(db, ct.UserID, ct.Date)
+		if errors.Is(err, periodlock.ErrLocked) {
+			results[i].Error, results[i].Message = apierr.PeriodLocked, ct.Date.In(loadPreferences(ct.UserID).Location()).Format("2006-01")+" is closed"
+			failed++
+			continue
+		}
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		if u.AccountID != nil && *u.AccountID != 0 {
+			var n int64
+			db.Model(&models.Account{}).Where("id = ? AND user_id = ?", *u.AccountID, ct.UserID).Count(&n)
+			if n == 0 {
+				results[i].Error, results[i].Message = apierr.InvalidBody, "unknown account"
+				failed++
+				continue
+			}
+		}
+	}
+	if failed > 0 {
+		writeError(c, apierr.InvalidBody, fmt.Sprintf("%d of %d catatan cannot be updated; none was", failed, len(ids)), gin.H{"results": results})
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.CatatanKeuangan{}).Where("id IN ?", ids).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return fmt.Errorf("updated %d of %d catatan", res.RowsAffected, len(ids))
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	for i := range results {
+		results[i].Updated = true
+	}
+	recordAudit(c, "catatan.bulk_update", gin.H{"ids": ids, "update": updates})
+	c.JSON(http.StatusOK, gin.H{"updated": len(ids), "results": results})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/hooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- split receipt --------------------
+
+// maxSplitItems caps the line items of one receipt.
+const maxSplitItems = 50
+
+var errAlreadySplit = errors.New("catatan is already split")
+
+type splitItem struct {
+	Amount      int64  `json:"amount"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// splitCatatanHandler divides a confirmed catatan into line items, for a
+// receipt covering several expense categories. The body is an array of
+// {amount, category, description} adding up to the catatan's amount. Each
+// item becomes a catatan with the receipt's date, account, currency and merchant and
+// parent_id set; the receipt is flagged split and totals count the items in
+// its place.
+func splitCatatanHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var items []splitItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if len(items) < 2 || len(items) > maxSplitItems {
+		writeError(c, apierr.InvalidBody, fmt.Sprintf("a split needs 2 to %d items", maxSplitItems), gin.H{"field": "items"})
+		return
+	}
+	var sum int64
+	for i := range items {
+		it := &items[i]
+		it.Category = strings.TrimSpace(it.Category)
+		it.Description = strings.TrimSpace(it.Description)
+		switch {
+		case it.Amount == 0:
+			writeError(c, apierr.InvalidBody, "item amount is required", gin.H{"field": "amount", "item": i})
+			return
+		case len(it.Category) > 64:
+			writeError(c, apierr.InvalidBody, "category must be at most 64 characters", gin.H{"field": "category", "item": i})
+			return
+		case len(it.Description) > 255:
+			writeError(c, apierr.InvalidBody, "description must be at most 255 characters", gin.H{"field": "description", "item": i})
+			return
+		}
+		sum += it.Amount
+	}
+	var parent models.CatatanKeuangan
+	if err := reqDB(c).First(&parent, c.Param("id")).Error; err != nil || role != "administrator" && parent.UserID != user.ID {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	switch {
+	case parent.ParentID != nil:
+		writeError(c, apierr.InvalidBody, "a line item cannot be split", gin.H{"parent_id": *parent.ParentID})
+		return
+	case parent.Pending || parent.Amount == 0:
+		writeError(c, apierr.InvalidBody, "confirm the catatan before splitting it", nil)
+		return
+	case sum != parent.Amount:
+		writeError(c, apierr.InvalidBody, "item amounts must add up to the catatan's amount", gin.H{"amount": parent.Amount, "sum": sum})
+		return
+	}
+	if !checkPeriodOpen(c, parent) {
+		return
+	}
+	children := make([]models.CatatanKeuangan, len(items))
+	for i, it := range items {
+		name := fmt.Sprintf("%s #%d", parent.FileName, i+1)
+		if len(name) > 255 {
+			name = fmt.Sprintf("%s #%d", parent.FileName[:240], i+1)
+		}
+		children[i] = models.CatatanKeuangan{UserID: parent.UserID, FileName: name, Amount: it.Amount, Date: parent.Date,
+			AccountID: parent.AccountID, Currency: parent.Currency, ParentID: &parent.ID, Category: it.Category, Description: it.Description, Merchant: parent.Merchant}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the flag is claimed first so two concurrent splits cannot both pass
+		res := tx.Model(&models.CatatanKeuangan{}).Where("id = ? AND split = ?", parent.ID, false).Update("split", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errAlreadySplit
+		}
+		return tx.Create(&children).Error
+	})
+	switch {
+	case errors.Is(err, errAlreadySplit):
+		writeError(c, apierr.Duplicate, "catatan is already split", gin.H{"id": parent.ID})
+		return
+	case err != nil:
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	parent.Split = true
+	for _, ch := range children {
+		hooks.EmitCatatanCreated(c.Request.Context(), hooks.CatatanCreated{Catatan: ch, Source: hooks.SourceAPI})
+	}
+	c.JSON(http.StatusCreated, gin.H{"catatan": parent, "items": children})
+}
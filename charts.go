@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- spending charts --------------------
+
+// GET /catatan/histogram defaults and bounds. Amounts from the last bucket on
+// are counted together, so the response stays small whatever bucket is asked.
+const (
+	defaultHistogramBucket = 50000
+	maxHistogramBucket     = 1_000_000_000_000
+	maxHistogramBuckets    = 1000
+)
+
+type histogramBucket struct {
+	Min   int64  `json:"min"` // inclusive
+	Max   *int64 `json:"max"` // exclusive; null for the open last bucket
+	Count int64  `json:"count"`
+	Total int64  `json:"total"`
+}
+
+// catatanHistogramHandler returns the distribution of the caller's spending
+// over amount buckets ?bucket= wide (default 50000), optionally limited by
+// from / to (YYYY-MM-DD in the user's timezone, inclusive) or a saved ?view=.
+// The buckets are
+// counted in SQL; only those holding catatan are returned, lowest first.
+// Catatan pending confirmation, split receipts (their items count) and
+// amounts of 0 or less are left out.
+func catatanHistogramHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	bucket := int64(defaultHistogramBucket)
+	if v := c.Query("bucket"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxHistogramBucket {
+			writeError(c, apierr.InvalidBody, "bucket must be a positive whole amount", gin.H{"field": "bucket"})
+			return
+		}
+		bucket = n
+	}
+	from, to, scope, ok := catatanRange(c, user.ID, loadPreferences(user.ID).Location())
+	if !ok {
+		return
+	}
+	q := catatanarchive.Catatan(reportDB(c), from).
+		Where("user_id = ? AND pending = ? AND split = ? AND amount > 0", user.ID, false, false).Scopes(scope)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	var rows []struct {
+		Idx   int64
+		Count int64
+		Total int64
+	}
+	last := int64(maxHistogramBuckets - 1)
+	err := q.Select("CASE WHEN amount >= ? THEN ? ELSE amount / ? END AS idx, COUNT(*) AS count, SUM(amount) AS total", last*bucket, last, bucket).
+		Group("idx").Order("idx").Scan(&rows).Error
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	buckets := make([]histogramBucket, 0, len(rows))
+	var count int64
+	for _, r := range rows {
+		b := histogramBucket{Min: r.Idx * bucket, Count: r.Count, Total: r.Total}
+		if r.Idx < last {
+			end := b.Min + bucket
+			b.Max = &end
+		}
+		buckets = append(buckets, b)
+		count += r.Count
+	}
+	c.JSON(http.StatusOK, gin.H{"bucket": bucket, "count": count, "buckets": buckets})
+}
+
+// GET /catatan/top limits.
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 50
+)
+
+// topColumns are the columns GET /catatan/top ranks by; rows older than the
+// merchant column hold NULL.
+var topColumns = map[string]string{"merchant": "COALESCE(merchant, '')", "category": "COALESCE(category, '')"}
+
+type topEntry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Total int64  `json:"total"`
+}
+
+// catatanTopHandler ranks the caller's merchants or categories (?by=, default
+// category) by the total of their catatan, optionally limited by from / to
+// (YYYY-MM-DD in the user's timezone, inclusive) or a saved ?view=. It returns the first
+// ?limit= (default 10) and adds up the rest in others; catatan without a
+// merchant or category are counted in unassigned. Catatan pending
+// confirmation and split receipts (their items count) are left out.
+func catatanTopHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	by := c.DefaultQuery("by", "category")
+	col, ok := topColumns[by]
+	if !ok {
+		writeError(c, apierr.InvalidBody, "by must be merchant or category", gin.H{"field": "by"})
+		return
+	}
+	limit := defaultTopLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTopLimit {
+			writeError(c, apierr.InvalidBody, fmt.Sprintf("limit must be 1 to %d", maxTopLimit), gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	from, to, scope, ok := catatanRange(c, user.ID, loadPreferences(user.ID).Location())
+	if !ok {
+		return
+	}
+	q := catatanarchive.Catatan(reportDB(c), from).Where("user_id = ? AND pending = ? AND split = ?", user.ID, false, false).Scopes(scope)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	q = q.Session(&gorm.Session{})
+	var all struct {
+		Count, Total, UnassignedCount, UnassignedTotal int64
+	}
+	err := q.Select("COUNT(*) AS count, COALESCE(SUM(amount),0) AS total, " +
+		"COALESCE(SUM(CASE WHEN " + col + " = '' THEN 1 ELSE 0 END),0) AS unassigned_count, " +
+		"COALESCE(SUM(CASE WHEN " + col + " = '' THEN amount ELSE 0 END),0) AS unassigned_total").Scan(&all).Error
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	items := []topEntry{}
+	err = q.Select(col + " AS key, COUNT(*) AS count, SUM(amount) AS total").Where(col + " <> ''").
+		Group(col).Order("total DESC, key").Limit(limit).Scan(&items).Error
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	others := topEntry{Key: "others", Count: all.Count - all.UnassignedCount, Total: all.Total - all.UnassignedTotal}
+	for _, it := range items {
+		others.Count -= it.Count
+		others.Total -= it.Total
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"by":         by,
+		"items":      items,
+		"others":     others,
+		"unassigned": topEntry{Count: all.UnassignedCount, Total: all.UnassignedTotal},
+		"count":      all.Count,
+		"total":      all.Total,
+	})
+}
+
+type calendarDay struct {
+	Date  string `json:"date"` // YYYY-MM-DD in the user's timezone
+	Count int64  `json:"count"`
+	Total int64  `json:"total"`
+}
+
+// catatanCalendarHandler returns the caller's daily spending over ?year=
+// (default the current one, in the user's timezone) for a heatmap: the days
+// holding catatan, in order, with their count and total, plus the largest
+// day total to scale the colours by. Catatan pending confirmation and split
+// receipts (their items count) are left out.
+func catatanCalendarHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	year := time.Now().In(loc).Year()
+	if v := c.Query("year"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1970 || n > 9999 {
+			writeError(c, apierr.InvalidBody, "year must be a year from 1970", gin.H{"field": "year"})
+			return
+		}
+		year = n
+	}
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+	var rows []models.CatatanKeuangan
+	err := catatanarchive.Catatan(reportDB(c), &from).
+		Where("user_id = ? AND pending = ? AND split = ? AND date >= ? AND date < ?", user.ID, false, false, from.UTC(), to.UTC()).
+		Select("amount", "date").Order("date").Find(&rows).Error
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	days := []calendarDay{}
+	var count, total, peak int64
+	for _, r := range rows {
+		key := r.Date.In(loc).Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != key {
+			days = append(days, calendarDay{Date: key})
+		}
+		d := &days[len(days)-1]
+		d.Count++
+		d.Total += r.Amount
+		peak = max(peak, d.Total)
+		count++
+		total += r.Amount
+	}
+	c.JSON(http.StatusOK, gin.H{"year": year, "days": days, "count": count, "total": total, "max_total": peak})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/chatbot"
+	"be03/pkg/ocr"
+	"be03/pkg/periodlock"
+	"be03/pkg/roles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- chat bots --------------------
+
+// chatLinkCodeTTL bounds how long a link code can be redeemed.
+const chatLinkCodeTTL = 15 * time.Minute
+
+// chatBot holds the dialogue state shared by all connectors.
+var chatBot = chatbot.New(chatPipeline{})
+
+// whatsApp is the WhatsApp connector; nil unless WHATSAPP_TOKEN is set.
+var whatsApp *chatbot.WhatsApp
+
+// startChatBots starts the connectors configured in the environment:
+// TELEGRAM_BOT_TOKEN (long polling) and WHATSAPP_TOKEN + WHATSAPP_PHONE_NUMBER_ID
+// (webhook at /api/v1/bots/whatsapp/webhook, verified with WHATSAPP_APP_SECRET
+// and WHATSAPP_VERIFY_TOKEN).
+func startChatBots() {
+	if tok := os.Getenv("WHATSAPP_TOKEN"); tok != "" {
+		whatsApp = &chatbot.WhatsApp{
+			PhoneNumberID: os.Getenv("WHATSAPP_PHONE_NUMBER_ID"),
+			Token:         tok,
+			AppSecret:     os.Getenv("WHATSAPP_APP_SECRET"),
+			VerifyToken:   os.Getenv("WHATSAPP_VERIFY_TOKEN"),
+		}
+		log.Printf("chatbot: whatsapp webhook enabled")
+	}
+	if tok := os.Getenv("TELEGRAM_BOT_TOKEN"); tok != "" {
+		tg, err := chatbot.NewTelegram(tok)
+		if err != nil {
+			log.Printf("chatbot: telegram disabled: %v", err)
+			return
+		}
+		log.Printf("chatbot: telegram polling started")
+		go tg.Run(context.Background(), chatBot)
+	}
+}
+
+// chatPipeline connects the bot dialogue to accounts, uploads and catatan.
+type chatPipeline struct{}
+
+func (chatPipeline) Link(provider, chatID, code string) (string, error) {
+	var lc models.ChatLinkCode
+	if err := db.Where("code = ? AND expires_at > ?", strings.ToUpper(code), time.Now()).First(&lc).Error; err != nil {
+		return "", chatbot.ErrInvalidCode
+	}
+	var user models.User
+	if err := db.First(&user, lc.UserID).Error; err != nil {
+		return "", chatbot.ErrInvalidCode
+	}
+	if user.DisabledAt != nil {
+		return "", chatbot.ErrDisabled
+	}
+	var link models.ChatLink
+	if err := db.Where("provider = ? AND chat_id = ?", provider, chatID).First(&link).Error; err == nil {
+		link.UserID = user.ID
+		if err := db.Save(&link).Error; err != nil {
+			return "", err
+		}
+	} else if err := db.Create(&models.ChatLink{UserID: user.ID, Provider: provider, ChatID: chatID}).Error; err != nil {
+		return "", err
+	}
+	db.Delete(&lc)
+	return user.Username, nil
+}
+
+// linkedUser resolves the account a chat is linked to; a disabled account is
+// refused like at login.
+func linkedUser(provider, chatID string) (models.User, error) {
+	var link models.ChatLink
+	var user models.User
+	if err := db.Where("provider = ? AND chat_id = ?", provider, chatID).First(&link).Error; err != nil {
+		return user, chatbot.ErrNotLinked
+	}
+	if err := db.Preload("Role").First(&user, link.UserID).Error; err != nil {
+		return user, chatbot.ErrNotLinked
+	}
+	if user.DisabledAt != nil {
+		return user, chatbot.ErrDisabled
+	}
+	return user, nil
+}
+
+// Submit stores the photo like an API upload and runs OCR inline so the bot can
+// answer with the amount right away.
+func (chatPipeline) Submit(provider, chatID, fileName string, data []byte) (chatbot.Receipt, error) {
+	user, err := linkedUser(provider, chatID)
+	if err != nil {
+		return chatbot.Receipt{}, err
+	}
+	if user.Role.Name == "administrator" {
+		return chatbot.Receipt{}, errors.New("administrator accounts do not record catatan")
+	}
+	if r, err := roles.Of(db, user); err != nil || !roles.Has(r, roles.PermUpload) {
+		return chatbot.Receipt{}, errors.New("your role does not allow uploads")
+	}
+	var profile models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		return chatbot.Receipt{}, errors.New("create a profile in the app first")
+	}
+	if fileName == "" {
+		fileName = fmt.Sprintf("%d.jpg", time.Now().UnixNano())
+	}
+	up, fullPath, err := storeIngestedFile(profile, provider+"-"+filepath.Base(fileName), data)
+	if err != nil {
+		return chatbot.Receipt{}, err
+	}
+	_, suspect, err := recognizeUpload(up, profile, fullPath, true, false)
+	if errors.Is(err, ocr.ErrNoAmount) {
+		if up.FailedReason != ocr.NoAmountMessage {
+			return chatbot.Receipt{}, &chatbot.PoorImageError{Feedback: up.FailedReason}
+		}
+		return chatbot.Receipt{}, chatbot.ErrNoAmount
+	}
+	if err != nil {
+		return chatbot.Receipt{}, err
+	}
+	if up.KeuanganID == nil && up.FailedReason != "" {
+		return chatbot.Receipt{}, errors.New(up.FailedReason) // held for review, see holdForReview
+	}
+	if up.KeuanganID == nil {
+		return chatbot.Receipt{}, errors.New("saving the catatan failed")
+	}
+	var ct models.CatatanKeuangan
+	if err := db.First(&ct, *up.KeuanganID).Error; err != nil {
+		return chatbot.Receipt{}, err
+	}
+	return chatbot.Receipt{CatatanID: ct.ID, Amount: ct.Amount, Currency: loadPreferences(user.ID).Currency, Suspect: suspect}, nil
+}
+
+// ownedCatatan loads a catatan of the chat's account that may still be changed.
+func ownedCatatan(provider, chatID string, id uint) (models.User, models.CatatanKeuangan, error) {
+	var ct models.CatatanKeuangan
+	user, err := linkedUser(provider, chatID)
+	if err != nil {
+		return user, ct, err
+	}
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&ct).Error; err != nil {
+		return user, ct, errors.New("catatan not found")
+	}
+	if err := periodlock.Check(db, user.ID, ct.Date); err != nil {
+		return user, ct, err
+	}
+	return user, ct, nil
+}
+
+func (chatPipeline) Confirm(provider, chatID string, id uint) error {
+	_, ct, err := ownedCatatan(provider, chatID, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	ct.Suspect, ct.SuspectReason, ct.Pending, ct.ConfirmedAt = false, "", false, &now
+	return db.Save(&ct).Error
+}
+
+// Correct replaces the amount; a user-typed amount counts as a confirmation.
+func (chatPipeline) Correct(provider, chatID string, id uint, amount int64) (chatbot.Receipt, error) {
+	user, ct, err := ownedCatatan(provider, chatID, id)
+	if err != nil {
+		return chatbot.Receipt{}, err
+	}
+	now := time.Now()
+	ct.Amount, ct.Suspect, ct.SuspectReason, ct.Pending, ct.ConfirmedAt = amount, false, "", false, &now
+	if err := db.Save(&ct).Error; err != nil {
+		return chatbot.Receipt{}, err
+	}
+	return chatbot.Receipt{CatatanID: ct.ID, Amount: ct.Amount, Currency: loadPreferences(user.ID).Currency}, nil
+}
+
+// newChatLinkCode returns 8 characters without look-alikes (0/O, 1/I).
+func newChatLinkCode() string {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+// createChatLinkCodeHandler issues a one-time code the user sends to a bot as
+// "/link CODE". Set TELEGRAM_BOT_USERNAME to also get a t.me deep link.
+func createChatLinkCodeHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	lc := models.ChatLinkCode{UserID: user.ID, Code: newChatLinkCode(), ExpiresAt: time.Now().Add(chatLinkCodeTTL)}
+	if err := db.Create(&lc).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	resp := gin.H{"code": lc.Code, "expires_at": lc.ExpiresAt, "instructions": "send \"/link " + lc.Code + "\" to the bot"}
+	if bot := os.Getenv("TELEGRAM_BOT_USERNAME"); bot != "" {
+		resp["telegram_url"] = "https://t.me/" + bot + "?start=" + lc.Code
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// listChatLinksHandler lists the chats linked to the caller's account.
+func listChatLinksHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var links []models.ChatLink
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&links).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// deleteChatLinkHandler unlinks one of the caller's chats.
+func deleteChatLinkHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.ChatLink{})
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// whatsAppVerifyHandler answers the webhook subscription challenge.
+func whatsAppVerifyHandler(c *gin.Context) {
+	if whatsApp == nil || whatsApp.VerifyToken == "" || c.Query("hub.mode") != "subscribe" || c.Query("hub.verify_token") != whatsApp.VerifyToken {
+		writeError(c, apierr.Forbidden, "", nil)
+		return
+	}
+	c.String(http.StatusOK, c.Query("hub.challenge"))
+}
+
+// whatsAppWebhookHandler acknowledges immediately (Meta retries slow webhooks)
+// and runs the dialogue in the background.
+func whatsAppWebhookHandler(c *gin.Context) {
+	if whatsApp == nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		writeError(c, apierr.InvalidBody, "", nil)
+		return
+	}
+	if !whatsApp.VerifySignature(body, c.GetHeader("X-Hub-Signature-256")) {
+		writeError(c, apierr.Unauthorized, "invalid signature", nil)
+		return
+	}
+	msgs, err := chatbot.ParseWebhook(body)
+	if err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	go func() {
+		for _, in := range msgs {
+			chatBot.Handle(context.Background(), whatsApp, in)
+		}
+	}()
+	c.Status(http.StatusOK)
+}
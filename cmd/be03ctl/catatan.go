@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"be03/models"
+	"be03/pkg/acctexport"
+)
+
+// runCatatan dispatches `be03ctl catatan <subcommand>`.
+func runCatatan(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl catatan export [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runCatatanExport(args[1:])
+	default:
+		return fmt.Errorf("unknown catatan subcommand %q", args[0])
+	}
+}
+
+// runCatatanExport writes a user's catatan as an accounting import file, as
+// GET /catatan/export does, with the user's mapping for the format.
+func runCatatanExport(args []string) error {
+	fs := flag.NewFlagSet("catatan export", flag.ContinueOnError)
+	username := fs.String("username", "", "whose catatan to export")
+	format := fs.String("format", "", "accurate, jurnal or quickbooks")
+	from := fs.String("from", "", "first day (YYYY-MM-DD, user's timezone)")
+	to := fs.String("to", "", "last day (YYYY-MM-DD, user's timezone)")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+	if _, ok := acctexport.Formats[*format]; !ok {
+		return errors.New("--format must be accurate, jurnal or quickbooks")
+	}
+	gdb := mustDBFromEnv()
+	var user models.User
+	if err := gdb.Where("username = ?", *username).First(&user).Error; err != nil {
+		return fmt.Errorf("user %q: %w", *username, err)
+	}
+	prefs := models.DefaultPreferences(user.ID)
+	gdb.Where("user_id = ?", user.ID).First(&prefs)
+	loc := prefs.Location()
+	var bounds [2]*time.Time
+	for i, v := range []string{*from, *to} {
+		if v == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return fmt.Errorf("dates must be YYYY-MM-DD: %w", err)
+		}
+		if i == 1 {
+			t = t.AddDate(0, 0, 1)
+		}
+		bounds[i] = &t
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := acctexport.Export(w, gdb, user.ID, *format, bounds[0], bounds[1], loc)
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d catatan of %s for %s", n, *username, *format)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"be03/models"
+	"be03/pkg/schemadoctor"
+)
+
+// runDB dispatches `be03ctl db <subcommand>`.
+func runDB(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl db doctor [flags]")
+	}
+	switch args[0] {
+	case "doctor":
+		return runDBDoctor(args[1:])
+	default:
+		return fmt.Errorf("unknown db subcommand %q", args[0])
+	}
+}
+
+// runDBDoctor compares the database with the models and prints each
+// difference with the SQL fixing it. --fix applies the safe fixes (creating
+// missing tables, columns, indexes and foreign keys); type changes and orphan
+// rows are left to the operator. It fails while findings remain.
+func runDBDoctor(args []string) error {
+	fs := flag.NewFlagSet("db doctor", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "apply the safe fixes")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	gdb := mustDBFromEnv()
+	findings, err := schemadoctor.Check(gdb, models.All())
+	if err != nil {
+		return err
+	}
+	if *fix && len(findings) > 0 {
+		n, err := schemadoctor.Apply(gdb, findings)
+		fmt.Fprintf(os.Stderr, "applied %d safe fixes\n", n)
+		if err != nil {
+			return err
+		}
+		if findings, err = schemadoctor.Check(gdb, models.All()); err != nil {
+			return err
+		}
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"findings": findings}); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			safe := ""
+			if f.Safe {
+				safe = " (safe, --fix applies it)"
+			}
+			fmt.Printf("%s\n  fix%s:\n    %s\n", f, safe, f.Fix)
+		}
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d findings", len(findings))
+	}
+	fmt.Fprintln(os.Stderr, "schema matches the models")
+	return nil
+}
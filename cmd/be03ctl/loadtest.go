@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"be03/pkg/loadtest"
+)
+
+// runLoadtest drives a running server with virtual users and prints latency
+// percentiles per operation. It talks HTTP only and needs no DB_DSN.
+func runLoadtest(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:8080", "base URL of the server")
+	corpus := fs.String("corpus", "", "directory of sample receipt images (.jpg, .png)")
+	users := fs.Int("users", 10, "number of virtual users")
+	duration := fs.Duration("duration", time.Minute, "how long to run (0 with --iterations runs until done)")
+	iterations := fs.Int("iterations", 0, "upload-and-list rounds per user (0 = until --duration)")
+	prefix := fs.String("user-prefix", "loadtest", "virtual user i logs in as <prefix><i>")
+	password := fs.String("password", "", "password of the virtual users")
+	register := fs.Bool("register", false, "register the virtual users first")
+	think := fs.Duration("think", time.Second, "pause between a user's rounds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *corpus == "" || *password == "" {
+		return errors.New("--corpus and --password are required")
+	}
+	images, err := loadtest.LoadCorpus(*corpus)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	log.Printf("loadtest: %d users against %s with %d images", *users, *target, len(images))
+	rep, err := loadtest.Run(ctx, loadtest.Config{
+		Target: *target, Users: *users, Duration: *duration, Iterations: *iterations, Images: images,
+		UserPrefix: *prefix, Password: *password, Register: *register, Think: *think,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rep.WriteTo(os.Stdout)
+	return err
+}
@@ -0,0 +1,110 @@
+// Command be03ctl is the operator CLI for be03. Subcommands:
+//
+//	be03ctl seed --fixtures <file.yaml|file.json> [--create-only]
+//	be03ctl seed uploads --username <name> [--dir d] [--catatan] [--reconcile] [--batch n] [--dry-run]
+//	be03ctl user import --file <archive.zip> [--username name] [--password pw]
+//	be03ctl user purge --username <name> --yes
+//	be03ctl tokens prune [--days n] [--dry-run]
+//	be03ctl uploads relocate [--dry-run]
+//	be03ctl uploads content-types [--dry-run]
+//	be03ctl db doctor [--fix] [--format text|json]
+//	be03ctl catatan export --username <name> --format <accurate|jurnal|quickbooks> [--from d] [--to d] [--out file]
+//	be03ctl ocr calibrate [--since d] [--bins n] [--dry-run] [--format text|json]
+//	be03ctl report --username <name>|--all-users [--month m | --from d --to d] [--category c] [--account a] [--format table|json|csv] [--list]
+//	be03ctl loadtest --corpus <dir> --password pw [--target url] [--users n] [--duration d]
+//
+// All subcommands but loadtest connect to Postgres using DB_DSN.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type command struct {
+	name  string
+	usage []string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "seed", run: runSeed, usage: []string{
+		"seed --fixtures <file> [--create-only]  load a fixture set (idempotent)",
+		"seed uploads --username <name> [--dir d] [--catatan] [--reconcile] [--batch n] [--dry-run]  register receipt files as uploads, reporting store path conflicts",
+	}},
+	{name: "user", run: runUser, usage: []string{
+		"user import --file <archive.zip> [--username name] [--password pw]  restore a /me/export archive",
+		"user purge --username <name> --yes  delete an account and all its data",
+	}},
+	{name: "tokens", run: runTokens, usage: []string{
+		"tokens prune [--days n] [--dry-run]  delete refresh tokens expired or revoked more than n days ago",
+	}},
+	{name: "uploads", run: runUploads, usage: []string{
+		"uploads relocate [--dry-run]  move receipts stored before per-profile file names or under hashed sub-directories to their normalized paths",
+		"uploads content-types [--dry-run]  sniff the stored receipts and correct the content type of their uploads",
+	}},
+	{name: "db", run: runDB, usage: []string{
+		"db doctor [--fix] [--format text|json]  check tables, columns, indexes, foreign keys and orphan rows against the models; --fix applies the safe fixes",
+	}},
+	{name: "catatan", run: runCatatan, usage: []string{
+		"catatan export --username <name> --format <accurate|jurnal|quickbooks> [--from d] [--to d] [--out file]  write an accounting import file",
+	}},
+	{name: "ocr", run: runOCR, usage: []string{
+		"ocr calibrate [--since d] [--bins n] [--dry-run] [--format text|json]  fit the OCR confidence calibration to the amounts users confirmed and report per-heuristic precision",
+	}},
+	{name: "report", run: runReport, usage: []string{
+		"report --username <name>|--all-users [--month m | --from d --to d] [--category c] [--account a] [--format table|json|csv] [--list]  totals per user, category and day; exit status 3 when empty",
+	}},
+	{name: "loadtest", run: runLoadtest, usage: []string{
+		"loadtest --corpus <dir> --password pw [--target url] [--users n] [--duration d] [--iterations n] [--register]  simulate upload traffic",
+	}},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: be03ctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		for _, u := range c.usage {
+			fmt.Fprintf(os.Stderr, "  %s\n", u)
+		}
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			return
+		}
+	}
+	if name != "-h" && name != "--help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+// mustDBFromEnv opens the Postgres database named by DB_DSN.
+func mustDBFromEnv() *gorm.DB {
+	dsn := os.Getenv("DB_DSN")
+	if strings.TrimSpace(dsn) == "" {
+		log.Fatal("DB_DSN not set in environment")
+	}
+	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("failed to open db: %v", err)
+	}
+	return gdb
+}
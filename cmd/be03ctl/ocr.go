@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"be03/pkg/ocr"
+	"be03/pkg/ocrcalib"
+)
+
+// runOCR dispatches `be03ctl ocr <subcommand>`.
+func runOCR(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl ocr calibrate [flags]")
+	}
+	switch args[0] {
+	case "calibrate":
+		return runOCRCalibrate(args[1:])
+	default:
+		return fmt.Errorf("unknown ocr subcommand %q", args[0])
+	}
+}
+
+// runOCRCalibrate fits the confidence calibration to the amounts users
+// confirmed and reports each heuristic's precision, its reliability table and
+// the Brier score of the raw and calibrated confidence. Unless --dry-run the
+// fit is stored; servers and the watcher switch to it within a minute.
+func runOCRCalibrate(args []string) error {
+	fs := flag.NewFlagSet("ocr calibrate", flag.ContinueOnError)
+	since := fs.String("since", "", "only reviews recorded on or after this date (YYYY-MM-DD)")
+	bins := fs.Int("bins", ocr.DefaultCalibrationBins, "confidence bins per heuristic")
+	dryRun := fs.Bool("dry-run", false, "report the fit without storing it")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *bins < 1 || *bins > 100 {
+		return errors.New("--bins must be between 1 and 100")
+	}
+	var from *time.Time
+	if *since != "" {
+		t, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+		from = &t
+	}
+	gdb := mustDBFromEnv()
+	samples, err := ocrcalib.Samples(gdb, from)
+	if err != nil {
+		return err
+	}
+	cal := ocr.Fit(samples, *bins)
+	if !*dryRun {
+		if err := ocrcalib.Save(gdb, cal); err != nil {
+			return err
+		}
+	}
+	raw, calibrated := cal.Brier(samples)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{
+			"calibration": cal, "dry_run": *dryRun, "calibrated": cal.Calibrated(),
+			"brier": map[string]float64{"raw": raw, "calibrated": calibrated},
+		})
+	}
+	fmt.Printf("reviews: %d  kept: %d  precision: %.3f\n", cal.Samples, cal.Correct, cal.Precision)
+	fmt.Printf("brier: raw %.4f  calibrated %.4f\n", raw, calibrated)
+	for _, name := range cal.HeuristicNames() {
+		h := cal.Heuristics[name]
+		note := ""
+		if h.Samples < ocr.MinCalibrationSamples {
+			note = fmt.Sprintf("  (under %d reviews: raw confidence kept)", ocr.MinCalibrationSamples)
+		}
+		fmt.Printf("\n%s: reviews %d  kept %d  precision %.3f%s\n", name, h.Samples, h.Correct, h.Precision, note)
+		fmt.Printf("  %-11s %7s %7s %11s\n", "raw conf", "reviews", "kept", "calibrated")
+		for _, b := range h.Bins {
+			if b.Samples == 0 {
+				continue
+			}
+			fmt.Printf("  %.2f-%.2f   %7d %7d %11.3f\n", b.Lo, b.Hi, b.Samples, b.Correct, b.Probability)
+		}
+	}
+	switch {
+	case len(cal.Calibrated()) == 0:
+		fmt.Fprintf(os.Stderr, "no heuristic has %d reviews: the raw confidence stays in use\n", ocr.MinCalibrationSamples)
+	case *dryRun:
+		fmt.Fprintln(os.Stderr, "dry run: calibration not stored")
+	default:
+		fmt.Fprintln(os.Stderr, "calibration stored")
+	}
+	return nil
+}
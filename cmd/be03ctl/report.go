@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"be03/process/report"
+)
+
+// runReport prints catatan totals per user, category and day (see
+// process/report); it exits with report.ExitEmpty when nothing matched.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	var q report.Query
+	fs.StringVar(&q.Username, "username", "", "whose catatan to report")
+	fs.BoolVar(&q.AllUsers, "all-users", false, "report every user, with a section per user")
+	fs.StringVar(&q.Month, "month", "", "month to report (YYYY-MM, user's timezone)")
+	fs.StringVar(&q.From, "from", "", "first day (YYYY-MM-DD, user's timezone)")
+	fs.StringVar(&q.To, "to", "", "last day (YYYY-MM-DD, user's timezone)")
+	fs.StringVar(&q.Category, "category", "", "only catatan in this category")
+	fs.StringVar(&q.Account, "account", "", "only catatan on the account with this name")
+	fs.BoolVar(&q.List, "list", false, "list the matching catatan")
+	format := fs.String("format", report.FormatTable, "table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (q.Username == "") == !q.AllUsers {
+		return errors.New("one of --username and --all-users is required")
+	}
+	if !report.ValidFormat(*format) {
+		return errors.New("--format must be table, json or csv")
+	}
+	r, err := report.Build(mustDBFromEnv(), q)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(os.Stdout, r, *format); err != nil {
+		return err
+	}
+	if r.Empty() {
+		os.Exit(report.ExitEmpty)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/usernames"
+)
+
+// runSeed loads a fixture file and upserts it, or with `seed uploads`
+// registers receipt files. Safe to run repeatedly.
+func runSeed(args []string) error {
+	if len(args) > 0 && args[0] == "uploads" {
+		return runSeedUploads(args[1:])
+	}
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("fixtures", "", "fixture file (.yaml, .yml or .json)")
+	createOnly := fs.Bool("create-only", false, "only insert missing rows; never update existing ones")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("--fixtures is required")
+	}
+	set, err := fixtures.Load(*file)
+	if err != nil {
+		return err
+	}
+	if *createOnly {
+		set.CreateOnly = true
+	}
+	st, err := fixtures.Apply(mustDBFromEnv(), set)
+	if err != nil {
+		return err
+	}
+	log.Printf("seeded %s: %s", *file, st)
+	return nil
+}
+
+// runSeedUploads registers the receipts in a directory as uploads of one
+// user. It works on public/ of the current directory, so run it where the
+// server runs.
+func runSeedUploads(args []string) error {
+	fs := flag.NewFlagSet("seed uploads", flag.ContinueOnError)
+	dir := fs.String("dir", "public/keu", "directory of receipt images (searched recursively)")
+	username := fs.String("username", "", "owner of the uploads (current or former username)")
+	catatan := fs.Bool("catatan", false, "also create and link a catatan of amount 0 for each upload without one")
+	reconcile := fs.Bool("reconcile", false, "point uploads of the same name whose file is gone at the seeded file")
+	batch := fs.Int("batch", 100, "files written per transaction")
+	dryRun := fs.Bool("dry-run", false, "only report what would change")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+	gdb := mustDBFromEnv()
+	user, err := usernames.Resolve(gdb, *username)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", *username, err)
+	}
+	var profile models.Profile
+	if err := gdb.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		return fmt.Errorf("profile of %s: %w", *username, err)
+	}
+	res, err := uploadfiles.Seed(gdb, uploadfiles.SeedOptions{Dir: *dir, Profile: profile, Catatan: *catatan, Reconcile: *reconcile, BatchSize: *batch, DryRun: *dryRun})
+	for _, c := range res.Conflicts {
+		log.Printf("CONFLICT %s: %s (upload %d at %q, file wants %q)", c.File, c.Reason, c.UploadID, c.StorePath, c.Want)
+	}
+	verb := "seeded"
+	if *dryRun {
+		verb = "would seed"
+	}
+	log.Printf("%s %s for %s: %s", verb, *dir, user.Username, res)
+	return err
+}
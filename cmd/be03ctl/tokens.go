@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"be03/pkg/refreshtokens"
+)
+
+// runTokens dispatches `be03ctl tokens <subcommand>`.
+func runTokens(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl tokens prune [flags]")
+	}
+	switch args[0] {
+	case "prune":
+		return runTokensPrune(args[1:])
+	default:
+		return fmt.Errorf("unknown tokens subcommand %q", args[0])
+	}
+}
+
+// runTokensPrune does what the server's daily janitor does, on demand.
+func runTokensPrune(args []string) error {
+	fs := flag.NewFlagSet("tokens prune", flag.ContinueOnError)
+	days := fs.Int("days", refreshtokens.DefaultRetentionDays, "keep tokens that expired or were revoked within this many days")
+	dryRun := fs.Bool("dry-run", false, "only count the tokens that would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days < 0 {
+		return errors.New("--days must not be negative")
+	}
+	gdb := mustDBFromEnv()
+	cutoff := refreshtokens.Cutoff(time.Now(), *days)
+	if *dryRun {
+		n, err := refreshtokens.Count(gdb, cutoff)
+		if err != nil {
+			return err
+		}
+		log.Printf("would prune %d refresh tokens dead before %s", n, cutoff.Format(time.RFC3339))
+		return nil
+	}
+	n, err := refreshtokens.Prune(gdb, cutoff, refreshtokens.DefaultBatch)
+	if err != nil {
+		return err
+	}
+	log.Printf("pruned %d refresh tokens dead before %s", n, cutoff.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"be03/pkg/uploadfiles"
+)
+
+// runUploads dispatches `be03ctl uploads <subcommand>`.
+func runUploads(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl uploads relocate|content-types [flags]")
+	}
+	switch args[0] {
+	case "relocate":
+		return runUploadsRelocate(args[1:])
+	case "content-types":
+		return runUploadsContentTypes(args[1:])
+	default:
+		return fmt.Errorf("unknown uploads subcommand %q", args[0])
+	}
+}
+
+// runUploadsRelocate moves receipts stored under their plain file name, or
+// in hashed sub-directories of public/keu, to their normalized store path
+// (see storagepath.Normalize). It works on public/ of the current directory, so
+// run it where the server runs, with the watcher stopped.
+func runUploadsRelocate(args []string) error {
+	fs := flag.NewFlagSet("uploads relocate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be renamed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	res, err := uploadfiles.Relocate(mustDBFromEnv(), *dryRun)
+	verb := "relocated"
+	if *dryRun {
+		verb = "would relocate"
+	}
+	log.Printf("%s %d uploads (%d files renamed)", verb, res.Uploads, res.Moved)
+	if len(res.Missing) > 0 {
+		log.Printf("%d uploads have no file (gone, or overwritten by another upload of the same name): ids %v", len(res.Missing), res.Missing)
+	}
+	return err
+}
+
+// runUploadsContentTypes records the sniffed content type of every upload
+// whose file is found (see uploadfiles.FixContentTypes). Like relocate it
+// works on public/ of the current directory.
+func runUploadsContentTypes(args []string) error {
+	fs := flag.NewFlagSet("uploads content-types", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be corrected")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	res, err := uploadfiles.FixContentTypes(mustDBFromEnv(), *dryRun)
+	verb := "corrected"
+	if *dryRun {
+		verb = "would correct"
+	}
+	log.Printf("%s %d of %d uploads", verb, res.Fixed, res.Checked)
+	if len(res.Unsupported) > 0 {
+		log.Printf("%d uploads are not receipt images, their content type is cleared: ids %v", len(res.Unsupported), res.Unsupported)
+	}
+	if len(res.Missing) > 0 {
+		log.Printf("%d uploads have no file: ids %v", len(res.Missing), res.Missing)
+	}
+	return err
+}
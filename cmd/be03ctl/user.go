@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"be03/models"
+	"be03/pkg/accountpurge"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/userarchive"
+)
+
+// runUser dispatches `be03ctl user <subcommand>`.
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: be03ctl user import|purge [flags]")
+	}
+	switch args[0] {
+	case "import":
+		return runUserImport(args[1:])
+	case "purge":
+		return runUserPurge(args[1:])
+	default:
+		return fmt.Errorf("unknown user subcommand %q", args[0])
+	}
+}
+
+// runUserImport restores an archive produced by GET /me/export.
+func runUserImport(args []string) error {
+	fs := flag.NewFlagSet("user import", flag.ContinueOnError)
+	file := fs.String("file", "", "archive produced by GET /me/export")
+	username := fs.String("username", "", "restore under this username instead of the archived one")
+	password := fs.String("password", "", "password for a newly created user (random when empty)")
+	imageDir := fs.String("image-dir", "", "directory for restored receipt images (default public/processed)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("--file is required")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	a, err := userarchive.Read(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	res, err := userarchive.Import(mustDBFromEnv(), a, userarchive.ImportOptions{Username: *username, Password: *password, ImageDir: *imageDir})
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %s (user id=%d created=%v): catatan=%d (skipped %d) uploads=%d (skipped %d) images=%d",
+		res.Username, res.UserID, res.CreatedUser, res.Catatan, res.SkippedCatatan, res.Uploads, res.SkippedUploads, res.ImagesRestored)
+	if res.GeneratedPass != "" {
+		fmt.Printf("generated password for %s: %s\n", res.Username, res.GeneratedPass)
+	}
+	return nil
+}
+
+// runUserPurge deletes an account and all its data inline (same job as DELETE /me).
+func runUserPurge(args []string) error {
+	fs := flag.NewFlagSet("user purge", flag.ContinueOnError)
+	username := fs.String("username", "", "account to delete")
+	yes := fs.Bool("yes", false, "confirm the irreversible deletion")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+	if !*yes {
+		return errors.New("refusing to purge without --yes")
+	}
+	gdb := mustDBFromEnv()
+	var user models.User
+	if err := gdb.Where("username = ?", *username).First(&user).Error; err != nil {
+		return fmt.Errorf("user %q: %w", *username, err)
+	}
+	operator := os.Getenv("USER")
+	if operator == "" {
+		operator = "operator"
+	}
+	job, err := accountpurge.Start(gdb, user.ID, "be03ctl:"+operator)
+	if err != nil {
+		return err
+	}
+	if err := accountpurge.Run(gdb, job, uploadfiles.Candidates); err != nil {
+		return err
+	}
+	log.Printf("purged %s (user id=%d): files deleted=%d missing=%d", *username, user.ID, job.FilesDeleted, job.FilesMissing)
+	return nil
+}
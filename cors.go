@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/cors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- CORS --------------------
+
+// devOrigins apply when no ALLOWED_ORIGINS is configured: Vite's 5173 plus
+// common React ports, on localhost and 127.0.0.1.
+var devOrigins = []string{
+	"http://localhost:5173", "http://localhost:3000", "http://localhost:3001", "http://localhost:3002", "http://localhost:3003",
+	"http://127.0.0.1:5173", "http://127.0.0.1:3000", "http://127.0.0.1:3001", "http://127.0.0.1:3002", "http://127.0.0.1:3003",
+}
+
+// corsSettingKey stores origins set through PUT /admin/cors; they take
+// precedence over the environment until cleared.
+const corsSettingKey = "cors_origins"
+
+// corsRules override the default policy per path (both versioned and legacy
+// mounts): probes and the error catalog are public, webhooks are
+// server-to-server and get no CORS headers.
+func corsRules() []cors.Rule {
+	mounts := func(paths ...string) []string {
+		var out []string
+		for _, p := range paths {
+			out = append(out, p, apiPrefix+p)
+		}
+		return out
+	}
+	return []cors.Rule{
+		{Prefixes: mounts("/health", "/errors"), Policy: cors.Public},
+		{Prefixes: mounts("/ingest/", "/bots/"), Policy: cors.Off},
+	}
+}
+
+// corsHandler holds the live policy; nil until corsMiddleware runs.
+var corsHandler *cors.Handler
+
+// corsMiddleware allows cross-origin requests from ALLOWED_ORIGINS (comma
+// separated exact origins, https://*.example.com wildcards or regex:<pattern>).
+// The list is reloaded on SIGHUP (see reloadCORSOnSignal) and via
+// POST /admin/cors/reload.
+func corsMiddleware() gin.HandlerFunc {
+	p, source, err := loadCORSPolicy()
+	if err != nil {
+		log.Printf("cors: %v; falling back to development origins", err)
+		p, _ = cors.Parse(devOrigins)
+		source = "default"
+	}
+	log.Printf("cors: %d origin entries from %s", len(p.Entries()), source)
+	corsHandler = cors.New(p, corsRules()...)
+	return corsHandler.Middleware()
+}
+
+// loadCORSPolicy resolves the origins: a stored admin override, then
+// ALLOWED_ORIGINS (or the older ALLOW_ORIGINS) from .env, which wins over the
+// process environment so edits apply on reload, then the environment, then the
+// development defaults.
+func loadCORSPolicy() (*cors.Policy, string, error) {
+	if db != nil {
+		var s models.Setting
+		if err := db.Where("key = ?", corsSettingKey).First(&s).Error; err == nil {
+			var entries []string
+			if err := json.Unmarshal([]byte(s.Value), &entries); err != nil {
+				return nil, "", err
+			}
+			p, err := cors.Parse(entries)
+			return p, "admin override", err
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("cors: reading override: %v", err)
+		}
+	}
+	for _, key := range []string{"ALLOWED_ORIGINS", "ALLOW_ORIGINS"} {
+		if v, ok := dotEnvValue(key); ok && strings.TrimSpace(v) != "" {
+			p, err := cors.ParseList(v)
+			return p, ".env " + key, err
+		}
+	}
+	for _, key := range []string{"ALLOWED_ORIGINS", "ALLOW_ORIGINS"} {
+		if v := os.Getenv(key); strings.TrimSpace(v) != "" {
+			p, err := cors.ParseList(v)
+			return p, key, err
+		}
+	}
+	p, err := cors.Parse(devOrigins)
+	return p, "default", err
+}
+
+// dotEnvValue reads key from ./.env without touching the environment.
+func dotEnvValue(key string) (string, bool) {
+	f, err := os.Open(filepath.Clean(".env"))
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	val, found := "", false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if k, v, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") && strings.TrimSpace(k) == key {
+			val, found = strings.TrimSpace(v), true
+		}
+	}
+	return val, found
+}
+
+// reloadCORS re-reads the configuration and swaps the policy; on error the
+// current policy stays.
+func reloadCORS() (*cors.Policy, string, error) {
+	p, source, err := loadCORSPolicy()
+	if err != nil {
+		return nil, "", err
+	}
+	corsHandler.Set(p)
+	log.Printf("cors: reloaded %d origin entries from %s", len(p.Entries()), source)
+	return p, source, nil
+}
+
+// reloadCORSOnSignal reloads the origins whenever the process gets SIGHUP.
+func reloadCORSOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if _, _, err := reloadCORS(); err != nil {
+			log.Printf("cors: reload failed, keeping current origins: %v", err)
+		}
+	}
+}
+
+func corsView(p *cors.Policy, source string) gin.H {
+	return gin.H{"origins": p.Entries(), "source": source}
+}
+
+func getCORSHandler(c *gin.Context) {
+	_, source, _ := loadCORSPolicy()
+	c.JSON(http.StatusOK, corsView(corsHandler.Policy(), source))
+}
+
+// setCORSHandler stores an origin list that overrides the environment on every
+// server (after their next reload); "origins": null removes the override.
+func setCORSHandler(c *gin.Context) {
+	var req struct {
+		Origins []string `json:"origins"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if req.Origins == nil {
+		if err := db.Where("key = ?", corsSettingKey).Delete(&models.Setting{}).Error; err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+	} else {
+		if _, err := cors.Parse(req.Origins); err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "origins"})
+			return
+		}
+		b, _ := json.Marshal(req.Origins)
+		if err := db.Save(&models.Setting{Key: corsSettingKey, Value: string(b)}).Error; err != nil {
+			writeError(c, apierr.CreateFailed, "", nil)
+			return
+		}
+	}
+	p, source, err := reloadCORS()
+	if err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	recordAudit(c, "cors.update", gin.H{"origins": req.Origins})
+	c.JSON(http.StatusOK, corsView(p, source))
+}
+
+// reloadCORSHandler re-reads .env / the override, like SIGHUP.
+func reloadCORSHandler(c *gin.Context) {
+	p, source, err := reloadCORS()
+	if err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	recordAudit(c, "cors.reload", nil)
+	c.JSON(http.StatusOK, corsView(p, source))
+}
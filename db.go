@@ -3,27 +3,65 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"be03/models"
+	"be03/pkg/catatanstore"
+	"be03/pkg/dbhealth"
+	"be03/pkg/fixtures"
+	"be03/pkg/querylog"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 var db *gorm.DB
 
+// reportingResolver names the resolver that sends reporting reads to the
+// replica; queries opt in with Clauses(dbresolver.Use(reportingResolver)).
+const reportingResolver = "reporting"
+
+// queryLog instruments every query of db; see /admin/db-stats.
+var queryLog = querylog.New(200 * time.Millisecond)
+
 func initDB() {
 	var err error
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
 		log.Fatal("DB_DSN is not set. This project requires a Postgres DSN in DB_DSN.")
 	}
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// DB_SLOW_QUERY_MS (default 200) is the slow-query log threshold;
+	// DB_PREPARE_STMT=false turns off the prepared statement cache (needed
+	// behind pgbouncer in transaction pooling mode).
+	if ms, err := strconv.Atoi(os.Getenv("DB_SLOW_QUERY_MS")); err == nil && ms > 0 {
+		queryLog.SlowThreshold = time.Duration(ms) * time.Millisecond
+	}
+	prepare := true
+	if v := strings.ToLower(os.Getenv("DB_PREPARE_STMT")); v == "false" || v == "0" || v == "no" {
+		prepare = false
+	}
+	// wait up to DB_CONNECT_TIMEOUT for a database that is still starting
+	err = dbhealth.Retry("postgres", dbhealth.BackoffFromEnv(), func() error {
+		var err error
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{PrepareStmt: prepare, Logger: queryLog})
+		return err
+	})
 	if err != nil {
 		log.Fatal("failed to connect postgres database:", err)
 	}
+	watchDB()
+	initTenancy()
+	// DB_DSN_REPLICA (optional) serves the reporting queries; everything else,
+	// including writes and auth lookups, stays on the primary.
+	if replica := os.Getenv("DB_DSN_REPLICA"); replica != "" {
+		if err := useReplica(db, postgres.Open(replica)); err != nil {
+			log.Fatal("failed to connect postgres replica:", err)
+		}
+		log.Printf("reporting queries use the read replica")
+	}
 	// Control schema migrations with env DB_AUTO_MIGRATE (default true). Any permission errors will be logged and ignored.
 	shouldMigrate := true
 	if v := os.Getenv("DB_AUTO_MIGRATE"); v != "" {
@@ -39,13 +77,8 @@ func initDB() {
 		}
 	}
 	// seed master roles immediately
-	roles := []models.Role{{Name: "administrator", Description: "full access"}, {Name: "user", Description: "regular user"}}
-	for _, r := range roles {
-		var cnt int64
-		db.Model(&models.Role{}).Where("name = ?", r.Name).Count(&cnt)
-		if cnt == 0 {
-			db.Create(&r)
-		}
+	if _, err := fixtures.Apply(db, &fixtures.Set{CreateOnly: true, Roles: fixtures.DefaultRoles()}); err != nil {
+		log.Printf("seeding roles failed: %v", err)
 	}
 
 	// Now migrate the rest (users will get FK to roles)
@@ -54,6 +87,11 @@ func initDB() {
 		if err := db.AutoMigrate(&models.User{}); err != nil {
 			log.Printf("migration warning (users): %v", err)
 		}
+		// rows recorded before the unique content hash / reference indexes
+		// may share a key; creating the index would fail on them
+		if err := catatanstore.ClearDuplicateKeys(db); err != nil {
+			log.Printf("migration warning (catatan_keuangans duplicates): %v", err)
+		}
 		if err := db.AutoMigrate(&models.CatatanKeuangan{}); err != nil {
 			log.Printf("migration warning (catatan_keuangans): %v", err)
 		}
@@ -66,6 +104,87 @@ func initDB() {
 		if err := db.AutoMigrate(&models.RefreshToken{}); err != nil {
 			log.Printf("migration warning (refresh_tokens): %v", err)
 		}
+		if err := db.AutoMigrate(&models.Preferences{}); err != nil {
+			log.Printf("migration warning (preferences): %v", err)
+		}
+		if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+			log.Printf("migration warning (audit_logs): %v", err)
+		}
+		if err := db.AutoMigrate(&models.PurgeJob{}); err != nil {
+			log.Printf("migration warning (purge_jobs): %v", err)
+		}
+		if err := db.AutoMigrate(&models.ChatLink{}); err != nil {
+			log.Printf("migration warning (chat_links): %v", err)
+		}
+		if err := db.AutoMigrate(&models.ChatLinkCode{}); err != nil {
+			log.Printf("migration warning (chat_link_codes): %v", err)
+		}
+		if err := db.AutoMigrate(&models.PeriodLock{}); err != nil {
+			log.Printf("migration warning (period_locks): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Account{}); err != nil {
+			log.Printf("migration warning (accounts): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Goal{}); err != nil {
+			log.Printf("migration warning (goals): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Notification{}); err != nil {
+			log.Printf("migration warning (notifications): %v", err)
+		}
+		if err := db.AutoMigrate(&models.NotificationDelivery{}); err != nil {
+			log.Printf("migration warning (notification_deliveries): %v", err)
+		}
+		if err := db.AutoMigrate(&models.PushSubscription{}); err != nil {
+			log.Printf("migration warning (push_subscriptions): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Setting{}); err != nil {
+			log.Printf("migration warning (settings): %v", err)
+		}
+		if err := db.AutoMigrate(&models.CatatanArchive{}); err != nil {
+			log.Printf("migration warning (catatan_archives): %v", err)
+		}
+		if err := db.AutoMigrate(&models.UploadOCRText{}); err != nil {
+			log.Printf("migration warning (upload_ocr_texts): %v", err)
+		}
+		if err := db.AutoMigrate(&models.UploadPHashBand{}); err != nil {
+			log.Printf("migration warning (upload_phash_bands): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Organization{}, &models.OrgMembership{}, &models.OrgInvite{}); err != nil {
+			log.Printf("migration warning (organizations): %v", err)
+		}
+		if err := db.AutoMigrate(&models.ExportMapping{}); err != nil {
+			log.Printf("migration warning (export_mappings): %v", err)
+		}
+		if err := db.AutoMigrate(&models.APIToken{}); err != nil {
+			log.Printf("migration warning (api_tokens): %v", err)
+		}
+		if err := db.AutoMigrate(&models.ExchangeRate{}); err != nil {
+			log.Printf("migration warning (exchange_rates): %v", err)
+		}
+		if err := db.AutoMigrate(&models.UploadItem{}); err != nil {
+			log.Printf("migration warning (upload_items): %v", err)
+		}
+		if err := db.AutoMigrate(&models.UsernameHistory{}); err != nil {
+			log.Printf("migration warning (username_histories): %v", err)
+		}
+		if err := db.AutoMigrate(&models.FeatureFlag{}); err != nil {
+			log.Printf("migration warning (feature_flags): %v", err)
+		}
+		if err := db.AutoMigrate(&models.JobLock{}, &models.JobRun{}); err != nil {
+			log.Printf("migration warning (job_locks, job_runs): %v", err)
+		}
+		if err := db.AutoMigrate(&models.Tenant{}); err != nil {
+			log.Printf("migration warning (tenants): %v", err)
+		}
+		if err := db.AutoMigrate(&models.SavedView{}); err != nil {
+			log.Printf("migration warning (saved_views): %v", err)
+		}
+		if err := db.AutoMigrate(&models.UploadNote{}); err != nil {
+			log.Printf("migration warning (upload_notes): %v", err)
+		}
+		if err := db.AutoMigrate(&models.OCRShadowRun{}); err != nil {
+			log.Printf("migration warning (ocr_shadow_runs): %v", err)
+		}
 	}
 
 	// Ensure uploads -> profiles FK exists (in case table existed before adding ProfileID)
@@ -110,53 +229,15 @@ func ensureUploadProfileFK() error {
 	return nil
 }
 
+// seedDB applies the built-in default fixture set (master roles, admin user and
+// profile). It only creates missing rows, so edits made after boot are preserved.
 func seedDB() {
-	// Ensure master roles exist
-	roles := []models.Role{{Name: "administrator", Description: "full access"}, {Name: "user", Description: "regular user"}}
-	for _, r := range roles {
-		var cnt int64
-		db.Model(&models.Role{}).Where("name = ?", r.Name).Count(&cnt)
-		if cnt == 0 {
-			db.Create(&r)
-		}
-	}
-
-	// Check if admin user exists
-	var count int64
-	db.Model(&models.User{}).Where("username = ?", "admin").Count(&count)
-	if count == 0 {
-		// find administrator role id
-		var role models.Role
-		if err := db.Where("name = ?", "administrator").First(&role).Error; err != nil {
-			log.Printf("failed to find administrator role: %v", err)
-		}
-		// Seed admin user
-		rid := role.ID
-		admin := models.User{
-			Username: "admin",
-			RoleID:   &rid,
-		}
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
-		admin.HashedPassword = hashedPassword
-		db.Create(&admin)
+	st, err := fixtures.Apply(db, fixtures.Default())
+	if err != nil {
+		log.Printf("seeding defaults failed: %v", err)
+	} else if st.Created["users"] > 0 {
 		log.Println("Seeded admin user: username=admin, password=admin123")
 	}
-	// Ensure admin has a one-to-one profile
-	var admin models.User
-	if err := db.Where("username = ?", "admin").First(&admin).Error; err != nil {
-		log.Printf("failed to find admin user after seeding: %v", err)
-		return
-	}
-	var pcount int64
-	db.Model(&models.Profile{}).Where("user_id = ?", admin.ID).Count(&pcount)
-	if pcount == 0 {
-		profile := models.Profile{UserID: admin.ID, Name: "Administrator", Email: "admin@example.com"}
-		if err := db.Create(&profile).Error; err != nil {
-			log.Printf("failed to create profile for admin: %v", err)
-		} else {
-			log.Println("Seeded admin profile for user id:", admin.ID)
-		}
-	}
 	// Ensure upload directory exists
 	ensureUploadBase()
 }
@@ -176,3 +257,9 @@ func uploadBaseDir() string {
 	}
 	return "uploads"
 }
+
+// useReplica registers replica under reportingResolver. The resolver is not
+// global, so only statements that ask for it are routed there.
+func useReplica(gdb *gorm.DB, replica gorm.Dialector) error {
+	return gdb.Use(dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{replica}}, reportingResolver))
+}
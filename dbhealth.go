@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/dbhealth"
+	"be03/pkg/errreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- database outages --------------------
+
+// dbBreaker opens after repeated connection failures; initDB configures it
+// from DB_BREAKER_THRESHOLD / DB_BREAKER_COOLDOWN.
+var dbBreaker = &dbhealth.Breaker{Threshold: 5, Cooldown: 15 * time.Second}
+
+// watchDB feeds gdb's statements to a fresh breaker from the environment.
+func watchDB() {
+	dbBreaker = dbhealth.BreakerFromEnv()
+	dbBreaker.OnChange = logBreakerChange("api")
+	if err := dbhealth.Watch(db, dbBreaker); err != nil {
+		log.Printf("database health callbacks: %v", err)
+	}
+}
+
+// logBreakerChange logs and reports the breaker opening and closing, once per
+// change rather than for every failed request.
+func logBreakerChange(service string) func(bool, error) {
+	return func(open bool, err error) {
+		if !open {
+			log.Printf("database reachable again (%s)", service)
+			return
+		}
+		log.Printf("database unreachable (%s): %v", service, err)
+		errreport.Capture(errreport.Event{Message: "database unreachable", Err: err, Tags: map[string]string{"kind": "db", "service": service}})
+	}
+}
+
+// dbUnavailable answers 503 db_unavailable with a Retry-After hint.
+func dbUnavailable(c *gin.Context) {
+	secs := int((dbBreaker.RetryAfter() + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(secs))
+	writeError(c, apierr.DBUnavailable, "", gin.H{"retry_after_seconds": secs})
+}
+
+// dbAvailableMiddleware rejects requests with 503 while the breaker is open,
+// letting one through per cooldown to find out whether the database is back.
+// Health checks always go through.
+func dbAvailableMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasSuffix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+		if ok, _ := dbBreaker.Allow(); !ok {
+			dbUnavailable(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authLookupFailed answers 503 instead of 401 when a credential lookup failed
+// because the database is unreachable, so clients keep their session.
+func authLookupFailed(c *gin.Context, err error) bool {
+	if !dbhealth.IsConnError(err) {
+		return false
+	}
+	dbUnavailable(c)
+	return true
+}
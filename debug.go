@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- debug --------------------
+
+// startedAt is reported as the process uptime by /debug/vars.
+var startedAt = time.Now()
+
+// ocrCounters track OCR calls made by the API process.
+type ocrCounters struct {
+	inFlight, peak, calls, failed, nanos atomic.Int64
+}
+
+var ocrStats ocrCounters
+
+// extractOCR runs ocrEngine.Extract on path, counting the call in ocrStats.
+// A receipt without an amount is a result, not a failure.
+func extractOCR(path string) (*ocr.Result, error) {
+	n := ocrStats.inFlight.Add(1)
+	for p := ocrStats.peak.Load(); n > p && !ocrStats.peak.CompareAndSwap(p, n); p = ocrStats.peak.Load() {
+	}
+	start := time.Now()
+	res, err := ocrEngine.Extract(path)
+	ocrStats.nanos.Add(int64(time.Since(start)))
+	ocrStats.calls.Add(1)
+	if err != nil && !errors.Is(err, ocr.ErrNoAmount) {
+		ocrStats.failed.Add(1)
+		reportOCRFailure(path, err)
+	}
+	ocrStats.inFlight.Add(-1)
+	return res, err
+}
+
+// debugEnabled reports whether DEBUG_ENDPOINTS turns on /debug/pprof and
+// /debug/vars; they are off by default.
+func debugEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("DEBUG_ENDPOINTS"))) {
+	case "on", "true", "1", "yes":
+		return true
+	}
+	return false
+}
+
+const debugTokenKey = "debug_token"
+
+// debugToken accepts the X-Debug-Token header when it matches DEBUG_TOKEN, so
+// profiles can be fetched with curl without logging in; any other request
+// must carry a platform administrator's JWT.
+func debugToken() gin.HandlerFunc {
+	auth := jwtAuthMiddleware()
+	return func(c *gin.Context) {
+		secret, got := os.Getenv("DEBUG_TOKEN"), c.GetHeader("X-Debug-Token")
+		if secret != "" && got != "" {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+				writeError(c, apierr.Unauthorized, "invalid debug token", nil)
+				return
+			}
+			c.Set(debugTokenKey, true)
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
+// requireDebugAccess lets token holders through and applies check to every
+// other request. Profiles and vars cover every tenant of the process, so
+// registerDebug checks for a platform administrator, not a tenant's.
+func requireDebugAccess(check gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(debugTokenKey) {
+			c.Next()
+			return
+		}
+		check(c)
+	}
+}
+
+// registerDebug mounts net/http/pprof under /debug/pprof and the runtime
+// summary at /debug/vars when debugEnabled.
+func registerDebug(r *gin.Engine) {
+	if !debugEnabled() {
+		return
+	}
+	dbg := r.Group("/debug")
+	dbg.Use(debugToken(), requireDebugAccess(requireAdmin()), requireDebugAccess(requirePlatformAdmin()))
+	dbg.GET("/vars", debugVarsHandler)
+	dbg.GET("/pprof/*name", pprofHandler)
+	dbg.POST("/pprof/*name", pprofHandler)
+}
+
+// pprofHandler dispatches to the net/http/pprof handlers; pprof.Index serves
+// the index page and every named profile (heap, goroutine, allocs, ...).
+func pprofHandler(c *gin.Context) {
+	switch strings.TrimPrefix(c.Param("name"), "/") {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// debugVarsHandler reports goroutines, heap and GC figures, the OCR counters
+// and the totals of the cleanup jobs.
+func debugVarsHandler(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	calls := ocrStats.calls.Load()
+	avg := int64(0)
+	if calls > 0 {
+		avg = ocrStats.nanos.Load() / calls / int64(time.Millisecond)
+	}
+	var lastRun *time.Time
+	if ts := tokenJanitorStats.lastRunUnix.Load(); ts > 0 {
+		t := time.Unix(ts, 0).UTC()
+		lastRun = &t
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"go_version": runtime.Version(),
+		"uptime_s":   int64(time.Since(startedAt).Seconds()),
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"heap": gin.H{
+			"alloc_bytes":   m.HeapAlloc,
+			"inuse_bytes":   m.HeapInuse,
+			"sys_bytes":     m.HeapSys,
+			"objects":       m.HeapObjects,
+			"total_alloc":   m.TotalAlloc,
+			"sys_total":     m.Sys,
+			"num_gc":        m.NumGC,
+			"gc_pause_ms":   m.PauseTotalNs / uint64(time.Millisecond),
+			"next_gc_bytes": m.NextGC,
+		},
+		"refresh_token_janitor": gin.H{
+			"runs":         tokenJanitorStats.runs.Load(),
+			"pruned_total": tokenJanitorStats.pruned.Load(),
+			"last_pruned":  tokenJanitorStats.lastPruned.Load(),
+			"last_run":     lastRun,
+		},
+		"file_gc": gin.H{
+			"runs":          fileGCStats.runs.Load(),
+			"files_removed": fileGCStats.files.Load(),
+			"bytes_removed": fileGCStats.bytes.Load(),
+		},
+		"ocr": gin.H{
+			"in_flight": ocrStats.inFlight.Load(),
+			"peak":      ocrStats.peak.Load(),
+			"calls":     calls,
+			"failed":    ocrStats.failed.Load(),
+			"avg_ms":    avg,
+			"pixels":    ocr.Stats(),
+			"shadow":    ocrexp.CurrentStats(),
+		},
+	})
+}
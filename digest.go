@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/digest"
+	"be03/pkg/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- weekly digest --------------------
+
+// sendDigests is the weekly_digest job: it sends last week's digest to users
+// whose week has rolled over.
+func sendDigests(context.Context) (string, error) {
+	n, err := digest.SendDue(db, time.Now())
+	return fmt.Sprintf("sent %d weekly digests", n), err
+}
+
+// digestPreviewHandler shows the digest of the week containing ?week=YYYY-MM-DD
+// (default: last week) as it would be sent, without sending it.
+func digestPreviewHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	prefs := loadPreferences(user.ID)
+	loc := prefs.Location()
+	at := time.Now().AddDate(0, 0, -7)
+	if v := c.Query("week"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "week must be YYYY-MM-DD", gin.H{"field": "week"})
+			return
+		}
+		at = t
+	}
+	from, to := digest.WeekOf(at, loc)
+	d, err := digest.Compile(reportDB(c), user.ID, from, to)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	data := d.Data(loc)
+	data["Currency"] = prefs.Currency
+	title, body, err := notify.Render(notify.KindWeeklySummary, prefs.Language, data)
+	if err != nil {
+		writeError(c, apierr.Internal, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"digest": d, "title": title, "body": body, "empty": d.Empty()})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/phash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- near-duplicate receipts --------------------
+
+// maxDuplicatePairs caps GET /admin/duplicates.
+const maxDuplicatePairs = 500
+
+// similarDistance is how many bits two perceptual hashes may differ in and
+// still count as the same receipt (PHASH_MAX_DISTANCE, default
+// phash.DefaultDistance, at most phash.MaxDistance).
+func similarDistance() int {
+	if n, err := strconv.Atoi(os.Getenv("PHASH_MAX_DISTANCE")); err == nil && n >= 0 && n <= phash.MaxDistance {
+		return n
+	}
+	return phash.DefaultDistance
+}
+
+// indexImage records the perceptual hash of data as the image of up and
+// returns userID's other uploads that look like it. Near-duplicate detection
+// is advisory, so failures are only logged.
+func indexImage(userID uint, up *models.Upload, data []byte) []phash.Match {
+	h, ok := phash.Compute(data)
+	if !ok {
+		return nil
+	}
+	if err := phash.Index(db, up, h); err != nil {
+		log.Printf("phash: indexing upload=%d: %v", up.ID, err)
+		return nil
+	}
+	similar, err := phash.Similar(db, userID, up.ID, h, similarDistance())
+	if err != nil {
+		log.Printf("phash: similar uploads of upload=%d: %v", up.ID, err)
+		return nil
+	}
+	return similar
+}
+
+// adminDuplicatesHandler reports pairs of uploads of the same user whose
+// images look alike, e.g. a receipt uploaded again as a screenshot.
+// max_distance (bits) defaults to PHASH_MAX_DISTANCE; limit to 100.
+func adminDuplicatesHandler(c *gin.Context) {
+	maxDist := similarDistance()
+	if v := c.Query("max_distance"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > phash.MaxDistance {
+			writeError(c, apierr.InvalidBody, fmt.Sprintf("max_distance must be between 0 and %d", phash.MaxDistance), gin.H{"field": "max_distance"})
+			return
+		}
+		maxDist = n
+	}
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDuplicatePairs {
+			writeError(c, apierr.InvalidBody, fmt.Sprintf("limit must be between 1 and %d", maxDuplicatePairs), gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	pairs, err := phash.Duplicates(reportDB(c), maxDist, limit)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"max_distance": maxDist, "pairs": pairs})
+}
@@ -0,0 +1,4116 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/chatbot"
+	"be03/pkg/dbhealth"
+	"be03/pkg/errreport"
+	"be03/pkg/exifmeta"
+	"be03/pkg/exifmeta/exiftest"
+	"be03/pkg/fixtures"
+	"be03/pkg/fxrates"
+	"be03/pkg/hooks"
+	"be03/pkg/maintenance"
+	"be03/pkg/notify"
+	"be03/pkg/ocr"
+	"be03/pkg/ocr/ocrtest"
+	"be03/pkg/ocrcalib"
+	"be03/pkg/ocrexp"
+	"be03/pkg/querylog"
+	"be03/pkg/scheduler"
+	"be03/pkg/storage/storagetest"
+	"be03/pkg/storagepath"
+	"be03/pkg/tenancy"
+	"be03/pkg/testenv"
+	"be03/pkg/uploadfiles"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupE2E wires the API to an in-memory database and a scripted OCR engine. Unlike
+// setupTestServer it needs neither Postgres nor tesseract, so it always runs.
+func setupE2E(t *testing.T, sets ...*fixtures.Set) (*gin.Engine, *ocrtest.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	testenv.Chdir(t)
+	prevDB, prevEngine, prevSecret := db, ocrEngine, jwtSecret
+	db = testenv.OpenDB(t, sets...)
+	fake := ocrtest.New()
+	ocrEngine = fake
+	jwtSecret = []byte("e2e-secret")
+	t.Cleanup(func() { db, ocrEngine, jwtSecret = prevDB, prevEngine, prevSecret })
+	r := gin.New()
+	setupRoutes(r)
+	return r, fake
+}
+
+func loginToken(t *testing.T, r http.Handler, username, password string) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBuffer(body), "", "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("login %s failed status=%d body=%s", username, resp.Code, resp.Body.String())
+	}
+	var out map[string]any
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	token, _ := out["access_token"].(string)
+	if token == "" {
+		t.Fatalf("empty token for %s: %v", username, out)
+	}
+	return token
+}
+
+func uploadFile(r http.Handler, token, name string, data []byte) *httpResult {
+	return uploadFileWith(r, token, name, data, nil)
+}
+
+// uploadFileWith is uploadFile with extra form fields.
+func uploadFileWith(r http.Handler, token, name string, data []byte, fields map[string]string) *httpResult {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	_ = mw.WriteField("folder", "keu")
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	w, _ := mw.CreateFormFile("file", name)
+	_, _ = w.Write(data)
+	_ = mw.Close()
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/uploads", buf, token, mw.FormDataContentType())
+	res := &httpResult{Code: resp.Code, Raw: resp.Body.String()}
+	_ = json.Unmarshal(resp.Body.Bytes(), &res.Body)
+	return res
+}
+
+type httpResult struct {
+	Code int
+	Raw  string
+	Body map[string]any
+}
+
+var demoUser = &fixtures.Set{Users: []fixtures.User{{Username: "demo", Password: "demo1234", Role: "user"}}}
+
+func TestE2EUploadCreatesCatatan(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("struk.jpg", 125000, "Rp 125.000")
+	token := loginToken(t, r, "demo", "demo1234")
+
+	res := uploadFile(r, token, "struk.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload failed status=%d body=%s", res.Code, res.Raw)
+	}
+	if res.Body["catatan_id"] == nil {
+		t.Fatalf("expected catatan_id in response: %s", res.Raw)
+	}
+	var ct models.CatatanKeuangan
+	if err := db.Where("file_name = ?", "struk.jpg").First(&ct).Error; err != nil {
+		t.Fatalf("catatan not created: %v", err)
+	}
+	if ct.Amount != 125000 {
+		t.Fatalf("amount = %d, want 125000", ct.Amount)
+	}
+	var up models.Upload
+	if err := db.Where("file_name = ?", "struk.jpg").First(&up).Error; err != nil {
+		t.Fatalf("upload row missing: %v", err)
+	}
+	if up.KeuanganID == nil || *up.KeuanganID != ct.ID || up.Failed || up.ContentType != "image/jpeg" {
+		t.Fatalf("upload not linked: %+v", up)
+	}
+	// the content decides, not the name
+	if res := uploadFile(r, token, "notes.jpg", []byte("just some text")); res.Code != http.StatusBadRequest || res.Body["error"] != "unsupported_type" {
+		t.Fatalf("text named .jpg: %d %s", res.Code, res.Raw)
+	}
+}
+
+func TestE2EUploadWithoutAmountFails(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	res := uploadFile(r, token, "logo.jpg", testenv.JPEG)
+	if res.Code != http.StatusBadRequest || res.Body["error"] != "amount_not_found" {
+		t.Fatalf("expected amount_not_found, got status=%d body=%s", res.Code, res.Raw)
+	}
+	var up models.Upload
+	if err := db.Where("file_name = ?", "logo.jpg").First(&up).Error; err != nil {
+		t.Fatalf("upload row missing: %v", err)
+	}
+	if !up.Failed || up.KeuanganID != nil {
+		t.Fatalf("expected failed, unlinked upload: %+v", up)
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("expected no catatan, got %d", n)
+	}
+}
+
+func TestE2EAdminUploadCreatesNoCatatan(t *testing.T) {
+	r, fake := setupE2E(t)
+	fake.Amount("admin.jpg", 50000, "Rp 50.000")
+	token := loginToken(t, r, "admin", "admin123")
+
+	res := uploadFile(r, token, "admin.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload failed status=%d body=%s", res.Code, res.Raw)
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("administrator upload created %d catatan", n)
+	}
+}
+
+func TestE2EOCRErrorIsServerError(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Set("broken.jpg", ocrtest.Script{Err: errors.New("tesseract crashed")})
+	token := loginToken(t, r, "demo", "demo1234")
+
+	res := uploadFile(r, token, "broken.jpg", testenv.JPEG)
+	if res.Code != http.StatusInternalServerError || res.Body["error"] != "ocr_error" {
+		t.Fatalf("expected ocr_error, got status=%d body=%s", res.Code, res.Raw)
+	}
+}
+
+func TestE2EVersionedAndLegacyRoutes(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	body, _ := json.Marshal(map[string]string{"username": "demo", "password": "demo1234"})
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBuffer(body), "", "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("v1 login failed status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Deprecation") != "" || resp.Header().Get("API-Version") != "v1" {
+		t.Fatalf("unexpected v1 headers: %v", resp.Header())
+	}
+
+	resp = performRequest(r, http.MethodPost, "/login", bytes.NewBuffer(body), "", "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("legacy login failed status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Deprecation") != "true" || resp.Header().Get("Link") != `</api/v1/login>; rel="successor-version"` {
+		t.Fatalf("legacy route missing deprecation headers: %v", resp.Header())
+	}
+
+	resp = performRequest(r, http.MethodGet, "/api/v2/catatan", nil, "", "")
+	if resp.Code != http.StatusNotFound || !bytes.Contains(resp.Body.Bytes(), []byte("unsupported_api_version")) {
+		t.Fatalf("expected unsupported_api_version, got %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EErrorEnvelope(t *testing.T) {
+	r, _ := setupE2E(t)
+
+	req := performRequestWithHeader(r, http.MethodGet, apiPrefix+"/catatan", "X-Request-ID", "client-req-42")
+	if req.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", req.Code)
+	}
+	var env map[string]any
+	if err := json.Unmarshal(req.Body.Bytes(), &env); err != nil {
+		t.Fatalf("error body is not JSON: %s", req.Body.String())
+	}
+	if env["code"] != "unauthorized" || env["error"] != "unauthorized" || env["request_id"] != "client-req-42" {
+		t.Fatalf("unexpected envelope: %v", env)
+	}
+	if req.Header().Get("X-Request-ID") != "client-req-42" {
+		t.Fatalf("request id not echoed: %v", req.Header())
+	}
+
+	req = performRequestWithHeader(r, http.MethodGet, "/no/such/route", "X-Request-ID", "bad id with spaces")
+	env = map[string]any{}
+	_ = json.Unmarshal(req.Body.Bytes(), &env)
+	if req.Code != http.StatusNotFound || env["code"] != "not_found" {
+		t.Fatalf("unexpected 404 envelope: %d %v", req.Code, env)
+	}
+	if id, _ := env["request_id"].(string); id == "" || id == "bad id with spaces" {
+		t.Fatalf("expected a minted request id, got %q", id)
+	}
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/errors", nil, "", "")
+	if resp.Code != http.StatusOK || !bytes.Contains(resp.Body.Bytes(), []byte(`"amount_not_found"`)) {
+		t.Fatalf("error catalog missing: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func performRequestWithHeader(r http.Handler, method, path, key, value string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set(key, value)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestE2EPreferences(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/me/preferences", nil, token, "")
+	var prefs map[string]any
+	_ = json.Unmarshal(resp.Body.Bytes(), &prefs)
+	if resp.Code != http.StatusOK || prefs["currency"] != "IDR" || prefs["timezone"] != "Asia/Jakarta" {
+		t.Fatalf("unexpected defaults: %d %s", resp.Code, resp.Body.String())
+	}
+
+	body := bytes.NewBufferString(`{"timezone":"Asia/Makassar","language":"en","review_low_confidence":true}`)
+	resp = performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", body, token, "application/json")
+	prefs = map[string]any{}
+	_ = json.Unmarshal(resp.Body.Bytes(), &prefs)
+	if resp.Code != http.StatusOK || prefs["timezone"] != "Asia/Makassar" || prefs["language"] != "en" || prefs["currency"] != "IDR" || prefs["review_low_confidence"] != true {
+		t.Fatalf("unexpected update result: %d %s", resp.Code, resp.Body.String())
+	}
+
+	for _, bad := range []string{`{"timezone":"Mars/Olympus"}`, `{"currency":"rupiah"}`, `{"notify_webhook":true}`,
+		`{"webhook_url":"http://hooks.example.com/keu"}`, `{"webhook_url":"https://169.254.169.254/latest"}`, `{"webhook_url":"https://localhost:8080/"}`} {
+		resp = performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", bytes.NewBufferString(bad), token, "application/json")
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", bad, resp.Code)
+		}
+	}
+	var p models.Preferences
+	db.Joins("JOIN users ON users.id = preferences.user_id").Where("users.username = ?", "demo").First(&p)
+	if p.Timezone != "Asia/Makassar" {
+		t.Fatalf("stored timezone = %q", p.Timezone)
+	}
+}
+
+func TestE2EDeleteAccount(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	resp := performRequest(r, http.MethodDelete, apiPrefix+"/me", bytes.NewBufferString(`{"password":"wrong"}`), token, "application/json")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d", resp.Code)
+	}
+	resp = performRequest(r, http.MethodDelete, apiPrefix+"/me", bytes.NewBufferString(`{"password":"demo1234"}`), token, "application/json")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("delete failed: %d %s", resp.Code, resp.Body.String())
+	}
+	var out map[string]any
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	statusURL, _ := out["status_url"].(string)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp = performRequest(r, http.MethodGet, statusURL, nil, "", "")
+		var st map[string]any
+		_ = json.Unmarshal(resp.Body.Bytes(), &st)
+		if st["status"] == "done" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("purge did not finish: %s", resp.Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	body, _ := json.Marshal(map[string]string{"username": "demo", "password": "demo1234"})
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBuffer(body), "", "application/json")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("deleted user can still log in: %d", resp.Code)
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/me/preferences", nil, token, "")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("access token of deleted user still accepted: %d", resp.Code)
+	}
+}
+
+func TestE2ESuspectAmountNeedsConfirmation(t *testing.T) {
+	set := &fixtures.Set{Users: demoUser.Users}
+	for i, amt := range []int64{50000, 75000, 120000, 60000, 90000} {
+		set.Catatan = append(set.Catatan, fixtures.Catatan{User: "demo", FileName: fmt.Sprintf("old-%d.jpg", i), Amount: amt, Date: "2025-08-01"})
+	}
+	r, fake := setupE2E(t, set)
+	fake.Amount("cents.jpg", 8_500_000_00, "Rp 8.500.000,00")
+	token := loginToken(t, r, "demo", "demo1234")
+
+	res := uploadFile(r, token, "cents.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK || res.Body["suspect"] != true {
+		t.Fatalf("expected suspect upload, got %d %s", res.Code, res.Raw)
+	}
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/suspect", nil, token, "")
+	var items []models.CatatanKeuangan
+	_ = json.Unmarshal(resp.Body.Bytes(), &items)
+	if resp.Code != http.StatusOK || len(items) != 1 || items[0].FileName != "cents.jpg" {
+		t.Fatalf("unexpected suspect list: %d %s", resp.Code, resp.Body.String())
+	}
+
+	path := fmt.Sprintf("%s/catatan/%d/confirm", apiPrefix, items[0].ID)
+	resp = performRequest(r, http.MethodPost, path, bytes.NewBufferString(`{"amount":8500000}`), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("confirm failed: %d %s", resp.Code, resp.Body.String())
+	}
+	var ct models.CatatanKeuangan
+	db.First(&ct, items[0].ID)
+	if ct.Suspect || ct.Amount != 8500000 || ct.ConfirmedAt == nil {
+		t.Fatalf("confirmation not stored: %+v", ct)
+	}
+}
+
+func TestE2EUploadsSearch(t *testing.T) {
+	set := &fixtures.Set{
+		Users: demoUser.Users,
+		Uploads: []fixtures.Upload{
+			{User: "demo", FileName: "Struk_Indomaret.jpg", ContentType: "image/jpeg"},
+			{User: "demo", FileName: "transfer-bca.png", ContentType: "image/png", Failed: true, FailedReason: "amount not found"},
+			{User: "demo", FileName: "struk-alfa.jpg", ContentType: "image/jpeg"},
+			{User: "demo", FileName: "struk%odd.jpg", ContentType: "image/jpeg"},
+		},
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "struk-alfa.jpg", Amount: 10000}},
+	}
+	r, _ := setupE2E(t, set)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	list := func(query string) []string {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/uploads?"+query, nil, token, "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: status %d %s", query, resp.Code, resp.Body.String())
+		}
+		var ups []models.Upload
+		_ = json.Unmarshal(resp.Body.Bytes(), &ups)
+		names := []string{}
+		for _, u := range ups {
+			names = append(names, u.FileName)
+		}
+		return names
+	}
+	check := func(query string, want ...string) {
+		t.Helper()
+		got := list(query)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+	check("failed=true", "transfer-bca.png")
+	check("unlinked=true&failed=false&sort=file_name", "Struk_Indomaret.jpg", "struk%odd.jpg")
+	check("content_type=image/png", "transfer-bca.png")
+	check("file_name_like=STRUK&sort=file_name", "Struk_Indomaret.jpg", "struk%odd.jpg", "struk-alfa.jpg")
+	check("file_name_like=k%25o", "struk%odd.jpg")
+	check("sort=-file_name&limit=1&offset=1", "struk-alfa.jpg")
+
+	for _, bad := range []string{"failed=maybe", "sort=amount", "limit=0", "offset=-1"} {
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/uploads?"+bad, nil, token, "")
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", bad, resp.Code)
+		}
+	}
+}
+
+func TestE2EAdminCleanup(t *testing.T) {
+	set := &fixtures.Set{
+		Users: demoUser.Users,
+		Uploads: []fixtures.Upload{
+			{User: "demo", FileName: "zero.jpg"},
+			{User: "demo", FileName: "ok.jpg"},
+		},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "zero.jpg", Amount: 0, Date: "2025-08-02"},
+			{User: "demo", FileName: "ok.jpg", Amount: 15000, Date: "2025-08-02"},
+		},
+	}
+	r, _ := setupE2E(t, set)
+	userToken := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+
+	body := `{"username":"demo","zero_amount_only":true}`
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/cleanup", bytes.NewBufferString(body), userToken, "application/json")
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin cleanup: status = %d", resp.Code)
+	}
+
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/cleanup", bytes.NewBufferString(body), adminToken, "application/json")
+	var out struct {
+		Result struct {
+			DryRun          bool  `json:"dry_run"`
+			Catatan         int64 `json:"catatan"`
+			UploadsUnlinked int64 `json:"uploads_unlinked"`
+		} `json:"result"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || !out.Result.DryRun || out.Result.Catatan != 1 || out.Result.UploadsUnlinked != 1 {
+		t.Fatalf("unexpected preview: %d %s", resp.Code, resp.Body.String())
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("dry run deleted rows: %d left", n)
+	}
+
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/cleanup", bytes.NewBufferString(`{"dry_run":false}`), adminToken, "application/json")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("unscoped cleanup without confirm_all: status = %d", resp.Code)
+	}
+
+	body = `{"username":"demo","zero_amount_only":true,"dry_run":false}`
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/cleanup", bytes.NewBufferString(body), adminToken, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("cleanup failed: %d %s", resp.Code, resp.Body.String())
+	}
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	var up models.Upload
+	db.Where("file_name = ?", "zero.jpg").First(&up)
+	if n != 1 || up.KeuanganID != nil {
+		t.Fatalf("cleanup result wrong: catatan=%d upload=%+v", n, up)
+	}
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "admin.cleanup").First(&audit).Error; err != nil || audit.Username != "admin" {
+		t.Fatalf("cleanup not audited: %v %+v", err, audit)
+	}
+}
+
+func TestE2EIngestS3Event(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "demo", Password: "demo1234", Role: "user"},
+		{Username: "ani", Password: "ani12345", Role: "user"},
+	}})
+	t.Setenv("INGEST_SECRET", "bucket-secret")
+	other := append([]byte(nil), testenv.JPEG...)
+	other = append(other, "ani"...)
+	store := storagetest.New().Put("receipts", "demo/struk 1.jpg", testenv.JPEG).Put("receipts", "ghost/a.jpg", testenv.JPEG).
+		Put("receipts", "ani/struk 1.jpg", other)
+	prev := objectStore
+	objectStore = store
+	t.Cleanup(func() { objectStore = prev })
+
+	event := `{"Records":[
+		{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"receipts"},"object":{"key":"demo/struk+1.jpg","size":10}}},
+		{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"receipts"},"object":{"key":"ghost/a.jpg","size":10}}},
+		{"eventName":"s3:ObjectRemoved:Delete","s3":{"bucket":{"name":"receipts"},"object":{"key":"demo/old.jpg"}}}
+	]}`
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/ingest/s3-event", bytes.NewBufferString(event), "wrong", "application/json")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: status = %d", resp.Code)
+	}
+
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/ingest/s3-event", bytes.NewBufferString(event), "bucket-secret", "application/json")
+	var out struct {
+		Results []struct {
+			Key      string `json:"key"`
+			Status   string `json:"status"`
+			UploadID uint   `json:"upload_id"`
+		} `json:"results"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusAccepted || len(out.Results) != 3 {
+		t.Fatalf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if out.Results[0].Status != "queued" || out.Results[1].Status != "rejected" || out.Results[2].Status != "ignored" {
+		t.Fatalf("unexpected statuses: %+v", out.Results)
+	}
+	var up models.Upload
+	if err := db.First(&up, out.Results[0].UploadID).Error; err != nil || up.FileName != "struk 1.jpg" || up.StorePath != storagepath.StorePath(up.ProfileID, "struk 1.jpg") {
+		t.Fatalf("upload not recorded: %v %+v", err, up)
+	}
+	if _, err := os.Stat(filepath.FromSlash(up.StorePath)); err != nil {
+		t.Fatalf("object not stored: %v", err)
+	}
+
+	// another user's receipt of the same name gets its own file
+	event = `{"Records":[{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"receipts"},"object":{"key":"ani/struk+1.jpg","size":13}}}]}`
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/ingest/s3-event", bytes.NewBufferString(event), "bucket-secret", "application/json")
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	var aniUp models.Upload
+	if err := db.First(&aniUp, out.Results[0].UploadID).Error; err != nil || aniUp.ProfileID == up.ProfileID || aniUp.StorePath == up.StorePath {
+		t.Fatalf("second user's upload: %v %+v", err, aniUp)
+	}
+	demoFile, _ := os.ReadFile(filepath.FromSlash(up.StorePath))
+	aniFile, _ := os.ReadFile(filepath.FromSlash(aniUp.StorePath))
+	if !bytes.Equal(demoFile, testenv.JPEG) || !bytes.Equal(aniFile, other) {
+		t.Fatal("receipts of the same name overwrote each other")
+	}
+
+	// a disabled account's objects are refused
+	db.Model(&models.User{}).Where("username = ?", "ani").Update("disabled_at", time.Now())
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/ingest/s3-event", bytes.NewBufferString(event), "bucket-secret", "application/json")
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusAccepted || len(out.Results) != 1 || out.Results[0].Status != "rejected" {
+		t.Fatalf("disabled account: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EDirectUpload(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	presign := func(body string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPost, apiPrefix+"/uploads/presign", strings.NewReader(body), token, "application/json")
+	}
+	if resp := presign(`{"file_name":"struk.jpg"}`); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("disabled: %d %s", resp.Code, resp.Body.String())
+	}
+	t.Setenv("S3_UPLOAD_BUCKET", "direct")
+	store := storagetest.New()
+	prev := objectStore
+	objectStore = store
+	t.Cleanup(func() { objectStore = prev })
+
+	if resp := presign(`{"file_name":"notes.txt"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("text file: %d", resp.Code)
+	}
+	if resp := presign(`{"file_name":"struk.jpg","size":5000000}`); !strings.Contains(resp.Body.String(), "file_too_large") {
+		t.Fatalf("too large: %d", resp.Code)
+	}
+	resp := presign(`{"file_name":"../struk.jpg","size":1000}`)
+	var out struct {
+		URL         string `json:"url"`
+		UploadToken string `json:"upload_token"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	key, ok := strings.CutPrefix(out.URL, "memory://direct/")
+	if resp.Code != http.StatusOK || !ok || !strings.HasSuffix(key, "/struk.jpg") || out.UploadToken == "" {
+		t.Fatalf("presign: %d %s", resp.Code, resp.Body.String())
+	}
+	complete := func(tok, upload string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPost, apiPrefix+"/uploads/complete", strings.NewReader(`{"upload_token":"`+upload+`"}`), tok, "application/json")
+	}
+	if resp := complete(token, out.UploadToken); resp.Code != http.StatusNotFound {
+		t.Fatalf("complete before the PUT: %d %s", resp.Code, resp.Body.String())
+	}
+	// the upload token is no access token
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, out.UploadToken, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("upload token as bearer: %d", resp.Code)
+	}
+	if resp := complete(token, "forged"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("forged token: %d", resp.Code)
+	}
+
+	store.Put("direct", key, testenv.JPEG)
+	resp = complete(token, out.UploadToken)
+	var done struct {
+		UploadID uint `json:"upload_id"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &done)
+	if resp.Code != http.StatusAccepted || done.UploadID == 0 {
+		t.Fatalf("complete: %d %s", resp.Code, resp.Body.String())
+	}
+	var up models.Upload
+	if err := db.First(&up, done.UploadID).Error; err != nil || up.FileName != "struk.jpg" || up.ContentType != "image/jpeg" {
+		t.Fatalf("upload not recorded: %v %+v", err, up)
+	}
+	if _, err := os.Stat(filepath.FromSlash(up.StorePath)); err != nil {
+		t.Fatalf("object not stored: %v", err)
+	}
+}
+
+func TestE2EIngestEmailWebhook(t *testing.T) {
+	set := &fixtures.Set{Users: []fixtures.User{{Username: "demo", Password: "demo1234", Role: "user", Profile: &fixtures.Profile{Name: "Demo", Email: "demo@example.com"}}}}
+	r, _ := setupE2E(t, set)
+	t.Setenv("INGEST_SECRET", "mail-secret")
+
+	// a scan saved as PDF: the receipt is the JPEG the page embeds
+	var scan bytes.Buffer
+	_ = jpeg.Encode(&scan, image.NewGray(image.Rect(0, 0, 32, 32)), nil)
+	pdf := "%PDF-1.4\n1 0 obj\n<< /Type /XObject /Subtype /Image /Filter /DCTDecode >>\nstream\n" +
+		scan.String() + "\nendstream\nendobj\n%%EOF\n"
+	post := func(sender, spf string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("sender", sender)
+		_ = mw.WriteField("X-Mailgun-Spf", spf)
+		_ = mw.WriteField("Message-Id", "<m1@example.com>")
+		fw, _ := mw.CreateFormFile("attachment-1", "image001.jpg")
+		_, _ = fw.Write(testenv.JPEG)
+		fw, _ = mw.CreateFormFile("attachment-2", "notes.txt")
+		_, _ = fw.Write([]byte("hello"))
+		fw, _ = mw.CreateFormFile("attachment-3", "scan.pdf")
+		_, _ = fw.Write([]byte(pdf))
+		mw.Close()
+		req, _ := http.NewRequest(http.MethodPost, apiPrefix+"/ingest/email", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.SetBasicAuth("api", "mail-secret")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	resp := post("stranger@example.com", "Pass")
+	if resp.Code != http.StatusAccepted || !bytes.Contains(resp.Body.Bytes(), []byte(`"ignored"`)) {
+		t.Fatalf("unknown sender: %d %s", resp.Code, resp.Body.String())
+	}
+	// anyone can write the user's address into From; without a pass it is ignored
+	resp = post("demo@example.com", "SoftFail")
+	if resp.Code != http.StatusAccepted || !bytes.Contains(resp.Body.Bytes(), []byte(`"ignored"`)) {
+		t.Fatalf("spoofed sender: %d %s", resp.Code, resp.Body.String())
+	}
+	var n int64
+	db.Model(&models.Upload{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("spoofed mail created %d uploads", n)
+	}
+	resp = post("Demo@Example.com", "Pass")
+	var out struct {
+		Results []struct {
+			Name     string `json:"name"`
+			Status   string `json:"status"`
+			UploadID uint   `json:"upload_id"`
+		} `json:"results"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusAccepted || len(out.Results) != 2 || out.Results[0].Status != "queued" || out.Results[1].Status != "queued" {
+		t.Fatalf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	var up models.Upload
+	if err := db.First(&up, out.Results[0].UploadID).Error; err != nil || !strings.HasSuffix(up.FileName, "-image001.jpg") {
+		t.Fatalf("upload not recorded: %v %+v", err, up)
+	}
+	var scanUp models.Upload
+	if err := db.First(&scanUp, out.Results[1].UploadID).Error; err != nil || !strings.HasSuffix(scanUp.FileName, "-scan.jpg") {
+		t.Fatalf("pdf upload not recorded: %v %+v", err, scanUp)
+	}
+
+	// mail for a disabled account is ignored
+	db.Model(&models.User{}).Where("username = ?", "demo").Update("disabled_at", time.Now())
+	db.Delete(&models.Upload{}, "id IN ?", []uint{up.ID, scanUp.ID})
+	resp = post("demo@example.com", "Pass")
+	db.Model(&models.Upload{}).Count(&n)
+	if resp.Code != http.StatusAccepted || !bytes.Contains(resp.Body.Bytes(), []byte(`"ignored"`)) || n != 0 {
+		t.Fatalf("disabled account: %d %s (%d uploads)", resp.Code, resp.Body.String(), n)
+	}
+}
+
+// chatConn is a chatbot.Connector that records replies and serves fixed media.
+type chatConn struct{ replies []chatbot.Reply }
+
+func (c *chatConn) Provider() string { return "telegram" }
+func (c *chatConn) Download(context.Context, string) ([]byte, error) {
+	return testenv.JPEG, nil
+}
+func (c *chatConn) Send(_ context.Context, _ string, r chatbot.Reply) error {
+	c.replies = append(c.replies, r)
+	return nil
+}
+
+func TestE2EChatBotLinkAndSubmit(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("telegram-photo1.jpg", 87500, "Rp 87.500")
+	token := loginToken(t, r, "demo", "demo1234")
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/me/chat-links/code", nil, token, "")
+	var code struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &code)
+	if resp.Code != http.StatusCreated || len(code.Code) != 8 {
+		t.Fatalf("code: %d %s", resp.Code, resp.Body.String())
+	}
+
+	bot := chatbot.New(chatPipeline{})
+	conn := &chatConn{}
+	ctx := context.Background()
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", Text: "/link " + strings.ToLower(code.Code)})
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", MediaID: "f1", FileName: "photo1.jpg"})
+	last := conn.replies[len(conn.replies)-1]
+	if !strings.Contains(last.Text, "Rp 87.500") || len(last.Buttons) != 2 {
+		t.Fatalf("unexpected reply: %+v", conn.replies)
+	}
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", Callback: last.Buttons[1].Data})
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", Text: "90.000"})
+
+	var ct models.CatatanKeuangan
+	if err := db.Where("file_name = ?", "telegram-photo1.jpg").First(&ct).Error; err != nil || ct.Amount != 90000 || ct.ConfirmedAt == nil {
+		t.Fatalf("catatan not corrected: %v %+v", err, ct)
+	}
+
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/me/chat-links", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"ChatID":"42"`) {
+		t.Fatalf("links: %d %s", resp.Code, resp.Body.String())
+	}
+	// the code is single use
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "43", Text: "/link " + code.Code})
+	if !strings.Contains(conn.replies[len(conn.replies)-1].Text, "Kode tidak valid") {
+		t.Fatalf("code reused: %+v", conn.replies[len(conn.replies)-1])
+	}
+
+	// a disabled account can neither submit nor change catatan through the chat
+	db.Model(&models.User{}).Where("username = ?", "demo").Update("disabled_at", time.Now())
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", MediaID: "f2", FileName: "photo2.jpg"})
+	bot.Handle(ctx, conn, chatbot.Incoming{ChatID: "42", Callback: last.Buttons[0].Data})
+	for _, reply := range conn.replies[len(conn.replies)-2:] {
+		if !strings.Contains(reply.Text, "dinonaktifkan") {
+			t.Fatalf("disabled account: %+v", reply)
+		}
+	}
+	var n int64
+	db.Model(&models.Upload{}).Where("file_name = ?", "telegram-photo2.jpg").Count(&n)
+	if n != 0 {
+		t.Fatal("disabled account submitted a receipt")
+	}
+}
+
+func TestE2EPeriodLock(t *testing.T) {
+	set := &fixtures.Set{
+		Users:   demoUser.Users,
+		Uploads: []fixtures.Upload{{User: "demo", FileName: "aug.jpg"}},
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "aug.jpg", Amount: 15000, Date: "2025-08-12"}},
+	}
+	r, fake := setupE2E(t, set)
+	userToken := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+	var ct models.CatatanKeuangan
+	db.Where("file_name = ?", "aug.jpg").First(&ct)
+	confirmPath := fmt.Sprintf("%s/catatan/%d/confirm", apiPrefix, ct.ID)
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/periods/2025-08/close", nil, userToken, "")
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("close: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodPost, confirmPath, nil, userToken, "")
+	if resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), `"period_locked"`) {
+		t.Fatalf("edit in closed period: %d %s", resp.Code, resp.Body.String())
+	}
+	body := `{"file_name":"late.jpg","amount":5000,"date":"2025-08-20T10:00:00+07:00"}`
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), userToken, "application/json")
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("create in closed period: %d %s", resp.Code, resp.Body.String())
+	}
+	// a receipt dated in the closed month is kept for review, not recorded
+	printed := time.Date(2025, 8, 25, 0, 0, 0, 0, time.UTC)
+	fake.Set("struk-agustus.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 42000, Confidence: 0.9, Raw: "Rp 42.000", Date: &printed}})
+	if res := uploadFile(r, userToken, "struk-agustus.jpg", testenv.JPEG); res.Code != http.StatusOK || res.Body["catatan_id"] != nil {
+		t.Fatalf("upload dated in closed period: %d %s", res.Code, res.Raw)
+	}
+	var held models.Upload
+	if db.Where("file_name = ?", "struk-agustus.jpg").First(&held); held.KeuanganID != nil || held.Failed || !strings.Contains(held.FailedReason, "2025-08") {
+		t.Fatalf("held upload: %+v", held)
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "struk-agustus.jpg").Count(&n)
+	if n != 0 {
+		t.Fatal("catatan written into the closed period")
+	}
+	db.Model(&models.Notification{}).Where("kind = ?", "period_locked").Count(&n)
+	if n != 1 {
+		t.Fatalf("%d period_locked notifications", n)
+	}
+
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/periods/2025-08/unlock?username=demo", nil, userToken, "")
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin unlock: %d", resp.Code)
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/periods/2025-08/unlock?username=demo", nil, adminToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", resp.Code, resp.Body.String())
+	}
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "period.unlock").First(&audit).Error; err != nil || audit.Username != "admin" {
+		t.Fatalf("unlock not audited: %v %+v", err, audit)
+	}
+	resp = performRequest(r, http.MethodPost, confirmPath, nil, userToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("confirm after unlock: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EAccounts(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	body := `{"name":"BCA utama","type":"bank","institution":"BCA","opening_balance":100000}`
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/accounts", bytes.NewBufferString(body), token, "application/json")
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create account: %d %s", resp.Code, resp.Body.String())
+	}
+	var acc struct {
+		ID      uint  `json:"id"`
+		Balance int64 `json:"balance"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &acc)
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/accounts", bytes.NewBufferString(`{"name":"x","type":"crypto"}`), token, "application/json")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid type accepted: %d", resp.Code)
+	}
+
+	fake.Set("bca.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 25000, Confidence: 0.9, Raw: "Rp 25.000", Institution: "BCA"}})
+	res := uploadFile(r, token, "bca.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK || res.Body["catatan_id"] == nil {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	var ct models.CatatanKeuangan
+	db.First(&ct, uint(res.Body["catatan_id"].(float64)))
+	if ct.AccountID == nil || *ct.AccountID != acc.ID {
+		t.Fatalf("receipt not mapped to the BCA account: %+v", ct.AccountID)
+	}
+
+	resp = performRequest(r, http.MethodGet, fmt.Sprintf("%s/accounts/%d/summary", apiPrefix, acc.ID), nil, token, "")
+	var sum struct {
+		Account struct {
+			Balance int64 `json:"balance"`
+		} `json:"account"`
+		PeriodTotal int64 `json:"period_total"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &sum)
+	if resp.Code != http.StatusOK || sum.Account.Balance != 125000 || sum.PeriodTotal != 25000 {
+		t.Fatalf("summary: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequest(r, http.MethodDelete, fmt.Sprintf("%s/accounts/%d", apiPrefix, acc.ID), nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"archived":true`) {
+		t.Fatalf("delete of used account should archive: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EGoals(t *testing.T) {
+	set := &fixtures.Set{
+		Users:   demoUser.Users,
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "old.jpg", Amount: 999000, Date: "2020-01-01"}},
+	}
+	r, _ := setupE2E(t, set)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/goals", bytes.NewBufferString(`{"name":"Laptop","target_amount":0}`), token, "application/json")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("zero target accepted: %d", resp.Code)
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/goals", bytes.NewBufferString(`{"name":"Laptop","target_amount":200000}`), token, "application/json")
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create goal: %d %s", resp.Code, resp.Body.String())
+	}
+	var g struct {
+		ID uint `json:"id"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &g)
+
+	body := fmt.Sprintf(`{"file_name":"gaji.jpg","amount":50000,"date":%q}`, time.Now().Format(time.RFC3339))
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create catatan: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequest(r, http.MethodGet, fmt.Sprintf("%s/goals/%d/progress", apiPrefix, g.ID), nil, token, "")
+	var v struct {
+		Progress struct {
+			Saved       int64      `json:"saved"`
+			Percent     float64    `json:"percent"`
+			ProjectedAt *time.Time `json:"projected_at"`
+		} `json:"progress"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &v)
+	// the 2020 catatan predates the goal and must not count
+	if resp.Code != http.StatusOK || v.Progress.Saved != 50000 || v.Progress.Percent != 25 || v.Progress.ProjectedAt == nil {
+		t.Fatalf("progress: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequest(r, http.MethodDelete, fmt.Sprintf("%s/goals/%d", apiPrefix, g.ID), nil, token, "")
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("delete goal: %d", resp.Code)
+	}
+}
+
+func TestE2ENotifications(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	body := `{"notify_webhook":true,"webhook_url":"https://hooks.example.com/keu","notify_push":true}`
+	resp := performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", bytes.NewBufferString(body), token, "application/json")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"notify_push":true`) {
+		t.Fatalf("preferences: %d %s", resp.Code, resp.Body.String())
+	}
+	if res := uploadFile(r, token, "blur.jpg", testenv.JPEG); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected failed upload: %d %s", res.Code, res.Raw)
+	}
+
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/notifications?unread=true", nil, token, "")
+	var list struct {
+		Items []struct {
+			ID   uint   `json:"id"`
+			Kind string `json:"kind"`
+			Body string `json:"body"`
+		} `json:"items"`
+		Unread int64 `json:"unread"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &list)
+	if resp.Code != http.StatusOK || list.Unread != 1 || list.Items[0].Kind != "ocr_failed" || !strings.Contains(list.Items[0].Body, "blur.jpg") {
+		t.Fatalf("notifications: %d %s", resp.Code, resp.Body.String())
+	}
+	var channels []string
+	db.Model(&models.NotificationDelivery{}).Order("channel").Pluck("channel", &channels)
+	if len(channels) != 2 || channels[0] != "push" || channels[1] != "webhook" {
+		t.Fatalf("deliveries queued for %v", channels)
+	}
+
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/notifications/all/read", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"marked":1`) {
+		t.Fatalf("mark read: %d %s", resp.Code, resp.Body.String())
+	}
+
+	sub := func(token, endpoint string) *httptest.ResponseRecorder {
+		body := `{"endpoint":"` + endpoint + `","keys":{"p256dh":"k","auth":"a"}}`
+		return performRequest(r, http.MethodPost, apiPrefix+"/me/push-subscriptions", bytes.NewBufferString(body), token, "application/json")
+	}
+	for _, internal := range []string{"https://169.254.169.254/latest", "https://localhost:8080/admin", "http://push.example.com/x"} {
+		if resp = sub(token, internal); resp.Code != http.StatusBadRequest {
+			t.Fatalf("push endpoint %s: %d %s", internal, resp.Code, resp.Body.String())
+		}
+	}
+	if resp = sub(token, "https://push.example.com/demo"); resp.Code != http.StatusCreated {
+		t.Fatalf("subscribe: %d %s", resp.Code, resp.Body.String())
+	}
+	// another user cannot take the subscription over
+	if resp = sub(loginToken(t, r, "admin", "admin123"), "https://push.example.com/demo"); resp.Code != http.StatusConflict {
+		t.Fatalf("subscribe as another user: %d %s", resp.Code, resp.Body.String())
+	}
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	var owners []uint
+	db.Model(&models.PushSubscription{}).Pluck("user_id", &owners)
+	if len(owners) != 1 || owners[0] != demo.ID {
+		t.Fatalf("subscription owners %v", owners)
+	}
+}
+
+func TestE2EDigestPreview(t *testing.T) {
+	set := &fixtures.Set{
+		Users:   demoUser.Users,
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "senin.jpg", Amount: 75000, Date: "2025-08-11T10:00:00+07:00"}},
+	}
+	r, _ := setupE2E(t, set)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/me/digest/preview?week=2025-08-14", nil, token, "")
+	var out struct {
+		Digest struct {
+			Total int64 `json:"total"`
+			Count int64 `json:"count"`
+		} `json:"digest"`
+		Title string `json:"title"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Digest.Total != 75000 || out.Title != "Ringkasan mingguan 2025-08-11 – 2025-08-17" {
+		t.Fatalf("preview: %d %s", resp.Code, resp.Body.String())
+	}
+	var n int64
+	db.Model(&models.Notification{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("preview must not send, %d notifications stored", n)
+	}
+}
+
+func TestE2EAdminAnalytics(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("struk.jpg", 125000, "Rp 125.000")
+	token := loginToken(t, r, "demo", "demo1234")
+	if res := uploadFile(r, token, "struk.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics", nil, token, "")
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin analytics: %d", resp.Code)
+	}
+	adminToken := loginToken(t, r, "admin", "admin123")
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics", nil, adminToken, "")
+	var out struct {
+		ActiveUsers int64 `json:"active_users"`
+		Uploads     int64 `json:"uploads"`
+		OCR         struct {
+			SuccessRate *float64 `json:"success_rate"`
+		} `json:"ocr"`
+		Storage struct {
+			TotalBytes int64 `json:"total_bytes"`
+		} `json:"storage"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.ActiveUsers != 1 || out.Uploads != 1 || out.OCR.SuccessRate == nil || *out.OCR.SuccessRate != 1 || out.Storage.TotalBytes != int64(len(testenv.JPEG)) {
+		t.Fatalf("analytics: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics?from=2025-01-01&to=2024-01-01", nil, adminToken, "")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("inverted range accepted: %d", resp.Code)
+	}
+}
+
+func TestE2EAdminDBStats(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	prevLog := queryLog
+	queryLog = querylog.New(time.Hour)
+	db.Logger = queryLog
+	t.Cleanup(func() { queryLog = prevLog })
+	adminToken := loginToken(t, r, "admin", "admin123")
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/total", nil, adminToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("total: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/db-stats", nil, adminToken, "")
+	var out struct {
+		Queries querylog.Stats `json:"queries"`
+		Pool    struct {
+			Open int `json:"open"`
+		} `json:"pool"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Queries.Queries == 0 || out.Queries.Slow != 0 || out.Queries.SlowThreshold != "1h0m0s" {
+		t.Fatalf("db-stats: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EReportsReadReplica(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	// the replica lags: it has the fixtures but not the upload below
+	replica, err := testenv.OpenDB(t).DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := useReplica(db, sqlite.Dialector{Conn: replica}); err != nil {
+		t.Fatalf("use replica: %v", err)
+	}
+	fake.Amount("struk.jpg", 125000, "Rp 125.000")
+	token := loginToken(t, r, "demo", "demo1234")
+	if res := uploadFile(r, token, "struk.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/uploads", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "struk.jpg") {
+		t.Fatalf("uploads must read the primary: %d %s", resp.Code, resp.Body.String())
+	}
+	adminToken := loginToken(t, r, "admin", "admin123")
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics", nil, adminToken, "")
+	var out struct {
+		Uploads int64 `json:"uploads"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Uploads != 0 {
+		t.Fatalf("analytics must read the replica: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2ECatatanArchive(t *testing.T) {
+	r, _ := setupE2E(t, demoUser, &fixtures.Set{Catatan: []fixtures.Catatan{
+		{User: "demo", FileName: "lama.jpg", Amount: 1000, Date: "2012-05-01"},
+		{User: "demo", FileName: "baru.jpg", Amount: 2000, Date: "2025-05-01"},
+	}})
+	if n, err := catatanarchive.Run(db, catatanarchive.Cutoff(time.Now(), 5), 0); err != nil || n != 1 {
+		t.Fatalf("archive: %d %v", n, err)
+	}
+	token := loginToken(t, r, "demo", "demo1234")
+
+	list := func(query string) []models.CatatanKeuangan {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan"+query, nil, token, "")
+		var items []models.CatatanKeuangan
+		if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &items) != nil {
+			t.Fatalf("list %s: %d %s", query, resp.Code, resp.Body.String())
+		}
+		return items
+	}
+	if items := list(""); len(items) != 1 || items[0].FileName != "baru.jpg" {
+		t.Fatalf("default list: %+v", items)
+	}
+	if items := list("?from=2010-01-01&to=2013-01-01"); len(items) != 1 || items[0].FileName != "lama.jpg" {
+		t.Fatalf("wide range must include the archive: %+v", items)
+	}
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/total", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"total":3000`) {
+		t.Fatalf("total must include the archive: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2ECatatanUpsert(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	body := `{"file_name":"manual.jpg","amount":50000}`
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	var created struct {
+		ID uint `json:"id"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &created)
+	if resp.Code != http.StatusOK || created.ID == 0 {
+		t.Fatalf("create: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	var dup struct {
+		Details struct {
+			ID uint `json:"id"`
+		} `json:"details"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &dup)
+	if resp.Code != http.StatusConflict || dup.Details.ID != created.ID {
+		t.Fatalf("duplicate must return the existing id: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// the same image uploaded under another name links to the first catatan
+	fake.Amount("struk.jpg", 125000, "Rp 125.000")
+	fake.Amount("struk-lagi.jpg", 125000, "Rp 125.000")
+	first := uploadFile(r, token, "struk.jpg", testenv.JPEG)
+	second := uploadFile(r, token, "struk-lagi.jpg", testenv.JPEG)
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("uploads: %d %s / %d %s", first.Code, first.Raw, second.Code, second.Raw)
+	}
+	if first.Body["catatan_id"] == nil || first.Body["catatan_id"] != second.Body["catatan_id"] {
+		t.Fatalf("catatan ids differ: %v vs %v", first.Body["catatan_id"], second.Body["catatan_id"])
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("expected 2 catatan, got %d", n)
+	}
+}
+
+func TestE2EUploadOCRText(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Set("struk.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 125000, Confidence: 0.9, Raw: "Rp 125.000", Text: "TRANSFER BERHASIL total rp 125.000"}})
+	token := loginToken(t, r, "demo", "demo1234")
+	res := uploadFile(r, token, "struk.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	path := fmt.Sprintf("%s/uploads/%v/ocr-text", apiPrefix, res.Body["id"])
+	resp := performRequest(r, http.MethodGet, path, nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "TRANSFER BERHASIL") {
+		t.Fatalf("ocr text: %d %s", resp.Code, resp.Body.String())
+	}
+	if strings.Contains(res.Raw, "TRANSFER BERHASIL") {
+		t.Fatalf("upload response must not carry the OCR text: %s", res.Raw)
+	}
+}
+
+func TestE2EUploadRateLimit(t *testing.T) {
+	t.Setenv("UPLOAD_RATE_PER_MINUTE", "1")
+	t.Setenv("UPLOAD_RATE_BURST", "2")
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	upload := func(name string) *httptest.ResponseRecorder {
+		fake.Amount(name, 125000, "Rp 125.000")
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+		w, _ := mw.CreateFormFile("file", name)
+		_, _ = w.Write(testenv.JPEG)
+		_ = mw.Close()
+		return performRequest(r, http.MethodPost, apiPrefix+"/uploads", buf, token, mw.FormDataContentType())
+	}
+
+	resp := upload("a.jpg")
+	if resp.Code != http.StatusOK || resp.Header().Get("X-RateLimit-Limit") != "2" || resp.Header().Get("X-RateLimit-Remaining") != "1" {
+		t.Fatalf("first upload: %d %v", resp.Code, resp.Header())
+	}
+	upload("b.jpg")
+	resp = upload("c.jpg")
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" || !strings.Contains(resp.Body.String(), "rate_limited") {
+		t.Fatalf("third upload must be limited: %d %s", resp.Code, resp.Body.String())
+	}
+	// the legacy alias shares the quota rather than granting a second one
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	w, _ := mw.CreateFormFile("file", "d.jpg")
+	_, _ = w.Write(testenv.JPEG)
+	_ = mw.Close()
+	if resp := performRequest(r, http.MethodPost, "/uploads", buf, token, mw.FormDataContentType()); resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("legacy path must share the limit: %d %s", resp.Code, resp.Body.String())
+	}
+
+	adminToken := loginToken(t, r, "admin", "admin123")
+	body := `{"overrides":[{"username":"demo","per_minute":0}]}`
+	if resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/rate-limits", bytes.NewBufferString(body), adminToken, "application/json"); resp.Code != http.StatusOK {
+		t.Fatalf("set overrides: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp = upload("c.jpg"); resp.Code != http.StatusOK {
+		t.Fatalf("exempted user still limited: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EUploadPrecheck(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	sum := sha256.Sum256(testenv.JPEG)
+	hash := hex.EncodeToString(sum[:])
+	precheck := func(body map[string]any) (accepted bool, codes []string, out map[string]any) {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		resp := performRequest(r, http.MethodPost, apiPrefix+"/uploads/precheck", bytes.NewBuffer(b), token, "application/json")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("precheck: %d %s", resp.Code, resp.Body.String())
+		}
+		var res struct {
+			Accepted bool `json:"accepted"`
+			Problems []struct {
+				Code string `json:"code"`
+			} `json:"problems"`
+		}
+		_ = json.Unmarshal(resp.Body.Bytes(), &res)
+		_ = json.Unmarshal(resp.Body.Bytes(), &out)
+		for _, p := range res.Problems {
+			codes = append(codes, p.Code)
+		}
+		return res.Accepted, codes, out
+	}
+
+	head := testenv.JPEG[:4]
+	if ok, codes, _ := precheck(map[string]any{"file_name": "struk.jpg", "size": len(testenv.JPEG), "sha256": hash, "head": head}); !ok {
+		t.Fatalf("fresh receipt rejected: %v", codes)
+	}
+	if ok, codes, _ := precheck(map[string]any{"file_name": "doc.pdf", "size": 5_000_000, "head": []byte("%PDF-1.4")}); ok || len(codes) != 2 {
+		t.Fatalf("pdf over the size limit: %v %v", ok, codes)
+	}
+
+	fake.Amount("struk.jpg", 125000, "Rp 125.000")
+	if res := uploadFile(r, token, "struk.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	ok, codes, out := precheck(map[string]any{"file_name": "renamed.jpg", "size": len(testenv.JPEG), "sha256": hash, "head": head})
+	if ok || len(codes) != 1 || codes[0] != "duplicate" || out["duplicate_of"] == nil {
+		t.Fatalf("same image under another name: %v %v", codes, out)
+	}
+}
+
+func TestE2EUploadQualityFeedback(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	var dark bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 600, 800))
+	for i := range img.Pix {
+		img.Pix[i] = 12
+	}
+	if err := jpeg.Encode(&dark, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	fake.Amount("gelap.jpg", 50000, "Rp 50.000")
+	res := uploadFile(r, token, "gelap.jpg", dark.Bytes())
+	if res.Code != http.StatusBadRequest || res.Body["error"] != "amount_not_found" {
+		t.Fatalf("dark photo: status=%d body=%s", res.Code, res.Raw)
+	}
+	if msg, _ := res.Body["message"].(string); !strings.Contains(msg, "terlalu gelap") {
+		t.Fatalf("expected darkness feedback, got %q", msg)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("rejected photo reached OCR: %v", fake.Calls())
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "gelap.jpg").First(&up)
+	if !up.Failed || !strings.Contains(up.FailedReason, "terlalu gelap") {
+		t.Fatalf("upload not failed with feedback: %+v", up)
+	}
+
+	// an undecodable image is left to OCR and keeps the generic reason
+	res = uploadFile(r, token, "logo.jpg", testenv.JPEG)
+	if msg, _ := res.Body["message"].(string); msg != ocr.NoAmountMessage {
+		t.Fatalf("generic failure message = %q", msg)
+	}
+}
+
+// receiptImage is a legible receipt-like image: rows of dark glyph blocks on paper.
+func receiptImage() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 600, 800))
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 600; x++ {
+			img.Pix[y*img.Stride+x] = 235
+			if x >= 20 && x < 580 && y >= 20 && (y-20)%24 < 8 && (x-20)%10 < 6 {
+				img.Pix[y*img.Stride+x] = 20
+			}
+		}
+	}
+	return img
+}
+
+// receiptJPEG encodes receiptImage.
+func receiptJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, receiptImage(), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestE2EUploadRegionRetry(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+
+	fake.Set("crop.jpg", ocrtest.Script{Regions: []ocr.Region{{X: 20, Y: 404, Width: 560, Height: 8, Text: "TOTAL 45.000", Confidence: 71}}})
+	res := uploadFile(r, token, "crop.jpg", receiptJPEG(t))
+	if res.Code != http.StatusBadRequest || res.Body["error"] != "amount_not_found" {
+		t.Fatalf("upload: status=%d body=%s", res.Code, res.Raw)
+	}
+	var failed struct {
+		Details struct {
+			OCR struct {
+				Regions []ocr.Region `json:"regions"`
+			} `json:"ocr"`
+		} `json:"details"`
+	}
+	_ = json.Unmarshal([]byte(res.Raw), &failed)
+	if len(failed.Details.OCR.Regions) != 1 || failed.Details.OCR.Regions[0].Text != "TOTAL 45.000" {
+		t.Fatalf("expected crop-assist regions, got %s", res.Raw)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "crop.jpg").First(&up)
+	if _, err := os.Stat(filepath.Join("public", "failed", uploadfiles.StoredName(up))); err != nil {
+		t.Fatalf("failed receipt must be kept for a region retry: %v", err)
+	}
+	path := fmt.Sprintf("%s/uploads/%d/region", apiPrefix, up.ID)
+
+	resp := performRequest(r, http.MethodPost, path, strings.NewReader(`{"x":590,"y":0,"width":40,"height":40}`), token, "application/json")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("crop outside the image: status=%d body=%s", resp.Code, resp.Body.String())
+	}
+
+	fake.Amount("crop.jpg", 45000, "TOTAL 45.000")
+	resp = performRequest(r, http.MethodPost, path, strings.NewReader(`{"x":0,"y":390,"width":600,"height":40}`), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("region retry: status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	db.First(&up, up.ID)
+	var ct models.CatatanKeuangan
+	if up.Failed || up.KeuanganID == nil || db.First(&ct, *up.KeuanganID).Error != nil || ct.Amount != 45000 {
+		t.Fatalf("upload not linked after region retry: %+v catatan=%+v", up, ct)
+	}
+
+	resp = performRequest(r, http.MethodPost, path, strings.NewReader(`{"x":0,"y":390,"width":600,"height":40}`), token, "application/json")
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("retry of a linked upload: status=%d", resp.Code)
+	}
+}
+
+func TestE2EUploadConfirmRequired(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	fake.Amount("lama.jpg", 80000, "Rp 80.000")
+	fake.Amount("baru.jpg", 20000, "Rp 20.000")
+
+	if res := uploadFileWith(r, token, "x.jpg", testenv.JPEG, map[string]string{"confirm_required": "maybe"}); res.Code != http.StatusBadRequest {
+		t.Fatalf("invalid flag: status=%d", res.Code)
+	}
+	res := uploadFileWith(r, token, "lama.jpg", testenv.JPEG, map[string]string{"confirm_required": "true"})
+	if res.Code != http.StatusOK || res.Body["pending"] != true || res.Body["catatan_id"] == nil {
+		t.Fatalf("pending upload: status=%d body=%s", res.Code, res.Raw)
+	}
+	pendingID := uint(res.Body["catatan_id"].(float64))
+	if res := uploadFile(r, token, "baru.jpg", receiptJPEG(t)); res.Body["pending"] != false {
+		t.Fatalf("default upload must not be pending: %s", res.Raw)
+	}
+
+	total := func() float64 {
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/total", nil, token, "")
+		var body map[string]any
+		_ = json.Unmarshal(resp.Body.Bytes(), &body)
+		v, _ := body["total"].(float64)
+		return v
+	}
+	if got := total(); got != 20000 {
+		t.Fatalf("total with a pending catatan = %v, want 20000", got)
+	}
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/pending", nil, token, "")
+	if !strings.Contains(resp.Body.String(), `"lama.jpg"`) || strings.Contains(resp.Body.String(), `"baru.jpg"`) {
+		t.Fatalf("pending list: %s", resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodPost, fmt.Sprintf("%s/catatan/%d/confirm", apiPrefix, pendingID), nil, token, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("confirm: status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	if got := total(); got != 100000 {
+		t.Fatalf("total after confirm = %v, want 100000", got)
+	}
+}
+
+func TestE2ERememberMeSessions(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	post := func(path, body string) (int, map[string]any) {
+		resp := performRequest(r, http.MethodPost, apiPrefix+path, strings.NewReader(body), "", "application/json")
+		var out map[string]any
+		_ = json.Unmarshal(resp.Body.Bytes(), &out)
+		return resp.Code, out
+	}
+
+	if code, _ := post("/login", `{"username":"demo","password":"demo1234","remember_me":true}`); code != http.StatusBadRequest {
+		t.Fatalf("remember_me without device_id: status=%d", code)
+	}
+	code, login := post("/login", `{"username":"demo","password":"demo1234","remember_me":true,"device_id":"phone-1"}`)
+	if code != http.StatusOK || login["remember_me"] != true {
+		t.Fatalf("remember-me login: %d %v", code, login)
+	}
+	if exp, _ := time.Parse(time.RFC3339, login["refresh_expires_at"].(string)); exp.Before(time.Now().Add(29 * 24 * time.Hour)) {
+		t.Fatalf("remember-me token expires too soon: %v", exp)
+	}
+	rt := login["refresh_token"].(string)
+	if code, _ := post("/refresh", `{"refresh_token":"`+rt+`"}`); code != http.StatusUnauthorized {
+		t.Fatalf("refresh without the device: status=%d", code)
+	}
+	if code, _ := post("/refresh", `{"refresh_token":"`+rt+`","device_id":"laptop"}`); code != http.StatusUnauthorized {
+		t.Fatalf("refresh from another device: status=%d", code)
+	}
+	if code, out := post("/refresh", `{"refresh_token":"`+rt+`","device_id":"phone-1"}`); code != http.StatusOK {
+		t.Fatalf("refresh from the device: %d %v", code, out)
+	}
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/me/sessions", nil, token, "")
+	var sessions []map[string]any
+	_ = json.Unmarshal(resp.Body.Bytes(), &sessions)
+	if len(sessions) != 2 || sessions[0]["remember_me"] != true || sessions[1]["remember_me"] != false {
+		t.Fatalf("sessions: %s", resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodDelete, apiPrefix+"/me/sessions/remembered", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"revoked":1`) {
+		t.Fatalf("forget devices: %d %s", resp.Code, resp.Body.String())
+	}
+	if code, _ := post("/refresh", `{"refresh_token":"`+rt+`","device_id":"phone-1"}`); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after forgetting devices: status=%d", code)
+	}
+	id := fmt.Sprint(sessions[1]["id"])
+	if resp := performRequest(r, http.MethodDelete, apiPrefix+"/me/sessions/"+id, nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("revoke session: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodDelete, apiPrefix+"/me/sessions/"+id, nil, token, ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("revoking twice: %d", resp.Code)
+	}
+}
+
+func TestE2EDemotedAdmin(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "boss", Password: "boss1234", Role: "administrator"},
+		{Username: "ops", Password: "ops12345", Role: "administrator"},
+	}})
+	boss := loginToken(t, r, "boss", "boss1234")
+	ops := loginToken(t, r, "ops", "ops12345")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics", nil, ops, ""); resp.Code != http.StatusOK {
+		t.Fatalf("admin before demotion: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/users/ops/role", strings.NewReader(`{"role":"user"}`), boss, "application/json"); resp.Code != http.StatusOK {
+		t.Fatalf("demote: %d %s", resp.Code, resp.Body.String())
+	}
+	// the token still says administrator; it must not be honoured
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/analytics", nil, ops, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("demoted admin: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, ops, ""); resp.Code != http.StatusOK {
+		t.Fatalf("demoted admin keeps their account: %d", resp.Code)
+	}
+}
+
+func TestE2ECustomRoles(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	adminToken := loginToken(t, r, "admin", "admin123")
+	token := loginToken(t, r, "demo", "demo1234")
+	fake.Amount("satu.jpg", 10000, "Rp 10.000")
+	adminJSON := func(method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), adminToken, "application/json")
+	}
+
+	if resp := adminJSON(http.MethodPost, "/admin/roles", `{"name":"viewer","permissions":["fly"]}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unknown permission: %d", resp.Code)
+	}
+	if resp := adminJSON(http.MethodPost, "/admin/roles", `{"name":"viewer","permissions":["export"]}`); resp.Code != http.StatusCreated {
+		t.Fatalf("create viewer: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := adminJSON(http.MethodPost, "/admin/roles", `{"name":"hemat","permissions":["upload","catatan_write"],"uploads_per_day":1}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create hemat: %d %s", resp.Code, resp.Body.String())
+	}
+
+	adminJSON(http.MethodPut, "/admin/users/demo/role", `{"role":"viewer"}`)
+	if res := uploadFile(r, token, "satu.jpg", testenv.JPEG); res.Code != http.StatusForbidden || res.Body["error"] != "forbidden" {
+		t.Fatalf("viewer upload: %d %s", res.Code, res.Raw)
+	}
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me/export", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("viewer export: %d", resp.Code)
+	}
+
+	adminJSON(http.MethodPut, "/admin/users/demo/role", `{"role":"hemat"}`)
+	if res := uploadFile(r, token, "satu.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("first upload of the day: %d %s", res.Code, res.Raw)
+	}
+	if res := uploadFile(r, token, "dua.jpg", receiptJPEG(t)); res.Code != http.StatusForbidden || res.Body["error"] != "quota_exceeded" {
+		t.Fatalf("second upload of the day: %d %s", res.Code, res.Raw)
+	}
+
+	resp = adminJSON(http.MethodGet, "/admin/roles", "")
+	if !strings.Contains(resp.Body.String(), `"name":"hemat"`) || !strings.Contains(resp.Body.String(), `"users":1`) {
+		t.Fatalf("roles list: %s", resp.Body.String())
+	}
+	var hemat models.Role
+	db.Where("name = ?", "hemat").First(&hemat)
+	if resp := adminJSON(http.MethodDelete, fmt.Sprintf("/admin/roles/%d", hemat.ID), ""); resp.Code != http.StatusConflict {
+		t.Fatalf("deleting a role in use: %d", resp.Code)
+	}
+	var user models.Role
+	db.Where("name = ?", "user").First(&user)
+	if resp := adminJSON(http.MethodPut, fmt.Sprintf("/admin/roles/%d", user.ID), `{"permissions":["export"]}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("restricting the built-in user role: %d", resp.Code)
+	}
+	if resp := adminJSON(http.MethodDelete, fmt.Sprintf("/admin/roles/%d", user.ID), ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("deleting the built-in user role: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/roles", nil, token, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("roles admin as a regular user: %d", resp.Code)
+	}
+}
+
+func TestE2EOrganizations(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{
+			{Username: "demo", Password: "demo1234", Role: "user"},
+			{Username: "ani", Password: "ani12345", Role: "user"},
+			{Username: "budi", Password: "budi1234", Role: "user"},
+		},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "d.jpg", Amount: 10000, Date: "2025-03-02"},
+			{User: "ani", FileName: "a.jpg", Amount: 25000, Date: "2025-03-05"},
+			{User: "budi", FileName: "b.jpg", Amount: 99000, Date: "2025-03-05"},
+		},
+	})
+	owner := loginToken(t, r, "demo", "demo1234")
+	ani := loginToken(t, r, "ani", "ani12345")
+	budi := loginToken(t, r, "budi", "budi1234")
+	call := func(token, method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+
+	resp := call(owner, http.MethodPost, "/orgs", `{"name":"Toko Maju"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create org: %d %s", resp.Code, resp.Body.String())
+	}
+	var org struct {
+		ID   uint   `json:"id"`
+		Role string `json:"role"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &org)
+	if org.Role != "owner" {
+		t.Fatalf("creator role: %+v", org)
+	}
+	base := fmt.Sprintf("/orgs/%d", org.ID)
+	// adding by username only invites: the token reaches the invitee alone
+	inviteToken := regexp.MustCompile(`[0-9a-f]{48}`)
+	resp = call(owner, http.MethodPost, base+"/members", `{"username":"ani","role":"member"}`)
+	if resp.Code != http.StatusAccepted || inviteToken.MatchString(resp.Body.String()) {
+		t.Fatalf("add ani: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call(owner, http.MethodPost, base+"/members", `{"username":"ani"}`); resp.Code != http.StatusConflict {
+		t.Fatalf("second add of ani: %d", resp.Code)
+	}
+	if resp := call(ani, http.MethodGet, base+"/summary", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("summary before accepting: %d", resp.Code)
+	}
+	aniToken := inviteToken.FindString(call(ani, http.MethodGet, "/notifications", "").Body.String())
+	if aniToken == "" {
+		t.Fatal("ani was not notified of the invite")
+	}
+	if resp := call("", http.MethodPost, "/invites/"+aniToken+"/accept", `{"username":"budi","password":"budi1234"}`); resp.Code != http.StatusNotFound {
+		t.Fatalf("budi accepting ani's invite: %d", resp.Code)
+	}
+	if resp := call("", http.MethodPost, "/invites/"+aniToken+"/accept", `{"username":"newcomer","password":"newcomer1"}`); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("signing up through ani's invite: %d", resp.Code)
+	}
+	if resp := call("", http.MethodPost, "/invites/"+aniToken+"/accept", `{"username":"ani","password":"ani12345"}`); resp.Code != http.StatusOK {
+		t.Fatalf("ani accepting: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call(ani, http.MethodPost, base+"/members", `{"username":"budi"}`); resp.Code != http.StatusForbidden {
+		t.Fatalf("member adding members: %d", resp.Code)
+	}
+	// budi is invited but never accepts: none of their records are exposed
+	if resp := call(owner, http.MethodPost, base+"/members", `{"username":"budi","role":"member"}`); resp.Code != http.StatusAccepted {
+		t.Fatalf("add budi: %d %s", resp.Code, resp.Body.String())
+	}
+	for _, path := range []string{"/catatan", "/export", "/summary"} {
+		resp := call(owner, http.MethodGet, base+path, "")
+		if resp.Code != http.StatusOK || strings.Contains(resp.Body.String(), "b.jpg") || strings.Contains(resp.Body.String(), "99000") {
+			t.Fatalf("owner %s with budi invited: %d %s", path, resp.Code, resp.Body.String())
+		}
+	}
+	if resp := call(budi, http.MethodGet, base+"/summary", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("outsider summary: %d", resp.Code)
+	}
+
+	// members see the roll-up, not who contributed what
+	resp = call(ani, http.MethodGet, base+"/summary", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"total":35000`) || strings.Contains(resp.Body.String(), `"by_member":[`) {
+		t.Fatalf("member summary: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call(ani, http.MethodGet, base+"/catatan", ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("member listing records: %d", resp.Code)
+	}
+
+	var aniUser models.User
+	db.Where("username = ?", "ani").First(&aniUser)
+	if resp := call(owner, http.MethodPut, fmt.Sprintf("%s/members/%d", base, aniUser.ID), `{"role":"accountant"}`); resp.Code != http.StatusOK {
+		t.Fatalf("promote ani: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = call(ani, http.MethodGet, base+"/catatan", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "d.jpg") || strings.Contains(resp.Body.String(), "b.jpg") {
+		t.Fatalf("accountant records: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = call(ani, http.MethodGet, base+"/export", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "demo,d.jpg,10000") {
+		t.Fatalf("accountant export: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call(ani, http.MethodGet, base+"/summary", ""); !strings.Contains(resp.Body.String(), `"by_member":[`) {
+		t.Fatalf("accountant summary: %s", resp.Body.String())
+	}
+
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	if resp := call(owner, http.MethodDelete, fmt.Sprintf("%s/members/%d", base, demo.ID), ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("last owner leaving: %d", resp.Code)
+	}
+	if resp := call(ani, http.MethodDelete, fmt.Sprintf("%s/members/%d", base, aniUser.ID), ""); resp.Code != http.StatusNoContent {
+		t.Fatalf("accountant leaving: %d", resp.Code)
+	}
+	if resp := call(ani, http.MethodGet, "/orgs", ""); resp.Body.String() != "[]" {
+		t.Fatalf("orgs after leaving: %s", resp.Body.String())
+	}
+}
+
+// outbox is a mail channel that keeps what it was asked to send.
+type outbox struct{ sent []notify.Message }
+
+func (o *outbox) Name() string { return notify.ChannelEmail }
+
+func (o *outbox) Send(_ context.Context, _ notify.Recipient, m notify.Message) error {
+	o.sent = append(o.sent, m)
+	return nil
+}
+
+func TestE2EOrganizationInvites(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "demo", Password: "demo1234", Role: "user"},
+		{Username: "ani", Password: "ani12345", Role: "user"},
+	}})
+	t.Setenv("PUBLIC_BASE_URL", "https://keu.example.com")
+	box := &outbox{}
+	prevMailer := mailer
+	mailer = box
+	t.Cleanup(func() { mailer = prevMailer })
+	owner := loginToken(t, r, "demo", "demo1234")
+	ani := loginToken(t, r, "ani", "ani12345")
+	call := func(token, method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	resp := call(owner, http.MethodPost, "/orgs", `{"name":"Toko Maju"}`)
+	var org struct {
+		ID uint `json:"id"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &org)
+	base := fmt.Sprintf("/orgs/%d", org.ID)
+
+	if resp := call(owner, http.MethodPost, base+"/invites", `{"email":"not-an-address"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("bad email: %d", resp.Code)
+	}
+	resp = call(owner, http.MethodPost, base+"/invites", `{"email":"Budi@Example.com","role":"accountant"}`)
+	if resp.Code != http.StatusCreated || strings.Contains(resp.Body.String(), `"token"`) {
+		t.Fatalf("invite budi: %d %s", resp.Code, resp.Body.String())
+	}
+	if len(box.sent) != 1 || !strings.Contains(box.sent[0].Body, "https://keu.example.com/invites/") {
+		t.Fatalf("invite mail: %+v", box.sent)
+	}
+	link := box.sent[0].Body[strings.Index(box.sent[0].Body, "/invites/")+len("/invites/"):]
+	budiToken := link[:strings.IndexAny(link, "\n ")]
+	if resp := call(owner, http.MethodPost, base+"/invites", `{"email":"budi@example.com"}`); resp.Code != http.StatusConflict {
+		t.Fatalf("second invite for a pending address: %d", resp.Code)
+	}
+	if resp := call(ani, http.MethodGet, base+"/invites", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("outsider listing invites: %d", resp.Code)
+	}
+
+	// the invitee previews the invite, then signs up through it
+	resp = call("", http.MethodGet, "/invites/"+budiToken, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"name":"Toko Maju"`) || !strings.Contains(resp.Body.String(), `"email":"budi@example.com"`) {
+		t.Fatalf("preview: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = call("", http.MethodPost, "/invites/"+budiToken+"/accept", `{"username":"budi","password":"budi1234"}`)
+	if resp.Code != http.StatusCreated || !strings.Contains(resp.Body.String(), `"role":"accountant"`) {
+		t.Fatalf("accept as new user: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call("", http.MethodPost, "/invites/"+budiToken+"/accept", `{"username":"budi","password":"budi1234"}`); resp.Code != http.StatusNotFound {
+		t.Fatalf("reusing an invite: %d", resp.Code)
+	}
+	budi := loginToken(t, r, "budi", "budi1234")
+	if resp := call(budi, http.MethodGet, base+"/catatan", ""); resp.Code != http.StatusOK {
+		t.Fatalf("accountant after accepting: %d", resp.Code)
+	}
+
+	// an existing user joins with their credentials; without SMTP the owner gets the token
+	mailer = nil
+	resp = call(owner, http.MethodPost, base+"/invites", `{"email":"ani@example.com"}`)
+	var created struct {
+		Token     string `json:"token"`
+		EmailSent bool   `json:"email_sent"`
+		Invite    struct {
+			ID uint `json:"id"`
+		} `json:"invite"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	if resp.Code != http.StatusCreated || created.EmailSent || created.Token == "" {
+		t.Fatalf("invite without mailer: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = call(owner, http.MethodPost, fmt.Sprintf("%s/invites/%d/resend", base, created.Invite.ID), "")
+	var resent struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &resent)
+	if resp.Code != http.StatusOK || resent.Token == "" || resent.Token == created.Token {
+		t.Fatalf("resend: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call("", http.MethodGet, "/invites/"+created.Token, ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("token replaced by resend: %d", resp.Code)
+	}
+	if resp := call("", http.MethodPost, "/invites/"+resent.Token+"/accept", `{"username":"ani","password":"wrong-pass"}`); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d", resp.Code)
+	}
+	resp = call("", http.MethodPost, "/invites/"+resent.Token+"/accept", `{"username":"ani","password":"ani12345"}`)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"role":"member"`) {
+		t.Fatalf("accept as existing user: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = call(owner, http.MethodPost, base+"/invites", `{"email":"cici@example.com"}`)
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	if resp := call(owner, http.MethodDelete, fmt.Sprintf("%s/invites/%d", base, created.Invite.ID), ""); resp.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", resp.Code)
+	}
+	if resp := call(owner, http.MethodGet, base+"/invites", ""); resp.Body.String() != "[]" {
+		t.Fatalf("pending invites: %s", resp.Body.String())
+	}
+	if resp := call(owner, http.MethodGet, base, ""); !strings.Contains(resp.Body.String(), `"username":"ani"`) || !strings.Contains(resp.Body.String(), `"username":"budi"`) {
+		t.Fatalf("members: %s", resp.Body.String())
+	}
+}
+
+func TestE2EOrganizationQuota(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("satu.jpg", 10000, "Rp 10.000")
+	adminToken := loginToken(t, r, "admin", "admin123")
+	token := loginToken(t, r, "demo", "demo1234")
+	call := func(token, method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	resp := call(token, http.MethodPost, "/orgs", `{"name":"Toko Maju"}`)
+	var org struct {
+		ID uint `json:"id"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &org)
+	if resp := call(token, http.MethodPut, fmt.Sprintf("/admin/orgs/%d/quota", org.ID), `{"monthly_ocr_quota":1}`); resp.Code != http.StatusForbidden {
+		t.Fatalf("owner setting quota: %d", resp.Code)
+	}
+	if resp := call(adminToken, http.MethodPut, fmt.Sprintf("/admin/orgs/%d/quota", org.ID), `{"monthly_ocr_quota":1}`); resp.Code != http.StatusOK {
+		t.Fatalf("set quota: %d %s", resp.Code, resp.Body.String())
+	}
+
+	if res := uploadFile(r, token, "satu.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("first upload: %d %s", res.Code, res.Raw)
+	}
+	res := uploadFile(r, token, "dua.jpg", receiptJPEG(t))
+	if res.Code != http.StatusForbidden || res.Body["error"] != "quota_exceeded" {
+		t.Fatalf("upload over the org quota: %d %s", res.Code, res.Raw)
+	}
+	resp = call(token, http.MethodGet, fmt.Sprintf("/orgs/%d/usage", org.ID), "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"ocr_jobs":1`) || !strings.Contains(resp.Body.String(), `"warnings":["ocr"]`) {
+		t.Fatalf("usage: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = call(token, http.MethodGet, "/notifications", "")
+	if !strings.Contains(resp.Body.String(), "Toko Maju") {
+		t.Fatalf("near-limit notification: %s", resp.Body.String())
+	}
+}
+
+func TestE2EReceiptsMap(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	for _, name := range []string{"client.jpg", "exif.jpg", "off.jpg"} {
+		fake.Amount(name, 15000, "Rp 15.000")
+	}
+
+	res := uploadFileWith(r, token, "client.jpg", testenv.JPEG, map[string]string{"latitude": "-6.2", "longitude": "999"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("invalid longitude: %d %s", res.Code, res.Raw)
+	}
+	if res := uploadFileWith(r, token, "client.jpg", testenv.JPEG, map[string]string{"latitude": "-6.2", "longitude": "106.8"}); res.Code != http.StatusOK {
+		t.Fatalf("client location: %d %s", res.Code, res.Raw)
+	}
+	geotagged := exiftest.JPEG(receiptImage(), exiftest.Tags{Lat: -7.25, Lon: 112.75})
+	if res := uploadFile(r, token, "exif.jpg", geotagged); res.Code != http.StatusOK {
+		t.Fatalf("exif location: %d %s", res.Code, res.Raw)
+	}
+	performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", strings.NewReader(`{"exif_location":false}`), token, "application/json")
+	if res := uploadFile(r, token, "off.jpg", exiftest.JPEG(receiptImage(), exiftest.Tags{Lat: 1.5, Lon: 124.8})); res.Code != http.StatusOK {
+		t.Fatalf("exif parsing off: %d %s", res.Code, res.Raw)
+	}
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/map", nil, token, "")
+	var out struct {
+		Points []struct {
+			FileName  string  `json:"file_name"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+			Source    string  `json:"source"`
+			Amount    int64   `json:"amount"`
+		} `json:"points"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || len(out.Points) != 2 {
+		t.Fatalf("map: %d %s", resp.Code, resp.Body.String())
+	}
+	got := map[string]string{}
+	for _, p := range out.Points {
+		got[p.FileName] = fmt.Sprintf("%.2f,%.2f,%s,%d", p.Latitude, p.Longitude, p.Source, p.Amount)
+	}
+	if got["client.jpg"] != "-6.20,106.80,client,15000" || got["exif.jpg"] != "-7.25,112.75,exif,15000" {
+		t.Fatalf("points: %v", got)
+	}
+}
+
+func TestE2EUploadEXIFDateFallback(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	printed := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	fake.Amount("lama.jpg", 30000, "Rp 30.000")
+	fake.Set("tercetak.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 40000, Raw: "Rp 40.000", Date: &printed}})
+	fake.Amount("baru.jpg", 50000, "Rp 50.000")
+	taken := time.Date(2024, 11, 20, 19, 30, 0, 0, time.UTC)
+
+	res := uploadFile(r, token, "lama.jpg", exiftest.JPEG(receiptImage(), exiftest.Tags{Taken: taken, Lat: -6.2, Lon: 106.8}))
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	// the stored copy is stripped of its EXIF, the upload row keeps what was read from it
+	stored, err := os.ReadFile(res.Body["store_path"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := exifmeta.Location(stored); ok || bytes.Contains(stored, []byte("Exif\x00\x00")) {
+		t.Fatal("stored image still carries EXIF")
+	}
+	// stripped copies of the same pixels would be one receipt
+	other := receiptImage()
+	other.Pix[0] ^= 0xFF
+	if res := uploadFile(r, token, "tercetak.jpg", exiftest.JPEG(other, exiftest.Tags{Taken: taken.AddDate(0, 0, 1)})); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	if res := uploadFile(r, token, "baru.jpg", receiptJPEG(t)); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+
+	got := map[string]models.CatatanKeuangan{}
+	var rows []models.CatatanKeuangan
+	db.Find(&rows)
+	for _, ct := range rows {
+		got[ct.FileName] = ct
+	}
+	// the default timezone is Asia/Jakarta, so the EXIF wall clock is 12:30 UTC
+	if ct := got["lama.jpg"]; ct.DateSource != models.DateFromEXIF || !ct.Date.Equal(time.Date(2024, 11, 20, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("exif date: %v %q", ct.Date, ct.DateSource)
+	}
+	if ct := got["tercetak.jpg"]; ct.DateSource != models.DateFromReceipt || !ct.Date.Equal(printed) {
+		t.Fatalf("printed date wins over exif: %v %q", ct.Date, ct.DateSource)
+	}
+	if ct := got["baru.jpg"]; ct.DateSource != models.DateFromUpload || time.Since(ct.Date) > time.Minute {
+		t.Fatalf("upload time fallback: %v %q", ct.Date, ct.DateSource)
+	}
+}
+
+func TestE2EUploadSimilarReceipt(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	fake.Amount("asli.jpg", 30000, "Rp 30.000")
+	fake.Amount("screenshot.jpg", 30000, "Rp 30.000")
+
+	// lines of varying length, as on a real receipt; a uniform page hashes to noise
+	img := receiptImage()
+	for y := 20; y < 800; y++ {
+		for x := 120 + ((y-20)/24*137)%460; x < 600; x++ {
+			img.Pix[y*img.Stride+x] = 235
+		}
+	}
+	var orig, copied bytes.Buffer
+	_ = jpeg.Encode(&orig, img, &jpeg.Options{Quality: 90})
+	// a smaller, re-compressed copy of the same receipt
+	_ = jpeg.Encode(&copied, imaging.Resize(img, 450, 0, imaging.Linear), &jpeg.Options{Quality: 50})
+
+	if res := uploadFile(r, token, "asli.jpg", orig.Bytes()); res.Code != http.StatusOK || res.Body["similar"] != nil {
+		t.Fatalf("first upload: %d %s", res.Code, res.Raw)
+	}
+	res := uploadFile(r, token, "screenshot.jpg", copied.Bytes())
+	if res.Code != http.StatusOK {
+		t.Fatalf("second upload: %d %s", res.Code, res.Raw)
+	}
+	similar, _ := res.Body["similar"].([]any)
+	if len(similar) != 1 || similar[0].(map[string]any)["file_name"] != "asli.jpg" || res.Body["warning"] == nil {
+		t.Fatalf("similar receipt not reported: %s", res.Raw)
+	}
+
+	adminToken := loginToken(t, r, "admin", "admin123")
+	resp := performRequest(r, http.MethodGet, "/api/v1/admin/duplicates", nil, adminToken, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"file_name":"asli.jpg"`) || !strings.Contains(resp.Body.String(), `"file_name":"screenshot.jpg"`) {
+		t.Fatalf("duplicates report: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, "/api/v1/admin/duplicates?max_distance=9", nil, adminToken, ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("max_distance above the index limit: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodGet, "/api/v1/admin/duplicates", nil, token, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin duplicates report: %d", resp.Code)
+	}
+}
+
+func TestE2EReceiptsArchive(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	jan := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	fake.Set("januari.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 25000, Raw: "Rp 25.000", Date: &jan}})
+	fake.Set("maret.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 40000, Raw: "Rp 40.000", Date: &mar}})
+	if res := uploadFile(r, token, "januari.jpg", receiptJPEG(t)); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	other := receiptImage()
+	other.Pix[0] ^= 0xFF
+	var buf bytes.Buffer
+	_ = jpeg.Encode(&buf, other, &jpeg.Options{Quality: 90})
+	if res := uploadFile(r, token, "maret.jpg", buf.Bytes()); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+
+	resp := performRequest(r, http.MethodGet, "/api/v1/uploads/archive?from=2025-01-01&to=2025-01-31", nil, token, "")
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("archive: %d %s", resp.Code, resp.Body.String())
+	}
+	if cd := resp.Header().Get("Content-Disposition"); !strings.Contains(cd, "20250101-20250131") {
+		t.Fatalf("file name: %s", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if len(files) != 2 || files["images/2025-01-10_1_januari.jpg"] == nil {
+		t.Fatalf("archive entries: %v", files)
+	}
+	rc, _ := files["index.csv"].Open()
+	index, _ := io.ReadAll(rc)
+	rc.Close()
+	if want := "catatan_id,date,amount,file_name,image\n1,2025-01-10,25000,januari.jpg,images/2025-01-10_1_januari.jpg\n"; string(index) != want {
+		t.Fatalf("index.csv = %q", index)
+	}
+
+	if resp := performRequest(r, http.MethodGet, "/api/v1/uploads/archive?from=januari", nil, token, ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("bad from: %d", resp.Code)
+	}
+}
+
+func TestE2ESecurityHeaders(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	for _, h := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Content-Security-Policy", "Strict-Transport-Security"} {
+		if w.Header().Get(h) == "" {
+			t.Errorf("%s missing", h)
+		}
+	}
+	// errors rendered by middleware carry them too
+	if resp := performRequest(r, http.MethodGet, "/api/v1/me", nil, "", ""); resp.Code != http.StatusUnauthorized || resp.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("unauthorized response: %d %v", resp.Code, resp.Header())
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, c := range []struct{ port, host, want string }{
+		{"443", "api.example.com", "https://api.example.com/api/v1/health?x=1"},
+		{"443", "api.example.com:80", "https://api.example.com/api/v1/health?x=1"},
+		{"8443", "api.example.com:8080", "https://api.example.com:8443/api/v1/health?x=1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+c.host+"/api/v1/health?x=1", nil)
+		w := httptest.NewRecorder()
+		httpsRedirect(c.port).ServeHTTP(w, req)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != c.want {
+			t.Errorf("port %s host %s: %d %s", c.port, c.host, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	if _, ok := tlsSettingsFromEnv(); ok {
+		t.Fatal("TLS enabled without configuration")
+	}
+	t.Setenv("TLS_AUTOCERT_DOMAINS", " API.example.com, ,www.example.com")
+	t.Setenv("HTTP_REDIRECT_ADDR", "off")
+	s, ok := tlsSettingsFromEnv()
+	if !ok || len(s.Domains) != 2 || s.Domains[0] != "api.example.com" || s.CacheDir != "certs" || s.RedirectAddr != "" {
+		t.Fatalf("settings = %+v, %v", s, ok)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	if got := listenAddr(); got != ":9090" {
+		t.Fatalf("listenAddr = %q", got)
+	}
+	sock := filepath.Join(t.TempDir(), "be03.sock")
+	t.Setenv("LISTEN_ADDR", "unix:"+sock)
+	if got := listenAddr(); got != "unix:"+sock {
+		t.Fatalf("listenAddr = %q", got)
+	}
+	// a socket left behind by a crashed run is replaced
+	stale, err := listen(listenAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	ln, err := listen(listenAddr())
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0o660 {
+		t.Fatalf("socket file: %v %v", fi, err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+	}}}
+	resp, err := client.Get("http://be03/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestE2EClientIPBehindProxy(t *testing.T) {
+	// httptest requests come from 192.0.2.1
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.0/24")
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	createOrg := func(name, forwardedFor string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, apiPrefix+"/orgs", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+			t.Fatalf("create org: %d %s", w.Code, w.Body.String())
+		}
+	}
+	// the client is the last address not added by a trusted proxy
+	createOrg("Toko A", "203.0.113.7, 10.1.2.3")
+	// a spoofed entry before an untrusted hop is ignored
+	createOrg("Toko B", "198.51.100.1, 203.0.113.9")
+
+	var logs []models.AuditLog
+	db.Where("action = ?", "org.create").Order("id").Find(&logs)
+	if len(logs) != 2 || logs[0].IP != "203.0.113.7" || logs[1].IP != "203.0.113.9" {
+		t.Fatalf("audit ips = %+v", logs)
+	}
+}
+
+func TestE2EDebugEndpoints(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	if resp := performRequest(r, http.MethodGet, "/debug/vars", nil, "", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("debug endpoints mounted while disabled: %d", resp.Code)
+	}
+
+	t.Setenv("DEBUG_ENDPOINTS", "on")
+	t.Setenv("DEBUG_TOKEN", "dbg-secret")
+	r, fake := setupE2E(t, demoUser)
+	userToken := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+	fake.Amount("struk.jpg", 15000, "TOTAL 15.000")
+	if res := uploadFile(r, userToken, "struk.jpg", testenv.JPEG); res.Code != http.StatusCreated && res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Body)
+	}
+
+	if resp := performRequest(r, http.MethodGet, "/debug/vars", nil, "", ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodGet, "/debug/vars", nil, userToken, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: %d", resp.Code)
+	}
+	if resp := performRequestWithHeader(r, http.MethodGet, "/debug/vars", "X-Debug-Token", "wrong"); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", resp.Code)
+	}
+
+	resp := performRequest(r, http.MethodGet, "/debug/vars", nil, adminToken, "")
+	var vars struct {
+		Goroutines int            `json:"goroutines"`
+		Heap       map[string]any `json:"heap"`
+		OCR        struct {
+			Calls int64 `json:"calls"`
+		} `json:"ocr"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &vars); err != nil || resp.Code != http.StatusOK || vars.Goroutines == 0 || vars.Heap["alloc_bytes"] == nil || vars.OCR.Calls < 1 ||
+		!strings.Contains(resp.Body.String(), `"refresh_token_janitor"`) {
+		t.Fatalf("vars: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequestWithHeader(r, http.MethodGet, "/debug/pprof/heap?debug=1", "X-Debug-Token", "dbg-secret")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "heap profile") {
+		t.Fatalf("heap profile: %d %.200s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, "/debug/pprof/", nil, adminToken, ""); resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "goroutine") {
+		t.Fatalf("pprof index: %d", resp.Code)
+	}
+}
+
+func TestE2EPasswordResetRevokesAccessTokens(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("me: %d", resp.Code)
+	}
+	// what scripts/reset_password does, seen once the cached row expires
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	db.Model(&demo).Update("token_version", gorm.Expr("token_version + 1"))
+	userCache.Invalidate(demo.ID)
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, token, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("token from before the reset: %d", resp.Code)
+	}
+	token = loginToken(t, r, "demo", "demo1234")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("new token: %d", resp.Code)
+	}
+}
+
+func TestE2EAcceptInviteRateLimit(t *testing.T) {
+	t.Setenv("AUTH_RATE_PER_MINUTE", "1")
+	t.Setenv("AUTH_RATE_BURST", "2")
+	r, _ := setupE2E(t, demoUser)
+	accept := func(prefix string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"username":"demo","password":"guess"}`)
+		return performRequest(r, http.MethodPost, prefix+"/invites/0123456789abcdef/accept", body, "", "application/json")
+	}
+	accept(apiPrefix)
+	accept(apiPrefix)
+	// the legacy alias counts against the same quota
+	if resp := accept(""); resp.Code != http.StatusTooManyRequests || !strings.Contains(resp.Body.String(), "rate_limited") {
+		t.Fatalf("third guess must be limited: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EDisableAccount(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	adminToken := loginToken(t, r, "admin", "admin123")
+	body := bytes.NewBufferString(`{"username":"demo","password":"demo1234","remember_me":true,"device_id":"phone-1"}`)
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/login", body, "", "application/json")
+	var login struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &login); err != nil || login.RefreshToken == "" {
+		t.Fatalf("login: %d %s", resp.Code, resp.Body.String())
+	}
+	adminPost := func(path string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPost, apiPrefix+path, nil, adminToken, "")
+	}
+	if resp := adminPost("/admin/users/nobody/disable"); resp.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: %d", resp.Code)
+	}
+	if resp := adminPost("/admin/users/admin/disable"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("disabling oneself: %d", resp.Code)
+	}
+	if resp := adminPost("/admin/users/demo/disable"); resp.Code != http.StatusOK {
+		t.Fatalf("disable: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/me", nil, login.AccessToken, "")
+	if resp.Code != http.StatusForbidden || !strings.Contains(resp.Body.String(), "account_disabled") {
+		t.Fatalf("access token of a disabled user: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBufferString(`{"username":"demo","password":"demo1234"}`), "", "application/json")
+	if resp.Code != http.StatusForbidden || !strings.Contains(resp.Body.String(), "account_disabled") {
+		t.Fatalf("login while disabled: %d %s", resp.Code, resp.Body.String())
+	}
+	// a wrong password does not reveal the status
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBufferString(`{"username":"demo","password":"wrong-pass"}`), "", "application/json")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password while disabled: %d", resp.Code)
+	}
+	refresh := `{"refresh_token":"` + login.RefreshToken + `","device_id":"phone-1"}`
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/refresh", bytes.NewBufferString(refresh), "", "application/json"); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token survived disabling: %d", resp.Code)
+	}
+	// an invite is no way around it either
+	mailer = nil
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/orgs", strings.NewReader(`{"name":"Toko Admin"}`), adminToken, "application/json")
+	var org struct {
+		ID uint `json:"id"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &org)
+	resp = performRequest(r, http.MethodPost, fmt.Sprintf("%s/orgs/%d/invites", apiPrefix, org.ID), strings.NewReader(`{"email":"demo@example.com"}`), adminToken, "application/json")
+	var invite struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(resp.Body.Bytes(), &invite); invite.Token == "" {
+		t.Fatalf("invite: %d %s", resp.Code, resp.Body.String())
+	}
+	accept := func(password string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"username":"demo","password":"` + password + `"}`)
+		return performRequest(r, http.MethodPost, apiPrefix+"/invites/"+invite.Token+"/accept", body, "", "application/json")
+	}
+	if resp := accept("demo1234"); resp.Code != http.StatusForbidden || !strings.Contains(resp.Body.String(), "account_disabled") {
+		t.Fatalf("accept while disabled: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := accept("wrong-pass"); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("accept with wrong password while disabled: %d", resp.Code)
+	}
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "admin.user.disable").First(&audit).Error; err != nil || !strings.Contains(audit.Detail, "demo") {
+		t.Fatalf("disable not audited: %v %+v", err, audit)
+	}
+
+	if resp := adminPost("/admin/users/demo/enable"); resp.Code != http.StatusOK {
+		t.Fatalf("enable: %d", resp.Code)
+	}
+	// the old sessions stay ended; logging in works again
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, login.AccessToken, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("old access token after enabling: %d", resp.Code)
+	}
+	token := loginToken(t, r, "demo", "demo1234")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("after enabling: %d", resp.Code)
+	}
+}
+
+func TestE2EFileGC(t *testing.T) {
+	set := &fixtures.Set{Users: demoUser.Users, Uploads: []fixtures.Upload{
+		{User: "demo", FileName: "blurry.jpg", Failed: true, FailedReason: "File tidak dikenali, gunakan file lain!"},
+		{User: "demo", FileName: "recent.jpg", Failed: true, FailedReason: "File tidak dikenali, gunakan file lain!"},
+	}}
+	r, _ := setupE2E(t, set)
+	adminToken := loginToken(t, r, "admin", "admin123")
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(path string, size int, mtime time.Time) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(path, mtime, mtime)
+	}
+	write("public/.staging/123_left.jpg", 300, old)
+	write("public/.staging/456_in_flight.jpg", 10, time.Now())
+	write("public/failed/blurry.jpg", 200, time.Now().AddDate(0, 0, -40))
+	write("public/failed/recent.jpg", 20, old)
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/file-gc?dry_run=true", nil, adminToken, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"bytes":500`) {
+		t.Fatalf("dry run: %d %s", resp.Code, resp.Body.String())
+	}
+	if _, err := os.Stat("public/.staging/123_left.jpg"); err != nil {
+		t.Fatal("dry run removed a file")
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/admin/file-gc", nil, adminToken, "")
+	var out struct {
+		Files int   `json:"files"`
+		Bytes int64 `json:"bytes"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &out); err != nil || out.Files != 2 || out.Bytes != 500 {
+		t.Fatalf("gc: %d %s", resp.Code, resp.Body.String())
+	}
+	for path, want := range map[string]bool{
+		"public/.staging/123_left.jpg": false, "public/.staging/456_in_flight.jpg": true,
+		"public/failed/blurry.jpg": false, "public/failed/recent.jpg": true,
+	} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists=%v, want %v", path, err == nil, want)
+		}
+	}
+	// the failed uploads stay for review; only the expired one loses its file
+	stores := map[string]string{}
+	var ups []models.Upload
+	db.Find(&ups)
+	for _, up := range ups {
+		stores[up.FileName] = up.StorePath
+	}
+	if len(stores) != 2 || stores["blurry.jpg"] != "" || stores["recent.jpg"] != "public/keu/recent.jpg" {
+		t.Fatalf("store paths after gc: %v", stores)
+	}
+}
+
+func TestE2ESameFileNameFromTwoUsers(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "demo", Password: "demo1234", Role: "user"},
+		{Username: "ani", Password: "ani12345", Role: "user"},
+	}})
+	// no amount scripted: both receipts end up in public/failed
+	imgs := map[string][]byte{"demo": testenv.JPEG, "ani": receiptJPEG(t)}
+	for _, u := range []struct{ name, pw string }{{"demo", "demo1234"}, {"ani", "ani12345"}} {
+		if res := uploadFile(r, loginToken(t, r, u.name, u.pw), "IMG_0001.jpg", imgs[u.name]); res.Code != http.StatusBadRequest {
+			t.Fatalf("%s upload: %d %s", u.name, res.Code, res.Raw)
+		}
+	}
+	var ups []models.Upload
+	db.Preload("Profile.User").Where("file_name = ?", "IMG_0001.jpg").Find(&ups)
+	if len(ups) != 2 || ups[0].StorePath == ups[1].StorePath {
+		t.Fatalf("uploads = %+v", ups)
+	}
+	for _, up := range ups {
+		got, err := os.ReadFile(uploadfiles.Locate(up))
+		if err != nil || !bytes.Equal(got, imgs[up.Profile.User.Username]) {
+			t.Fatalf("%s's receipt was overwritten (%v)", up.Profile.User.Username, err)
+		}
+	}
+}
+
+func TestE2EPlaceholderCatatanAttachUpload(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("nota.jpg", 45000, "Rp 45.000")
+	token := loginToken(t, r, "demo", "demo1234")
+	post := func(path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPost, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	attach := func(id uint, name string, data []byte) *httptest.ResponseRecorder {
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+		w, _ := mw.CreateFormFile("file", name)
+		_, _ = w.Write(data)
+		_ = mw.Close()
+		return performRequest(r, http.MethodPost, fmt.Sprintf("%s/catatan/%d/attach-upload", apiPrefix, id), buf, token, mw.FormDataContentType())
+	}
+
+	if resp := post("/catatan", `{"file_name":"makan siang"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("catatan without amount: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := post("/catatan", `{"file_name":"makan siang","pending":true}`)
+	var created struct{ ID uint }
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &created) != nil {
+		t.Fatalf("placeholder: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := post(fmt.Sprintf("/catatan/%d/confirm", created.ID), ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("confirm without an amount: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = attach(created.ID, "nota.jpg", receiptJPEG(t))
+	var out struct {
+		Catatan  models.CatatanKeuangan `json:"catatan"`
+		UploadID uint                   `json:"upload_id"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &out) != nil {
+		t.Fatalf("attach: %d %s", resp.Code, resp.Body.String())
+	}
+	if out.Catatan.Amount != 45000 || !out.Catatan.Pending || out.Catatan.ContentHash == nil {
+		t.Fatalf("catatan after attach: %+v", out.Catatan)
+	}
+	var up models.Upload
+	if db.First(&up, out.UploadID).Error != nil || up.KeuanganID == nil || *up.KeuanganID != created.ID {
+		t.Fatalf("upload not linked: %+v", up)
+	}
+	if resp := attach(created.ID, "lagi.jpg", testenv.JPEG); resp.Code != http.StatusConflict {
+		t.Fatalf("second receipt: %d %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := post(fmt.Sprintf("/catatan/%d/confirm", created.ID), ""); resp.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan/total", nil, token, "")
+	if !strings.Contains(resp.Body.String(), `"total":45000`) {
+		t.Fatalf("total: %s", resp.Body.String())
+	}
+}
+
+func TestE2EEventHooks(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	fake.Amount("nota.jpg", 45000, "Rp 45.000")
+	token := loginToken(t, r, "demo", "demo1234")
+
+	var events []string
+	for _, remove := range []func(){
+		hooks.OnUploadStored(func(_ context.Context, e hooks.UploadStored) {
+			events = append(events, hooks.EventUploadStored+":"+e.Upload.FileName)
+		}),
+		hooks.OnAmountExtracted(func(_ context.Context, e hooks.AmountExtracted) {
+			events = append(events, fmt.Sprintf("%s:%d", hooks.EventAmountExtracted, e.Amount))
+		}),
+		hooks.OnCatatanCreated(func(_ context.Context, e hooks.CatatanCreated) {
+			events = append(events, hooks.EventCatatanCreated+":"+e.Catatan.FileName)
+		}),
+	} {
+		t.Cleanup(remove)
+	}
+
+	if res := uploadFile(r, token, "nota.jpg", receiptJPEG(t)); res.Code != http.StatusOK {
+		t.Fatalf("upload: status=%d body=%s", res.Code, res.Raw)
+	}
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/catatan", strings.NewReader(`{"file_name":"parkir","amount":5000}`), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("catatan: %d %s", resp.Code, resp.Body.String())
+	}
+	// a duplicate is not a new catatan
+	performRequest(r, http.MethodPost, apiPrefix+"/catatan", strings.NewReader(`{"file_name":"parkir","amount":5000}`), token, "application/json")
+
+	want := []string{"upload.stored:nota.jpg", "amount.extracted:45000", "catatan.created:nota.jpg", "catatan.created:parkir"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+}
+
+func TestE2EAccountingExport(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	send(http.MethodPost, "/catatan", `{"file_name":"makan siang","amount":45000,"date":"2025-03-04T05:00:00Z"}`)
+	send(http.MethodPost, "/catatan", `{"file_name":"belum pasti","pending":true,"date":"2025-03-04T06:00:00Z"}`)
+	send(http.MethodPost, "/catatan", `{"file_name":"bulan lalu","amount":1000,"date":"2025-02-01T05:00:00Z"}`)
+
+	if resp := send(http.MethodGet, "/catatan/export?format=xero", ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unknown format: %d", resp.Code)
+	}
+	if resp := send(http.MethodPut, "/me/export-mappings/xero", `{}`); resp.Code != http.StatusNotFound {
+		t.Fatalf("mapping of unknown format: %d", resp.Code)
+	}
+	if resp := send(http.MethodPut, "/me/export-mappings/jurnal", `{"columns":[{"header":"PPN","field":"vat"}]}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := send(http.MethodPut, "/me/export-mappings/jurnal", `{"expense_account":"6-60200","columns":[
+		{"header":"Tanggal","field":"date"},{"header":"Akun","field":"account"},{"header":"Debit","field":"debit"},{"header":"Kredit","field":"credit"}]}`)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"cash_account":"1-10001"`) {
+		t.Fatalf("save mapping: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = send(http.MethodGet, "/catatan/export?format=jurnal&from=2025-03-01&to=2025-03-31", "")
+	if resp.Code != http.StatusOK || !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export: %d %s", resp.Code, resp.Body.String())
+	}
+	want := "Tanggal,Akun,Debit,Kredit\n04/03/2025,6-60200,45000,\n04/03/2025,1-10001,,45000\n"
+	if resp.Body.String() != want {
+		t.Fatalf("export =\n%s\nwant\n%s", resp.Body.String(), want)
+	}
+	// other formats keep their defaults
+	resp = send(http.MethodGet, "/catatan/export?format=quickbooks", "")
+	if !strings.HasPrefix(resp.Body.String(), "Journal No,Journal Date,") || strings.Count(resp.Body.String(), "\n") != 5 {
+		t.Fatalf("quickbooks export: %s", resp.Body.String())
+	}
+}
+
+func TestE2EPersonalAccessTokens(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body, bearer string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), bearer, "application/json")
+	}
+	send(http.MethodPost, "/catatan", `{"file_name":"makan siang","amount":45000}`, token)
+
+	if resp := send(http.MethodPost, "/me/tokens", `{"name":"sheets","scopes":["write:catatan"]}`, token); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unknown scope: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := send(http.MethodPost, "/me/tokens", `{"name":"sheets","scopes":["read:catatan"],"expires_in_days":30}`, token)
+	var created struct {
+		Token    string `json:"token"`
+		APIToken struct {
+			ID     uint     `json:"id"`
+			Scopes []string `json:"scopes"`
+		} `json:"api_token"`
+	}
+	if resp.Code != http.StatusCreated || json.Unmarshal(resp.Body.Bytes(), &created) != nil || !strings.HasPrefix(created.Token, "be03_pat_") {
+		t.Fatalf("create: %d %s", resp.Code, resp.Body.String())
+	}
+	pat := created.Token
+
+	if resp := send(http.MethodGet, "/catatan", "", pat); resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "makan siang") {
+		t.Fatalf("read with token: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, "/catatan", nil, pat, ""); resp.Code != http.StatusOK {
+		t.Fatalf("legacy route with token: %d", resp.Code)
+	}
+	for _, c := range []struct{ method, path, body string }{
+		{http.MethodGet, "/catatan/total", ""}, // read:reports
+		{http.MethodPost, "/catatan", `{"file_name":"x","amount":1}`},
+		{http.MethodGet, "/me/tokens", ""},
+		{http.MethodPost, "/me/tokens", `{"name":"more","scopes":["read:reports"]}`},
+		{http.MethodGet, "/me/export", ""},
+	} {
+		if resp := send(c.method, c.path, c.body, pat); resp.Code != http.StatusForbidden {
+			t.Fatalf("%s %s with token: %d %s", c.method, c.path, resp.Code, resp.Body.String())
+		}
+	}
+
+	resp = send(http.MethodGet, "/me/tokens", "", token)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"hint":"be03_pat_`) || strings.Contains(resp.Body.String(), pat) {
+		t.Fatalf("list: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := send(http.MethodDelete, fmt.Sprintf("/me/tokens/%d", created.APIToken.ID), "", token); resp.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", resp.Code)
+	}
+	if resp := send(http.MethodGet, "/catatan", "", pat); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: %d", resp.Code)
+	}
+}
+
+func TestE2ECurrencyConversion(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	prev := fxConfig
+	t.Cleanup(func() { fxConfig = prev })
+	fxConfig.Provider = &fxrates.Static{PerUnit: map[string]float64{"USD": 1, "IDR": 0.0001}}
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	if resp := send(http.MethodPost, "/catatan", `{"file_name":"x","amount":1,"currency":"dollar"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid currency: %d", resp.Code)
+	}
+	send(http.MethodPost, "/catatan", `{"file_name":"makan siang","amount":45000,"date":"2025-03-04T05:00:00Z"}`)
+	send(http.MethodPost, "/catatan", `{"file_name":"langganan","amount":5,"currency":"usd","date":"2025-03-04T06:00:00Z"}`)
+	send(http.MethodPost, "/catatan", `{"file_name":"kopi","amount":4,"currency":"EUR","date":"2025-04-02T06:00:00Z"}`)
+
+	resp := send(http.MethodGet, "/catatan/total?convert_to=USD", "")
+	var total struct {
+		Total     int64 `json:"total"`
+		Converted struct {
+			Currency     string            `json:"currency"`
+			Total        float64           `json:"total"`
+			MissingRates []fxrates.Missing `json:"missing_rates"`
+		} `json:"converted"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &total) != nil {
+		t.Fatalf("total: %d %s", resp.Code, resp.Body.String())
+	}
+	if total.Total != 45009 || total.Converted.Currency != "USD" || total.Converted.Total != 9.5 ||
+		len(total.Converted.MissingRates) != 1 || total.Converted.MissingRates[0] != (fxrates.Missing{Currency: "EUR", Day: "2025-04-02"}) {
+		t.Fatalf("total = %+v", total)
+	}
+	if resp := send(http.MethodGet, "/catatan/total", ""); strings.Contains(resp.Body.String(), "converted") {
+		t.Fatalf("converted without convert_to: %s", resp.Body.String())
+	}
+	if resp := send(http.MethodGet, "/catatan/total?convert_to=us", ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid convert_to: %d", resp.Code)
+	}
+
+	resp = send(http.MethodGet, "/catatan/revenue?convert_to=IDR", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"Month":"2025-03","Total":45005,"Converted":{"currency":"IDR","total":95000`) {
+		t.Fatalf("revenue: %d %s", resp.Code, resp.Body.String())
+	}
+
+	fxConfig.Fallback = fxrates.FallbackError
+	resp = send(http.MethodGet, "/catatan/total?convert_to=USD", "")
+	if resp.Code != http.StatusBadGateway || !strings.Contains(resp.Body.String(), "rate_unavailable") {
+		t.Fatalf("error policy: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2ETaxBreakdown(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+
+	fake.Set("resto.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 115500, Confidence: 0.9, Raw: "Rp 115.500", Tax: &ocr.Tax{Amount: 10500, Rate: 10, Service: 5000}}})
+	res := uploadFile(r, token, "resto.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK || res.Body["catatan_id"] == nil {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	var ct models.CatatanKeuangan
+	db.First(&ct, uint(res.Body["catatan_id"].(float64)))
+	if ct.Tax != 10500 || ct.ServiceCharge != 5000 {
+		t.Fatalf("tax not stored: %+v", ct)
+	}
+
+	if resp := send(http.MethodPost, "/catatan", `{"file_name":"toko","amount":10000,"tax":11000}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("tax above amount: %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, "/catatan", `{"file_name":"toko","amount":10000,"tax":-1}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("negative tax: %d", resp.Code)
+	}
+	send(http.MethodPost, "/catatan", `{"file_name":"toko online","amount":55500,"tax":5500,"date":"2025-03-04T05:00:00Z"}`)
+	send(http.MethodPost, "/catatan", `{"file_name":"tanpa pajak","amount":20000,"date":"2025-03-05T05:00:00Z"}`)
+	resp := send(http.MethodPost, "/catatan", `{"file_name":"belum pasti","amount":30000,"pending":true,"date":"2025-03-06T05:00:00Z"}`)
+	var pending struct {
+		ID uint `json:"id"`
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &pending)
+
+	resp = send(http.MethodGet, "/catatan/tax?from=2025-03-01&to=2025-03-31", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"tax":5500,"service_charge":0,"taxed_amount":55500,"count":1`) {
+		t.Fatalf("march tax: %d %s", resp.Code, resp.Body.String())
+	}
+	// confirming with a tax brings the pending catatan into the report
+	if resp := send(http.MethodPost, fmt.Sprintf("/catatan/%d/confirm", pending.ID), `{"tax":3000}`); resp.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = send(http.MethodGet, "/catatan/tax", "")
+	var sum struct {
+		Tax           int64 `json:"tax"`
+		ServiceCharge int64 `json:"service_charge"`
+		Count         int64 `json:"count"`
+		Months        []struct {
+			Month string `json:"month"`
+		} `json:"months"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &sum) != nil {
+		t.Fatalf("tax: %d %s", resp.Code, resp.Body.String())
+	}
+	if sum.Tax != 19000 || sum.ServiceCharge != 5000 || sum.Count != 3 || len(sum.Months) != 2 || sum.Months[0].Month != "2025-03" {
+		t.Fatalf("tax summary = %+v", sum)
+	}
+}
+
+func TestE2ESplitCatatan(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), token, "application/json")
+	}
+	var created struct {
+		ID uint `json:"id"`
+	}
+	resp := send(http.MethodPost, "/catatan", `{"file_name":"indomaret","amount":100000,"tax":9900}`)
+	_ = json.Unmarshal(resp.Body.Bytes(), &created)
+	send(http.MethodPost, "/catatan", `{"file_name":"parkir","amount":5000}`)
+	path := fmt.Sprintf("/catatan/%d/split", created.ID)
+
+	if resp := send(http.MethodPost, path, `[{"amount":60000,"category":"groceries"},{"amount":30000,"category":"household"}]`); resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), `"sum":90000`) {
+		t.Fatalf("wrong sum: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := send(http.MethodPost, path, `[{"amount":100000}]`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("single item: %d", resp.Code)
+	}
+	resp = send(http.MethodPost, path, `[{"amount":60000,"category":"groceries","description":"sayur"},{"amount":40000,"category":"household","description":"sabun"}]`)
+	var split struct {
+		Catatan struct{ Split bool }
+		Items   []struct {
+			ID       uint
+			FileName string
+			ParentID *uint
+			Category string
+		} `json:"items"`
+	}
+	if resp.Code != http.StatusCreated || json.Unmarshal(resp.Body.Bytes(), &split) != nil {
+		t.Fatalf("split: %d %s", resp.Code, resp.Body.String())
+	}
+	if !split.Catatan.Split || len(split.Items) != 2 || split.Items[1].FileName != "indomaret #2" ||
+		split.Items[1].ParentID == nil || *split.Items[1].ParentID != created.ID || split.Items[1].Category != "household" {
+		t.Fatalf("split = %+v", split)
+	}
+	if resp := send(http.MethodPost, path, `[{"amount":50000},{"amount":50000}]`); resp.Code != http.StatusConflict {
+		t.Fatalf("split twice: %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, fmt.Sprintf("/catatan/%d/split", split.Items[0].ID), `[{"amount":30000},{"amount":30000}]`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("split an item: %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, fmt.Sprintf("/catatan/%d/confirm", created.ID), `{"amount":1}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("amount of split receipt changed: %d", resp.Code)
+	}
+
+	// the items count instead of the receipt; its tax stays reported
+	if resp := send(http.MethodGet, "/catatan/total", ""); !strings.Contains(resp.Body.String(), `"total":105000`) {
+		t.Fatalf("total: %s", resp.Body.String())
+	}
+	if resp := send(http.MethodGet, "/catatan/tax", ""); !strings.Contains(resp.Body.String(), `"tax":9900`) {
+		t.Fatalf("tax: %s", resp.Body.String())
+	}
+}
+
+func TestE2EItemizedReceipt(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	t.Cleanup(func() { ocr.SetItemizedMode(ocr.ItemizedOff) })
+	items := []ocr.LineItem{{Name: "Nasi Goreng", Qty: 2, UnitPrice: 25000, Price: 50000}, {Name: "Es Teh", Qty: 1, UnitPrice: 5000, Price: 5000}}
+	fake.Set("warung.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 55000, Confidence: 0.9, Raw: "Rp 55.000", Items: items}})
+	fake.Set("warung2.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 55000, Confidence: 0.9, Raw: "Rp 55.000", Items: items}})
+
+	// "on" returns the items without keeping them
+	ocr.SetItemizedMode(ocr.ItemizedOn)
+	res := uploadFile(r, token, "warung.jpg", receiptJPEG(t))
+	if res.Code != http.StatusOK || !strings.Contains(res.Raw, `"items":[{"name":"Nasi Goreng","qty":2,"unit_price":25000,"price":50000}`) {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	resp := performRequest(r, http.MethodGet, fmt.Sprintf("%s/uploads/%v/items", apiPrefix, res.Body["id"]), nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"items":[]`) {
+		t.Fatalf("items without store: %d %s", resp.Code, resp.Body.String())
+	}
+
+	ocr.SetItemizedMode(ocr.ItemizedStore)
+	res = uploadFile(r, token, "warung2.jpg", receiptJPEG(t))
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	resp = performRequest(r, http.MethodGet, fmt.Sprintf("%s/uploads/%v/items", apiPrefix, res.Body["id"]), nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"items_total":55000`) || !strings.Contains(resp.Body.String(), `"name":"Es Teh"`) {
+		t.Fatalf("stored items: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EProfileAssets(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	put := func(kind, name string, data []byte) *httpResult {
+		t.Helper()
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+		w, _ := mw.CreateFormFile("file", name)
+		_, _ = w.Write(data)
+		_ = mw.Close()
+		resp := performRequest(r, http.MethodPut, apiPrefix+"/profile/"+kind, buf, token, mw.FormDataContentType())
+		res := &httpResult{Code: resp.Code, Raw: resp.Body.String()}
+		_ = json.Unmarshal(resp.Body.Bytes(), &res.Body)
+		return res
+	}
+	fetch := func(url string) (*httptest.ResponseRecorder, image.Image) {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, url, nil, "", "")
+		img, _, _ := image.Decode(resp.Body)
+		return resp, img
+	}
+
+	res := put("avatar", "me.jpg", receiptJPEG(t))
+	if res.Code != http.StatusOK {
+		t.Fatalf("avatar: %d %s", res.Code, res.Raw)
+	}
+	avatar, _ := res.Body["avatar_url"].(string)
+	if !strings.HasPrefix(avatar, apiPrefix+"/profile-assets/") || !strings.HasSuffix(avatar, ".jpg") {
+		t.Fatalf("avatar_url = %q", avatar)
+	}
+	// served without a token, cropped to a square
+	resp, img := fetch(avatar)
+	if resp.Code != http.StatusOK || img == nil || img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+		t.Fatalf("avatar file: %d %v", resp.Code, img)
+	}
+
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, receiptImage()); err != nil {
+		t.Fatal(err)
+	}
+	res = put("logo", "logo.png", logo.Bytes())
+	logoURL, _ := res.Body["logo_url"].(string)
+	if res.Code != http.StatusOK || !strings.HasSuffix(logoURL, ".png") {
+		t.Fatalf("logo: %d %s", res.Code, res.Raw)
+	}
+	// 600x800 fits 600x300 as 225x300
+	if resp, img := fetch(logoURL); resp.Code != http.StatusOK || img.Bounds().Dx() != 225 || img.Bounds().Dy() != 300 {
+		t.Fatalf("logo file: %d %v", resp.Code, img.Bounds())
+	}
+
+	t.Setenv("PUBLIC_BASE_URL", "https://keu.example.com/")
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/profile", nil, token, "")
+	var prof map[string]any
+	_ = json.Unmarshal(resp.Body.Bytes(), &prof)
+	if prof["avatar_url"] != "https://keu.example.com"+avatar || prof["logo_url"] != "https://keu.example.com"+logoURL || prof["AvatarFile"] != nil {
+		t.Fatalf("profile: %s", resp.Body.String())
+	}
+
+	// a replacement gets a new name and the old file goes
+	res = put("avatar", "me2.jpg", receiptJPEG(t))
+	if res.Code != http.StatusOK || strings.HasSuffix(res.Body["avatar_url"].(string), avatar) {
+		t.Fatalf("replace avatar: %d %s", res.Code, res.Raw)
+	}
+	if resp, _ := fetch(avatar); resp.Code != http.StatusNotFound {
+		t.Fatalf("old avatar still served: %d", resp.Code)
+	}
+
+	if res := put("avatar", "broken.jpg", testenv.JPEG); res.Code != http.StatusBadRequest || res.Body["error"] != "invalid_file" {
+		t.Fatalf("undecodable image: %d %s", res.Code, res.Raw)
+	}
+	if res := put("avatar", "notes.txt", []byte("hello")); res.Body["error"] != "unsupported_type" {
+		t.Fatalf("text file: %d %s", res.Code, res.Raw)
+	}
+	if res := put("banner", "me.jpg", receiptJPEG(t)); res.Code != http.StatusNotFound {
+		t.Fatalf("unknown kind: %d", res.Code)
+	}
+	if resp, _ := fetch(apiPrefix + "/profile-assets/..%2Fkeu.db"); resp.Code != http.StatusNotFound {
+		t.Fatalf("traversal: %d", resp.Code)
+	}
+
+	resp = performRequest(r, http.MethodDelete, apiPrefix+"/profile/logo", nil, token, "")
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("delete logo: %d %s", resp.Code, resp.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(uploadfiles.ProfileAssetsDir(), filepath.Base(logoURL))); !os.IsNotExist(err) {
+		t.Fatalf("logo file kept: %v", err)
+	}
+	if resp := performRequest(r, http.MethodDelete, apiPrefix+"/profile/logo", nil, token, ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("delete again: %d", resp.Code)
+	}
+}
+
+func TestE2EProfileUpdate(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	put := func(body string) (int, map[string]any) {
+		t.Helper()
+		resp := performRequest(r, http.MethodPut, apiPrefix+"/profile", strings.NewReader(body), token, "application/json")
+		var out map[string]any
+		_ = json.Unmarshal(resp.Body.Bytes(), &out)
+		return resp.Code, out
+	}
+
+	// the fixture user already has a profile
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/profile", strings.NewReader(`{"name":"Second"}`), token, "application/json")
+	if resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), `"duplicate"`) {
+		t.Fatalf("second profile: %d %s", resp.Code, resp.Body.String())
+	}
+
+	code, p := put(`{"phone":"0812-3456 7890","email":" Demo@Example.COM ","occupation":"Baker"}`)
+	if code != http.StatusOK || p["Phone"] != "+6281234567890" || p["Email"] != "demo@example.com" || p["Occupation"] != "Baker" || p["Name"] != "demo" {
+		t.Fatalf("update: %d %v", code, p)
+	}
+	// fields left out are kept, empty ones cleared
+	code, p = put(`{"name":"Toko Demo","occupation":""}`)
+	if code != http.StatusOK || p["Name"] != "Toko Demo" || p["Occupation"] != "" || p["Phone"] != "+6281234567890" {
+		t.Fatalf("partial update: %d %v", code, p)
+	}
+	for _, tc := range []struct{ body, field string }{
+		{`{"email":"not-an-address"}`, "email"},
+		{`{"email":"Demo <demo@example.com>"}`, "email"},
+		{`{"phone":"call me"}`, "phone"},
+		{`{"phone":"123"}`, "phone"},
+		{`{"name":"  "}`, "name"},
+	} {
+		code, out := put(tc.body)
+		details, _ := out["details"].(map[string]any)
+		if code != http.StatusBadRequest || details["field"] != tc.field {
+			t.Errorf("%s: %d %v", tc.body, code, out)
+		}
+	}
+	for in, want := range map[string]string{"+62 812 3456 7890": "+6281234567890", "6281234567890": "+6281234567890", "0044 20 7946 0958": "+442079460958"} {
+		if code, p := put(`{"phone":"` + in + `"}`); code != http.StatusOK || p["Phone"] != want {
+			t.Errorf("phone %q: %d %v", in, code, p["Phone"])
+		}
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/profile", nil, token, "")
+	if !strings.Contains(resp.Body.String(), `"Name":"Toko Demo"`) {
+		t.Fatalf("profile not stored: %s", resp.Body.String())
+	}
+}
+
+func TestE2EChangeUsername(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "demo", Password: "demo1234", Role: "user"},
+		{Username: "other", Password: "other1234", Role: "user"},
+	}})
+	token := loginToken(t, r, "demo", "demo1234")
+	rename := func(body string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPost, apiPrefix+"/me/username", strings.NewReader(body), token, "application/json")
+	}
+
+	if resp := rename(`{"username":"toko.demo","password":"wrong"}`); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d", resp.Code)
+	}
+	if resp := rename(`{"username":"Other","password":"demo1234"}`); resp.Code != http.StatusConflict {
+		t.Fatalf("taken: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := rename(`{"username":"toko.demo","password":"demo1234"}`)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"previous":"demo"`) || !strings.Contains(resp.Body.String(), "next_change_at") {
+		t.Fatalf("rename: %d %s", resp.Code, resp.Body.String())
+	}
+	// the token issued to "demo" keeps working and reports the new name
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/me", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"toko.demo"`) {
+		t.Fatalf("me after rename: %d %s", resp.Code, resp.Body.String())
+	}
+	if res := performRequest(r, http.MethodPost, apiPrefix+"/login", strings.NewReader(`{"username":"demo","password":"demo1234"}`), "", "application/json"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("login with old name: %d", res.Code)
+	}
+	loginToken(t, r, "toko.demo", "demo1234")
+
+	resp = rename(`{"username":"toko.lagi","password":"demo1234"}`)
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" || !strings.Contains(resp.Body.String(), "username_cooldown") {
+		t.Fatalf("cooldown: %d %s", resp.Code, resp.Body.String())
+	}
+	t.Setenv("USERNAME_CHANGE_COOLDOWN", "0")
+	if resp := rename(`{"username":"toko.lagi","password":"demo1234"}`); resp.Code != http.StatusOK {
+		t.Fatalf("rename without cooldown: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/me/username/history", nil, token, "")
+	var hist struct {
+		Items []struct{ From, To string }
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &hist)
+	if len(hist.Items) != 2 || hist.Items[0].From != "toko.demo" || hist.Items[1].From != "demo" {
+		t.Fatalf("history: %s", resp.Body.String())
+	}
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "user.username_changed").Order("id").First(&audit).Error; err != nil || !strings.Contains(audit.Detail, `"from":"demo"`) {
+		t.Fatalf("audit: %+v %v", audit, err)
+	}
+	// the old name stays reserved for its former owner
+	other := loginToken(t, r, "other", "other1234")
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/me/username", strings.NewReader(`{"username":"demo","password":"other1234"}`), other, "application/json"); resp.Code != http.StatusConflict {
+		t.Fatalf("former name taken by another user: %d", resp.Code)
+	}
+}
+
+func TestE2EOnboarding(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	type step struct {
+		Key      string
+		Done     bool
+		Missing  []string
+		At       *time.Time
+		Channels []string
+	}
+	check := func() (map[string]step, int) {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/me/onboarding", nil, token, "")
+		var out struct {
+			Steps     []step
+			Completed int
+		}
+		if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &out) != nil || len(out.Steps) != 4 {
+			t.Fatalf("onboarding: %d %s", resp.Code, resp.Body.String())
+		}
+		steps := map[string]step{}
+		for _, s := range out.Steps {
+			steps[s.Key] = s
+		}
+		return steps, out.Completed
+	}
+
+	steps, completed := check()
+	if completed != 0 || strings.Join(steps["profile"].Missing, ",") != "email,phone" {
+		t.Fatalf("fresh account: %d %+v", completed, steps)
+	}
+
+	fake.Amount("a.jpg", 50000, "Rp 50.000")
+	if res := uploadFileWith(r, token, "a.jpg", testenv.JPEG, map[string]string{"confirm_required": "true"}); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	steps, _ = check()
+	if !steps["first_upload"].Done || steps["first_upload"].At == nil || steps["first_confirmed_catatan"].Done {
+		t.Fatalf("after pending upload: %+v", steps)
+	}
+	fake.Amount("b.jpg", 70000, "Rp 70.000")
+	uploadFile(r, token, "b.jpg", receiptJPEG(t))
+
+	// opting into email needs an address to reach
+	performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", strings.NewReader(`{"notify_email":true}`), token, "application/json")
+	if steps, _ = check(); steps["notification_channel"].Done {
+		t.Fatalf("email without address: %+v", steps["notification_channel"])
+	}
+	performRequest(r, http.MethodPut, apiPrefix+"/profile", strings.NewReader(`{"email":"demo@example.com","phone":"081234567890"}`), token, "application/json")
+	steps, completed = check()
+	if completed != 4 || strings.Join(steps["notification_channel"].Channels, ",") != "email" {
+		t.Fatalf("completed: %d %+v", completed, steps)
+	}
+}
+
+func TestE2EFeatureFlags(t *testing.T) {
+	r, fake := setupE2E(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "demo", Password: "demo1234", Role: "user"},
+		{Username: "pilot", Password: "pilot1234", Role: "user"},
+	}})
+	admin := loginToken(t, r, "admin", "admin123")
+	demo := loginToken(t, r, "demo", "demo1234")
+	pilot := loginToken(t, r, "pilot", "pilot1234")
+	flags := func(token string) map[string]bool {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/me/feature-flags", nil, token, "")
+		var out struct{ Flags map[string]bool }
+		_ = json.Unmarshal(resp.Body.Bytes(), &out)
+		return out.Flags
+	}
+	taxOf := func(token, name string) int64 {
+		t.Helper()
+		fake.Set(name, ocrtest.Script{Result: &ocr.Result{Amount: 55500, Confidence: 0.9, Raw: "Rp 55.500", Tax: &ocr.Tax{Amount: 5500}}})
+		res := uploadFile(r, token, name, testenv.JPEG)
+		var ct models.CatatanKeuangan
+		if res.Code != http.StatusOK || db.First(&ct, res.Body["catatan_id"]).Error != nil {
+			t.Fatalf("upload %s: %d %s", name, res.Code, res.Raw)
+		}
+		return ct.Tax
+	}
+
+	if f := flags(demo); !f["ocr_tax"] || !f["ocr_itemized"] {
+		t.Fatalf("defaults: %v", f)
+	}
+	if resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/feature-flags/ocr_tax", strings.NewReader(`{"enabled":true}`), demo, "application/json"); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin toggled a flag: %d", resp.Code)
+	}
+	// roll tax detection back to a single pilot user
+	resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/feature-flags/ocr_tax", strings.NewReader(`{"enabled":true,"percent":0,"users":["pilot"]}`), admin, "application/json")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"users":["pilot"]`) {
+		t.Fatalf("put flag: %d %s", resp.Code, resp.Body.String())
+	}
+	if f := flags(demo); f["ocr_tax"] {
+		t.Fatal("flag still on for demo")
+	}
+	if tax := taxOf(demo, "demo.jpg"); tax != 0 {
+		t.Fatalf("demo got tax %d with the flag off", tax)
+	}
+	if tax := taxOf(pilot, "pilot.jpg"); tax != 5500 {
+		t.Fatalf("pilot got tax %d with the flag on", tax)
+	}
+
+	for body, want := range map[string]int{`{"enabled":true,"percent":101}`: http.StatusBadRequest, `{"users":["nobody"]}`: http.StatusBadRequest} {
+		if resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/feature-flags/ocr_tax", strings.NewReader(body), admin, "application/json"); resp.Code != want {
+			t.Errorf("%s: %d", body, resp.Code)
+		}
+	}
+	if resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/feature-flags/Bad-Key", strings.NewReader(`{}`), admin, "application/json"); resp.Code != http.StatusBadRequest {
+		t.Errorf("bad key: %d", resp.Code)
+	}
+
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/feature-flags", nil, admin, "")
+	var list struct {
+		Items []struct {
+			Key    string
+			Stored bool
+		}
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &list)
+	if len(list.Items) != 2 || list.Items[0].Key != "ocr_itemized" || list.Items[0].Stored || !list.Items[1].Stored {
+		t.Fatalf("list: %s", resp.Body.String())
+	}
+
+	if resp := performRequest(r, http.MethodDelete, apiPrefix+"/admin/feature-flags/ocr_tax", nil, admin, ""); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.Code)
+	}
+	if !flags(demo)["ocr_tax"] {
+		t.Fatal("deleted flag did not return to its default")
+	}
+}
+
+// errorRecorder keeps the reported events, scrubbed as a real reporter would.
+type errorRecorder struct {
+	mu     sync.Mutex
+	events []errreport.Event
+}
+
+func (r *errorRecorder) Report(e errreport.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, errreport.Scrubbed(e))
+}
+
+func (r *errorRecorder) take() []errreport.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := r.events
+	r.events = nil
+	return out
+}
+
+func TestE2EErrorReporting(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	rec := &errorRecorder{}
+	errreport.Set(rec)
+	t.Cleanup(func() { errreport.Set(nil) })
+	token := loginToken(t, r, "demo", "demo1234")
+	r.GET(apiPrefix+"/test/panic", jwtAuthMiddleware(), func(c *gin.Context) { panic("boom with token=abc123") })
+	r.GET(apiPrefix+"/test/fail", func(c *gin.Context) {
+		writeError(c, apierr.DBSaveFailed, "saving Rp 125.000 failed", nil)
+	})
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/test/panic", nil, token, "")
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("panic: %d %s", resp.Code, resp.Body.String())
+	}
+	events := rec.take()
+	if len(events) != 1 {
+		t.Fatalf("panic reported %d times: %+v", len(events), events)
+	}
+	e := events[0]
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	if e.Level != "fatal" || e.Tags["kind"] != "panic" || !strings.Contains(e.Stack, "TestE2EErrorReporting") ||
+		e.Request.Route != apiPrefix+"/test/panic" || e.Request.Status != 500 || e.Request.RequestID == "" || e.UserID != demo.ID {
+		t.Fatalf("panic event: %+v", e)
+	}
+	if strings.Contains(e.Err.Error(), "abc123") {
+		t.Fatalf("secret in report: %v", e.Err)
+	}
+
+	performRequest(r, http.MethodGet, apiPrefix+"/test/fail", nil, "", "")
+	events = rec.take()
+	if len(events) != 1 || events[0].Tags["error_code"] != string(apierr.DBSaveFailed) || events[0].Request.Status != 500 {
+		t.Fatalf("5xx events: %+v", events)
+	}
+	if msg := events[0].Extra["message"]; msg != "saving Rp ###.### failed" {
+		t.Fatalf("amount not scrubbed: %v", msg)
+	}
+
+	fake.Set("broken.jpg", ocrtest.Script{Err: errors.New("tesseract crashed")})
+	uploadFile(r, token, "broken.jpg", testenv.JPEG)
+	kinds := map[string]bool{}
+	for _, e := range rec.take() {
+		kinds[e.Tags["kind"]] = true
+	}
+	if !kinds["ocr"] || !kinds["http"] {
+		t.Fatalf("OCR failure reports: %v", kinds)
+	}
+
+	// client errors and receipts without an amount are not reported
+	performRequest(r, http.MethodGet, apiPrefix+"/profile", nil, "", "")
+	fake.Set("blank.jpg", ocrtest.Script{Result: &ocr.Result{}})
+	uploadFile(r, token, "blank.jpg", testenv.JPEG)
+	if events := rec.take(); len(events) != 0 {
+		t.Fatalf("unexpected reports: %+v", events)
+	}
+}
+
+func TestE2EDatabaseOutage(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	prev := dbBreaker
+	t.Cleanup(func() { dbBreaker = prev })
+	dbBreaker = &dbhealth.Breaker{Threshold: 3, Cooldown: 200 * time.Millisecond}
+	if err := dbhealth.Watch(db, dbBreaker); err != nil {
+		t.Fatal(err)
+	}
+	var down atomic.Bool
+	db.Callback().Query().Before("gorm:query").Register("test:outage", func(d *gorm.DB) {
+		if down.Load() {
+			d.AddError(driver.ErrBadConn)
+		}
+	})
+
+	down.Store(true)
+	// a failed lookup during an outage must not log the user out
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, token, "")
+	if resp.Code != http.StatusServiceUnavailable || !strings.Contains(resp.Body.String(), `"db_unavailable"`) || resp.Header().Get("Retry-After") == "" {
+		t.Fatalf("outage: %d %s %v", resp.Code, resp.Body.String(), resp.Header())
+	}
+	for range 3 {
+		performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, token, "")
+	}
+	if !dbBreaker.Open() {
+		t.Fatal("breaker still closed")
+	}
+	// once open, requests are turned away before reaching the database
+	down.Store(false)
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, token, ""); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("open breaker let a request through: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodGet, "/health", nil, "", ""); resp.Code != http.StatusOK {
+		t.Fatalf("health during outage: %d", resp.Code)
+	}
+
+	// after the cooldown a probe finds the database back and closes it
+	time.Sleep(250 * time.Millisecond)
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("probe: %d %s", resp.Code, resp.Body.String())
+	}
+	if dbBreaker.Open() {
+		t.Fatal("breaker still open after a successful probe")
+	}
+}
+
+func TestE2EAdminJobs(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	prev := jobScheduler
+	t.Cleanup(func() { jobScheduler = prev })
+	jobScheduler = newJobScheduler()
+	release := make(chan struct{})
+	every, _ := scheduler.Parse("@every 1h", nil)
+	jobScheduler.Register(scheduler.Job{Name: "slow_job", Schedule: every, Run: func(context.Context) (string, error) {
+		<-release
+		return "done", nil
+	}})
+	admin := loginToken(t, r, "admin", "admin123")
+	demo := loginToken(t, r, "demo", "demo1234")
+
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/jobs", nil, demo, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin listed jobs: %d", resp.Code)
+	}
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/jobs/slow_job/run", nil, admin, "")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("trigger: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/jobs/slow_job/run", nil, admin, ""); resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "job_running") {
+		t.Fatalf("second trigger: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/jobs", nil, admin, "")
+	var list struct {
+		Items []struct {
+			Name     string
+			Schedule string
+			Running  bool
+			LastRun  *models.JobRun `json:"last_run"`
+		}
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &list)
+	jobs := map[string]bool{}
+	for _, j := range list.Items {
+		jobs[j.Name] = true
+		if j.Name == "slow_job" && (!j.Running || j.LastRun == nil || j.LastRun.Status != scheduler.StatusRunning) {
+			t.Fatalf("slow_job while running: %+v", j)
+		}
+	}
+	if !jobs["weekly_digest"] || !jobs["token_janitor"] || jobs["catatan_archive"] {
+		t.Fatalf("jobs = %s", resp.Body.String())
+	}
+
+	close(release)
+	jobScheduler.Wait()
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/jobs/slow_job/runs", nil, admin, "")
+	var runs struct{ Items []models.JobRun }
+	_ = json.Unmarshal(resp.Body.Bytes(), &runs)
+	if len(runs.Items) != 1 || runs.Items[0].Status != scheduler.StatusSucceeded || runs.Items[0].Result != "done" || runs.Items[0].TriggeredBy == nil {
+		t.Fatalf("runs: %s", resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/jobs/nope/run", nil, admin, ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: %d", resp.Code)
+	}
+
+	// the digest job runs through the same path
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/jobs/weekly_digest/run", nil, admin, ""); resp.Code != http.StatusAccepted {
+		t.Fatalf("digest trigger: %d %s", resp.Code, resp.Body.String())
+	}
+	jobScheduler.Wait()
+	var n int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "job.trigger").Count(&n)
+	if n != 2 {
+		t.Fatalf("audit rows = %d", n)
+	}
+}
+
+// hostRouter serves requests as if sent to host, e.g. a tenant's subdomain.
+type hostRouter struct {
+	r    http.Handler
+	host string
+}
+
+func (h hostRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.Host = h.host
+	h.r.ServeHTTP(w, req)
+}
+
+func TestE2EMultiTenant(t *testing.T) {
+	t.Setenv("DEBUG_ENDPOINTS", "on")
+	r, fake := setupE2E(t, demoUser)
+	prev := tenancyCfg
+	t.Cleanup(func() { tenancyCfg = prev })
+	tenancyCfg = tenancy.Config{Enabled: true, BaseDomain: "fekeu.test", Header: "X-Tenant"}
+	if err := db.Use(tenancy.Plugin{}); err != nil {
+		t.Fatal(err)
+	}
+	acme := hostRouter{r, "acme.fekeu.test"}
+	admin := loginToken(t, r, "admin", "admin123")
+	demo := loginToken(t, r, "demo", "demo1234")
+	demoCatatan := performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(`{"file_name":"kopi.jpg","amount":25000}`), demo, "application/json")
+	if demoCatatan.Code != http.StatusOK {
+		t.Fatalf("demo catatan: %d %s", demoCatatan.Code, demoCatatan.Body.String())
+	}
+
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/admin/tenants", bytes.NewBufferString(`{"slug":"acme","name":"Acme","primary_color":"#FF0000","max_users":1,"max_uploads_per_month":1}`), admin, "application/json")
+	var tenant models.Tenant
+	_ = json.Unmarshal(resp.Body.Bytes(), &tenant)
+	if resp.Code != http.StatusCreated || tenant.ID == 0 {
+		t.Fatalf("create tenant: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(acme, http.MethodGet, apiPrefix+"/tenant", nil, "", "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"primary_color":"#ff0000"`) || !strings.Contains(resp.Body.String(), `"name":"Acme"`) {
+		t.Fatalf("branding: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(hostRouter{r, "nope.fekeu.test"}, http.MethodGet, apiPrefix+"/tenant", nil, "", ""); resp.Code != http.StatusNotFound || !strings.Contains(resp.Body.String(), "tenant_not_found") {
+		t.Fatalf("unknown tenant: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// accounts belong to the tenant they registered on; usernames stay global
+	register := func(h http.Handler, name string) int {
+		return performRequest(h, http.MethodPost, apiPrefix+"/register", bytes.NewBufferString(`{"username":"`+name+`","password":"secret99"}`), "", "application/json").Code
+	}
+	if code := register(acme, "demo"); code != http.StatusConflict {
+		t.Fatalf("taken username: %d", code)
+	}
+	if code := register(acme, "alice"); code != http.StatusOK {
+		t.Fatalf("register alice: %d", code)
+	}
+	if code := register(acme, "bob"); code != http.StatusForbidden {
+		t.Fatalf("register beyond max_users: %d", code)
+	}
+	body, _ := json.Marshal(map[string]string{"username": "alice", "password": "secret99"})
+	if resp := performRequest(r, http.MethodPost, apiPrefix+"/login", bytes.NewBuffer(body), "", "application/json"); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("alice logged in on the default tenant: %d", resp.Code)
+	}
+	alice := loginToken(t, acme, "alice", "secret99")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/me", nil, alice, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("acme token accepted on the default tenant: %d", resp.Code)
+	}
+	if resp := performRequest(acme, http.MethodGet, apiPrefix+"/me", nil, demo, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("default token accepted on acme: %d", resp.Code)
+	}
+	// the header names a tenant as well as the subdomain does
+	req, _ := http.NewRequest(http.MethodGet, apiPrefix+"/me", nil)
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("X-Tenant: %d %s", rec.Code, rec.Body.String())
+	}
+
+	fake.Amount("nota.jpg", 50000, "Rp 50.000")
+	if res := uploadFile(acme, alice, "nota.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("acme upload: %d %s", res.Code, res.Raw)
+	}
+	if res := uploadFile(acme, alice, "nota2.jpg", testenv.JPEG); res.Code != http.StatusForbidden || !strings.Contains(res.Raw, "quota_exceeded") {
+		t.Fatalf("upload beyond the monthly limit: %d %s", res.Code, res.Raw)
+	}
+	var aliceUser models.User
+	db.Where("username = ?", "alice").First(&aliceUser)
+	var ct models.CatatanKeuangan
+	db.Where("user_id = ?", aliceUser.ID).First(&ct)
+	if aliceUser.TenantID != tenant.ID || ct.TenantID != tenant.ID {
+		t.Fatalf("tenant ids: user=%d catatan=%d", aliceUser.TenantID, ct.TenantID)
+	}
+
+	// a tenant administrator sees the tenant's data only and no platform settings
+	var adminRole models.Role
+	db.Where("name = ?", "administrator").First(&adminRole)
+	db.Model(&aliceUser).Update("role_id", adminRole.ID)
+	userCache.Invalidate(aliceUser.ID)
+	alice = loginToken(t, acme, "alice", "secret99")
+	var items []models.CatatanKeuangan
+	resp = performRequest(acme, http.MethodGet, apiPrefix+"/catatan", nil, alice, "")
+	_ = json.Unmarshal(resp.Body.Bytes(), &items)
+	if len(items) != 1 || items[0].ID != ct.ID {
+		t.Fatalf("tenant admin catatan: %s", resp.Body.String())
+	}
+	if resp := performRequest(acme, http.MethodPut, apiPrefix+"/admin/users/demo/role", bytes.NewBufferString(`{"role":"administrator"}`), alice, "application/json"); resp.Code != http.StatusNotFound {
+		t.Fatalf("tenant admin reached another tenant's user: %d", resp.Code)
+	}
+	if resp := performRequest(acme, http.MethodGet, apiPrefix+"/admin/tenants", nil, alice, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("tenant admin listed tenants: %d", resp.Code)
+	}
+	// profiles and runtime vars span every tenant
+	for _, path := range []string{"/debug/vars", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+		if resp := performRequest(acme, http.MethodGet, path, nil, alice, ""); resp.Code != http.StatusForbidden {
+			t.Fatalf("tenant admin reached %s: %d", path, resp.Code)
+		}
+	}
+	if resp := performRequest(r, http.MethodGet, "/debug/vars", nil, admin, ""); resp.Code != http.StatusOK {
+		t.Fatalf("platform admin debug vars: %d", resp.Code)
+	}
+	if resp := performRequest(acme, http.MethodGet, apiPrefix+"/admin/analytics", nil, alice, ""); resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"total_users":1`) {
+		t.Fatalf("tenant analytics: %d %s", resp.Code, resp.Body.String())
+	}
+	items = nil
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, admin, "")
+	_ = json.Unmarshal(resp.Body.Bytes(), &items)
+	for _, it := range items {
+		if it.ID == ct.ID {
+			t.Fatalf("default tenant listed acme's catatan: %s", resp.Body.String())
+		}
+	}
+
+	// suspending the tenant turns its requests away
+	resp = performRequest(r, http.MethodPut, fmt.Sprintf("%s/admin/tenants/%d", apiPrefix, tenant.ID), bytes.NewBufferString(`{"disabled":true}`), admin, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("suspend: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(acme, http.MethodGet, apiPrefix+"/me", nil, alice, ""); resp.Code != http.StatusForbidden || !strings.Contains(resp.Body.String(), "tenant_disabled") {
+		t.Fatalf("suspended tenant: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2ECatatanHistogram(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a.jpg", Amount: 10000, Date: "2025-08-01"},
+			{User: "demo", FileName: "b.jpg", Amount: 49999, Date: "2025-08-02"},
+			{User: "demo", FileName: "c.jpg", Amount: 50000, Date: "2025-08-03"},
+			{User: "demo", FileName: "d.jpg", Amount: 125000, Date: "2025-08-04"},
+			{User: "demo", FileName: "zero.jpg", Amount: 0, Date: "2025-08-05"},
+			{User: "demo", FileName: "july.jpg", Amount: 20000, Date: "2025-07-31"},
+			{User: "ani", FileName: "a.jpg", Amount: 30000, Date: "2025-08-01"},
+		},
+	})
+	token := loginToken(t, r, "demo", "demo1234")
+	type bucket struct {
+		Min   int64  `json:"min"`
+		Max   *int64 `json:"max"`
+		Count int64  `json:"count"`
+		Total int64  `json:"total"`
+	}
+	get := func(query string) (int, []bucket, int64) {
+		t.Helper()
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/histogram"+query, nil, token, "")
+		var out struct {
+			Count   int64    `json:"count"`
+			Buckets []bucket `json:"buckets"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &out)
+		return resp.Code, out.Buckets, out.Count
+	}
+
+	code, buckets, count := get("?from=2025-08-01&to=2025-08-31")
+	if code != http.StatusOK || count != 4 || len(buckets) != 3 {
+		t.Fatalf("histogram: %d %+v", code, buckets)
+	}
+	if b := buckets[0]; b.Min != 0 || *b.Max != 50000 || b.Count != 2 || b.Total != 59999 {
+		t.Fatalf("first bucket: %+v", b)
+	}
+	if b := buckets[2]; b.Min != 100000 || *b.Max != 150000 || b.Count != 1 {
+		t.Fatalf("last bucket: %+v", b)
+	}
+	if _, buckets, count := get("?bucket=100000"); count != 5 || len(buckets) != 2 || buckets[0].Count != 4 {
+		t.Fatalf("bucket=100000: %d %+v", count, buckets)
+	}
+	// amounts beyond the last bucket are counted in it
+	if _, buckets, _ := get("?bucket=100"); len(buckets) != 5 || buckets[4].Max != nil || buckets[4].Min != 99900 || buckets[4].Total != 125000 {
+		t.Fatalf("open bucket: %+v", buckets)
+	}
+	if code, _, _ := get("?bucket=0"); code != http.StatusBadRequest {
+		t.Fatalf("bucket=0: %d", code)
+	}
+}
+
+func TestE2ECatatanTop(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a.jpg", Amount: 50000, Date: "2025-08-01"},
+			{User: "demo", FileName: "b.jpg", Amount: 30000, Date: "2025-08-02"},
+			{User: "demo", FileName: "c.jpg", Amount: 20000, Date: "2025-08-03"},
+			{User: "demo", FileName: "d.jpg", Amount: 5000, Date: "2025-08-04"},
+			{User: "demo", FileName: "e.jpg", Amount: 7000, Date: "2025-08-05"},
+			{User: "demo", FileName: "july.jpg", Amount: 90000, Date: "2025-07-01"},
+			{User: "ani", FileName: "a.jpg", Amount: 99000, Date: "2025-08-01"},
+		},
+	})
+	token := loginToken(t, r, "demo", "demo1234")
+	for name, merchant := range map[string]string{"a.jpg": "Indomaret", "b.jpg": "Alfamart", "c.jpg": "Indomaret", "d.jpg": "Warung Bu Sri", "july.jpg": "Alfamart"} {
+		db.Model(&models.CatatanKeuangan{}).Where("file_name = ?", name).Update("merchant", merchant)
+	}
+	resp := performRequest(r, http.MethodPost, apiPrefix+"/catatan", strings.NewReader(`{"file_name":"f","amount":1000,"date":"2025-08-06T10:00:00Z","merchant":" Alfamart ","category":"makan"}`), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create with merchant: %d %s", resp.Code, resp.Body.String())
+	}
+	type entry struct {
+		Key   string `json:"key"`
+		Count int64  `json:"count"`
+		Total int64  `json:"total"`
+	}
+	var out struct {
+		Items      []entry `json:"items"`
+		Others     entry   `json:"others"`
+		Unassigned entry   `json:"unassigned"`
+		Total      int64   `json:"total"`
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan/top?by=merchant&limit=2&from=2025-08-01&to=2025-08-31", nil, token, "")
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &out) != nil {
+		t.Fatalf("top merchants: %d %s", resp.Code, resp.Body.String())
+	}
+	if len(out.Items) != 2 || out.Items[0] != (entry{"Indomaret", 2, 70000}) || out.Items[1] != (entry{"Alfamart", 2, 31000}) {
+		t.Fatalf("items: %+v", out.Items)
+	}
+	if out.Others != (entry{"others", 1, 5000}) || out.Unassigned.Total != 7000 || out.Total != 113000 {
+		t.Fatalf("others / unassigned: %s", resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan/top", nil, token, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"items":[{"key":"makan","count":1,"total":1000}]`) {
+		t.Fatalf("top categories: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/top?by=account", nil, token, ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("by=account: %d", resp.Code)
+	}
+}
+
+func TestE2ECatatanCalendar(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a.jpg", Amount: 10000, Date: "2025-03-01T02:00:00Z"},
+			{User: "demo", FileName: "b.jpg", Amount: 15000, Date: "2025-03-01T14:00:00Z"},
+			// the days are Jakarta's: 23:30 and 00:30 there
+			{User: "demo", FileName: "c.jpg", Amount: 40000, Date: "2025-12-31T16:30:00Z"},
+			{User: "demo", FileName: "d.jpg", Amount: 5000, Date: "2025-12-31T17:30:00Z"},
+		},
+	})
+	token := loginToken(t, r, "demo", "demo1234")
+	performRequest(r, http.MethodPut, apiPrefix+"/me/preferences", strings.NewReader(`{"timezone":"Asia/Jakarta"}`), token, "application/json")
+
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/calendar?year=2025", nil, token, "")
+	want := `{"count":3,"days":[{"date":"2025-03-01","count":2,"total":25000},{"date":"2025-12-31","count":1,"total":40000}],"max_total":40000,"total":65000,"year":2025}`
+	if resp.Code != http.StatusOK || resp.Body.String() != want {
+		t.Fatalf("calendar: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan/calendar?year=25x", nil, token, ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("bad year: %d", resp.Code)
+	}
+}
+
+func TestE2ESavedViews(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "q3-makan.jpg", Amount: 45000, Date: "2025-08-01"},
+			{User: "demo", FileName: "q3-kecil.jpg", Amount: 5000, Date: "2025-08-02"},
+			{User: "demo", FileName: "q3-bensin.jpg", Amount: 90000, Date: "2025-09-03"},
+			{User: "demo", FileName: "q4-makan.jpg", Amount: 60000, Date: "2025-10-01"},
+		},
+	})
+	db.Model(&models.CatatanKeuangan{}).Where("file_name LIKE ?", "%makan%").Update("category", "Makan")
+	db.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "q3-kecil.jpg").Update("category", "makan")
+	token := loginToken(t, r, "demo", "demo1234")
+	send := func(method, path, body, tok string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), tok, "application/json")
+	}
+
+	body := `{"name":"Q3 makan","filters":{"from":"2025-07-01","to":"2025-09-30","categories":["Makan"],"min_amount":10000}}`
+	resp := send(http.MethodPost, "/views", body, token)
+	var view struct {
+		ID uint `json:"id"`
+	}
+	if resp.Code != http.StatusCreated || json.Unmarshal(resp.Body.Bytes(), &view) != nil {
+		t.Fatalf("create: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := send(http.MethodPost, "/views", body, token); resp.Code != http.StatusConflict {
+		t.Fatalf("same name: %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, "/views", `{"name":"x","filters":{"from":"2025-10-01","to":"2025-09-30"}}`, token); resp.Code != http.StatusBadRequest {
+		t.Fatalf("from after to: %d", resp.Code)
+	}
+
+	resp = send(http.MethodGet, fmt.Sprintf("/catatan?view=%d", view.ID), "", token)
+	var items []models.CatatanKeuangan
+	json.Unmarshal(resp.Body.Bytes(), &items)
+	if resp.Code != http.StatusOK || len(items) != 1 || items[0].FileName != "q3-makan.jpg" {
+		t.Fatalf("list with view: %d %s", resp.Code, resp.Body.String())
+	}
+	// from / to given with the view win over its dates
+	resp = send(http.MethodGet, fmt.Sprintf("/catatan?view=%d&to=2025-12-31", view.ID), "", token)
+	if json.Unmarshal(resp.Body.Bytes(), &items); len(items) != 2 {
+		t.Fatalf("view with to: %s", resp.Body.String())
+	}
+	resp = send(http.MethodGet, fmt.Sprintf("/catatan/histogram?view=%d", view.ID), "", token)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"count":1`) {
+		t.Fatalf("histogram with view: %d %s", resp.Code, resp.Body.String())
+	}
+
+	other := loginToken(t, r, "ani", "ani12345")
+	if resp := send(http.MethodGet, fmt.Sprintf("/catatan?view=%d", view.ID), "", other); resp.Code != http.StatusNotFound {
+		t.Fatalf("another user's view: %d", resp.Code)
+	}
+	resp = send(http.MethodPut, fmt.Sprintf("/views/%d", view.ID), `{"name":"Q3 semua makan","filters":{"categories":["makan"]}}`, token)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"name":"Q3 semua makan"`) {
+		t.Fatalf("update: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := send(http.MethodGet, "/views", "", token); !strings.Contains(resp.Body.String(), `"categories":["makan"]`) {
+		t.Fatalf("list views: %s", resp.Body.String())
+	}
+	if resp := send(http.MethodDelete, fmt.Sprintf("/views/%d", view.ID), "", token); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.Code)
+	}
+}
+
+func TestE2ECatatanBulkEdit(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a.jpg", Amount: 10000, Date: "2025-08-01"},
+			{User: "demo", FileName: "b.jpg", Amount: 20000, Date: "2025-08-02"},
+			{User: "ani", FileName: "c.jpg", Amount: 30000, Date: "2025-08-03"},
+		},
+	})
+	token := loginToken(t, r, "demo", "demo1234")
+	var cats []models.CatatanKeuangan
+	db.Order("id").Find(&cats)
+	a, b, anis := cats[0], cats[1], cats[2]
+	acct := models.Account{UserID: a.UserID, Name: "BCA", Type: "bank"}
+	db.Create(&acct)
+	patch := func(body string) *httptest.ResponseRecorder {
+		return performRequest(r, http.MethodPatch, apiPrefix+"/catatan/bulk", strings.NewReader(body), token, "application/json")
+	}
+
+	// another user's catatan fails the whole batch
+	resp := patch(fmt.Sprintf(`{"ids":[%d,%d,%d],"update":{"category":"Makan"}}`, a.ID, b.ID, anis.ID))
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), fmt.Sprintf(`{"id":%d,"updated":false,"error":"not_found"}`, anis.ID)) {
+		t.Fatalf("foreign id: %d %s", resp.Code, resp.Body.String())
+	}
+	if db.First(&a, a.ID); a.Category != "" {
+		t.Fatal("a failed batch changed a catatan")
+	}
+	if resp := patch(fmt.Sprintf(`{"ids":[%d],"update":{}}`, a.ID)); resp.Code != http.StatusBadRequest {
+		t.Fatalf("empty update: %d", resp.Code)
+	}
+
+	resp = patch(fmt.Sprintf(`{"ids":[%d,%d,%d],"update":{"category":" Makan ","account_id":%d}}`, a.ID, b.ID, a.ID, acct.ID))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"updated":2`) {
+		t.Fatalf("bulk edit: %d %s", resp.Code, resp.Body.String())
+	}
+	db.Order("id").Find(&cats)
+	for _, ct := range cats[:2] {
+		if ct.Category != "Makan" || ct.AccountID == nil || *ct.AccountID != acct.ID {
+			t.Fatalf("%s: %+v", ct.FileName, ct)
+		}
+	}
+	if cats[2].Category != "" {
+		t.Fatal("ani's catatan changed")
+	}
+	var n int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "catatan.bulk_update").Count(&n)
+	if n != 1 {
+		t.Fatalf("audit entries = %d", n)
+	}
+	if resp := patch(fmt.Sprintf(`{"ids":[%d],"update":{"account_id":0}}`, a.ID)); resp.Code != http.StatusOK {
+		t.Fatalf("clear account: %d %s", resp.Code, resp.Body.String())
+	}
+	if db.First(&a, a.ID); a.AccountID != nil {
+		t.Fatal("account not cleared")
+	}
+}
+
+func TestE2EAdminCatatan(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a.jpg", Amount: 10000, Date: "2025-08-01T00:00:00Z"},
+			{User: "demo", FileName: "b.jpg", Amount: 20000, Date: "2025-08-02T00:00:00Z"},
+			{User: "ani", FileName: "c.jpg", Amount: 30000, Date: "2025-09-03T00:00:00Z"},
+		},
+		Uploads: []fixtures.Upload{{User: "demo", FileName: "a.jpg", StorePath: "public/keu/a.jpg", ContentType: "image/jpeg"}},
+	})
+	db.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "b.jpg").Update("pending", true)
+	adminToken := loginToken(t, r, "admin", "admin123")
+	list := func(query string) (int, struct {
+		Total int64
+		Items []adminCatatan
+	}) {
+		resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/catatan"+query, nil, adminToken, "")
+		var out struct {
+			Total int64
+			Items []adminCatatan
+		}
+		_ = json.Unmarshal(resp.Body.Bytes(), &out)
+		return resp.Code, out
+	}
+
+	code, out := list("")
+	if code != http.StatusOK || out.Total != 3 || len(out.Items) != 3 {
+		t.Fatalf("list: %d %+v", code, out)
+	}
+	c, a := out.Items[0], out.Items[2]
+	if c.Username != "ani" || c.UploadID != nil || a.Username != "demo" || a.UploadID == nil || *a.StorePath != "public/keu/a.jpg" {
+		t.Fatalf("items: %+v", out.Items)
+	}
+	if _, out := list("?username=demo&status=pending"); out.Total != 1 || out.Items[0].FileName != "b.jpg" {
+		t.Fatalf("demo pending: %+v", out)
+	}
+	if _, out := list("?from=2025-09-01&limit=1"); out.Total != 1 || out.Items[0].FileName != "c.jpg" {
+		t.Fatalf("from: %+v", out)
+	}
+	if _, out := list("?limit=1&offset=1"); out.Total != 3 || len(out.Items) != 1 || out.Items[0].FileName != "b.jpg" {
+		t.Fatalf("page: %+v", out)
+	}
+	if code, _ := list("?status=lost"); code != http.StatusBadRequest {
+		t.Fatalf("bad status: %d", code)
+	}
+	if code, _ := list("?username=nobody"); code != http.StatusNotFound {
+		t.Fatalf("unknown user: %d", code)
+	}
+	demo := loginToken(t, r, "demo", "demo1234")
+	if resp := performRequest(r, http.MethodGet, apiPrefix+"/admin/catatan", nil, demo, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: %d", resp.Code)
+	}
+}
+
+func TestE2EUploadNotes(t *testing.T) {
+	r, _ := setupE2E(t, &fixtures.Set{
+		Users:   []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "a.jpg", Amount: 10000, Date: "2025-08-01T00:00:00Z"}},
+		Uploads: []fixtures.Upload{{User: "demo", FileName: "a.jpg", StorePath: "public/keu/a.jpg", ContentType: "image/jpeg"}},
+	})
+	var up models.Upload
+	db.First(&up)
+	path := fmt.Sprintf("%s/uploads/%d/notes", apiPrefix, up.ID)
+	adminToken := loginToken(t, r, "admin", "admin123")
+	demo := loginToken(t, r, "demo", "demo1234")
+	ani := loginToken(t, r, "ani", "ani12345")
+
+	resp := performRequest(r, http.MethodPost, path, strings.NewReader(`{"note":" blurred, asked to re-upload "}`), adminToken, "application/json")
+	if resp.Code != http.StatusCreated || !strings.Contains(resp.Body.String(), `"Body":"blurred, asked to re-upload"`) {
+		t.Fatalf("admin note: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodPost, path, strings.NewReader(`{"note":"uploaded a sharper one"}`), demo, "application/json"); resp.Code != http.StatusCreated {
+		t.Fatalf("owner note: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := performRequest(r, http.MethodPost, path, strings.NewReader(`{"note":"mine now"}`), ani, "application/json"); resp.Code != http.StatusForbidden {
+		t.Fatalf("other user: %d", resp.Code)
+	}
+	if resp := performRequest(r, http.MethodPost, path, strings.NewReader(`{"note":"  "}`), demo, "application/json"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("empty note: %d", resp.Code)
+	}
+
+	resp = performRequest(r, http.MethodGet, path, nil, demo, "")
+	var notes []models.UploadNote
+	_ = json.Unmarshal(resp.Body.Bytes(), &notes)
+	if resp.Code != http.StatusOK || len(notes) != 2 || notes[0].Username != "admin" || notes[1].Username != "demo" {
+		t.Fatalf("list: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/admin/catatan", nil, adminToken, "")
+	if !strings.Contains(resp.Body.String(), `"upload_notes":2`) {
+		t.Fatalf("admin view: %s", resp.Body.String())
+	}
+	var n int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "upload.note").Count(&n)
+	if n != 2 {
+		t.Fatalf("audit entries = %d", n)
+	}
+}
+
+func TestE2EOCRCalibration(t *testing.T) {
+	defer ocr.SetCalibration(nil)
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+	send := func(method, path, body, tok string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), tok, "application/json")
+	}
+	fake.Set("ragu.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 5000, Confidence: 0.35, RawConfidence: 0.35,
+		Heuristic: ocr.HeuristicZeroBlock, Raw: "5000", NeedsConfirmation: true}})
+	fake.Amount("yakin.jpg", 30000, "Rp 30.000")
+
+	// owners reviewing low-confidence readings get them pending
+	if resp := send(http.MethodPut, "/me/preferences", `{"review_low_confidence":true}`, token); resp.Code != http.StatusOK {
+		t.Fatalf("preferences: %d %s", resp.Code, resp.Body.String())
+	}
+	res := uploadFile(r, token, "ragu.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK || res.Body["pending"] != true {
+		t.Fatalf("low-confidence upload: %d %s", res.Code, res.Raw)
+	}
+	ragu := uint(res.Body["catatan_id"].(float64))
+	if res := uploadFile(r, token, "yakin.jpg", receiptJPEG(t)); res.Body["pending"] != false {
+		t.Fatalf("confident upload must not be pending: %s", res.Raw)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "ragu.jpg").First(&up)
+	if up.OCRHeuristic != ocr.HeuristicZeroBlock || up.OCRRawConfidence == nil || *up.OCRRawConfidence != 0.35 {
+		t.Fatalf("upload heuristic %q raw %v", up.OCRHeuristic, up.OCRRawConfidence)
+	}
+
+	// the first confirmation is recorded as a review, later ones are not
+	for i := 0; i < 2; i++ {
+		if resp := send(http.MethodPost, fmt.Sprintf("/catatan/%d/confirm", ragu), `{"amount":50000}`, token); resp.Code != http.StatusOK {
+			t.Fatalf("confirm: %d %s", resp.Code, resp.Body.String())
+		}
+	}
+	var reviews []models.AuditLog
+	db.Where("action = ?", ocrcalib.ReviewAction).Find(&reviews)
+	if len(reviews) != 1 || !strings.Contains(reviews[0].Detail, `"corrected":true`) || !strings.Contains(reviews[0].Detail, `"ocr_amount":5000`) {
+		t.Fatalf("reviews: %+v", reviews)
+	}
+	for i := 0; i < 40; i++ {
+		d := fmt.Sprintf(`{"heuristic":"match","raw_confidence":0.9,"corrected":%t}`, i%10 < 3)
+		db.Create(&models.AuditLog{Action: ocrcalib.ReviewAction, Detail: d})
+	}
+
+	if resp := send(http.MethodPost, "/admin/ocr/calibration", `{}`, token); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin refit: %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, "/admin/ocr/calibration", `{"bins":0.5}`, adminToken); resp.Code != http.StatusBadRequest {
+		t.Fatalf("bad bins: %d", resp.Code)
+	}
+	resp := send(http.MethodPost, "/admin/ocr/calibration", `{"dry_run":true}`, adminToken)
+	var fit struct {
+		Calibration ocr.Calibration `json:"calibration"`
+		Calibrated  []string        `json:"calibrated"`
+		Brier       struct{ Raw, Calibrated float64 }
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &fit); err != nil || resp.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", resp.Code, resp.Body.String())
+	}
+	if fit.Calibration.Samples != 41 || len(fit.Calibrated) != 1 || len(fit.Calibration.Heuristics) != 2 || fit.Brier.Calibrated >= fit.Brier.Raw {
+		t.Fatalf("dry run fit: %s", resp.Body.String())
+	}
+	if ocr.CurrentCalibration() != nil {
+		t.Fatal("dry run installed the calibration")
+	}
+	if resp := send(http.MethodPost, "/admin/ocr/calibration", "", adminToken); resp.Code != http.StatusOK {
+		t.Fatalf("refit: %d %s", resp.Code, resp.Body.String())
+	}
+	cal := ocr.CurrentCalibration()
+	if p, ok := cal.Probability(ocr.HeuristicMatch, 0.9); !ok || p < 0.65 || p > 0.8 {
+		t.Fatalf("installed calibration: %v %v", p, ok)
+	}
+	// one review is too few to calibrate zero_block
+	if _, ok := cal.Probability(ocr.HeuristicZeroBlock, 0.35); ok {
+		t.Fatal("zero_block calibrated from a single review")
+	}
+	resp = send(http.MethodGet, "/admin/ocr/calibration", "", adminToken)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"reviews":41`) || !strings.Contains(resp.Body.String(), `"zero_block"`) {
+		t.Fatalf("stored calibration: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EOCRExperiment(t *testing.T) {
+	defer ocr.SetOptions(ocr.Options{})
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+	send := func(method, path, body, tok string) *httptest.ResponseRecorder {
+		return performRequest(r, method, apiPrefix+path, strings.NewReader(body), tok, "application/json")
+	}
+	fake.Amount("sama.jpg", 30000, "Rp 30.000")
+	fake.Amount("beda.jpg", 9000, "Rp 9.000")
+	candidate := ocrtest.New().Amount("sama.jpg", 30000, "Rp 30.000").Amount("beda.jpg", 90000, "Rp 90.000")
+	var candidateOpts ocr.Options
+	prev := ocrexp.NewCandidate
+	ocrexp.NewCandidate = func(o ocr.Options) ocr.Engine { candidateOpts = o; return candidate }
+	t.Cleanup(func() { ocrexp.NewCandidate = prev })
+
+	if resp := send(http.MethodPut, "/admin/ocr/experiment", `{"name":"mp4","percent":100}`, token); resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin start: %d", resp.Code)
+	}
+	for _, body := range []string{`{"name":"mp4","percent":0}`, `{"name":"Bad Name","percent":50}`, `{"name":"mp4","percent":100,"candidate":{"max_megapixels":-1}}`} {
+		if resp := send(http.MethodPut, "/admin/ocr/experiment", body, adminToken); resp.Code != http.StatusBadRequest {
+			t.Fatalf("invalid experiment %s: %d", body, resp.Code)
+		}
+	}
+	if resp := send(http.MethodPut, "/admin/ocr/experiment", `{"name":"mp4","percent":100,"candidate":{"max_megapixels":4}}`, adminToken); resp.Code != http.StatusOK {
+		t.Fatalf("start: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// production readings are applied, the candidate's only recorded
+	if res := uploadFile(r, token, "sama.jpg", testenv.JPEG); res.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	res := uploadFile(r, token, "beda.jpg", receiptJPEG(t))
+	if res.Code != http.StatusOK || res.Body["ocr"].(map[string]any)["amount"] != float64(9000) {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	ocrexp.Wait()
+	if candidateOpts.MaxMegapixels != 4 {
+		t.Fatalf("candidate options %+v", candidateOpts)
+	}
+	beda := uint(res.Body["catatan_id"].(float64))
+	if resp := send(http.MethodPost, fmt.Sprintf("/catatan/%d/confirm", beda), `{"amount":90000}`, token); resp.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp := send(http.MethodGet, "/admin/ocr/experiment", "", adminToken)
+	var got struct {
+		Experiment *ocrexp.Experiment `json:"experiment"`
+		Summary    ocrexp.Summary     `json:"summary"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil || resp.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", resp.Code, resp.Body.String())
+	}
+	s := got.Summary
+	if got.Experiment == nil || got.Experiment.By != "admin" || s.Runs != 2 || s.Agree != 1 || s.Disagree != 1 ||
+		s.Reviewed != 1 || s.PrimaryCorrect != 0 || s.CandidateCorrect != 1 || len(s.RecentDisagreements) != 1 ||
+		s.RecentDisagreements[0].CandidateAmount != 90000 || s.RecentDisagreements[0].ProfileID == nil {
+		t.Fatalf("summary: %s", resp.Body.String())
+	}
+
+	if resp := send(http.MethodPost, "/admin/ocr/experiment/promote", "", adminToken); resp.Code != http.StatusOK {
+		t.Fatalf("promote: %d %s", resp.Code, resp.Body.String())
+	}
+	if o := ocr.CurrentOptions(); o.MaxMegapixels != 4 {
+		t.Fatalf("installed options %+v", o)
+	}
+	resp = send(http.MethodGet, "/admin/ocr/experiment?name=mp4", "", adminToken)
+	if !strings.Contains(resp.Body.String(), `"experiment":null`) || !strings.Contains(resp.Body.String(), `"max_megapixels":4`) || !strings.Contains(resp.Body.String(), `"runs":2`) {
+		t.Fatalf("after promotion: %s", resp.Body.String())
+	}
+	if resp := send(http.MethodPost, "/admin/ocr/experiment/promote", "", adminToken); resp.Code != http.StatusNotFound {
+		t.Fatalf("promote without experiment: %d", resp.Code)
+	}
+	// without an experiment nothing is shadowed
+	fake.Amount("lagi.jpg", 1000, "Rp 1.000")
+	if res := uploadFile(r, token, "lagi.jpg", append(append([]byte{}, testenv.JPEG...), 0)); res.Code != http.StatusOK || res.Body["catatan_id"] == nil {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	ocrexp.Wait()
+	var n int64
+	db.Model(&models.OCRShadowRun{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("shadow runs = %d", n)
+	}
+}
+
+func TestE2EQRISUpload(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	qr := &ocr.QRIS{Dynamic: true, Amount: 125000, Merchant: "KOPI KENANGAN"}
+	fake.Set("qris.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 125000, Confidence: ocr.QRISConfidence,
+		RawConfidence: ocr.QRISConfidence, Heuristic: ocr.HeuristicQRIS, Raw: "125000.00", QRIS: qr}})
+
+	res := uploadFile(r, token, "qris.jpg", testenv.JPEG)
+	if res.Code != http.StatusOK || res.Body["pending"] != false {
+		t.Fatalf("upload: %d %s", res.Code, res.Raw)
+	}
+	var ct models.CatatanKeuangan
+	if err := db.First(&ct, uint(res.Body["catatan_id"].(float64))).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ct.Amount != 125000 || ct.Merchant != "KOPI KENANGAN" {
+		t.Fatalf("catatan %+v", ct)
+	}
+}
+
+func TestE2ETransactionReference(t *testing.T) {
+	r, fake := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	for _, name := range []string{"bukti.jpg", "bukti-lagi.jpg"} {
+		fake.Set(name, ocrtest.Script{Result: &ocr.Result{Amount: 250000, Confidence: 0.9, RawConfidence: 0.9,
+			Heuristic: ocr.HeuristicMatch, Raw: "Rp 250.000", Reference: "231012345678"}})
+	}
+
+	first := uploadFile(r, token, "bukti.jpg", testenv.JPEG)
+	if first.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", first.Code, first.Raw)
+	}
+	// another screenshot of the same transfer is the same catatan
+	again := uploadFile(r, token, "bukti-lagi.jpg", receiptJPEG(t))
+	if again.Code != http.StatusOK || again.Body["catatan_id"] != first.Body["catatan_id"] {
+		t.Fatalf("re-screenshot: %d %s, first %s", again.Code, again.Raw, first.Raw)
+	}
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 1 {
+		t.Fatalf("%d catatan for one transfer", n)
+	}
+
+	var cats []models.CatatanKeuangan
+	resp := performRequest(r, http.MethodGet, apiPrefix+"/catatan?reference="+url.QueryEscape("2310 1234-5678"), nil, token, "")
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &cats) != nil || len(cats) != 1 {
+		t.Fatalf("search catatan: %d %s", resp.Code, resp.Body.String())
+	}
+	var ups []models.Upload
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/uploads?reference=231012345678", nil, token, "")
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &ups) != nil || len(ups) != 2 {
+		t.Fatalf("search uploads: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan?reference=999999999", nil, token, "")
+	if resp.Code != http.StatusOK || strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Fatalf("unknown reference: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EMaintenanceMode(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	adminToken := loginToken(t, r, "admin", "admin123")
+
+	resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/maintenance", bytes.NewBufferString(`{"enabled":true,"message":"migrasi database"}`), adminToken, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("enable: %d %s", resp.Code, resp.Body.String())
+	}
+	t.Cleanup(func() { _, _ = maintenance.Set(db, false, "", "test") })
+
+	body := `{"file_name":"m.jpg","amount":5000}`
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	if resp.Code != http.StatusServiceUnavailable || !strings.Contains(resp.Body.String(), "migrasi database") {
+		t.Fatalf("write during maintenance: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp = performRequest(r, http.MethodGet, apiPrefix+"/catatan", nil, token, ""); resp.Code != http.StatusOK {
+		t.Fatalf("read during maintenance: %d", resp.Code)
+	}
+	// only the login routes are exempt, not any path ending like them
+	for _, path := range []string{apiPrefix + "/me/sessions/refresh", "/me/sessions/login"} {
+		if resp = performRequest(r, http.MethodDelete, path, nil, token, ""); resp.Code != http.StatusServiceUnavailable {
+			t.Fatalf("DELETE %s during maintenance: %d %s", path, resp.Code, resp.Body.String())
+		}
+	}
+	// logging in still works, also through the legacy alias, so the switch can be lifted
+	if resp = performRequest(r, http.MethodPost, "/login", bytes.NewBufferString(`{"username":"demo","password":"demo1234"}`), "", "application/json"); resp.Code != http.StatusOK {
+		t.Fatalf("legacy login during maintenance: %d %s", resp.Code, resp.Body.String())
+	}
+	adminToken = loginToken(t, r, "admin", "admin123")
+	resp = performRequest(r, http.MethodPut, apiPrefix+"/admin/maintenance", bytes.NewBufferString(`{"enabled":false}`), adminToken, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("disable: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("write after maintenance: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2ECORSOverrideAndRules(t *testing.T) {
+	setupE2E(t, demoUser)
+	t.Setenv("ALLOWED_ORIGINS", "https://keu.example.com")
+	r := gin.New()
+	r.Use(corsMiddleware())
+	setupRoutes(r)
+	allowed := func(method, path, origin string) string {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := allowed(http.MethodOptions, apiPrefix+"/catatan", "https://keu.example.com"); got != "https://keu.example.com" {
+		t.Fatalf("env origin: %q", got)
+	}
+	if got := allowed(http.MethodGet, "/health", "https://status.other.org"); got != "*" {
+		t.Fatalf("health should be public: %q", got)
+	}
+	if got := allowed(http.MethodOptions, apiPrefix+"/ingest/email", "https://keu.example.com"); got != "" {
+		t.Fatalf("webhooks must not send CORS headers: %q", got)
+	}
+
+	adminToken := loginToken(t, r, "admin", "admin123")
+	resp := performRequest(r, http.MethodPut, apiPrefix+"/admin/cors", bytes.NewBufferString(`{"origins":["https://*.keu.example.com"]}`), adminToken, "application/json")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"admin override"`) {
+		t.Fatalf("override: %d %s", resp.Code, resp.Body.String())
+	}
+	if got := allowed(http.MethodOptions, apiPrefix+"/catatan", "https://pr-7.keu.example.com"); got != "https://pr-7.keu.example.com" {
+		t.Fatalf("wildcard after override: %q", got)
+	}
+	resp = performRequest(r, http.MethodPut, apiPrefix+"/admin/cors", bytes.NewBufferString(`{"origins":["https://app.*.com"]}`), adminToken, "application/json")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid pattern accepted: %d", resp.Code)
+	}
+	resp = performRequest(r, http.MethodPut, apiPrefix+"/admin/cors", bytes.NewBufferString(`{"origins":null}`), adminToken, "application/json")
+	if resp.Code != http.StatusOK || allowed(http.MethodOptions, apiPrefix+"/catatan", "https://keu.example.com") == "" {
+		t.Fatalf("clearing override: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestE2EListETag(t *testing.T) {
+	r, _ := setupE2E(t, demoUser)
+	token := loginToken(t, r, "demo", "demo1234")
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get(apiPrefix+"/catatan", "")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(tag, `W/"`) {
+		t.Fatalf("first: %d etag=%q", first.Code, tag)
+	}
+	if w := get(apiPrefix+"/catatan", tag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("unchanged list: %d", w.Code)
+	}
+	if w := get(apiPrefix+"/uploads", tag); w.Code != http.StatusOK {
+		t.Fatalf("tag leaked across endpoints: %d", w.Code)
+	}
+
+	body := `{"file_name":"baru.jpg","amount":1000}`
+	performRequest(r, http.MethodPost, apiPrefix+"/catatan", bytes.NewBufferString(body), token, "application/json")
+	if w := get(apiPrefix+"/catatan", tag); w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+		t.Fatalf("changed list still matched: %d", w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"be03/pkg/errreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- error reporting --------------------
+
+const (
+	errorCodeKey     = "error_code"     // set by writeError for the 5xx report
+	errorMessageKey  = "error_message"  // likewise
+	errorReportedKey = "error_reported" // a panic was already reported
+)
+
+// initErrorReporter installs the reporter chosen by ERROR_REPORTER /
+// SENTRY_DSN.
+func initErrorReporter() {
+	r, err := errreport.FromEnv("api")
+	if err != nil {
+		log.Fatalf("error reporting: %v", err)
+	}
+	errreport.Set(r)
+	if _, ok := r.(errreport.Nop); !ok {
+		log.Printf("error reporting: %T", r)
+	}
+}
+
+// requestEvent fills in the request context of an event: method, route,
+// status, request ID and the caller.
+func requestEvent(c *gin.Context, e errreport.Event) errreport.Event {
+	e.Request = &errreport.Request{Method: c.Request.Method, Route: c.FullPath(), Status: c.Writer.Status(), RequestID: c.GetString(requestIDKey)}
+	if e.Request.Route == "" {
+		e.Request.Route = "(unmatched)"
+	}
+	if user, ok := getUserFromContext(c); ok {
+		e.UserID = user.ID
+	}
+	return e
+}
+
+// errorReportMiddleware reports every 5xx response that a panic report did
+// not already cover. 503s are deliberate (maintenance, database outage) and
+// reported where the state changes instead.
+func errorReportMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		status := c.Writer.Status()
+		if status < 500 || status == http.StatusServiceUnavailable || c.GetBool(errorReportedKey) {
+			return
+		}
+		code := c.GetString(errorCodeKey)
+		e := errreport.Event{Message: fmt.Sprintf("HTTP %d %s", status, code), Tags: map[string]string{"kind": "http"}}
+		if code != "" {
+			e.Tags["error_code"] = code
+		}
+		if msg := c.GetString(errorMessageKey); msg != "" {
+			e.Extra = map[string]any{"message": msg}
+		}
+		errreport.Capture(requestEvent(c, e))
+	}
+}
+
+// reportPanic reports a recovered handler panic with its stack.
+func reportPanic(c *gin.Context, p any) {
+	c.Set(errorReportedKey, true)
+	e := requestEvent(c, errreport.Event{
+		Level:   "fatal",
+		Message: "panic",
+		Err:     fmt.Errorf("%v", p),
+		Stack:   string(debug.Stack()),
+		Tags:    map[string]string{"kind": "panic"},
+	})
+	e.Request.Status = 500 // the envelope is written after this
+	errreport.Capture(e)
+}
+
+// reportOCRFailure reports an OCR engine error other than a receipt without
+// an amount, which is a normal outcome.
+func reportOCRFailure(path string, err error) {
+	errreport.Capture(errreport.Event{
+		Message: "ocr engine failed",
+		Err:     err,
+		Tags:    map[string]string{"kind": "ocr", "engine": fmt.Sprintf("%T", ocrEngine)},
+		Extra:   map[string]any{"file": path},
+	})
+}
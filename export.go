@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"be03/pkg/acctexport"
+	"be03/pkg/apierr"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/userarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- account export --------------------
+
+// exportAccountHandler streams a zip with the caller's profile, preferences, catatan
+// (JSON and CSV) and receipt images. Restore it with `be03ctl user import`.
+func exportAccountHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	name := fmt.Sprintf("be03-export-%s-%s.zip", user.Username, time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if err := userarchive.Export(c.Writer, reportDB(c), user.ID, uploadfiles.LocateOriginal); err != nil {
+		// headers may already be flushed; log and cut the stream short
+		log.Printf("export failed for user=%d: %v", user.ID, err)
+		if !c.Writer.Written() {
+			writeError(c, apierr.QueryFailed, "", nil)
+		}
+		return
+	}
+}
+
+// receiptsArchiveHandler streams a zip of the caller's receipt images for
+// catatan dated from / to (YYYY-MM-DD in the user's timezone, both optional)
+// with an index.csv of those catatan, e.g. for an audit or a tax return.
+func receiptsArchiveHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	from, to, ok := dateRange(c, loc)
+	if !ok {
+		return
+	}
+	name := fmt.Sprintf("be03-receipts-%s-%s.zip", user.Username, time.Now().Format("20060102"))
+	if from != nil && to != nil {
+		name = fmt.Sprintf("be03-receipts-%s-%s-%s.zip", user.Username, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if err := userarchive.ExportReceipts(c.Writer, reportDB(c), user.ID, from, to, loc, uploadfiles.LocateOriginal); err != nil {
+		log.Printf("receipts archive failed for user=%d: %v", user.ID, err)
+		if !c.Writer.Written() {
+			writeError(c, apierr.QueryFailed, "", nil)
+		}
+	}
+}
+
+// -------------------- accounting export --------------------
+
+// accountingExportHandler streams the caller's confirmed catatan dated from /
+// to (YYYY-MM-DD in the user's timezone, both optional) or in a saved ?view=
+// as a journal import
+// file for ?format= (accurate, jurnal or quickbooks), using the caller's
+// mapping for that format (see /me/export-mappings/:format).
+func accountingExportHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	format := c.Query("format")
+	if _, ok := acctexport.Formats[format]; !ok {
+		writeError(c, apierr.InvalidBody, "format must be accurate, jurnal or quickbooks", gin.H{"field": "format"})
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	from, to, scope, ok := catatanRange(c, user.ID, loc)
+	if !ok {
+		return
+	}
+	// buffered so a failure mid-way still gets a proper error response
+	var buf bytes.Buffer
+	if _, err := acctexport.Export(&buf, reportDB(c), user.ID, format, from, to, loc, scope); err != nil {
+		log.Printf("%s export failed for user=%d: %v", format, user.ID, err)
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	name := fmt.Sprintf("be03-%s-%s-%s.csv", format, user.Username, time.Now().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+// getExportMappingHandler returns the caller's mapping for an accounting
+// export format, defaults filled in.
+func getExportMappingHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	m, err := acctexport.Load(db, user.ID, c.Param("format"))
+	if errors.Is(err, acctexport.ErrUnknownFormat) {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// putExportMappingHandler replaces the caller's mapping for an accounting
+// export format; fields left empty take the format's defaults.
+func putExportMappingHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	format := c.Param("format")
+	if _, ok := acctexport.Formats[format]; !ok {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	var m acctexport.Mapping
+	if err := c.ShouldBindJSON(&m); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if err := m.Validate(); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "columns"})
+		return
+	}
+	if err := acctexport.Save(db, user.ID, format, m); err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	m, _ = acctexport.Resolve(format, m)
+	c.JSON(http.StatusOK, m)
+}
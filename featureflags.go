@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/featureflags"
+	"be03/pkg/ocr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- feature flags --------------------
+
+var featureFlags = &featureflags.Cache{TTL: 5 * time.Second}
+
+// flagOn reports whether the feature key is on for the calling user.
+func flagOn(c *gin.Context, key string) bool {
+	var uid uint
+	if user, ok := getUserFromContext(c); ok {
+		uid = user.ID
+	}
+	return featureFlags.On(db, key, uid)
+}
+
+// itemizedFor is the OCR_ITEMIZED mode as it applies to the calling user:
+// "off" while the ocr_itemized flag is off for them.
+func itemizedFor(c *gin.Context) string {
+	if !flagOn(c, featureflags.OCRItemized) {
+		return ocr.ItemizedOff
+	}
+	return ocr.ItemizedMode()
+}
+
+type flagView struct {
+	Key         string   `json:"key"`
+	Description string   `json:"description"`
+	Stored      bool     `json:"stored"` // false: the code default applies
+	Default     bool     `json:"default"`
+	Enabled     bool     `json:"enabled"`
+	Percent     int      `json:"percent"`
+	Users       []string `json:"users"`
+}
+
+// newFlagView shows f with its users by name; stored is false for a known
+// flag without a row.
+func newFlagView(f models.FeatureFlag, stored bool) flagView {
+	def := featureflags.Known[f.Key]
+	v := flagView{Key: f.Key, Description: f.Description, Stored: stored, Default: def.Default, Enabled: f.Enabled, Percent: f.Percent, Users: []string{}}
+	if !stored {
+		v.Description, v.Enabled = def.Description, def.Default
+		if def.Default {
+			v.Percent = 100
+		}
+	}
+	if ids := featureflags.ParseUsers(f.Users); len(ids) > 0 {
+		db.Model(&models.User{}).Where("id IN ?", ids).Order("username").Pluck("username", &v.Users)
+	}
+	return v
+}
+
+// listFeatureFlagsHandler lists the stored flags and the known ones still on
+// their default.
+func listFeatureFlagsHandler(c *gin.Context) {
+	var rows []models.FeatureFlag
+	if err := db.Order("key").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := []flagView{}
+	seen := map[string]bool{}
+	for _, f := range rows {
+		out = append(out, newFlagView(f, true))
+		seen[f.Key] = true
+	}
+	for key := range featureflags.Known {
+		if !seen[key] {
+			out = append(out, newFlagView(models.FeatureFlag{Key: key}, false))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	c.JSON(http.StatusOK, gin.H{"items": out})
+}
+
+// putFeatureFlagHandler creates or replaces a flag: enabled is the master
+// switch, percent the share of users it is rolled out to and users the
+// usernames that always get it while it is enabled.
+func putFeatureFlagHandler(c *gin.Context) {
+	var req struct {
+		Description string   `json:"description"`
+		Enabled     bool     `json:"enabled"`
+		Percent     int      `json:"percent"`
+		Users       []string `json:"users"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	f := models.FeatureFlag{Key: c.Param("key"), Description: strings.TrimSpace(req.Description), Enabled: req.Enabled, Percent: req.Percent}
+	if len(f.Description) > 255 {
+		writeError(c, apierr.InvalidBody, "description must be at most 255 characters", gin.H{"field": "description"})
+		return
+	}
+	// users are stored by ID so a rename does not drop them
+	ids := make([]uint, 0, len(req.Users))
+	for _, name := range req.Users {
+		var u models.User
+		if err := db.Where("username = ?", strings.TrimSpace(name)).First(&u).Error; err != nil {
+			writeError(c, apierr.InvalidBody, "unknown user", gin.H{"field": "users", "username": name})
+			return
+		}
+		ids = append(ids, u.ID)
+	}
+	f.Users = featureflags.FormatUsers(ids)
+	if len(f.Users) > 2048 {
+		writeError(c, apierr.InvalidBody, "too many users", gin.H{"field": "users"})
+		return
+	}
+	if err := featureflags.Save(db, &f); errors.Is(err, featureflags.ErrInvalid) {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	} else if err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	featureFlags.Invalidate()
+	recordAudit(c, "feature_flag.update", gin.H{"key": f.Key, "enabled": f.Enabled, "percent": f.Percent, "users": req.Users})
+	c.JSON(http.StatusOK, newFlagView(f, true))
+}
+
+// deleteFeatureFlagHandler removes a flag's row, returning a known flag to
+// its default.
+func deleteFeatureFlagHandler(c *gin.Context) {
+	res := db.Where("key = ?", c.Param("key")).Delete(&models.FeatureFlag{})
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	featureFlags.Invalidate()
+	recordAudit(c, "feature_flag.delete", gin.H{"key": c.Param("key")})
+	c.Status(http.StatusNoContent)
+}
+
+// myFeatureFlagsHandler evaluates every stored and known flag for the caller,
+// so the frontend can show or hide features.
+func myFeatureFlagsHandler(c *gin.Context) {
+	var keys []string
+	if err := db.Model(&models.FeatureFlag{}).Pluck("key", &keys).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	for key := range featureflags.Known {
+		keys = append(keys, key)
+	}
+	out := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		out[key] = flagOn(c, key)
+	}
+	c.JSON(http.StatusOK, gin.H{"flags": out})
+}
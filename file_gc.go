@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/filegc"
+	"be03/pkg/storagepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- file garbage collection --------------------
+
+// fileGCStats are reported by /debug/vars.
+var fileGCStats struct {
+	runs, files, bytes atomic.Int64
+}
+
+// gcRule removes files older than maxAge from dir; removed, if set, is told
+// about each file deleted.
+type gcRule struct {
+	dir     string
+	maxAge  time.Duration
+	removed func(path string)
+}
+
+// fileGCRules are STAGING_MAX_AGE (duration, default 1h) for public/.staging
+// and FAILED_RETENTION_DAYS (default 30, 0 keeps them) for public/failed.
+func fileGCRules() []gcRule {
+	staging := time.Hour
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("STAGING_MAX_AGE"))); err == nil && d > 0 {
+		staging = d
+	}
+	rules := []gcRule{{dir: filepath.Join("public", ".staging"), maxAge: staging}}
+	failedDays := 30
+	if n, err := strconv.Atoi(os.Getenv("FAILED_RETENTION_DAYS")); err == nil && n >= 0 {
+		failedDays = n
+	}
+	if failedDays > 0 {
+		rules = append(rules, gcRule{storagepath.File(storagepath.Failed), time.Duration(failedDays) * 24 * time.Hour, forgetFailedFile})
+	}
+	return rules
+}
+
+// forgetFailedFile clears the store path of the failed upload whose receipt
+// the retention removed from public/failed, so the row (kept for review) no
+// longer points at a file that is gone. A failed upload keeps the store path
+// it had while pending (see uploadfiles.MoveToFailed).
+func forgetFailedFile(fullPath string) {
+	name := filepath.Base(fullPath)
+	err := db.Model(&models.Upload{}).Where("failed = ? AND keuangan_id IS NULL", true).
+		Where("store_path IN ?", []string{path.Join(storagepath.Pending, name), storagepath.Of(fullPath)}).
+		Update("store_path", "").Error
+	if err != nil {
+		log.Printf("file gc: clearing the store path of %s: %v", name, err)
+	}
+}
+
+// collectFiles sweeps every fileGCRules directory once.
+func collectFiles(now time.Time, dryRun bool) []filegc.Result {
+	var out []filegc.Result
+	for _, r := range fileGCRules() {
+		res, err := filegc.Sweep(r.dir, r.maxAge, now, dryRun, r.removed)
+		if err != nil {
+			log.Printf("file gc: %s: %v", r.dir, err)
+		}
+		if !dryRun {
+			fileGCStats.files.Add(int64(res.Files))
+			fileGCStats.bytes.Add(res.Bytes)
+			if res.Files > 0 || res.Errors > 0 {
+				log.Printf("file gc: removed %d files (%d bytes) from %s, %d errors", res.Files, res.Bytes, r.dir, res.Errors)
+			}
+		}
+		out = append(out, res)
+	}
+	if !dryRun {
+		fileGCStats.runs.Add(1)
+	}
+	return out
+}
+
+// startFileGC runs collectFiles every hour. It is not a scheduler job: the
+// directories are local, so every server sweeps its own.
+func startFileGC() {
+	for {
+		collectFiles(time.Now(), false)
+		time.Sleep(time.Hour)
+	}
+}
+
+// adminFileGCHandler runs the collector now (?dry_run=true only reports) and
+// returns the reclaimed files and bytes per directory.
+func adminFileGCHandler(c *gin.Context) {
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "dry_run must be true or false", gin.H{"field": "dry_run"})
+			return
+		}
+		dryRun = b
+	}
+	results := collectFiles(time.Now(), dryRun)
+	var files int
+	var bytes int64
+	for _, r := range results {
+		files += r.Files
+		bytes += r.Bytes
+	}
+	if !dryRun {
+		recordAudit(c, "admin.file_gc", gin.H{"files": files, "bytes": bytes})
+	}
+	c.JSON(http.StatusOK, gin.H{"dirs": results, "files": files, "bytes": bytes, "dry_run": dryRun})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/fxrates"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- currency conversion --------------------
+
+// fxConfig is the rates provider and fallback policy; each request copies it
+// onto the current database (see converterFor).
+var fxConfig = fxrates.Service{Fallback: fxrates.FallbackPrevious, FallbackDays: fxrates.DefaultFallbackDays}
+
+// initFX configures exchange rates from FX_RATES_URL / FX_STATIC_RATES,
+// FX_FALLBACK and FX_FALLBACK_DAYS.
+func initFX() {
+	s, err := fxrates.FromEnv(nil)
+	if err != nil {
+		log.Fatalf("fx: %v", err)
+	}
+	fxConfig = *s
+	if s.Provider != nil {
+		log.Printf("fx: %s rates provider, fallback %s", s.Provider.Name(), s.Fallback)
+	}
+}
+
+// converterFor returns a converter to the ?convert_to= currency, nil when the
+// parameter is absent, or writes an error when it is not a currency code.
+func converterFor(c *gin.Context, loc *time.Location) (*fxrates.Converter, bool) {
+	to := strings.ToUpper(strings.TrimSpace(c.Query("convert_to")))
+	if to == "" {
+		return nil, true
+	}
+	if !currencyRE.MatchString(to) {
+		writeError(c, apierr.InvalidBody, "convert_to must be an ISO 4217 currency code", gin.H{"field": "convert_to"})
+		return nil, false
+	}
+	s := fxConfig
+	s.DB = db
+	return s.Converter(c.Request.Context(), to, loc), true
+}
+
+// fxRow is the part of a catatan a conversion needs.
+type fxRow struct {
+	UserID   uint
+	Currency string
+	Amount   int64
+	Date     time.Time
+}
+
+// loadFXRows reads the rows of q; a row without a currency takes its owner's
+// preferred one.
+func loadFXRows(q *gorm.DB) ([]fxRow, error) {
+	var rows []fxRow
+	if err := q.Select("user_id", "currency", "amount", "date").Order("date").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	prefs := map[uint]string{}
+	for i, r := range rows {
+		if r.Currency != "" {
+			continue
+		}
+		cur, ok := prefs[r.UserID]
+		if !ok {
+			cur = loadPreferences(r.UserID).Currency
+			prefs[r.UserID] = cur
+		}
+		rows[i].Currency = cur
+	}
+	return rows, nil
+}
+
+// convertedView is the "converted" block of a summary.
+type convertedView struct {
+	Currency     string            `json:"currency"`
+	Total        float64           `json:"total"`
+	MissingRates []fxrates.Missing `json:"missing_rates"`
+	missing      map[fxrates.Missing]bool
+}
+
+func newConverted(conv *fxrates.Converter) *convertedView {
+	return &convertedView{Currency: conv.Currency(), MissingRates: []fxrates.Missing{}, missing: map[fxrates.Missing]bool{}}
+}
+
+// add converts r into v's total, or records its missing rate.
+func (v *convertedView) add(conv *fxrates.Converter, r fxRow, loc *time.Location) {
+	amt, ok := conv.Convert(r.Amount, r.Currency, r.Date)
+	if ok {
+		v.Total += amt
+		return
+	}
+	k := fxrates.Missing{Currency: r.Currency, Day: r.Date.In(loc).Format("2006-01-02")}
+	if !v.missing[k] {
+		v.missing[k] = true
+		v.MissingRates = append(v.MissingRates, k)
+	}
+}
+
+func (v *convertedView) round() *convertedView {
+	v.Total = fxrates.Round(v.Total)
+	return v
+}
+
+// convertRows totals q's rows in conv's currency, or writes an error when the
+// fallback policy fails the conversion.
+func convertRows(c *gin.Context, conv *fxrates.Converter, q *gorm.DB, loc *time.Location) (*convertedView, bool) {
+	rows, err := loadFXRows(q)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return nil, false
+	}
+	v := newConverted(conv)
+	for _, r := range rows {
+		v.add(conv, r, loc)
+	}
+	if !checkConversion(c, conv) {
+		return nil, false
+	}
+	return v.round(), true
+}
+
+// checkConversion writes RateUnavailable when conv failed.
+func checkConversion(c *gin.Context, conv *fxrates.Converter) bool {
+	if err := conv.Err(); err != nil {
+		writeError(c, apierr.RateUnavailable, err.Error(), gin.H{"currency": conv.Currency(), "missing_rates": conv.Missing()})
+		return false
+	}
+	return true
+}
+
+// catatanCurrency validates an optional currency of a new catatan.
+func catatanCurrency(c *gin.Context, cur string) (string, bool) {
+	cur = strings.ToUpper(strings.TrimSpace(cur))
+	if cur != "" && !currencyRE.MatchString(cur) {
+		writeError(c, apierr.InvalidBody, "currency must be an ISO 4217 code", gin.H{"field": "currency"})
+		return "", false
+	}
+	return cur, true
+}
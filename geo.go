@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/exifmeta"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- receipts map --------------------
+
+// Upload.LocationSource values.
+const (
+	locationClient = "client"
+	locationEXIF   = "exif"
+)
+
+// maxMapPoints caps GET /catatan/map.
+const maxMapPoints = 1000
+
+// uploadLocation reads the optional latitude / longitude form fields of an
+// upload and falls back to the photo's EXIF GPS position unless the user
+// turned that off. It writes an error and reports false on bad coordinates.
+func uploadLocation(c *gin.Context, userID uint, data []byte) (lat, lon *float64, source string, ok bool) {
+	latStr, lonStr := c.PostForm("latitude"), c.PostForm("longitude")
+	if latStr == "" && lonStr == "" {
+		lat, lon, source = exifLocation(userID, data)
+		return lat, lon, source, true
+	}
+	la, err1 := strconv.ParseFloat(latStr, 64)
+	lo, err2 := strconv.ParseFloat(lonStr, 64)
+	if err1 != nil || err2 != nil || !exifmeta.ValidCoordinates(la, lo) {
+		writeError(c, apierr.InvalidBody, "latitude and longitude must be given together as decimal degrees", gin.H{"field": "latitude"})
+		return nil, nil, "", false
+	}
+	return &la, &lo, locationClient, true
+}
+
+// exifLocation is the GPS position in data's EXIF, or nils when there is none
+// or userID opted out of EXIF parsing.
+func exifLocation(userID uint, data []byte) (lat, lon *float64, source string) {
+	if loadPreferences(userID).SkipExifLocation {
+		return nil, nil, ""
+	}
+	la, lo, ok := exifmeta.Location(data)
+	if !ok {
+		return nil, nil, ""
+	}
+	return &la, &lo, locationEXIF
+}
+
+// exifCaptureTime is when the photo in data was taken according to its EXIF,
+// read in userID's timezone, or nil. Uploads keep it in CapturedAt because the
+// stored image is stripped of its EXIF.
+func exifCaptureTime(userID uint, data []byte) *time.Time {
+	t, ok := exifmeta.CaptureTime(data, loadPreferences(userID).Location(), time.Now())
+	if !ok {
+		return nil
+	}
+	return &t
+}
+
+type mapPoint struct {
+	CatatanID uint      `json:"catatan_id"`
+	UploadID  uint      `json:"upload_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Source    string    `json:"source"`
+	Amount    int64     `json:"amount"`
+	Date      time.Time `json:"date"`
+	FileName  string    `json:"file_name"`
+}
+
+// catatanMapHandler returns the caller's geotagged catatan as map points,
+// newest first, optionally limited by from / to (YYYY-MM-DD in the user's
+// timezone). Catatan pending confirmation are left out.
+func catatanMapHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	from, to, ok := dateRange(c, loadPreferences(user.ID).Location())
+	if !ok {
+		return
+	}
+	q := reportDB(c).Model(&models.Upload{}).
+		Select("catatan_keuangans.id AS catatan_id, uploads.id AS upload_id, uploads.latitude, uploads.longitude, uploads.location_source AS source, catatan_keuangans.amount, catatan_keuangans.date, catatan_keuangans.file_name").
+		Joins("JOIN catatan_keuangans ON catatan_keuangans.id = uploads.keuangan_id").
+		Where("catatan_keuangans.user_id = ? AND catatan_keuangans.pending = ? AND uploads.latitude IS NOT NULL AND uploads.longitude IS NOT NULL", user.ID, false)
+	if from != nil {
+		q = q.Where("catatan_keuangans.date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("catatan_keuangans.date < ?", to.UTC())
+	}
+	points := []mapPoint{}
+	if err := q.Order("catatan_keuangans.date desc, catatan_keuangans.id desc").Limit(maxMapPoints).Scan(&points).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"points": points})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/goals"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- goals --------------------
+
+type goalView struct {
+	ID           uint           `json:"id"`
+	Name         string         `json:"name"`
+	TargetAmount int64          `json:"target_amount"`
+	StartsAt     string         `json:"starts_at"`
+	Deadline     *string        `json:"deadline"`
+	AccountID    *uint          `json:"account_id"`
+	Progress     goals.Progress `json:"progress"`
+}
+
+// viewGoal renders g with its progress; dates are YYYY-MM-DD in loc.
+func viewGoal(g models.Goal, loc *time.Location) (goalView, error) {
+	saved, err := goals.Saved(db, g)
+	if err != nil {
+		return goalView{}, err
+	}
+	v := goalView{
+		ID:           g.ID,
+		Name:         g.Name,
+		TargetAmount: g.TargetAmount,
+		StartsAt:     g.StartsAt.In(loc).Format("2006-01-02"),
+		AccountID:    g.AccountID,
+		Progress:     goals.Compute(g, saved, time.Now()),
+	}
+	if g.Deadline != nil {
+		d := g.Deadline.In(loc).Format("2006-01-02")
+		v.Deadline = &d
+	}
+	return v, nil
+}
+
+// goalRequest is shared by create and update; dates are YYYY-MM-DD in the
+// user's timezone and an empty deadline / account_id of 0 clears the field.
+type goalRequest struct {
+	Name         *string `json:"name"`
+	TargetAmount *int64  `json:"target_amount"`
+	StartsAt     *string `json:"starts_at"`
+	Deadline     *string `json:"deadline"`
+	AccountID    *uint   `json:"account_id"`
+}
+
+// apply copies the set fields onto g and validates the result.
+func (r goalRequest) apply(c *gin.Context, g *models.Goal, loc *time.Location) bool {
+	if r.Name != nil {
+		g.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.TargetAmount != nil {
+		g.TargetAmount = *r.TargetAmount
+	}
+	if r.StartsAt != nil {
+		t, err := time.ParseInLocation("2006-01-02", *r.StartsAt, loc)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "starts_at must be YYYY-MM-DD", gin.H{"field": "starts_at"})
+			return false
+		}
+		g.StartsAt = t
+	}
+	if r.Deadline != nil {
+		if *r.Deadline == "" {
+			g.Deadline = nil
+		} else {
+			t, err := time.ParseInLocation("2006-01-02", *r.Deadline, loc)
+			if err != nil {
+				writeError(c, apierr.InvalidBody, "deadline must be YYYY-MM-DD", gin.H{"field": "deadline"})
+				return false
+			}
+			// the deadline day itself still counts
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+			g.Deadline = &t
+		}
+	}
+	if r.AccountID != nil {
+		if *r.AccountID == 0 {
+			g.AccountID = nil
+		} else {
+			if !checkAccountID(c, g.UserID, r.AccountID) {
+				return false
+			}
+			g.AccountID = r.AccountID
+		}
+	}
+	if g.Name == "" || len(g.Name) > 128 {
+		writeError(c, apierr.InvalidBody, "name is required (max 128 characters)", gin.H{"field": "name"})
+		return false
+	}
+	if g.TargetAmount <= 0 {
+		writeError(c, apierr.InvalidBody, "target_amount must be positive", gin.H{"field": "target_amount"})
+		return false
+	}
+	if g.Deadline != nil && g.Deadline.Before(g.StartsAt) {
+		writeError(c, apierr.InvalidBody, "deadline is before starts_at", gin.H{"field": "deadline"})
+		return false
+	}
+	return true
+}
+
+// ownGoal loads goal :id of the caller, writing not_found otherwise.
+func ownGoal(c *gin.Context, userID uint) (models.Goal, bool) {
+	var g models.Goal
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&g).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return g, false
+	}
+	return g, true
+}
+
+// listGoalsHandler lists the caller's goals with their progress, for the dashboard.
+func listGoalsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var list []models.Goal
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	out := make([]goalView, 0, len(list))
+	for _, g := range list {
+		v, err := viewGoal(g, loc)
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		out = append(out, v)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// createGoalHandler creates a goal; starts_at defaults to today.
+func createGoalHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req goalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	now := time.Now().In(loc)
+	g := models.Goal{UserID: user.ID, StartsAt: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)}
+	if !req.apply(c, &g, loc) {
+		return
+	}
+	if err := db.Create(&g).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	v, _ := viewGoal(g, loc)
+	c.JSON(http.StatusCreated, v)
+}
+
+func updateGoalHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	g, ok := ownGoal(c, user.ID)
+	if !ok {
+		return
+	}
+	var req goalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	if !req.apply(c, &g, loc) {
+		return
+	}
+	if err := db.Save(&g).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	v, _ := viewGoal(g, loc)
+	c.JSON(http.StatusOK, v)
+}
+
+func deleteGoalHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.Goal{})
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// goalProgressHandler returns one goal with its percentage complete and the
+// projected completion date.
+func goalProgressHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	g, ok := ownGoal(c, user.ID)
+	if !ok {
+		return
+	}
+	v, err := viewGoal(g, loadPreferences(user.ID).Location())
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -11,46 +12,123 @@ import (
 	"log"
 	"mime/multipart"
 	"net/http"
+	"net/mail"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"be03/models"
+	"be03/pkg/accounts"
+	"be03/pkg/anomaly"
+	"be03/pkg/apierr"
+	"be03/pkg/apitokens"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/catatanstore"
+	"be03/pkg/exifmeta"
+	"be03/pkg/fxrates"
+	"be03/pkg/hooks"
+	"be03/pkg/logredact"
+	"be03/pkg/notify"
 	"be03/pkg/ocr"
+	"be03/pkg/ocrexp"
+	"be03/pkg/ocrtext"
+	"be03/pkg/orgs"
+	"be03/pkg/periodlock"
+	"be03/pkg/querylog"
+	"be03/pkg/roles"
+	"be03/pkg/secheaders"
+	"be03/pkg/storagepath"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/uploadqueue"
+	"be03/pkg/usercache"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 // -------------------- helpers --------------------
 
-var centsRE = regexp.MustCompile(`[.,]\d{2}$`)
+// ocrEngine performs receipt OCR for uploads; tests swap in a scripted fake.
+var ocrEngine ocr.Engine = ocr.TesseractEngine{}
 
-func writeError(c *gin.Context, status int, code, msg string, extra gin.H) {
-	body := gin.H{"error": code}
-	if msg != "" {
-		body["message"] = msg
-	}
-	for k, v := range extra {
-		body[k] = v
+// writeError aborts with the standard error envelope; the HTTP status comes from
+// the apierr catalog so a code always maps to the same status.
+func writeError(c *gin.Context, code apierr.Code, msg string, details gin.H) {
+	status := apierr.Status(code)
+	if status == http.StatusInternalServerError && dbBreaker.Failing() {
+		// most likely failed because the database is unreachable
+		dbUnavailable(c)
+		return
 	}
 	if status >= 500 {
-		log.Printf("HTTP %d error code=%s msg=%s path=%s", status, code, msg, c.FullPath())
+		log.Printf("HTTP %d error code=%s msg=%s path=%s request_id=%s", status, code, msg, c.FullPath(), c.GetString(requestIDKey))
+		c.Set(errorCodeKey, string(code))
+		c.Set(errorMessageKey, msg)
+	}
+	c.AbortWithStatusJSON(status, apierr.New(code, msg, details, c.GetString(requestIDKey)))
+}
+
+// requestIDKey is the context key (and X-Request-ID echo) for request correlation.
+const requestIDKey = "request_id"
+
+// requestIDMiddleware propagates a well-formed inbound X-Request-ID or mints one,
+// exposing it on the context and the response.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			b := make([]byte, 8)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(querylog.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// reqDB is db bound to the request context, so slow queries are logged with
+// the request id.
+func reqDB(c *gin.Context) *gorm.DB {
+	return db.WithContext(c.Request.Context())
+}
+
+// reportDB is reqDB routed to the read replica when DB_DSN_REPLICA is set. Use
+// it only for read-only reporting queries that tolerate replication lag.
+func reportDB(c *gin.Context) *gorm.DB {
+	// Session makes the result reusable, like db itself, by the report packages
+	return reqDB(c).Clauses(dbresolver.Use(reportingResolver)).Session(&gorm.Session{})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r == '-' || r == '_' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+			return false
+		}
 	}
-	c.AbortWithStatusJSON(status, body)
+	return true
+}
+
+// recoverWithEnvelope turns handler panics into an internal_error envelope.
+func recoverWithEnvelope(c *gin.Context, err any) {
+	log.Printf("panic: %v path=%s request_id=%s", err, c.FullPath(), c.GetString(requestIDKey))
+	reportPanic(c, err)
+	writeError(c, apierr.Internal, "", nil)
 }
 
 // upload constraints & file sniffing
 const maxUploadBytes = 1_000_000 // 1MB
-var allowedUploadMimes = map[string]struct{}{"image/jpeg": {}, "image/png": {}}
-var allowedUploadExts = map[string]struct{}{".jpg": {}, ".jpeg": {}, ".png": {}}
 
-// validateAndSniff reads <= maxUploadBytes+1, determines mime by extension + magic bytes, returns mime + full bytes.
+// validateAndSniff reads <= maxUploadBytes+1, determines mime by extension + magic bytes (uploadfiles.APITypes), returns mime + full bytes.
 func validateAndSniff(f multipart.File, hdr *multipart.FileHeader) (string, []byte, error) {
 	if hdr.Size > maxUploadBytes {
 		return "", nil, errors.New("too_large")
@@ -64,42 +142,41 @@ func validateAndSniff(f multipart.File, hdr *multipart.FileHeader) (string, []by
 	if len(b) > maxUploadBytes {
 		return "", nil, errors.New("too_large")
 	}
-	ext := strings.ToLower(filepath.Ext(hdr.Filename))
-	if _, ok := allowedUploadExts[ext]; !ok {
-		return "", nil, errors.New("unsupported_type")
-	}
-	// quick magic sniff (jpeg/png only)
-	mime := ""
-	if len(b) >= 4 && b[0] == 0xFF && b[1] == 0xD8 {
-		mime = "image/jpeg"
-	}
-	if len(b) >= 8 && string(b[:8]) == "\x89PNG\r\n\x1a\n" {
-		mime = "image/png"
-	}
-	if mime == "" { // fallback from extension map
-		if ext == ".jpg" || ext == ".jpeg" {
-			mime = "image/jpeg"
-		} else if ext == ".png" {
-			mime = "image/png"
-		}
-	}
-	if mime == "" {
-		return "", nil, errors.New("unsupported_type")
+	mime, err := uploadfiles.APITypes.Sniff(hdr.Filename, b)
+	if err != nil {
+		return "", nil, err
 	}
 	return mime, b, nil
 }
 
 // -------------------- auth & security helpers --------------------
 
+// userCache holds the users behind recent access tokens; see userCacheTTL.
+var userCache = usercache.New(userCacheTTL())
+
+// userCacheTTL is USER_CACHE_TTL (a duration, default 30s; 0 reads the users
+// table on every request). Other API instances see a role change after at
+// most this long.
+func userCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("USER_CACHE_TTL"))); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
 // jwtAuthMiddleware validates bearer token and sets context values
 func jwtAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		h := c.GetHeader("Authorization")
 		if h == "" || !strings.HasPrefix(strings.ToLower(h), "bearer ") {
-			writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+			writeError(c, apierr.Unauthorized, "", nil)
 			return
 		}
 		tokenStr := strings.TrimSpace(h[7:])
+		if apitokens.Is(tokenStr) {
+			apiTokenAuth(c, tokenStr)
+			return
+		}
 		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method")
@@ -107,33 +184,52 @@ func jwtAuthMiddleware() gin.HandlerFunc {
 			return jwtSecret, nil
 		})
 		if err != nil || !token.Valid {
-			writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+			writeError(c, apierr.Unauthorized, "", nil)
 			return
 		}
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+			writeError(c, apierr.Unauthorized, "", nil)
 			return
 		}
 		uidF, ok := claims["uid"].(float64)
 		if !ok {
-			writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+			writeError(c, apierr.Unauthorized, "", nil)
+			return
+		}
+		// tokens issued before versions existed carry none, i.e. version 0
+		ver, _ := claims["ver"].(float64)
+		user, err := userCache.Get(db, uint(uidF))
+		if authLookupFailed(c, err) {
+			return
+		}
+		if err == nil && user.DisabledAt != nil {
+			writeError(c, apierr.AccountDisabled, "", nil)
 			return
 		}
-		username, _ := claims["sub"].(string)
-		role, _ := claims["role"].(string)
-		var user models.User
-		if err := db.First(&user, uint(uidF)).Error; err != nil {
-			writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		if err != nil || uint(ver) != user.TokenVersion || wrongTenant(c, user) {
+			writeError(c, apierr.Unauthorized, "", nil)
 			return
 		}
 		c.Set("user", user)
-		c.Set("username", username)
-		c.Set("role", role)
+		// sub is the username at issue time; a rename since does not void the token
+		c.Set("username", user.Username)
+		// the role claim is what the user had at issue time; a demotion since
+		// must take effect, so the role comes from the (cached) user instead
+		c.Set("role", roleName(user))
 		c.Next()
 	}
 }
 
+// roleName is the name of the role loaded with user by userCache. Users without
+// one are plain users, as at login.
+func roleName(user models.User) string {
+	if user.RoleID == nil || user.Role.Name == "" {
+		return "user"
+	}
+	return user.Role.Name
+}
+
 func getUserFromContext(c *gin.Context) (models.User, bool) {
 	v, ok := c.Get("user")
 	if !ok {
@@ -152,9 +248,9 @@ func checkPassword(hash []byte, pw string) bool {
 }
 
 // refresh token persistence & helpers
-func storeRefreshToken(u models.User, raw string, ttl time.Duration) (*models.RefreshToken, error) {
+func storeRefreshToken(u models.User, raw string, rt *models.RefreshToken) (*models.RefreshToken, error) {
 	h := sha256.Sum256([]byte(raw))
-	rt := &models.RefreshToken{UserID: u.ID, TokenHash: hex.EncodeToString(h[:]), ExpiresAt: time.Now().Add(ttl)}
+	rt.UserID, rt.TokenHash = u.ID, hex.EncodeToString(h[:])
 	if err := db.Create(rt).Error; err != nil {
 		log.Printf("storeRefreshToken failed for user=%s id=%d: %v", u.Username, u.ID, err)
 		return nil, err
@@ -179,6 +275,7 @@ func generateAccessToken(u models.User, roleName string, ttl time.Duration) (str
 		"sub":  u.Username,
 		"uid":  u.ID,
 		"role": roleName,
+		"ver":  u.TokenVersion,
 		"exp":  time.Now().Add(ttl).Unix(),
 		"iat":  time.Now().Unix(),
 	}
@@ -195,13 +292,17 @@ func registerHandler(c *gin.Context) {
 		Password string `json:"password" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Username) == "" || len(req.Password) < 6 {
-		writeError(c, http.StatusBadRequest, "invalid_body", "", nil)
+		writeError(c, apierr.InvalidBody, "", nil)
 		return
 	}
 	var cnt int64
+	// usernames are unique across tenants
 	db.Model(&models.User{}).Where("username = ?", req.Username).Count(&cnt)
 	if cnt > 0 {
-		writeError(c, http.StatusConflict, "duplicate", "username taken", nil)
+		writeError(c, apierr.Duplicate, "username taken", nil)
+		return
+	}
+	if !checkTenantUserLimit(c) {
 		return
 	}
 	hpw, _ := hashPassword(req.Password)
@@ -209,13 +310,13 @@ func registerHandler(c *gin.Context) {
 	var role models.Role
 	db.Where("name = ?", "user").First(&role)
 	rid := role.ID
-	user := models.User{Username: req.Username, HashedPassword: hpw, RoleID: &rid}
+	user := models.User{Username: req.Username, HashedPassword: hpw, RoleID: &rid, TenantID: currentTenant(c).ID}
 	if err := db.Create(&user).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "create_failed", "", nil)
+		writeError(c, apierr.CreateFailed, "", nil)
 		return
 	}
 	// auto create profile placeholder
-	prof := models.Profile{UserID: user.ID, Name: user.Username}
+	prof := models.Profile{UserID: user.ID, Name: user.Username, TenantID: user.TenantID}
 	_ = db.Create(&prof).Error
 	c.JSON(http.StatusOK, gin.H{"id": user.ID})
 }
@@ -224,6 +325,10 @@ func loginHandler(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		// RememberMe asks for a long-lived refresh token bound to DeviceID,
+		// a stable fingerprint the client must present again on refresh.
+		RememberMe bool   `json:"remember_me"`
+		DeviceID   string `json:"device_id"`
 	}
 	// read raw body to aid debugging of bind issues (we'll restore it for the decoder)
 	raw, _ := c.GetRawData()
@@ -240,17 +345,29 @@ func loginHandler(c *gin.Context) {
 		if req.Username == "" || req.Password == "" {
 			// log headers, content length and raw body to help diagnose malformed/missing JSON from clients
 			log.Printf("login: bind error=%v headers=%v content_length=%d raw=%q", err, c.Request.Header, c.Request.ContentLength, string(raw))
-			writeError(c, http.StatusBadRequest, "invalid_body", "", nil)
+			writeError(c, apierr.InvalidBody, "", nil)
 			return
 		}
 	}
+	if req.RememberMe && strings.TrimSpace(req.DeviceID) == "" {
+		writeError(c, apierr.InvalidBody, "device_id is required with remember_me", gin.H{"field": "device_id"})
+		return
+	}
 	var user models.User
 	if err := db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		writeError(c, http.StatusUnauthorized, "invalid_credentials", "", nil)
+		if authLookupFailed(c, err) {
+			return
+		}
+		writeError(c, apierr.InvalidCredentials, "", nil)
+		return
+	}
+	if !checkPassword(user.HashedPassword, req.Password) || wrongTenant(c, user) {
+		writeError(c, apierr.InvalidCredentials, "", nil)
 		return
 	}
-	if !checkPassword(user.HashedPassword, req.Password) {
-		writeError(c, http.StatusUnauthorized, "invalid_credentials", "", nil)
+	// only after the password so the status does not reveal the account
+	if user.DisabledAt != nil {
+		writeError(c, apierr.AccountDisabled, "", nil)
 		return
 	}
 	roleName := "user"
@@ -263,35 +380,47 @@ func loginHandler(c *gin.Context) {
 	at, err := generateAccessToken(user, roleName, 15*time.Minute)
 	if err != nil {
 		log.Printf("generateAccessToken failed: %v", err)
-		writeError(c, http.StatusInternalServerError, "token_failed", "", nil)
+		writeError(c, apierr.TokenFailed, "", nil)
 		return
 	}
 	rawRT := randomHex(32)
-	if _, err := storeRefreshToken(user, rawRT, 7*24*time.Hour); err != nil {
+	rt, err := storeRefreshToken(user, rawRT, newSession(c, req.RememberMe, req.DeviceID))
+	if err != nil {
 		// Non-fatal: return access token so FE can proceed. Include empty refresh token to keep response shape stable.
 		log.Printf("login: refresh token store failed (non-fatal): %v", err)
 		c.JSON(http.StatusOK, gin.H{"access_token": at, "refresh_token": "", "token_type": "bearer", "expires_in": 900})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"access_token": at, "refresh_token": rawRT, "token_type": "bearer", "expires_in": 900})
+	c.JSON(http.StatusOK, gin.H{"access_token": at, "refresh_token": rawRT, "token_type": "bearer", "expires_in": 900, "remember_me": rt.RememberMe, "refresh_expires_at": rt.ExpiresAt})
 }
 
 func refreshHandler(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refresh_token" binding:"required"`
+		DeviceID     string `json:"device_id"` // required for remember-me tokens
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeError(c, http.StatusBadRequest, "invalid_body", "", nil)
+		writeError(c, apierr.InvalidBody, "", nil)
 		return
 	}
 	rt, err := findRefreshTokenByRaw(req.RefreshToken)
-	if err != nil {
-		writeError(c, http.StatusUnauthorized, "invalid_refresh", "", nil)
+	if authLookupFailed(c, err) {
+		return
+	}
+	if err != nil || !touchSession(rt, req.DeviceID) {
+		writeError(c, apierr.InvalidRefresh, "", nil)
 		return
 	}
 	var user models.User
-	if err := db.First(&user, rt.UserID).Error; err != nil {
-		writeError(c, http.StatusUnauthorized, "invalid_refresh", "", nil)
+	if err := db.First(&user, rt.UserID).Error; err != nil || wrongTenant(c, user) {
+		if authLookupFailed(c, err) {
+			return
+		}
+		writeError(c, apierr.InvalidRefresh, "", nil)
+		return
+	}
+	if user.DisabledAt != nil {
+		writeError(c, apierr.AccountDisabled, "", nil)
 		return
 	}
 	roleName := "user"
@@ -303,7 +432,7 @@ func refreshHandler(c *gin.Context) {
 	}
 	at, err := generateAccessToken(user, roleName, 15*time.Minute)
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, "token_failed", "", nil)
+		writeError(c, apierr.TokenFailed, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"access_token": at, "token_type": "bearer", "expires_in": 900})
@@ -314,17 +443,17 @@ func revokeRefreshHandler(c *gin.Context) {
 		RefreshToken string `json:"refresh_token" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeError(c, http.StatusBadRequest, "invalid_body", err.Error(), nil)
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
 		return
 	}
 	rt, err := findRefreshTokenByRaw(req.RefreshToken)
 	if err != nil {
-		writeError(c, http.StatusNotFound, "not_found", "refresh token not found", nil)
+		writeError(c, apierr.NotFound, "refresh token not found", nil)
 		return
 	}
 	rt.Revoked = true
 	if err := db.Save(rt).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "revoke_failed", "", nil)
+		writeError(c, apierr.RevokeFailed, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "refresh token revoked"})
@@ -333,7 +462,7 @@ func revokeRefreshHandler(c *gin.Context) {
 func meHandler(c *gin.Context) {
 	usernameVal, _ := c.Get("username")
 	if usernameVal == nil {
-		writeError(c, http.StatusInternalServerError, "context_missing", "", nil)
+		writeError(c, apierr.ContextMissing, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"username": usernameVal.(string)})
@@ -341,65 +470,256 @@ func meHandler(c *gin.Context) {
 
 // -------------------- profile --------------------
 
+// profileRequest is the body of POST and PUT /profile. Fields left out keep
+// their value on update; an empty email, phone, address or occupation clears
+// it.
+type profileRequest struct {
+	Name       *string `json:"name"`
+	Address    *string `json:"address"`
+	Email      *string `json:"email"`
+	Phone      *string `json:"phone"`
+	Occupation *string `json:"occupation"`
+}
+
+// apply validates the fields present in req and copies them, normalised, onto
+// p. It writes the error response and returns false on invalid input.
+func (req profileRequest) apply(c *gin.Context, p *models.Profile) bool {
+	text := func(field string, v *string, max int, dst *string) bool {
+		if v == nil {
+			return true
+		}
+		s := strings.TrimSpace(*v)
+		if len(s) > max {
+			writeError(c, apierr.InvalidBody, fmt.Sprintf("%s must be at most %d characters", field, max), gin.H{"field": field})
+			return false
+		}
+		*dst = s
+		return true
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		writeError(c, apierr.InvalidBody, "name must not be empty", gin.H{"field": "name"})
+		return false
+	}
+	if !text("name", req.Name, 255, &p.Name) || !text("address", req.Address, 512, &p.Address) ||
+		!text("occupation", req.Occupation, 255, &p.Occupation) {
+		return false
+	}
+	if req.Email != nil {
+		email, ok := normalizeEmail(*req.Email)
+		if !ok {
+			writeError(c, apierr.InvalidBody, "email is not a valid address", gin.H{"field": "email"})
+			return false
+		}
+		p.Email = email
+	}
+	if req.Phone != nil {
+		phone, ok := normalizePhone(*req.Phone)
+		if !ok {
+			writeError(c, apierr.InvalidBody, "phone is not a valid number", gin.H{"field": "phone"})
+			return false
+		}
+		p.Phone = phone
+	}
+	return true
+}
+
+// normalizeEmail lower-cases a bare address ("" stays ""); addresses with a
+// display name or that do not parse are rejected.
+func normalizeEmail(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", true
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || len(s) > 255 {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
+// normalizePhone turns a phone number into E.164 ("+628123456789"): spaces,
+// dashes, dots and brackets are dropped, a leading 00 is an international
+// prefix, and local Indonesian numbers (0812..., 62812...) get +62. "" stays "".
+func normalizePhone(s string) (string, bool) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "", true
+	}
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	case strings.HasPrefix(s, "00"):
+		s = s[2:]
+	case strings.HasPrefix(s, "0"):
+		s = "62" + s[1:]
+	}
+	if len(s) < 8 || len(s) > 15 || s[0] == '0' {
+		return "", false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return "+" + s, true
+}
+
+// createProfileHandler creates the caller's profile; a user has at most one,
+// so a second attempt is a 409.
 func createProfileHandler(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
-	var req struct {
-		Name                              string `json:"name" binding:"required"`
-		Address, Email, Phone, Occupation string
-	}
+	var req profileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeError(c, http.StatusBadRequest, "invalid_body", err.Error(), nil)
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if req.Name == nil {
+		writeError(c, apierr.InvalidBody, "name is required", gin.H{"field": "name"})
+		return
+	}
+	profile := models.Profile{UserID: user.ID}
+	if !req.apply(c, &profile) {
+		return
+	}
+	if profileExists(user.ID) {
+		writeError(c, apierr.Duplicate, "profile already exists", nil)
+		return
+	}
+	if !checkProfileLimit(c, user) {
 		return
 	}
-	profile := models.Profile{UserID: user.ID, Name: req.Name, Address: req.Address, Email: req.Email, Phone: req.Phone, Occupation: req.Occupation}
 	if err := db.Create(&profile).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "create_failed", "", nil)
+		// a concurrent create won the unique index on user_id
+		if profileExists(user.ID) {
+			writeError(c, apierr.Duplicate, "profile already exists", nil)
+			return
+		}
+		writeError(c, apierr.CreateFailed, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"id": profile.ID})
 }
 
+func profileExists(userID uint) bool {
+	var n int64
+	db.Model(&models.Profile{}).Where("user_id = ?", userID).Count(&n)
+	return n > 0
+}
+
 func getProfileHandler(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var p models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&p).Error; err != nil {
+		writeError(c, apierr.NotFound, "profile not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, newProfileView(p))
+}
+
+// updateProfileHandler changes the fields present in the body of the caller's
+// profile and returns it.
+func updateProfileHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
 		return
 	}
 	var p models.Profile
 	if err := db.Where("user_id = ?", user.ID).First(&p).Error; err != nil {
-		writeError(c, http.StatusNotFound, "not_found", "profile not found", nil)
+		writeError(c, apierr.NotFound, "profile not found", nil)
+		return
+	}
+	if !req.apply(c, &p) {
 		return
 	}
-	c.JSON(http.StatusOK, p)
+	if err := db.Model(&p).Select("name", "address", "email", "phone", "occupation").Updates(&p).Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, newProfileView(p))
 }
 
 // -------------------- catatan --------------------
 
+// checkLabel trims the free-text field *v (a category or merchant) and
+// checks it fits in max bytes.
+func checkLabel(c *gin.Context, field string, v *string, max int) bool {
+	*v = strings.TrimSpace(*v)
+	if len(*v) > max {
+		writeError(c, apierr.InvalidBody, fmt.Sprintf("%s must be at most %d characters", field, max), gin.H{"field": field})
+		return false
+	}
+	return true
+}
+
+// createCatatanHandler records a manual catatan. With pending set the amount
+// may be left out (or 0): the catatan is a placeholder that counts towards no
+// total until it is confirmed with an amount, possibly read from a receipt
+// attached later (POST /catatan/:id/attach-upload).
 func createCatatanHandler(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	var req struct {
-		FileName string `json:"file_name" binding:"required"`
-		Amount   int64  `json:"amount" binding:"required"`
-		Date     string `json:"date"`
+		FileName  string `json:"file_name" binding:"required"`
+		Amount    int64  `json:"amount"`
+		Pending   bool   `json:"pending"`
+		Date      string `json:"date"`
+		AccountID *uint  `json:"account_id"`
+		Currency  string `json:"currency"` // default: the user's preferred currency
+		// Tax and ServiceCharge are the parts of Amount itemised on the receipt
+		Tax           *int64 `json:"tax"`
+		ServiceCharge *int64 `json:"service_charge"`
+		Category      string `json:"category"`
+		Merchant      string `json:"merchant"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		writeError(c, http.StatusBadRequest, "invalid_body", err.Error(), nil)
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
 		return
 	}
-	var existing models.CatatanKeuangan
-	if err := db.Where("user_id = ? AND file_name = ?", user.ID, req.FileName).First(&existing).Error; err == nil {
-		writeError(c, http.StatusConflict, "duplicate", "file already recorded", nil)
+	currency, ok := catatanCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if !checkLabel(c, "category", &req.Category, 64) || !checkLabel(c, "merchant", &req.Merchant, 128) {
 		return
 	}
-	ct := models.CatatanKeuangan{UserID: user.ID, FileName: req.FileName, Amount: req.Amount}
+	if req.Amount == 0 && !req.Pending {
+		writeError(c, apierr.InvalidBody, "amount is required unless pending is true", gin.H{"field": "amount"})
+		return
+	}
+	if !checkAccountID(c, user.ID, req.AccountID) || !checkTax(c, req.Amount, req.Tax, req.ServiceCharge) {
+		return
+	}
+	ct := models.CatatanKeuangan{UserID: user.ID, FileName: req.FileName, Amount: req.Amount, AccountID: req.AccountID, Pending: req.Pending, Currency: currency,
+		Category: req.Category, Merchant: req.Merchant}
+	if req.Tax != nil {
+		ct.Tax = *req.Tax
+	}
+	if req.ServiceCharge != nil {
+		ct.ServiceCharge = *req.ServiceCharge
+	}
 	if req.Date != "" {
 		if t, err := time.Parse(time.RFC3339, req.Date); err == nil {
 			ct.Date = t
@@ -409,37 +729,218 @@ func createCatatanHandler(c *gin.Context) {
 	} else {
 		ct.Date = time.Now()
 	}
-	if err := db.Create(&ct).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "create_failed", "", nil)
+	if !checkPeriodOpen(c, ct) {
+		return
+	}
+	created, err := catatanstore.Create(db, &ct)
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	if !created {
+		writeError(c, apierr.Duplicate, "file already recorded", gin.H{"id": ct.ID})
 		return
 	}
+	hooks.EmitCatatanCreated(c.Request.Context(), hooks.CatatanCreated{Catatan: ct, Source: hooks.SourceAPI})
 	c.JSON(http.StatusOK, gin.H{"id": ct.ID})
 }
 
+// listCatatanHandler lists the newest 200 catatan, optionally limited by from / to
+// (YYYY-MM-DD in the user's timezone, inclusive), a saved ?view= or the
+// transaction ?reference= printed on the receipt (any spacing or case).
+// Archived catatan are listed only when from asks for them.
 func listCatatanHandler(c *gin.Context) {
 	role, _ := c.Get("role")
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	from, to, scope, ok := catatanRange(c, user.ID, loadPreferences(user.ID).Location())
+	if !ok {
+		return
+	}
+	var items []models.CatatanKeuangan
+	// the default page reads the live table only; a from reaching past the
+	// archive horizon also lists archived catatan
+	q := reqDB(c).Model(&models.CatatanKeuangan{})
+	if from != nil {
+		q = catatanarchive.Catatan(reqDB(c), from)
+	}
+	if role != "administrator" {
+		q = q.Where("user_id = ?", user.ID)
+	}
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	if v := c.Query("reference"); v != "" {
+		q = q.Where("reference = ?", ocr.NormalizeReference(v))
+	}
+	q = q.Scopes(scope)
+	if notModified(c, q) {
+		return
+	}
+	if err := q.Order("id desc").Limit(200).Find(&items).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// dateRange parses the optional from / to query parameters (YYYY-MM-DD in loc,
+// both inclusive) into half-open [from, to) bounds.
+func dateRange(c *gin.Context, loc *time.Location) (from, to *time.Time, ok bool) {
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, p.name+" must be YYYY-MM-DD", gin.H{"field": p.name})
+			return nil, nil, false
+		}
+		if p.name == "to" {
+			t = t.AddDate(0, 0, 1)
+		}
+		*p.dst = &t
+	}
+	return from, to, true
+}
+
+// listSuspectCatatanHandler lists catatan flagged by anomaly detection that still
+// await confirmation (administrators see every user's).
+func listSuspectCatatanHandler(c *gin.Context) { listUnconfirmedCatatan(c, "suspect") }
+
+// listPendingCatatanHandler lists catatan uploaded with confirm_required that
+// still await confirmation (administrators see every user's).
+func listPendingCatatanHandler(c *gin.Context) { listUnconfirmedCatatan(c, "pending") }
+
+// listUnconfirmedCatatan lists catatan whose flag column is set.
+func listUnconfirmedCatatan(c *gin.Context, flag string) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	var items []models.CatatanKeuangan
-	q := db.Model(&models.CatatanKeuangan{})
+	q := reqDB(c).Model(&models.CatatanKeuangan{}).Where(flag+" = ?", true)
 	if role != "administrator" {
 		q = q.Where("user_id = ?", user.ID)
 	}
+	if notModified(c, q) {
+		return
+	}
 	if err := q.Order("id desc").Limit(200).Find(&items).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "query_failed", "", nil)
+		writeError(c, apierr.QueryFailed, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, items)
 }
 
+// confirmCatatanHandler clears the suspect and pending flags, optionally
+// correcting the amount, the account, the tax and the service charge and
+// setting the category and merchant. A placeholder without an amount needs
+// one to be confirmed.
+func confirmCatatanHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Amount        *int64  `json:"amount"`
+		AccountID     *uint   `json:"account_id"`
+		Tax           *int64  `json:"tax"`
+		ServiceCharge *int64  `json:"service_charge"`
+		Category      *string `json:"category"`
+		Merchant      *string `json:"merchant"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), nil)
+			return
+		}
+	}
+	if req.Amount != nil && *req.Amount <= 0 {
+		writeError(c, apierr.InvalidBody, "amount must be positive", gin.H{"field": "amount"})
+		return
+	}
+	if req.Category != nil && !checkLabel(c, "category", req.Category, 64) || req.Merchant != nil && !checkLabel(c, "merchant", req.Merchant, 128) {
+		return
+	}
+	var ct models.CatatanKeuangan
+	if err := reqDB(c).First(&ct, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if role != "administrator" && ct.UserID != user.ID {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if !checkPeriodOpen(c, ct) || !checkAccountID(c, ct.UserID, req.AccountID) {
+		return
+	}
+	if ct.Amount == 0 && req.Amount == nil {
+		writeError(c, apierr.InvalidBody, "amount is required to confirm a catatan without one", gin.H{"field": "amount"})
+		return
+	}
+	if req.Amount != nil && *req.Amount != ct.Amount && (ct.Split || ct.ParentID != nil) {
+		writeError(c, apierr.InvalidBody, "the amount of a split receipt or its line items cannot change", gin.H{"field": "amount"})
+		return
+	}
+	firstReview, ocrAmount := ct.ConfirmedAt == nil, ct.Amount
+	amount, tax, service := ct.Amount, ct.Tax, ct.ServiceCharge
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if req.Tax != nil {
+		tax = *req.Tax
+	}
+	if req.ServiceCharge != nil {
+		service = *req.ServiceCharge
+	}
+	if !checkTax(c, amount, &tax, &service) {
+		return
+	}
+	now := time.Now()
+	ct.Suspect = false
+	ct.SuspectReason = ""
+	ct.Pending = false
+	ct.ConfirmedAt = &now
+	ct.Amount, ct.Tax, ct.ServiceCharge = amount, tax, service
+	if req.AccountID != nil {
+		ct.AccountID = req.AccountID
+	}
+	if req.Category != nil {
+		ct.Category = *req.Category
+	}
+	if req.Merchant != nil {
+		ct.Merchant = *req.Merchant
+	}
+	if err := db.Save(&ct).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	if firstReview {
+		recordOCRReview(c, ct, ocrAmount)
+	}
+	c.JSON(http.StatusOK, ct)
+}
+
 func revenueSummaryHandler(c *gin.Context) {
 	role, _ := c.Get("role")
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	type Result struct {
@@ -447,13 +948,24 @@ func revenueSummaryHandler(c *gin.Context) {
 		Total int64
 	}
 	var results []Result
-	q := db.Model(&models.CatatanKeuangan{})
+	q := catatanarchive.Catatan(reportDB(c), nil).Where("pending = ? AND split = ?", false, false)
 	if role != "administrator" {
 		q = q.Where("user_id = ?", user.ID)
 	}
-	rows, err := q.Select("to_char(date, 'YYYY-MM') as month, sum(amount) as total").Group("month").Rows()
+	// bucket by month in the caller's timezone so late-evening receipts land in the right month
+	loc := loadPreferences(user.ID).Location()
+	conv, ok := converterFor(c, loc)
+	if !ok {
+		return
+	}
+	if conv != nil {
+		convertedRevenue(c, conv, q, loc)
+		return
+	}
+	tz := loc.String()
+	rows, err := q.Select("to_char(date AT TIME ZONE ?, 'YYYY-MM') as month, sum(amount) as total", tz).Group("month").Rows()
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, "query_failed", "", nil)
+		writeError(c, apierr.QueryFailed, "", nil)
 		return
 	}
 	defer rows.Close()
@@ -465,21 +977,68 @@ func revenueSummaryHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, results)
 }
 
-// getCatatanTotalHandler returns a single total (sum of amount) for the authenticated user.
+// convertedRevenue is revenueSummaryHandler with ?convert_to=: months are
+// bucketed here and each carries its converted block.
+func convertedRevenue(c *gin.Context, conv *fxrates.Converter, q *gorm.DB, loc *time.Location) {
+	rows, err := loadFXRows(q)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	type Result struct {
+		Month     string
+		Total     int64
+		Converted *convertedView
+	}
+	results := []Result{}
+	for _, r := range rows {
+		key := r.Date.In(loc).Format("2006-01")
+		if len(results) == 0 || results[len(results)-1].Month != key {
+			results = append(results, Result{Month: key, Converted: newConverted(conv)})
+		}
+		results[len(results)-1].Total += r.Amount
+		results[len(results)-1].Converted.add(conv, r, loc)
+	}
+	if !checkConversion(c, conv) {
+		return
+	}
+	for _, r := range results {
+		r.Converted.round()
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// getCatatanTotalHandler returns a single total (sum of amount) for the authenticated
+// user; catatan pending confirmation are left out. With ?convert_to= it adds
+// the total converted at each catatan's date rate.
 func getCatatanTotalHandler(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	// Sum with a single query
 	type Row struct{ Total int64 }
 	var row Row
-	if err := db.Raw("SELECT COALESCE(SUM(amount),0) AS total FROM catatan_keuangans WHERE user_id = ?", user.ID).Scan(&row).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "query_failed", "", nil)
+	if err := catatanarchive.Catatan(reportDB(c), nil).Select("COALESCE(SUM(amount),0) AS total").Where("user_id = ? AND pending = ? AND split = ?", user.ID, false, false).Scan(&row).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	conv, ok := converterFor(c, loc)
+	if !ok {
+		return
+	}
+	if conv == nil {
+		c.JSON(http.StatusOK, gin.H{"total": row.Total})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"total": row.Total})
+	q := catatanarchive.Catatan(reportDB(c), nil).Where("user_id = ? AND pending = ? AND split = ?", user.ID, false, false)
+	v, ok := convertRows(c, conv, q, loc)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": row.Total, "converted": v})
 }
 
 // -------------------- uploads (atomic DB-first) --------------------
@@ -487,12 +1046,15 @@ func getCatatanTotalHandler(c *gin.Context) {
 func uploadFileHandler(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	var profile models.Profile
 	if err := db.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
-		writeError(c, http.StatusBadRequest, "profile_missing", "profile missing", nil)
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	if !checkUploadQuota(c, user, profile) {
 		return
 	}
 	// Force uploads into the folder watched by the watcher: public/keu
@@ -500,34 +1062,56 @@ func uploadFileHandler(c *gin.Context) {
 	if folder != "keu" { // normalize any value to the single supported folder
 		folder = "keu"
 	}
+	// confirm_required=true keeps the OCR catatan pending until POST /catatan/:id/confirm
+	confirmRequired := false
+	if v := c.PostForm("confirm_required"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "confirm_required must be true or false", gin.H{"field": "confirm_required"})
+			return
+		}
+		confirmRequired = b
+	}
 	file, err := c.FormFile("file")
 	if err != nil {
-		writeError(c, http.StatusBadRequest, "missing_file", "file missing", nil)
+		writeError(c, apierr.MissingFile, "file missing", nil)
 		return
 	}
 	// sanitize filename to prevent directory traversal or weird paths
 	cleanName := filepath.Base(file.Filename)
 	src, err := file.Open()
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, "open_failed", "", nil)
+		writeError(c, apierr.OpenFailed, "", nil)
 		return
 	}
 	mime, firstBytes, verr := func() (string, []byte, error) { defer src.Close(); return validateAndSniff(src, file) }()
 	if verr != nil {
 		switch verr.Error() {
 		case "too_large":
-			writeError(c, http.StatusBadRequest, "file_too_large", "file too large (max 1MB)", nil)
+			writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
 		case "unsupported_type":
-			writeError(c, http.StatusBadRequest, "unsupported_type", "File tidak dikenali, gunakan file lain!", gin.H{"allowed": []string{"image/jpeg", "image/png"}})
+			writeError(c, apierr.UnsupportedType, "File tidak dikenali, gunakan file lain!", gin.H{"allowed": uploadfiles.APITypes.List()})
 		default:
-			writeError(c, http.StatusBadRequest, "invalid_file", "", nil)
+			writeError(c, apierr.InvalidFile, "", nil)
 		}
 		return
 	}
-	baseDir := "public"
-	relPath := folder + "/" + cleanName
-	fullPath := filepath.Join(baseDir, relPath)
-	storePath := filepath.ToSlash(filepath.Join("public", relPath))
+	if !checkOrgQuota(c, user, file.Size) {
+		return
+	}
+	lat, lon, locSource, ok := uploadLocation(c, user.ID, firstBytes)
+	if !ok {
+		return
+	}
+	// keep what the EXIF is used for, then store the image without it so
+	// downloads and shared links do not leak the location or device
+	captured := exifCaptureTime(user.ID, firstBytes)
+	firstBytes, _ = exifmeta.Strip(firstBytes)
+	baseDir := storagepath.Root
+	// namespaced on disk so users sending the same file name do not collide
+	storePath := storagepath.StorePath(profile.ID, cleanName)
+	relPath := strings.TrimPrefix(storePath, storagepath.Root+"/")
+	fullPath := storagepath.File(storePath)
 	// optional manual linkage (declared early as it may be used in creation branch)
 	var keuID *uint
 	var catatanID *uint
@@ -539,6 +1123,8 @@ func uploadFileHandler(c *gin.Context) {
 		reprocess = true
 		up.StorePath = storePath
 		up.ContentType = mime
+		up.SizeBytes = int64(len(firstBytes))
+		up.Latitude, up.Longitude, up.LocationSource, up.CapturedAt = lat, lon, locSource, captured
 		// reset failure state; will update after OCR
 		up.Failed = false
 		up.FailedReason = ""
@@ -547,9 +1133,10 @@ func uploadFileHandler(c *gin.Context) {
 		}
 		_ = db.Save(&up).Error
 	} else {
-		up = models.Upload{ProfileID: profile.ID, FileName: cleanName, StorePath: storePath, KeuanganID: keuID, ContentType: mime}
+		up = models.Upload{ProfileID: profile.ID, FileName: cleanName, StorePath: storePath, KeuanganID: keuID, ContentType: mime, SizeBytes: int64(len(firstBytes)),
+			Latitude: lat, Longitude: lon, LocationSource: locSource, CapturedAt: captured}
 		if err := db.Create(&up).Error; err != nil {
-			writeError(c, http.StatusInternalServerError, "db_save_failed", "", nil)
+			writeError(c, apierr.DBSaveFailed, "", nil)
 			return
 		}
 	}
@@ -562,18 +1149,15 @@ func uploadFileHandler(c *gin.Context) {
 	}
 	if amtStr := c.PostForm("amount"); amtStr != "" {
 		if amtVal, err := strconv.ParseInt(amtStr, 10, 64); err == nil && amtVal > 0 {
-			var existing models.CatatanKeuangan
-			if err := db.Where("user_id = ? AND file_name = ?", user.ID, cleanName).First(&existing).Error; err == nil {
-				keuID = &existing.ID
-				cid := existing.ID
-				catatanID = &cid
-			} else {
-				ck := models.CatatanKeuangan{UserID: user.ID, FileName: cleanName, Amount: amtVal, Date: time.Now()}
-				if err := db.Create(&ck).Error; err == nil {
-					cid := ck.ID
-					catatanID = &cid
-					keuID = &cid
+			// an existing catatan for this file (or the same image) is linked instead
+			ck := models.CatatanKeuangan{UserID: user.ID, FileName: cleanName, Amount: amtVal, Date: time.Now(), ContentHash: catatanstore.Hash(firstBytes)}
+			if created, err := catatanstore.Create(db, &ck); err == nil {
+				if created {
+					hooks.EmitCatatanCreated(c.Request.Context(), hooks.CatatanCreated{Catatan: ck, Source: hooks.SourceAPI})
 				}
+				cid := ck.ID
+				catatanID = &cid
+				keuID = &cid
 			}
 		}
 	}
@@ -582,14 +1166,14 @@ func uploadFileHandler(c *gin.Context) {
 		if !reprocess {
 			db.Delete(&up)
 		}
-		writeError(c, http.StatusInternalServerError, "mkdir_failed", "", nil)
+		writeError(c, apierr.MkdirFailed, "", nil)
 		return
 	}
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
 		if !reprocess {
 			db.Delete(&up)
 		}
-		writeError(c, http.StatusInternalServerError, "mkdir_failed", "", nil)
+		writeError(c, apierr.MkdirFailed, "", nil)
 		return
 	}
 	tmpName := filepath.Join(stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename))
@@ -597,7 +1181,7 @@ func uploadFileHandler(c *gin.Context) {
 		if !reprocess {
 			db.Delete(&up)
 		}
-		writeError(c, http.StatusInternalServerError, "save_failed", "", nil)
+		writeError(c, apierr.SaveFailed, "", nil)
 		return
 	}
 	if err := os.Rename(tmpName, fullPath); err != nil {
@@ -605,116 +1189,631 @@ func uploadFileHandler(c *gin.Context) {
 			db.Delete(&up)
 		}
 		_ = os.Remove(tmpName)
-		writeError(c, http.StatusInternalServerError, "save_failed", "", nil)
+		writeError(c, apierr.SaveFailed, "", nil)
 		return
 	}
-	log.Printf("OCR: starting on %s for user=%d file=%s", fullPath, profile.UserID, cleanName)
-	amt, _, raw, err := ocr.ExtractAmountFromImage(fullPath)
-	if err != nil {
-		log.Printf("OCR: error on %s: %v", fullPath, err)
-		writeError(c, http.StatusInternalServerError, "ocr_error", "", nil)
+	orgs.WarnNearLimit(db, user.ID, time.Now())
+	hooks.EmitUploadStored(c.Request.Context(), hooks.UploadStored{Upload: up, UserID: profile.UserID, Source: hooks.SourceAPI})
+	similar := indexImage(user.ID, &up, firstBytes)
+	role, _ := c.Get("role")
+	res, suspect, err := recognizeUpload(&up, profile, fullPath, role != "administrator", confirmRequired)
+	if errors.Is(err, ocr.ErrNoAmount) {
+		writeError(c, apierr.AmountNotFound, up.FailedReason, gin.H{"ocr": res, "quality": res.Quality})
 		return
 	}
-	log.Printf("OCR: result amount=%d raw=%q for %s", amt, raw, fullPath)
-	if amt <= 0 {
-		up.Failed = true
-		up.FailedReason = "Nominal tidak ditemukan, gunakan file lain"
-		db.Save(&up)
-		_ = os.Remove(fullPath)
-		writeError(c, http.StatusBadRequest, "amount_not_found", "Nominal tidak ditemukan, gunakan file lain", nil)
+	if err != nil {
+		writeError(c, apierr.OCRError, "", nil)
 		return
 	}
-	if amt > 0 {
-		var existingCat models.CatatanKeuangan
-		if err := db.Where("user_id = ? AND file_name = ?", profile.UserID, up.FileName).First(&existingCat).Error; err == nil {
-			up.KeuanganID = &existingCat.ID
-			db.Save(&up)
-		} else {
-			// Never create catatan for admin (user_id=1)
-			if profile.UserID != 1 {
-				ct := models.CatatanKeuangan{UserID: profile.UserID, FileName: up.FileName, Amount: amt, Date: time.Now()}
-				if err := db.Create(&ct).Error; err == nil {
-					up.KeuanganID = &ct.ID
-					db.Save(&up)
-					log.Printf("OCR: created catatan id=%d amount=%d for user=%d file=%s", ct.ID, amt, profile.UserID, up.FileName)
-				} else {
-					log.Printf("OCR: failed to create catatan for user=%d file=%s: %v", profile.UserID, up.FileName, err)
-				}
-			}
+	// hand anything still unlinked (e.g. administrator uploads) to the watcher right away
+	if up.KeuanganID == nil {
+		if err := uploadqueue.Publish(db, uploadqueue.Event{UploadID: up.ID, FileName: up.FileName, StorePath: up.StorePath}); err != nil {
+			log.Printf("upload notify failed for upload=%d: %v", up.ID, err)
 		}
 	}
 	respCatID := up.KeuanganID
 	if catatanID != nil {
 		respCatID = catatanID
 	}
-	c.JSON(http.StatusOK, gin.H{"id": up.ID, "path": relPath, "store_path": storePath, "catatan_id": respCatID})
+	pending := false
+	if respCatID != nil {
+		db.Model(&models.CatatanKeuangan{}).Select("pending").Where("id = ?", *respCatID).Scan(&pending)
+	}
+	out := gin.H{"id": up.ID, "path": relPath, "store_path": storePath, "catatan_id": respCatID, "ocr": res, "suspect": suspect, "pending": pending}
+	if len(similar) > 0 {
+		// e.g. the same receipt screenshotted again; the client asks before keeping both
+		out["similar"] = similar
+		out["warning"] = "a visually similar receipt was uploaded before"
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// precheckHeadBytes bounds the file head a precheck may send; magic bytes need far less.
+const precheckHeadBytes = 512
+
+// precheckUploadHandler tells a client whether an upload would be accepted
+// before it spends bandwidth on the full image. The body describes the file:
+// file_name, size, sha256 (hex, optional) and head (base64 of its first bytes).
+// It answers with accepted plus the problems found: file_too_large,
+// unsupported_type or duplicate (with the catatan already recorded).
+func precheckUploadHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		FileName string `json:"file_name" binding:"required"`
+		Size     int64  `json:"size"`
+		SHA256   string `json:"sha256"`
+		Head     []byte `json:"head"` // base64 in JSON
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if len(req.Head) > precheckHeadBytes {
+		writeError(c, apierr.InvalidBody, fmt.Sprintf("head is limited to %d bytes", precheckHeadBytes), gin.H{"field": "head"})
+		return
+	}
+	req.SHA256 = strings.ToLower(strings.TrimSpace(req.SHA256))
+	if _, err := hex.DecodeString(req.SHA256); err != nil || (req.SHA256 != "" && len(req.SHA256) != 64) {
+		writeError(c, apierr.InvalidBody, "sha256 must be 64 hex characters", gin.H{"field": "sha256"})
+		return
+	}
+	type problem struct {
+		Code    apierr.Code `json:"code"`
+		Message string      `json:"message"`
+	}
+	problems := []problem{}
+	if req.Size > maxUploadBytes {
+		problems = append(problems, problem{apierr.FileTooLarge, "file too large (max 1MB)"})
+	}
+	name := filepath.Base(req.FileName)
+	mime, err := uploadfiles.APITypes.Sniff(name, req.Head)
+	if err != nil {
+		problems = append(problems, problem{apierr.UnsupportedType, "File tidak dikenali, gunakan file lain!"})
+	}
+	var duplicateOf *uint
+	q := db.Where("user_id = ? AND file_name = ?", user.ID, name)
+	if req.SHA256 != "" {
+		q = db.Where("user_id = ? AND (file_name = ? OR content_hash = ?)", user.ID, name, req.SHA256)
+	}
+	var existing models.CatatanKeuangan
+	if q.Order("id").First(&existing).Error == nil {
+		duplicateOf = &existing.ID
+		problems = append(problems, problem{apierr.Duplicate, "receipt already recorded"})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"accepted":     len(problems) == 0,
+		"content_type": mime,
+		"max_bytes":    maxUploadBytes,
+		"duplicate_of": duplicateOf,
+		"problems":     problems,
+	})
+}
+
+// recognizeUpload runs OCR on the stored file of up and links up to the owner's
+// catatan for that file, creating it when createCatatan is set (administrator
+// uploads never get one) and pending confirmation when pending is set. When no amount is found the upload is marked failed,
+// the file is moved to public/failed and ocr.ErrNoAmount is returned alongside
+// the result, which then lists the detected text regions so the user can pick
+// the amount (see uploadRegionHandler). The failure reason names the image
+// problem (blur, darkness, ...) when the quality gate found one; images the
+// gate rejects outright never reach OCR.
+func recognizeUpload(up *models.Upload, profile models.Profile, fullPath string, createCatatan, pending bool) (*ocr.Result, bool, error) {
+	// formats the gate cannot decode go straight to OCR
+	quality, _ := ocr.AssessFile(fullPath)
+	if quality != nil && quality.Reject() {
+		log.Printf("OCR: rejected %s before OCR: %v", fullPath, quality.Problems)
+		now := time.Now()
+		up.ProcessedAt = &now
+		return &ocr.Result{Quality: quality}, false, failRecognition(up, profile, fullPath, quality)
+	}
+	log.Printf("OCR: starting on %s for user=%d file=%s", fullPath, profile.UserID, up.FileName)
+	res, err := extractOCR(fullPath)
+	ocrexp.Shadow(db, fullPath, res)
+	if err != nil && !errors.Is(err, ocr.ErrNoAmount) {
+		log.Printf("OCR: error on %s: %v", fullPath, err)
+		return nil, false, err
+	}
+	res.Quality = quality
+	featureFlags.GateOCR(db, profile.UserID, res)
+	// owners who review low-confidence readings confirm them first
+	if res.NeedsConfirmation && !pending {
+		pending = loadPreferences(profile.UserID).ReviewLowConfidence
+	}
+	amt := res.Amount
+	now, conf, raw := time.Now(), res.Confidence, res.RawConfidence
+	up.ProcessedAt, up.OCRConfidence = &now, &conf
+	up.OCRHeuristic, up.OCRRawConfidence, up.Reference = res.Heuristic, &raw, res.Reference
+	if err := ocrtext.SaveResult(db, up.ID, res); err != nil {
+		log.Printf("OCR: storing text for upload=%d: %v", up.ID, err)
+	}
+	log.Printf("OCR: result amount=%s conf=%.2f raw=%q warnings=%v for %s", logredact.Amount(amt), res.Confidence, logredact.Text(res.Raw), res.Warnings, fullPath)
+	if amt <= 0 {
+		if regions, err := ocrEngine.Regions(fullPath); err == nil {
+			res.Regions = regions
+		} else {
+			log.Printf("OCR: regions of %s: %v", fullPath, err)
+		}
+		return res, false, failRecognition(up, profile, fullPath, quality)
+	}
+	return res, linkRecognized(up, profile, fullPath, res, createCatatan, pending), nil
+}
+
+// linkRecognized links up to the owner's catatan for its file, creating one
+// from res when createCatatan is set (pending confirmation when pending is
+// set), saves up and reports whether the amount was flagged suspect. A receipt
+// dated in a closed period gets no catatan; see holdForReview.
+func linkRecognized(up *models.Upload, profile models.Profile, fullPath string, res *ocr.Result, createCatatan, pending bool) bool {
+	amt := res.Amount
+	hooks.EmitAmountExtracted(context.Background(), hooks.AmountExtracted{Upload: *up, UserID: profile.UserID, Amount: amt, Confidence: res.Confidence, Source: hooks.SourceAPI})
+	// prefer the date printed on the receipt, then when the photo was taken
+	txDate, dateSource := catatanstore.TransactionDate(res.Date, up.CapturedAt, time.Now())
+	suspect := false
+	var existingCat models.CatatanKeuangan
+	if err := db.Where("user_id = ? AND file_name = ?", profile.UserID, up.FileName).First(&existingCat).Error; err == nil {
+		up.KeuanganID = &existingCat.ID
+	} else if createCatatan {
+		// a closed period takes no new catatan; the upload waits for review
+		if err := periodlock.Check(db, profile.UserID, txDate); err != nil {
+			holdForReview(up, profile.UserID, txDate, err)
+			db.Save(up)
+			return false
+		}
+		ct := models.CatatanKeuangan{UserID: profile.UserID, FileName: up.FileName, Amount: amt, Date: txDate, DateSource: dateSource,
+			ContentHash: catatanstore.HashFile(fullPath), Reference: catatanstore.Reference(res.Reference), Pending: pending}
+		ct.Tax, ct.ServiceCharge = res.Tax.Amounts()
+		if res.QRIS != nil {
+			ct.Merchant = res.QRIS.Merchant
+		}
+		// a bank or e-wallet named on the receipt selects the matching account
+		ct.AccountID = accounts.Match(db, profile.UserID, res.Institution)
+		if v := anomaly.Apply(db, &ct); v.Suspect {
+			suspect = true
+			log.Printf("OCR: suspect amount for user=%d file=%s: %s", profile.UserID, up.FileName, logredact.Digits(v.Reason))
+		}
+		created, err := catatanstore.Create(db, &ct)
+		switch {
+		case err != nil:
+			log.Printf("OCR: failed to create catatan for user=%d file=%s: %v", profile.UserID, up.FileName, err)
+		case created:
+			up.KeuanganID = &ct.ID
+			hooks.EmitCatatanCreated(context.Background(), hooks.CatatanCreated{Catatan: ct, Source: hooks.SourceAPI})
+			log.Printf("OCR: created catatan id=%d amount=%s for user=%d file=%s", ct.ID, logredact.Amount(amt), profile.UserID, up.FileName)
+		default:
+			up.KeuanganID = &ct.ID
+			suspect = ct.Suspect
+			log.Printf("OCR: user=%d file=%s is already recorded as catatan id=%d", profile.UserID, up.FileName, ct.ID)
+		}
+	}
+	db.Save(up)
+	return suspect
 }
 
+// failRecognition marks up failed with the reason quality suggests, moves the
+// file to public/failed and notifies the owner. It returns ocr.ErrNoAmount.
+func failRecognition(up *models.Upload, profile models.Profile, fullPath string, quality *ocr.Quality) error {
+	up.Failed = true
+	up.FailedReason = quality.FailureReason()
+	db.Save(up)
+	if err := uploadfiles.MoveToFailed(fullPath, *up); err != nil {
+		log.Printf("OCR: moving failed upload=%d: %v", up.ID, err)
+		_ = os.Remove(fullPath)
+	}
+	notifyUser(profile.UserID, notify.KindOCRFailed, map[string]any{"FileName": up.FileName})
+	return ocr.ErrNoAmount
+}
+
+// uploadSortColumns maps ?sort= values to ORDER BY clauses ("-" prefix = descending).
+var uploadSortColumns = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+	"file_name":  "file_name",
+}
+
+// listUploadsHandler lists uploads with optional filters: failed=true|false,
+// unlinked=true (no catatan yet), content_type=, file_name_like= (case-insensitive
+// substring), reference= (transaction reference read by OCR, any spacing or
+// case), sort=[-]id|created_at|file_name, limit (max 500) and offset.
 func listUploadsHandler(c *gin.Context) {
 	role, _ := c.Get("role")
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	var profile models.Profile
 	db.Where("user_id = ?", user.ID).First(&profile)
 	var uploads []models.Upload
-	q := db.Model(&models.Upload{})
+	q := reqDB(c).Model(&models.Upload{})
 	if role != "administrator" {
 		q = q.Where("profile_id = ?", profile.ID)
 	}
-	if err := q.Order("id desc").Limit(100).Find(&uploads).Error; err != nil {
-		writeError(c, http.StatusInternalServerError, "query_failed", "", nil)
+	if v := c.Query("failed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "failed must be true or false", gin.H{"field": "failed"})
+			return
+		}
+		q = q.Where("failed = ?", b)
+	}
+	if v := c.Query("unlinked"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "unlinked must be true or false", gin.H{"field": "unlinked"})
+			return
+		}
+		if b {
+			q = q.Where("keuangan_id IS NULL")
+		} else {
+			q = q.Where("keuangan_id IS NOT NULL")
+		}
+	}
+	if v := strings.TrimSpace(c.Query("content_type")); v != "" {
+		q = q.Where("content_type = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("file_name_like")); v != "" {
+		q = q.Where(`LOWER(file_name) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(v))+"%")
+	}
+	if v := c.Query("reference"); v != "" {
+		q = q.Where("reference = ?", ocr.NormalizeReference(v))
+	}
+	order := "id desc"
+	if v := c.Query("sort"); v != "" {
+		col, desc := strings.TrimPrefix(v, "-"), strings.HasPrefix(v, "-")
+		name, ok := uploadSortColumns[col]
+		if !ok {
+			writeError(c, apierr.InvalidBody, "unsupported sort", gin.H{"field": "sort", "allowed": []string{"id", "created_at", "file_name"}})
+			return
+		}
+		order = name + " asc"
+		if desc {
+			order = name + " desc"
+		}
+		if name != "id" {
+			order += ", id desc"
+		}
+	}
+	limit, offset := 100, 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(c, apierr.InvalidBody, "limit must be between 1 and 500", gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(c, apierr.InvalidBody, "offset must be >= 0", gin.H{"field": "offset"})
+			return
+		}
+		offset = n
+	}
+	if notModified(c, q) {
+		return
+	}
+	if err := q.Order(order).Limit(limit).Offset(offset).Find(&uploads).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, uploads)
 }
 
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func getUploadHandler(c *gin.Context) {
 	role, _ := c.Get("role")
 	user, ok := getUserFromContext(c)
 	if !ok {
-		writeError(c, http.StatusUnauthorized, "unauthorized", "", nil)
+		writeError(c, apierr.Unauthorized, "", nil)
 		return
 	}
 	var profile models.Profile
 	db.Where("user_id = ?", user.ID).First(&profile)
 	id := c.Param("id")
 	var up models.Upload
-	if err := db.First(&up, id).Error; err != nil {
-		writeError(c, http.StatusNotFound, "not_found", "", nil)
+	if err := reqDB(c).First(&up, id).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
 		return
 	}
 	if role != "administrator" && up.ProfileID != profile.ID {
-		writeError(c, http.StatusForbidden, "forbidden", "", nil)
+		writeError(c, apierr.Forbidden, "", nil)
 		return
 	}
 	c.JSON(http.StatusOK, up)
 }
 
+// getUploadOCRTextHandler returns the text OCR read from an upload, for
+// support and for re-running the heuristics offline.
+func getUploadOCRTextHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var profile models.Profile
+	db.Where("user_id = ?", user.ID).First(&profile)
+	var up models.Upload
+	if err := reqDB(c).First(&up, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if role != "administrator" && up.ProfileID != profile.ID {
+		writeError(c, apierr.Forbidden, "", nil)
+		return
+	}
+	text, err := ocrtext.Load(db, up.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(c, apierr.NotFound, "no OCR text stored for this upload", nil)
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"upload_id": up.ID, "text": text})
+}
+
+// getUploadItemsHandler returns the receipt line items OCR read from an
+// upload. Itemized extraction is experimental: items are only kept when
+// OCR_ITEMIZED is "store", and may be incomplete.
+func getUploadItemsHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var profile models.Profile
+	db.Where("user_id = ?", user.ID).First(&profile)
+	var up models.Upload
+	if err := reqDB(c).First(&up, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if role != "administrator" && up.ProfileID != profile.ID {
+		writeError(c, apierr.Forbidden, "", nil)
+		return
+	}
+	items, err := ocrtext.LoadItems(db, up.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	var sum int64
+	for _, it := range items {
+		sum += it.Price
+	}
+	c.JSON(http.StatusOK, gin.H{"upload_id": up.ID, "items": items, "items_total": sum, "itemized": itemizedFor(c)})
+}
+
 // -------------------- health --------------------
 func healthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// errorCatalogHandler publishes the machine-readable error codes.
+func errorCatalogHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"errors": apierr.Catalog()})
+}
+
 // -------------------- routes wiring --------------------
+
+// apiPrefix is the mount point of the current API version. Clients select a
+// version through the path; the unprefixed routes are deprecated aliases of v1.
+const apiPrefix = "/api/v1"
+
 func setupRoutes(r *gin.Engine) {
+	configureClientIP(r)
+	r.Use(requestIDMiddleware(), secheaders.Middleware(secheaders.ConfigFromEnv()), errorReportMiddleware(), gin.CustomRecovery(recoverWithEnvelope), dbAvailableMiddleware(), maintenanceMiddleware(), tenantMiddleware())
+	// health stays unversioned so probes never break
 	r.GET("/health", healthHandler)
-	r.POST("/register", registerHandler)
-	r.POST("/login", loginHandler)
-	r.POST("/refresh", refreshHandler)
-	r.POST("/revoke", revokeRefreshHandler)
-	auth := r.Group("")
+	v1 := r.Group(apiPrefix)
+	v1.Use(apiVersionHeader("v1"))
+	v1.GET("/health", healthHandler)
+	v1.GET("/errors", errorCatalogHandler)
+	limits := newAPILimits()
+	registerAPI(v1, limits)
+	legacy := r.Group("")
+	legacy.Use(deprecatedAlias(apiPrefix))
+	registerAPI(legacy, limits)
+	registerDebug(r)
+	r.NoRoute(unknownAPIVersion)
+}
+
+// registerAPI mounts every versioned endpoint on g, guarded by the shared limits.
+func registerAPI(g *gin.RouterGroup, limits apiLimits) {
+	authRate := limits.auth
+	g.POST("/register", authRate, registerHandler)
+	g.POST("/login", authRate, loginHandler)
+	g.POST("/refresh", refreshHandler)
+	g.POST("/revoke", revokeRefreshHandler)
+	g.GET("/tenant", getTenantHandler)
+	g.GET("/account-deletions/:token", purgeStatusHandler)
+	g.GET("/invites/:token", getInviteHandler)
+	g.GET("/profile-assets/:name", profileAssetFileHandler)
+	g.POST("/invites/:token/accept", authRate, acceptInviteHandler)
+	g.POST("/ingest/s3-event", requireIngestSecret(), s3EventIngestHandler)
+	g.POST("/ingest/email", requireIngestSecret(), emailIngestHandler)
+	g.GET("/bots/whatsapp/webhook", whatsAppVerifyHandler)
+	g.POST("/bots/whatsapp/webhook", whatsAppWebhookHandler)
+	auth := g.Group("")
 	auth.Use(jwtAuthMiddleware())
 	auth.GET("/me", meHandler)
+	auth.GET("/me/onboarding", onboardingHandler)
+	auth.GET("/me/feature-flags", myFeatureFlagsHandler)
+	auth.GET("/me/preferences", getPreferencesHandler)
+	auth.PUT("/me/preferences", updatePreferencesHandler)
+	auth.GET("/me/export", requirePermission(roles.PermExport), exportAccountHandler)
+	auth.GET("/me/export-mappings/:format", getExportMappingHandler)
+	auth.PUT("/me/export-mappings/:format", putExportMappingHandler)
+	auth.DELETE("/me", deleteAccountHandler)
+	auth.POST("/me/username", changeUsernameHandler)
+	auth.GET("/me/username/history", usernameHistoryHandler)
+	auth.GET("/me/sessions", listSessionsHandler)
+	auth.DELETE("/me/sessions/remembered", revokeRememberedSessionsHandler)
+	auth.DELETE("/me/sessions/:id", revokeSessionHandler)
+	auth.GET("/me/tokens", listAPITokensHandler)
+	auth.POST("/me/tokens", createAPITokenHandler)
+	auth.DELETE("/me/tokens/:id", deleteAPITokenHandler)
+	auth.POST("/me/chat-links/code", createChatLinkCodeHandler)
+	auth.GET("/me/chat-links", listChatLinksHandler)
+	auth.DELETE("/me/chat-links/:id", deleteChatLinkHandler)
 	auth.POST("/profile", createProfileHandler)
 	auth.GET("/profile", getProfileHandler)
-	auth.POST("/catatan", createCatatanHandler)
+	auth.PUT("/profile", updateProfileHandler)
+	auth.PUT("/profile/:kind", putProfileAssetHandler)
+	auth.DELETE("/profile/:kind", deleteProfileAssetHandler)
+	canWriteCatatan := requirePermission(roles.PermCatatanWrite)
+	auth.POST("/catatan", canWriteCatatan, createCatatanHandler)
 	auth.GET("/catatan", listCatatanHandler)
 	auth.GET("/catatan/total", getCatatanTotalHandler)
 	auth.GET("/catatan/revenue", revenueSummaryHandler)
-	auth.POST("/uploads", uploadFileHandler)
+	auth.GET("/catatan/tax", taxSummaryHandler)
+	auth.GET("/catatan/suspect", listSuspectCatatanHandler)
+	auth.GET("/catatan/pending", listPendingCatatanHandler)
+	auth.GET("/catatan/map", catatanMapHandler)
+	auth.GET("/catatan/histogram", catatanHistogramHandler)
+	auth.GET("/catatan/top", catatanTopHandler)
+	auth.GET("/catatan/calendar", catatanCalendarHandler)
+	auth.GET("/catatan/export", requirePermission(roles.PermExport), accountingExportHandler)
+	auth.POST("/catatan/:id/confirm", canWriteCatatan, confirmCatatanHandler)
+	auth.POST("/catatan/:id/attach-upload", canWriteCatatan, attachUploadHandler)
+	auth.POST("/catatan/:id/split", canWriteCatatan, splitCatatanHandler)
+	auth.PATCH("/catatan/bulk", canWriteCatatan, bulkEditCatatanHandler)
+	auth.GET("/accounts", listAccountsHandler)
+	auth.POST("/accounts", createAccountHandler)
+	auth.PUT("/accounts/:id", updateAccountHandler)
+	auth.DELETE("/accounts/:id", archiveOrDeleteAccountHandler)
+	auth.GET("/accounts/:id/summary", accountSummaryHandler)
+	auth.GET("/views", listViewsHandler)
+	auth.POST("/views", createViewHandler)
+	auth.PUT("/views/:id", updateViewHandler)
+	auth.DELETE("/views/:id", deleteViewHandler)
+	auth.GET("/goals", listGoalsHandler)
+	auth.POST("/goals", createGoalHandler)
+	auth.PUT("/goals/:id", updateGoalHandler)
+	auth.DELETE("/goals/:id", deleteGoalHandler)
+	auth.GET("/goals/:id/progress", goalProgressHandler)
+	auth.GET("/notifications", listNotificationsHandler)
+	auth.POST("/notifications/:id/read", markNotificationReadHandler)
+	auth.GET("/notifications/push-key", pushKeyHandler)
+	auth.GET("/me/digest/preview", digestPreviewHandler)
+	auth.POST("/me/push-subscriptions", createPushSubscriptionHandler)
+	auth.DELETE("/me/push-subscriptions", deletePushSubscriptionHandler)
+	auth.GET("/periods/locks", listPeriodLocksHandler)
+	auth.GET("/orgs", listOrgsHandler)
+	auth.POST("/orgs", createOrgHandler)
+	auth.GET("/orgs/:id", getOrgHandler)
+	auth.PUT("/orgs/:id", renameOrgHandler)
+	auth.POST("/orgs/:id/members", addOrgMemberHandler)
+	auth.PUT("/orgs/:id/members/:user_id", setOrgMemberRoleHandler)
+	auth.DELETE("/orgs/:id/members/:user_id", removeOrgMemberHandler)
+	auth.GET("/orgs/:id/invites", listOrgInvitesHandler)
+	auth.POST("/orgs/:id/invites", createOrgInviteHandler)
+	auth.POST("/orgs/:id/invites/:invite_id/resend", resendOrgInviteHandler)
+	auth.DELETE("/orgs/:id/invites/:invite_id", revokeOrgInviteHandler)
+	auth.GET("/orgs/:id/summary", orgSummaryHandler)
+	auth.GET("/orgs/:id/usage", orgUsageHandler)
+	auth.GET("/orgs/:id/catatan", listOrgCatatanHandler)
+	auth.GET("/orgs/:id/export", requirePermission(roles.PermExport), exportOrgCatatanHandler)
+	auth.POST("/periods/:period/close", closePeriodHandler)
+	// region retries run OCR too, so they draw on the same per-user budget
+	uploadRate := limits.uploads
+	canUpload := requirePermission(roles.PermUpload)
+	auth.POST("/uploads", canUpload, uploadRate, uploadFileHandler)
+	auth.POST("/uploads/precheck", precheckUploadHandler)
+	auth.POST("/uploads/presign", canUpload, uploadRate, presignUploadHandler)
+	auth.POST("/uploads/complete", canUpload, completeUploadHandler)
 	auth.GET("/uploads", listUploadsHandler)
+	auth.GET("/uploads/archive", requirePermission(roles.PermExport), receiptsArchiveHandler)
 	auth.GET("/uploads/:id", getUploadHandler)
+	auth.GET("/uploads/:id/ocr-text", getUploadOCRTextHandler)
+	auth.GET("/uploads/:id/items", getUploadItemsHandler)
+	auth.GET("/uploads/:id/notes", listUploadNotesHandler)
+	auth.POST("/uploads/:id/notes", createUploadNoteHandler)
+	auth.POST("/uploads/:id/region", canUpload, uploadRate, uploadRegionHandler)
+	admin := auth.Group("/admin")
+	admin.Use(requireAdmin())
+	// a tenant's administrators manage its own users and data ...
+	admin.GET("/analytics", adminAnalyticsHandler)
+	admin.POST("/periods/:period/unlock", unlockPeriodHandler)
+	admin.PUT("/users/:username/role", setUserRoleHandler)
+	admin.POST("/users/:username/disable", setUserDisabledHandler(true))
+	admin.POST("/users/:username/enable", setUserDisabledHandler(false))
+	admin.GET("/duplicates", adminDuplicatesHandler)
+	admin.GET("/catatan", adminCatatanHandler)
+	// ... the rest concerns the whole deployment
+	platform := admin.Group("")
+	platform.Use(requirePlatformAdmin())
+	platform.POST("/cleanup", adminCleanupHandler)
+	platform.GET("/maintenance", getMaintenanceHandler)
+	platform.PUT("/maintenance", setMaintenanceHandler)
+	platform.GET("/cors", getCORSHandler)
+	platform.PUT("/cors", setCORSHandler)
+	platform.POST("/cors/reload", reloadCORSHandler)
+	platform.GET("/db-stats", adminDBStatsHandler)
+	platform.GET("/feature-flags", listFeatureFlagsHandler)
+	platform.PUT("/feature-flags/:key", putFeatureFlagHandler)
+	platform.DELETE("/feature-flags/:key", deleteFeatureFlagHandler)
+	platform.GET("/rate-limits", getRateLimitsHandler)
+	platform.PUT("/rate-limits", setRateLimitsHandler)
+	platform.GET("/roles", listRolesHandler)
+	platform.POST("/roles", createRoleHandler)
+	platform.PUT("/roles/:id", updateRoleHandler)
+	platform.DELETE("/roles/:id", deleteRoleHandler)
+	platform.PUT("/orgs/:id/quota", setOrgQuotaHandler)
+	platform.POST("/file-gc", adminFileGCHandler)
+	platform.GET("/ocr/calibration", getOCRCalibrationHandler)
+	platform.POST("/ocr/calibration", refitOCRCalibrationHandler)
+	platform.GET("/ocr/experiment", getOCRExperimentHandler)
+	platform.PUT("/ocr/experiment", startOCRExperimentHandler)
+	platform.DELETE("/ocr/experiment", stopOCRExperimentHandler)
+	platform.POST("/ocr/experiment/promote", promoteOCRExperimentHandler)
+	platform.GET("/jobs", listJobsHandler)
+	platform.GET("/jobs/:name/runs", jobRunsHandler)
+	platform.POST("/jobs/:name/run", triggerJobHandler)
+	platform.GET("/tenants", listTenantsHandler)
+	platform.POST("/tenants", createTenantHandler)
+	platform.PUT("/tenants/:id", updateTenantHandler)
+}
+
+// apiVersionHeader reports the API version that served the request.
+func apiVersionHeader(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("API-Version", version)
+		c.Next()
+	}
+}
+
+// deprecatedAlias marks legacy root routes as deprecated and points clients at the
+// versioned successor. Set API_LEGACY_SUNSET (HTTP date) to announce removal.
+func deprecatedAlias(prefix string) gin.HandlerFunc {
+	sunset := strings.TrimSpace(os.Getenv("API_LEGACY_SUNSET"))
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", prefix, c.Request.URL.Path))
+		if sunset != "" {
+			c.Header("Sunset", sunset)
+		}
+		c.Next()
+	}
+}
+
+// unknownAPIVersion answers JSON for unmatched routes, flagging unsupported versions.
+func unknownAPIVersion(c *gin.Context) {
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path+"/", apiPrefix+"/") {
+		writeError(c, apierr.UnsupportedAPIVersion, "supported versions: v1", gin.H{"supported": []string{"v1"}})
+		return
+	}
+	writeError(c, apierr.NotFound, "", nil)
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/exifmeta"
+	"be03/pkg/hooks"
+	"be03/pkg/orgs"
+	"be03/pkg/storage"
+	"be03/pkg/storagepath"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/uploadqueue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- ingestion --------------------
+
+// objectStore fetches objects announced by bucket notifications; nil until
+// S3_ENDPOINT is configured. Tests swap in an in-memory backend.
+var objectStore storage.Backend
+
+// initObjectStore connects the S3/MinIO backend when S3_ENDPOINT is set.
+func initObjectStore() {
+	cfg, ok := storage.ConfigFromEnv()
+	if !ok {
+		return
+	}
+	s3, err := storage.NewS3(cfg)
+	if err != nil {
+		log.Printf("object storage disabled: %v", err)
+		return
+	}
+	objectStore = s3
+}
+
+// requireIngestSecret authenticates machine callers with the INGEST_SECRET shared
+// secret, sent as "X-Ingest-Secret: <secret>", "Authorization: Bearer <secret>" or
+// as the basic-auth password (for webhook providers that only support URL credentials).
+func requireIngestSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := os.Getenv("INGEST_SECRET")
+		if secret == "" {
+			writeError(c, apierr.IngestDisabled, "set INGEST_SECRET to enable ingestion", nil)
+			return
+		}
+		got := c.GetHeader("X-Ingest-Secret")
+		if _, pw, ok := c.Request.BasicAuth(); got == "" && ok {
+			got = pw
+		}
+		if got == "" {
+			got = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			writeError(c, apierr.Unauthorized, "invalid ingest secret", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// s3Event is the subset of an S3 / MinIO bucket notification we use.
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// ingestResult reports the outcome for one notification record.
+type ingestResult struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Status   string `json:"status"` // queued | ignored | rejected
+	UploadID uint   `json:"upload_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// s3EventIngestHandler accepts bucket notifications for objects keyed
+// "<username>/<file name>", downloads each new object into public/keu under
+// that user's disk name, records the Upload for their profile and notifies the
+// watcher to OCR it. Records are handled independently; the response lists
+// every outcome.
+func s3EventIngestHandler(c *gin.Context) {
+	if objectStore == nil {
+		writeError(c, apierr.IngestDisabled, "set S3_ENDPOINT to enable bucket ingestion", nil)
+		return
+	}
+	var ev s3Event
+	if err := c.ShouldBindJSON(&ev); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	results := make([]ingestResult, 0, len(ev.Records))
+	for _, rec := range ev.Records {
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			key = rec.S3.Object.Key
+		}
+		res := ingestResult{Bucket: rec.S3.Bucket.Name, Key: key}
+		if !strings.Contains(rec.EventName, "ObjectCreated:") {
+			res.Status, res.Reason = "ignored", "not an object-created event"
+		} else {
+			res.UploadID, err = ingestObject(c.Request.Context(), rec.S3.Bucket.Name, key, rec.S3.Object.Size)
+			if err != nil {
+				res.Status, res.Reason = "rejected", err.Error()
+				log.Printf("ingest: %s/%s rejected: %v", res.Bucket, key, err)
+			} else {
+				res.Status = "queued"
+			}
+		}
+		results = append(results, res)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"results": results})
+}
+
+// ingestObject stores one bucket object as an upload and returns its id.
+func ingestObject(ctx context.Context, bucket, key string, size int64) (uint, error) {
+	owner, _, found := strings.Cut(key, "/")
+	name := path.Base(key)
+	if !found || owner == "" || name == "" || name == "." {
+		return 0, errors.New("key must be <username>/<file name>")
+	}
+	if size > maxUploadBytes {
+		return 0, errors.New("file too large")
+	}
+	var user models.User
+	if err := db.Where("username = ?", owner).First(&user).Error; err != nil {
+		return 0, fmt.Errorf("unknown user %q", owner)
+	}
+	if user.DisabledAt != nil {
+		return 0, fmt.Errorf("account %q is disabled", owner)
+	}
+	var profile models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		return 0, errors.New("profile missing")
+	}
+	rc, err := objectStore.Get(ctx, bucket, key)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, rc, maxUploadBytes+1); err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	return ingestFile(profile, name, buf.Bytes())
+}
+
+// ingestFile runs a file received outside the upload form through the upload
+// pipeline: validate, store under public/keu, record the Upload for profile and
+// notify the watcher, which performs OCR and creates the catatan.
+func ingestFile(profile models.Profile, name string, data []byte) (uint, error) {
+	up, _, err := storeIngestedFile(profile, name, data)
+	if err != nil {
+		return 0, err
+	}
+	if err := uploadqueue.Publish(db, uploadqueue.Event{UploadID: up.ID, FileName: up.FileName, StorePath: up.StorePath}); err != nil {
+		log.Printf("upload notify failed for upload=%d: %v", up.ID, err)
+	}
+	return up.ID, nil
+}
+
+// storeIngestedFile validates data, writes it to public/keu under the profile's
+// disk name (see storagepath.DiskName), as the upload form does, and records (or
+// resets) the Upload row for profile. It returns the upload and the file's full
+// path. Two users ingesting the same file name never share a file.
+func storeIngestedFile(profile models.Profile, name string, data []byte) (*models.Upload, string, error) {
+	// names come from bucket keys, mail and chat providers: keep only the base
+	name = filepath.Base(filepath.FromSlash(name))
+	if name == "." || name == string(filepath.Separator) {
+		return nil, "", errors.New("file name missing")
+	}
+	if len(data) > maxUploadBytes {
+		return nil, "", errors.New("file too large")
+	}
+	mime, err := uploadfiles.APITypes.Sniff(name, data)
+	if err != nil {
+		return nil, "", errors.New("unsupported file type")
+	}
+	var up models.Upload
+	existing := db.Where("profile_id = ? AND file_name = ?", profile.ID, name).First(&up).Error == nil
+	if existing && up.KeuanganID != nil {
+		return nil, "", errors.New("already processed")
+	}
+	if err := orgs.CheckQuota(db, profile.UserID, int64(len(data)), time.Now()); err != nil {
+		return nil, "", err
+	}
+
+	// the stored image keeps no EXIF; its location and capture time go on the upload row
+	lat, lon, locSource := exifLocation(profile.UserID, data)
+	captured := exifCaptureTime(profile.UserID, data)
+	data, _ = exifmeta.Strip(data)
+
+	// stage then rename so the watcher never sees a partial file
+	baseDir := storagepath.Root
+	fullPath := storagepath.File(storagepath.StorePath(profile.ID, name))
+	stagingDir := filepath.Join(baseDir, ".staging")
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return nil, "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return nil, "", err
+	}
+	tmpName := filepath.Join(stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), name))
+	if err := os.WriteFile(tmpName, data, 0644); err != nil {
+		return nil, "", err
+	}
+	if err := os.Rename(tmpName, fullPath); err != nil {
+		_ = os.Remove(tmpName)
+		return nil, "", err
+	}
+
+	storePath := filepath.ToSlash(fullPath)
+	if existing {
+		up.StorePath, up.ContentType, up.Failed, up.FailedReason, up.SizeBytes = storePath, mime, false, "", int64(len(data))
+		up.Latitude, up.Longitude, up.LocationSource, up.CapturedAt = lat, lon, locSource, captured
+		err = db.Save(&up).Error
+	} else {
+		up = models.Upload{ProfileID: profile.ID, FileName: name, StorePath: storePath, ContentType: mime, SizeBytes: int64(len(data)),
+			Latitude: lat, Longitude: lon, LocationSource: locSource, CapturedAt: captured}
+		err = db.Create(&up).Error
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("saving upload failed: %w", err)
+	}
+	orgs.WarnNearLimit(db, profile.UserID, time.Now())
+	indexImage(profile.UserID, &up, data)
+	hooks.EmitUploadStored(context.Background(), hooks.UploadStored{Upload: up, UserID: profile.UserID, Source: hooks.SourceAPI})
+	return &up, fullPath, nil
+}
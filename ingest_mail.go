@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/mailin"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUnknownSender means no profile carries the sender's e-mail address.
+var errUnknownSender = errors.New("no profile with this e-mail address")
+
+// errDisabledSender means the sender's account is deactivated.
+var errDisabledSender = errors.New("the account of this e-mail address is disabled")
+
+// errUnverifiedSender means the receiving side did not authenticate the From
+// address, so it may be forged.
+var errUnverifiedSender = errors.New("sender address is not verified (no aligned DKIM, SPF or DMARC pass)")
+
+// mailResult reports the outcome for one attachment.
+type mailResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"` // queued | rejected
+	UploadID uint   `json:"upload_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ingestMail maps a verified sender to a profile (by profile e-mail,
+// case-insensitive) and pushes every receipt attachment through ingestFile; a PDF
+// goes in as the JPEG it embeds. Attachment names are prefixed with a digest of
+// the Message-ID so common names like image001.jpg do not collide, while a
+// redelivered message maps onto the same uploads.
+func ingestMail(m *mailin.Message) ([]mailResult, error) {
+	if !m.Verified {
+		return nil, errUnverifiedSender
+	}
+	var profile models.Profile
+	if m.From == "" || db.Where("LOWER(email) = ?", m.From).First(&profile).Error != nil {
+		return nil, errUnknownSender
+	}
+	var owner models.User
+	if err := db.First(&owner, profile.UserID).Error; err != nil {
+		return nil, errUnknownSender
+	}
+	if owner.DisabledAt != nil {
+		return nil, errDisabledSender
+	}
+	prefix := mailPrefix(m.ID)
+	var results []mailResult
+	for _, a := range m.Receipts() {
+		res := mailResult{Name: prefix + a.Name}
+		data := a.Data
+		var err error
+		if strings.EqualFold(filepath.Ext(a.Name), ".pdf") || mailin.IsPDF(a) {
+			var ok bool
+			if data, ok = mailin.PDFImage(a.Data); ok {
+				res.Name = strings.TrimSuffix(res.Name, filepath.Ext(res.Name)) + ".jpg"
+			} else {
+				err = errors.New("pdf has no embedded receipt image; forward a photo or screenshot")
+			}
+		}
+		if err == nil {
+			res.UploadID, err = ingestFile(profile, res.Name, data)
+		}
+		if err != nil {
+			res.Status, res.Reason = "rejected", err.Error()
+			log.Printf("mail ingest: %s from %s rejected: %v", a.Name, m.From, err)
+		} else {
+			res.Status = "queued"
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// ignoredSender reports whether err rejects the whole message because of its
+// sender; such mail is acknowledged and dropped, not retried.
+func ignoredSender(err error) bool {
+	return errors.Is(err, errUnknownSender) || errors.Is(err, errUnverifiedSender) || errors.Is(err, errDisabledSender)
+}
+
+func mailPrefix(messageID string) string {
+	if messageID == "" {
+		messageID = fmt.Sprint(time.Now().UnixNano())
+	}
+	sum := sha1.Sum([]byte(messageID))
+	return "mail-" + hex.EncodeToString(sum[:4]) + "-"
+}
+
+// emailIngestHandler accepts inbound-mail webhooks. It understands SendGrid Inbound
+// Parse (form fields from + attachmentN files, or the full MIME message in "email"
+// when "send raw" is enabled) and Mailgun routes (sender/from + attachment-N files).
+// The From address counts only when the provider reports it verified (see
+// mailin.VerifyFields) or, for raw mail, when the Authentication-Results header of
+// MAIL_AUTHSERV_ID vouches for it. Unverified and unknown senders are acknowledged
+// with 202 so providers do not retry them, and so is mail for disabled accounts.
+func emailIngestHandler(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		writeError(c, apierr.InvalidBody, "expected multipart/form-data", nil)
+		return
+	}
+	var m *mailin.Message
+	if raw := c.PostForm("email"); raw != "" {
+		if m, err = mailin.Parse(strings.NewReader(raw)); err != nil {
+			writeError(c, apierr.InvalidBody, "unreadable raw email: "+err.Error(), gin.H{"field": "email"})
+			return
+		}
+		m.Verify(os.Getenv("MAIL_AUTHSERV_ID"))
+	} else {
+		m = &mailin.Message{ID: c.PostForm("Message-Id"), Subject: c.PostForm("subject")}
+		// "from" is the header the user sees; Mailgun's "sender" is the envelope
+		if f := c.PostForm("from"); f != "" {
+			m.From = mailin.ParseAddress(f)
+		} else {
+			m.From = mailin.ParseAddress(c.PostForm("sender"))
+		}
+		fields := make([]string, 0, len(form.File))
+		for k := range form.File {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, k := range fields {
+			for _, fh := range form.File[k] {
+				f, err := fh.Open()
+				if err != nil {
+					continue
+				}
+				data, err := io.ReadAll(io.LimitReader(f, mailin.MaxAttachmentBytes+1))
+				f.Close()
+				if err != nil {
+					continue
+				}
+				m.Attachments = append(m.Attachments, mailin.Attachment{Name: filepath.Base(fh.Filename), ContentType: fh.Header.Get("Content-Type"), Data: data})
+			}
+		}
+	}
+	m.VerifyFields(c.PostForm)
+	results, err := ingestMail(m)
+	if ignoredSender(err) {
+		log.Printf("mail ingest: ignoring mail from %q: %v", m.From, err)
+		c.JSON(http.StatusAccepted, gin.H{"from": m.From, "status": "ignored", "reason": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"from": m.From, "status": "processed", "results": results})
+}
+
+// startMailPoller polls the IMAP mailbox configured by MAIL_IMAP_* and ingests
+// forwarded receipts. Mail from unknown, unverified or disabled senders is
+// marked seen and skipped.
+func startMailPoller() {
+	cfg, ok := mailin.IMAPConfigFromEnv()
+	if !ok {
+		return
+	}
+	log.Printf("mail ingest: polling %s/%s every %s", cfg.Addr, cfg.Mailbox, cfg.Interval)
+	handle := func(m *mailin.Message) error {
+		m.Verify(cfg.AuthServID)
+		results, err := ingestMail(m)
+		if ignoredSender(err) {
+			log.Printf("mail ingest: skipping mail from %q: %v", m.From, err)
+			return nil
+		}
+		log.Printf("mail ingest: %d attachment(s) from %s", len(results), m.From)
+		return err
+	}
+	for {
+		if n, err := mailin.FetchUnseen(cfg, handle); err != nil {
+			log.Printf("mail ingest: %v (handled %d)", err, n)
+		}
+		time.Sleep(cfg.Interval)
+	}
+}
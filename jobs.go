@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- background jobs --------------------
+
+// jobScheduler runs the periodic jobs; startJobs sets it up.
+var jobScheduler *scheduler.Scheduler
+
+// defaultJobSchedules are used unless JOB_SCHEDULES overrides them, e.g.
+// JOB_SCHEDULES="token_janitor=0 4 * * *;weekly_digest=@every 30m".
+var defaultJobSchedules = map[string]string{
+	"weekly_digest":   "5 * * * *",
+	"token_janitor":   "0 3 * * *",
+	"catatan_archive": "30 3 * * *",
+}
+
+// jobSchedule is the schedule of the job name.
+func jobSchedule(name string) (scheduler.Schedule, error) {
+	spec := defaultJobSchedules[name]
+	for _, kv := range strings.Split(os.Getenv("JOB_SCHEDULES"), ";") {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.TrimSpace(k) == name {
+			spec = v
+		}
+	}
+	return scheduler.Parse(spec, time.Local)
+}
+
+// newJobScheduler registers the jobs enabled by the environment.
+func newJobScheduler() *scheduler.Scheduler {
+	s := scheduler.New(db)
+	jobs := []scheduler.Job{
+		{Name: "weekly_digest", Description: "send last week's digest to users whose week rolled over", Run: sendDigests},
+	}
+	if days := tokenRetentionDays(); days > 0 {
+		jobs = append(jobs, scheduler.Job{Name: "token_janitor", Description: "delete refresh tokens dead for REFRESH_TOKEN_RETENTION_DAYS", Run: pruneTokensJob(days)})
+	}
+	if years := catatanArchiveYears(); years > 0 {
+		jobs = append(jobs, scheduler.Job{Name: "catatan_archive", Description: "move catatan older than CATATAN_ARCHIVE_YEARS into the archive", Run: archiveCatatan(years)})
+	}
+	for _, j := range jobs {
+		sched, err := jobSchedule(j.Name)
+		if err != nil {
+			log.Fatalf("jobs: %s: %v", j.Name, err)
+		}
+		j.Schedule = sched
+		if err := s.Register(j); err != nil {
+			log.Fatalf("jobs: %v", err)
+		}
+	}
+	return s
+}
+
+// startJobs runs the scheduler unless JOBS_ENABLED=false, which keeps a
+// server out of scheduled runs; administrators can still trigger jobs there.
+func startJobs() {
+	jobScheduler = newJobScheduler()
+	if on, err := strconv.ParseBool(os.Getenv("JOBS_ENABLED")); err == nil && !on {
+		log.Printf("jobs: scheduled runs disabled on this server")
+		return
+	}
+	go jobScheduler.Start(context.Background())
+}
+
+type jobView struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Schedule    string         `json:"schedule"`
+	NextRunAt   time.Time      `json:"next_run_at"`
+	Running     bool           `json:"running"`
+	LockedBy    string         `json:"locked_by,omitempty"`
+	LastRun     *models.JobRun `json:"last_run"`
+}
+
+// listJobsHandler lists the jobs with their next run time, whether a server
+// holds their lease and their latest run.
+func listJobsHandler(c *gin.Context) {
+	now := time.Now()
+	items := []jobView{}
+	for _, j := range jobScheduler.Jobs() {
+		v := jobView{Name: j.Name, Description: j.Description, Schedule: j.Schedule.String(), NextRunAt: j.Schedule.Next(now)}
+		lock, err := jobScheduler.Lock(j.Name)
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		if lock.LockedUntil > now.Unix() {
+			v.Running, v.LockedBy = true, lock.Owner
+		}
+		runs, err := jobScheduler.Runs(j.Name, 1)
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		if len(runs) > 0 {
+			v.LastRun = &runs[0]
+		}
+		items = append(items, v)
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// jobRunsHandler returns a job's run history, newest first (?limit=, default
+// 50, at most 500).
+func jobRunsHandler(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := jobScheduler.Job(name); !ok {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(c, apierr.InvalidBody, "limit must be 1-500", gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	runs, err := jobScheduler.Runs(name, limit)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": runs})
+}
+
+// triggerJobHandler starts a job now and returns its run; follow it through
+// the run history.
+func triggerJobHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	run, err := jobScheduler.Trigger(c.Request.Context(), c.Param("name"), &user.ID)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	case errors.Is(err, scheduler.ErrBusy):
+		writeError(c, apierr.JobRunning, "", nil)
+		return
+	case err != nil:
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	recordAudit(c, "job.trigger", gin.H{"job": run.Job, "run_id": run.ID})
+	c.JSON(http.StatusAccepted, run)
+}
@@ -4,13 +4,18 @@ import (
 	"bufio"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"be03/pkg/accountpurge"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrcalib"
+	"be03/pkg/ocrexp"
+	"be03/pkg/uploadfiles"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,30 +41,49 @@ func main() {
 	}
 
 	initDB()
+	initObjectStore()
+	initFX()
+	initErrorReporter()
+	// finish account deletions interrupted by a restart
+	go accountpurge.ResumePending(db, uploadfiles.Candidates)
+	// forwarded e-receipts (only when MAIL_IMAP_ADDR is set)
+	go startMailPoller()
+	startChatBots()
+	startNotifier()
+	startEventWebhook()
+	startJobs()
+	go startFileGC()
+	// intermediate OCR images of extractions cut short by a crash
+	if n, err := ocr.SweepStale(ocr.StaleAfter); n > 0 || err != nil {
+		log.Printf("ocr temp sweep: removed=%d err=%v", n, err)
+	}
+	// the confidence calibration, refitted via /admin/ocr/calibration, and
+	// the pipeline options promoted via /admin/ocr/experiment
+	ocrcalib.Watch(db, time.Minute)
+	ocrexp.Watch(db, time.Minute)
 
 	r := gin.Default()
 
-	// Register CORS middleware early so all routes covered
+	// Register CORS middleware early so all routes covered (after initDB: an
+	// admin override may be stored in the database)
 	r.Use(corsMiddleware())
+	go reloadCORSOnSignal()
 
 	setupRoutes(r)
 
 	// Start file watcher in background so `go run .` also runs the watcher.
 	go startWatcherProcess()
 
-	// Listen on configured port (default 8080 to match FE expectations)
-	port := os.Getenv("PORT")
-	if strings.TrimSpace(port) == "" {
-		port = os.Getenv("SERVER_PORT")
+	// LISTEN_ADDR, a Unix socket or PORT (default 8080 to match FE expectations);
+	// HTTPS and HTTP/2 when TLS_CERT_FILE / TLS_AUTOCERT_DOMAINS are set
+	if err := serve(r, listenAddr()); err != nil {
+		log.Fatal(err)
 	}
-	if strings.TrimSpace(port) == "" {
-		port = "8080"
-	}
-	r.Run(":" + port)
 }
 
 // startWatcherProcess launches the existing process watcher as a child process
-// using `go run`. Output is redirected to logs/watcher.log. This keeps the
+// using `go run ./process` (the package, not process_keu.go alone: it spans
+// several files). Output is redirected to logs/watcher.log. This keeps the
 // implementation minimal and avoids refactoring the watcher into a library.
 func startWatcherProcess() {
 	// Ensure logs directory exists
@@ -70,7 +94,7 @@ func startWatcherProcess() {
 		log.Printf("failed to open watcher log: %v", err)
 		return
 	}
-	cmd := exec.Command("go", "run", "process/process_keu.go", "-dir", "public/keu", "-watch")
+	cmd := exec.Command("go", "run", "./process", "-dir", "public/keu", "-watch")
 	// inherit environment so DB_DSN and other env vars propagate
 	cmd.Env = os.Environ()
 	cmd.Stdout = f
@@ -84,68 +108,6 @@ func startWatcherProcess() {
 	// do not wait here; child runs independently and logs to file
 }
 
-// corsMiddleware allows cross-origin requests from configured origins (comma separated in ALLOWED_ORIGINS).
-// If ALLOWED_ORIGINS is empty, it falls back to common local dev ports.
-// Example .env: ALLOWED_ORIGINS=http://localhost:3000,http://localhost:3001
-func corsMiddleware() gin.HandlerFunc {
-	// Read and parse allowed origins once (hot-reload not required for dev convenience)
-	raw := os.Getenv("ALLOWED_ORIGINS")
-	if strings.TrimSpace(raw) == "" {
-		// backward-compat for .env that used ALLOW_ORIGINS
-		raw = os.Getenv("ALLOW_ORIGINS")
-	}
-	if strings.TrimSpace(raw) == "" {
-		// include Vite default 5173 plus common React ports
-		raw = strings.Join([]string{
-			// localhost variants
-			"http://localhost:5173",
-			"http://localhost:3000",
-			"http://localhost:3001",
-			"http://localhost:3002",
-			"http://localhost:3003",
-			// 127.0.0.1 variants (common FE dev setups)
-			"http://127.0.0.1:5173",
-			"http://127.0.0.1:3000",
-			"http://127.0.0.1:3001",
-			"http://127.0.0.1:3002",
-			"http://127.0.0.1:3003",
-		}, ",")
-	}
-	parts := strings.Split(raw, ",")
-	allowed := make(map[string]struct{}, len(parts))
-	cleanedList := make([]string, 0, len(parts))
-	for _, p := range parts {
-		o := strings.TrimSpace(p)
-		if o == "" {
-			continue
-		}
-		allowed[o] = struct{}{}
-		cleanedList = append(cleanedList, o)
-	}
-	allowMethods := "GET,POST,PUT,PATCH,DELETE,OPTIONS"
-	allowHeaders := "Authorization,Content-Type,Accept,Origin,X-Requested-With"
-	maxAge := fmt.Sprintf("%d", int((12*time.Hour)/time.Second))
-	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		if origin != "" {
-			if _, ok := allowed[origin]; ok {
-				c.Header("Access-Control-Allow-Origin", origin)
-				c.Header("Vary", "Origin")
-				c.Header("Access-Control-Allow-Credentials", "true")
-				c.Header("Access-Control-Allow-Methods", allowMethods)
-				c.Header("Access-Control-Allow-Headers", allowHeaders)
-				c.Header("Access-Control-Max-Age", maxAge)
-			}
-		}
-		// Handle preflight quickly
-		if c.Request.Method == http.MethodOptions {
-			c.Status(http.StatusNoContent)
-			return
-		}
-		c.Next()
-	}
-}
-
 // loadDotEnv loads key=value pairs from a local .env file into the environment
 // without overwriting variables that are already set. Lines starting with # are ignored.
 func loadDotEnv() {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/maintenance"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- maintenance mode --------------------
+
+// maintenanceCheckTTL bounds how stale a server's view of the switch may be.
+const maintenanceCheckTTL = 5 * time.Second
+
+// maintenanceExempt are the routes (as registered, see gin.Context.FullPath)
+// still writable during maintenance: logging in (so an administrator can lift
+// it) and the switch itself, under apiPrefix and as legacy aliases.
+var maintenanceExempt = func() map[string]bool {
+	m := map[string]bool{}
+	for _, route := range []string{"/login", "/refresh", "/admin/maintenance"} {
+		m[route], m[apiPrefix+route] = true, true
+	}
+	return m
+}()
+
+// maintenanceMiddleware rejects mutating requests with 503 while maintenance
+// mode is on; reads keep working.
+func maintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if maintenanceExempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		st := maintenance.Current(db, maintenanceCheckTTL)
+		if !st.Enabled {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "120")
+		writeError(c, apierr.Maintenance, st.Message, gin.H{"since": st.Since})
+	}
+}
+
+func getMaintenanceHandler(c *gin.Context) {
+	st, err := maintenance.Load(db)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// setMaintenanceHandler turns maintenance mode on or off. Servers and the
+// watcher notice within a few seconds.
+func setMaintenanceHandler(c *gin.Context) {
+	var req struct {
+		Enabled *bool  `json:"enabled" binding:"required"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	by := ""
+	if user, ok := getUserFromContext(c); ok {
+		by = user.Username
+	}
+	st, err := maintenance.Set(db, *req.Enabled, req.Message, by)
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	action := "maintenance.disable"
+	if *req.Enabled {
+		action = "maintenance.enable"
+	}
+	recordAudit(c, action, gin.H{"message": req.Message})
+	c.JSON(http.StatusOK, st)
+}
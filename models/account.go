@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Account types.
+const (
+	AccountCash    = "cash"
+	AccountBank    = "bank"
+	AccountEWallet = "ewallet"
+)
+
+// Account is a place money is held (cash, a bank account, an e-wallet). Catatan
+// may reference one; its balance is OpeningBalance plus the catatan recorded on it.
+type Account struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Name      string `gorm:"size:128;not null"`
+	Type      string `gorm:"size:16;not null"`
+	// Institution is the bank or e-wallet brand as reported by ocr.DetectInstitution
+	// (e.g. "BCA", "GoPay"); receipts from it are assigned to this account.
+	Institution    string `gorm:"size:64"`
+	OpeningBalance int64  `gorm:"not null;default:0"`
+	Archived       bool   `gorm:"not null;default:false"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// All lists every table the application migrates, in dependency order. New
+// models go here as well as in the server's migrations.
+func All() []any {
+	return []any{
+		&Role{},
+		&User{},
+		&CatatanKeuangan{},
+		&Profile{},
+		&Upload{},
+		&RefreshToken{},
+		&Preferences{},
+		&AuditLog{},
+		&PurgeJob{},
+		&ChatLink{},
+		&ChatLinkCode{},
+		&PeriodLock{},
+		&Account{},
+		&Goal{},
+		&Notification{},
+		&NotificationDelivery{},
+		&PushSubscription{},
+		&Setting{},
+		&CatatanArchive{},
+		&UploadOCRText{},
+		&UploadPHashBand{},
+		&Organization{},
+		&OrgMembership{},
+		&OrgInvite{},
+		&ExportMapping{},
+		&APIToken{},
+		&ExchangeRate{},
+		&UploadItem{},
+		&UsernameHistory{},
+		&FeatureFlag{},
+		&JobLock{},
+		&JobRun{},
+		&Tenant{},
+		&SavedView{},
+		&UploadNote{},
+		&OCRShadowRun{},
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIToken is a personal access token: a long-lived, read-only bearer token a
+// user creates for spreadsheets and BI tools (see pkg/apitokens). Only the
+// token's SHA-256 is stored; Hint is its first characters, to tell tokens
+// apart in the list.
+type APIToken struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:128;not null"`
+	TokenHash  string `gorm:"size:64;not null;uniqueIndex"`
+	Hint       string `gorm:"size:16;not null"`
+	Scopes     string `gorm:"size:255;not null"` // comma-separated, sorted
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AuditLog records security-relevant account events. UserID is cleared and
+// Username replaced with a placeholder when the account is purged.
+type AuditLog struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    *uint  `gorm:"index"`
+	Username  string `gorm:"size:255"`
+	Action    string `gorm:"size:64;index;not null"` // e.g. account.delete_requested
+	Detail    string `gorm:"size:1024"`
+	IP        string `gorm:"size:45"` // client address, see TRUSTED_PROXIES
+}
@@ -2,13 +2,88 @@ package models
 
 import "time"
 
+// Where the date of an OCR catatan came from (CatatanKeuangan.DateSource);
+// manual catatan leave it empty.
+const (
+	DateFromReceipt = "receipt" // printed on the receipt
+	DateFromEXIF    = "exif"    // capture time of the photo
+	DateFromUpload  = "upload"  // neither was found; the time of processing
+)
+
 // CatatanKeuangan represents a financial note belonging to a user
 type CatatanKeuangan struct {
 	ID        uint `gorm:"primaryKey"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	UserID    uint      `gorm:"index;not null;uniqueIndex:idx_user_file"`
+	UserID    uint      `gorm:"index;not null;uniqueIndex:idx_user_file;uniqueIndex:idx_user_content_hash;uniqueIndex:idx_user_reference"`
 	FileName  string    `gorm:"size:255;not null;uniqueIndex:idx_user_file"`
 	Amount    int64     `gorm:"not null"`
 	Date      time.Time `gorm:"not null"`
+	// ContentHash is the SHA-256 of the receipt image (NULL for manual entries);
+	// the same image cannot be recorded twice under another name.
+	ContentHash *string `gorm:"size:64;uniqueIndex:idx_user_content_hash"`
+	// Reference is the normalized transaction reference read from the
+	// receipt (RRN, transfer id; see ocr.DetectReference), NULL when none was
+	// found: a re-screenshotted receipt is recognised by it.
+	Reference *string `gorm:"size:64;uniqueIndex:idx_user_reference"`
+	// Suspect marks an OCR amount far outside the user's usual range; it stays
+	// flagged until the owner confirms (or corrects) it.
+	Suspect       bool   `gorm:"default:false;not null;index"`
+	SuspectReason string `gorm:"size:255"`
+	// Pending marks an OCR catatan the uploader asked to review first
+	// (confirm_required); it counts towards no total until confirmed.
+	Pending     bool `gorm:"default:false;not null;index"`
+	ConfirmedAt *time.Time
+	AccountID   *uint  `gorm:"index"` // optional Account the money went to
+	DateSource  string `gorm:"size:8"`
+	// Currency is the ISO 4217 code of Amount; empty means the owner's
+	// preferred currency (Preferences.Currency).
+	Currency string `gorm:"size:3"`
+	// Tax (PPN / PB1) and ServiceCharge are the parts of Amount itemised on
+	// the receipt; 0 when none were detected or entered.
+	Tax           int64 `gorm:"default:0;not null"`
+	ServiceCharge int64 `gorm:"default:0;not null"`
+	// Split marks a receipt divided into line items: catatan whose ParentID
+	// is its id and whose amounts add up to its own. Totals count the items
+	// instead of the receipt.
+	Split       bool   `gorm:"default:false;not null"`
+	ParentID    *uint  `gorm:"index"`
+	Category    string `gorm:"size:64"`
+	Description string `gorm:"size:255"`
+	// Merchant is the shop or payee, as entered by the owner or read from a
+	// QRIS code on the receipt; the line items of a split receipt take the
+	// receipt's.
+	Merchant string `gorm:"size:128"`
+	TenantID uint   `gorm:"index;not null;default:0" json:"-"` // the owner's tenant
+}
+
+// CatatanArchive holds catatan moved out of catatan_keuangans by the archival
+// job. Rows keep their original id; the columns mirror CatatanKeuangan and must
+// be kept in step with it (see pkg/catatanarchive).
+type CatatanArchive struct {
+	ID            uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        uint      `gorm:"index;not null"`
+	FileName      string    `gorm:"size:255;not null"`
+	Amount        int64     `gorm:"not null"`
+	Date          time.Time `gorm:"not null;index"`
+	ContentHash   *string   `gorm:"size:64"`
+	Reference     *string   `gorm:"size:64"`
+	Suspect       bool      `gorm:"default:false;not null"`
+	SuspectReason string    `gorm:"size:255"`
+	Pending       bool      `gorm:"default:false;not null"`
+	ConfirmedAt   *time.Time
+	AccountID     *uint  `gorm:"index"`
+	DateSource    string `gorm:"size:8"`
+	Currency      string `gorm:"size:3"`
+	Tax           int64  `gorm:"default:0;not null"`
+	ServiceCharge int64  `gorm:"default:0;not null"`
+	Split         bool   `gorm:"default:false;not null"`
+	ParentID      *uint  `gorm:"index"`
+	Category      string `gorm:"size:64"`
+	Description   string `gorm:"size:255"`
+	Merchant      string `gorm:"size:128"`
+	TenantID      uint   `gorm:"index;not null;default:0" json:"-"`
+	ArchivedAt    time.Time
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ChatLink connects a chat on a messaging provider (Telegram, WhatsApp) to a user
+// so receipts sent to the bot land in that user's account.
+type ChatLink struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Provider  string `gorm:"size:32;not null;uniqueIndex:idx_chat_links_provider_chat"`
+	ChatID    string `gorm:"size:64;not null;uniqueIndex:idx_chat_links_provider_chat"`
+}
+
+// ChatLinkCode is a short-lived one-time code a user sends to the bot to link a chat.
+type ChatLinkCode struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    uint      `gorm:"index;not null"`
+	Code      string    `gorm:"size:16;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
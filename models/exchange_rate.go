@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ExchangeRate is a cached daily rate: on Day (YYYY-MM-DD) one unit of Base
+// was worth Rate units of Quote, as reported by Source (see pkg/fxrates).
+type ExchangeRate struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Day       string  `gorm:"size:10;not null;uniqueIndex:idx_fx_day_pair"`
+	Base      string  `gorm:"size:3;not null;uniqueIndex:idx_fx_day_pair"`
+	Quote     string  `gorm:"size:3;not null;uniqueIndex:idx_fx_day_pair"`
+	Rate      float64 `gorm:"not null"`
+	Source    string  `gorm:"size:32"`
+}
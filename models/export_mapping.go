@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ExportMapping is a user's configuration of one accounting export format
+// (see pkg/acctexport): account codes and columns, stored as JSON.
+type ExportMapping struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_user_export_format"`
+	Format    string `gorm:"size:16;not null;uniqueIndex:idx_user_export_format"`
+	Config    string `gorm:"type:text;not null"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// FeatureFlag gates a feature per user (see pkg/featureflags). Flags without a
+// row take the default the code declares for them.
+type FeatureFlag struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Key         string `gorm:"size:64;uniqueIndex;not null"`
+	Description string `gorm:"size:255"`
+	// Enabled is the master switch: when false the feature is off for everyone.
+	Enabled bool `gorm:"default:false;not null"`
+	// Percent is the share of users (0-100) the feature is rolled out to.
+	Percent int `gorm:"default:0;not null"`
+	// Users is the comma-separated IDs of users who always get the feature
+	// while it is enabled.
+	Users string `gorm:"size:2048"`
+}
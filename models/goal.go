@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Goal is a savings target. Progress counts the owner's catatan dated from
+// StartsAt onwards, limited to AccountID when one is linked.
+type Goal struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uint      `gorm:"index;not null"`
+	Name         string    `gorm:"size:128;not null"`
+	TargetAmount int64     `gorm:"not null"`
+	StartsAt     time.Time `gorm:"not null"`
+	Deadline     *time.Time
+	AccountID    *uint `gorm:"index"`
+}
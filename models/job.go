@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// JobLock is the lease a server takes before running a scheduled job (see
+// pkg/scheduler), so a job runs on one replica at a time and once per slot.
+// Times are Unix seconds.
+type JobLock struct {
+	Name        string `gorm:"primaryKey;size:64"`
+	Owner       string `gorm:"size:128"`
+	LockedUntil int64  `gorm:"not null;default:0"`
+	// LastSlot is the scheduled time last claimed, so a replica running
+	// late does not repeat a run another already did.
+	LastSlot int64 `gorm:"not null;default:0"`
+}
+
+// JobRun is one execution of a scheduled job.
+type JobRun struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Job         string     `gorm:"size:64;index;not null" json:"job"`
+	Trigger     string     `gorm:"size:16;not null" json:"trigger"` // "schedule" or "manual"
+	Owner       string     `gorm:"size:128" json:"owner"`           // server that ran it
+	TriggeredBy *uint      `json:"triggered_by,omitempty"`          // administrator of a manual run
+	StartedAt   time.Time  `gorm:"index;not null" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Status      string     `gorm:"size:16;not null" json:"status"` // running, succeeded, failed
+	Result      string     `gorm:"size:512" json:"result,omitempty"`
+	Error       string     `gorm:"size:1024" json:"error,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Notification is an in-app message for a user (GET /notifications). Every
+// notification is stored; external channels get one NotificationDelivery each.
+type Notification struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Kind      string `gorm:"size:32;not null;index"`
+	Title     string `gorm:"size:255;not null"`
+	Body      string `gorm:"type:text"`
+	ReadAt    *time.Time
+}
+
+// Delivery statuses.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed" // gave up after the last retry
+)
+
+// NotificationDelivery queues sending a Notification through one channel
+// (email, push, webhook); failed attempts are retried at NextAttemptAt.
+type NotificationDelivery struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	NotificationID uint      `gorm:"index;not null"`
+	UserID         uint      `gorm:"index;not null"`
+	Channel        string    `gorm:"size:16;not null"`
+	Status         string    `gorm:"size:16;not null;index"`
+	Attempts       int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastError      string    `gorm:"size:512"`
+	SentAt         *time.Time
+}
+
+// PushSubscription is a browser Web Push endpoint registered by a user.
+type PushSubscription struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Endpoint  string `gorm:"size:1024;not null;uniqueIndex"`
+	P256dh    string `gorm:"size:255;not null"` // base64url client public key
+	Auth      string `gorm:"size:64;not null"`  // base64url auth secret
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// OCRShadowRun is one receipt read a second time by the candidate pipeline
+// of an OCR experiment (see pkg/ocrexp), next to the primary reading that
+// was applied. FileName is the receipt's disk name, which with ProfileID
+// (read from it, NULL for other names) finds its upload.
+type OCRShadowRun struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	Experiment          string `gorm:"size:64;not null;index"`
+	ProfileID           *uint  `gorm:"index"`
+	FileName            string `gorm:"size:255"`
+	PrimaryAmount       int64
+	PrimaryConfidence   float64
+	CandidateAmount     int64
+	CandidateConfidence float64
+	CandidateHeuristic  string `gorm:"size:16"`
+	CandidateError      string `gorm:"size:255"`
+	CandidateMillis     int64
+	Agree               bool
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Organization groups users whose catatan roll up into shared summaries.
+type Organization struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string `gorm:"size:128;not null"`
+	// Quotas over all members' uploads; 0 means unlimited. OCR jobs are counted
+	// per calendar month (UTC).
+	StorageQuotaBytes int64 `gorm:"default:0;not null"`
+	MonthlyOCRQuota   int   `gorm:"default:0;not null"`
+	// Near-limit warnings already sent: storage until usage falls back below
+	// the threshold, OCR once per month (YYYY-MM).
+	StorageWarned  bool   `gorm:"default:false;not null"`
+	OCRWarnedMonth string `gorm:"size:7"`
+}
+
+// OrgMembership places a user in an organization with one of the roles in
+// pkg/orgs (owner, accountant, member).
+type OrgMembership struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	OrgID     uint   `gorm:"not null;uniqueIndex:idx_org_memberships_org_user"`
+	UserID    uint   `gorm:"not null;index;uniqueIndex:idx_org_memberships_org_user"`
+	Role      string `gorm:"size:16;not null"`
+}
+
+// OrgInvite is an e-mailed invitation to join an organization, or one
+// addressed to an existing account (UserID) by username. Only a hash of the
+// token is stored. An invite is pending until it is accepted, revoked
+// (deleted) or past ExpiresAt.
+type OrgInvite struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	OrgID      uint      `gorm:"index;not null"`
+	Email      string    `gorm:"size:255;not null;index"`
+	Role       string    `gorm:"size:16;not null"`
+	TokenHash  string    `gorm:"size:64;not null;uniqueIndex"`
+	InvitedBy  uint      `gorm:"not null"` // user id of the owner who sent it
+	UserID     *uint     `gorm:"index"`    // the only account that may accept it, when set
+	ExpiresAt  time.Time `gorm:"not null"`
+	AcceptedAt *time.Time
+	AcceptedBy *uint
+}
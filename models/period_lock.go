@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PeriodLock closes one month of a user's books. Catatan dated in
+// [StartsAt, EndsAt) are read-only until an administrator unlocks the period.
+// The bounds are fixed at close time in the user's timezone.
+type PeriodLock struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_period_locks_user_period"`
+	Period    string    `gorm:"size:7;not null;uniqueIndex:idx_period_locks_user_period"` // YYYY-MM
+	StartsAt  time.Time `gorm:"not null"`
+	EndsAt    time.Time `gorm:"not null"`
+	ClosedBy  uint      `gorm:"not null"` // user id of the owner or administrator who closed it
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Preferences holds per-user display and notification settings (one-to-one with User).
+// Users without a row get DefaultPreferences.
+type Preferences struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"uniqueIndex;not null"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Currency  string `gorm:"size:3;not null;default:IDR"`           // ISO 4217 display currency
+	Timezone  string `gorm:"size:64;not null;default:Asia/Jakarta"` // IANA zone used for month boundaries
+	Language  string `gorm:"size:8;not null;default:id"`
+	// ReviewLowConfidence opts the user into reviewing low-confidence OCR results before they count.
+	ReviewLowConfidence bool   `gorm:"default:false;not null"`
+	NotifyEmail         bool   `gorm:"default:false;not null"`
+	NotifyWebhook       bool   `gorm:"default:false;not null"`
+	NotifyPush          bool   `gorm:"default:false;not null"`
+	WebhookURL          string `gorm:"size:512"`
+	// SkipExifLocation stops uploads from reading a position out of photo EXIF.
+	SkipExifLocation bool `gorm:"default:false;not null"`
+}
+
+// DefaultPreferences returns the settings applied when a user has not saved any.
+func DefaultPreferences(userID uint) Preferences {
+	return Preferences{UserID: userID, Currency: "IDR", Timezone: "Asia/Jakarta", Language: "id"}
+}
+
+// Location resolves Timezone, falling back to UTC for unknown zones.
+func (p Preferences) Location() *time.Location {
+	if loc, err := time.LoadLocation(p.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
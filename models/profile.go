@@ -18,6 +18,11 @@ type Profile struct {
 	Email      string `gorm:"size:255"`
 	Phone      string `gorm:"size:64"`
 	Occupation string `gorm:"size:255"`
+	// AvatarFile and LogoFile name the resized images in the profile assets
+	// directory; responses carry their URLs instead.
+	AvatarFile string `gorm:"size:128" json:"-"`
+	LogoFile   string `gorm:"size:128" json:"-"`
 	// Uploads is a one-to-many relation from Profile to Upload
-	Uploads []Upload `gorm:"foreignKey:ProfileID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Uploads  []Upload `gorm:"foreignKey:ProfileID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	TenantID uint     `gorm:"index;not null;default:0" json:"-"` // the user's tenant
 }
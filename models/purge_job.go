@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Purge job states.
+const (
+	PurgePending = "pending"
+	PurgeRunning = "running"
+	PurgeDone    = "done"
+	PurgeFailed  = "failed"
+)
+
+// PurgeJob tracks an account deletion. The user row is gone once the job finishes,
+// so clients poll status with the unguessable Token rather than a session.
+type PurgeJob struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Token        string `gorm:"size:64;uniqueIndex;not null"`
+	UserID       uint   `gorm:"index;not null"` // no FK: the user is deleted by the job
+	RequestedBy  string `gorm:"size:255"`       // "self" or the operator running be03ctl
+	Status       string `gorm:"size:16;index;not null"`
+	Error        string `gorm:"size:1024"`
+	FilesDeleted int
+	FilesMissing int
+	FinishedAt   *time.Time
+}
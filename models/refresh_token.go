@@ -6,9 +6,20 @@ import "time"
 type RefreshToken struct {
 	ID        uint `gorm:"primaryKey"`
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	// UpdatedAt dates the revocation of revoked tokens; with Revoked it
+	// indexes the pruning of dead tokens (pkg/refreshtokens).
+	UpdatedAt time.Time `gorm:"index:idx_refresh_tokens_prune,priority:2"`
 	UserID    uint      `gorm:"index;not null"`
 	TokenHash string    `gorm:"size:128;not null;uniqueIndex"`
 	ExpiresAt time.Time `gorm:"index;not null"`
-	Revoked   bool      `gorm:"default:false"`
+	Revoked   bool      `gorm:"default:false;index:idx_refresh_tokens_prune,priority:1"`
+	// DeviceName is the User-Agent at login, shown in the sessions list.
+	DeviceName string `gorm:"size:255"`
+	LastUsedAt *time.Time
+	// RememberMe tokens come from a "remember me" login: each refresh extends
+	// them up to MaxExpiresAt, and only the device whose fingerprint hashes to
+	// DeviceHash may use them.
+	RememberMe   bool   `gorm:"default:false;not null"`
+	DeviceHash   string `gorm:"size:64"`
+	MaxExpiresAt *time.Time
 }
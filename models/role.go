@@ -9,4 +9,10 @@ type Role struct {
 	UpdatedAt   time.Time
 	Name        string `gorm:"size:32;uniqueIndex;not null"`
 	Description string `gorm:"size:255"`
+	// Permissions is the comma-separated permission set of a custom role (see
+	// pkg/roles); the built-in administrator and user roles hold them all.
+	Permissions string `gorm:"size:512"`
+	// Per-role limits; 0 means unlimited.
+	UploadsPerDay int `gorm:"default:0;not null"`
+	MaxProfiles   int `gorm:"default:0;not null"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SavedView is a named set of catatan filters a user applies by id (?view=)
+// on catatan lists, exports and reports; Filters holds them as JSON (see
+// pkg/savedviews).
+type SavedView struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_user_view_name"`
+	Name      string `gorm:"size:128;not null;uniqueIndex:idx_user_view_name"`
+	Filters   string `gorm:"type:text;not null"`
+}
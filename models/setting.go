@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Setting is a runtime switch shared by the API servers and the watcher, keyed
+// by name with a JSON value.
+type Setting struct {
+	Key       string `gorm:"primaryKey;size:64"`
+	Value     string `gorm:"type:text"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Tenant is one business served by a multi-tenant deployment (MULTI_TENANT,
+// see pkg/tenancy). Rows of users, profiles, uploads and catatan carry its id;
+// tenant 0 is the implicit default tenant and has no row.
+type Tenant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Slug is the subdomain (acme.example.com) or X-Tenant header naming it.
+	Slug string `gorm:"size:63;uniqueIndex;not null" json:"slug"`
+	Name string `gorm:"size:255;not null" json:"name"`
+	// Branding shown by the frontend (GET /tenant).
+	LogoURL      string `gorm:"size:512" json:"logo_url"`
+	PrimaryColor string `gorm:"size:7" json:"primary_color"` // #rrggbb
+	// Limits; 0 means unlimited.
+	MaxUsers           int `gorm:"not null;default:0" json:"max_users"`
+	MaxUploadsPerMonth int `gorm:"not null;default:0" json:"max_uploads_per_month"`
+	// DisabledAt is set while the tenant is suspended: its requests are refused.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
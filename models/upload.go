@@ -10,7 +10,7 @@ type Upload struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	FileName    string  `gorm:"size:255;not null"`
-	StorePath   string  `gorm:"column:store_path;size:512"` // public relative path (e.g. public/keu/xxx.jpg)
+	StorePath   string  `gorm:"column:store_path;size:512"` // public relative path (e.g. public/keu/12_xxx.jpg, see storagepath.DiskName)
 	ProfileID   uint    `gorm:"index;not null"`             // FK to profiles.id (profile_id)
 	Profile     Profile `gorm:"foreignKey:ProfileID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	ContentType string  `gorm:"size:128"`
@@ -18,4 +18,79 @@ type Upload struct {
 	// Mark upload as failed for OCR processing (do not delete record so front-end/admin can review)
 	Failed       bool   `gorm:"default:false;index"`
 	FailedReason string `gorm:"size:255"`
+	// SizeBytes, OCRConfidence and ProcessedAt feed the admin analytics; rows
+	// uploaded before they existed keep zero / NULL.
+	SizeBytes     int64 `gorm:"not null;default:0"`
+	OCRConfidence *float64
+	ProcessedAt   *time.Time
+	// OCRHeuristic and OCRRawConfidence are the extraction path and its
+	// uncalibrated score behind OCRConfidence, the inputs of the confidence
+	// calibration (see pkg/ocrcalib).
+	OCRHeuristic     string `gorm:"size:16"`
+	OCRRawConfidence *float64
+	// Reference is the transaction reference OCR read (see
+	// ocr.DetectReference), normalized; empty when none was found.
+	Reference string `gorm:"size:64;index"`
+	// Where the receipt was captured, sent by the client or read from the
+	// photo's EXIF GPS tags (LocationSource "client" or "exif").
+	Latitude       *float64
+	Longitude      *float64
+	LocationSource string `gorm:"size:8"`
+	// CapturedAt is the photo's EXIF capture time, kept here because the
+	// stored image is stripped of its EXIF.
+	CapturedAt *time.Time
+	// PHash is the perceptual hash of the image (see pkg/phash), stored as the
+	// signed bit pattern; NULL when the image could not be decoded.
+	PHash *int64
+	// OriginalPath keeps the image as received when the processed copy had to
+	// be re-encoded to fit the size budget (KEEP_ORIGINALS); empty otherwise.
+	OriginalPath      string `gorm:"size:512"`
+	OriginalSizeBytes int64  `gorm:"not null;default:0"`
+	TenantID          uint   `gorm:"index;not null;default:0" json:"-"` // the uploader's tenant
+}
+
+// UploadPHashBand indexes one 8-bit band of an upload's PHash. Uploads that
+// share a band are the candidates of a near-duplicate lookup.
+type UploadPHashBand struct {
+	UploadID uint  `gorm:"primaryKey;autoIncrement:false"`
+	Band     uint8 `gorm:"primaryKey;autoIncrement:false;index:idx_upload_phash_bands_value,priority:1"`
+	Value    uint8 `gorm:"not null;index:idx_upload_phash_bands_value,priority:2"`
+}
+
+// UploadOCRText keeps the normalized aggregate OCR text of an upload,
+// gzip-compressed, so heuristics can be re-run and support can see what
+// tesseract read without OCRing the image again. One row per upload; a
+// reprocess overwrites it.
+type UploadOCRText struct {
+	UploadID  uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Text      []byte // gzip
+	Length    int    `gorm:"not null;default:0"` // uncompressed bytes
+}
+
+// UploadItem is a purchased line OCR read from an upload's receipt, kept when
+// OCR_ITEMIZED is "store" (see pkg/ocrtext).
+type UploadItem struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UploadID  uint   `gorm:"index;not null"`
+	Line      int    `gorm:"not null"` // position on the receipt, from 1
+	Name      string `gorm:"size:255;not null"`
+	Qty       int    `gorm:"not null"`
+	UnitPrice int64  `gorm:"not null"`
+	Price     int64  `gorm:"not null"`
+}
+
+// UploadNote is a support note on an upload, e.g. "blurred, asked the user to
+// re-upload", written by an administrator or the uploader. Username is the
+// author's at the time of writing.
+type UploadNote struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UploadID  uint   `gorm:"index;not null"`
+	UserID    uint   `gorm:"not null"`
+	Username  string `gorm:"size:64"`
+	Body      string `gorm:"size:1000;not null"`
+	TenantID  uint   `gorm:"index;not null;default:0" json:"-"` // the upload's tenant
 }
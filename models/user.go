@@ -15,5 +15,14 @@ type User struct {
 	Catatan        []CatatanKeuangan
 	Profile        *Profile `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	RoleID         *uint    `gorm:"index"`
-	Role           Role     `gorm:"foreignKey:RoleID;references:ID"`
+	// TokenVersion is embedded in access tokens; bumping it (password reset)
+	// rejects every token issued before.
+	TokenVersion uint `gorm:"not null;default:0"`
+	// DisabledAt is set while an administrator has deactivated the account;
+	// its data is kept but it can neither log in nor use existing tokens.
+	DisabledAt *time.Time
+	Role       Role `gorm:"foreignKey:RoleID;references:ID"`
+	// TenantID is the Tenant the account belongs to (0: the default tenant).
+	// Usernames stay unique across tenants.
+	TenantID uint `gorm:"index;not null;default:0" json:"-"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UsernameHistory records one rename of a user, so tokens, audit rows and
+// reports that still carry the old name can be traced to the account.
+type UsernameHistory struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uint      `gorm:"index;not null"`
+	OldUsername string    `gorm:"size:255;index;not null"`
+	NewUsername string    `gorm:"size:255;not null"`
+	ChangedAt   time.Time `gorm:"index;not null"`
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/hooks"
+	"be03/pkg/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- notifications --------------------
+
+// webPush is the push channel; nil unless VAPID_PRIVATE_KEY is set.
+var webPush *notify.WebPush
+
+// mailer sends e-mail to addresses that need not belong to a user (invites);
+// nil unless SMTP_ADDR is set.
+var mailer notify.Channel
+
+// startNotifier delivers queued notifications through the channels configured
+// in the environment: SMTP_ADDR (email), VAPID_PRIVATE_KEY + VAPID_SUBJECT
+// (web push) and the always-available webhook channel, signed with
+// NOTIFY_WEBHOOK_SECRET when set.
+func startNotifier() {
+	channels := map[string]notify.Channel{
+		notify.ChannelWebhook: &notify.Webhook{Secret: os.Getenv("NOTIFY_WEBHOOK_SECRET")},
+	}
+	if s, ok := notify.SMTPFromEnv(); ok {
+		channels[notify.ChannelEmail] = s
+		mailer = s
+	}
+	if key := os.Getenv("VAPID_PRIVATE_KEY"); key != "" {
+		wp, err := notify.NewWebPush(key, os.Getenv("VAPID_SUBJECT"))
+		if err != nil {
+			log.Printf("notify: web push disabled: %v", err)
+		} else {
+			wp.OnGone = func(endpoint string) {
+				db.Where("endpoint = ?", endpoint).Delete(&models.PushSubscription{})
+			}
+			webPush = wp
+			channels[notify.ChannelPush] = wp
+		}
+	}
+	d := &notify.Dispatcher{DB: db, Channels: channels}
+	go d.Run(context.Background(), 30*time.Second)
+}
+
+// startEventWebhook sends upload, amount and catatan events to
+// HOOKS_WEBHOOK_URL, signed with HOOKS_WEBHOOK_SECRET, when it is set.
+func startEventWebhook() {
+	if w, ok := hooks.WebhookFromEnv(); ok {
+		w.Start()
+		log.Printf("hooks: event webhook enabled")
+	}
+}
+
+// notifyUser queues a notification; failures are logged, never surfaced to the
+// request that triggered them.
+func notifyUser(userID uint, kind string, data map[string]any) {
+	if _, err := notify.Notify(db, userID, kind, data); err != nil {
+		log.Printf("notify: %s for user=%d: %v", kind, userID, err)
+	}
+}
+
+type notificationView struct {
+	ID        uint       `json:"id"`
+	Kind      string     `json:"kind"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// listNotificationsHandler lists the caller's in-app notifications, newest
+// first; ?unread=true limits to unread ones and limit caps the page (max 200).
+func listNotificationsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			writeError(c, apierr.InvalidBody, "limit must be between 1 and 200", gin.H{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	q := db.Where("user_id = ?", user.ID)
+	if c.Query("unread") == "true" {
+		q = q.Where("read_at IS NULL")
+	}
+	var list []models.Notification
+	if err := q.Order("id desc").Limit(limit).Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	var unread int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Count(&unread)
+	out := make([]notificationView, 0, len(list))
+	for _, n := range list {
+		out = append(out, notificationView{ID: n.ID, Kind: n.Kind, Title: n.Title, Body: n.Body, CreatedAt: n.CreatedAt, ReadAt: n.ReadAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": out, "unread": unread})
+}
+
+// markNotificationReadHandler marks one notification read; id "all" marks every
+// unread notification of the caller.
+func markNotificationReadHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	q := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID)
+	if id := c.Param("id"); id != "all" {
+		var n models.Notification
+		if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&n).Error; err != nil {
+			writeError(c, apierr.NotFound, "", nil)
+			return
+		}
+		q = q.Where("id = ?", n.ID)
+	}
+	res := q.Update("read_at", time.Now())
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"marked": res.RowsAffected})
+}
+
+// pushKeyHandler returns the VAPID public key browsers subscribe with.
+func pushKeyHandler(c *gin.Context) {
+	if webPush == nil {
+		writeError(c, apierr.NotFound, "web push is not configured", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"public_key": webPush.PublicKey()})
+}
+
+// createPushSubscriptionHandler stores a PushSubscription.toJSON() body; the
+// caller's subscription for the same endpoint gets the new keys. An endpoint
+// registered by another user is a conflict.
+func createPushSubscriptionHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Endpoint string `json:"endpoint" binding:"required"`
+		Keys     struct {
+			P256dh string `json:"p256dh" binding:"required"`
+			Auth   string `json:"auth" binding:"required"`
+		} `json:"keys"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if err := notify.CheckWebhookURL(req.Endpoint); err != nil {
+		writeError(c, apierr.InvalidBody, "endpoint must be an https URL on a public host", gin.H{"field": "endpoint"})
+		return
+	}
+	var sub models.PushSubscription
+	if err := db.Where("user_id = ? AND endpoint = ?", user.ID, req.Endpoint).First(&sub).Error; err != nil {
+		var taken int64
+		db.Model(&models.PushSubscription{}).Where("endpoint = ?", req.Endpoint).Count(&taken)
+		if taken > 0 {
+			writeError(c, apierr.Duplicate, "endpoint is registered by another user", gin.H{"field": "endpoint"})
+			return
+		}
+	}
+	sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth = user.ID, req.Endpoint, req.Keys.P256dh, req.Keys.Auth
+	if err := db.Save(&sub).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": sub.ID})
+}
+
+// deletePushSubscriptionHandler removes the caller's subscription for ?endpoint=.
+func deletePushSubscriptionHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Where("user_id = ? AND endpoint = ?", user.ID, c.Query("endpoint")).Delete(&models.PushSubscription{})
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrcalib"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- OCR confidence calibration --------------------
+
+// recordOCRReview records the first confirmation of a catatan read from a
+// receipt: whether the user kept ocrAmount, the amount it had before, is
+// what the confidence calibration learns from (see pkg/ocrcalib).
+// Catatan without an OCR reading, or read before heuristics were recorded,
+// are skipped.
+func recordOCRReview(c *gin.Context, ct models.CatatanKeuangan, ocrAmount int64) {
+	if ocrAmount <= 0 {
+		return
+	}
+	var up models.Upload
+	if err := db.Where("keuangan_id = ? AND ocr_heuristic <> ''", ct.ID).Order("id").First(&up).Error; err != nil || up.OCRRawConfidence == nil {
+		return
+	}
+	recordAudit(c, ocrcalib.ReviewAction, ocrcalib.Review{
+		CatatanID: ct.ID, UploadID: up.ID, Heuristic: up.OCRHeuristic, RawConfidence: *up.OCRRawConfidence,
+		OCRAmount: ocrAmount, Amount: ct.Amount, Corrected: ct.Amount != ocrAmount,
+	})
+}
+
+// getOCRCalibrationHandler returns the stored calibration (null before the
+// first fit) and how many reviews a refit would learn from.
+func getOCRCalibrationHandler(c *gin.Context) {
+	cal, err := ocrcalib.Load(db)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	var reviews int64
+	db.Model(&models.AuditLog{}).Where("action = ?", ocrcalib.ReviewAction).Count(&reviews)
+	c.JSON(http.StatusOK, gin.H{"calibration": cal, "reviews": reviews, "min_samples": ocr.MinCalibrationSamples})
+}
+
+// refitOCRCalibrationHandler fits the calibration to the reviews recorded
+// since {since} (YYYY-MM-DD, default all) with {bins} confidence bins
+// (default 10). A dry run only reports the fit; otherwise it is stored and
+// servers and the watcher switch to it within a minute. calibrated lists the
+// heuristics with enough reviews to be calibrated; brier compares the raw and
+// calibrated confidence on the same reviews.
+func refitOCRCalibrationHandler(c *gin.Context) {
+	var req struct {
+		Since  string `json:"since"`
+		Bins   int    `json:"bins"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), nil)
+			return
+		}
+	}
+	if req.Bins < 0 || req.Bins > 100 {
+		writeError(c, apierr.InvalidBody, "bins must be between 1 and 100", gin.H{"field": "bins"})
+		return
+	}
+	var since *time.Time
+	if req.Since != "" {
+		t, err := time.Parse("2006-01-02", req.Since)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, "since must be YYYY-MM-DD", gin.H{"field": "since"})
+			return
+		}
+		since = &t
+	}
+	samples, err := ocrcalib.Samples(db, since)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	cal := ocr.Fit(samples, req.Bins)
+	if !req.DryRun {
+		if err := ocrcalib.Save(db, cal); err != nil {
+			writeError(c, apierr.CreateFailed, "", nil)
+			return
+		}
+		ocr.SetCalibration(cal)
+		recordAudit(c, "ocr.calibration_refit", gin.H{"samples": cal.Samples, "since": req.Since, "bins": req.Bins})
+	}
+	raw, calibrated := cal.Brier(samples)
+	c.JSON(http.StatusOK, gin.H{
+		"calibration": cal, "dry_run": req.DryRun, "calibrated": cal.Calibrated(),
+		"brier": gin.H{"raw": raw, "calibrated": calibrated},
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"be03/pkg/apierr"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- OCR experiments --------------------
+
+// getOCRExperimentHandler returns the running experiment (null when none),
+// the production pipeline options and the summary of the running
+// experiment, or of the finished one named by ?name=.
+func getOCRExperimentHandler(c *gin.Context) {
+	e, err := ocrexp.Load(db)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	opts, err := ocrexp.LoadOptions(db)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := gin.H{"experiment": e, "options": opts, "shadow": ocrexp.CurrentStats()}
+	name := c.Query("name")
+	if name == "" && e != nil {
+		name = e.Name
+	}
+	if name != "" {
+		s, err := ocrexp.Summarize(db, name)
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		out["summary"] = s
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// startOCRExperimentHandler starts {name, percent, candidate} in shadow
+// mode, replacing the running experiment: percent of the receipts are read
+// again with the candidate options and both readings recorded, while only
+// the production one is applied. Servers and the watcher pick it up within
+// seconds.
+func startOCRExperimentHandler(c *gin.Context) {
+	var req struct {
+		Name      string      `json:"name"`
+		Percent   int         `json:"percent"`
+		Candidate ocr.Options `json:"candidate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	e := ocrexp.Experiment{Name: req.Name, Percent: req.Percent, Candidate: req.Candidate}
+	if user, ok := getUserFromContext(c); ok {
+		e.By = user.Username
+	}
+	started, err := ocrexp.Start(db, e)
+	if errors.Is(err, ocrexp.ErrInvalid) {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "ocr.experiment_start", started)
+	c.JSON(http.StatusOK, started)
+}
+
+// stopOCRExperimentHandler ends the running experiment; its runs are kept.
+func stopOCRExperimentHandler(c *gin.Context) {
+	if err := ocrexp.Stop(db); err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	recordAudit(c, "ocr.experiment_stop", nil)
+	c.Status(http.StatusNoContent)
+}
+
+// promoteOCRExperimentHandler makes the candidate of the running experiment
+// the production pipeline configuration and ends the experiment.
+func promoteOCRExperimentHandler(c *gin.Context) {
+	e, err := ocrexp.Promote(db)
+	if errors.Is(err, ocrexp.ErrNoExperiment) {
+		writeError(c, apierr.NotFound, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "ocr.experiment_promote", gin.H{"name": e.Name, "options": e.Candidate})
+	c.JSON(http.StatusOK, gin.H{"promoted": e.Name, "options": e.Candidate})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- onboarding --------------------
+
+// onboardingStep is one item of the setup checklist. Missing, At and
+// Channels carry what the frontend needs to word the step.
+type onboardingStep struct {
+	Key      string     `json:"key"`
+	Done     bool       `json:"done"`
+	Missing  []string   `json:"missing,omitempty"`  // profile fields still empty
+	At       *time.Time `json:"at,omitempty"`       // when the step was first done
+	Channels []string   `json:"channels,omitempty"` // notification channels that reach the user
+}
+
+// onboardingHandler reports the caller's setup checklist, computed from their
+// data: a profile with name, email and phone, a first upload, a first
+// confirmed catatan and a notification channel that can reach them.
+func onboardingHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	steps, err := onboardingSteps(user.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	completed := 0
+	for _, s := range steps {
+		if s.Done {
+			completed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"steps": steps, "completed": completed, "total": len(steps), "done": completed == len(steps)})
+}
+
+func onboardingSteps(userID uint) ([]onboardingStep, error) {
+	profile := onboardingStep{Key: "profile"}
+	var p models.Profile
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&p).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range []struct{ name, value string }{{"name", p.Name}, {"email", p.Email}, {"phone", p.Phone}} {
+		if f.value == "" {
+			profile.Missing = append(profile.Missing, f.name)
+		}
+	}
+	profile.Done = p.ID != 0 && len(profile.Missing) == 0
+
+	upload := onboardingStep{Key: "first_upload"}
+	var first models.Upload
+	if p.ID != 0 {
+		if err := db.Where("profile_id = ?", p.ID).Order("created_at").Limit(1).Find(&first).Error; err != nil {
+			return nil, err
+		}
+	}
+	if first.ID != 0 {
+		upload.Done, upload.At = true, &first.CreatedAt
+	}
+
+	confirmed := onboardingStep{Key: "first_confirmed_catatan"}
+	var ids []uint
+	// archived catatan count too: an old account may have only those
+	if err := catatanarchive.Catatan(db, nil).Where("user_id = ? AND pending = ? AND amount <> 0", userID, false).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	confirmed.Done = len(ids) > 0
+
+	channel := onboardingStep{Key: "notification_channel"}
+	chs, err := notify.Reachable(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	channel.Done, channel.Channels = len(chs) > 0, chs
+
+	return []onboardingStep{profile, upload, confirmed, channel}, nil
+}
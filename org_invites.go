@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/notify"
+	"be03/pkg/orgs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- organization invites --------------------
+
+// inviteTTL is how long an invite stays valid (ORG_INVITE_TTL_HOURS, default 7 days).
+func inviteTTL() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("ORG_INVITE_TTL_HOURS")); err == nil && n > 0 {
+		return time.Duration(n) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+type inviteView struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	UserID    *uint     `json:"user_id,omitempty"` // invited by username
+	Status    string    `json:"status"`            // pending or expired
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func viewInvite(inv models.OrgInvite) inviteView {
+	status := "pending"
+	if !time.Now().Before(inv.ExpiresAt) {
+		status = "expired"
+	}
+	return inviteView{ID: inv.ID, Email: inv.Email, Role: inv.Role, UserID: inv.UserID, Status: status, CreatedAt: inv.CreatedAt, ExpiresAt: inv.ExpiresAt}
+}
+
+// loadOrgAsOwner is loadOrg limited to owners, who manage invites.
+func loadOrgAsOwner(c *gin.Context) (models.User, models.Organization, bool) {
+	user, org, m, ok := loadOrg(c)
+	if !ok {
+		return user, org, false
+	}
+	if m.Role != orgs.Owner {
+		writeError(c, apierr.Forbidden, "only owners can manage invites", nil)
+		return user, org, false
+	}
+	return user, org, true
+}
+
+// sendInvite e-mails raw to inv.Email in the inviter's language. It reports
+// false when no mailer is configured or delivery failed; the caller then hands
+// the token to the owner to share.
+func sendInvite(inviter models.User, org models.Organization, inv models.OrgInvite, raw string) bool {
+	if mailer == nil {
+		return false
+	}
+	prefs := loadPreferences(inviter.ID)
+	data := map[string]any{
+		"Org": org.Name, "Inviter": inviter.Username, "Role": inv.Role, "Token": raw,
+		"Expires": inv.ExpiresAt.In(prefs.Location()).Format("2006-01-02 15:04 MST"),
+	}
+	if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+		data["URL"] = base + "/invites/" + raw
+	}
+	title, body, err := notify.Render(notify.KindOrgInvite, prefs.Language, data)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		err = mailer.Send(ctx, notify.Recipient{Email: inv.Email}, notify.Message{Kind: notify.KindOrgInvite, Title: title, Body: body, CreatedAt: time.Now()})
+	}
+	if err != nil {
+		log.Printf("org invite %d: send to %s failed: %v", inv.ID, inv.Email, err)
+		return false
+	}
+	return true
+}
+
+// inviteResponse is the body of a created or re-sent invite. The token is only
+// returned when it could not be e-mailed.
+func inviteResponse(inv models.OrgInvite, raw string, sent bool) gin.H {
+	out := gin.H{"invite": viewInvite(inv), "email_sent": sent}
+	if !sent {
+		out["token"] = raw
+	}
+	return out
+}
+
+// createOrgInviteHandler invites an e-mail address into the organization with
+// a role; owners only.
+func createOrgInviteHandler(c *gin.Context) {
+	user, org, ok := loadOrgAsOwner(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		writeError(c, apierr.InvalidBody, "email is not a valid address", gin.H{"field": "email"})
+		return
+	}
+	email := strings.ToLower(addr.Address)
+	if req.Role == "" {
+		req.Role = orgs.Member
+	}
+	if !orgs.ValidRole(req.Role) {
+		writeError(c, apierr.InvalidBody, "unknown role", gin.H{"field": "role", "allowed": []string{orgs.Owner, orgs.Accountant, orgs.Member}})
+		return
+	}
+	var pending models.OrgInvite
+	if err := reqDB(c).Where("org_id = ? AND email = ? AND accepted_at IS NULL AND expires_at > ?", org.ID, email, time.Now().UTC()).
+		First(&pending).Error; err == nil {
+		writeError(c, apierr.Duplicate, "an invite for this address is pending, resend it instead", gin.H{"invite_id": pending.ID})
+		return
+	}
+	raw, hash := orgs.NewInviteToken()
+	inv := models.OrgInvite{OrgID: org.ID, Email: email, Role: req.Role, TokenHash: hash, InvitedBy: user.ID, ExpiresAt: time.Now().Add(inviteTTL())}
+	if err := reqDB(c).Create(&inv).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	sent := sendInvite(user, org, inv, raw)
+	recordAudit(c, "org.invite.create", gin.H{"org_id": org.ID, "invite_id": inv.ID, "email": email, "role": inv.Role, "email_sent": sent})
+	c.JSON(http.StatusCreated, inviteResponse(inv, raw, sent))
+}
+
+// listOrgInvitesHandler lists the organization's unused invites, expired ones
+// included so they can be re-sent; owners only.
+func listOrgInvitesHandler(c *gin.Context) {
+	_, org, ok := loadOrgAsOwner(c)
+	if !ok {
+		return
+	}
+	var rows []models.OrgInvite
+	if err := reqDB(c).Where("org_id = ? AND accepted_at IS NULL", org.ID).Order("id desc").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]inviteView, 0, len(rows))
+	for _, inv := range rows {
+		out = append(out, viewInvite(inv))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// loadOrgInvite resolves :invite_id to an unused invite of org.
+func loadOrgInvite(c *gin.Context, org models.Organization) (models.OrgInvite, bool) {
+	var inv models.OrgInvite
+	if err := reqDB(c).Where("id = ? AND org_id = ? AND accepted_at IS NULL", c.Param("invite_id"), org.ID).First(&inv).Error; err != nil {
+		writeError(c, apierr.NotFound, "invite not found", nil)
+		return inv, false
+	}
+	return inv, true
+}
+
+// resendOrgInviteHandler issues a fresh token and expiry for an invite and
+// e-mails it again; the previous token stops working.
+func resendOrgInviteHandler(c *gin.Context) {
+	user, org, ok := loadOrgAsOwner(c)
+	if !ok {
+		return
+	}
+	inv, ok := loadOrgInvite(c, org)
+	if !ok {
+		return
+	}
+	raw, hash := orgs.NewInviteToken()
+	inv.TokenHash, inv.ExpiresAt = hash, time.Now().Add(inviteTTL())
+	if err := reqDB(c).Save(&inv).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	sent := sendInvite(user, org, inv, raw)
+	recordAudit(c, "org.invite.resend", gin.H{"org_id": org.ID, "invite_id": inv.ID, "email_sent": sent})
+	c.JSON(http.StatusOK, inviteResponse(inv, raw, sent))
+}
+
+// revokeOrgInviteHandler withdraws an unused invite.
+func revokeOrgInviteHandler(c *gin.Context) {
+	_, org, ok := loadOrgAsOwner(c)
+	if !ok {
+		return
+	}
+	inv, ok := loadOrgInvite(c, org)
+	if !ok {
+		return
+	}
+	if err := reqDB(c).Delete(&inv).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	recordAudit(c, "org.invite.revoke", gin.H{"org_id": org.ID, "invite_id": inv.ID, "email": inv.Email})
+	c.Status(http.StatusNoContent)
+}
+
+// getInviteHandler shows what an invite token is for, so the accept page can
+// name the organization before the user signs in or up.
+func getInviteHandler(c *gin.Context) {
+	inv, err := orgs.FindInvite(reqDB(c), c.Param("token"), time.Now())
+	if err != nil {
+		writeError(c, apierr.NotFound, orgs.ErrInviteInvalid.Error(), nil)
+		return
+	}
+	var org models.Organization
+	reqDB(c).First(&org, inv.OrgID)
+	var inviter models.User
+	reqDB(c).First(&inviter, inv.InvitedBy)
+	c.JSON(http.StatusOK, gin.H{"org": gin.H{"id": org.ID, "name": org.Name}, "email": inv.Email, "role": inv.Role,
+		"invited_by": inviter.Username, "expires_at": inv.ExpiresAt})
+}
+
+// acceptInviteHandler joins the organization of an invite. With the username
+// and password of an existing account it links that user; with an unused
+// username it creates the account (profile e-mail set to the invited address)
+// first, unless the invite is addressed to an account. Sign in afterwards as
+// usual. Disabled accounts are turned away as at login.
+func acceptInviteHandler(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	err := c.ShouldBindJSON(&req)
+	req.Username = strings.TrimSpace(req.Username)
+	if err != nil || req.Username == "" {
+		writeError(c, apierr.InvalidBody, "username and password are required", nil)
+		return
+	}
+	now := time.Now()
+	inv, err := orgs.FindInvite(reqDB(c), c.Param("token"), now)
+	if err != nil {
+		writeError(c, apierr.NotFound, orgs.ErrInviteInvalid.Error(), nil)
+		return
+	}
+	var user models.User
+	created := false
+	// usernames are unique across tenants; wrongTenant turns away other tenants' accounts
+	err = db.Where("username = ?", req.Username).First(&user).Error
+	switch {
+	case err == nil:
+		// the same checks as login, this being another way to prove a password
+		if !checkPassword(user.HashedPassword, req.Password) || wrongTenant(c, user) {
+			writeError(c, apierr.InvalidCredentials, "", nil)
+			return
+		}
+		if user.DisabledAt != nil {
+			writeError(c, apierr.AccountDisabled, "", nil)
+			return
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound) && inv.UserID == nil:
+		if len(req.Password) < 6 {
+			writeError(c, apierr.InvalidBody, "password too short (min 6)", gin.H{"field": "password"})
+			return
+		}
+		if !checkTenantUserLimit(c) {
+			return
+		}
+		hpw, _ := hashPassword(req.Password)
+		var role models.Role
+		reqDB(c).Where("name = ?", "user").First(&role)
+		rid := role.ID
+		user = models.User{Username: req.Username, HashedPassword: hpw, RoleID: &rid, TenantID: currentTenant(c).ID}
+		if err := reqDB(c).Create(&user).Error; err != nil {
+			writeError(c, apierr.CreateFailed, "", nil)
+			return
+		}
+		_ = reqDB(c).Create(&models.Profile{UserID: user.ID, Name: user.Username, Email: inv.Email, TenantID: user.TenantID}).Error
+		created = true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(c, apierr.InvalidCredentials, "", nil)
+		return
+	default:
+		if authLookupFailed(c, err) {
+			return
+		}
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	m, err := orgs.Accept(reqDB(c), inv, user.ID, now)
+	if errors.Is(err, orgs.ErrInviteInvalid) {
+		writeError(c, apierr.NotFound, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.Set("user", user)
+	recordAudit(c, "org.invite.accept", gin.H{"org_id": inv.OrgID, "invite_id": inv.ID, "user_id": user.ID, "created": created})
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"org_id": m.OrgID, "role": m.Role, "user_id": user.ID, "username": user.Username, "created": created})
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/notify"
+	"be03/pkg/orgs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- organizations --------------------
+
+type orgMemberView struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type orgView struct {
+	ID        uint            `json:"id"`
+	Name      string          `json:"name"`
+	CreatedAt time.Time       `json:"created_at"`
+	Role      string          `json:"role"` // the caller's role
+	Members   []orgMemberView `json:"members,omitempty"`
+}
+
+// orgMembers lists the members of orgID, owners first.
+func orgMembers(gdb *gorm.DB, orgID uint) ([]orgMemberView, error) {
+	var rows []orgMemberView
+	err := gdb.Table("org_memberships").
+		Select("org_memberships.user_id, users.username, org_memberships.role, org_memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.id = org_memberships.user_id").
+		Where("org_memberships.org_id = ?", orgID).
+		Order("CASE org_memberships.role WHEN 'owner' THEN 0 WHEN 'accountant' THEN 1 ELSE 2 END, users.username").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// loadOrg resolves :id to an organization the caller belongs to. Non-members
+// get not_found so organization ids cannot be probed.
+func loadOrg(c *gin.Context) (models.User, models.Organization, models.OrgMembership, bool) {
+	var org models.Organization
+	var m models.OrgMembership
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return user, org, m, false
+	}
+	if err := reqDB(c).First(&org, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return user, org, m, false
+	}
+	m, err := orgs.Membership(reqDB(c), org.ID, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(c, apierr.NotFound, "", nil)
+		return user, org, m, false
+	}
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return user, org, m, false
+	}
+	return user, org, m, true
+}
+
+// orgName validates an organization name.
+func orgName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 128 {
+		writeError(c, apierr.InvalidBody, "name must be 1-128 characters", gin.H{"field": "name"})
+		return "", false
+	}
+	return name, true
+}
+
+// createOrgHandler creates an organization with the caller as its owner.
+func createOrgHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	name, ok := orgName(c, req.Name)
+	if !ok {
+		return
+	}
+	org := models.Organization{Name: name}
+	err := reqDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgMembership{OrgID: org.ID, UserID: user.ID, Role: orgs.Owner}).Error
+	})
+	if err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "org.create", gin.H{"id": org.ID, "name": org.Name})
+	c.JSON(http.StatusCreated, orgView{ID: org.ID, Name: org.Name, CreatedAt: org.CreatedAt, Role: orgs.Owner})
+}
+
+// listOrgsHandler lists the organizations the caller belongs to.
+func listOrgsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var rows []orgView
+	if err := reqDB(c).Table("organizations").
+		Select("organizations.id, organizations.name, organizations.created_at, org_memberships.role").
+		Joins("JOIN org_memberships ON org_memberships.org_id = organizations.id").
+		Where("org_memberships.user_id = ?", user.ID).Order("organizations.id").Scan(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if rows == nil {
+		rows = []orgView{}
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// getOrgHandler returns an organization with its members.
+func getOrgHandler(c *gin.Context) {
+	_, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	members, err := orgMembers(reqDB(c), org.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, orgView{ID: org.ID, Name: org.Name, CreatedAt: org.CreatedAt, Role: m.Role, Members: members})
+}
+
+// renameOrgHandler changes an organization's name; owners only.
+func renameOrgHandler(c *gin.Context) {
+	_, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	if m.Role != orgs.Owner {
+		writeError(c, apierr.Forbidden, "only owners can rename the organization", nil)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	name, ok := orgName(c, req.Name)
+	if !ok {
+		return
+	}
+	if err := reqDB(c).Model(&org).Update("name", name).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "org.rename", gin.H{"id": org.ID, "name": name})
+	c.JSON(http.StatusOK, orgView{ID: org.ID, Name: name, CreatedAt: org.CreatedAt, Role: m.Role})
+}
+
+// addOrgMemberHandler invites an existing user into the organization by
+// username; owners only. Members see each other's catatan, so nobody joins
+// without consent: the user is notified of the invite and accepts it like an
+// e-mailed one, with their own credentials.
+func addOrgMemberHandler(c *gin.Context) {
+	user, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	if m.Role != orgs.Owner {
+		writeError(c, apierr.Forbidden, "only owners can add members", nil)
+		return
+	}
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if req.Role == "" {
+		req.Role = orgs.Member
+	}
+	if !orgs.ValidRole(req.Role) {
+		writeError(c, apierr.InvalidBody, "unknown role", gin.H{"field": "role", "allowed": []string{orgs.Owner, orgs.Accountant, orgs.Member}})
+		return
+	}
+	var u models.User
+	if err := reqDB(c).Where("username = ?", req.Username).First(&u).Error; err != nil {
+		writeError(c, apierr.NotFound, "user not found", gin.H{"field": "username"})
+		return
+	}
+	if _, err := orgs.Membership(reqDB(c), org.ID, u.ID); err == nil {
+		writeError(c, apierr.Duplicate, "user is already a member", gin.H{"field": "username"})
+		return
+	}
+	var pending models.OrgInvite
+	if err := reqDB(c).Where("org_id = ? AND user_id = ? AND accepted_at IS NULL AND expires_at > ?", org.ID, u.ID, time.Now().UTC()).
+		First(&pending).Error; err == nil {
+		writeError(c, apierr.Duplicate, "an invite for this user is pending", gin.H{"invite_id": pending.ID})
+		return
+	}
+	var profile models.Profile
+	reqDB(c).Where("user_id = ?", u.ID).Limit(1).Find(&profile)
+	raw, hash := orgs.NewInviteToken()
+	uid := u.ID
+	inv := models.OrgInvite{OrgID: org.ID, Email: strings.ToLower(profile.Email), Role: req.Role, TokenHash: hash,
+		InvitedBy: user.ID, UserID: &uid, ExpiresAt: time.Now().Add(inviteTTL())}
+	if err := reqDB(c).Create(&inv).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	// the token goes to the invitee only, never back to the owner
+	data := map[string]any{"Org": org.Name, "Inviter": user.Username, "Role": inv.Role, "Token": raw,
+		"Expires": inv.ExpiresAt.In(loadPreferences(u.ID).Location()).Format("2006-01-02 15:04 MST")}
+	if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+		data["URL"] = base + "/invites/" + raw
+	}
+	notifyUser(u.ID, notify.KindOrgInvite, data)
+	recordAudit(c, "org.member.invite", gin.H{"org_id": org.ID, "invite_id": inv.ID, "username": u.Username, "role": inv.Role})
+	c.JSON(http.StatusAccepted, gin.H{"invite": viewInvite(inv), "user_id": u.ID, "username": u.Username})
+}
+
+// loadOrgMember resolves :user_id to a membership of org.
+func loadOrgMember(c *gin.Context, org models.Organization) (models.OrgMembership, bool) {
+	uid, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return models.OrgMembership{}, false
+	}
+	target, err := orgs.Membership(reqDB(c), org.ID, uint(uid))
+	if err != nil {
+		writeError(c, apierr.NotFound, "member not found", nil)
+		return target, false
+	}
+	return target, true
+}
+
+// lastOwner reports whether target is the only owner of its organization.
+func lastOwner(gdb *gorm.DB, target models.OrgMembership) bool {
+	if target.Role != orgs.Owner {
+		return false
+	}
+	var n int64
+	gdb.Model(&models.OrgMembership{}).Where("org_id = ? AND role = ?", target.OrgID, orgs.Owner).Count(&n)
+	return n <= 1
+}
+
+// setOrgMemberRoleHandler changes a member's role; owners only. The last
+// owner cannot be demoted.
+func setOrgMemberRoleHandler(c *gin.Context) {
+	_, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	if m.Role != orgs.Owner {
+		writeError(c, apierr.Forbidden, "only owners can change roles", nil)
+		return
+	}
+	target, ok := loadOrgMember(c, org)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if !orgs.ValidRole(req.Role) {
+		writeError(c, apierr.InvalidBody, "unknown role", gin.H{"field": "role", "allowed": []string{orgs.Owner, orgs.Accountant, orgs.Member}})
+		return
+	}
+	if req.Role != orgs.Owner && lastOwner(reqDB(c), target) {
+		writeError(c, apierr.Forbidden, "an organization needs at least one owner", nil)
+		return
+	}
+	if err := reqDB(c).Model(&target).Update("role", req.Role).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "org.member.role", gin.H{"org_id": org.ID, "user_id": target.UserID, "role": req.Role})
+	c.JSON(http.StatusOK, gin.H{"user_id": target.UserID, "role": req.Role})
+}
+
+// removeOrgMemberHandler removes a member. Owners may remove anyone and every
+// member may leave, but the last owner stays.
+func removeOrgMemberHandler(c *gin.Context) {
+	user, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	target, ok := loadOrgMember(c, org)
+	if !ok {
+		return
+	}
+	if m.Role != orgs.Owner && target.UserID != user.ID {
+		writeError(c, apierr.Forbidden, "only owners can remove other members", nil)
+		return
+	}
+	if lastOwner(reqDB(c), target) {
+		writeError(c, apierr.Forbidden, "an organization needs at least one owner", nil)
+		return
+	}
+	if err := reqDB(c).Delete(&target).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	recordAudit(c, "org.member.remove", gin.H{"org_id": org.ID, "user_id": target.UserID})
+	c.Status(http.StatusNoContent)
+}
+
+// orgSummaryHandler rolls the members' catatan up into org totals, optionally
+// limited by from / to (YYYY-MM-DD in the caller's timezone). The per-member
+// breakdown is shown to owners and accountants only. With ?convert_to= the
+// members' catatan are also totalled in that currency.
+func orgSummaryHandler(c *gin.Context) {
+	user, org, m, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	from, to, ok := dateRange(c, loc)
+	if !ok {
+		return
+	}
+	conv, ok := converterFor(c, loc)
+	if !ok {
+		return
+	}
+	ids, err := orgs.MemberIDs(reqDB(c), org.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	s, err := orgs.Summarize(reportDB(c), ids, from, to, loc)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if !orgs.CanViewAll(m.Role) {
+		s.ByMember = nil
+	}
+	out := gin.H{"org_id": org.ID, "members": len(ids), "summary": s}
+	if conv != nil {
+		// members may keep their books in different currencies
+		q := catatanarchive.Catatan(reportDB(c), from).Where("user_id IN ? AND pending = ? AND split = ?", ids, false, false)
+		if from != nil {
+			q = q.Where("date >= ?", from.UTC())
+		}
+		if to != nil {
+			q = q.Where("date < ?", to.UTC())
+		}
+		v, ok := convertRows(c, conv, q, loc)
+		if !ok {
+			return
+		}
+		out["converted"] = v
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// orgCatatanQuery selects the confirmed catatan of every member of org in the
+// from / to range, or writes an error when the caller may not see them.
+func orgCatatanQuery(c *gin.Context) (*gorm.DB, models.Organization, bool) {
+	user, org, m, ok := loadOrg(c)
+	if !ok {
+		return nil, org, false
+	}
+	if !orgs.CanViewAll(m.Role) {
+		writeError(c, apierr.Forbidden, "only owners and accountants can view members' records", nil)
+		return nil, org, false
+	}
+	from, to, ok := dateRange(c, loadPreferences(user.ID).Location())
+	if !ok {
+		return nil, org, false
+	}
+	ids, err := orgs.MemberIDs(reqDB(c), org.ID)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return nil, org, false
+	}
+	q := catatanarchive.Catatan(reportDB(c), from).Where("user_id IN ? AND pending = ? AND split = ?", ids, false, false)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	return q, org, true
+}
+
+// listOrgCatatanHandler lists the newest 500 catatan of all members.
+func listOrgCatatanHandler(c *gin.Context) {
+	q, _, ok := orgCatatanQuery(c)
+	if !ok {
+		return
+	}
+	var items []models.CatatanKeuangan
+	if err := q.Order("date desc, id desc").Limit(500).Find(&items).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if items == nil {
+		items = []models.CatatanKeuangan{}
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// exportOrgCatatanHandler streams all members' catatan as CSV.
+func exportOrgCatatanHandler(c *gin.Context) {
+	q, org, ok := orgCatatanQuery(c)
+	if !ok {
+		return
+	}
+	var items []struct {
+		models.CatatanKeuangan
+		Username string
+	}
+	if err := q.Select("catatan_keuangans.*, users.username").
+		Joins("JOIN users ON users.id = catatan_keuangans.user_id").
+		Order("date, catatan_keuangans.id").Scan(&items).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	name := fmt.Sprintf("be03-org-%d-%s.csv", org.ID, time.Now().Format("20060102"))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	recordAudit(c, "org.export", gin.H{"org_id": org.ID, "rows": len(items)})
+	cw := csv.NewWriter(c.Writer)
+	_ = cw.Write([]string{"username", "file_name", "amount", "date", "created_at"})
+	for _, it := range items {
+		_ = cw.Write([]string{it.Username, it.FileName, strconv.FormatInt(it.Amount, 10), it.Date.Format(time.RFC3339), it.CreatedAt.Format(time.RFC3339)})
+	}
+	cw.Flush()
+}
+
+// checkOrgQuota rejects an upload of size bytes (0: an OCR retry) that would
+// exceed a quota of one of the user's organizations.
+func checkOrgQuota(c *gin.Context, user models.User, size int64) bool {
+	err := orgs.CheckQuota(reqDB(c), user.ID, size, time.Now())
+	if qe, ok := orgs.IsQuotaError(err); ok {
+		writeError(c, apierr.QuotaExceeded, qe.Error(), gin.H{"org_id": qe.OrgID, "resource": qe.Resource, "limit": qe.Limit, "used": qe.Used})
+		return false
+	}
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	return true
+}
+
+// orgUsageHandler reports the organization's storage and monthly OCR usage
+// against its quotas, with the resources that are near their limit.
+func orgUsageHandler(c *gin.Context) {
+	_, org, _, ok := loadOrg(c)
+	if !ok {
+		return
+	}
+	u, err := orgs.UsageOf(reportDB(c), org, time.Now())
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// setOrgQuotaHandler sets an organization's quotas; omitted fields keep their
+// value and 0 means unlimited.
+func setOrgQuotaHandler(c *gin.Context) {
+	var org models.Organization
+	if err := reqDB(c).First(&org, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	var req struct {
+		StorageQuotaBytes *int64 `json:"storage_quota_bytes"`
+		MonthlyOCRQuota   *int   `json:"monthly_ocr_quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if req.StorageQuotaBytes != nil {
+		if *req.StorageQuotaBytes < 0 {
+			writeError(c, apierr.InvalidBody, "storage_quota_bytes must not be negative", gin.H{"field": "storage_quota_bytes"})
+			return
+		}
+		org.StorageQuotaBytes = *req.StorageQuotaBytes
+	}
+	if req.MonthlyOCRQuota != nil {
+		if *req.MonthlyOCRQuota < 0 {
+			writeError(c, apierr.InvalidBody, "monthly_ocr_quota must not be negative", gin.H{"field": "monthly_ocr_quota"})
+			return
+		}
+		org.MonthlyOCRQuota = *req.MonthlyOCRQuota
+	}
+	if err := reqDB(c).Model(&org).Updates(map[string]any{"storage_quota_bytes": org.StorageQuotaBytes, "monthly_ocr_quota": org.MonthlyOCRQuota}).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "admin.org.quota", gin.H{"org_id": org.ID, "storage_quota_bytes": org.StorageQuotaBytes, "monthly_ocr_quota": org.MonthlyOCRQuota})
+	c.JSON(http.StatusOK, gin.H{"org_id": org.ID, "storage_quota_bytes": org.StorageQuotaBytes, "monthly_ocr_quota": org.MonthlyOCRQuota})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/notify"
+	"be03/pkg/periodlock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- period locks --------------------
+
+// periodTarget resolves whose books a period request is about: the caller, or for
+// administrators the user named by ?username=.
+func periodTarget(c *gin.Context) (models.User, bool) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return user, false
+	}
+	name := c.Query("username")
+	if name == "" || name == user.Username {
+		return user, true
+	}
+	if role, _ := c.Get("role"); role != "administrator" {
+		writeError(c, apierr.Forbidden, "only administrators can manage other users' periods", nil)
+		return user, false
+	}
+	var target models.User
+	if err := reqDB(c).Where("username = ?", name).First(&target).Error; err != nil {
+		writeError(c, apierr.NotFound, "user not found", gin.H{"field": "username"})
+		return target, false
+	}
+	return target, true
+}
+
+// checkPeriodOpen writes a period_locked error and returns false when the
+// catatan date falls in a closed period of its owner.
+func checkPeriodOpen(c *gin.Context, ct models.CatatanKeuangan) bool {
+	err := periodlock.Check(db, ct.UserID, ct.Date)
+	if errors.Is(err, periodlock.ErrLocked) {
+		writeError(c, apierr.PeriodLocked, "", gin.H{"period": ct.Date.In(loadPreferences(ct.UserID).Location()).Format("2006-01")})
+		return false
+	}
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	return true
+}
+
+// holdForReview keeps up without a catatan because its receipt is dated in a
+// closed period of userID (or the lock could not be checked), notes why on the
+// upload and tells the owner. The caller saves up.
+func holdForReview(up *models.Upload, userID uint, date time.Time, err error) {
+	period := date.In(loadPreferences(userID).Location()).Format("2006-01")
+	log.Printf("OCR: upload=%d of user=%d is dated in period %s: %v", up.ID, userID, period, err)
+	up.FailedReason = periodlock.ReviewReason(period)
+	notifyUser(userID, notify.KindPeriodLocked, map[string]any{"FileName": up.FileName, "Period": period})
+}
+
+// listPeriodLocksHandler lists the closed periods of the caller (or ?username=).
+func listPeriodLocksHandler(c *gin.Context) {
+	target, ok := periodTarget(c)
+	if !ok {
+		return
+	}
+	var locks []models.PeriodLock
+	if err := db.Where("user_id = ?", target.ID).Order("period").Find(&locks).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, locks)
+}
+
+// closePeriodHandler closes a month (YYYY-MM) in the owner's timezone. Closing
+// again is a no-op that returns the existing lock.
+func closePeriodHandler(c *gin.Context) {
+	target, ok := periodTarget(c)
+	if !ok {
+		return
+	}
+	period := c.Param("period")
+	if _, _, err := periodlock.Bounds(period, time.UTC); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "period"})
+		return
+	}
+	closer, _ := getUserFromContext(c)
+	lock, created, err := periodlock.Close(db, target.ID, period, loadPreferences(target.ID).Location(), closer.ID)
+	if err != nil {
+		log.Printf("period close failed for user=%d: %v", target.ID, err)
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		recordAudit(c, "period.close", gin.H{"user_id": target.ID, "period": lock.Period})
+	}
+	c.JSON(status, lock)
+}
+
+// unlockPeriodHandler reopens a closed month; administrators only, always audited.
+func unlockPeriodHandler(c *gin.Context) {
+	target, ok := periodTarget(c)
+	if !ok {
+		return
+	}
+	period := c.Param("period")
+	found, err := periodlock.Unlock(db, target.ID, period)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if !found {
+		writeError(c, apierr.NotFound, "period is not closed", nil)
+		return
+	}
+	recordAudit(c, "period.unlock", gin.H{"user_id": target.ID, "username": target.Username, "period": period})
+	c.JSON(http.StatusOK, gin.H{"user_id": target.ID, "period": period, "unlocked": true})
+}
@@ -0,0 +1,249 @@
+// Package accountpurge deletes a user account and everything it owns: refresh
+// tokens, catatan, uploads and their receipt files, preferences and profile
+// with its avatar and logo.
+// Audit rows are kept but anonymised. Deletion runs as a tracked PurgeJob because
+// removing files can be slow.
+package accountpurge
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/storagepath"
+	"be03/pkg/uploadfiles"
+
+	"gorm.io/gorm"
+)
+
+// Locator returns every on-disk path that may hold an upload's file.
+type Locator func(models.Upload) []string
+
+// Start creates (or returns the already active) purge job for userID. The caller
+// decides whether to Run it inline or in a goroutine.
+func Start(gdb *gorm.DB, userID uint, requestedBy string) (*models.PurgeJob, error) {
+	var active models.PurgeJob
+	err := gdb.Where("user_id = ? AND status IN ?", userID, []string{models.PurgePending, models.PurgeRunning}).First(&active).Error
+	if err == nil {
+		return &active, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	// cut off session renewal immediately; the rows themselves go when the job runs
+	if err := gdb.Model(&models.RefreshToken{}).Where("user_id = ?", userID).Update("revoked", true).Error; err != nil {
+		return nil, fmt.Errorf("revoke tokens: %w", err)
+	}
+	if err := gdb.Where("user_id = ?", userID).Delete(&models.APIToken{}).Error; err != nil {
+		return nil, fmt.Errorf("delete api tokens: %w", err)
+	}
+	job := &models.PurgeJob{Token: hex.EncodeToString(b), UserID: userID, RequestedBy: requestedBy, Status: models.PurgePending}
+	if err := gdb.Create(job).Error; err != nil {
+		return nil, err
+	}
+	var user models.User
+	_ = gdb.First(&user, userID).Error
+	uid := userID
+	gdb.Create(&models.AuditLog{UserID: &uid, Username: user.Username, Action: "account.delete_requested", Detail: "by " + requestedBy})
+	return job, nil
+}
+
+// Run executes the job to completion and records the outcome on the job row.
+func Run(gdb *gorm.DB, job *models.PurgeJob, locate Locator) error {
+	gdb.Model(job).Update("status", models.PurgeRunning)
+	files, assets, err := purgeRows(gdb, job.UserID)
+	if err != nil {
+		now := time.Now()
+		gdb.Model(job).Updates(map[string]any{"status": models.PurgeFailed, "error": truncate(err.Error()), "finished_at": &now})
+		return err
+	}
+	// rows are gone; now remove files best-effort
+	var problems []string
+	kept := 0
+	for _, up := range files {
+		removed := false
+		for _, p := range locate(up) {
+			if !owned(up, p) || referenced(gdb, p) {
+				kept++
+				continue
+			}
+			if err := os.Remove(p); err == nil {
+				removed = true
+			} else if !os.IsNotExist(err) {
+				problems = append(problems, fmt.Sprintf("%s: %v", p, err))
+			}
+		}
+		if removed {
+			job.FilesDeleted++
+		} else {
+			job.FilesMissing++
+		}
+	}
+	for _, name := range assets {
+		p := filepath.Join(uploadfiles.ProfileAssetsDir(), filepath.Base(name))
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%s: %v", p, err))
+		}
+	}
+	now := time.Now()
+	updates := map[string]any{"status": models.PurgeDone, "files_deleted": job.FilesDeleted, "files_missing": job.FilesMissing, "finished_at": &now}
+	if len(problems) > 0 {
+		updates["error"] = truncate("some files could not be removed: " + strings.Join(problems, "; "))
+	}
+	gdb.Model(job).Updates(updates)
+	gdb.Create(&models.AuditLog{Username: anonymous(job.UserID), Action: "account.purged",
+		Detail: fmt.Sprintf("job=%d files_deleted=%d files_missing=%d", job.ID, job.FilesDeleted, job.FilesMissing)})
+	log.Printf("account purge job=%d user=%d done: files deleted=%d missing=%d kept=%d", job.ID, job.UserID, job.FilesDeleted, job.FilesMissing, kept)
+	return nil
+}
+
+// owned reports whether the file at p is provably up's: its store path or
+// preserved original, or the file the watcher moved on under the store path's
+// name (storagepath.DiskName for every row written since). Rows without a
+// store path predate per-profile names; public/processed/<name> may then be
+// another user's receipt of the same name, and is left.
+func owned(up models.Upload, p string) bool {
+	p = filepath.Clean(p)
+	if up.OriginalPath != "" && p == filepath.Clean(storagepath.File(up.OriginalPath)) {
+		return true
+	}
+	return up.StorePath != "" && (p == filepath.Clean(storagepath.File(up.StorePath)) || filepath.Base(p) == path.Base(up.StorePath))
+}
+
+// referenced reports whether an upload row left after the purge may still
+// point at the file at p, by its store path, its original, or the shared name
+// Candidates looks for in public/processed and public/failed. LIKE treats _
+// in names as a wildcard, which only ever keeps more files.
+func referenced(gdb *gorm.DB, p string) bool {
+	slash, base := filepath.ToSlash(filepath.Clean(p)), filepath.Base(p)
+	var n int64
+	err := gdb.Model(&models.Upload{}).
+		Where("store_path = ? OR original_path = ? OR store_path LIKE ? OR (store_path = '' AND (file_name = ? OR file_name LIKE ?))",
+			slash, slash, "%/"+base, base, "%/"+base).
+		Count(&n).Error
+	return err != nil || n > 0
+}
+
+// ResumePending restarts jobs interrupted by a shutdown.
+func ResumePending(gdb *gorm.DB, locate Locator) {
+	var jobs []models.PurgeJob
+	if err := gdb.Where("status IN ?", []string{models.PurgePending, models.PurgeRunning}).Find(&jobs).Error; err != nil {
+		log.Printf("account purge: listing pending jobs failed: %v", err)
+		return
+	}
+	for i := range jobs {
+		if err := Run(gdb, &jobs[i], locate); err != nil {
+			log.Printf("account purge job=%d failed: %v", jobs[i].ID, err)
+		}
+	}
+}
+
+// purgeRows deletes every row owned by userID in one transaction and returns the
+// uploads whose files still need removing, and the profile avatar and logo files.
+func purgeRows(gdb *gorm.DB, userID uint) ([]models.Upload, []string, error) {
+	var uploads []models.Upload
+	var assets []string
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		var profiles []models.Profile
+		if err := tx.Where("user_id = ?", userID).Find(&profiles).Error; err != nil {
+			return err
+		}
+		var profileIDs []uint
+		for _, p := range profiles {
+			profileIDs = append(profileIDs, p.ID)
+			for _, f := range []string{p.AvatarFile, p.LogoFile} {
+				if f != "" {
+					assets = append(assets, f)
+				}
+			}
+		}
+		if len(profileIDs) > 0 {
+			if err := tx.Where("profile_id IN ?", profileIDs).Find(&uploads).Error; err != nil {
+				return err
+			}
+			// OCR text holds receipt contents too
+			if err := tx.Where("upload_id IN (?)", tx.Model(&models.Upload{}).Select("id").Where("profile_id IN ?", profileIDs)).
+				Delete(&models.UploadOCRText{}).Error; err != nil {
+				return fmt.Errorf("delete upload ocr texts: %w", err)
+			}
+			if err := tx.Where("upload_id IN (?)", tx.Model(&models.Upload{}).Select("id").Where("profile_id IN ?", profileIDs)).
+				Delete(&models.UploadItem{}).Error; err != nil {
+				return fmt.Errorf("delete upload items: %w", err)
+			}
+			if err := tx.Where("upload_id IN (?)", tx.Model(&models.Upload{}).Select("id").Where("profile_id IN ?", profileIDs)).
+				Delete(&models.UploadPHashBand{}).Error; err != nil {
+				return fmt.Errorf("delete upload phash bands: %w", err)
+			}
+			if err := tx.Where("upload_id IN (?)", tx.Model(&models.Upload{}).Select("id").Where("profile_id IN ?", profileIDs)).
+				Delete(&models.UploadNote{}).Error; err != nil {
+				return fmt.Errorf("delete upload notes: %w", err)
+			}
+			if err := tx.Where("profile_id IN ?", profileIDs).Delete(&models.OCRShadowRun{}).Error; err != nil {
+				return fmt.Errorf("delete ocr shadow runs: %w", err)
+			}
+			if err := tx.Where("profile_id IN ?", profileIDs).Delete(&models.Upload{}).Error; err != nil {
+				return fmt.Errorf("delete uploads: %w", err)
+			}
+		}
+		steps := []struct {
+			name  string
+			model any
+		}{
+			{"refresh tokens", &models.RefreshToken{}},
+			{"api tokens", &models.APIToken{}},
+			{"catatan", &models.CatatanKeuangan{}},
+			{"archived catatan", &models.CatatanArchive{}},
+			{"goals", &models.Goal{}},
+			{"accounts", &models.Account{}},
+			{"preferences", &models.Preferences{}},
+			{"chat links", &models.ChatLink{}},
+			{"chat link codes", &models.ChatLinkCode{}},
+			{"period locks", &models.PeriodLock{}},
+			{"export mappings", &models.ExportMapping{}},
+			{"saved views", &models.SavedView{}},
+			{"notification deliveries", &models.NotificationDelivery{}},
+			{"notifications", &models.Notification{}},
+			{"push subscriptions", &models.PushSubscription{}},
+			{"org memberships", &models.OrgMembership{}},
+			{"username history", &models.UsernameHistory{}},
+			{"profile", &models.Profile{}},
+		}
+		for _, s := range steps {
+			if err := tx.Where("user_id = ?", userID).Delete(s.model).Error; err != nil {
+				return fmt.Errorf("delete %s: %w", s.name, err)
+			}
+		}
+		if err := tx.Model(&models.AuditLog{}).Where("user_id = ?", userID).
+			Updates(map[string]any{"user_id": nil, "username": anonymous(userID), "ip": ""}).Error; err != nil {
+			return fmt.Errorf("anonymise audit log: %w", err)
+		}
+		if err := tx.Delete(&models.User{}, userID).Error; err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+		return nil
+	})
+	return uploads, assets, err
+}
+
+func anonymous(userID uint) string {
+	return fmt.Sprintf("deleted-user-%d", userID)
+}
+
+func truncate(s string) string {
+	if len(s) > 1000 {
+		return s[:1000]
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package accountpurge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+	"be03/pkg/uploadfiles"
+)
+
+func TestPurgeRemovesRowsAndFiles(t *testing.T) {
+	testenv.Chdir(t)
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{
+			{Username: "gone", Password: "secret1", Role: "user"},
+			{Username: "stays", Password: "secret2", Role: "user"},
+		},
+		Uploads: []fixtures.Upload{
+			{User: "gone", FileName: "a.jpg", StorePath: "public/keu/a.jpg"},
+			{User: "gone", FileName: "missing.jpg"},
+			{User: "stays", FileName: "b.jpg", StorePath: "public/keu/b.jpg"},
+			// rows from before per-profile names share public/processed/<name>
+			{User: "gone", FileName: "shared.jpg"},
+			{User: "stays", FileName: "shared.jpg"},
+		},
+		Catatan: []fixtures.Catatan{{User: "gone", FileName: "a.jpg", Amount: 1000}, {User: "stays", FileName: "b.jpg", Amount: 2000}},
+	})
+	for _, p := range []string{"public/processed/a.jpg", "public/keu/b.jpg", "public/processed/shared.jpg", "public/failed/legacy.jpg"} {
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, testenv.JPEG, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var gone models.User
+	gdb.Where("username = ?", "gone").First(&gone)
+	gdb.Create(&models.RefreshToken{UserID: gone.ID, TokenHash: "h1"})
+	uid := gone.ID
+	gdb.Create(&models.AuditLog{UserID: &uid, Username: "gone", Action: "login"})
+	avatar := filepath.Join(uploadfiles.ProfileAssetsDir(), "1-avatar-0123456789abcdef.jpg")
+	_ = os.MkdirAll(filepath.Dir(avatar), 0o755)
+	if err := os.WriteFile(avatar, testenv.JPEG, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gdb.Model(&models.Profile{}).Where("user_id = ?", gone.ID).Update("avatar_file", filepath.Base(avatar))
+	// without a store path nothing proves public/failed/legacy.jpg is theirs
+	var profile models.Profile
+	gdb.Where("user_id = ?", gone.ID).First(&profile)
+	gdb.Create(&models.Upload{ProfileID: profile.ID, FileName: "legacy.jpg"})
+
+	job, err := Start(gdb, gone.ID, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := Start(gdb, gone.ID, "test")
+	if again.ID != job.ID {
+		t.Fatal("a second request must reuse the active job")
+	}
+	if err := Run(gdb, job, uploadfiles.Candidates); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.PurgeJob
+	gdb.First(&stored, job.ID)
+	if stored.Status != models.PurgeDone || stored.FilesDeleted != 1 || stored.FilesMissing != 3 || stored.FinishedAt == nil {
+		t.Fatalf("unexpected job state: %+v", stored)
+	}
+	for _, m := range []any{&models.User{}, &models.Profile{}, &models.CatatanKeuangan{}, &models.RefreshToken{}} {
+		var n int64
+		gdb.Model(m).Where("user_id = ?", gone.ID).Count(&n)
+		if _, isUser := m.(*models.User); isUser {
+			gdb.Model(m).Where("id = ?", gone.ID).Count(&n)
+		}
+		if n != 0 {
+			t.Errorf("%T rows left: %d", m, n)
+		}
+	}
+	var ups int64
+	gdb.Model(&models.Upload{}).Count(&ups)
+	if ups != 2 {
+		t.Errorf("expected only the other user's upload to remain, got %d", ups)
+	}
+	if _, err := os.Stat("public/processed/a.jpg"); !os.IsNotExist(err) {
+		t.Error("receipt file not removed")
+	}
+	for _, p := range []string{"public/keu/b.jpg", "public/processed/shared.jpg", "public/failed/legacy.jpg"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s, which the account does not provably own, removed", p)
+		}
+	}
+	if _, err := os.Stat(avatar); !os.IsNotExist(err) {
+		t.Error("avatar not removed")
+	}
+	var logs []models.AuditLog
+	gdb.Order("id").Find(&logs)
+	for _, l := range logs {
+		if l.UserID != nil || l.Username == "gone" {
+			t.Errorf("audit row not anonymised: %+v", l)
+		}
+	}
+}
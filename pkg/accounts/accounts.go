@@ -0,0 +1,63 @@
+// Package accounts holds the account helpers shared by the API and the watcher:
+// type validation, mapping an OCR-detected institution to an account and
+// per-account totals.
+package accounts
+
+import (
+	"strings"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+
+	"gorm.io/gorm"
+)
+
+// ValidType reports whether t is a known account type.
+func ValidType(t string) bool {
+	switch t {
+	case models.AccountCash, models.AccountBank, models.AccountEWallet:
+		return true
+	}
+	return false
+}
+
+// Match returns the id of userID's active account for institution (compared
+// case-insensitively), or nil when institution is empty or no account matches.
+// With several matches the oldest account wins.
+func Match(gdb *gorm.DB, userID uint, institution string) *uint {
+	institution = strings.TrimSpace(institution)
+	if institution == "" {
+		return nil
+	}
+	var acc models.Account
+	if err := gdb.Where("user_id = ? AND archived = ? AND LOWER(institution) = ?", userID, false, strings.ToLower(institution)).
+		Order("id").First(&acc).Error; err != nil {
+		return nil
+	}
+	return &acc.ID
+}
+
+// Total is the sum and count of catatan recorded on one account.
+type Total struct {
+	AccountID uint  `json:"account_id"`
+	Total     int64 `json:"total"`
+	Count     int64 `json:"count"`
+}
+
+// Totals returns catatan totals per account for userID, keyed by account id,
+// archived catatan included; pending and split ones are left out.
+func Totals(gdb *gorm.DB, userID uint) (map[uint]Total, error) {
+	var rows []Total
+	err := catatanarchive.Catatan(gdb, nil).
+		Select("account_id, COALESCE(SUM(amount), 0) AS total, COUNT(*) AS count").
+		Where("user_id = ? AND account_id IS NOT NULL AND pending = ? AND split = ?", userID, false, false).
+		Group("account_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint]Total, len(rows))
+	for _, r := range rows {
+		out[r.AccountID] = r
+	}
+	return out, nil
+}
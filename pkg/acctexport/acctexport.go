@@ -0,0 +1,195 @@
+// Package acctexport writes catatan as journal import files for accounting
+// tools: Accurate, Jurnal (Mekari) and QuickBooks Online. Each catatan becomes
+// an entry of two lines, debiting the expense account and crediting the
+// ledger account of the be03 Account the money came from.
+//
+// be03 has no expense categories; the ledger code of the credit line is picked
+// per be03 Account, or per account type (cash, bank, ewallet), in the user's
+// Mapping, which also renames, reorders or drops columns. Mappings are stored
+// per user and format (models.ExportMapping).
+package acctexport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+)
+
+// Formats.
+const (
+	FormatAccurate   = "accurate"
+	FormatJurnal     = "jurnal"
+	FormatQuickBooks = "quickbooks"
+)
+
+// Fields a column can hold.
+const (
+	FieldEntryNo     = "entry_no"     // BE03-<catatan id>, shared by both lines
+	FieldDate        = "date"         // in DateLayout and the user's timezone
+	FieldAccount     = "account"      // ledger code (QuickBooks: name) of the line
+	FieldDebit       = "debit"        // amount on the debit line, else empty
+	FieldCredit      = "credit"       // amount on the credit line, else empty
+	FieldDescription = "description"  // the catatan's file name or label
+	FieldBe03Account = "be03_account" // name of the catatan's be03 Account
+)
+
+var fields = map[string]bool{
+	FieldEntryNo: true, FieldDate: true, FieldAccount: true, FieldDebit: true,
+	FieldCredit: true, FieldDescription: true, FieldBe03Account: true,
+}
+
+// ErrUnknownFormat is returned for a format name not in Formats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Column is one column of the file: its header and the field it holds.
+type Column struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// Mapping configures a format for one user. Zero fields take the format's
+// defaults.
+type Mapping struct {
+	// ExpenseAccount is debited with every catatan.
+	ExpenseAccount string `json:"expense_account"`
+	// CashAccount is credited for catatan without a be03 Account, or whose
+	// account has no code in AccountCodes.
+	CashAccount string `json:"cash_account"`
+	// AccountCodes maps a be03 Account id ("12") or type ("bank") to the
+	// ledger account credited; the id wins over the type.
+	AccountCodes map[string]string `json:"account_codes,omitempty"`
+	Columns      []Column          `json:"columns,omitempty"`
+	// DateLayout is a Go time layout, e.g. "02/01/2006".
+	DateLayout string `json:"date_layout,omitempty"`
+}
+
+// Formats holds the defaults of each format, after the vendors' journal
+// import templates.
+var Formats = map[string]Mapping{
+	FormatAccurate: {
+		ExpenseAccount: "6000", CashAccount: "1100", DateLayout: "02/01/2006",
+		Columns: []Column{
+			{"No. Bukti", FieldEntryNo}, {"Tanggal", FieldDate}, {"No. Akun", FieldAccount},
+			{"Debit", FieldDebit}, {"Kredit", FieldCredit}, {"Keterangan", FieldDescription},
+		},
+	},
+	FormatJurnal: {
+		ExpenseAccount: "6-60000", CashAccount: "1-10001", DateLayout: "02/01/2006",
+		Columns: []Column{
+			{"*Transaction Date", FieldDate}, {"*Transaction No", FieldEntryNo}, {"Memo", FieldDescription},
+			{"*Account Code", FieldAccount}, {"Debit", FieldDebit}, {"Credit", FieldCredit},
+			{"Description", FieldDescription}, {"Tags", FieldBe03Account},
+		},
+	},
+	FormatQuickBooks: {
+		ExpenseAccount: "Uncategorized Expense", CashAccount: "Cash", DateLayout: "01/02/2006",
+		Columns: []Column{
+			{"Journal No", FieldEntryNo}, {"Journal Date", FieldDate}, {"Account Name", FieldAccount},
+			{"Debits", FieldDebit}, {"Credits", FieldCredit}, {"Description", FieldDescription},
+		},
+	},
+}
+
+// Resolve fills the zero fields of m from format's defaults.
+func Resolve(format string, m Mapping) (Mapping, error) {
+	def, ok := Formats[format]
+	if !ok {
+		return m, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if m.ExpenseAccount == "" {
+		m.ExpenseAccount = def.ExpenseAccount
+	}
+	if m.CashAccount == "" {
+		m.CashAccount = def.CashAccount
+	}
+	if len(m.Columns) == 0 {
+		m.Columns = def.Columns
+	}
+	if m.DateLayout == "" {
+		m.DateLayout = def.DateLayout
+	}
+	return m, nil
+}
+
+// Validate checks the columns of m.
+func (m Mapping) Validate() error {
+	for i, c := range m.Columns {
+		if strings.TrimSpace(c.Header) == "" {
+			return fmt.Errorf("column %d has no header", i+1)
+		}
+		if !fields[c.Field] {
+			return fmt.Errorf("column %q: unknown field %q", c.Header, c.Field)
+		}
+	}
+	return nil
+}
+
+// creditAccount is the ledger account credited for a catatan on acct (nil:
+// none).
+func (m Mapping) creditAccount(acct *models.Account) string {
+	if acct != nil {
+		if code := m.AccountCodes[strconv.FormatUint(uint64(acct.ID), 10)]; code != "" {
+			return code
+		}
+		if code := m.AccountCodes[acct.Type]; code != "" {
+			return code
+		}
+	}
+	return m.CashAccount
+}
+
+// Write writes cats as a CSV journal in the resolved mapping m, dates in loc.
+// accounts holds the be03 Accounts the catatan reference, by id.
+func Write(w io.Writer, m Mapping, cats []models.CatatanKeuangan, accounts map[uint]models.Account, loc *time.Location) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(m.Columns))
+	for i, c := range m.Columns {
+		header[i] = c.Header
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, ct := range cats {
+		var acct *models.Account
+		if ct.AccountID != nil {
+			if a, ok := accounts[*ct.AccountID]; ok {
+				acct = &a
+			}
+		}
+		debit, credit := m.ExpenseAccount, m.creditAccount(acct)
+		amount := ct.Amount
+		if amount < 0 {
+			// a refund: money flows back
+			debit, credit, amount = credit, debit, -amount
+		}
+		values := map[string]string{
+			FieldEntryNo:     fmt.Sprintf("BE03-%d", ct.ID),
+			FieldDate:        ct.Date.In(loc).Format(m.DateLayout),
+			FieldDescription: ct.FileName,
+		}
+		if acct != nil {
+			values[FieldBe03Account] = acct.Name
+		}
+		for _, line := range []struct{ account, debit, credit string }{
+			{debit, strconv.FormatInt(amount, 10), ""},
+			{credit, "", strconv.FormatInt(amount, 10)},
+		} {
+			values[FieldAccount], values[FieldDebit], values[FieldCredit] = line.account, line.debit, line.credit
+			row := make([]string, len(m.Columns))
+			for i, c := range m.Columns {
+				row[i] = values[c.Field]
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,74 @@
+package acctexport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+)
+
+func TestWriteJournal(t *testing.T) {
+	jkt := time.FixedZone("WIB", 7*3600)
+	bank := uint(7)
+	cats := []models.CatatanKeuangan{
+		// 20:00 UTC is already the next day in Jakarta
+		{ID: 1, FileName: "nota.jpg", Amount: 45000, Date: time.Date(2025, 3, 4, 20, 0, 0, 0, time.UTC)},
+		{ID: 2, FileName: "refund", Amount: -5000, Date: time.Date(2025, 3, 6, 1, 0, 0, 0, time.UTC), AccountID: &bank},
+	}
+	accounts := map[uint]models.Account{bank: {ID: bank, Name: "BCA", Type: models.AccountBank}}
+
+	m, err := Resolve(FormatAccurate, Mapping{AccountCodes: map[string]string{"bank": "1200"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, m, cats, accounts, jkt); err != nil {
+		t.Fatal(err)
+	}
+	want := `No. Bukti,Tanggal,No. Akun,Debit,Kredit,Keterangan
+BE03-1,05/03/2025,6000,45000,,nota.jpg
+BE03-1,05/03/2025,1100,,45000,nota.jpg
+BE03-2,06/03/2025,1200,5000,,refund
+BE03-2,06/03/2025,6000,,5000,refund
+`
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// an account id wins over its type; columns are the user's
+	m.AccountCodes["7"] = "1201"
+	m.Columns = []Column{{"Date", FieldDate}, {"Acct", FieldAccount}, {"Amt", FieldCredit}, {"Wallet", FieldBe03Account}}
+	m.DateLayout = "2006-01-02"
+	buf.Reset()
+	if err := Write(&buf, m, cats[1:], accounts, jkt); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Date,Acct,Amt,Wallet\n2025-03-06,1201,,BCA\n2025-03-06,6000,5000,BCA\n"; buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestResolveAndValidate(t *testing.T) {
+	for name := range Formats {
+		m, err := Resolve(name, Mapping{})
+		if err != nil || m.Validate() != nil || m.ExpenseAccount == "" || m.CashAccount == "" {
+			t.Fatalf("%s defaults: %+v %v", name, m, err)
+		}
+	}
+	m, _ := Resolve(FormatQuickBooks, Mapping{CashAccount: "Checking"})
+	if m.CashAccount != "Checking" || m.ExpenseAccount != "Uncategorized Expense" || !strings.HasPrefix(m.Columns[0].Header, "Journal") {
+		t.Fatalf("quickbooks: %+v", m)
+	}
+	if _, err := Resolve("xero", Mapping{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("unknown format: %v", err)
+	}
+	if err := (Mapping{Columns: []Column{{"Tax", "vat"}}}).Validate(); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	if err := (Mapping{Columns: []Column{{" ", FieldDate}}}).Validate(); err == nil {
+		t.Fatal("empty header accepted")
+	}
+}
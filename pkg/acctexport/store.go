@@ -0,0 +1,75 @@
+package acctexport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+
+	"gorm.io/gorm"
+)
+
+// Load returns userID's mapping for format, resolved against the defaults.
+func Load(gdb *gorm.DB, userID uint, format string) (Mapping, error) {
+	var m Mapping
+	var row models.ExportMapping
+	err := gdb.Where("user_id = ? AND format = ?", userID, format).First(&row).Error
+	switch {
+	case err == nil:
+		if err := json.Unmarshal([]byte(row.Config), &m); err != nil {
+			return m, fmt.Errorf("stored %s mapping: %w", format, err)
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return m, err
+	}
+	return Resolve(format, m)
+}
+
+// Save validates m and stores it as userID's mapping for format.
+func Save(gdb *gorm.DB, userID uint, format string, m Mapping) error {
+	if _, ok := Formats[format]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	b, _ := json.Marshal(m)
+	var row models.ExportMapping
+	gdb.Where("user_id = ? AND format = ?", userID, format).First(&row)
+	row.UserID, row.Format, row.Config = userID, format, string(b)
+	return gdb.Save(&row).Error
+}
+
+// Export writes userID's catatan dated in [from, to) (nil: unbounded), archived
+// ones included and pending and split ones left out, in format with the user's
+// mapping. It returns the number of catatan written.
+func Export(w io.Writer, gdb *gorm.DB, userID uint, format string, from, to *time.Time, loc *time.Location, scopes ...func(*gorm.DB) *gorm.DB) (int, error) {
+	m, err := Load(gdb, userID, format)
+	if err != nil {
+		return 0, err
+	}
+	q := catatanarchive.Catatan(gdb, from).Where("user_id = ? AND pending = ? AND split = ?", userID, false, false)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	var cats []models.CatatanKeuangan
+	if err := q.Scopes(scopes...).Order("date, id").Find(&cats).Error; err != nil {
+		return 0, fmt.Errorf("load catatan: %w", err)
+	}
+	var list []models.Account
+	if err := gdb.Where("user_id = ?", userID).Find(&list).Error; err != nil {
+		return 0, fmt.Errorf("load accounts: %w", err)
+	}
+	accounts := make(map[uint]models.Account, len(list))
+	for _, a := range list {
+		accounts[a.ID] = a
+	}
+	return len(cats), Write(w, m, cats, accounts, loc)
+}
@@ -0,0 +1,145 @@
+// Package analytics computes platform-wide operating metrics for administrators.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"be03/models"
+	"be03/pkg/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// DayCount is the number of uploads on one UTC day.
+type DayCount struct {
+	Day   string `json:"day"` // YYYY-MM-DD
+	Count int64  `json:"count"`
+}
+
+// Latency percentiles in seconds between upload and OCR completion.
+type Latency struct {
+	Samples int64   `json:"samples"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// Report covers uploads and catatan created in [From, To).
+type Report struct {
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	ActiveUsers int64      `json:"active_users"`
+	TotalUsers  int64      `json:"total_users"`
+	Uploads     int64      `json:"uploads"`
+	UploadsPer  []DayCount `json:"uploads_per_day"`
+	OCR         struct {
+		Succeeded     int64    `json:"succeeded"`
+		Failed        int64    `json:"failed"`
+		SuccessRate   *float64 `json:"success_rate"` // nil without processed uploads
+		AvgConfidence *float64 `json:"avg_confidence"`
+	} `json:"ocr"`
+	Latency Latency `json:"latency"`
+	Storage struct {
+		TotalBytes  int64 `json:"total_bytes"`  // every upload on record
+		PeriodBytes int64 `json:"period_bytes"` // uploaded within the range
+	} `json:"storage"`
+}
+
+// maxLatencySamples bounds the rows read for percentiles; the most recent win.
+const maxLatencySamples = 50000
+
+// Compute builds the report for [from, to).
+func Compute(gdb *gorm.DB, from, to time.Time) (Report, error) {
+	from, to = from.UTC(), to.UTC()
+	r := Report{From: from, To: to, UploadsPer: []DayCount{}}
+	inRange := func() *gorm.DB {
+		return gdb.Model(&models.Upload{}).Where("uploads.created_at >= ? AND uploads.created_at < ?", from, to)
+	}
+
+	// raw SQL escapes the tenancy plugin, so the tenant is filtered here
+	catatanCond, uploadCond := "", ""
+	args := []any{from, to, from, to}
+	if id, ok := tenancy.FromContext(gdb.Statement.Context); ok {
+		catatanCond, uploadCond = " AND tenant_id = ?", " AND uploads.tenant_id = ?"
+		args = []any{from, to, id, from, to, id}
+	}
+	err := gdb.Raw(`SELECT COUNT(*) FROM (
+			SELECT user_id FROM catatan_keuangans WHERE created_at >= ? AND created_at < ?`+catatanCond+`
+			UNION
+			SELECT profiles.user_id FROM uploads JOIN profiles ON profiles.id = uploads.profile_id
+			WHERE uploads.created_at >= ? AND uploads.created_at < ?`+uploadCond+`
+		) active`, args...).Scan(&r.ActiveUsers).Error
+	if err != nil {
+		return r, err
+	}
+	if err := gdb.Model(&models.User{}).Where("deleted_at IS NULL").Count(&r.TotalUsers).Error; err != nil {
+		return r, err
+	}
+	if err := inRange().Count(&r.Uploads).Error; err != nil {
+		return r, err
+	}
+	if err := inRange().Select("DATE(created_at) AS day, COUNT(*) AS count").
+		Group("DATE(created_at)").Order("day").Scan(&r.UploadsPer).Error; err != nil {
+		return r, err
+	}
+
+	var ocr struct {
+		Succeeded int64
+		Failed    int64
+		AvgConf   *float64
+	}
+	if err := inRange().Select(`
+			COALESCE(SUM(CASE WHEN failed = ? THEN 0 WHEN keuangan_id IS NOT NULL THEN 1 ELSE 0 END), 0) AS succeeded,
+			COALESCE(SUM(CASE WHEN failed = ? THEN 1 ELSE 0 END), 0) AS failed,
+			AVG(ocr_confidence) AS avg_conf`, true, true).Scan(&ocr).Error; err != nil {
+		return r, err
+	}
+	r.OCR.Succeeded, r.OCR.Failed, r.OCR.AvgConfidence = ocr.Succeeded, ocr.Failed, ocr.AvgConf
+	if done := ocr.Succeeded + ocr.Failed; done > 0 {
+		rate := float64(ocr.Succeeded) / float64(done)
+		r.OCR.SuccessRate = &rate
+	}
+
+	var stamps []struct {
+		CreatedAt   time.Time
+		ProcessedAt time.Time
+	}
+	if err := inRange().Select("created_at, processed_at").Where("processed_at IS NOT NULL").
+		Order("id desc").Limit(maxLatencySamples).Scan(&stamps).Error; err != nil {
+		return r, err
+	}
+	secs := make([]float64, 0, len(stamps))
+	for _, s := range stamps {
+		secs = append(secs, math.Max(0, s.ProcessedAt.Sub(s.CreatedAt).Seconds()))
+	}
+	r.Latency = Percentiles(secs)
+
+	if err := gdb.Model(&models.Upload{}).Select("COALESCE(SUM(size_bytes), 0)").Scan(&r.Storage.TotalBytes).Error; err != nil {
+		return r, err
+	}
+	if err := inRange().Select("COALESCE(SUM(size_bytes), 0)").Scan(&r.Storage.PeriodBytes).Error; err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// Percentiles summarises samples (nearest-rank method); samples is sorted in place.
+func Percentiles(samples []float64) Latency {
+	l := Latency{Samples: int64(len(samples))}
+	if len(samples) == 0 {
+		return l
+	}
+	sort.Float64s(samples)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p/100*float64(len(samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return samples[i]
+	}
+	l.P50, l.P90, l.P99, l.Max = rank(50), rank(90), rank(99), samples[len(samples)-1]
+	return l
+}
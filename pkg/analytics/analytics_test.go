@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestPercentiles(t *testing.T) {
+	var s []float64
+	for i := 100; i >= 1; i-- {
+		s = append(s, float64(i))
+	}
+	l := Percentiles(s)
+	if l.Samples != 100 || l.P50 != 50 || l.P90 != 90 || l.P99 != 99 || l.Max != 100 {
+		t.Fatalf("unexpected percentiles: %+v", l)
+	}
+	if l = Percentiles(nil); l.Samples != 0 || l.P50 != 0 {
+		t.Fatalf("empty: %+v", l)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "u1", Password: "secret1"}, {Username: "u2", Password: "secret2"}},
+		Uploads: []fixtures.Upload{
+			{User: "u1", FileName: "ok.jpg"},
+			{User: "u1", FileName: "bad.jpg", Failed: true},
+		},
+		Catatan: []fixtures.Catatan{{User: "u1", FileName: "ok.jpg", Amount: 1000, Date: "2025-08-01"}},
+	})
+	var ok, bad models.Upload
+	gdb.Where("file_name = ?", "ok.jpg").First(&ok)
+	gdb.Where("file_name = ?", "bad.jpg").First(&bad)
+	var ct models.CatatanKeuangan
+	gdb.First(&ct)
+	conf := 0.8
+	done := ok.CreatedAt.Add(4 * time.Second)
+	gdb.Model(&ok).Updates(map[string]any{"keuangan_id": ct.ID, "size_bytes": 1500, "ocr_confidence": conf, "processed_at": done})
+	gdb.Model(&bad).Updates(map[string]any{"size_bytes": 500, "ocr_confidence": 0.2, "processed_at": bad.CreatedAt.Add(2 * time.Second)})
+
+	now := time.Now()
+	r, err := Compute(gdb, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ActiveUsers != 1 || r.Uploads != 2 || len(r.UploadsPer) != 1 || r.UploadsPer[0].Count != 2 {
+		t.Fatalf("activity: %+v", r)
+	}
+	if r.OCR.Succeeded != 1 || r.OCR.Failed != 1 || *r.OCR.SuccessRate != 0.5 || *r.OCR.AvgConfidence != 0.5 {
+		t.Fatalf("ocr: %+v", r.OCR)
+	}
+	if r.Latency.Samples != 2 || r.Latency.Max != 4 || r.Storage.TotalBytes != 2000 {
+		t.Fatalf("latency/storage: %+v %+v", r.Latency, r.Storage)
+	}
+
+	if r, _ = Compute(gdb, now.Add(-48*time.Hour), now.Add(-24*time.Hour)); r.Uploads != 0 || r.OCR.SuccessRate != nil || r.Storage.PeriodBytes != 0 {
+		t.Fatalf("empty range: %+v", r)
+	}
+}
@@ -0,0 +1,86 @@
+// Package anomaly flags OCR amounts that deviate wildly from a user's history,
+// backstopping extraction mistakes such as thousand-flooring or cents misread as
+// whole rupiah (both of which are off by roughly 100x or more).
+package anomaly
+
+import (
+	"fmt"
+	"sort"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Factor is how far from the median an amount may be before it is suspect.
+	Factor = 100
+	// MinHistory is the number of prior catatan required before judging; new users
+	// have no meaningful range yet.
+	MinHistory = 5
+	// HistoryWindow bounds how many recent catatan form the baseline.
+	HistoryWindow = 200
+)
+
+// Verdict is the outcome of a check.
+type Verdict struct {
+	Suspect bool
+	Reason  string
+	Median  int64
+}
+
+// Median returns the median of amounts (0 for an empty slice).
+func Median(amounts []int64) int64 {
+	if len(amounts) == 0 {
+		return 0
+	}
+	s := append([]int64(nil), amounts...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	mid := len(s) / 2
+	if len(s)%2 == 1 {
+		return s[mid]
+	}
+	return (s[mid-1] + s[mid]) / 2
+}
+
+// Check judges amount against the user's previous amounts.
+func Check(amount int64, history []int64) Verdict {
+	if amount <= 0 || len(history) < MinHistory {
+		return Verdict{}
+	}
+	m := Median(history)
+	if m <= 0 {
+		return Verdict{}
+	}
+	v := Verdict{Median: m}
+	switch {
+	case amount >= m*Factor:
+		v.Suspect = true
+		v.Reason = fmt.Sprintf("amount %d is over %dx the usual %d", amount, Factor, m)
+	case amount*Factor <= m:
+		v.Suspect = true
+		v.Reason = fmt.Sprintf("amount %d is under 1/%d of the usual %d", amount, Factor, m)
+	}
+	return v
+}
+
+// Evaluate loads the user's recent confirmed, non-suspect amounts and checks
+// amount against them.
+func Evaluate(gdb *gorm.DB, userID uint, amount int64) Verdict {
+	var history []int64
+	if err := gdb.Model(&models.CatatanKeuangan{}).
+		Where("user_id = ? AND suspect = ? AND pending = ? AND amount > 0", userID, false, false).
+		Order("id desc").Limit(HistoryWindow).
+		Pluck("amount", &history).Error; err != nil {
+		return Verdict{}
+	}
+	return Check(amount, history)
+}
+
+// Apply sets the suspect flag on a catatan about to be created.
+func Apply(gdb *gorm.DB, ct *models.CatatanKeuangan) Verdict {
+	v := Evaluate(gdb, ct.UserID, ct.Amount)
+	ct.Suspect = v.Suspect
+	ct.SuspectReason = v.Reason
+	return v
+}
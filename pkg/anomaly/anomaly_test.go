@@ -0,0 +1,45 @@
+package anomaly
+
+import "testing"
+
+func TestMedian(t *testing.T) {
+	cases := []struct {
+		in   []int64
+		want int64
+	}{
+		{nil, 0},
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{4, 1, 3, 2}, 2},
+	}
+	for _, c := range cases {
+		if got := Median(c.in); got != c.want {
+			t.Errorf("Median(%v) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	history := []int64{50000, 75000, 120000, 60000, 90000}
+	cases := []struct {
+		name    string
+		amount  int64
+		history []int64
+		suspect bool
+	}{
+		{"typical", 80000, history, false},
+		{"cents read as rupiah", 8_000_000_00, history, true},
+		{"floored to nothing", 500, history, true},
+		{"big but plausible", 5_000_000, history, false},
+		{"too little history", 8_000_000_00, history[:3], false},
+	}
+	for _, c := range cases {
+		v := Check(c.amount, c.history)
+		if v.Suspect != c.suspect {
+			t.Errorf("%s: suspect = %v, want %v (%s)", c.name, v.Suspect, c.suspect, v.Reason)
+		}
+		if v.Suspect && v.Reason == "" {
+			t.Errorf("%s: suspect without reason", c.name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package apierr defines the API's error envelope and the catalog of
+// machine-readable error codes. Every error response has the same shape:
+//
+//	{"code": "not_found", "error": "not_found", "message": "...", "details": {...}, "request_id": "..."}
+//
+// "error" duplicates "code" for clients written against the original bodies.
+package apierr
+
+import "net/http"
+
+// Code is a stable, machine-readable error identifier. Never rename a published code.
+type Code string
+
+const (
+	InvalidBody           Code = "invalid_body"
+	Unauthorized          Code = "unauthorized"
+	InvalidCredentials    Code = "invalid_credentials"
+	AccountDisabled       Code = "account_disabled"
+	InvalidRefresh        Code = "invalid_refresh"
+	Forbidden             Code = "forbidden"
+	NotFound              Code = "not_found"
+	Duplicate             Code = "duplicate"
+	ProfileMissing        Code = "profile_missing"
+	MissingFile           Code = "missing_file"
+	FileTooLarge          Code = "file_too_large"
+	UnsupportedType       Code = "unsupported_type"
+	InvalidFile           Code = "invalid_file"
+	AmountNotFound        Code = "amount_not_found"
+	UnsupportedAPIVersion Code = "unsupported_api_version"
+	CreateFailed          Code = "create_failed"
+	QueryFailed           Code = "query_failed"
+	TokenFailed           Code = "token_failed"
+	RevokeFailed          Code = "revoke_failed"
+	ContextMissing        Code = "context_missing"
+	OpenFailed            Code = "open_failed"
+	DBSaveFailed          Code = "db_save_failed"
+	MkdirFailed           Code = "mkdir_failed"
+	SaveFailed            Code = "save_failed"
+	OCRError              Code = "ocr_error"
+	IngestDisabled        Code = "ingest_disabled"
+	PeriodLocked          Code = "period_locked"
+	Maintenance           Code = "maintenance"
+	RateLimited           Code = "rate_limited"
+	UsernameCooldown      Code = "username_cooldown"
+	QuotaExceeded         Code = "quota_exceeded"
+	RateUnavailable       Code = "rate_unavailable"
+	DBUnavailable         Code = "db_unavailable"
+	JobRunning            Code = "job_running"
+	TenantNotFound        Code = "tenant_not_found"
+	TenantDisabled        Code = "tenant_disabled"
+	Internal              Code = "internal_error"
+)
+
+// Entry describes one code in the catalog.
+type Entry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var catalog = []Entry{
+	{InvalidBody, http.StatusBadRequest, "request body or query is malformed or fails validation"},
+	{Unauthorized, http.StatusUnauthorized, "missing, invalid or expired access token"},
+	{InvalidCredentials, http.StatusUnauthorized, "username or password is wrong"},
+	{InvalidRefresh, http.StatusUnauthorized, "refresh token is unknown, revoked or expired"},
+	{AccountDisabled, http.StatusForbidden, "the account has been disabled by an administrator"},
+	{Forbidden, http.StatusForbidden, "authenticated but not allowed to access the resource"},
+	{NotFound, http.StatusNotFound, "resource or route does not exist"},
+	{Duplicate, http.StatusConflict, "resource already exists"},
+	{ProfileMissing, http.StatusBadRequest, "the user has no profile yet"},
+	{MissingFile, http.StatusBadRequest, "multipart field \"file\" is missing"},
+	{FileTooLarge, http.StatusBadRequest, "uploaded file exceeds the size limit"},
+	{UnsupportedType, http.StatusBadRequest, "uploaded file type is not accepted"},
+	{InvalidFile, http.StatusBadRequest, "uploaded file could not be read"},
+	{AmountNotFound, http.StatusBadRequest, "OCR found no amount on the receipt"},
+	{UnsupportedAPIVersion, http.StatusNotFound, "the requested API version does not exist"},
+	{CreateFailed, http.StatusInternalServerError, "storing the resource failed"},
+	{QueryFailed, http.StatusInternalServerError, "reading from the database failed"},
+	{TokenFailed, http.StatusInternalServerError, "issuing tokens failed"},
+	{RevokeFailed, http.StatusInternalServerError, "revoking the token failed"},
+	{ContextMissing, http.StatusInternalServerError, "authentication context was not set"},
+	{OpenFailed, http.StatusInternalServerError, "opening the uploaded file failed"},
+	{DBSaveFailed, http.StatusInternalServerError, "saving the upload record failed"},
+	{MkdirFailed, http.StatusInternalServerError, "creating the storage directory failed"},
+	{SaveFailed, http.StatusInternalServerError, "writing the file to storage failed"},
+	{OCRError, http.StatusInternalServerError, "the OCR engine failed"},
+	{IngestDisabled, http.StatusServiceUnavailable, "ingestion is not configured on this server"},
+	{PeriodLocked, http.StatusConflict, "the catatan falls in a closed accounting period"},
+	{Maintenance, http.StatusServiceUnavailable, "the service is in maintenance mode; only reads are accepted"},
+	{RateLimited, http.StatusTooManyRequests, "too many requests; retry after the Retry-After delay"},
+	{UsernameCooldown, http.StatusTooManyRequests, "the username was changed too recently; retry after the Retry-After delay"},
+	{QuotaExceeded, http.StatusForbidden, "a limit of the user's role is reached"},
+	{RateUnavailable, http.StatusBadGateway, "no exchange rate is known for a currency and day being converted"},
+	{DBUnavailable, http.StatusServiceUnavailable, "the database is unreachable; retry after the Retry-After delay"},
+	{JobRunning, http.StatusConflict, "the job is already running on one of the servers"},
+	{TenantNotFound, http.StatusNotFound, "no tenant goes by the request's subdomain or X-Tenant header"},
+	{TenantDisabled, http.StatusForbidden, "the tenant has been suspended"},
+	{Internal, http.StatusInternalServerError, "unexpected server error"},
+}
+
+var byCode = func() map[Code]Entry {
+	m := make(map[Code]Entry, len(catalog))
+	for _, e := range catalog {
+		m[e.Code] = e
+	}
+	return m
+}()
+
+// Catalog returns every registered code.
+func Catalog() []Entry {
+	return append([]Entry(nil), catalog...)
+}
+
+// Lookup returns the catalog entry for code.
+func Lookup(code Code) (Entry, bool) {
+	e, ok := byCode[code]
+	return e, ok
+}
+
+// Status returns the HTTP status for code; unknown codes map to 500.
+func Status(code Code) int {
+	if e, ok := byCode[code]; ok {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Response is the JSON error envelope.
+type Response struct {
+	Code      Code           `json:"code"`
+	Error     Code           `json:"error"`
+	Message   string         `json:"message,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// New builds an envelope for code.
+func New(code Code, message string, details map[string]any, requestID string) Response {
+	return Response{Code: code, Error: code, Message: message, Details: details, RequestID: requestID}
+}
@@ -0,0 +1,53 @@
+package apierr
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCatalogIsConsistent(t *testing.T) {
+	seen := map[Code]bool{}
+	for _, e := range Catalog() {
+		if seen[e.Code] {
+			t.Errorf("duplicate code %q", e.Code)
+		}
+		seen[e.Code] = true
+		if e.Status < 400 || e.Status > 599 {
+			t.Errorf("code %q has non-error status %d", e.Code, e.Status)
+		}
+		if e.Description == "" {
+			t.Errorf("code %q has no description", e.Code)
+		}
+	}
+	if Status("no_such_code") != http.StatusInternalServerError {
+		t.Error("unknown codes must map to 500")
+	}
+}
+
+func TestResponseShape(t *testing.T) {
+	b, err := json.Marshal(New(NotFound, "profile not found", map[string]any{"id": 7}, "req-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(b, &got)
+	want := map[string]any{"code": "not_found", "error": "not_found", "message": "profile not found", "request_id": "req-1"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if d, _ := got["details"].(map[string]any); d["id"] != float64(7) {
+		t.Errorf("details = %v", got["details"])
+	}
+
+	b, _ = json.Marshal(New(Unauthorized, "", nil, ""))
+	got = map[string]any{}
+	_ = json.Unmarshal(b, &got)
+	for _, k := range []string{"message", "details", "request_id"} {
+		if _, ok := got[k]; ok {
+			t.Errorf("empty %s should be omitted: %s", k, b)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package apitokens issues personal access tokens: long-lived bearer tokens a
+// user creates so spreadsheets and BI tools can read their data without the
+// login password or a refresh token. Tokens are read-only; their scopes admit
+// them to the GET routes listed in Routes and nowhere else, so a route added
+// later stays closed to them until it is listed.
+package apitokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Prefix starts every token, which tells them apart from JWT access tokens.
+const Prefix = "be03_pat_"
+
+// Scopes.
+const (
+	ScopeReadCatatan = "read:catatan" // catatan, accounts and goals
+	ScopeReadReports = "read:reports" // totals, summaries and exports
+)
+
+// All lists every scope.
+var All = []string{ScopeReadCatatan, ScopeReadReports}
+
+// Routes maps "METHOD route" (route as registered, without the API version
+// prefix) to the scope admitting tokens to it; "" admits any token.
+var Routes = map[string]string{
+	"GET /me":                   "",
+	"GET /catatan":              ScopeReadCatatan,
+	"GET /catatan/suspect":      ScopeReadCatatan,
+	"GET /catatan/pending":      ScopeReadCatatan,
+	"GET /catatan/map":          ScopeReadCatatan,
+	"GET /accounts":             ScopeReadCatatan,
+	"GET /goals":                ScopeReadCatatan,
+	"GET /views":                ScopeReadCatatan,
+	"GET /catatan/total":        ScopeReadReports,
+	"GET /catatan/revenue":      ScopeReadReports,
+	"GET /catatan/tax":          ScopeReadReports,
+	"GET /catatan/histogram":    ScopeReadReports,
+	"GET /catatan/top":          ScopeReadReports,
+	"GET /catatan/calendar":     ScopeReadReports,
+	"GET /catatan/export":       ScopeReadReports,
+	"GET /accounts/:id/summary": ScopeReadReports,
+	"GET /goals/:id/progress":   ScopeReadReports,
+	"GET /orgs/:id/summary":     ScopeReadReports,
+}
+
+// ErrInvalid is returned by Lookup for unknown and expired tokens.
+var ErrInvalid = errors.New("api token is unknown or expired")
+
+// Is reports whether raw looks like a personal access token.
+func Is(raw string) bool { return strings.HasPrefix(raw, Prefix) }
+
+// Generate returns a new token and the hash to store for it.
+func Generate() (raw, hash string) {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	raw = Prefix + hex.EncodeToString(b)
+	return raw, Hash(raw)
+}
+
+// Hash is the stored form of raw.
+func Hash(raw string) string {
+	h := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(h[:])
+}
+
+// Hint is the part of raw shown in token lists.
+func Hint(raw string) string { return raw[:len(Prefix)+4] }
+
+// Normalize validates scopes and returns them in stored form: sorted, without
+// duplicates, comma-separated. At least one scope is required.
+func Normalize(scopes []string) (string, error) {
+	set := map[string]bool{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !valid(s) {
+			return "", fmt.Errorf("unknown scope %q", s)
+		}
+		set[s] = true
+	}
+	if len(set) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	out := make([]string, 0, len(set))
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ","), nil
+}
+
+func valid(s string) bool {
+	for _, a := range All {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Split returns the scopes of a stored token.
+func Split(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// Allows reports whether a token with scopes may call method on route.
+func Allows(scopes, method, route string) bool {
+	need, ok := Routes[method+" "+route]
+	if !ok {
+		return false
+	}
+	if need == "" {
+		return true
+	}
+	for _, s := range Split(scopes) {
+		if s == need {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup finds the live token raw; it records the use at most once a minute.
+func Lookup(gdb *gorm.DB, raw string, now time.Time) (models.APIToken, error) {
+	var t models.APIToken
+	if err := gdb.Where("token_hash = ?", Hash(raw)).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return t, ErrInvalid
+		}
+		return t, err
+	}
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return t, ErrInvalid
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= time.Minute {
+		t.LastUsedAt = &now
+		gdb.Model(&t).UpdateColumn("last_used_at", now)
+	}
+	return t, nil
+}
@@ -0,0 +1,69 @@
+package apitokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+)
+
+func TestScopes(t *testing.T) {
+	s, err := Normalize([]string{"read:reports", " read:catatan", "read:reports"})
+	if err != nil || s != "read:catatan,read:reports" {
+		t.Fatalf("normalize = %q, %v", s, err)
+	}
+	if _, err := Normalize([]string{"write:catatan"}); err == nil {
+		t.Fatal("unknown scope accepted")
+	}
+	if _, err := Normalize(nil); err == nil {
+		t.Fatal("no scopes accepted")
+	}
+
+	for _, c := range []struct {
+		scopes, method, route string
+		want                  bool
+	}{
+		{"read:catatan", "GET", "/catatan", true},
+		{"read:catatan", "GET", "/catatan/total", false},
+		{"read:reports", "GET", "/catatan/total", true},
+		{"read:reports", "GET", "/me", true},
+		{"read:catatan,read:reports", "POST", "/catatan", false},
+		{"read:catatan,read:reports", "GET", "/me/tokens", false},
+		{"read:catatan,read:reports", "GET", "/me/export", false},
+	} {
+		if got := Allows(c.scopes, c.method, c.route); got != c.want {
+			t.Errorf("Allows(%q, %s %s) = %v", c.scopes, c.method, c.route, got)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	raw, hash := Generate()
+	if !Is(raw) || len(Hint(raw)) != len(Prefix)+4 || hash != Hash(raw) {
+		t.Fatalf("generated %q", raw)
+	}
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	tok := models.APIToken{UserID: 1, Name: "sheets", TokenHash: hash, Hint: Hint(raw), Scopes: ScopeReadCatatan, ExpiresAt: &expires}
+	if err := gdb.Create(&tok).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Lookup(gdb, raw, now)
+	if err != nil || got.ID != tok.ID {
+		t.Fatalf("lookup: %+v %v", got, err)
+	}
+	gdb.First(&tok, tok.ID)
+	if tok.LastUsedAt == nil {
+		t.Fatal("use not recorded")
+	}
+	if _, err := Lookup(gdb, raw+"0", now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unknown token: %v", err)
+	}
+	if _, err := Lookup(gdb, raw, expires); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expired token: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package catatanarchive moves old catatan out of catatan_keuangans into
+// catatan_archives so the hot table stays small on long-lived deployments, and
+// gives readers a source that transparently includes the archive when the
+// requested range reaches past the archive horizon.
+//
+// Archived catatan are read-only: they keep their id (uploads still point at
+// them) but edit, confirm and delete endpoints only see the live table.
+package catatanarchive
+
+import (
+	"errors"
+	"time"
+
+	"be03/models"
+	"be03/pkg/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// horizonKey is the Setting holding the cutoff of the last run (RFC 3339):
+// every catatan dated before it lives in the archive.
+const horizonKey = "catatan_archived_before"
+
+// DefaultBatch is the number of rows moved per transaction.
+const DefaultBatch = 500
+
+// columns are shared by both tables; keep in step with models.CatatanArchive.
+const columns = "id, created_at, updated_at, user_id, file_name, amount, date, content_hash, reference, suspect, suspect_reason, pending, confirmed_at, account_id, date_source, currency, tax, service_charge, split, parent_id, category, description, merchant, tenant_id"
+
+// Cutoff returns the start of the day years before now, in UTC.
+func Cutoff(now time.Time, years int) time.Time {
+	y, m, d := now.UTC().AddDate(-years, 0, 0).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Horizon returns the cutoff of the last run; zero when nothing was archived.
+func Horizon(gdb *gorm.DB) (time.Time, error) {
+	var s models.Setting
+	err := gdb.Where("key = ?", horizonKey).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, s.Value)
+}
+
+// Run archives every confirmed catatan dated before cutoff in batches of
+// batch rows and advances the horizon. Suspect and pending catatan stay
+// behind until their owner confirms them. It returns the number of rows moved.
+func Run(gdb *gorm.DB, cutoff time.Time, batch int) (int64, error) {
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+	var moved int64
+	for {
+		var n int
+		err := gdb.Transaction(func(tx *gorm.DB) error {
+			var rows []models.CatatanKeuangan
+			if err := tx.Where("date < ? AND suspect = ? AND pending = ?", cutoff.UTC(), false, false).
+				Order("id").Limit(batch).Find(&rows).Error; err != nil {
+				return err
+			}
+			n = len(rows)
+			if n == 0 {
+				return nil
+			}
+			now := time.Now()
+			archived := make([]models.CatatanArchive, 0, n)
+			ids := make([]uint, 0, n)
+			for _, r := range rows {
+				archived = append(archived, models.CatatanArchive{
+					ID: r.ID, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt, UserID: r.UserID,
+					FileName: r.FileName, Amount: r.Amount, Date: r.Date, ContentHash: r.ContentHash, Reference: r.Reference, Suspect: r.Suspect,
+					SuspectReason: r.SuspectReason, Pending: r.Pending, ConfirmedAt: r.ConfirmedAt, AccountID: r.AccountID,
+					Currency: r.Currency, Tax: r.Tax, ServiceCharge: r.ServiceCharge, Split: r.Split, ParentID: r.ParentID,
+					Category: r.Category, Description: r.Description, Merchant: r.Merchant, TenantID: r.TenantID, ArchivedAt: now,
+				})
+				ids = append(ids, r.ID)
+			}
+			if err := tx.Create(&archived).Error; err != nil {
+				return err
+			}
+			return tx.Where("id IN ?", ids).Delete(&models.CatatanKeuangan{}).Error
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += int64(n)
+		if n < batch {
+			break
+		}
+	}
+	prev, err := Horizon(gdb)
+	if err != nil {
+		return moved, err
+	}
+	if cutoff.After(prev) {
+		s := models.Setting{Key: horizonKey, Value: cutoff.UTC().Format(time.RFC3339)}
+		if err := gdb.Save(&s).Error; err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// Catatan returns a query over catatan dated from onwards (nil: all of them).
+// When from reaches before the horizon the live table and the archive are
+// unioned under the name catatan_keuangans, so callers add their conditions,
+// ordering and scans as usual.
+func Catatan(gdb *gorm.DB, from *time.Time) *gorm.DB {
+	horizon, err := Horizon(gdb)
+	if err != nil || horizon.IsZero() || (from != nil && !from.Before(horizon)) {
+		return gdb.Model(&models.CatatanKeuangan{})
+	}
+	union := gdb.Session(&gorm.Session{NewDB: true}).Raw(
+		"SELECT " + columns + " FROM catatan_keuangans UNION ALL SELECT " + columns + " FROM catatan_archives")
+	q := gdb.Table("(?) AS catatan_keuangans", union)
+	// the tenancy plugin does not look into the union
+	if id, ok := tenancy.FromContext(gdb.Statement.Context); ok {
+		q = q.Where("catatan_keuangans.tenant_id = ?", id)
+	}
+	return q
+}
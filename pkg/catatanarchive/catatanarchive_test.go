@@ -0,0 +1,62 @@
+package catatanarchive
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestRunAndUnion(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "u1", Password: "secret1"}},
+		Catatan: []fixtures.Catatan{
+			{User: "u1", FileName: "old1.jpg", Amount: 1000, Date: "2015-03-01"},
+			{User: "u1", FileName: "old2.jpg", Amount: 2000, Date: "2016-07-01"},
+			{User: "u1", FileName: "new.jpg", Amount: 4000, Date: "2025-01-10"},
+		},
+	})
+	// a suspect catatan waits for its owner even when it is old
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "old2.jpg").Update("suspect", true)
+
+	cutoff := Cutoff(time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC), 5)
+	if want := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC); !cutoff.Equal(want) {
+		t.Fatalf("cutoff %v, want %v", cutoff, want)
+	}
+	moved, err := Run(gdb, cutoff, 1)
+	if err != nil || moved != 1 {
+		t.Fatalf("run: moved=%d err=%v", moved, err)
+	}
+	if h, _ := Horizon(gdb); !h.Equal(cutoff) {
+		t.Fatalf("horizon %v", h)
+	}
+
+	sum := func(from *time.Time) int64 {
+		var total int64
+		if err := Catatan(gdb, from).Select("COALESCE(SUM(amount), 0)").Scan(&total).Error; err != nil {
+			t.Fatalf("sum: %v", err)
+		}
+		return total
+	}
+	recent := cutoff.AddDate(1, 0, 0)
+	if got := sum(&recent); got != 6000 {
+		t.Fatalf("recent range must skip the archive: %d", got)
+	}
+	if got := sum(nil); got != 7000 {
+		t.Fatalf("all-time total must include the archive: %d", got)
+	}
+	var rows []models.CatatanKeuangan
+	if err := Catatan(gdb, nil).Where("user_id = (SELECT id FROM users WHERE username = ?)", "u1").Order("date").Find(&rows).Error; err != nil || len(rows) != 3 || rows[0].FileName != "old1.jpg" {
+		t.Fatalf("union rows: %+v %v", rows, err)
+	}
+
+	// an earlier cutoff never moves the horizon back
+	if _, err := Run(gdb, cutoff.AddDate(-3, 0, 0), 0); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := Horizon(gdb); !h.Equal(cutoff) {
+		t.Fatalf("horizon moved back to %v", h)
+	}
+}
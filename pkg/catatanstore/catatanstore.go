@@ -0,0 +1,112 @@
+// Package catatanstore creates catatan idempotently. Uniqueness is enforced by
+// the database, on (user_id, file_name), (user_id, content_hash) and
+// (user_id, reference), so concurrent uploads of the same receipt through the
+// API and the watcher end up as one catatan instead of racing a
+// read-then-write check, and so does a new screenshot of a recorded transfer.
+package catatanstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Hash returns the content hash stored on catatan created from data.
+func Hash(data []byte) *string {
+	sum := sha256.Sum256(data)
+	h := hex.EncodeToString(sum[:])
+	return &h
+}
+
+// HashFile is Hash of the file at path; nil when it cannot be read, so the
+// catatan is still created, deduplicated by file name only.
+func HashFile(path string) *string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil
+	}
+	s := hex.EncodeToString(h.Sum(nil))
+	return &s
+}
+
+// Reference is the Reference stored on a catatan for a transaction
+// reference read by OCR; nil when none was read.
+func Reference(ref string) *string {
+	if ref == "" {
+		return nil
+	}
+	return &ref
+}
+
+// TransactionDate picks the date of an OCR catatan and its DateSource: the
+// date printed on the receipt, else the photo's EXIF capture time (see
+// Upload.CapturedAt), else now.
+func TransactionDate(printed, captured *time.Time, now time.Time) (time.Time, string) {
+	if printed != nil {
+		return *printed, models.DateFromReceipt
+	}
+	if captured != nil {
+		return *captured, models.DateFromEXIF
+	}
+	return now, models.DateFromUpload
+}
+
+// Create inserts ct with ON CONFLICT DO NOTHING. When the user already has a
+// catatan with the same file name, content hash or transaction reference, ct
+// is replaced by that row and created is false.
+func Create(gdb *gorm.DB, ct *models.CatatanKeuangan) (created bool, err error) {
+	res := gdb.Clauses(clause.OnConflict{DoNothing: true}).Create(ct)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+	same := gdb.Session(&gorm.Session{NewDB: true}).Where("file_name = ?", ct.FileName)
+	if ct.ContentHash != nil {
+		same = same.Or("content_hash = ?", *ct.ContentHash)
+	}
+	if ct.Reference != nil {
+		same = same.Or("reference = ?", *ct.Reference)
+	}
+	q := gdb.Where("user_id = ?", ct.UserID).Where(same)
+	var existing models.CatatanKeuangan
+	if err := q.Order("id").First(&existing).Error; err != nil {
+		return false, err
+	}
+	*ct = existing
+	return false, nil
+}
+
+// ClearDuplicateKeys prepares an existing catatan_keuangans table for the
+// unique (user_id, content_hash) and (user_id, reference) indexes: where a user
+// has several catatan with the same key, only the oldest keeps it and the
+// others get NULL, so no catatan is lost and the indexes can be created. Run
+// it before migrating CatatanKeuangan; a missing table or column is skipped.
+func ClearDuplicateKeys(gdb *gorm.DB) error {
+	mig := gdb.Migrator()
+	for _, col := range []string{"content_hash", "reference"} {
+		if !mig.HasColumn(&models.CatatanKeuangan{}, col) {
+			continue
+		}
+		err := gdb.Exec(`UPDATE catatan_keuangans SET ` + col + ` = NULL
+			WHERE ` + col + ` IS NOT NULL AND id NOT IN (
+				SELECT MIN(id) FROM catatan_keuangans WHERE ` + col + ` IS NOT NULL GROUP BY user_id, ` + col + `)`).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package catatanstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestCreateUpsert(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "u1", Password: "secret1"}}})
+	var u models.User
+	gdb.Where("username = ?", "u1").First(&u)
+
+	first := models.CatatanKeuangan{UserID: u.ID, FileName: "a.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img"))}
+	if created, err := Create(gdb, &first); err != nil || !created || first.ID == 0 {
+		t.Fatalf("create: %v %v %+v", created, err, first)
+	}
+	for _, dup := range []models.CatatanKeuangan{
+		{UserID: u.ID, FileName: "a.jpg", Amount: 2000, Date: time.Now()},
+		{UserID: u.ID, FileName: "renamed.jpg", Amount: 2000, Date: time.Now(), ContentHash: Hash([]byte("img"))},
+	} {
+		created, err := Create(gdb, &dup)
+		if err != nil || created || dup.ID != first.ID || dup.Amount != 1000 {
+			t.Fatalf("duplicate %v: created=%v err=%v row=%+v", dup.FileName, created, err, dup)
+		}
+	}
+	// a new screenshot of a recorded transfer carries its reference
+	ref := "231012345678"
+	first.Reference = &ref
+	gdb.Save(&first)
+	again := models.CatatanKeuangan{UserID: u.ID, FileName: "shot2.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img2")), Reference: &ref}
+	if created, err := Create(gdb, &again); err != nil || created || again.ID != first.ID {
+		t.Fatalf("same reference: created=%v err=%v row=%+v", created, err, again)
+	}
+	// another user may record the same image
+	other := models.CatatanKeuangan{UserID: 1, FileName: "a.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img"))}
+	if created, err := Create(gdb, &other); err != nil || !created {
+		t.Fatalf("other user: %v %v", created, err)
+	}
+
+	// concurrent creators agree on one row
+	var wg sync.WaitGroup
+	ids := make([]uint, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ct := models.CatatanKeuangan{UserID: u.ID, FileName: "race.jpg", Amount: 500, Date: time.Now()}
+			if _, err := Create(gdb, &ct); err != nil {
+				t.Errorf("create: %v", err)
+			}
+			ids[i] = ct.ID
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id == 0 || id != ids[0] {
+			t.Fatalf("racing creators got different rows: %v", ids)
+		}
+	}
+}
+
+func TestClearDuplicateKeys(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "u1", Password: "secret1"}}})
+	var u models.User
+	gdb.Where("username = ?", "u1").First(&u)
+	// a table from before the unique indexes existed
+	mig := gdb.Migrator()
+	for _, idx := range []string{"idx_user_content_hash", "idx_user_reference"} {
+		if err := mig.DropIndex(&models.CatatanKeuangan{}, idx); err != nil {
+			t.Fatalf("drop %s: %v", idx, err)
+		}
+	}
+	ref := "231012345678"
+	rows := []models.CatatanKeuangan{
+		{UserID: u.ID, FileName: "a.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img")), Reference: &ref},
+		{UserID: u.ID, FileName: "b.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img"))},
+		{UserID: u.ID, FileName: "c.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img2")), Reference: &ref},
+		{UserID: 1, FileName: "a.jpg", Amount: 1000, Date: time.Now(), ContentHash: Hash([]byte("img")), Reference: &ref},
+	}
+	for i := range rows {
+		if err := gdb.Create(&rows[i]).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	if err := ClearDuplicateKeys(gdb); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if err := gdb.AutoMigrate(&models.CatatanKeuangan{}); err != nil {
+		t.Fatalf("migrate after clearing: %v", err)
+	}
+	var got []models.CatatanKeuangan
+	gdb.Order("id").Find(&got, "id IN ?", []uint{rows[0].ID, rows[1].ID, rows[2].ID, rows[3].ID})
+	if len(got) != 4 {
+		t.Fatalf("catatan lost: %d left", len(got))
+	}
+	has := func(s *string) bool { return s != nil }
+	for i, want := range [][2]bool{{true, true}, {false, false}, {true, false}, {true, true}} {
+		if has(got[i].ContentHash) != want[0] || has(got[i].Reference) != want[1] {
+			t.Errorf("%s (user %d): hash=%v reference=%v, want %v", got[i].FileName, got[i].UserID, got[i].ContentHash, got[i].Reference, want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package chatbot lets users submit receipts from chat apps. A Connector speaks one
+// provider's API (Telegram, WhatsApp); Bot holds the provider-independent dialogue:
+// linking a chat to an account with a one-time code, turning photos into uploads and
+// offering confirm / correct buttons for the extracted amount.
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotLinked means the chat is not linked to an account yet.
+	ErrNotLinked = errors.New("chat is not linked to an account")
+	// ErrInvalidCode means the link code is unknown or expired.
+	ErrInvalidCode = errors.New("link code is invalid or expired")
+	// ErrNoAmount means OCR found no amount on the receipt.
+	ErrNoAmount = errors.New("no amount found on the receipt")
+	// ErrDisabled means an administrator deactivated the linked account.
+	ErrDisabled = errors.New("account is disabled")
+)
+
+// PoorImageError is ErrNoAmount blamed on the photo itself; Feedback tells the
+// user what to fix (blur, darkness, resolution).
+type PoorImageError struct{ Feedback string }
+
+func (e *PoorImageError) Error() string { return ErrNoAmount.Error() + ": " + e.Feedback }
+func (e *PoorImageError) Unwrap() error { return ErrNoAmount }
+
+// Incoming is one provider-neutral event from a chat.
+type Incoming struct {
+	ChatID   string
+	Text     string
+	MediaID  string // provider file / media id of a photo or image document
+	FileName string // optional original name of the media
+	Callback string // data of a pressed button
+}
+
+// Button is an inline reply button; Data comes back as Incoming.Callback.
+type Button struct {
+	Label string
+	Data  string
+}
+
+// Reply is a message sent back to a chat.
+type Reply struct {
+	Text    string
+	Buttons []Button
+}
+
+// Connector adapts one chat provider.
+type Connector interface {
+	Provider() string // "telegram", "whatsapp"
+	Download(ctx context.Context, mediaID string) ([]byte, error)
+	Send(ctx context.Context, chatID string, r Reply) error
+}
+
+// Receipt is the outcome of a submitted photo.
+type Receipt struct {
+	CatatanID uint
+	Amount    int64
+	Currency  string
+	Suspect   bool
+}
+
+// Pipeline is the application side of the bot.
+type Pipeline interface {
+	Link(provider, chatID, code string) (username string, err error)
+	Submit(provider, chatID, fileName string, data []byte) (Receipt, error)
+	Confirm(provider, chatID string, catatanID uint) error
+	Correct(provider, chatID string, catatanID uint, amount int64) (Receipt, error)
+}
+
+// Bot runs the dialogue for any number of connectors.
+type Bot struct {
+	Pipeline Pipeline
+
+	mu      sync.Mutex
+	pending map[string]uint // provider/chatID -> catatan awaiting a corrected amount
+}
+
+// New returns a Bot backed by p.
+func New(p Pipeline) *Bot {
+	return &Bot{Pipeline: p, pending: map[string]uint{}}
+}
+
+const helpText = "Kirim foto struk untuk dicatat.\n" +
+	"Belum terhubung? Buat kode di aplikasi (Profil > Hubungkan chat) lalu kirim /link KODE."
+
+// Handle processes one event and sends the reply through conn. Send failures are
+// logged; the provider will not redeliver, so there is nothing to retry.
+func (b *Bot) Handle(ctx context.Context, conn Connector, in Incoming) {
+	r := b.reply(ctx, conn, in)
+	if r.Text == "" {
+		return
+	}
+	if err := conn.Send(ctx, in.ChatID, r); err != nil {
+		log.Printf("chatbot: %s send to %s failed: %v", conn.Provider(), in.ChatID, err)
+	}
+}
+
+func (b *Bot) reply(ctx context.Context, conn Connector, in Incoming) Reply {
+	p := conn.Provider()
+	key := p + "/" + in.ChatID
+	if in.Callback != "" {
+		action, idStr, _ := strings.Cut(in.Callback, ":")
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return Reply{}
+		}
+		switch action {
+		case "confirm":
+			if err := b.Pipeline.Confirm(p, in.ChatID, uint(id)); err != nil {
+				return errorReply(err)
+			}
+			return Reply{Text: "Tercatat. Terima kasih!"}
+		case "correct":
+			b.setPending(key, uint(id))
+			return Reply{Text: "Kirim nominal yang benar, contoh: 125000"}
+		}
+		return Reply{}
+	}
+	if in.MediaID != "" {
+		data, err := conn.Download(ctx, in.MediaID)
+		if err != nil {
+			log.Printf("chatbot: %s download %s failed: %v", p, in.MediaID, err)
+			return Reply{Text: "Maaf, foto tidak bisa diunduh. Coba kirim ulang."}
+		}
+		rc, err := b.Pipeline.Submit(p, in.ChatID, in.FileName, data)
+		if err != nil {
+			return errorReply(err)
+		}
+		return receiptReply(rc, "Nominal terbaca")
+	}
+	text := strings.TrimSpace(in.Text)
+	cmd, arg, _ := strings.Cut(text, " ")
+	switch strings.ToLower(cmd) {
+	case "/link", "/start":
+		if arg = strings.TrimSpace(arg); arg == "" {
+			return Reply{Text: helpText}
+		}
+		username, err := b.Pipeline.Link(p, in.ChatID, arg)
+		if err != nil {
+			return errorReply(err)
+		}
+		return Reply{Text: fmt.Sprintf("Chat terhubung ke akun %s. Silakan kirim foto struk.", username)}
+	case "/help":
+		return Reply{Text: helpText}
+	}
+	if id, ok := b.takePending(key); ok {
+		amt, ok := ParseAmount(text)
+		if !ok {
+			b.setPending(key, id)
+			return Reply{Text: "Nominal tidak valid, kirim angka saja, contoh: 125000"}
+		}
+		rc, err := b.Pipeline.Correct(p, in.ChatID, id, amt)
+		if err != nil {
+			return errorReply(err)
+		}
+		return receiptReply(rc, "Nominal diperbarui")
+	}
+	return Reply{Text: helpText}
+}
+
+func (b *Bot) setPending(key string, id uint) {
+	b.mu.Lock()
+	b.pending[key] = id
+	b.mu.Unlock()
+}
+
+func (b *Bot) takePending(key string) (uint, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id, ok := b.pending[key]
+	delete(b.pending, key)
+	return id, ok
+}
+
+func receiptReply(rc Receipt, prefix string) Reply {
+	text := fmt.Sprintf("%s: %s", prefix, FormatAmount(rc.Amount, rc.Currency))
+	if rc.Suspect {
+		text += "\nNominal ini jauh dari biasanya, mohon dicek."
+	}
+	id := strconv.FormatUint(uint64(rc.CatatanID), 10)
+	return Reply{Text: text, Buttons: []Button{
+		{Label: "Benar", Data: "confirm:" + id},
+		{Label: "Koreksi", Data: "correct:" + id},
+	}}
+}
+
+func errorReply(err error) Reply {
+	var poor *PoorImageError
+	switch {
+	case errors.As(err, &poor):
+		return Reply{Text: poor.Feedback + "."}
+	case errors.Is(err, ErrNotLinked):
+		return Reply{Text: "Chat ini belum terhubung.\n" + helpText}
+	case errors.Is(err, ErrDisabled):
+		return Reply{Text: "Akun yang terhubung dengan chat ini dinonaktifkan."}
+	case errors.Is(err, ErrInvalidCode):
+		return Reply{Text: "Kode tidak valid atau sudah kedaluwarsa. Buat kode baru di aplikasi."}
+	case errors.Is(err, ErrNoAmount):
+		return Reply{Text: "Nominal tidak ditemukan, gunakan foto lain."}
+	}
+	return Reply{Text: "Maaf, struk tidak bisa diproses: " + err.Error()}
+}
+
+// ParseAmount reads a user-typed amount such as "125000", "125.000" or "Rp 125.000".
+func ParseAmount(s string) (int64, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimSpace(strings.TrimPrefix(s, "rp"))
+	// drop a two-digit decimal part ("125.000,00")
+	if n := len(s); n > 3 && (s[n-3] == ',' || s[n-3] == '.') && strings.Count(s, string(s[n-3])) == 1 && strings.ContainsAny(s[:n-3], ".,") {
+		s = s[:n-3]
+	}
+	s = strings.NewReplacer(".", "", ",", "", " ", "").Replace(s)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// FormatAmount renders amount with dot grouping, e.g. "Rp 125.000" for IDR.
+func FormatAmount(amount int64, currency string) string {
+	ds := strconv.FormatInt(amount, 10)
+	var parts []string
+	for len(ds) > 3 {
+		parts = append([]string{ds[len(ds)-3:]}, parts...)
+		ds = ds[:len(ds)-3]
+	}
+	parts = append([]string{ds}, parts...)
+	num := strings.Join(parts, ".")
+	if currency == "" || currency == "IDR" {
+		return "Rp " + num
+	}
+	return currency + " " + num
+}
@@ -0,0 +1,110 @@
+package chatbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type fakeConn struct{ sent []Reply }
+
+func (f *fakeConn) Provider() string { return "test" }
+func (f *fakeConn) Download(context.Context, string) ([]byte, error) {
+	return []byte("img"), nil
+}
+func (f *fakeConn) Send(_ context.Context, _ string, r Reply) error {
+	f.sent = append(f.sent, r)
+	return nil
+}
+func (f *fakeConn) last() Reply { return f.sent[len(f.sent)-1] }
+
+type fakePipeline struct {
+	linked    bool
+	confirmed uint
+	corrected int64
+}
+
+func (p *fakePipeline) Link(_, _, code string) (string, error) {
+	if code != "GOODCODE" {
+		return "", ErrInvalidCode
+	}
+	p.linked = true
+	return "demo", nil
+}
+func (p *fakePipeline) Submit(_, _, _ string, _ []byte) (Receipt, error) {
+	if !p.linked {
+		return Receipt{}, ErrNotLinked
+	}
+	return Receipt{CatatanID: 7, Amount: 125000, Currency: "IDR"}, nil
+}
+func (p *fakePipeline) Confirm(_, _ string, id uint) error {
+	p.confirmed = id
+	return nil
+}
+func (p *fakePipeline) Correct(_, _ string, id uint, amt int64) (Receipt, error) {
+	p.corrected = amt
+	return Receipt{CatatanID: id, Amount: amt}, nil
+}
+
+func TestDialogue(t *testing.T) {
+	p := &fakePipeline{}
+	b := New(p)
+	conn := &fakeConn{}
+	ctx := context.Background()
+
+	b.Handle(ctx, conn, Incoming{ChatID: "1", MediaID: "m1"})
+	if !strings.Contains(conn.last().Text, "belum terhubung") {
+		t.Fatalf("unlinked photo reply = %q", conn.last().Text)
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Text: "/link BADCODE"})
+	if !strings.Contains(conn.last().Text, "Kode tidak valid") {
+		t.Fatalf("bad code reply = %q", conn.last().Text)
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Text: "/start GOODCODE"})
+	if !p.linked {
+		t.Fatal("link not called")
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", MediaID: "m1"})
+	r := conn.last()
+	if !strings.Contains(r.Text, "Rp 125.000") || len(r.Buttons) != 2 || r.Buttons[0].Data != "confirm:7" {
+		t.Fatalf("receipt reply = %+v", r)
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Callback: "confirm:7"})
+	if p.confirmed != 7 {
+		t.Fatalf("confirmed = %d", p.confirmed)
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Callback: "correct:7"})
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Text: "abc"})
+	if p.corrected != 0 || !strings.Contains(conn.last().Text, "tidak valid") {
+		t.Fatalf("invalid correction accepted: %d %q", p.corrected, conn.last().Text)
+	}
+	b.Handle(ctx, conn, Incoming{ChatID: "1", Text: "Rp 130.000"})
+	if p.corrected != 130000 {
+		t.Fatalf("corrected = %d", p.corrected)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := map[string]int64{"125000": 125000, "125.000": 125000, "Rp 1.250.000": 1250000, "125.000,00": 125000, "0": 0, "abc": 0}
+	for in, want := range cases {
+		got, _ := ParseAmount(in)
+		if got != want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	body := `{"entry":[{"changes":[{"value":{"messages":[
+		{"from":"628123","type":"image","image":{"id":"media-1"}},
+		{"from":"628123","type":"interactive","interactive":{"button_reply":{"id":"confirm:3"}}},
+		{"from":"628123","type":"sticker"}
+	]}}]}]}`
+	got, err := ParseWebhook([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].MediaID != "media-1" || got[1].Callback != "confirm:3" {
+		t.Fatalf("ParseWebhook = %+v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram is a Connector for the Telegram Bot API using long polling.
+type Telegram struct {
+	api *tgbotapi.BotAPI
+}
+
+// NewTelegram authenticates with the bot token from @BotFather.
+func NewTelegram(token string) (*Telegram, error) {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Telegram{api: api}, nil
+}
+
+// Provider implements Connector.
+func (t *Telegram) Provider() string { return "telegram" }
+
+// Download implements Connector. mediaID is a Telegram file_id.
+func (t *Telegram) Download(ctx context.Context, mediaID string) ([]byte, error) {
+	u, err := t.api.GetFileDirectURL(mediaID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telegram file download: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+}
+
+// Send implements Connector; buttons become an inline keyboard on one row.
+func (t *Telegram) Send(_ context.Context, chatID string, r Reply) error {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return err
+	}
+	msg := tgbotapi.NewMessage(id, r.Text)
+	if len(r.Buttons) > 0 {
+		row := make([]tgbotapi.InlineKeyboardButton, 0, len(r.Buttons))
+		for _, b := range r.Buttons {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(b.Label, b.Data))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	}
+	_, err = t.api.Send(msg)
+	return err
+}
+
+// Run long-polls for updates and hands them to bot until ctx is cancelled.
+func (t *Telegram) Run(ctx context.Context, bot *Bot) {
+	cfg := tgbotapi.NewUpdate(0)
+	cfg.Timeout = 50
+	updates := t.api.GetUpdatesChan(cfg)
+	defer t.api.StopReceivingUpdates()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			if in, ok := telegramIncoming(u); ok {
+				if u.CallbackQuery != nil {
+					// stop the button's loading spinner
+					_, _ = t.api.Request(tgbotapi.NewCallback(u.CallbackQuery.ID, ""))
+				}
+				bot.Handle(ctx, t, in)
+			}
+		}
+	}
+}
+
+// telegramIncoming converts an update; photos use the largest size offered and
+// image documents (sent "as file", uncompressed) are accepted too.
+func telegramIncoming(u tgbotapi.Update) (Incoming, bool) {
+	if q := u.CallbackQuery; q != nil && q.Message != nil {
+		return Incoming{ChatID: strconv.FormatInt(q.Message.Chat.ID, 10), Callback: q.Data}, true
+	}
+	m := u.Message
+	if m == nil {
+		return Incoming{}, false
+	}
+	in := Incoming{ChatID: strconv.FormatInt(m.Chat.ID, 10), Text: m.Text}
+	switch {
+	case len(m.Photo) > 0:
+		p := m.Photo[len(m.Photo)-1]
+		in.MediaID, in.FileName = p.FileID, p.FileUniqueID+".jpg"
+	case m.Document != nil && (m.Document.MimeType == "image/jpeg" || m.Document.MimeType == "image/png"):
+		in.MediaID, in.FileName = m.Document.FileID, m.Document.FileName
+	}
+	return in, true
+}
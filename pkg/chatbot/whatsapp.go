@@ -0,0 +1,186 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WhatsApp is a Connector for the WhatsApp Business Cloud API. Messages arrive
+// through the webhook (ParseWebhook); replies and media go through the Graph API.
+type WhatsApp struct {
+	PhoneNumberID string
+	Token         string // permanent / system-user access token
+	AppSecret     string // verifies X-Hub-Signature-256 on webhook calls
+	VerifyToken   string // echoed during webhook subscription
+	GraphURL      string // default https://graph.facebook.com/v19.0
+	Client        *http.Client
+}
+
+// Provider implements Connector.
+func (w *WhatsApp) Provider() string { return "whatsapp" }
+
+func (w *WhatsApp) graph() string {
+	if w.GraphURL != "" {
+		return strings.TrimRight(w.GraphURL, "/")
+	}
+	return "https://graph.facebook.com/v19.0"
+}
+
+func (w *WhatsApp) client() *http.Client {
+	if w.Client != nil {
+		return w.Client
+	}
+	return http.DefaultClient
+}
+
+func (w *WhatsApp) do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := w.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("whatsapp %s %s: %s", method, url, resp.Status)
+	}
+	return resp, nil
+}
+
+// Download implements Connector: resolve the media id to a URL, then fetch it.
+func (w *WhatsApp) Download(ctx context.Context, mediaID string) ([]byte, error) {
+	resp, err := w.do(ctx, http.MethodGet, w.graph()+"/"+mediaID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		URL string `json:"url"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp, err = w.do(ctx, http.MethodGet, meta.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+}
+
+// Send implements Connector; buttons become interactive reply buttons (max 3).
+func (w *WhatsApp) Send(ctx context.Context, chatID string, r Reply) error {
+	msg := map[string]any{"messaging_product": "whatsapp", "to": chatID}
+	if len(r.Buttons) == 0 {
+		msg["type"] = "text"
+		msg["text"] = map[string]string{"body": r.Text}
+	} else {
+		buttons := make([]map[string]any, 0, len(r.Buttons))
+		for i, b := range r.Buttons {
+			if i == 3 {
+				break
+			}
+			buttons = append(buttons, map[string]any{"type": "reply", "reply": map[string]string{"id": b.Data, "title": b.Label}})
+		}
+		msg["type"] = "interactive"
+		msg["interactive"] = map[string]any{
+			"type":   "button",
+			"body":   map[string]string{"text": r.Text},
+			"action": map[string]any{"buttons": buttons},
+		}
+	}
+	b, _ := json.Marshal(msg)
+	resp, err := w.do(ctx, http.MethodPost, w.graph()+"/"+w.PhoneNumberID+"/messages", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header against body.
+func (w *WhatsApp) VerifySignature(body []byte, header string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil || w.AppSecret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(w.AppSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// ParseWebhook extracts incoming messages from a webhook payload. Status updates
+// (delivered, read) carry no messages and yield nothing.
+func ParseWebhook(body []byte) ([]Incoming, error) {
+	var p struct {
+		Entry []struct {
+			Changes []struct {
+				Value struct {
+					Messages []struct {
+						From string `json:"from"`
+						Type string `json:"type"`
+						Text struct {
+							Body string `json:"body"`
+						} `json:"text"`
+						Image struct {
+							ID string `json:"id"`
+						} `json:"image"`
+						Document struct {
+							ID       string `json:"id"`
+							Filename string `json:"filename"`
+							MimeType string `json:"mime_type"`
+						} `json:"document"`
+						Interactive struct {
+							ButtonReply struct {
+								ID string `json:"id"`
+							} `json:"button_reply"`
+						} `json:"interactive"`
+					} `json:"messages"`
+				} `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	var out []Incoming
+	for _, e := range p.Entry {
+		for _, ch := range e.Changes {
+			for _, m := range ch.Value.Messages {
+				in := Incoming{ChatID: m.From}
+				switch m.Type {
+				case "text":
+					in.Text = m.Text.Body
+				case "image":
+					in.MediaID, in.FileName = m.Image.ID, m.Image.ID+".jpg"
+				case "document":
+					if m.Document.MimeType != "image/jpeg" && m.Document.MimeType != "image/png" {
+						continue
+					}
+					in.MediaID, in.FileName = m.Document.ID, m.Document.Filename
+				case "interactive":
+					in.Callback = m.Interactive.ButtonReply.ID
+				default:
+					continue
+				}
+				out = append(out, in)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,117 @@
+// Package cleanup deletes catatan in bulk (unlinking their uploads first) for a
+// scope of user, date range, zero amounts and/or failed uploads. It backs
+// POST /admin/cleanup and the legacy scripts/cleanup_catatan tool.
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"be03/models"
+	"be03/pkg/periodlock"
+
+	"gorm.io/gorm"
+)
+
+// ErrUserNotFound is returned when Scope.Username does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// sampleSize bounds the ids echoed back in a Result.
+const sampleSize = 50
+
+// batchSize bounds IN lists so huge cleanups stay within driver parameter limits.
+const batchSize = 1000
+
+// Scope selects catatan to delete. Empty fields do not filter; an entirely empty
+// scope matches every catatan.
+type Scope struct {
+	Username       string     `json:"username,omitempty"`
+	From           *time.Time `json:"from,omitempty"` // inclusive
+	To             *time.Time `json:"to,omitempty"`   // exclusive
+	ZeroAmountOnly bool       `json:"zero_amount_only,omitempty"`
+	FailedOnly     bool       `json:"failed_only,omitempty"` // only catatan linked to uploads marked failed
+}
+
+// Global reports whether the scope matches every catatan.
+func (s Scope) Global() bool {
+	return s.Username == "" && s.From == nil && s.To == nil && !s.ZeroAmountOnly && !s.FailedOnly
+}
+
+// Result reports what was (or, for a dry run, would be) changed.
+type Result struct {
+	DryRun          bool   `json:"dry_run"`
+	Catatan         int64  `json:"catatan"`
+	UploadsUnlinked int64  `json:"uploads_unlinked"`
+	SkippedLocked   int64  `json:"skipped_locked"` // matched but inside a closed period
+	SampleIDs       []uint `json:"sample_ids"`
+}
+
+// Run applies the cleanup in one transaction; with dryRun nothing is modified.
+func Run(gdb *gorm.DB, scope Scope, dryRun bool) (Result, error) {
+	res := Result{DryRun: dryRun, SampleIDs: []uint{}}
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		q := tx.Model(&models.CatatanKeuangan{})
+		if scope.Username != "" {
+			var user models.User
+			if err := tx.Where("username = ?", scope.Username).First(&user).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrUserNotFound
+				}
+				return err
+			}
+			q = q.Where("user_id = ?", user.ID)
+		}
+		if scope.From != nil {
+			q = q.Where("date >= ?", *scope.From)
+		}
+		if scope.To != nil {
+			q = q.Where("date < ?", *scope.To)
+		}
+		if scope.ZeroAmountOnly {
+			q = q.Where("amount = 0")
+		}
+		if scope.FailedOnly {
+			q = q.Where("id IN (?)", tx.Model(&models.Upload{}).Select("keuangan_id").Where("failed = ? AND keuangan_id IS NOT NULL", true))
+		}
+		q = q.Session(&gorm.Session{})
+		var matched int64
+		if err := q.Count(&matched).Error; err != nil {
+			return fmt.Errorf("count catatan: %w", err)
+		}
+		// closed periods are read-only; their catatan are reported, never deleted
+		var ids []uint
+		if err := q.Where(periodlock.UnlockedCatatan).Order("id").Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("select catatan: %w", err)
+		}
+		res.Catatan = int64(len(ids))
+		res.SkippedLocked = matched - res.Catatan
+		if len(ids) > sampleSize {
+			res.SampleIDs = ids[:sampleSize]
+		} else {
+			res.SampleIDs = ids
+		}
+		for start := 0; start < len(ids); start += batchSize {
+			end := min(start+batchSize, len(ids))
+			batch := ids[start:end]
+			if dryRun {
+				var n int64
+				if err := tx.Model(&models.Upload{}).Where("keuangan_id IN ?", batch).Count(&n).Error; err != nil {
+					return err
+				}
+				res.UploadsUnlinked += n
+				continue
+			}
+			u := tx.Model(&models.Upload{}).Where("keuangan_id IN ?", batch).Update("keuangan_id", nil)
+			if u.Error != nil {
+				return fmt.Errorf("unlink uploads: %w", u.Error)
+			}
+			res.UploadsUnlinked += u.RowsAffected
+			if err := tx.Where("id IN ?", batch).Delete(&models.CatatanKeuangan{}).Error; err != nil {
+				return fmt.Errorf("delete catatan: %w", err)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
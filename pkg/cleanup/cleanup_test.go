@@ -0,0 +1,61 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/periodlock"
+	"be03/pkg/testenv"
+)
+
+func TestRunScopes(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "u1", Password: "secret1"}, {Username: "u2", Password: "secret2"}},
+		Uploads: []fixtures.Upload{
+			{User: "u1", FileName: "bad.jpg", Failed: true},
+			{User: "u1", FileName: "good.jpg"},
+			{User: "u2", FileName: "other.jpg", Failed: true},
+		},
+		Catatan: []fixtures.Catatan{
+			{User: "u1", FileName: "bad.jpg", Amount: 100, Date: "2025-07-15"},
+			{User: "u1", FileName: "good.jpg", Amount: 200, Date: "2025-08-15"},
+			{User: "u2", FileName: "other.jpg", Amount: 300, Date: "2025-08-15"},
+		},
+	})
+
+	res, err := Run(gdb, Scope{Username: "u1", FailedOnly: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Catatan != 1 || res.UploadsUnlinked != 1 {
+		t.Fatalf("failed-only: %+v", res)
+	}
+	var left []string
+	gdb.Model(&models.CatatanKeuangan{}).Order("file_name").Pluck("file_name", &left)
+	if len(left) != 2 || left[0] != "good.jpg" || left[1] != "other.jpg" {
+		t.Fatalf("unexpected remaining catatan: %v", left)
+	}
+
+	from := time.Date(2025, 8, 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+	res, err = Run(gdb, Scope{From: &from, To: &to}, true)
+	if err != nil || res.Catatan != 2 || !res.DryRun {
+		t.Fatalf("date range dry run: %+v %v", res, err)
+	}
+
+	var u2 models.User
+	gdb.Where("username = ?", "u2").First(&u2)
+	if _, _, err := periodlock.Close(gdb, u2.ID, "2025-08", time.Local, u2.ID); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Run(gdb, Scope{From: &from, To: &to}, false)
+	if err != nil || res.Catatan != 1 || res.SkippedLocked != 1 {
+		t.Fatalf("closed period not skipped: %+v %v", res, err)
+	}
+
+	if _, err := Run(gdb, Scope{Username: "nobody"}, true); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
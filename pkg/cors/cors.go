@@ -0,0 +1,187 @@
+// Package cors decides which browser origins may call the API. Policies accept
+// exact origins, wildcard subdomains (https://*.example.com) and regular
+// expressions ("regex:^https://pr-\d+\.preview\.app$"); the active policy can be
+// swapped at runtime and path rules override it for individual endpoints.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy is a parsed set of allowed origins.
+type Policy struct {
+	// Any allows every origin with "Access-Control-Allow-Origin: *" and no
+	// credentials, for public read-only endpoints.
+	Any bool
+	// Off sends no CORS headers at all, for server-to-server endpoints.
+	Off bool
+
+	entries   []string
+	exact     map[string]struct{}
+	wildcards []wildcard
+	regexps   []*regexp.Regexp
+}
+
+type wildcard struct {
+	scheme string // "https"
+	suffix string // ".example.com" (may carry a port)
+}
+
+// Public allows any origin without credentials.
+var Public = &Policy{Any: true, entries: []string{"*"}}
+
+// Off disables CORS for the matched paths.
+var Off = &Policy{Off: true}
+
+// Parse builds a policy from origin entries; blank entries are ignored and "*"
+// allows any origin.
+func Parse(entries []string) (*Policy, error) {
+	p := &Policy{exact: map[string]struct{}{}}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+			continue
+		case e == "*":
+			p.Any = true
+		case strings.HasPrefix(e, "regex:"):
+			src := strings.TrimPrefix(e, "regex:")
+			re, err := regexp.Compile("^(?:" + src + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cors: origin pattern %q: %w", src, err)
+			}
+			p.regexps = append(p.regexps, re)
+		case strings.Contains(e, "*"):
+			scheme, host, ok := strings.Cut(e, "://")
+			if !ok || !strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1 || len(host) < 3 {
+				return nil, fmt.Errorf("cors: wildcard origin %q must look like https://*.example.com", e)
+			}
+			p.wildcards = append(p.wildcards, wildcard{scheme: strings.ToLower(scheme), suffix: strings.ToLower(host[1:])})
+		default:
+			p.exact[strings.TrimRight(e, "/")] = struct{}{}
+		}
+		p.entries = append(p.entries, e)
+	}
+	return p, nil
+}
+
+// ParseList splits a comma separated ALLOWED_ORIGINS value.
+func ParseList(raw string) (*Policy, error) {
+	return Parse(strings.Split(raw, ","))
+}
+
+// Entries returns the configured origin entries.
+func (p *Policy) Entries() []string {
+	return append([]string(nil), p.entries...)
+}
+
+// Allows reports whether origin may call the API under p.
+func (p *Policy) Allows(origin string) bool {
+	if p.Off || origin == "" {
+		return false
+	}
+	if p.Any {
+		return true
+	}
+	if _, ok := p.exact[origin]; ok {
+		return true
+	}
+	if scheme, host, ok := strings.Cut(origin, "://"); ok {
+		scheme, host = strings.ToLower(scheme), strings.ToLower(host)
+		for _, w := range p.wildcards {
+			if scheme == w.scheme && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+				return true
+			}
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule applies Policy to requests whose path starts with one of Prefixes.
+type Rule struct {
+	Prefixes []string
+	Policy   *Policy
+}
+
+// Handler serves CORS headers for the current policy.
+type Handler struct {
+	policy        atomic.Pointer[Policy]
+	rules         []Rule
+	AllowMethods  string
+	AllowHeaders  string
+	ExposeHeaders string
+	MaxAge        time.Duration
+}
+
+// New returns a handler enforcing p, with rules checked first (in order).
+func New(p *Policy, rules ...Rule) *Handler {
+	h := &Handler{
+		rules:         rules,
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:  "Authorization,Content-Type,Accept,Origin,X-Requested-With,X-Request-ID,If-None-Match",
+		ExposeHeaders: "X-Request-ID,Deprecation,Link,Sunset,API-Version,ETag,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset",
+		MaxAge:        12 * time.Hour,
+	}
+	h.policy.Store(p)
+	return h
+}
+
+// Policy returns the active default policy.
+func (h *Handler) Policy() *Policy { return h.policy.Load() }
+
+// Set swaps the default policy; in-flight requests finish with the old one.
+func (h *Handler) Set(p *Policy) { h.policy.Store(p) }
+
+// policyFor picks the rule policy for path, or the default.
+func (h *Handler) policyFor(path string) *Policy {
+	for _, r := range h.rules {
+		for _, prefix := range r.Prefixes {
+			if strings.HasPrefix(path, prefix) {
+				return r.Policy
+			}
+		}
+	}
+	return h.policy.Load()
+}
+
+// Middleware sets the CORS headers and answers preflight requests.
+func (h *Handler) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := h.policyFor(c.Request.URL.Path)
+		origin := c.GetHeader("Origin")
+		if p.Allows(origin) {
+			if p.Any {
+				c.Header("Access-Control-Allow-Origin", "*")
+			} else {
+				c.Header("Access-Control-Allow-Origin", origin)
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			c.Header("Access-Control-Allow-Methods", h.AllowMethods)
+			c.Header("Access-Control-Allow-Headers", h.AllowHeaders)
+			c.Header("Access-Control-Expose-Headers", h.ExposeHeaders)
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(h.MaxAge/time.Second)))
+		}
+		if !p.Any && !p.Off {
+			c.Header("Vary", "Origin")
+		}
+		// Handle preflight quickly
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
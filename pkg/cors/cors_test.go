@@ -0,0 +1,78 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	p, err := ParseList("http://localhost:5173, https://*.example.com,regex:https://pr-\\d+\\.preview\\.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"http://localhost:5173":       true,
+		"http://localhost:3000":       false,
+		"https://app.example.com":     true,
+		"https://a.b.example.com":     true,
+		"https://example.com":         false,
+		"http://app.example.com":      false,
+		"https://evilexample.com":     false,
+		"https://pr-42.preview.app":   true,
+		"https://pr-42.preview.app.x": false,
+		"":                            false,
+	}
+	for origin, want := range cases {
+		if got := p.Allows(origin); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", origin, got, want)
+		}
+	}
+	for _, bad := range []string{"https://*", "https://app.*.com", "regex:("} {
+		if _, err := Parse([]string{bad}); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMiddlewareRulesAndReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p, _ := ParseList("https://app.example.com")
+	h := New(p, Rule{Prefixes: []string{"/health"}, Policy: Public}, Rule{Prefixes: []string{"/hook"}, Policy: Off})
+	r := gin.New()
+	r.Use(h.Middleware())
+	for _, path := range []string{"/api", "/health", "/hook"} {
+		r.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+	origin := func(path, o string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", o)
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := origin("/api", "https://app.example.com"); got != "https://app.example.com" {
+		t.Fatalf("default policy: %q", got)
+	}
+	if got := origin("/health", "https://anything.test"); got != "*" {
+		t.Fatalf("public rule: %q", got)
+	}
+	if got := origin("/hook", "https://app.example.com"); got != "" {
+		t.Fatalf("off rule: %q", got)
+	}
+	np, _ := ParseList("https://other.example.com")
+	h.Set(np)
+	if got := origin("/api", "https://app.example.com"); got != "" {
+		t.Fatalf("old origin still allowed after reload: %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/api", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("preflight: %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,218 @@
+// Package dbhealth keeps the API and the watcher usable through Postgres
+// outages: Retry waits for the database at startup, Breaker counts connection
+// failures seen by GORM and opens after a run of them so callers can answer
+// 503 or pause instead of piling up errors.
+package dbhealth
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// IsConnError reports whether err means the database could not be reached
+// (refused or dropped connection, timeout, server shutting down) as opposed to
+// a failing statement. A query running into its own deadline is not one.
+func IsConnError(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 08: connection exception; 57P01-03: shutdown, cannot connect now
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &connErr), errors.As(err, &netErr),
+		errors.Is(err, driver.ErrBadConn), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "conn closed") || strings.Contains(msg, "connection refused") || strings.Contains(msg, "database is closed")
+}
+
+// Backoff bounds the startup retry: waits start at Initial and double up to
+// Max until Timeout has passed. A zero Timeout tries once.
+type Backoff struct {
+	Initial, Max, Timeout time.Duration
+	sleep                 func(time.Duration) // tests
+}
+
+// BackoffFromEnv reads DB_CONNECT_TIMEOUT (default 60s).
+func BackoffFromEnv() Backoff {
+	b := Backoff{Initial: 500 * time.Millisecond, Max: 10 * time.Second, Timeout: time.Minute}
+	if d, ok := envDuration("DB_CONNECT_TIMEOUT"); ok {
+		b.Timeout = d
+	}
+	return b
+}
+
+// Retry calls connect until it succeeds, fails with something other than a
+// connection error or the backoff runs out; what names the target in the log.
+func Retry(what string, b Backoff, connect func() error) error {
+	sleep := b.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	wait, waited := b.Initial, time.Duration(0)
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil || !IsConnError(err) || waited+wait > b.Timeout {
+			return err
+		}
+		log.Printf("%s unreachable (attempt %d): %v; retrying in %s", what, attempt, err, wait)
+		sleep(wait)
+		waited += wait
+		if wait *= 2; wait > b.Max {
+			wait = b.Max
+		}
+	}
+}
+
+// Breaker opens after Threshold consecutive connection errors. While open,
+// Allow lets one call through per Cooldown as a probe; the first success
+// closes it again. A zero Threshold never opens.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// OnChange, if set, is called when the breaker opens or closes.
+	OnChange func(open bool, err error)
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	probeAt  time.Time // when the next probe may go through
+	now      func() time.Time
+}
+
+// BreakerFromEnv reads DB_BREAKER_THRESHOLD (default 5, 0 disables) and
+// DB_BREAKER_COOLDOWN (default 15s).
+func BreakerFromEnv() *Breaker {
+	b := &Breaker{Threshold: 5, Cooldown: 15 * time.Second}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("DB_BREAKER_THRESHOLD"))); err == nil && n >= 0 {
+		b.Threshold = n
+	}
+	if d, ok := envDuration("DB_BREAKER_COOLDOWN"); ok && d > 0 {
+		b.Cooldown = d
+	}
+	return b
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// Record feeds the outcome of a database call: connection errors count
+// towards opening, anything else proves the database reachable.
+func (b *Breaker) Record(err error) {
+	conn := IsConnError(err)
+	b.mu.Lock()
+	changed := false
+	if conn {
+		b.failures++
+		if b.Threshold > 0 && b.failures >= b.Threshold {
+			changed = !b.open
+			b.open, b.probeAt = true, b.clock().Add(b.Cooldown)
+		}
+	} else {
+		changed = b.open
+		b.failures, b.open = 0, false
+	}
+	open, onChange := b.open, b.OnChange
+	b.mu.Unlock()
+	if changed && onChange != nil {
+		onChange(open, err)
+	}
+}
+
+// Allow reports whether a call should go ahead and, when not, how long until
+// the next probe.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true, 0
+	}
+	now := b.clock()
+	if !now.Before(b.probeAt) {
+		b.probeAt = now.Add(b.Cooldown)
+		return true, 0
+	}
+	return false, b.probeAt.Sub(now)
+}
+
+// Open reports whether the breaker is open.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// Failing reports whether the last database call failed to connect.
+func (b *Breaker) Failing() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures > 0
+}
+
+// RetryAfter is the Retry-After hint for clients: the time to the next probe,
+// at least a second.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.Cooldown
+	if b.open {
+		d = b.probeAt.Sub(b.clock())
+	}
+	return max(d, time.Second)
+}
+
+// Watch feeds the outcome of every statement run through gdb to b.
+func Watch(gdb *gorm.DB, b *Breaker) error {
+	record := func(d *gorm.DB) { b.Record(d.Error) }
+	cb := gdb.Callback()
+	for _, err := range []error{
+		cb.Create().After("gorm:create").Register("dbhealth:create", record),
+		cb.Query().After("gorm:query").Register("dbhealth:query", record),
+		cb.Update().After("gorm:update").Register("dbhealth:update", record),
+		cb.Delete().After("gorm:delete").Register("dbhealth:delete", record),
+		cb.Row().After("gorm:row").Register("dbhealth:row", record),
+		cb.Raw().After("gorm:raw").Register("dbhealth:raw", record),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envDuration(name string) (time.Duration, bool) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("%s=%q is not a duration; ignored", name, v)
+		return 0, false
+	}
+	return d, true
+}
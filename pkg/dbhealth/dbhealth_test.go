@@ -0,0 +1,122 @@
+package dbhealth
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestIsConnError(t *testing.T) {
+	conn := []error{
+		driver.ErrBadConn,
+		fmt.Errorf("query: %w", &pgconn.PgError{Code: "57P01"}),
+		&pgconn.PgError{Code: "08006"},
+		errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"),
+	}
+	for _, err := range conn {
+		if !IsConnError(err) {
+			t.Errorf("IsConnError(%v) = false", err)
+		}
+	}
+	other := []error{nil, gorm.ErrRecordNotFound, &pgconn.PgError{Code: "23505"}, errors.New("syntax error")}
+	for _, err := range other {
+		if IsConnError(err) {
+			t.Errorf("IsConnError(%v) = true", err)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var waits []time.Duration
+	b := Backoff{Initial: time.Second, Max: 4 * time.Second, Timeout: 20 * time.Second, sleep: func(d time.Duration) { waits = append(waits, d) }}
+	calls := 0
+	err := Retry("db", b, func() error {
+		if calls++; calls < 5 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != 5 || fmt.Sprint(waits) != "[1s 2s 4s 4s]" {
+		t.Fatalf("err=%v calls=%d waits=%v", err, calls, waits)
+	}
+
+	// other errors are not retried; the timeout ends the retries
+	calls, waits = 0, nil
+	if err := Retry("db", b, func() error { calls++; return errors.New("password authentication failed") }); err == nil || calls != 1 {
+		t.Fatalf("auth failure: err=%v calls=%d", err, calls)
+	}
+	calls = 0
+	if err := Retry("db", b, func() error { calls++; return driver.ErrBadConn }); err == nil || calls != 7 { // waits 1+2+4+4+4+4s
+		t.Fatalf("timeout: err=%v calls=%d waits=%v", err, calls, waits)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var changes []bool
+	b := &Breaker{Threshold: 3, Cooldown: 10 * time.Second, now: func() time.Time { return now }, OnChange: func(open bool, _ error) { changes = append(changes, open) }}
+
+	b.Record(driver.ErrBadConn)
+	b.Record(driver.ErrBadConn)
+	if ok, _ := b.Allow(); !ok || b.Open() || !b.Failing() {
+		t.Fatal("opened below the threshold")
+	}
+	b.Record(errors.New("syntax error")) // the database answered
+	if b.Failing() {
+		t.Fatal("a statement error counted as a connection failure")
+	}
+	for range 3 {
+		b.Record(driver.ErrBadConn)
+	}
+	if ok, wait := b.Allow(); ok || wait != 10*time.Second || b.RetryAfter() != 10*time.Second {
+		t.Fatalf("open breaker allowed a call: %v %v", ok, wait)
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := b.Allow(); !ok {
+		t.Fatal("no probe after the cooldown")
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Fatal("a second probe in the same cooldown")
+	}
+	b.Record(nil)
+	if ok, _ := b.Allow(); !ok || b.Open() {
+		t.Fatal("still open after a successful probe")
+	}
+	if fmt.Sprint(changes) != "[true false]" {
+		t.Fatalf("changes = %v", changes)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	b := &Breaker{Threshold: 2, Cooldown: time.Minute}
+	if err := Watch(gdb, b); err != nil {
+		t.Fatal(err)
+	}
+	down := true
+	gdb.Callback().Query().Before("gorm:query").Register("test:down", func(d *gorm.DB) {
+		if down {
+			d.AddError(driver.ErrBadConn)
+		}
+	})
+	var u models.User
+	gdb.First(&u)
+	gdb.First(&u)
+	if !b.Open() {
+		t.Fatal("breaker did not open on failing queries")
+	}
+	down = false
+	gdb.Limit(1).Find(&u)
+	if b.Open() || b.Failing() {
+		t.Fatal("breaker did not close once queries succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+// Package digest compiles the weekly activity summary sent to every user
+// through the notification subsystem.
+package digest
+
+import (
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+// maxListed bounds the categories and failed uploads named in a digest.
+const maxListed = 5
+
+// CategoryTotal is the amount recorded under one category during the week.
+type CategoryTotal struct {
+	Name  string `json:"name"`
+	Total int64  `json:"total"`
+}
+
+// Digest summarises one user's week.
+type Digest struct {
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"` // exclusive
+	Total         int64           `json:"total"`
+	Count         int64           `json:"count"`
+	TopCategories []CategoryTotal `json:"top_categories"`
+	// FailedUploads names uploads from the week that failed OCR and are still
+	// not linked to a catatan; FailedCount counts all of them.
+	FailedUploads []string `json:"failed_uploads"`
+	FailedCount   int64    `json:"failed_count"`
+}
+
+// Empty reports whether there is nothing worth sending.
+func (d Digest) Empty() bool { return d.Count == 0 && d.FailedCount == 0 }
+
+// WeekOf returns the Monday-to-Monday week containing t, in loc.
+func WeekOf(t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	start = time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 7)
+}
+
+// Compile gathers userID's activity in [from, to).
+func Compile(gdb *gorm.DB, userID uint, from, to time.Time) (Digest, error) {
+	d := Digest{From: from, To: to, TopCategories: []CategoryTotal{}, FailedUploads: []string{}}
+	inWeek := gdb.Model(&models.CatatanKeuangan{}).Where("catatan_keuangans.user_id = ? AND date >= ? AND date < ? AND pending = ? AND split = ?", userID, from.UTC(), to.UTC(), false, false)
+	var sum struct {
+		Total int64
+		Count int64
+	}
+	if err := inWeek.Session(&gorm.Session{}).Select("COALESCE(SUM(amount), 0) AS total, COUNT(*) AS count").Scan(&sum).Error; err != nil {
+		return d, err
+	}
+	d.Total, d.Count = sum.Total, sum.Count
+	// uncategorized catatan count towards the total but are no category
+	if err := inWeek.Session(&gorm.Session{}).
+		Select("catatan_keuangans.category AS name, SUM(catatan_keuangans.amount) AS total").
+		Where("catatan_keuangans.category <> ''").
+		Group("catatan_keuangans.category").Order("total desc").Limit(maxListed).
+		Scan(&d.TopCategories).Error; err != nil {
+		return d, err
+	}
+	failed := gdb.Model(&models.Upload{}).
+		Joins("JOIN profiles ON profiles.id = uploads.profile_id").
+		Where("profiles.user_id = ? AND uploads.failed = ? AND uploads.keuangan_id IS NULL AND uploads.created_at >= ? AND uploads.created_at < ?", userID, true, from.UTC(), to.UTC())
+	if err := failed.Session(&gorm.Session{}).Count(&d.FailedCount).Error; err != nil {
+		return d, err
+	}
+	if err := failed.Session(&gorm.Session{}).Order("uploads.id").Limit(maxListed).Pluck("uploads.file_name", &d.FailedUploads).Error; err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// Data renders d as notify.KindWeeklySummary template data; dates are shown
+// in loc with To as the last day of the week.
+func (d Digest) Data(loc *time.Location) map[string]any {
+	top := make([]string, 0, len(d.TopCategories))
+	for _, c := range d.TopCategories {
+		top = append(top, c.Name)
+	}
+	return map[string]any{
+		"From":   d.From.In(loc).Format("2006-01-02"),
+		"To":     d.To.In(loc).AddDate(0, 0, -1).Format("2006-01-02"),
+		"Total":  d.Total,
+		"Count":  d.Count,
+		"Top":    strings.Join(top, ", "),
+		"Failed": d.FailedCount,
+	}
+}
+
+// SendDue sends last week's digest to every non-administrator user who has not
+// received one since their current week began (in their timezone). Users with
+// an empty week are skipped. It returns the number of digests sent.
+func SendDue(gdb *gorm.DB, now time.Time) (int, error) {
+	var users []models.User
+	err := gdb.Model(&models.User{}).
+		Joins("LEFT JOIN roles ON roles.id = users.role_id").
+		Where("users.deleted_at IS NULL AND (roles.name IS NULL OR roles.name <> ?)", "administrator").
+		Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, u := range users {
+		prefs := models.DefaultPreferences(u.ID)
+		gdb.Where("user_id = ?", u.ID).First(&prefs)
+		loc := prefs.Location()
+		thisWeek, _ := WeekOf(now, loc)
+		var n int64
+		gdb.Model(&models.Notification{}).Where("user_id = ? AND kind = ? AND created_at >= ?", u.ID, notify.KindWeeklySummary, thisWeek.UTC()).Count(&n)
+		if n > 0 {
+			continue
+		}
+		d, err := Compile(gdb, u.ID, thisWeek.AddDate(0, 0, -7), thisWeek)
+		if err != nil {
+			return sent, err
+		}
+		if d.Empty() {
+			continue
+		}
+		if _, err := notify.Notify(gdb, u.ID, notify.KindWeeklySummary, d.Data(loc)); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
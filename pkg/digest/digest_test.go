@@ -0,0 +1,71 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestWeekOf(t *testing.T) {
+	sun := time.Date(2025, 8, 17, 23, 0, 0, 0, time.UTC)
+	start, end := WeekOf(sun, time.UTC)
+	if !start.Equal(time.Date(2025, 8, 11, 0, 0, 0, 0, time.UTC)) || !end.Equal(start.AddDate(0, 0, 7)) {
+		t.Fatalf("week of %v: %v - %v", sun, start, end)
+	}
+	// 23:00 UTC Sunday is already Monday in Jakarta
+	jkt := time.FixedZone("WIB", 7*3600)
+	if start, _ = WeekOf(sun, jkt); start.Day() != 18 {
+		t.Fatalf("expected the next week in WIB, got %v", start)
+	}
+}
+
+func TestSendDue(t *testing.T) {
+	now := time.Now().UTC()
+	thisWeek, _ := WeekOf(now, time.UTC)
+	lastWeek := thisWeek.AddDate(0, 0, -7)
+	day := func(n int) string { return lastWeek.AddDate(0, 0, n).Format(time.RFC3339) }
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users:   []fixtures.User{{Username: "u1", Password: "secret1"}, {Username: "u2", Password: "secret2"}},
+		Uploads: []fixtures.Upload{{User: "u1", FileName: "blur.jpg", Failed: true}},
+		Catatan: []fixtures.Catatan{
+			{User: "u1", FileName: "a.jpg", Amount: 40000, Date: day(1)},
+			{User: "u1", FileName: "b.jpg", Amount: 60000, Date: day(3)},
+			{User: "u1", FileName: "old.jpg", Amount: 999, Date: day(-2)},
+		},
+	})
+	var u1 models.User
+	gdb.Where("username = ?", "u1").First(&u1)
+	gdb.Create(&models.Preferences{UserID: u1.ID, Currency: "IDR", Timezone: "UTC", Language: "en"})
+	gdb.Model(&models.Upload{}).Where("file_name = ?", "blur.jpg").Update("created_at", lastWeek.AddDate(0, 0, 2))
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "b.jpg").Update("category", "Makan")
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "old.jpg").Update("category", "Transport")
+
+	d, err := Compile(gdb, u1.ID, lastWeek, thisWeek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Total != 100000 || d.Count != 2 || d.FailedCount != 1 || d.FailedUploads[0] != "blur.jpg" {
+		t.Fatalf("digest: %+v", d)
+	}
+	// a.jpg is uncategorized and old.jpg from another week
+	if len(d.TopCategories) != 1 || d.TopCategories[0] != (CategoryTotal{Name: "Makan", Total: 60000}) {
+		t.Fatalf("top categories: %+v", d.TopCategories)
+	}
+
+	sent, err := SendDue(gdb, now)
+	if err != nil || sent != 1 {
+		t.Fatalf("expected one digest (u2 had an empty week): sent=%d err=%v", sent, err)
+	}
+	var n models.Notification
+	gdb.Where("user_id = ?", u1.ID).First(&n)
+	if !strings.Contains(n.Body, "IDR 100.000") || !strings.Contains(n.Body, "Top categories: Makan.") || !strings.Contains(n.Body, "1 failed upload") {
+		t.Fatalf("body: %q", n.Body)
+	}
+	if sent, _ = SendDue(gdb, now); sent != 0 {
+		t.Fatalf("digest sent twice in one week")
+	}
+}
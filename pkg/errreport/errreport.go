@@ -0,0 +1,191 @@
+// Package errreport sends server errors (handler panics, 5xx responses,
+// watcher and OCR failures) to an error tracker. The reporter is pluggable:
+// Sentry by default when SENTRY_DSN is set, the log, or nothing. Messages are
+// scrubbed of secrets and amounts before they leave the process.
+package errreport
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/pkg/apitokens"
+	"be03/pkg/logredact"
+)
+
+// Event is one error to report.
+type Event struct {
+	Level   string // "error" (default), "fatal" for panics, or "warning"
+	Message string
+	Err     error
+	Stack   string // for panics
+	Tags    map[string]string
+	Extra   map[string]any
+	Request *Request
+	UserID  uint
+	Time    time.Time
+}
+
+// Request is the HTTP context of an event. Route is the matched route
+// pattern, never the raw URL, so IDs and query strings stay out of reports.
+type Request struct {
+	Method    string
+	Route     string
+	Status    int
+	RequestID string
+}
+
+// Reporter delivers events. Report must not block the caller for long.
+type Reporter interface {
+	Report(Event)
+}
+
+// Nop drops every event.
+type Nop struct{}
+
+func (Nop) Report(Event) {}
+
+// Log writes events to the standard logger, scrubbed like Sentry events.
+type Log struct{}
+
+func (Log) Report(e Event) {
+	e = Scrubbed(e)
+	line := fmt.Sprintf("error report level=%s msg=%q", e.Level, e.Message)
+	if e.Err != nil {
+		line += fmt.Sprintf(" err=%q", e.Err.Error())
+	}
+	if r := e.Request; r != nil {
+		line += fmt.Sprintf(" %s %s status=%d request_id=%s", r.Method, r.Route, r.Status, r.RequestID)
+	}
+	for k, v := range e.Tags {
+		line += fmt.Sprintf(" %s=%s", k, v)
+	}
+	log.Print(line)
+}
+
+var (
+	mu      sync.RWMutex
+	current Reporter = Nop{}
+)
+
+// Set installs r as the process-wide reporter (nil: Nop).
+func Set(r Reporter) {
+	if r == nil {
+		r = Nop{}
+	}
+	mu.Lock()
+	current = r
+	mu.Unlock()
+}
+
+// Current returns the process-wide reporter.
+func Current() Reporter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Capture reports e through the process-wide reporter.
+func Capture(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Level == "" {
+		e.Level = "error"
+	}
+	Current().Report(e)
+}
+
+// Flush waits up to timeout for the process-wide reporter to deliver queued
+// events, for reporters that queue them.
+func Flush(timeout time.Duration) bool {
+	if f, ok := Current().(interface{ Flush(time.Duration) bool }); ok {
+		return f.Flush(timeout)
+	}
+	return true
+}
+
+// FromEnv builds the reporter selected by ERROR_REPORTER: "sentry" (the
+// default when SENTRY_DSN is set), "log" or "off" (the default otherwise).
+// service names the process ("api", "watcher") in every event.
+func FromEnv(service string) (Reporter, error) {
+	dsn := strings.TrimSpace(os.Getenv("SENTRY_DSN"))
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("ERROR_REPORTER")))
+	if kind == "" && dsn != "" {
+		kind = "sentry"
+	}
+	switch kind {
+	case "", "off", "none":
+		return Nop{}, nil
+	case "log":
+		return Log{}, nil
+	case "sentry":
+		if dsn == "" {
+			return nil, fmt.Errorf("ERROR_REPORTER=sentry needs SENTRY_DSN")
+		}
+		s, err := NewSentry(dsn)
+		if err != nil {
+			return nil, err
+		}
+		s.Service = service
+		s.Environment = strings.TrimSpace(os.Getenv("SENTRY_ENVIRONMENT"))
+		s.Release = strings.TrimSpace(os.Getenv("SENTRY_RELEASE"))
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown ERROR_REPORTER %q (sentry, log or off)", kind)
+}
+
+var (
+	bearerRE = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	jwtRE    = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	patRE    = regexp.MustCompile(regexp.QuoteMeta(apitokens.Prefix) + `[A-Za-z0-9_-]+`)
+	// key=value and "key": "value" pairs naming a secret
+	secretRE   = regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|dsn)[A-Za-z_]*"?\s*[=:]\s*"?)[^\s&",;}]+`)
+	userinfoRE = regexp.MustCompile(`://[^/\s:@]+:[^/\s@]+@`)
+)
+
+// Scrub removes credentials (bearer, JWT and personal access tokens,
+// password=..., URL passwords) and masks amounts, account and phone numbers.
+func Scrub(s string) string {
+	if s == "" {
+		return s
+	}
+	s = bearerRE.ReplaceAllString(s, "$1 [redacted]")
+	s = jwtRE.ReplaceAllString(s, "[redacted]")
+	s = patRE.ReplaceAllString(s, apitokens.Prefix+"[redacted]")
+	s = secretRE.ReplaceAllString(s, "${1}[redacted]")
+	s = userinfoRE.ReplaceAllString(s, "://[redacted]@")
+	return logredact.Mask(s)
+}
+
+// scrubbedError keeps an error's text only, scrubbed.
+type scrubbedError string
+
+func (e scrubbedError) Error() string { return string(e) }
+
+// Scrubbed returns e with its message, error, stack and string extras
+// scrubbed. Tags are set by the code and left as they are.
+func Scrubbed(e Event) Event {
+	e.Message = Scrub(e.Message)
+	if e.Err != nil {
+		e.Err = scrubbedError(Scrub(e.Err.Error()))
+	}
+	e.Stack = Scrub(e.Stack)
+	if len(e.Extra) > 0 {
+		extra := make(map[string]any, len(e.Extra))
+		for k, v := range e.Extra {
+			if s, ok := v.(string); ok {
+				v = Scrub(s)
+			} else if err, ok := v.(error); ok {
+				v = Scrub(err.Error())
+			}
+			extra[k] = v
+		}
+		e.Extra = extra
+	}
+	return e
+}
@@ -0,0 +1,121 @@
+package errreport
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	cases := []struct{ dsn, endpoint, key string }{
+		{"https://abc123@o1.ingest.sentry.io/42", "https://o1.ingest.sentry.io/api/42/store/", "abc123"},
+		{"http://k@sentry.local:9000/sub/path/7", "http://sentry.local:9000/sub/path/api/7/store/", "k"},
+	}
+	for _, c := range cases {
+		endpoint, key, err := ParseDSN(c.dsn)
+		if err != nil || endpoint != c.endpoint || key != c.key {
+			t.Errorf("ParseDSN(%q) = %q, %q, %v", c.dsn, endpoint, key, err)
+		}
+	}
+	for _, bad := range []string{"", "o1.ingest.sentry.io/42", "https://o1.ingest.sentry.io/42", "https://k@host/", "ftp://k@host/1"} {
+		if _, _, err := ParseDSN(bad); err == nil {
+			t.Errorf("ParseDSN(%q) accepted", bad)
+		}
+	}
+}
+
+func TestScrub(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"Authorization: Bearer abc.def-ghi", "Authorization: Bearer [redacted]"},
+		{"token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOjF9.c2ln leaked", "token [redacted] leaked"},
+		{"key be03_pat_Zx9-aa used", "key be03_pat_[redacted] used"},
+		{"dial password=hunter2 host=db", "dial password=[redacted] host=db"},
+		{`{"api_key": "s3cr3t"}`, `{"api_key": "[redacted]"}`},
+		{"postgres://app:pw@db:5432/be03", "postgres://[redacted]@db:5432/be03"},
+		{"amount Rp 125.000 over limit", "amount Rp ###.### over limit"},
+		{"rek 1234567890", "rek ******7890"},
+	}
+	for _, c := range cases {
+		if got := Scrub(c.in); got != c.want {
+			t.Errorf("Scrub(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SENTRY_DSN", "")
+	t.Setenv("ERROR_REPORTER", "")
+	if r, err := FromEnv("api"); err != nil || r != (Nop{}) {
+		t.Fatalf("default = %T, %v", r, err)
+	}
+	t.Setenv("ERROR_REPORTER", "sentry")
+	if _, err := FromEnv("api"); err == nil {
+		t.Fatal("sentry without a DSN accepted")
+	}
+	t.Setenv("ERROR_REPORTER", "")
+	t.Setenv("SENTRY_DSN", "https://k@example.com/1")
+	if r, err := FromEnv("api"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := r.(*Sentry); !ok {
+		t.Fatalf("DSN set: got %T", r)
+	}
+	t.Setenv("ERROR_REPORTER", "carrier-pigeon")
+	if _, err := FromEnv("api"); err == nil {
+		t.Fatal("unknown reporter accepted")
+	}
+}
+
+func TestSentryPostsScrubbedEvent(t *testing.T) {
+	got := make(chan map[string]any, 1)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/5/store/" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("X-Sentry-Auth")
+		b, _ := io.ReadAll(r.Body)
+		var p map[string]any
+		json.Unmarshal(b, &p)
+		got <- p
+	}))
+	defer srv.Close()
+	s, err := NewSentry(strings.Replace(srv.URL, "://", "://pubkey@", 1) + "/5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Service, s.Environment = "api", "test"
+	s.Report(Event{
+		Level:   "error",
+		Message: "HTTP 500 db_save_failed",
+		Err:     errors.New("insert amount 1.250.000 with password=pw failed"),
+		Tags:    map[string]string{"kind": "http"},
+		Request: &Request{Method: "POST", Route: "/api/v1/catatan", Status: 500, RequestID: "r1"},
+		UserID:  7,
+		Time:    time.Now(),
+	})
+	if !s.Flush(5 * time.Second) {
+		t.Fatal("flush timed out")
+	}
+	p := <-got
+	if !strings.Contains(auth, "sentry_key=pubkey") {
+		t.Errorf("auth header %q", auth)
+	}
+	body, _ := json.Marshal(p)
+	for _, leak := range []string{"1.250.000", "password=pw"} {
+		if strings.Contains(string(body), leak) {
+			t.Errorf("payload leaks %q: %s", leak, body)
+		}
+	}
+	tags := p["tags"].(map[string]any)
+	if tags["route"] != "/api/v1/catatan" || tags["service"] != "api" || tags["request_id"] != "r1" || tags["status"] != "500" {
+		t.Errorf("tags = %v", tags)
+	}
+	if p["user"].(map[string]any)["id"] != "7" || p["environment"] != "test" {
+		t.Errorf("payload = %s", body)
+	}
+}
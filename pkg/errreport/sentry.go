@@ -0,0 +1,185 @@
+package errreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sentry posts events to a Sentry project through its store endpoint. Events
+// are sent from a background goroutine; when the queue is full they are
+// dropped rather than slowing requests down.
+type Sentry struct {
+	Service     string // tagged on every event
+	Environment string
+	Release     string
+
+	endpoint string
+	auth     string
+	client   *http.Client
+	queue    chan []byte
+	wg       sync.WaitGroup
+	start    sync.Once
+}
+
+const sentryQueueSize = 100
+
+// ParseDSN splits a Sentry DSN (https://key@host/path/project) into the
+// store endpoint URL and the public key.
+func ParseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(strings.TrimSpace(dsn))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: want scheme://key@host/project")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	if project == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: project id missing")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project), u.User.Username(), nil
+}
+
+// NewSentry returns a reporter for dsn.
+func NewSentry(dsn string) (*Sentry, error) {
+	endpoint, key, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Sentry{
+		endpoint: endpoint,
+		auth:     "Sentry sentry_version=7, sentry_client=be03/1.0, sentry_key=" + key,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan []byte, sentryQueueSize),
+	}, nil
+}
+
+// Report scrubs e and queues it for sending.
+func (s *Sentry) Report(e Event) {
+	body, err := json.Marshal(s.payload(Scrubbed(e)))
+	if err != nil {
+		log.Printf("error report: encoding event failed: %v", err)
+		return
+	}
+	s.start.Do(func() { go s.run() })
+	s.wg.Add(1)
+	select {
+	case s.queue <- body:
+	default:
+		s.wg.Done()
+		log.Printf("error report: queue full, event dropped")
+	}
+}
+
+// Flush waits up to timeout for queued events to be sent and reports whether
+// the queue drained.
+func (s *Sentry) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() { s.wg.Wait(); close(done) }()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *Sentry) run() {
+	for body := range s.queue {
+		s.send(body)
+		s.wg.Done()
+	}
+}
+
+func (s *Sentry) send(body []byte) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		log.Printf("error report: sending to sentry failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("error report: sentry answered %d", resp.StatusCode)
+	}
+}
+
+func (s *Sentry) payload(e Event) map[string]any {
+	id := make([]byte, 16)
+	rand.Read(id)
+	p := map[string]any{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": e.Time.UTC().Format(time.RFC3339),
+		"level":     e.Level,
+		"platform":  "go",
+		"logger":    s.Service,
+		"message":   e.Message,
+	}
+	if s.Environment != "" {
+		p["environment"] = s.Environment
+	}
+	if s.Release != "" {
+		p["release"] = s.Release
+	}
+	tags := map[string]string{}
+	for k, v := range e.Tags {
+		tags[k] = v
+	}
+	if s.Service != "" {
+		tags["service"] = s.Service
+	}
+	extra := map[string]any{}
+	for k, v := range e.Extra {
+		extra[k] = v
+	}
+	if e.Stack != "" {
+		extra["stack"] = e.Stack
+	}
+	if e.Err != nil {
+		typ := e.Tags["kind"]
+		if typ == "" {
+			typ = "error"
+		}
+		p["exception"] = map[string]any{"values": []map[string]string{{"type": typ, "value": e.Err.Error()}}}
+	}
+	if r := e.Request; r != nil {
+		p["request"] = map[string]any{"method": r.Method, "url": r.Route}
+		tags["route"] = r.Route
+		if r.Status != 0 {
+			tags["status"] = strconv.Itoa(r.Status)
+		}
+		if r.RequestID != "" {
+			tags["request_id"] = r.RequestID
+		}
+	}
+	if e.UserID != 0 {
+		p["user"] = map[string]string{"id": strconv.FormatUint(uint64(e.UserID), 10)}
+	}
+	if len(tags) > 0 {
+		p["tags"] = tags
+	}
+	if len(extra) > 0 {
+		p["extra"] = extra
+	}
+	return p
+}
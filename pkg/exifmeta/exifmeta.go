@@ -0,0 +1,135 @@
+// Package exifmeta reads the EXIF metadata of receipt photos that the API
+// keeps alongside an upload.
+package exifmeta
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exifTimeLayout is how EXIF writes DateTimeOriginal.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// earliestCapture rejects camera clocks that were never set.
+var earliestCapture = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ValidCoordinates reports whether lat / lon are a usable position. 0,0 is
+// rejected: it is what devices without a fix write.
+func ValidCoordinates(lat, lon float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return false
+	}
+	return lat != 0 || lon != 0
+}
+
+// Location returns the GPS position recorded in the EXIF of a JPEG; ok is
+// false when the image has no (valid) position.
+func Location(data []byte) (lat, lon float64, ok bool) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	lat, lon, err = x.LatLong()
+	if err != nil || !ValidCoordinates(lat, lon) {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// CaptureTime returns when the photo was taken according to EXIF
+// DateTimeOriginal (DateTime when absent). EXIF stores wall-clock time without
+// a zone, so it is read in loc. ok is false when there is no plausible time:
+// missing, before 2000 or more than a day after now.
+func CaptureTime(data []byte, loc *time.Location, now time.Time) (t time.Time, ok bool) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return time.Time{}, false
+	}
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		if tag, err = x.Get(exif.DateTime); err != nil {
+			return time.Time{}, false
+		}
+	}
+	if tag.Format() != tiff.StringVal {
+		return time.Time{}, false
+	}
+	t, err = time.ParseInLocation(exifTimeLayout, strings.TrimRight(string(tag.Val), "\x00 "), loc)
+	if err != nil || t.Before(earliestCapture) || t.After(now.AddDate(0, 0, 1)) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// CaptureTimeFile is CaptureTime of the image at path.
+func CaptureTimeFile(path string, loc *time.Location, now time.Time) (time.Time, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return CaptureTime(data, loc, now)
+}
+
+// metadataMarkers identify embedded metadata blocks: a JPEG APP1 EXIF or XMP
+// header and a PNG eXIf chunk.
+var metadataMarkers = [][]byte{[]byte("Exif\x00\x00"), []byte("http://ns.adobe.com/xap/1.0/"), []byte("eXIf")}
+
+// Strip returns data re-encoded without its metadata (GPS position, device
+// serials, ...). The pixels are rotated upright first, as the EXIF
+// orientation goes too. Images without metadata, or that cannot be decoded,
+// are returned as is with stripped false.
+func Strip(data []byte) (out []byte, stripped bool) {
+	found := false
+	for _, m := range metadataMarkers {
+		if bytes.Contains(data, m) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return data, false
+	}
+	_, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, false
+	}
+	format, err := imaging.FormatFromExtension(name)
+	if err != nil {
+		return data, false
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return data, false
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format); err != nil {
+		return data, false
+	}
+	return buf.Bytes(), true
+}
+
+// StripFile rewrites the image at path without its metadata; files without
+// any are left untouched.
+func StripFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, stripped := Strip(data)
+	if !stripped {
+		return nil
+	}
+	tmp := path + ".strip"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
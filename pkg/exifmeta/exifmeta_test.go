@@ -0,0 +1,76 @@
+package exifmeta
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"be03/pkg/exifmeta/exiftest"
+)
+
+func TestLocation(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	lat, lon, ok := Location(exiftest.JPEG(img, exiftest.Tags{Lat: -6.2088, Lon: 106.8456}))
+	if !ok || math.Abs(lat+6.2088) > 1e-4 || math.Abs(lon-106.8456) > 1e-4 {
+		t.Fatalf("location = %v, %v, %v", lat, lon, ok)
+	}
+	if _, _, ok := Location(exiftest.JPEG(img, exiftest.Tags{})); ok {
+		t.Fatal("image without GPS reported a location")
+	}
+	if _, _, ok := Location([]byte("not an image")); ok {
+		t.Fatal("garbage reported a location")
+	}
+}
+
+func TestValidCoordinates(t *testing.T) {
+	for _, c := range []struct {
+		lat, lon float64
+		ok       bool
+	}{{-6.2, 106.8, true}, {0, 0, false}, {91, 0, false}, {10, -181, false}, {math.NaN(), 1, false}} {
+		if got := ValidCoordinates(c.lat, c.lon); got != c.ok {
+			t.Errorf("ValidCoordinates(%v, %v) = %v", c.lat, c.lon, got)
+		}
+	}
+}
+
+func TestCaptureTime(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	jkt := time.FixedZone("WIB", 7*3600)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	taken := time.Date(2024, 12, 31, 20, 15, 0, 0, time.UTC)
+	got, ok := CaptureTime(exiftest.JPEG(img, exiftest.Tags{Taken: taken, Lat: 1, Lon: 2}), jkt, now)
+	if want := time.Date(2024, 12, 31, 20, 15, 0, 0, jkt); !ok || !got.Equal(want) {
+		t.Fatalf("capture time = %v, %v; want %v", got, ok, want)
+	}
+	if _, ok := CaptureTime(exiftest.JPEG(img, exiftest.Tags{Taken: now.AddDate(0, 0, 3)}), jkt, now); ok {
+		t.Fatal("a capture time in the future was accepted")
+	}
+	if _, ok := CaptureTime(exiftest.JPEG(img, exiftest.Tags{Taken: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)}), jkt, now); ok {
+		t.Fatal("an unset camera clock was accepted")
+	}
+	if _, ok := CaptureTime(exiftest.JPEG(img, exiftest.Tags{}), jkt, now); ok {
+		t.Fatal("image without a capture time reported one")
+	}
+}
+
+func TestStrip(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	out, stripped := Strip(exiftest.JPEG(img, exiftest.Tags{Lat: -6.2, Lon: 106.8, Taken: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}))
+	if !stripped {
+		t.Fatal("EXIF was not stripped")
+	}
+	if _, _, ok := Location(out); ok {
+		t.Fatal("stripped image still has a location")
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(out)); err != nil || cfg.Width != 32 {
+		t.Fatalf("stripped image does not decode: %v %v", cfg, err)
+	}
+	if _, stripped := Strip([]byte("not an image")); stripped {
+		t.Fatal("garbage reported as stripped")
+	}
+	if again, stripped := Strip(out); stripped || !bytes.Equal(again, out) {
+		t.Fatal("an image without metadata was re-encoded")
+	}
+}
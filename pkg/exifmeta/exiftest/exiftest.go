@@ -0,0 +1,132 @@
+// Package exiftest builds JPEGs carrying EXIF metadata for tests.
+package exiftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"time"
+)
+
+// Tags is the metadata written into the image; zero fields are left out.
+type Tags struct {
+	Lat, Lon float64
+	Taken    time.Time // DateTimeOriginal, written as wall-clock time
+}
+
+// JPEG encodes img with an APP1 EXIF segment holding tags.
+func JPEG(img image.Image, tags Tags) []byte {
+	var enc bytes.Buffer
+	_ = jpeg.Encode(&enc, img, &jpeg.Options{Quality: 90})
+	tiff := buildTIFF(tags)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(app1)+2))
+	out.Write(app1)
+	out.Write(enc.Bytes()[2:]) // drop the encoder's SOI
+	return out.Bytes()
+}
+
+type entry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte // inline when 4 bytes or less, else stored after the IFD
+}
+
+const (
+	typeASCII    = 2
+	typeLong     = 4
+	typeRational = 5
+)
+
+// buildTIFF lays out a little-endian TIFF: IFD0 pointing at a GPS IFD.
+func buildTIFF(tags Tags) []byte {
+	var gps []entry
+	if tags.Lat != 0 || tags.Lon != 0 {
+		latRef, lonRef := "N", "E"
+		if tags.Lat < 0 {
+			latRef = "S"
+		}
+		if tags.Lon < 0 {
+			lonRef = "W"
+		}
+		gps = []entry{
+			{1, typeASCII, 2, []byte(latRef + "\x00")},
+			{2, typeRational, 3, degrees(math.Abs(tags.Lat))},
+			{3, typeASCII, 2, []byte(lonRef + "\x00")},
+			{4, typeRational, 3, degrees(math.Abs(tags.Lon))},
+		}
+	}
+	var sub []entry
+	if !tags.Taken.IsZero() {
+		sub = []entry{{0x9003, typeASCII, 20, []byte(tags.Taken.Format("2006:01:02 15:04:05") + "\x00")}}
+	}
+	// IFD0 points at the Exif and GPS sub-IFDs, which follow it in that order
+	const ifd0At = 8
+	const exifAt = ifd0At + 2 + 2*12 + 4
+	gpsAt := exifAt + ifdSize(sub)
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	le32(&b, ifd0At)
+	writeIFD(&b, ifd0At, []entry{{0x8769, typeLong, 1, u32(exifAt)}, {0x8825, typeLong, 1, u32(gpsAt)}})
+	writeIFD(&b, exifAt, sub)
+	writeIFD(&b, gpsAt, gps)
+	return b.Bytes()
+}
+
+// ifdSize is the number of bytes writeIFD emits for entries.
+func ifdSize(entries []entry) uint32 {
+	n := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			n += uint32(len(e.value))
+		}
+	}
+	return n
+}
+
+// writeIFD appends an IFD starting at offset at, followed by its out-of-line values.
+func writeIFD(b *bytes.Buffer, at uint32, entries []entry) {
+	extraAt := at + 2 + 12*uint32(len(entries)) + 4
+	var extra bytes.Buffer
+	_ = binary.Write(b, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		_ = binary.Write(b, binary.LittleEndian, e.tag)
+		_ = binary.Write(b, binary.LittleEndian, e.typ)
+		le32(b, e.count)
+		if len(e.value) <= 4 {
+			v := make([]byte, 4)
+			copy(v, e.value)
+			b.Write(v)
+			continue
+		}
+		le32(b, extraAt+uint32(extra.Len()))
+		extra.Write(e.value)
+	}
+	le32(b, 0)
+	b.Write(extra.Bytes())
+}
+
+// degrees encodes v as degrees, minutes and seconds rationals.
+func degrees(v float64) []byte {
+	d := math.Floor(v)
+	m := math.Floor((v - d) * 60)
+	s := ((v-d)*60 - m) * 60
+	var b bytes.Buffer
+	for _, r := range [][2]uint32{{uint32(d), 1}, {uint32(m), 1}, {uint32(math.Round(s * 10000)), 10000}} {
+		le32(&b, r[0])
+		le32(&b, r[1])
+	}
+	return b.Bytes()
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func le32(b *bytes.Buffer, v uint32) { _ = binary.Write(b, binary.LittleEndian, v) }
@@ -0,0 +1,172 @@
+// Package featureflags rolls risky features out gradually. A flag is a
+// FeatureFlag row that is on for an allow-list of users and a stable
+// percentage of the rest; flags without a row take the default declared in
+// Known. The API servers and the watcher read flags through a Cache.
+package featureflags
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/models"
+	"be03/pkg/ocr"
+
+	"gorm.io/gorm"
+)
+
+// Flags checked by the code.
+const (
+	OCRItemized = "ocr_itemized" // line items read from receipts (OCR_ITEMIZED must be on too)
+	OCRTax      = "ocr_tax"      // tax and service charge read from receipts
+)
+
+// Def is a flag the code checks.
+type Def struct {
+	Default     bool   `json:"default"` // value while the flag has no row
+	Description string `json:"description"`
+}
+
+// Known lists the flags the code checks. Both OCR flags default to on so an
+// unconfigured server behaves as before; a row narrows them to a rollout.
+var Known = map[string]Def{
+	OCRItemized: {Default: true, Description: "store and show receipt line items"},
+	OCRTax:      {Default: true, Description: "detect tax and service charge on receipts"},
+}
+
+var keyRE = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+// ValidKey reports whether key can name a flag: lower-case letters, digits
+// and underscores, starting with a letter.
+func ValidKey(key string) bool { return keyRE.MatchString(key) }
+
+// Bucket places userID in 0-99 for key. It is stable, so raising a flag's
+// percentage only adds users, and differs between flags, so the same users
+// are not always first.
+func Bucket(key string, userID uint) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", key, userID)
+	return int(h.Sum32() % 100)
+}
+
+// On evaluates f for userID. Calls without a user (userID 0) only see flags
+// rolled out to everyone.
+func On(f models.FeatureFlag, userID uint) bool {
+	switch {
+	case !f.Enabled:
+		return false
+	case f.Percent >= 100:
+		return true
+	case userID == 0:
+		return false
+	}
+	for _, id := range ParseUsers(f.Users) {
+		if id == userID {
+			return true
+		}
+	}
+	return Bucket(f.Key, userID) < f.Percent
+}
+
+// ParseUsers reads a Users column; malformed entries are skipped.
+func ParseUsers(s string) []uint {
+	var out []uint
+	for _, p := range strings.Split(s, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32); err == nil && id > 0 {
+			out = append(out, uint(id))
+		}
+	}
+	return out
+}
+
+// FormatUsers writes ids as a Users column, sorted and without duplicates.
+func FormatUsers(ids []uint) string {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, 0, len(sorted))
+	for i, id := range sorted {
+		if i > 0 && id == sorted[i-1] {
+			continue
+		}
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ErrInvalid wraps the validation errors of Save.
+var ErrInvalid = errors.New("invalid feature flag")
+
+// Save validates f and creates or replaces the row for f.Key.
+func Save(gdb *gorm.DB, f *models.FeatureFlag) error {
+	if !ValidKey(f.Key) {
+		return fmt.Errorf("%w: key must be 2-64 lower-case letters, digits or underscores", ErrInvalid)
+	}
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("%w: percent must be between 0 and 100", ErrInvalid)
+	}
+	var existing models.FeatureFlag
+	if err := gdb.Where("key = ?", f.Key).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	f.ID, f.CreatedAt = existing.ID, existing.CreatedAt
+	return gdb.Save(f).Error
+}
+
+// Cache serves flags re-read at most every TTL.
+type Cache struct {
+	TTL time.Duration
+
+	mu    sync.Mutex
+	from  *gorm.DB
+	at    time.Time
+	flags map[string]models.FeatureFlag
+}
+
+// On reports whether key is on for userID. Read errors keep the last flags;
+// a flag that is neither stored nor known is off.
+func (c *Cache) On(gdb *gorm.DB, key string, userID uint) bool {
+	c.mu.Lock()
+	if c.from != gdb || c.at.IsZero() || time.Since(c.at) >= c.TTL {
+		var rows []models.FeatureFlag
+		if err := gdb.Find(&rows).Error; err == nil {
+			c.flags = make(map[string]models.FeatureFlag, len(rows))
+			for _, f := range rows {
+				c.flags[f.Key] = f
+			}
+		}
+		c.from, c.at = gdb, time.Now()
+	}
+	f, ok := c.flags[key]
+	c.mu.Unlock()
+	if !ok {
+		return Known[key].Default
+	}
+	return On(f, userID)
+}
+
+// Invalidate forces the next On to re-read the flags.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.at = time.Time{}
+	c.mu.Unlock()
+}
+
+// GateOCR drops the parts of res whose features are off for userID, before
+// the result is stored or shown.
+func (c *Cache) GateOCR(gdb *gorm.DB, userID uint, res *ocr.Result) {
+	if res == nil {
+		return
+	}
+	if len(res.Items) > 0 && !c.On(gdb, OCRItemized, userID) {
+		res.Items = nil
+	}
+	if res.Tax != nil && !c.On(gdb, OCRTax, userID) {
+		res.Tax = nil
+	}
+}
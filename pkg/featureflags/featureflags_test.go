@@ -0,0 +1,75 @@
+package featureflags
+
+import (
+	"errors"
+	"testing"
+
+	"be03/models"
+	"be03/pkg/ocr"
+	"be03/pkg/testenv"
+)
+
+func TestOn(t *testing.T) {
+	f := models.FeatureFlag{Key: "new_scoring", Enabled: true, Percent: 30, Users: "7, 9,x"}
+	on := 0
+	for uid := uint(1); uid <= 1000; uid++ {
+		if On(f, uid) {
+			on++
+		}
+		if On(f, uid) != On(f, uid) {
+			t.Fatal("rollout is not stable")
+		}
+	}
+	if on < 250 || on > 350 {
+		t.Fatalf("30%% rollout reached %d of 1000 users", on)
+	}
+	for _, uid := range []uint{7, 9} {
+		if !On(f, uid) {
+			t.Errorf("listed user %d is off", uid)
+		}
+	}
+	if On(f, 0) {
+		t.Error("a partial rollout is on without a user")
+	}
+	f.Enabled = false
+	if On(f, 7) {
+		t.Error("disabled flag is on for a listed user")
+	}
+	if got := FormatUsers([]uint{9, 3, 9}); got != "3,9" {
+		t.Errorf("FormatUsers = %q", got)
+	}
+}
+
+func TestCacheAndGate(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	c := &Cache{}
+	if !c.On(gdb, OCRTax, 1) || c.On(gdb, "unknown", 1) {
+		t.Fatal("defaults not applied")
+	}
+	if err := Save(gdb, &models.FeatureFlag{Key: "Bad Key"}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("bad key: %v", err)
+	}
+	if err := Save(gdb, &models.FeatureFlag{Key: OCRTax, Enabled: true, Users: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	// replacing keeps one row per key
+	if err := Save(gdb, &models.FeatureFlag{Key: OCRTax, Enabled: true, Users: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	gdb.Model(&models.FeatureFlag{}).Count(&n)
+	if n != 1 {
+		t.Fatalf("%d rows", n)
+	}
+	c.Invalidate()
+	res := &ocr.Result{Tax: &ocr.Tax{Amount: 100}, Items: []ocr.LineItem{{Name: "Teh", Qty: 1, Price: 5000}}}
+	c.GateOCR(gdb, 2, res)
+	if res.Tax != nil || len(res.Items) != 1 {
+		t.Fatalf("gate for user 2: %+v", res)
+	}
+	res.Tax = &ocr.Tax{Amount: 100}
+	c.GateOCR(gdb, 1, res)
+	if res.Tax == nil {
+		t.Fatal("tax dropped for a listed user")
+	}
+}
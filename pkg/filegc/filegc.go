@@ -0,0 +1,59 @@
+// Package filegc deletes files that outlived their purpose on local disk:
+// staging copies left behind when an upload's final rename failed, and
+// unreadable receipts in public/failed past their retention.
+package filegc
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Result reports one Sweep.
+type Result struct {
+	Dir    string `json:"dir"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Errors int    `json:"errors,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+// Sweep removes the regular files under dir last modified before
+// now-maxAge and returns what was (or, on a dry run, would be) reclaimed.
+// A missing dir is empty; files that cannot be removed are counted in
+// Errors and skipped. Directories and symlinks are left alone. removed, when
+// not nil, is called with the path of every file deleted.
+func Sweep(dir string, maxAge time.Duration, now time.Time, dryRun bool, removed func(path string)) (Result, error) {
+	res := Result{Dir: dir, DryRun: dryRun}
+	cutoff := now.Add(-maxAge)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			res.Errors++
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || !fi.ModTime().Before(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				res.Errors++
+				return nil
+			}
+			if removed != nil {
+				removed(path)
+			}
+		}
+		res.Files++
+		res.Bytes += fi.Size()
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,52 @@
+package filegc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old.jpg", 100, 2*time.Hour)
+	write("nested/old.png", 50, 3*time.Hour)
+	write("fresh.jpg", 70, time.Minute)
+
+	res, err := Sweep(dir, time.Hour, now, true, func(string) { t.Fatal("dry run reported a removal") })
+	if err != nil || res.Files != 2 || res.Bytes != 150 || !res.DryRun {
+		t.Fatalf("dry run: %+v %v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.jpg")); err != nil {
+		t.Fatal("dry run deleted a file")
+	}
+
+	var removed []string
+	res, err = Sweep(dir, time.Hour, now, false, func(p string) { removed = append(removed, p) })
+	if err != nil || res.Files != 2 || res.Bytes != 150 || res.Errors != 0 || len(removed) != 2 {
+		t.Fatalf("sweep: %+v %v removed=%v", res, err, removed)
+	}
+	for name, want := range map[string]bool{"old.jpg": false, "nested/old.png": false, "fresh.jpg": true, "nested": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s exists=%v, want %v", name, err == nil, want)
+		}
+	}
+
+	if res, err := Sweep(filepath.Join(dir, "missing"), time.Hour, now, false, nil); err != nil || res.Files != 0 {
+		t.Fatalf("missing dir: %+v %v", res, err)
+	}
+}
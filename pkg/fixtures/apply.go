@@ -0,0 +1,298 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"be03/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type applier struct {
+	tx         *gorm.DB
+	st         *Stats
+	createOnly bool
+}
+
+// Stats counts rows created and updated per kind.
+type Stats struct {
+	Created map[string]int
+	Updated map[string]int
+}
+
+func newStats() Stats {
+	return Stats{Created: map[string]int{}, Updated: map[string]int{}}
+}
+
+// String renders a compact summary such as "created users=1 updated roles=2".
+func (s Stats) String() string {
+	part := func(label string, m map[string]int) string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := []string{label}
+		for _, k := range keys {
+			out = append(out, fmt.Sprintf("%s=%d", k, m[k]))
+		}
+		return strings.Join(out, " ")
+	}
+	return part("created", s.Created) + "; " + part("updated", s.Updated)
+}
+
+// Apply upserts the set inside a single transaction. Existing rows are matched on
+// natural keys and only updated when a fixture field differs (never when the set is
+// CreateOnly), so applying the same set twice is a no-op.
+func Apply(db *gorm.DB, set *Set) (Stats, error) {
+	st := newStats()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		a := &applier{tx: tx, st: &st, createOnly: set.CreateOnly}
+		for _, r := range set.Roles {
+			if err := a.applyRole(r); err != nil {
+				return err
+			}
+		}
+		profiles := map[string]models.Profile{}
+		for _, u := range set.Users {
+			p, err := a.applyUser(u)
+			if err != nil {
+				return err
+			}
+			profiles[u.Username] = p
+		}
+		profileFor := func(username string) (models.Profile, error) {
+			if p, ok := profiles[username]; ok {
+				return p, nil
+			}
+			p, err := a.ensureProfile(username, nil)
+			if err != nil {
+				return p, err
+			}
+			profiles[username] = p
+			return p, nil
+		}
+		for _, up := range set.Uploads {
+			p, err := profileFor(up.User)
+			if err != nil {
+				return err
+			}
+			if err := a.applyUpload(p, up); err != nil {
+				return err
+			}
+		}
+		for _, ct := range set.Catatan {
+			p, err := profileFor(ct.User)
+			if err != nil {
+				return err
+			}
+			if err := a.applyCatatan(p, ct); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return st, err
+}
+
+func (a *applier) applyRole(r Role) error {
+	var role models.Role
+	err := a.tx.Where("name = ?", r.Name).First(&role).Error
+	switch {
+	case err == nil:
+		if !a.createOnly && r.Description != "" && role.Description != r.Description {
+			if err := a.tx.Model(&role).Update("description", r.Description).Error; err != nil {
+				return fmt.Errorf("update role %s: %w", r.Name, err)
+			}
+			a.st.Updated["roles"]++
+		}
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		role = models.Role{Name: r.Name, Description: r.Description}
+		if err := a.tx.Create(&role).Error; err != nil {
+			return fmt.Errorf("create role %s: %w", r.Name, err)
+		}
+		a.st.Created["roles"]++
+		return nil
+	default:
+		return fmt.Errorf("lookup role %s: %w", r.Name, err)
+	}
+}
+
+func (a *applier) applyUser(u User) (models.Profile, error) {
+	if strings.TrimSpace(u.Username) == "" {
+		return models.Profile{}, fmt.Errorf("fixture user without username")
+	}
+	roleName := u.Role
+	if roleName == "" {
+		roleName = "user"
+	}
+	var role models.Role
+	if err := a.tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return models.Profile{}, fmt.Errorf("user %s: role %q not found: %w", u.Username, roleName, err)
+	}
+	var user models.User
+	err := a.tx.Where("username = ?", u.Username).First(&user).Error
+	switch {
+	case err == nil:
+		if !a.createOnly && (user.RoleID == nil || *user.RoleID != role.ID) {
+			if err := a.tx.Model(&user).Update("role_id", role.ID).Error; err != nil {
+				return models.Profile{}, fmt.Errorf("update user %s: %w", u.Username, err)
+			}
+			a.st.Updated["users"]++
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if len(u.Password) < 6 {
+			return models.Profile{}, fmt.Errorf("user %s: password too short (min 6)", u.Username)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return models.Profile{}, err
+		}
+		rid := role.ID
+		user = models.User{Username: u.Username, HashedPassword: hash, RoleID: &rid}
+		if err := a.tx.Create(&user).Error; err != nil {
+			return models.Profile{}, fmt.Errorf("create user %s: %w", u.Username, err)
+		}
+		a.st.Created["users"]++
+	default:
+		return models.Profile{}, fmt.Errorf("lookup user %s: %w", u.Username, err)
+	}
+	return a.ensureProfile(u.Username, u.Profile)
+}
+
+// ensureProfile upserts the profile of username; a nil fixture creates a placeholder
+// named after the user (mirroring registration) and never overwrites an existing one.
+func (a *applier) ensureProfile(username string, fp *Profile) (models.Profile, error) {
+	var user models.User
+	if err := a.tx.Where("username = ?", username).First(&user).Error; err != nil {
+		return models.Profile{}, fmt.Errorf("user %q not found: %w", username, err)
+	}
+	want := models.Profile{UserID: user.ID, Name: username}
+	if fp != nil {
+		want = models.Profile{UserID: user.ID, Name: fp.Name, Email: fp.Email, Phone: fp.Phone, Address: fp.Address, Occupation: fp.Occupation}
+		if want.Name == "" {
+			want.Name = username
+		}
+	}
+	var p models.Profile
+	err := a.tx.Where("user_id = ?", user.ID).First(&p).Error
+	switch {
+	case err == nil:
+		if fp == nil || a.createOnly {
+			return p, nil
+		}
+		if p.Name != want.Name || p.Email != want.Email || p.Phone != want.Phone || p.Address != want.Address || p.Occupation != want.Occupation {
+			p.Name, p.Email, p.Phone, p.Address, p.Occupation = want.Name, want.Email, want.Phone, want.Address, want.Occupation
+			if err := a.tx.Save(&p).Error; err != nil {
+				return p, fmt.Errorf("update profile for %s: %w", username, err)
+			}
+			a.st.Updated["profiles"]++
+		}
+		return p, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := a.tx.Create(&want).Error; err != nil {
+			return want, fmt.Errorf("create profile for %s: %w", username, err)
+		}
+		a.st.Created["profiles"]++
+		return want, nil
+	default:
+		return p, fmt.Errorf("lookup profile for %s: %w", username, err)
+	}
+}
+
+func (a *applier) applyUpload(p models.Profile, fu Upload) error {
+	if fu.FileName == "" {
+		return fmt.Errorf("upload for %s without file_name", fu.User)
+	}
+	store := fu.StorePath
+	if store == "" {
+		store = "public/keu/" + fu.FileName
+	}
+	var up models.Upload
+	err := a.tx.Where("profile_id = ? AND file_name = ?", p.ID, fu.FileName).First(&up).Error
+	switch {
+	case err == nil:
+		if !a.createOnly && (up.StorePath != store || up.ContentType != fu.ContentType || up.Failed != fu.Failed || up.FailedReason != fu.FailedReason) {
+			up.StorePath, up.ContentType, up.Failed, up.FailedReason = store, fu.ContentType, fu.Failed, fu.FailedReason
+			if err := a.tx.Save(&up).Error; err != nil {
+				return fmt.Errorf("update upload %s: %w", fu.FileName, err)
+			}
+			a.st.Updated["uploads"]++
+		}
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		up = models.Upload{ProfileID: p.ID, FileName: fu.FileName, StorePath: store, ContentType: fu.ContentType, Failed: fu.Failed, FailedReason: fu.FailedReason}
+		if err := a.tx.Create(&up).Error; err != nil {
+			return fmt.Errorf("create upload %s: %w", fu.FileName, err)
+		}
+		a.st.Created["uploads"]++
+		return nil
+	default:
+		return fmt.Errorf("lookup upload %s: %w", fu.FileName, err)
+	}
+}
+
+func (a *applier) applyCatatan(p models.Profile, fc Catatan) error {
+	if fc.FileName == "" {
+		return fmt.Errorf("catatan for %s without file_name", fc.User)
+	}
+	date := time.Now()
+	if fc.Date != "" {
+		t, err := parseDate(fc.Date)
+		if err != nil {
+			return fmt.Errorf("catatan %s: %w", fc.FileName, err)
+		}
+		date = t
+	}
+	var ct models.CatatanKeuangan
+	err := a.tx.Where("user_id = ? AND file_name = ?", p.UserID, fc.FileName).First(&ct).Error
+	switch {
+	case err == nil:
+		if !a.createOnly && (ct.Amount != fc.Amount || (fc.Date != "" && !ct.Date.Equal(date))) {
+			ct.Amount = fc.Amount
+			if fc.Date != "" {
+				ct.Date = date
+			}
+			if err := a.tx.Save(&ct).Error; err != nil {
+				return fmt.Errorf("update catatan %s: %w", fc.FileName, err)
+			}
+			a.st.Updated["catatan"]++
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ct = models.CatatanKeuangan{UserID: p.UserID, FileName: fc.FileName, Amount: fc.Amount, Date: date}
+		if err := a.tx.Create(&ct).Error; err != nil {
+			return fmt.Errorf("create catatan %s: %w", fc.FileName, err)
+		}
+		a.st.Created["catatan"]++
+	default:
+		return fmt.Errorf("lookup catatan %s: %w", fc.FileName, err)
+	}
+	// link the matching upload, if any, like the seeding scripts did
+	res := a.tx.Model(&models.Upload{}).
+		Where("profile_id = ? AND file_name = ? AND keuangan_id IS NULL", p.ID, fc.FileName).
+		Update("keuangan_id", ct.ID)
+	if res.Error != nil {
+		return fmt.Errorf("link upload %s: %w", fc.FileName, res.Error)
+	}
+	if res.RowsAffected > 0 {
+		a.st.Updated["uploads"] += int(res.RowsAffected)
+	}
+	return nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD or RFC3339)", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,116 @@
+// Package fixtures loads declarative data sets (roles, users, profiles, uploads,
+// catatan) from YAML or JSON and applies them to the database with idempotent
+// upserts keyed on natural keys (role name, username, file name). It backs the
+// server's boot-time seeding, `be03ctl seed` and integration tests.
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Set is a collection of records to load.
+type Set struct {
+	// CreateOnly inserts missing rows but never modifies existing ones. The boot-time
+	// default seed uses it so operator edits (e.g. the admin profile) survive restarts.
+	CreateOnly bool `yaml:"create_only" json:"create_only"`
+
+	Roles   []Role    `yaml:"roles" json:"roles"`
+	Users   []User    `yaml:"users" json:"users"`
+	Uploads []Upload  `yaml:"uploads" json:"uploads"`
+	Catatan []Catatan `yaml:"catatan" json:"catatan"`
+}
+
+// Role is keyed by name.
+type Role struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
+
+// User is keyed by username. Password is only applied when the user is created so
+// re-running a fixture never resets a password changed afterwards.
+type User struct {
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	Role     string   `yaml:"role" json:"role"`
+	Profile  *Profile `yaml:"profile" json:"profile"`
+}
+
+// Profile is the one-to-one profile of the enclosing user.
+type Profile struct {
+	Name       string `yaml:"name" json:"name"`
+	Email      string `yaml:"email" json:"email"`
+	Phone      string `yaml:"phone" json:"phone"`
+	Address    string `yaml:"address" json:"address"`
+	Occupation string `yaml:"occupation" json:"occupation"`
+}
+
+// Upload is keyed by (user's profile, file name).
+type Upload struct {
+	User         string `yaml:"user" json:"user"`
+	FileName     string `yaml:"file_name" json:"file_name"`
+	StorePath    string `yaml:"store_path" json:"store_path"`
+	ContentType  string `yaml:"content_type" json:"content_type"`
+	Failed       bool   `yaml:"failed" json:"failed"`
+	FailedReason string `yaml:"failed_reason" json:"failed_reason"`
+}
+
+// Catatan is keyed by (user, file name). Date accepts YYYY-MM-DD or RFC3339.
+// Uploads of the same user and file name are linked to the catatan.
+type Catatan struct {
+	User     string `yaml:"user" json:"user"`
+	FileName string `yaml:"file_name" json:"file_name"`
+	Amount   int64  `yaml:"amount" json:"amount"`
+	Date     string `yaml:"date" json:"date"`
+}
+
+// Load reads a fixture file, choosing the decoder from its extension.
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixtures: %w", err)
+	}
+	return Parse(data, strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+}
+
+// Parse decodes fixture data in the given format ("yaml", "yml" or "json").
+func Parse(data []byte, format string) (*Set, error) {
+	var set Set
+	switch format {
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("parse yaml fixtures: %w", err)
+		}
+	case "json":
+		if err := json.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("parse json fixtures: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q (use .yaml, .yml or .json)", format)
+	}
+	return &set, nil
+}
+
+// DefaultRoles are the master roles every deployment needs.
+func DefaultRoles() []Role {
+	return []Role{{Name: "administrator", Description: "full access"}, {Name: "user", Description: "regular user"}}
+}
+
+// Default is the baseline seed: master roles plus the admin account and its profile.
+func Default() *Set {
+	return &Set{
+		CreateOnly: true,
+		Roles:      DefaultRoles(),
+		Users: []User{{
+			Username: "admin",
+			Password: "admin123",
+			Role:     "administrator",
+			Profile:  &Profile{Name: "Administrator", Email: "admin@example.com"},
+		}},
+	}
+}
@@ -0,0 +1,77 @@
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseYAMLAndJSON(t *testing.T) {
+	y := []byte(`
+roles:
+  - name: user
+users:
+  - username: demo
+    password: demo1234
+    profile:
+      name: Demo
+catatan:
+  - user: demo
+    file_name: a.jpg
+    amount: 1500
+    date: "2025-08-01"
+`)
+	set, err := Parse(y, "yaml")
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	if len(set.Users) != 1 || set.Users[0].Profile == nil || set.Users[0].Profile.Name != "Demo" {
+		t.Fatalf("unexpected users: %+v", set.Users)
+	}
+	if len(set.Catatan) != 1 || set.Catatan[0].Amount != 1500 {
+		t.Fatalf("unexpected catatan: %+v", set.Catatan)
+	}
+
+	j := []byte(`{"create_only":true,"uploads":[{"user":"demo","file_name":"b.png","failed":true}]}`)
+	set, err = Parse(j, "json")
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if !set.CreateOnly || len(set.Uploads) != 1 || !set.Uploads[0].Failed {
+		t.Fatalf("unexpected set: %+v", set)
+	}
+
+	if _, err := Parse(j, "toml"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestLoadDemoFixtures(t *testing.T) {
+	set, err := Load(filepath.Join("..", "..", "seed", "demo.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Skip("demo fixtures not present")
+		}
+		t.Fatalf("load: %v", err)
+	}
+	if len(set.Users) == 0 || len(set.Catatan) == 0 {
+		t.Fatalf("demo set looks empty: %+v", set)
+	}
+	for _, c := range set.Catatan {
+		if _, err := parseDate(c.Date); err != nil {
+			t.Errorf("catatan %s: %v", c.FileName, err)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	if _, err := parseDate("2025-08-01"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseDate("2025-08-01T10:00:00+07:00"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseDate("01/08/2025"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,209 @@
+// Package fxrates converts amounts between currencies at the rate of their
+// transaction date. Daily rates come from a Provider and are cached in the
+// exchange_rates table, so a (day, currency) pair is fetched at most once and
+// past conversions stay stable. When no rate exists for a day the Fallback
+// policy decides: use the latest earlier rate, leave the amount out, or fail.
+package fxrates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Fallback policies for a day without a rate.
+const (
+	// FallbackPrevious uses the latest rate from up to FallbackDays before.
+	FallbackPrevious = "previous"
+	// FallbackSkip leaves the amount out of converted totals; it is listed
+	// in Converter.Missing.
+	FallbackSkip = "skip"
+	// FallbackError fails the conversion (see Converter.Err).
+	FallbackError = "error"
+)
+
+// DefaultFallbackDays bounds how old a FallbackPrevious rate may be.
+const DefaultFallbackDays = 7
+
+// ErrNoRate is returned when no rate is known for a pair and day.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Provider supplies daily rates.
+type Provider interface {
+	// Rates returns how many units of each quote currency one unit of base
+	// was worth on day.
+	Rates(ctx context.Context, base string, day time.Time) (map[string]float64, error)
+	// Name identifies the provider on cached rates.
+	Name() string
+}
+
+// Service looks up rates, caching the provider's answers in the database.
+type Service struct {
+	DB *gorm.DB
+	// Provider may be nil: only rates already in the database are used.
+	Provider     Provider
+	Fallback     string // default FallbackPrevious
+	FallbackDays int    // default DefaultFallbackDays
+}
+
+// ValidFallback reports whether p is a fallback policy.
+func ValidFallback(p string) bool {
+	return p == FallbackPrevious || p == FallbackSkip || p == FallbackError
+}
+
+func dayKey(t time.Time) string { return t.Format("2006-01-02") }
+
+// Rate returns how many units of to one unit of from was worth on day (a
+// calendar day; its time of day is ignored), and the day of the rate used,
+// which differs from day when the previous-rate fallback applied.
+func (s *Service) Rate(ctx context.Context, from, to string, day time.Time) (float64, string, error) {
+	key := dayKey(day)
+	if from == to {
+		return 1, key, nil
+	}
+	if r, ok := s.stored(from, to, key, key); ok {
+		return r, key, nil
+	}
+	var fetchErr error
+	if s.Provider != nil {
+		// an unreachable provider is treated as a missing rate
+		if fetchErr = s.fetch(ctx, from, day); fetchErr == nil {
+			if r, ok := s.stored(from, to, key, key); ok {
+				return r, key, nil
+			}
+		}
+	}
+	if s.Fallback == "" || s.Fallback == FallbackPrevious {
+		days := s.FallbackDays
+		if days <= 0 {
+			days = DefaultFallbackDays
+		}
+		var row models.ExchangeRate
+		earliest := dayKey(day.AddDate(0, 0, -days))
+		err := s.DB.Where("((base = ? AND quote = ?) OR (base = ? AND quote = ?)) AND day >= ? AND day < ?", from, to, to, from, earliest, key).
+			Order("day desc").First(&row).Error
+		if err == nil {
+			return oriented(row, from), row.Day, nil
+		}
+	}
+	if fetchErr != nil {
+		return 0, "", fmt.Errorf("%w for %s/%s on %s (provider: %v)", ErrNoRate, from, to, key, fetchErr)
+	}
+	return 0, "", fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, key)
+}
+
+// stored finds a cached rate for the pair, in either direction, dated from
+// first to last (inclusive).
+func (s *Service) stored(from, to, first, last string) (float64, bool) {
+	var row models.ExchangeRate
+	err := s.DB.Where("((base = ? AND quote = ?) OR (base = ? AND quote = ?)) AND day >= ? AND day <= ?", from, to, to, from, first, last).
+		Order("day desc").First(&row).Error
+	if err != nil {
+		return 0, false
+	}
+	return oriented(row, from), true
+}
+
+// oriented is row's rate expressed per unit of from.
+func oriented(row models.ExchangeRate, from string) float64 {
+	if row.Base == from {
+		return row.Rate
+	}
+	return 1 / row.Rate
+}
+
+// fetch asks the provider for base's rates on day and caches them.
+func (s *Service) fetch(ctx context.Context, base string, day time.Time) error {
+	rates, err := s.Provider.Rates(ctx, base, day)
+	if err != nil {
+		return err
+	}
+	rows := make([]models.ExchangeRate, 0, len(rates))
+	for quote, r := range rates {
+		if quote == base || r <= 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+			continue
+		}
+		rows = append(rows, models.ExchangeRate{Day: dayKey(day), Base: base, Quote: quote, Rate: r, Source: s.Provider.Name()})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// Missing is a currency and day for which no rate was found.
+type Missing struct {
+	Currency string `json:"currency"`
+	Day      string `json:"day"`
+}
+
+// Converter converts many amounts to one currency, asking the Service once
+// per currency and day. It is not safe for concurrent use.
+type Converter struct {
+	s       *Service
+	ctx     context.Context
+	to      string
+	loc     *time.Location
+	rates   map[Missing]float64 // NaN: no rate
+	missing []Missing
+	err     error
+}
+
+// Converter returns a converter to currency to; transaction days are
+// calendar days in loc.
+func (s *Service) Converter(ctx context.Context, to string, loc *time.Location) *Converter {
+	return &Converter{s: s, ctx: ctx, to: to, loc: loc, rates: map[Missing]float64{}}
+}
+
+// Currency is the target currency.
+func (c *Converter) Currency() string { return c.to }
+
+// Convert returns amount in currency, dated date, in the target currency. ok
+// is false when no rate is known; the amount is then left out of totals.
+func (c *Converter) Convert(amount int64, currency string, date time.Time) (float64, bool) {
+	k := Missing{Currency: currency, Day: dayKey(date.In(c.loc))}
+	r, seen := c.rates[k]
+	if !seen {
+		day, _ := time.ParseInLocation("2006-01-02", k.Day, time.UTC)
+		var err error
+		if r, _, err = c.s.Rate(c.ctx, currency, c.to, day); err != nil {
+			r = math.NaN()
+			c.missing = append(c.missing, k)
+			if c.err == nil && c.s.Fallback == FallbackError {
+				c.err = err
+			}
+		}
+		c.rates[k] = r
+	}
+	if math.IsNaN(r) {
+		return 0, false
+	}
+	return float64(amount) * r, true
+}
+
+// Missing lists the currencies and days converted without a rate, sorted.
+func (c *Converter) Missing() []Missing {
+	out := append([]Missing{}, c.missing...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Day != out[j].Day {
+			return out[i].Day < out[j].Day
+		}
+		return out[i].Currency < out[j].Currency
+	})
+	return out
+}
+
+// Err is the first missing rate under FallbackError, which should fail the
+// request; nil under the other policies.
+func (c *Converter) Err() error { return c.err }
+
+// Round rounds a converted amount to cents.
+func Round(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,74 @@
+package fxrates
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+)
+
+func TestRateCachesAndInverts(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	st, err := ParseStatic("USD=1, idr=0.00006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{DB: gdb, Provider: st}
+	day := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	r, used, err := s.Rate(ctx, "USD", "IDR", day)
+	if err != nil || Round(r) != 16666.67 || used != "2025-03-04" {
+		t.Fatalf("USD/IDR = %v %s %v", r, used, err)
+	}
+	var n int64
+	gdb.Model(&models.ExchangeRate{}).Where("day = ? AND base = ? AND source = ?", "2025-03-04", "USD", "static").Count(&n)
+	if n != 1 {
+		t.Fatalf("cached %d rates", n)
+	}
+
+	// the inverse comes from the cache, even without a provider
+	s.Provider = nil
+	if r, _, err := s.Rate(ctx, "IDR", "USD", day); err != nil || r*1e5 < 5.9999 || r*1e5 > 6.0001 {
+		t.Fatalf("IDR/USD = %v %v", r, err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	gdb.Create(&models.ExchangeRate{Day: "2025-03-01", Base: "EUR", Quote: "IDR", Rate: 17000, Source: "test"})
+	s := &Service{DB: gdb}
+	ctx := context.Background()
+	day := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	r, used, err := s.Rate(ctx, "EUR", "IDR", day)
+	if err != nil || r != 17000 || used != "2025-03-01" {
+		t.Fatalf("previous: %v %s %v", r, used, err)
+	}
+	s.FallbackDays = 2
+	if _, _, err := s.Rate(ctx, "EUR", "IDR", day); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("outside window: %v", err)
+	}
+
+	s.FallbackDays = 0
+	s.Fallback = FallbackSkip
+	c := s.Converter(ctx, "IDR", time.UTC)
+	if v, ok := c.Convert(100, "EUR", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)); !ok || v != 1700000 {
+		t.Fatalf("same day: %v %v", v, ok)
+	}
+	if _, ok := c.Convert(100, "EUR", day); ok || c.Err() != nil {
+		t.Fatalf("skip converted: %v", c.Err())
+	}
+	if m := c.Missing(); len(m) != 1 || m[0] != (Missing{"EUR", "2025-03-04"}) {
+		t.Fatalf("missing: %+v", m)
+	}
+
+	s.Fallback = FallbackError
+	c = s.Converter(ctx, "IDR", time.UTC)
+	if _, ok := c.Convert(100, "EUR", day); ok || !errors.Is(c.Err(), ErrNoRate) {
+		t.Fatalf("error policy: %v", c.Err())
+	}
+}
@@ -0,0 +1,136 @@
+package fxrates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HTTP fetches rates from a JSON API answering {"rates": {"USD": 0.00006,
+// ...}}. URL may contain {date} (YYYY-MM-DD) and {base}, for example
+// https://api.frankfurter.app/{date}?from={base}.
+type HTTP struct {
+	URL    string
+	Client *http.Client // default: 15s timeout
+}
+
+// Name implements Provider.
+func (p *HTTP) Name() string { return "http" }
+
+// Rates implements Provider.
+func (p *HTTP) Rates(ctx context.Context, base string, day time.Time) (map[string]float64, error) {
+	u := strings.NewReplacer("{date}", dayKey(day), "{base}", base).Replace(p.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rates provider: %s", resp.Status)
+	}
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("rates provider: %w", err)
+	}
+	return body.Rates, nil
+}
+
+// Static serves fixed rates, the same every day: PerUnit holds each
+// currency's value in a common unit, so one base buys
+// PerUnit[base]/PerUnit[quote] of quote. Useful offline and in tests.
+type Static struct {
+	PerUnit map[string]float64
+}
+
+// ParseStatic parses "USD=1,IDR=0.0000615,EUR=1.08": the value of one unit
+// of each currency in a common unit.
+func ParseStatic(s string) (*Static, error) {
+	st := &Static{PerUnit: map[string]float64{}}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cur, val, ok := strings.Cut(part, "=")
+		cur = strings.ToUpper(strings.TrimSpace(cur))
+		v, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if !ok || len(cur) != 3 || err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid static rate %q", part)
+		}
+		st.PerUnit[cur] = v
+	}
+	if len(st.PerUnit) == 0 {
+		return nil, errors.New("no static rates")
+	}
+	return st, nil
+}
+
+// Name implements Provider.
+func (p *Static) Name() string { return "static" }
+
+// Rates implements Provider.
+func (p *Static) Rates(_ context.Context, base string, _ time.Time) (map[string]float64, error) {
+	b, ok := p.PerUnit[base]
+	if !ok {
+		return nil, nil
+	}
+	out := make(map[string]float64, len(p.PerUnit))
+	for q, v := range p.PerUnit {
+		if q != base {
+			out[q] = b / v
+		}
+	}
+	return out, nil
+}
+
+// FromEnv configures a Service on gdb: FX_RATES_URL selects the HTTP
+// provider, else FX_STATIC_RATES the static one (neither: cached rates
+// only); FX_FALLBACK is the policy and FX_FALLBACK_DAYS its window.
+func FromEnv(gdb *gorm.DB) (*Service, error) {
+	s := &Service{DB: gdb, Fallback: FallbackPrevious, FallbackDays: DefaultFallbackDays}
+	if u := strings.TrimSpace(os.Getenv("FX_RATES_URL")); u != "" {
+		s.Provider = &HTTP{URL: u}
+	} else if v := strings.TrimSpace(os.Getenv("FX_STATIC_RATES")); v != "" {
+		st, err := ParseStatic(v)
+		if err != nil {
+			return nil, fmt.Errorf("FX_STATIC_RATES: %w", err)
+		}
+		s.Provider = st
+	}
+	if v := strings.TrimSpace(os.Getenv("FX_FALLBACK")); v != "" {
+		if !ValidFallback(v) {
+			return nil, fmt.Errorf("FX_FALLBACK: unknown policy %q", v)
+		}
+		s.Fallback = v
+	}
+	if v := strings.TrimSpace(os.Getenv("FX_FALLBACK_DAYS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("FX_FALLBACK_DAYS: invalid %q", v)
+		}
+		s.FallbackDays = n
+	}
+	return s, nil
+}
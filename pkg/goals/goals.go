@@ -0,0 +1,61 @@
+// Package goals computes savings-goal progress from catatan inflows.
+package goals
+
+import (
+	"math"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Progress is the computed state of a goal at a point in time.
+type Progress struct {
+	Saved     int64   `json:"saved"`
+	Remaining int64   `json:"remaining"`
+	Percent   float64 `json:"percent"` // 0-100, capped
+	Completed bool    `json:"completed"`
+	// ProjectedAt extrapolates the average daily inflow since StartsAt; nil while
+	// nothing has been saved yet or once the goal is completed.
+	ProjectedAt *time.Time `json:"projected_at,omitempty"`
+	// OnTrack is set when the goal has a deadline: completed, or projected to
+	// finish by it.
+	OnTrack *bool `json:"on_track,omitempty"`
+}
+
+// Saved sums the confirmed catatan counting towards g; a split catatan
+// counts through its line items.
+func Saved(gdb *gorm.DB, g models.Goal) (int64, error) {
+	q := gdb.Model(&models.CatatanKeuangan{}).Where("user_id = ? AND date >= ? AND pending = ? AND split = ?", g.UserID, g.StartsAt.UTC(), false, false)
+	if g.AccountID != nil {
+		q = q.Where("account_id = ?", *g.AccountID)
+	}
+	var total int64
+	err := q.Select("COALESCE(SUM(amount), 0)").Scan(&total).Error
+	return total, err
+}
+
+// Compute derives progress for g given the saved amount at now.
+func Compute(g models.Goal, saved int64, now time.Time) Progress {
+	p := Progress{Saved: saved, Remaining: g.TargetAmount - saved}
+	if p.Remaining < 0 {
+		p.Remaining = 0
+	}
+	if g.TargetAmount > 0 {
+		p.Percent = math.Min(100, math.Round(float64(saved)*10000/float64(g.TargetAmount))/100)
+	}
+	p.Completed = saved >= g.TargetAmount
+	if !p.Completed && saved > 0 {
+		// count at least one day so a same-day inflow doesn't divide by zero
+		days := math.Max(1, now.Sub(g.StartsAt).Hours()/24)
+		perDay := float64(saved) / days
+		eta := now.Add(time.Duration(float64(p.Remaining) / perDay * 24 * float64(time.Hour)))
+		p.ProjectedAt = &eta
+	}
+	if g.Deadline != nil {
+		ok := p.Completed || (p.ProjectedAt != nil && !p.ProjectedAt.After(*g.Deadline))
+		p.OnTrack = &ok
+	}
+	return p
+}
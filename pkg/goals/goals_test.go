@@ -0,0 +1,37 @@
+package goals
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+)
+
+func TestCompute(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.AddDate(0, 0, 10)
+	deadline := start.AddDate(0, 0, 30)
+	g := models.Goal{TargetAmount: 1000000, StartsAt: start, Deadline: &deadline}
+
+	p := Compute(g, 250000, now)
+	if p.Percent != 25 || p.Remaining != 750000 || p.Completed {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+	// 25k/day with 750k left -> 30 more days, past the deadline
+	if want := now.AddDate(0, 0, 30); p.ProjectedAt == nil || !p.ProjectedAt.Equal(want) {
+		t.Fatalf("projected %v, want %v", p.ProjectedAt, want)
+	}
+	if p.OnTrack == nil || *p.OnTrack {
+		t.Fatalf("expected off track: %+v", p)
+	}
+
+	p = Compute(g, 1200000, now)
+	if !p.Completed || p.Percent != 100 || p.Remaining != 0 || p.ProjectedAt != nil || !*p.OnTrack {
+		t.Fatalf("completed goal: %+v", p)
+	}
+
+	g.Deadline = nil
+	if p = Compute(g, 0, now); p.ProjectedAt != nil || p.OnTrack != nil {
+		t.Fatalf("empty goal: %+v", p)
+	}
+}
@@ -0,0 +1,152 @@
+// Package hooks lets a deployment compile in behaviour that runs when uploads
+// are stored, amounts are read and catatan are created (pushing them to an
+// ERP, say) without editing the API handlers or the watcher. Register handlers
+// from an init function in a file added to package main of the API or the
+// watcher; Webhook is the built-in consumer.
+//
+// Handlers run synchronously, in registration order, on the goroutine that
+// emits the event, so they must be quick: anything slow (network calls)
+// belongs on a queue, as Webhook does. A panicking handler is logged and does
+// not affect the others or the request. Events carry copies of the rows.
+package hooks
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"be03/models"
+)
+
+// Sources of an event: the process that emitted it.
+const (
+	SourceAPI     = "api"
+	SourceWatcher = "watcher"
+)
+
+// Event names, as sent by Webhook.
+const (
+	EventUploadStored    = "upload.stored"
+	EventAmountExtracted = "amount.extracted"
+	EventCatatanCreated  = "catatan.created"
+)
+
+// UploadStored follows a new receipt image being written to public/keu and
+// recorded as an upload, before OCR.
+type UploadStored struct {
+	Upload models.Upload `json:"upload"`
+	UserID uint          `json:"user_id"`
+	Source string        `json:"source"`
+	At     time.Time     `json:"at"`
+}
+
+// AmountExtracted follows OCR finding an amount on an upload, whether or not a
+// catatan is created from it.
+type AmountExtracted struct {
+	Upload     models.Upload `json:"upload"`
+	UserID     uint          `json:"user_id"`
+	Amount     int64         `json:"amount"`
+	Confidence float64       `json:"confidence"`
+	Source     string        `json:"source"`
+	At         time.Time     `json:"at"`
+}
+
+// CatatanCreated follows a new catatan, entered by hand or read from a
+// receipt. Catatan found to already exist do not fire it.
+type CatatanCreated struct {
+	Catatan models.CatatanKeuangan `json:"catatan"`
+	Source  string                 `json:"source"`
+	At      time.Time              `json:"at"`
+}
+
+type registry[E any] struct {
+	mu   sync.RWMutex
+	next int
+	fns  map[int]func(context.Context, E)
+}
+
+func (r *registry[E]) add(fn func(context.Context, E)) (remove func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fns == nil {
+		r.fns = map[int]func(context.Context, E){}
+	}
+	id := r.next
+	r.next++
+	r.fns[id] = fn
+	return func() {
+		r.mu.Lock()
+		delete(r.fns, id)
+		r.mu.Unlock()
+	}
+}
+
+func (r *registry[E]) emit(ctx context.Context, name string, e E) {
+	r.mu.RLock()
+	fns := make([]func(context.Context, E), 0, len(r.fns))
+	// registration order: ids only grow
+	for i := 0; i < r.next; i++ {
+		if fn, ok := r.fns[i]; ok {
+			fns = append(fns, fn)
+		}
+	}
+	r.mu.RUnlock()
+	for _, fn := range fns {
+		call(ctx, name, e, fn)
+	}
+}
+
+func call[E any](ctx context.Context, name string, e E, fn func(context.Context, E)) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("hooks: %s handler panicked: %v", name, p)
+		}
+	}()
+	fn(ctx, e)
+}
+
+var (
+	uploadStored    registry[UploadStored]
+	amountExtracted registry[AmountExtracted]
+	catatanCreated  registry[CatatanCreated]
+)
+
+// OnUploadStored registers fn for UploadStored; remove unregisters it.
+func OnUploadStored(fn func(context.Context, UploadStored)) (remove func()) {
+	return uploadStored.add(fn)
+}
+
+// OnAmountExtracted registers fn for AmountExtracted; remove unregisters it.
+func OnAmountExtracted(fn func(context.Context, AmountExtracted)) (remove func()) {
+	return amountExtracted.add(fn)
+}
+
+// OnCatatanCreated registers fn for CatatanCreated; remove unregisters it.
+func OnCatatanCreated(fn func(context.Context, CatatanCreated)) (remove func()) {
+	return catatanCreated.add(fn)
+}
+
+// EmitUploadStored runs the UploadStored handlers; a zero At is set to now.
+func EmitUploadStored(ctx context.Context, e UploadStored) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	uploadStored.emit(ctx, EventUploadStored, e)
+}
+
+// EmitAmountExtracted runs the AmountExtracted handlers; a zero At is set to now.
+func EmitAmountExtracted(ctx context.Context, e AmountExtracted) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	amountExtracted.emit(ctx, EventAmountExtracted, e)
+}
+
+// EmitCatatanCreated runs the CatatanCreated handlers; a zero At is set to now.
+func EmitCatatanCreated(ctx context.Context, e CatatanCreated) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	catatanCreated.emit(ctx, EventCatatanCreated, e)
+}
@@ -0,0 +1,84 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"be03/models"
+)
+
+func TestEmitRunsHandlersInOrder(t *testing.T) {
+	var got []string
+	r1 := OnCatatanCreated(func(_ context.Context, e CatatanCreated) { got = append(got, "first:"+e.Source) })
+	r2 := OnCatatanCreated(func(context.Context, CatatanCreated) { panic("boom") })
+	r3 := OnCatatanCreated(func(_ context.Context, e CatatanCreated) {
+		if e.At.IsZero() {
+			t.Error("At not set")
+		}
+		got = append(got, "third")
+	})
+	EmitCatatanCreated(context.Background(), CatatanCreated{Source: SourceAPI})
+	r1()
+	r2()
+	EmitCatatanCreated(context.Background(), CatatanCreated{Source: SourceAPI})
+	r3()
+	EmitCatatanCreated(context.Background(), CatatanCreated{Source: SourceAPI})
+	if want := []string{"first:api", "third", "third"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestWebhookDeliversSignedEventsWithRetries(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if r.Header.Get("X-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Error("bad signature")
+		}
+		var p struct {
+			Event string          `json:"event"`
+			Data  json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(body, &p)
+		if p.Event != r.Header.Get("X-Event") {
+			t.Errorf("event %q, header %q", p.Event, r.Header.Get("X-Event"))
+		}
+		events = append(events, p.Event)
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL, Secret: "s3cret", RetryWait: time.Millisecond}
+	w.Start()
+	EmitUploadStored(context.Background(), UploadStored{Upload: models.Upload{FileName: "nota.jpg"}, Source: SourceWatcher})
+	EmitAmountExtracted(context.Background(), AmountExtracted{Amount: 45000})
+	if !w.Stop(5 * time.Second) {
+		t.Fatal("queue not drained")
+	}
+	EmitCatatanCreated(context.Background(), CatatanCreated{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 || len(events) != 2 || events[0] != EventUploadStored || events[1] != EventAmountExtracted {
+		t.Fatalf("calls=%d events=%v", calls, events)
+	}
+}
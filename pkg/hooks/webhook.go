@@ -0,0 +1,159 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook POSTs every event as JSON ({"event": ..., "data": ...}) to one URL,
+// from a queue so emitting never waits on the network. With a Secret the body
+// is signed in X-Signature-256 ("sha256=<hex hmac>"), as notification
+// webhooks are. A delivery is tried Attempts times; events that still fail,
+// or that arrive while the queue is full, are logged and dropped.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+	// Attempts per event (default 3); RetryWait is the first wait between
+	// them (default 2s), doubled after each failure.
+	Attempts  int
+	RetryWait time.Duration
+	// QueueSize bounds the events waiting for delivery (default 256).
+	QueueSize int
+
+	mu      sync.Mutex
+	queue   chan payload
+	closed  bool
+	done    chan struct{}
+	removes []func()
+}
+
+type payload struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// WebhookFromEnv configures a Webhook from HOOKS_WEBHOOK_URL and
+// HOOKS_WEBHOOK_SECRET; ok is false when no URL is set.
+func WebhookFromEnv() (w *Webhook, ok bool) {
+	w = &Webhook{URL: strings.TrimSpace(os.Getenv("HOOKS_WEBHOOK_URL")), Secret: os.Getenv("HOOKS_WEBHOOK_SECRET")}
+	return w, w.URL != ""
+}
+
+// Start registers w for all events and starts delivering them.
+func (w *Webhook) Start() {
+	size := w.QueueSize
+	if size <= 0 {
+		size = 256
+	}
+	w.queue = make(chan payload, size)
+	w.done = make(chan struct{})
+	w.removes = []func(){
+		OnUploadStored(func(_ context.Context, e UploadStored) { w.enqueue(EventUploadStored, e) }),
+		OnAmountExtracted(func(_ context.Context, e AmountExtracted) { w.enqueue(EventAmountExtracted, e) }),
+		OnCatatanCreated(func(_ context.Context, e CatatanCreated) { w.enqueue(EventCatatanCreated, e) }),
+	}
+	go w.run()
+}
+
+// Stop unregisters w and waits up to timeout for the queued events to be
+// delivered; it reports whether the queue was drained.
+func (w *Webhook) Stop(timeout time.Duration) bool {
+	for _, remove := range w.removes {
+		remove()
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	select {
+	case <-w.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (w *Webhook) enqueue(event string, data any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- payload{Event: event, Data: data}:
+	default:
+		log.Printf("hooks: webhook queue full, dropping %s", event)
+	}
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	attempts, wait := w.Attempts, w.RetryWait
+	if attempts <= 0 {
+		attempts = 3
+	}
+	if wait <= 0 {
+		wait = 2 * time.Second
+	}
+	for p := range w.queue {
+		body, err := json.Marshal(p)
+		if err != nil {
+			log.Printf("hooks: webhook %s: %v", p.Event, err)
+			continue
+		}
+		for i, d := 1, wait; ; i, d = i+1, d*2 {
+			if err = w.send(p.Event, body); err == nil {
+				break
+			}
+			if i == attempts {
+				log.Printf("hooks: webhook %s dropped after %d attempts: %v", p.Event, attempts, err)
+				break
+			}
+			time.Sleep(d)
+		}
+	}
+}
+
+// send POSTs one event; any non-2xx answer is an error.
+func (w *Webhook) send(event string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event", event)
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
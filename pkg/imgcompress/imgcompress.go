@@ -0,0 +1,226 @@
+// Package imgcompress re-encodes receipt images that exceed the storage
+// budget. JPEG (and WebP) quality is binary-searched for the best one that
+// fits, PNG photos are converted to JPEG, and the image is only scaled down
+// when even the lowest acceptable quality is too large. Pool bounds how many
+// images are encoded at once so a burst of large uploads does not starve OCR.
+package imgcompress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // decode WebP uploads and output
+)
+
+// Output formats.
+const (
+	// FormatAuto keeps JPEG as JPEG, converts photos in other formats to
+	// JPEG and keeps graphics (few colours, transparency) as PNG.
+	FormatAuto = "auto"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	// FormatWebP encodes with the cwebp tool, which must be on PATH.
+	FormatWebP = "webp"
+)
+
+// Defaults for Options.
+const (
+	DefaultMaxBytes   = 1_000_000
+	DefaultMinQuality = 40
+	DefaultMaxQuality = 92
+	// maxDownscales bounds the resize rounds after which the smallest
+	// encoding is kept even if it is over the budget.
+	maxDownscales = 4
+)
+
+// ErrNoWebP is returned when WebP output is asked for but cwebp is missing.
+var ErrNoWebP = errors.New("imgcompress: cwebp not found on PATH")
+
+// CWebP is the WebP encoder binary.
+var CWebP = "cwebp"
+
+// WebPAvailable reports whether FormatWebP can be used.
+func WebPAvailable() bool {
+	_, err := exec.LookPath(CWebP)
+	return err == nil
+}
+
+// Options tune Compress. Zero fields take the defaults.
+type Options struct {
+	MaxBytes   int64
+	Format     string
+	MinQuality int
+	MaxQuality int
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultMaxBytes
+	}
+	if o.Format == "" {
+		o.Format = FormatAuto
+	}
+	if o.MinQuality <= 0 {
+		o.MinQuality = DefaultMinQuality
+	}
+	if o.MaxQuality <= 0 || o.MaxQuality > 100 {
+		o.MaxQuality = DefaultMaxQuality
+	}
+	if o.MinQuality > o.MaxQuality {
+		o.MinQuality = o.MaxQuality
+	}
+	return o
+}
+
+// Result is an encoded image.
+type Result struct {
+	Data          []byte
+	Format        string
+	Quality       int // 0 for PNG
+	Width, Height int
+	// Passes counts the encodings tried.
+	Passes int
+}
+
+// ContentType is the MIME type of Data.
+func (r Result) ContentType() string { return "image/" + r.Format }
+
+// Compress encodes img, decoded from srcFormat ("jpeg", "png", ...), in the
+// format opt asks for, as close under opt.MaxBytes as it gets.
+func Compress(img image.Image, srcFormat string, opt Options) (Result, error) {
+	opt = opt.withDefaults()
+	format, err := target(img, srcFormat, opt.Format)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Format: format}
+	for round := 0; ; round++ {
+		data, q, passes, err := fit(img, format, opt)
+		res.Passes += passes
+		if err != nil {
+			return Result{}, err
+		}
+		b := img.Bounds()
+		res.Data, res.Quality, res.Width, res.Height = data, q, b.Dx(), b.Dy()
+		if int64(len(data)) <= opt.MaxBytes || round == maxDownscales || b.Dx() <= 1 {
+			return res, nil
+		}
+		// the size roughly follows the area; aim a little under the budget
+		scale := math.Sqrt(float64(opt.MaxBytes)/float64(len(data))) * 0.95
+		scale = math.Min(0.9, math.Max(0.1, scale))
+		img = imaging.Resize(img, int(math.Max(1, math.Round(float64(b.Dx())*scale))), 0, imaging.Lanczos)
+	}
+}
+
+// target resolves the output format.
+func target(img image.Image, srcFormat, want string) (string, error) {
+	switch want {
+	case FormatJPEG, FormatPNG:
+		return want, nil
+	case FormatWebP:
+		if !WebPAvailable() {
+			return "", ErrNoWebP
+		}
+		return FormatWebP, nil
+	case FormatAuto:
+		if srcFormat == FormatJPEG || isPhoto(img) {
+			return FormatJPEG, nil
+		}
+		return FormatPNG, nil
+	}
+	return "", fmt.Errorf("imgcompress: unknown format %q", want)
+}
+
+// isPhoto tells photos from graphics: an opaque image with many distinct
+// colours over a sample grid. Scans and screenshots of receipts have few.
+func isPhoto(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		return false
+	}
+	b := img.Bounds()
+	const grid = 64
+	colours := map[uint32]struct{}{}
+	for y := 0; y < grid; y++ {
+		for x := 0; x < grid; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/grid, b.Min.Y+y*b.Dy()/grid).RGBA()
+			colours[r>>11<<10|g>>11<<5|bl>>11] = struct{}{}
+		}
+	}
+	return len(colours) > 512
+}
+
+// fit binary-searches the highest quality whose encoding is within the
+// budget, or returns the encoding at the lowest quality when none is.
+func fit(img image.Image, format string, opt Options) (data []byte, quality, passes int, err error) {
+	if format == FormatPNG {
+		data, err = encode(img, format, 0)
+		return data, 0, 1, err
+	}
+	var smallest []byte
+	lo, hi := opt.MinQuality, opt.MaxQuality
+	for lo <= hi {
+		q := (lo + hi) / 2
+		out, err := encode(img, format, q)
+		passes++
+		if err != nil {
+			return nil, 0, passes, err
+		}
+		if int64(len(out)) <= opt.MaxBytes {
+			data, quality = out, q
+			lo = q + 1
+			continue
+		}
+		if smallest == nil || len(out) < len(smallest) {
+			smallest = out
+		}
+		hi = q - 1
+	}
+	if data == nil {
+		// nothing fits: the search went all the way down to MinQuality
+		return smallest, opt.MinQuality, passes, nil
+	}
+	return data, quality, passes, nil
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	case FormatWebP:
+		return encodeWebP(img, quality)
+	default:
+		err = fmt.Errorf("imgcompress: unknown format %q", format)
+	}
+	return buf.Bytes(), err
+}
+
+// encodeWebP hands img to cwebp as a lossless PNG.
+func encodeWebP(img image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "imgcompress")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.webp")
+	if err := imaging.Save(img, in); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(CWebP, "-quiet", "-q", fmt.Sprint(quality), in, "-o", out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cwebp: %v: %s", err, bytes.TrimSpace(msg))
+	}
+	return os.ReadFile(out)
+}
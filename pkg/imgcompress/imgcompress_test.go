@@ -0,0 +1,139 @@
+package imgcompress
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// noise is a photo-like image that compresses poorly.
+func noise(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// graphic is a two-colour image, like a scanned receipt.
+func graphic(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{0xff, 0xff, 0xff, 0xff}
+			if (x/7+y/5)%3 == 0 {
+				c = color.NRGBA{0, 0, 0, 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestCompressPicksHighestQualityThatFits(t *testing.T) {
+	img := noise(400, 400)
+	res, err := Compress(img, FormatJPEG, Options{MaxBytes: 60_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != FormatJPEG || len(res.Data) > 60_000 || res.Width != 400 {
+		t.Fatalf("got %s %d bytes %dx%d", res.Format, len(res.Data), res.Width, res.Height)
+	}
+	var next bytes.Buffer
+	jpeg.Encode(&next, img, &jpeg.Options{Quality: res.Quality + 1})
+	if res.Quality < DefaultMaxQuality && next.Len() <= 60_000 {
+		t.Fatalf("quality %d fits but %d would too", res.Quality, res.Quality+1)
+	}
+	if res.Passes > 7 {
+		t.Fatalf("binary search took %d passes", res.Passes)
+	}
+}
+
+func TestCompressDownscalesWhenQualityAloneCannotFit(t *testing.T) {
+	res, err := Compress(noise(800, 600), FormatJPEG, Options{MaxBytes: 20_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) > 20_000 || res.Width >= 800 {
+		t.Fatalf("got %d bytes %dx%d q=%d", len(res.Data), res.Width, res.Height, res.Quality)
+	}
+	if res.Height*800 < res.Width*600-800 || res.Height*800 > res.Width*600+800 {
+		t.Fatalf("aspect ratio lost: %dx%d", res.Width, res.Height)
+	}
+}
+
+func TestCompressFormats(t *testing.T) {
+	if res, _ := Compress(noise(200, 200), FormatPNG, Options{MaxBytes: 1 << 20}); res.Format != FormatJPEG {
+		t.Fatalf("png photo encoded as %s, want jpeg", res.Format)
+	}
+	res, err := Compress(graphic(200, 200), FormatPNG, Options{MaxBytes: 1 << 20})
+	if err != nil || res.Format != FormatPNG {
+		t.Fatalf("png graphic encoded as %s (%v), want png", res.Format, err)
+	}
+	if _, err := png.Decode(bytes.NewReader(res.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := Compress(graphic(200, 200), FormatPNG, Options{Format: FormatJPEG}); res.Format != FormatJPEG {
+		t.Fatalf("forced jpeg encoded as %s", res.Format)
+	}
+
+	prev := CWebP
+	CWebP = "be03-no-such-cwebp"
+	defer func() { CWebP = prev }()
+	if _, err := Compress(graphic(10, 10), FormatPNG, Options{Format: FormatWebP}); !errors.Is(err, ErrNoWebP) {
+		t.Fatalf("webp without cwebp: %v", err)
+	}
+}
+
+func TestPoolCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, noise(300, 300)); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "in.png")
+	if err := os.WriteFile(src, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.jpg")
+	os.WriteFile(bad, []byte("not an image"), 0o644)
+
+	p := NewPool(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dst := filepath.Join(dir, "out"+string(rune('a'+i)))
+			if _, err := p.CompressFile(src, dst, Options{MaxBytes: 100_000}); err != nil {
+				t.Error(err)
+			}
+			if fi, err := os.Stat(dst); err != nil || fi.Size() > 100_000 {
+				t.Errorf("%s: %v", dst, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, err := p.CompressFile(bad, filepath.Join(dir, "bad-out"), Options{}); err == nil {
+		t.Fatal("undecodable file compressed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad-out")); err == nil {
+		t.Fatal("output written for an undecodable file")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatal("source removed")
+	}
+	s := p.Stats()
+	if s.Workers != 2 || s.Images != 5 || s.Errors != 1 || s.Converted != 4 || s.BytesIn != 4*int64(buf.Len()) || s.BytesOut == 0 || s.Busy != 0 || s.Waiting != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
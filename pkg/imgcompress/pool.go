@@ -0,0 +1,149 @@
+package imgcompress
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// Pool runs at most a fixed number of compressions at a time and keeps
+// totals over them. It is safe for concurrent use.
+type Pool struct {
+	sem chan struct{}
+
+	waiting, busy                   atomic.Int64
+	images, errors, converted       atomic.Int64
+	downscaled, passes              atomic.Int64
+	bytesIn, bytesOut, nanos, waitN atomic.Int64
+}
+
+// NewPool returns a pool of workers (at least one).
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{sem: make(chan struct{}, workers)}
+}
+
+// Workers is the pool's size.
+func (p *Pool) Workers() int { return cap(p.sem) }
+
+// CompressFile decodes src, applying its EXIF orientation since re-encoding
+// drops the EXIF, and writes the compressed image to dst through a temporary
+// file. src is left in place. Images that cannot be decoded return an error
+// and dst is not touched.
+func (p *Pool) CompressFile(src, dst string, opt Options) (Result, error) {
+	p.waiting.Add(1)
+	queued := time.Now()
+	p.sem <- struct{}{}
+	p.waiting.Add(-1)
+	p.waitN.Add(int64(time.Since(queued)))
+	p.busy.Add(1)
+	defer func() {
+		p.busy.Add(-1)
+		<-p.sem
+	}()
+
+	start := time.Now()
+	res, in, err := compressFile(src, dst, opt)
+	p.nanos.Add(int64(time.Since(start)))
+	p.images.Add(1)
+	p.passes.Add(int64(res.Passes))
+	if err != nil {
+		p.errors.Add(1)
+		return res, err
+	}
+	p.bytesIn.Add(in.size)
+	p.bytesOut.Add(int64(len(res.Data)))
+	if res.Format != in.format {
+		p.converted.Add(1)
+	}
+	if res.Width < in.width {
+		p.downscaled.Add(1)
+	}
+	return res, nil
+}
+
+type source struct {
+	format string
+	size   int64
+	width  int
+}
+
+func compressFile(src, dst string, opt Options) (Result, source, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return Result{}, source{}, err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, source{}, err
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return Result{}, source{}, err
+	}
+	in := source{format: format, size: int64(len(data)), width: img.Bounds().Dx()}
+	res, err := Compress(img, format, opt)
+	if err != nil {
+		return res, in, err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err := os.WriteFile(tmp, res.Data, 0o644); err != nil {
+		return res, in, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return res, in, err
+	}
+	return res, in, nil
+}
+
+// Stats is a snapshot of a Pool.
+type Stats struct {
+	Workers    int   `json:"workers"`
+	Busy       int64 `json:"busy"`
+	Waiting    int64 `json:"waiting"`
+	Images     int64 `json:"images"`
+	Errors     int64 `json:"errors"`
+	Converted  int64 `json:"converted"`
+	Downscaled int64 `json:"downscaled"`
+	Passes     int64 `json:"passes"`
+	BytesIn    int64 `json:"bytes_in"`
+	BytesOut   int64 `json:"bytes_out"`
+	// Time is spent compressing, Wait queued for a worker (both summed).
+	Time time.Duration `json:"time_ns"`
+	Wait time.Duration `json:"wait_ns"`
+}
+
+// Stats returns the pool's totals so far.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Workers: p.Workers(), Busy: p.busy.Load(), Waiting: p.waiting.Load(),
+		Images: p.images.Load(), Errors: p.errors.Load(), Converted: p.converted.Load(),
+		Downscaled: p.downscaled.Load(), Passes: p.passes.Load(),
+		BytesIn: p.bytesIn.Load(), BytesOut: p.bytesOut.Load(),
+		Time: time.Duration(p.nanos.Load()), Wait: time.Duration(p.waitN.Load()),
+	}
+}
+
+// String formats s for a log line.
+func (s Stats) String() string {
+	ratio := 0.0
+	if s.BytesIn > 0 {
+		ratio = float64(s.BytesOut) / float64(s.BytesIn)
+	}
+	avg := time.Duration(0)
+	if s.Images > 0 {
+		avg = s.Time / time.Duration(s.Images)
+	}
+	return fmt.Sprintf("images=%d errors=%d converted=%d downscaled=%d passes=%d in=%d out=%d ratio=%.2f avg=%s wait=%s workers=%d busy=%d waiting=%d",
+		s.Images, s.Errors, s.Converted, s.Downscaled, s.Passes, s.BytesIn, s.BytesOut, ratio,
+		avg.Round(time.Millisecond), s.Wait.Round(time.Millisecond), s.Workers, s.Busy, s.Waiting)
+}
@@ -0,0 +1,359 @@
+// Package loadtest drives a running be03 API with virtual users that log in,
+// upload receipt images from a corpus and list their uploads and catatan, the
+// traffic mix of the mobile app. The report gives latency percentiles, error
+// and rate-limit counts per operation, which is what sizing the OCR workers
+// of a server needs.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations reported by Run.
+const (
+	OpRegister     = "register"
+	OpLogin        = "login"
+	OpUpload       = "upload"
+	OpListUploads  = "list_uploads"
+	OpListCatatan  = "list_catatan"
+	apiPrefix      = "/api/v1"
+	defaultTimeout = 2 * time.Minute
+)
+
+// Image is one corpus file.
+type Image struct {
+	Name string
+	Data []byte
+}
+
+// LoadCorpus reads the JPEG and PNG files of dir.
+func LoadCorpus(dir string) ([]Image, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Image
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			continue
+		}
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Image{Name: e.Name(), Data: data})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no .jpg or .png files in %s", dir)
+	}
+	return out, nil
+}
+
+// Config describes a run.
+type Config struct {
+	// Target is the server's base URL, e.g. http://localhost:8080.
+	Target string
+	Users  int
+	// Run stops after Duration, or once every user has done Iterations
+	// upload-and-list rounds when that is set.
+	Duration   time.Duration
+	Iterations int
+	Images     []Image
+	// Virtual user i logs in as UserPrefix+i (from 1) with Password;
+	// Register creates the accounts first (existing ones are fine).
+	UserPrefix string
+	Password   string
+	Register   bool
+	// Think is the pause between a user's rounds.
+	Think  time.Duration
+	Client *http.Client
+}
+
+// Stats summarise one operation.
+type Stats struct {
+	Op          string
+	Count       int
+	Errors      int
+	RateLimited int
+	P50, P90    time.Duration
+	P99, Max    time.Duration
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	Elapsed time.Duration
+	Ops     []Stats
+}
+
+// Op returns the stats of op (zero when it never ran).
+func (r *Report) Op(op string) Stats {
+	for _, s := range r.Ops {
+		if s.Op == op {
+			return s
+		}
+	}
+	return Stats{Op: op}
+}
+
+// WriteTo prints the report as a table.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-13s %7s %7s %7s %9s %9s %9s %9s %8s\n", "op", "count", "errors", "429", "p50", "p90", "p99", "max", "req/s")
+	for _, s := range r.Ops {
+		rate := 0.0
+		if r.Elapsed > 0 {
+			rate = float64(s.Count) / r.Elapsed.Seconds()
+		}
+		fmt.Fprintf(&b, "%-13s %7d %7d %7d %9s %9s %9s %9s %8.2f\n", s.Op, s.Count, s.Errors, s.RateLimited,
+			round(s.P50), round(s.P90), round(s.P99), round(s.Max), rate)
+	}
+	fmt.Fprintf(&b, "elapsed %s\n", round(r.Elapsed))
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func round(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+
+// recorder collects samples from all virtual users.
+type recorder struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	errors  map[string]int
+	limited map[string]int
+}
+
+func (rec *recorder) add(op string, d time.Duration, status int, err error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.samples[op] = append(rec.samples[op], d)
+	switch {
+	case status == http.StatusTooManyRequests:
+		rec.limited[op]++
+	case err != nil || status < 200 || status > 299:
+		rec.errors[op]++
+	}
+}
+
+func (rec *recorder) report(elapsed time.Duration) *Report {
+	r := &Report{Elapsed: elapsed}
+	for op, ds := range rec.samples {
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		r.Ops = append(r.Ops, Stats{Op: op, Count: len(ds), Errors: rec.errors[op], RateLimited: rec.limited[op],
+			P50: percentile(ds, 50), P90: percentile(ds, 90), P99: percentile(ds, 99), Max: ds[len(ds)-1]})
+	}
+	order := map[string]int{OpRegister: 0, OpLogin: 1, OpUpload: 2, OpListUploads: 3, OpListCatatan: 4}
+	sort.Slice(r.Ops, func(i, j int) bool { return order[r.Ops[i].Op] < order[r.Ops[j].Op] })
+	return r
+}
+
+// percentile uses the nearest-rank method on sorted ds.
+func percentile(ds []time.Duration, p int) time.Duration {
+	i := (len(ds)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return ds[i-1]
+}
+
+// Run starts cfg.Users virtual users and waits until the run ends or ctx is
+// cancelled.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Target == "" || cfg.Users < 1 || len(cfg.Images) == 0 {
+		return nil, errors.New("loadtest: target, users and images are required")
+	}
+	if cfg.Duration <= 0 && cfg.Iterations <= 0 {
+		return nil, errors.New("loadtest: set a duration or a number of iterations")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if cfg.UserPrefix == "" {
+		cfg.UserPrefix = "loadtest"
+	}
+	cfg.Target = strings.TrimRight(cfg.Target, "/")
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	rec := &recorder{samples: map[string][]time.Duration{}, errors: map[string]int{}, limited: map[string]int{}}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 1; i <= cfg.Users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vu := &virtualUser{cfg: &cfg, rec: rec, id: i, username: fmt.Sprintf("%s%d", cfg.UserPrefix, i)}
+			vu.run(ctx)
+		}(i)
+	}
+	wg.Wait()
+	return rec.report(time.Since(start)), nil
+}
+
+type virtualUser struct {
+	cfg      *Config
+	rec      *recorder
+	id       int
+	username string
+	token    string
+}
+
+func (vu *virtualUser) run(ctx context.Context) {
+	creds := jsonBody(map[string]string{"username": vu.username, "password": vu.cfg.Password})
+	if vu.cfg.Register {
+		// 409 means the account exists from an earlier run
+		status, _, err := vu.retry(ctx, OpRegister, "/register", creds)
+		if err != nil || status >= 300 && status != http.StatusConflict {
+			return
+		}
+	}
+	status, body, err := vu.retry(ctx, OpLogin, "/login", creds)
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err != nil || status != http.StatusOK || json.Unmarshal(body, &login) != nil || login.AccessToken == "" {
+		return
+	}
+	vu.token = login.AccessToken
+
+	for n := 0; vu.cfg.Iterations <= 0 || n < vu.cfg.Iterations; n++ {
+		img := vu.cfg.Images[(vu.id+n)%len(vu.cfg.Images)]
+		name := fmt.Sprintf("vu%d-%d-%s", vu.id, n, img.Name)
+		body, ct, err := multipartFile(name, unique(img.Data, name))
+		if err != nil {
+			return
+		}
+		vu.do(ctx, OpUpload, http.MethodPost, "/uploads", body, ct)
+		vu.do(ctx, OpListUploads, http.MethodGet, "/uploads", nil, "")
+		vu.do(ctx, OpListCatatan, http.MethodGet, "/catatan", nil, "")
+		if ctx.Err() != nil {
+			return
+		}
+		if vu.cfg.Think > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(vu.cfg.Think):
+			}
+		}
+	}
+}
+
+// retry posts body to path until it is not rate limited: the server limits
+// logins per client IP, and every virtual user shares the load generator's.
+func (vu *virtualUser) retry(ctx context.Context, op, path string, body []byte) (int, []byte, error) {
+	for {
+		status, data, wait, err := vu.do(ctx, op, http.MethodPost, path, body, "application/json")
+		if err != nil || status != http.StatusTooManyRequests {
+			return status, data, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// do performs one request and records it unless the run ended meanwhile.
+// wait is the server's Retry-After (one second when absent).
+func (vu *virtualUser) do(ctx context.Context, op, method, path string, body []byte, contentType string) (status int, data []byte, wait time.Duration, err error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, vu.cfg.Target+apiPrefix+path, rd)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if vu.token != "" {
+		req.Header.Set("Authorization", "Bearer "+vu.token)
+	}
+	start := time.Now()
+	resp, err := vu.cfg.Client.Do(req)
+	wait = time.Second
+	if err == nil {
+		data, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		status = resp.StatusCode
+		if n, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && n > 0 {
+			wait = time.Duration(n) * time.Second
+		}
+	}
+	if ctx.Err() != nil {
+		// cut off by the end of the run, not the server's fault
+		return status, data, wait, ctx.Err()
+	}
+	vu.rec.add(op, time.Since(start), status, err)
+	return status, data, wait, err
+}
+
+func jsonBody(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func multipartFile(name string, data []byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+// unique embeds tag in a comment so the server does not reject repeated
+// corpus images as duplicates and every upload really goes through OCR:
+// a COM segment after the JPEG SOI marker, or a tEXt chunk after the PNG
+// header. Other data is returned unchanged.
+func unique(data []byte, tag string) []byte {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		seg := []byte{0xFF, 0xFE, 0, 0}
+		binary.BigEndian.PutUint16(seg[2:], uint16(len(tag)+2))
+		out := append([]byte{0xFF, 0xD8}, seg...)
+		out = append(out, tag...)
+		return append(out, data[2:]...)
+	case len(data) > 33 && bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		// signature (8) + IHDR chunk (25)
+		payload := append([]byte("tEXt"), append([]byte("Comment\x00"), tag...)...)
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)-4))
+		chunk = append(chunk, payload...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(payload))
+		out := append(append([]byte{}, data[:33]...), chunk...)
+		return append(out, data[33:]...)
+	}
+	return data
+}
@@ -0,0 +1,140 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func encoded(t *testing.T, asPNG bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 40, 60))
+	var err error
+	if asPNG {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUniqueKeepsImagesDecodable(t *testing.T) {
+	for _, asPNG := range []bool{false, true} {
+		orig := encoded(t, asPNG)
+		a, b := unique(orig, "vu1-0"), unique(orig, "vu1-1")
+		if bytes.Equal(a, b) || bytes.Equal(a, orig) {
+			t.Fatalf("png=%v: tagged copies are not distinct", asPNG)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(a)); err != nil {
+			t.Fatalf("png=%v: tagged copy does not decode: %v", asPNG, err)
+		}
+	}
+}
+
+func TestRunReportsEveryOperation(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		hashes   = map[[32]byte]bool{}
+		logins   atomic.Int32
+		accounts sync.Map
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/register":
+			body, _ := io.ReadAll(r.Body)
+			if _, taken := accounts.LoadOrStore(string(body), true); taken {
+				w.WriteHeader(http.StatusConflict)
+			}
+		case "POST /api/v1/login":
+			// the first attempt is throttled, as the auth limit would
+			if logins.Add(1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			io.WriteString(w, `{"access_token":"tok"}`)
+		case "POST /api/v1/uploads":
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(f)
+			mu.Lock()
+			dup := hashes[sha256.Sum256(data)]
+			hashes[sha256.Sum256(data)] = true
+			mu.Unlock()
+			if dup {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case "GET /api/v1/uploads", "GET /api/v1/catatan":
+			io.WriteString(w, "[]")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	rep, err := Run(context.Background(), Config{
+		Target: srv.URL + "/", Users: 3, Iterations: 2, Password: "secret1", Register: true,
+		Images: []Image{{Name: "a.jpg", Data: encoded(t, false)}, {Name: "b.png", Data: encoded(t, true)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rep.Op(OpRegister); s.Count != 3 || s.Errors != 0 {
+		t.Fatalf("register = %+v", s)
+	}
+	if s := rep.Op(OpLogin); s.Count != 4 || s.RateLimited != 1 || s.Errors != 0 {
+		t.Fatalf("login = %+v", s)
+	}
+	for _, op := range []string{OpUpload, OpListUploads, OpListCatatan} {
+		if s := rep.Op(op); s.Count != 6 || s.Errors != 0 || s.Max < s.P50 {
+			t.Fatalf("%s = %+v", op, s)
+		}
+	}
+	var out strings.Builder
+	rep.WriteTo(&out)
+	if !strings.Contains(out.String(), "upload") || !strings.Contains(out.String(), "p99") {
+		t.Fatalf("report:\n%s", out.String())
+	}
+
+	// a run bounded by time stops on its own
+	start := time.Now()
+	rep, err = Run(context.Background(), Config{Target: srv.URL, Users: 2, Duration: 200 * time.Millisecond, Password: "secret1",
+		Think: 20 * time.Millisecond, Images: []Image{{Name: "a.jpg", Data: encoded(t, false)}}})
+	if err != nil || time.Since(start) > 5*time.Second || rep.Op(OpUpload).Count == 0 {
+		t.Fatalf("timed run: %v %+v", err, rep)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ds := make([]time.Duration, 100)
+	for i := range ds {
+		ds[i] = time.Duration(i+1) * time.Millisecond
+	}
+	if percentile(ds, 50) != 50*time.Millisecond || percentile(ds, 99) != 99*time.Millisecond || percentile(ds[:1], 90) != time.Millisecond {
+		t.Fatal("nearest-rank percentile off")
+	}
+}
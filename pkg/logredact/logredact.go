@@ -0,0 +1,116 @@
+// Package logredact masks personal financial data (amounts, account numbers,
+// phone numbers) in OCR debug logs. Masking keeps the shape of what was
+// redacted, e.g. "Rp ###.###" or "******7890", so a log still shows whether a
+// currency amount or an account number was read, and how many digits it had.
+//
+// Redaction is on unless LOG_REDACT is "0", "false", "no" or "off".
+package logredact
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var enabled atomic.Bool
+
+func init() {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LOG_REDACT"))) {
+	case "0", "false", "no", "off":
+	default:
+		enabled.Store(true)
+	}
+}
+
+// Enabled reports whether log output is redacted.
+func Enabled() bool { return enabled.Load() }
+
+// SetEnabled turns redaction on or off, overriding LOG_REDACT.
+func SetEnabled(on bool) { enabled.Store(on) }
+
+var (
+	// Indonesian mobile numbers: 08…, 628… or +628…, optionally grouped
+	phoneRe = regexp.MustCompile(`(?:\+62[ -]?|\b62|\b0)8[0-9](?:[ -]?[0-9]){6,10}\b`)
+	// runs of 8+ digits, optionally grouped by spaces or dashes: account and
+	// card numbers, reference numbers
+	accountRe = regexp.MustCompile(`\b[0-9](?:[ -]?[0-9]){7,}\b`)
+	// any run of 4+ digits, for messages built from bare amounts
+	digitsRe = regexp.MustCompile(`[0-9]{4,}`)
+	// currency-marked numbers and thousands-grouped numbers
+	amountRe = regexp.MustCompile(`(?i)(?:\b(?:rp|idr)\.?\s*[0-9][0-9.,]*)|\b[0-9]{1,3}(?:[.,][0-9]{3})+(?:[.,][0-9]{2})?\b`)
+)
+
+// Text masks amounts, account numbers and phone numbers in s.
+func Text(s string) string {
+	if !Enabled() || s == "" {
+		return s
+	}
+	return Mask(s)
+}
+
+// Mask is Text regardless of LOG_REDACT, for data leaving the server such as
+// error reports.
+func Mask(s string) string {
+	s = phoneRe.ReplaceAllStringFunc(s, func(m string) string {
+		// keep the country / trunk prefix up to the mobile "8"
+		n := strings.IndexByte(m, '8') + 1
+		return m[:n] + maskDigits(m[n:])
+	})
+	s = accountRe.ReplaceAllStringFunc(s, func(m string) string {
+		// keep the last four digits, like a bank statement does
+		digits := 0
+		for i := len(m) - 1; i >= 0; i-- {
+			if m[i] >= '0' && m[i] <= '9' {
+				digits++
+				if digits == 4 {
+					return strings.Repeat("*", len(m[:i])) + m[i:]
+				}
+			}
+		}
+		return m
+	})
+	return amountRe.ReplaceAllStringFunc(s, maskDigits)
+}
+
+// Digits masks every run of four or more digits in s. Use it for messages
+// that embed bare amounts, like anomaly reasons, which Text cannot tell apart
+// from other numbers.
+func Digits(s string) string {
+	if !Enabled() {
+		return s
+	}
+	return digitsRe.ReplaceAllStringFunc(s, maskDigits)
+}
+
+// Amount formats n for a log line, masked to its number of digits when
+// redaction is on.
+func Amount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if !Enabled() {
+		return s
+	}
+	return maskDigits(s)
+}
+
+// Strings is Text applied to every element of ss.
+func Strings(ss []string) []string {
+	if !Enabled() {
+		return ss
+	}
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = Text(s)
+	}
+	return out
+}
+
+func maskDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '#'
+		}
+		return r
+	}, s)
+}
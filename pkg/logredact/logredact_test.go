@@ -0,0 +1,40 @@
+package logredact
+
+import "testing"
+
+func TestText(t *testing.T) {
+	SetEnabled(true)
+	t.Cleanup(func() { SetEnabled(true) })
+	cases := []struct{ in, want string }{
+		{"TOTAL Rp 125.000", "TOTAL Rp ###.###"},
+		{"Transfer IDR 4010000 berhasil", "Transfer IDR ####### berhasil"},
+		{"jumlah 1.250.000,00", "jumlah #.###.###,##"},
+		{"rek 1234567890 a.n. BUDI", "rek ******7890 a.n. BUDI"},
+		{"no 1234 5678 9012", "no **********9012"},
+		{"hp 081234567890", "hp 08##########"},
+		{"wa +62 812-3456-7890", "wa +62 8##-####-####"},
+		{"tanggal 17/08/2025 jam 10:15", "tanggal 17/08/2025 jam 10:15"},
+	}
+	for _, c := range cases {
+		if got := Text(c.in); got != c.want {
+			t.Errorf("Text(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+	if got := Digits("amount 125000 is over 10x the usual 2000"); got != "amount ###### is over 10x the usual ####" {
+		t.Errorf("Digits = %q", got)
+	}
+	if got := Amount(125000); got != "######" {
+		t.Errorf("Amount = %q", got)
+	}
+
+	SetEnabled(false)
+	if got := Text("Rp 125.000 rek 1234567890"); got != "Rp 125.000 rek 1234567890" {
+		t.Errorf("disabled redaction changed the text: %q", got)
+	}
+	if got := Amount(125000); got != "125000" {
+		t.Errorf("disabled Amount = %q", got)
+	}
+	if got := Mask("Rp 125.000"); got != "Rp ###.###" {
+		t.Errorf("Mask ignores LOG_REDACT, got %q", got)
+	}
+}
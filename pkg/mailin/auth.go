@@ -0,0 +1,117 @@
+package mailin
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Verify sets m.Verified from the Authentication-Results headers stamped by the
+// receiving server authserv (e.g. "mx.google.com"). Headers from any other server
+// are ignored, and so are older ones below its topmost stamp: the sender can write
+// those itself. An empty authserv trusts none.
+func (m *Message) Verify(authserv string) {
+	if authserv == "" {
+		return
+	}
+	for _, h := range m.authResults {
+		id, results, _ := strings.Cut(stripComments(h), ";")
+		// the authserv-id may carry a version: "mx.example.com 1"
+		if f := strings.Fields(id); len(f) == 0 || !strings.EqualFold(f[0], authserv) {
+			continue
+		}
+		for _, r := range strings.Split(results, ";") {
+			if authPass(strings.Fields(r), m.From) {
+				m.Verified = true
+			}
+		}
+		return
+	}
+}
+
+// authPass reports whether one Authentication-Results entry ("dkim=pass
+// header.d=example.com ...") is a pass aligned with the From address.
+func authPass(fields []string, from string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	method, result, _ := strings.Cut(strings.ToLower(fields[0]), "=")
+	if result != "pass" {
+		return false
+	}
+	props := map[string]string{}
+	for _, f := range fields[1:] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			props[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	switch method {
+	case "dmarc":
+		return aligned(props["header.from"], from)
+	case "dkim":
+		if d := props["header.d"]; d != "" {
+			return aligned(d, from)
+		}
+		return aligned(props["header.i"], from)
+	case "spf":
+		return aligned(props["smtp.mailfrom"], from)
+	}
+	return false
+}
+
+// sendgridDKIM matches the passing domains of SendGrid's dkim field, which
+// reads like "{@example.com : pass, @mailer.net : fail}".
+var sendgridDKIM = regexp.MustCompile(`@([A-Za-z0-9.-]+)\s*:\s*pass`)
+
+// VerifyFields sets m.Verified from the checks an inbound-parse provider reports
+// in its webhook fields: SendGrid's SPF, dkim and envelope, Mailgun's
+// X-Mailgun-Spf and sender. SPF only counts when the envelope sender it vouches
+// for is in the From domain.
+func (m *Message) VerifyFields(get func(string) string) {
+	var envelope struct {
+		From string `json:"from"`
+	}
+	_ = json.Unmarshal([]byte(get("envelope")), &envelope)
+	if strings.EqualFold(get("SPF"), "pass") && aligned(envelope.From, m.From) {
+		m.Verified = true
+	}
+	for _, d := range sendgridDKIM.FindAllStringSubmatch(get("dkim"), -1) {
+		if aligned(d[1], m.From) {
+			m.Verified = true
+		}
+	}
+	if strings.EqualFold(get("X-Mailgun-Spf"), "pass") && aligned(get("sender"), m.From) {
+		m.Verified = true
+	}
+}
+
+// aligned reports whether the authenticated domain (or address) d belongs to the
+// same domain as the from address: equal, or one a subdomain of the other.
+func aligned(d, from string) bool {
+	if i := strings.LastIndex(d, "@"); i >= 0 {
+		d = d[i+1:]
+	}
+	d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "<>."))
+	_, fd, ok := strings.Cut(from, "@")
+	if !ok || d == "" || fd == "" || !strings.Contains(d, ".") {
+		return false
+	}
+	return d == fd || strings.HasSuffix(fd, "."+d) || strings.HasSuffix(d, "."+fd)
+}
+
+// stripComments drops the parenthesised comments of a header value.
+func stripComments(v string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range v {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
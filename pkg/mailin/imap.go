@@ -0,0 +1,117 @@
+package mailin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// IMAPConfig describes the mailbox that receives forwarded receipts.
+type IMAPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	Mailbox  string
+	Insecure bool // plain connection, for local test servers only
+	Interval time.Duration
+	// AuthServID names the server whose Authentication-Results headers are
+	// trusted to verify senders (see Message.Verify).
+	AuthServID string
+}
+
+// IMAPConfigFromEnv reads MAIL_IMAP_ADDR, MAIL_IMAP_USER, MAIL_IMAP_PASSWORD,
+// MAIL_IMAP_MAILBOX (default INBOX), MAIL_IMAP_INSECURE, MAIL_IMAP_INTERVAL
+// (default 1m) and MAIL_AUTHSERV_ID. ok is false when no address is configured.
+func IMAPConfigFromEnv() (cfg IMAPConfig, ok bool) {
+	cfg = IMAPConfig{
+		Addr:       strings.TrimSpace(os.Getenv("MAIL_IMAP_ADDR")),
+		Username:   os.Getenv("MAIL_IMAP_USER"),
+		Password:   os.Getenv("MAIL_IMAP_PASSWORD"),
+		Mailbox:    os.Getenv("MAIL_IMAP_MAILBOX"),
+		Interval:   time.Minute,
+		AuthServID: strings.TrimSpace(os.Getenv("MAIL_AUTHSERV_ID")),
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	switch strings.ToLower(os.Getenv("MAIL_IMAP_INSECURE")) {
+	case "true", "1", "yes":
+		cfg.Insecure = true
+	}
+	if d, err := time.ParseDuration(os.Getenv("MAIL_IMAP_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	return cfg, cfg.Addr != ""
+}
+
+// FetchUnseen hands every unseen message in the mailbox to handle and flags it
+// \Seen once handle returns nil, so a failed message is retried on the next poll.
+// It returns the number of messages handled successfully.
+func FetchUnseen(cfg IMAPConfig, handle func(*Message) error) (int, error) {
+	var c *client.Client
+	var err error
+	if cfg.Insecure {
+		c, err = client.Dial(cfg.Addr)
+	} else {
+		c, err = client.DialTLS(cfg.Addr, nil)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("imap dial: %w", err)
+	}
+	defer c.Logout()
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		return 0, fmt.Errorf("imap login: %w", err)
+	}
+	if _, err := c.Select(cfg.Mailbox, false); err != nil {
+		return 0, fmt.Errorf("imap select %s: %w", cfg.Mailbox, err)
+	}
+	crit := imap.NewSearchCriteria()
+	crit.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(crit)
+	if err != nil || len(uids) == 0 {
+		return 0, err
+	}
+
+	seq := new(imap.SeqSet)
+	seq.AddNum(uids...)
+	// BODY.PEEK leaves \Seen alone; it is set explicitly after a successful handle
+	section := &imap.BodySectionName{Peek: true}
+	msgs := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() { done <- c.UidFetch(seq, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, msgs) }()
+
+	handled := new(imap.SeqSet)
+	var n int
+	var errs []error
+	for im := range msgs {
+		body := im.GetBody(section)
+		if body == nil {
+			continue
+		}
+		m, err := Parse(body)
+		if err == nil {
+			err = handle(m)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("uid %d: %w", im.Uid, err))
+			continue
+		}
+		handled.AddNum(im.Uid)
+		n++
+	}
+	if err := <-done; err != nil {
+		return n, fmt.Errorf("imap fetch: %w", err)
+	}
+	if n > 0 {
+		flags := []interface{}{imap.SeenFlag}
+		if err := c.UidStore(handled, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+			errs = append(errs, fmt.Errorf("imap flag seen: %w", err))
+		}
+	}
+	return n, errors.Join(errs...)
+}
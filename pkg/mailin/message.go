@@ -0,0 +1,154 @@
+// Package mailin turns inbound e-mail (IMAP or provider webhooks) into receipt
+// attachments for the upload pipeline.
+package mailin
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+)
+
+// MaxAttachmentBytes bounds how much of a single attachment is read.
+const MaxAttachmentBytes = 10 << 20
+
+// Attachment is one file carried by a message.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is the part of an e-mail the ingestion needs.
+type Message struct {
+	ID          string // Message-ID header, may be empty
+	From        string // lower-cased sender address
+	Subject     string
+	Attachments []Attachment
+	// Verified is set by Verify or VerifyFields once the receiving side has
+	// authenticated From (a DKIM, SPF or DMARC pass aligned with its domain).
+	Verified bool
+
+	authResults []string // Authentication-Results headers, topmost first
+}
+
+// receiptTypes are the attachment types worth handing to the upload pipeline.
+var receiptTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"application/pdf": true,
+}
+
+// IsReceipt reports whether a looks like an e-receipt (image or PDF).
+func IsReceipt(a Attachment) bool {
+	if receiptTypes[a.ContentType] {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(a.Name)) {
+	case ".jpg", ".jpeg", ".png", ".pdf":
+		return true
+	}
+	return false
+}
+
+// Receipts returns the attachments of m that pass IsReceipt.
+func (m *Message) Receipts() []Attachment {
+	var out []Attachment
+	for _, a := range m.Attachments {
+		if IsReceipt(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// ParseAddress extracts the lower-cased address from a From-style header value.
+func ParseAddress(v string) string {
+	if a, err := mail.ParseAddress(v); err == nil {
+		return strings.ToLower(a.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+// Parse reads a raw RFC 5322 message and collects its attachments, walking nested
+// multipart bodies (forwarded mails usually wrap the original one level deeper).
+func Parse(r io.Reader) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	m := &Message{
+		ID:          strings.Trim(msg.Header.Get("Message-ID"), "<> "),
+		From:        ParseAddress(msg.Header.Get("From")),
+		Subject:     subject,
+		authResults: msg.Header["Authentication-Results"],
+	}
+	err = m.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body)
+	return m, err
+}
+
+func (m *Message) walk(contentType, encoding, disposition string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.walk(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p.Header.Get("Content-Disposition"), p); err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType == "message/rfc822" {
+		inner, err := Parse(body)
+		if err != nil {
+			return nil // an unreadable forwarded mail should not drop the outer attachments
+		}
+		m.Attachments = append(m.Attachments, inner.Attachments...)
+		return nil
+	}
+	name := params["name"]
+	if _, dp, err := mime.ParseMediaType(disposition); err == nil && dp["filename"] != "" {
+		name = dp["filename"]
+	}
+	if name == "" {
+		return nil // inline text/html bodies
+	}
+	if dn, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = dn
+	}
+	data, err := io.ReadAll(io.LimitReader(decode(encoding, body), MaxAttachmentBytes+1))
+	if err != nil {
+		return err
+	}
+	m.Attachments = append(m.Attachments, Attachment{Name: filepath.Base(name), ContentType: mediaType, Data: data})
+	return nil
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r) // ignores the CR/LF line wrapping
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package mailin
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+const forwarded = "From: \"Demo User\" <Demo@Example.com>\r\n" +
+	"Message-ID: <abc@mail.example.com>\r\n" +
+	"Subject: =?UTF-8?Q?Fwd:_Struk_belanja?=\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"see attached\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/jpeg; name=\"struk.jpg\"\r\n" +
+	"Content-Disposition: attachment; filename=\"struk.jpg\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"/9j/4AAQ\r\nSkZJRg==\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: shop@example.com\r\n" +
+	"Content-Type: multipart/mixed; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=invoice.pdf\r\n" +
+	"\r\n" +
+	"%PDF-1.4\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/csv\r\n" +
+	"Content-Disposition: attachment; filename=items.csv\r\n" +
+	"\r\n" +
+	"a,b\r\n" +
+	"--inner--\r\n" +
+	"--outer--\r\n"
+
+func TestParse(t *testing.T) {
+	m, err := Parse(strings.NewReader(forwarded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "demo@example.com" || m.ID != "abc@mail.example.com" || m.Subject != "Fwd: Struk belanja" {
+		t.Fatalf("headers = %+v", m)
+	}
+	if len(m.Attachments) != 3 {
+		t.Fatalf("attachments = %d, want 3", len(m.Attachments))
+	}
+	jpg := m.Attachments[0]
+	if jpg.Name != "struk.jpg" || jpg.ContentType != "image/jpeg" || string(jpg.Data) != "\xff\xd8\xff\xe0\x00\x10JFIF" {
+		t.Fatalf("jpeg attachment = %+v", jpg)
+	}
+	got := m.Receipts()
+	if len(got) != 2 || got[0].Name != "struk.jpg" || got[1].Name != "invoice.pdf" {
+		t.Fatalf("receipts = %+v", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	raw := "Authentication-Results: mx.example.net;\r\n" +
+		" dkim=pass (2048-bit key) header.d=example.com header.s=s1;\r\n" +
+		" spf=neutral smtp.mailfrom=demo@example.com\r\n" +
+		"Authentication-Results: mx.example.net; dkim=pass header.d=example.com\r\n" +
+		"From: Demo <demo@mail.example.com>\r\n" +
+		"\r\n" +
+		"hi\r\n"
+	cases := []struct {
+		name, raw, authserv string
+		want                bool
+	}{
+		{"aligned dkim", raw, "mx.example.net", true},
+		{"untrusted server", raw, "mx.other.net", false},
+		{"no authserv", raw, "", false},
+		{"foreign domain", strings.Replace(raw, "header.d=example.com header.s", "header.d=attacker.net header.s", 1), "mx.example.net", false},
+		// only the receiving server's topmost stamp counts, not one the sender added below it
+		{"forged below", strings.Replace(raw, "dkim=pass (2048-bit key)", "dkim=fail", 1), "mx.example.net", false},
+		{"spf", "Authentication-Results: mx.example.net 1; spf=pass smtp.mailfrom=bounce@example.com\r\nFrom: demo@example.com\r\n\r\n", "mx.example.net", true},
+		{"dmarc", "Authentication-Results: mx.example.net; dmarc=pass header.from=example.com\r\nFrom: demo@example.com\r\n\r\n", "MX.example.net", true},
+	}
+	for _, tc := range cases {
+		m, err := Parse(strings.NewReader(tc.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Verify(tc.authserv)
+		if m.Verified != tc.want {
+			t.Errorf("%s: verified = %v", tc.name, m.Verified)
+		}
+	}
+}
+
+func TestVerifyFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields map[string]string
+		want   bool
+	}{
+		{"sendgrid dkim", map[string]string{"dkim": "{@mailer.net : fail, @example.com : pass}"}, true},
+		{"sendgrid dkim other domain", map[string]string{"dkim": "{@attacker.net : pass}"}, false},
+		{"sendgrid spf", map[string]string{"SPF": "pass", "envelope": `{"to":["r@in.example.org"],"from":"bounce@example.com"}`}, true},
+		{"sendgrid spf other envelope", map[string]string{"SPF": "pass", "envelope": `{"from":"x@attacker.net"}`}, false},
+		{"mailgun spf", map[string]string{"X-Mailgun-Spf": "Pass", "sender": "demo@example.com"}, true},
+		{"mailgun softfail", map[string]string{"X-Mailgun-Spf": "SoftFail", "sender": "demo@example.com"}, false},
+		{"nothing", map[string]string{}, false},
+	}
+	for _, tc := range cases {
+		m := &Message{From: "demo@example.com"}
+		m.VerifyFields(func(k string) string { return tc.fields[k] })
+		if m.Verified != tc.want {
+			t.Errorf("%s: verified = %v", tc.name, m.Verified)
+		}
+	}
+}
+
+func TestPDFImage(t *testing.T) {
+	var small, large bytes.Buffer
+	_ = jpeg.Encode(&small, image.NewGray(image.Rect(0, 0, 4, 4)), nil)
+	_ = jpeg.Encode(&large, image.NewGray(image.Rect(0, 0, 64, 64)), nil)
+	pdf := "%PDF-1.4\n" +
+		"1 0 obj\n<< /Type /XObject /Subtype /Image /Filter /DCTDecode /Length 9 >>\nstream\n" + small.String() + "\nendstream\nendobj\n" +
+		"2 0 obj\n<< /Length 5 /Filter /FlateDecode >>\nstream\nxxxxx\nendstream\nendobj\n" +
+		"3 0 obj\n<< /Subtype /Image /Filter [/FlateDecode /DCTDecode] >>\nstream\n" + large.String() + "\nendstream\nendobj\n" +
+		"4 0 obj\n<< /Subtype /Image /Filter /DCTDecode >>\nstream\r\n" + large.String() + "\r\nendstream\nendobj\n%%EOF\n"
+	img, ok := PDFImage([]byte(pdf))
+	if !ok || !bytes.Equal(img, large.Bytes()) {
+		t.Fatalf("got %d bytes, ok=%v; want the %d-byte image", len(img), ok, large.Len())
+	}
+	if _, ok := PDFImage([]byte("%PDF-1.4\n1 0 obj\n<< /Length 4 >>\nstream\nBT (Total 50.000) Tj ET\nendstream\nendobj\n")); ok {
+		t.Fatal("text-only pdf yielded an image")
+	}
+}
@@ -0,0 +1,61 @@
+package mailin
+
+import (
+	"bytes"
+	"image/jpeg"
+)
+
+// IsPDF reports whether a is a PDF attachment.
+func IsPDF(a Attachment) bool {
+	return a.ContentType == "application/pdf" || bytes.HasPrefix(a.Data, []byte("%PDF-"))
+}
+
+// otherFilters are stream filters that would have to be undone before the data
+// is a JPEG; such images are skipped rather than decoded.
+var otherFilters = [][]byte{
+	[]byte("/FlateDecode"), []byte("/LZWDecode"), []byte("/ASCII85Decode"),
+	[]byte("/ASCIIHexDecode"), []byte("/RunLengthDecode"), []byte("/Crypt"),
+}
+
+// PDFImage returns the largest JPEG image embedded in a PDF, which for a scanned
+// or photographed receipt saved as PDF is the receipt itself. ok is false when
+// the PDF carries no plain DCTDecode image (text-only e-receipts, for example).
+func PDFImage(data []byte) (img []byte, ok bool) {
+	rest := data
+	for {
+		i := bytes.Index(rest, []byte("stream"))
+		if i < 0 {
+			break
+		}
+		dict := rest[:i]
+		if j := bytes.LastIndex(dict, []byte("obj")); j >= 0 {
+			dict = dict[j:]
+		}
+		body := bytes.TrimPrefix(rest[i+len("stream"):], []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		if isJPEGStream(dict) {
+			s := bytes.TrimRight(body[:end], "\r\n")
+			if _, err := jpeg.DecodeConfig(bytes.NewReader(s)); err == nil && len(s) > len(img) {
+				img = s
+			}
+		}
+		rest = body[end+len("endstream"):]
+	}
+	return img, img != nil
+}
+
+func isJPEGStream(dict []byte) bool {
+	if !bytes.Contains(dict, []byte("/Image")) || !bytes.Contains(dict, []byte("/DCTDecode")) {
+		return false
+	}
+	for _, f := range otherFilters {
+		if bytes.Contains(dict, f) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Package maintenance stores the maintenance-mode switch. While it is on the
+// API rejects writes and the watcher stops claiming new files, so migrations
+// can run against a quiet database.
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+const settingKey = "maintenance"
+
+// DefaultMessage is shown when the administrator gave none.
+const DefaultMessage = "Layanan sedang dalam pemeliharaan, silakan coba lagi nanti."
+
+// State is the current maintenance mode.
+type State struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message"`
+	Since   *time.Time `json:"since,omitempty"`
+	By      string     `json:"by,omitempty"`
+	// Forced is set when MAINTENANCE_MODE is on; it cannot be lifted via the API.
+	Forced bool `json:"forced"`
+}
+
+// forced reports the MAINTENANCE_MODE config flag.
+func forced() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAINTENANCE_MODE"))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// Load reads the stored state; a missing row means off.
+func Load(gdb *gorm.DB) (State, error) {
+	var st State
+	var s models.Setting
+	err := gdb.Where("key = ?", settingKey).First(&s).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return st, err
+	default:
+		if err := json.Unmarshal([]byte(s.Value), &st); err != nil {
+			return st, err
+		}
+	}
+	if forced() {
+		st.Enabled, st.Forced = true, true
+	}
+	if st.Enabled && st.Message == "" {
+		st.Message = DefaultMessage
+	}
+	return st, nil
+}
+
+// Set switches maintenance mode on or off on behalf of by.
+func Set(gdb *gorm.DB, enabled bool, message, by string) (State, error) {
+	st := State{Enabled: enabled, Message: strings.TrimSpace(message), By: by}
+	if enabled {
+		now := time.Now()
+		st.Since = &now
+	}
+	b, _ := json.Marshal(st)
+	if err := gdb.Save(&models.Setting{Key: settingKey, Value: string(b)}).Error; err != nil {
+		return st, err
+	}
+	cache.invalidate()
+	return Load(gdb)
+}
+
+// Current returns the state, re-reading the database at most every ttl so the
+// per-request check stays cheap. Read errors keep the last known state.
+func Current(gdb *gorm.DB, ttl time.Duration) State {
+	return cache.get(gdb, ttl)
+}
+
+var cache stateCache
+
+type stateCache struct {
+	mu    sync.Mutex
+	state State
+	at    time.Time
+}
+
+func (c *stateCache) get(gdb *gorm.DB, ttl time.Duration) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.at.IsZero() && time.Since(c.at) < ttl {
+		return c.state
+	}
+	if st, err := Load(gdb); err == nil {
+		c.state = st
+	}
+	c.at = time.Now()
+	return c.state
+}
+
+func (c *stateCache) invalidate() {
+	c.mu.Lock()
+	c.at = time.Time{}
+	c.mu.Unlock()
+}
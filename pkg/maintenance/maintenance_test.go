@@ -0,0 +1,31 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"be03/pkg/testenv"
+)
+
+func TestSetAndLoad(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	if st := Current(gdb, time.Minute); st.Enabled {
+		t.Fatalf("expected off by default: %+v", st)
+	}
+	st, err := Set(gdb, true, "", "admin")
+	if err != nil || !st.Enabled || st.Message != DefaultMessage || st.Since == nil || st.By != "admin" {
+		t.Fatalf("enable: %+v %v", st, err)
+	}
+	// Set drops the cache, so the switch is visible at once
+	if !Current(gdb, time.Minute).Enabled {
+		t.Fatal("cache not invalidated")
+	}
+	if st, _ = Set(gdb, false, "", "admin"); st.Enabled {
+		t.Fatalf("disable: %+v", st)
+	}
+
+	t.Setenv("MAINTENANCE_MODE", "true")
+	if st, _ = Load(gdb); !st.Enabled || !st.Forced {
+		t.Fatalf("config flag ignored: %+v", st)
+	}
+}
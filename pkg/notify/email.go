@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTP is the e-mail channel.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPFromEnv reads SMTP_ADDR, SMTP_USER, SMTP_PASSWORD and SMTP_FROM
+// (default SMTP_USER). ok is false when no address is configured.
+func SMTPFromEnv() (s *SMTP, ok bool) {
+	s = &SMTP{
+		Addr:     strings.TrimSpace(os.Getenv("SMTP_ADDR")),
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if s.From == "" {
+		s.From = s.Username
+	}
+	return s, s.Addr != ""
+}
+
+// Name implements Channel.
+func (s *SMTP) Name() string { return ChannelEmail }
+
+// Send implements Channel with a plain-text message.
+func (s *SMTP) Send(_ context.Context, to Recipient, m Message) error {
+	if to.Email == "" {
+		return ErrNoAddress
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to.Email}, buildMail(s.From, to.Email, m))
+}
+
+func buildMail(from, to string, m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,142 @@
+// Package notify renders user notifications from templates, stores them for the
+// in-app list and delivers them through the channels a user opted into (email,
+// web push, webhook) with retries.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"be03/models"
+)
+
+// Kinds of notification.
+const (
+	KindOCRFailed      = "ocr_failed"
+	KindWeeklySummary  = "weekly_summary"
+	KindBudgetExceeded = "budget_exceeded"
+	KindOrgInvite      = "org_invite"
+	KindOrgQuota       = "org_quota"
+	KindPeriodLocked   = "period_locked"
+)
+
+// Channel names, as stored on NotificationDelivery.
+const (
+	ChannelEmail   = "email"
+	ChannelPush    = "push"
+	ChannelWebhook = "webhook"
+)
+
+// ErrNoAddress is returned by a channel when the recipient has nowhere to
+// deliver to (no e-mail, no push subscription); such deliveries are not retried.
+var ErrNoAddress = errors.New("recipient has no address for this channel")
+
+// ErrUnknownKind is returned by Render for a kind without templates.
+var ErrUnknownKind = errors.New("unknown notification kind")
+
+// Message is a rendered notification as handed to channels.
+type Message struct {
+	ID        uint      `json:"id"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Recipient carries the addresses of one user.
+type Recipient struct {
+	UserID     uint
+	Username   string
+	Email      string
+	WebhookURL string
+	Push       []models.PushSubscription
+}
+
+// Channel delivers a message to a recipient.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, to Recipient, m Message) error
+}
+
+// templates holds title and body per kind and language ("id" is the fallback).
+var templates = map[string]map[string][2]string{
+	KindOCRFailed: {
+		"id": {"Struk tidak terbaca", "Nominal pada {{.FileName}} tidak ditemukan{{if .Reason}}: {{.Reason}}{{end}}. Silakan unggah ulang dengan foto yang lebih jelas."},
+		"en": {"Receipt could not be read", "No amount was found on {{.FileName}}{{if .Reason}}: {{.Reason}}{{end}}. Please upload a clearer photo."},
+	},
+	KindWeeklySummary: {
+		"id": {"Ringkasan mingguan {{.From}} – {{.To}}", "Total {{money .Currency .Total}} dari {{.Count}} catatan.{{if .Top}} Kategori terbanyak: {{.Top}}.{{end}}{{if .Failed}} {{.Failed}} unggahan gagal perlu diperiksa.{{end}}"},
+		"en": {"Weekly summary {{.From}} – {{.To}}", "Total {{money .Currency .Total}} across {{.Count}} catatan.{{if .Top}} Top categories: {{.Top}}.{{end}}{{if .Failed}} {{.Failed}} failed uploads need attention.{{end}}"},
+	},
+	KindBudgetExceeded: {
+		"id": {"Anggaran {{.Budget}} terlampaui", "Pengeluaran {{money .Currency .Spent}} melebihi batas {{money .Currency .Limit}}."},
+		"en": {"Budget {{.Budget}} exceeded", "Spending of {{money .Currency .Spent}} is over the {{money .Currency .Limit}} limit."},
+	},
+	KindOrgQuota: {
+		"id": {"Kuota {{.Org}} hampir habis", "Pemakaian {{if eq .Resource \"storage\"}}penyimpanan{{else}}OCR bulan ini{{end}} {{.Org}} sudah {{.Percent}}% ({{.Used}} dari {{.Limit}}{{if eq .Resource \"storage\"}} byte{{end}})."},
+		"en": {"{{.Org}} is nearing its quota", "{{.Org}} has used {{.Percent}}% of its {{if eq .Resource \"storage\"}}storage{{else}}OCR jobs this month{{end}} ({{.Used}} of {{.Limit}}{{if eq .Resource \"storage\"}} bytes{{end}})."},
+	},
+	KindPeriodLocked: {
+		"id": {"Struk masuk periode yang sudah ditutup", "{{.FileName}} bertanggal di periode {{.Period}} yang sudah ditutup, jadi belum dicatat. Minta admin membuka kembali periode itu, lalu proses ulang unggahan ini."},
+		"en": {"Receipt falls in a closed period", "{{.FileName}} is dated in {{.Period}}, which is closed, so it was not recorded. Ask an administrator to reopen the period, then process the upload again."},
+	},
+	KindOrgInvite: {
+		"id": {"Undangan bergabung dengan {{.Org}}", "{{.Inviter}} mengundang Anda bergabung dengan {{.Org}} sebagai {{.Role}}.\n\n{{if .URL}}Terima undangan: {{.URL}}{{else}}Kode undangan: {{.Token}}{{end}}\n\nUndangan berlaku sampai {{.Expires}}."},
+		"en": {"Invitation to join {{.Org}}", "{{.Inviter}} invited you to join {{.Org}} as {{.Role}}.\n\n{{if .URL}}Accept the invitation: {{.URL}}{{else}}Invite code: {{.Token}}{{end}}\n\nThe invitation is valid until {{.Expires}}."},
+	},
+}
+
+var funcs = template.FuncMap{"money": formatMoney}
+
+// formatMoney renders 1250000 as "IDR 1.250.000".
+func formatMoney(currency string, v int64) string {
+	s := strconv.FormatInt(v, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	out := b.String()
+	if neg {
+		out = "-" + out
+	}
+	if currency == "" {
+		return out
+	}
+	return currency + " " + out
+}
+
+// Render fills the templates of kind in lang with data (a struct or map).
+func Render(kind, lang string, data any) (title, body string, err error) {
+	byLang, ok := templates[kind]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	tpl, ok := byLang[lang]
+	if !ok {
+		tpl = byLang["id"]
+	}
+	out := [2]string{}
+	for i, src := range tpl {
+		t, err := template.New(kind).Funcs(funcs).Option("missingkey=zero").Parse(src)
+		if err != nil {
+			return "", "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", "", err
+		}
+		out[i] = buf.String()
+	}
+	return out[0], out[1], nil
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestRender(t *testing.T) {
+	title, body, err := Render(KindWeeklySummary, "en", map[string]any{"From": "2025-08-04", "To": "2025-08-10", "Total": int64(1250000), "Count": 7, "Currency": "IDR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Weekly summary 2025-08-04 – 2025-08-10" || body != "Total IDR 1.250.000 across 7 catatan." {
+		t.Fatalf("got %q / %q", title, body)
+	}
+	// unknown languages fall back to Indonesian
+	if title, _, _ = Render(KindOCRFailed, "fr", map[string]any{"FileName": "a.jpg"}); title != "Struk tidak terbaca" {
+		t.Fatalf("fallback title %q", title)
+	}
+	if _, _, err := Render("nope", "id", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Fatalf("expected ErrUnknownKind, got %v", err)
+	}
+}
+
+type fakeChannel struct {
+	fail int // fail this many calls first
+	sent []Message
+}
+
+func (f *fakeChannel) Name() string { return ChannelWebhook }
+
+func (f *fakeChannel) Send(_ context.Context, _ Recipient, m Message) error {
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "u1", Password: "secret1"}}})
+	var u models.User
+	gdb.Where("username = ?", "u1").First(&u)
+	gdb.Create(&models.Preferences{UserID: u.ID, Currency: "IDR", Timezone: "UTC", Language: "en",
+		NotifyWebhook: true, WebhookURL: "http://example.invalid/hook", NotifyEmail: true})
+
+	n, err := Notify(gdb, u.ID, KindOCRFailed, map[string]any{"FileName": "x.jpg"})
+	if err != nil || n.ID == 0 || !strings.Contains(n.Body, "x.jpg") {
+		t.Fatalf("notify: %+v %v", n, err)
+	}
+
+	now := time.Now()
+	ch := &fakeChannel{fail: 1}
+	d := &Dispatcher{DB: gdb, Channels: map[string]Channel{ChannelWebhook: ch}, Now: func() time.Time { return now }}
+	sent, failed, err := d.RunOnce(context.Background())
+	// webhook fails once and is rescheduled; email has no channel and gives up
+	if err != nil || sent != 0 || failed != 1 {
+		t.Fatalf("first run: sent=%d failed=%d err=%v", sent, failed, err)
+	}
+	if sent, _, _ = d.RunOnce(context.Background()); sent != 0 {
+		t.Fatal("retried before the backoff elapsed")
+	}
+	now = now.Add(Backoff(1))
+	if sent, _, _ = d.RunOnce(context.Background()); sent != 1 || len(ch.sent) != 1 || ch.sent[0].ID != n.ID {
+		t.Fatalf("retry: sent=%d %+v", sent, ch.sent)
+	}
+	var del models.NotificationDelivery
+	gdb.Where("channel = ?", ChannelWebhook).First(&del)
+	if del.Status != models.DeliverySent || del.Attempts != 2 {
+		t.Fatalf("delivery: %+v", del)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if Backoff(1) != time.Minute || Backoff(3) != 16*time.Minute || Backoff(20) != 6*time.Hour {
+		t.Fatalf("unexpected backoff: %v %v %v", Backoff(1), Backoff(3), Backoff(20))
+	}
+}
+
+// TestEncryptRoundTrip decrypts as a browser would (RFC 8291).
+func TestEncryptRoundTrip(t *testing.T) {
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	secret := make([]byte, 16)
+	_, _ = rand.Read(secret)
+	enc := base64.RawURLEncoding.EncodeToString
+	body, err := encrypt(enc(ua.PublicKey().Bytes()), enc(secret), []byte("halo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, keyID, ct := body[:16], body[21:21+int(body[20])], body[21+int(body[20]):]
+	as, err := ecdh.P256().NewPublicKey(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, _ := ua.ECDH(as)
+	info := append(append([]byte("WebPush: info\x00"), ua.PublicKey().Bytes()...), keyID...)
+	ikm, _ := expand(hkdf.New(sha256.New, shared, secret, info), 32)
+	cek, _ := expand(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), 16)
+	nonce, _ := expand(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, ct, nil)
+	if err != nil || string(plain) != "halo\x02" {
+		t.Fatalf("decrypt: %q %v", plain, err)
+	}
+}
+
+// TestWebPushInternalEndpoint: endpoints stored before they were validated are
+// still never dialled when internal.
+func TestWebPushInternalEndpoint(t *testing.T) {
+	vapid, _ := ecdh.P256().GenerateKey(rand.Reader)
+	wp, err := NewWebPush(base64.RawURLEncoding.EncodeToString(vapid.Bytes()), "mailto:ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	enc := base64.RawURLEncoding.EncodeToString
+	to := Recipient{Push: []models.PushSubscription{{Endpoint: "https://169.254.169.254/latest", P256dh: enc(ua.PublicKey().Bytes()), Auth: enc(make([]byte, 16))}}}
+	if err := wp.Send(context.Background(), to, Message{Title: "x"}); !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("internal endpoint: %v", err)
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, ok := range []string{"https://hooks.example.com/keu", "https://203.0.113.9:8443/hook", "https://[2001:db8::1]/hook"} {
+		if err := CheckWebhookURL(ok); err != nil {
+			t.Errorf("%s rejected: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{
+		"http://hooks.example.com/keu", "ftp://hooks.example.com", "https://", "https://user:pw@hooks.example.com",
+		"https://localhost/hook", "https://api.localhost./hook", "https://127.0.0.1/hook", "https://[::1]/hook",
+		"https://169.254.169.254/latest/meta-data", "https://10.0.0.5/hook", "https://192.168.1.1/hook",
+		"https://172.16.0.1/hook", "https://100.64.0.1/hook", "https://0.0.0.0/hook", "https://[fd00::1]/hook",
+		"https://[fe80::1]/hook", "https://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := CheckWebhookURL(bad); !errors.Is(err, ErrWebhookURL) {
+			t.Errorf("%s accepted: %v", bad, err)
+		}
+	}
+}
+
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	// names are only resolved when dialled; the dialer checks what they resolve to
+	for _, addr := range []string{"127.0.0.1:443", "10.1.2.3:443", "169.254.169.254:80", "[::1]:443"} {
+		if err := dialPublic("tcp", addr, nil); !errors.Is(err, ErrWebhookURL) {
+			t.Errorf("dial %s allowed: %v", addr, err)
+		}
+	}
+	if err := dialPublic("tcp", "203.0.113.9:443", nil); err != nil {
+		t.Errorf("dial of a public address refused: %v", err)
+	}
+	err := (&Webhook{}).Send(context.Background(), Recipient{WebhookURL: "https://127.0.0.1:1/hook"}, Message{})
+	if !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("send to loopback: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxAttempts is how often a delivery is tried before it is marked failed.
+const MaxAttempts = 5
+
+// Backoff returns the wait after the given failed attempt (1m, 4m, 16m, ...),
+// capped at six hours.
+func Backoff(attempt int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempt && d < 6*time.Hour; i++ {
+		d *= 4
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+// Notify renders kind with data (a map) in the user's language, stores it as an
+// in-app notification and queues a delivery for every channel the user opted
+// into in their preferences.
+func Notify(gdb *gorm.DB, userID uint, kind string, data map[string]any) (models.Notification, error) {
+	prefs := models.DefaultPreferences(userID)
+	gdb.Where("user_id = ?", userID).First(&prefs)
+	if _, ok := data["Currency"]; !ok && data != nil {
+		data["Currency"] = prefs.Currency
+	}
+	n := models.Notification{UserID: userID, Kind: kind}
+	var err error
+	if n.Title, n.Body, err = Render(kind, prefs.Language, data); err != nil {
+		return n, err
+	}
+	err = gdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&n).Error; err != nil {
+			return err
+		}
+		for _, ch := range optedIn(prefs) {
+			d := models.NotificationDelivery{NotificationID: n.ID, UserID: userID, Channel: ch,
+				Status: models.DeliveryPending, NextAttemptAt: time.Now()}
+			if err := tx.Create(&d).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Reachable returns the channels the user opted into that also have a
+// destination: an email on their profile, a push subscription or a webhook URL.
+// Whether the server itself has the channel configured is not checked.
+func Reachable(gdb *gorm.DB, userID uint) ([]string, error) {
+	prefs := models.DefaultPreferences(userID)
+	if err := gdb.Where("user_id = ?", userID).Limit(1).Find(&prefs).Error; err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, ch := range optedIn(prefs) {
+		var n int64
+		switch ch {
+		case ChannelEmail:
+			if err := gdb.Model(&models.Profile{}).Where("user_id = ? AND email <> ?", userID, "").Count(&n).Error; err != nil {
+				return nil, err
+			}
+		case ChannelPush:
+			if err := gdb.Model(&models.PushSubscription{}).Where("user_id = ?", userID).Count(&n).Error; err != nil {
+				return nil, err
+			}
+		default:
+			n = 1 // optedIn only lists a webhook with its URL
+		}
+		if n > 0 {
+			out = append(out, ch)
+		}
+	}
+	return out, nil
+}
+
+func optedIn(p models.Preferences) []string {
+	var out []string
+	if p.NotifyEmail {
+		out = append(out, ChannelEmail)
+	}
+	if p.NotifyPush {
+		out = append(out, ChannelPush)
+	}
+	if p.NotifyWebhook && p.WebhookURL != "" {
+		out = append(out, ChannelWebhook)
+	}
+	return out
+}
+
+// Dispatcher sends queued deliveries through the configured channels.
+type Dispatcher struct {
+	DB       *gorm.DB
+	Channels map[string]Channel
+	// Now is the clock, for tests; nil means time.Now.
+	Now func() time.Time
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+// Recipient loads the addresses of userID.
+func (d *Dispatcher) Recipient(userID uint) Recipient {
+	r := Recipient{UserID: userID}
+	var user models.User
+	if d.DB.First(&user, userID).Error == nil {
+		r.Username = user.Username
+	}
+	var profile models.Profile
+	if d.DB.Where("user_id = ?", userID).First(&profile).Error == nil {
+		r.Email = profile.Email
+	}
+	var prefs models.Preferences
+	if d.DB.Where("user_id = ?", userID).First(&prefs).Error == nil {
+		r.WebhookURL = prefs.WebhookURL
+	}
+	d.DB.Where("user_id = ?", userID).Order("id").Find(&r.Push)
+	return r
+}
+
+// RunOnce attempts up to 100 due deliveries and returns how many were sent
+// and how many gave up for good.
+func (d *Dispatcher) RunOnce(ctx context.Context) (sent, failed int, err error) {
+	var due []models.NotificationDelivery
+	err = d.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, d.now()).
+		Order("next_attempt_at").Limit(100).Find(&due).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, del := range due {
+		if ctx.Err() != nil {
+			return sent, failed, ctx.Err()
+		}
+		switch d.attempt(ctx, &del) {
+		case models.DeliverySent:
+			sent++
+		case models.DeliveryFailed:
+			failed++
+		}
+		if err := d.DB.Save(&del).Error; err != nil {
+			return sent, failed, err
+		}
+	}
+	return sent, failed, nil
+}
+
+// attempt sends one delivery and updates its status, returning the new status.
+func (d *Dispatcher) attempt(ctx context.Context, del *models.NotificationDelivery) string {
+	del.Attempts++
+	ch, ok := d.Channels[del.Channel]
+	var n models.Notification
+	var err error
+	switch {
+	case !ok:
+		err = errors.New("channel not configured on this server")
+	case d.DB.First(&n, del.NotificationID).Error != nil:
+		err = errors.New("notification no longer exists")
+	default:
+		m := Message{ID: n.ID, Kind: n.Kind, Title: n.Title, Body: n.Body, CreatedAt: n.CreatedAt}
+		err = ch.Send(ctx, d.Recipient(del.UserID), m)
+	}
+	if err == nil {
+		now := d.now()
+		del.Status, del.SentAt, del.LastError = models.DeliverySent, &now, ""
+		return del.Status
+	}
+	del.LastError = err.Error()
+	if len(del.LastError) > 512 {
+		del.LastError = del.LastError[:512]
+	}
+	// misconfiguration does not heal by retrying
+	if !ok || errors.Is(err, ErrNoAddress) || del.Attempts >= MaxAttempts {
+		del.Status = models.DeliveryFailed
+		log.Printf("notify: delivery %d (%s) to user=%d failed: %v", del.ID, del.Channel, del.UserID, err)
+		return del.Status
+	}
+	del.NextAttemptAt = d.now().Add(Backoff(del.Attempts))
+	return del.Status
+}
+
+// Run calls RunOnce every interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("notify: dispatch: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
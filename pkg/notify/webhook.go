@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrWebhookURL wraps the reasons CheckWebhookURL rejects a URL.
+var ErrWebhookURL = errors.New("webhook_url must be an https URL on a public host")
+
+// CheckWebhookURL reports whether raw may receive webhooks: https, and a host
+// that is neither localhost nor a loopback, private, link-local or otherwise
+// non-public IP. Names resolving to such addresses are refused when dialled.
+func CheckWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrWebhookURL
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrWebhookURL, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !publicAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookURL, host)
+	}
+	return nil
+}
+
+// nonPublic are IPv4 ranges netip does not count as private but that are no
+// public host either: "this network" and carrier-grade NAT (RFC 6598).
+var nonPublic = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/8"), netip.MustParsePrefix("100.64.0.0/10")}
+
+// publicAddr reports whether ip is a globally routable unicast address.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublic refuses connections to non-public addresses. It runs after name
+// resolution, for every address tried, so a host that resolves (or rebinds)
+// to an internal address is refused too.
+func dialPublic(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(ip) {
+		return fmt.Errorf("%w: refusing to connect to %s", ErrWebhookURL, host)
+	}
+	return nil
+}
+
+// publicClient is the default client of Webhook and WebPush: no proxy, every dial checked
+// by dialPublic, redirects only to https.
+var publicClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublic}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		return CheckWebhookURL(req.URL.String())
+	},
+}
+
+// Webhook POSTs notifications as JSON to the user's webhook_url. With a Secret
+// the body is signed in X-Signature-256 ("sha256=<hex hmac>"). The URL is
+// user-supplied, so only public https hosts are reached (see CheckWebhookURL).
+type Webhook struct {
+	Secret string
+	Client *http.Client // publicClient when nil
+}
+
+// Name implements Channel.
+func (w *Webhook) Name() string { return ChannelWebhook }
+
+// Send implements Channel; any non-2xx answer is an error and is retried. A
+// URL CheckWebhookURL rejects is no address, and not retried.
+func (w *Webhook) Send(ctx context.Context, to Recipient, m Message) error {
+	if to.WebhookURL == "" {
+		return ErrNoAddress
+	}
+	if err := CheckWebhookURL(to.WebhookURL); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoAddress, err)
+	}
+	body, _ := json.Marshal(struct {
+		Message
+		Username string `json:"username"`
+	}{m, to.Username})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := w.Client
+	if client == nil {
+		client = publicClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrGone means the push service no longer knows the subscription.
+var ErrGone = errors.New("push subscription expired")
+
+// WebPush is the browser push channel (RFC 8030) with payload encryption
+// (RFC 8291) and VAPID authentication (RFC 8292). Endpoints are user-supplied,
+// so like webhooks only public https hosts are reached (see CheckWebhookURL).
+type WebPush struct {
+	key     *ecdsa.PrivateKey
+	public  string       // base64url uncompressed point, handed to browsers
+	Subject string       // mailto: or https: contact for the push service
+	Client  *http.Client // publicClient when nil
+	// OnGone is called for subscriptions the push service reports as gone.
+	OnGone func(endpoint string)
+}
+
+// NewWebPush loads a VAPID key pair; privateKey is the base64url raw 32-byte
+// scalar as printed by common VAPID generators.
+func NewWebPush(privateKey, subject string) (*WebPush, error) {
+	d, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	ek, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	pub := ek.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(pub[1:33]), Y: new(big.Int).SetBytes(pub[33:])},
+		D:         new(big.Int).SetBytes(d),
+	}
+	return &WebPush{key: key, public: base64.RawURLEncoding.EncodeToString(pub), Subject: subject}, nil
+}
+
+// PublicKey is the applicationServerKey for PushManager.subscribe.
+func (w *WebPush) PublicKey() string { return w.public }
+
+// Name implements Channel.
+func (w *WebPush) Name() string { return ChannelPush }
+
+// Send implements Channel, pushing to every subscription of the recipient. It
+// succeeds when at least one push service accepted the message.
+func (w *WebPush) Send(ctx context.Context, to Recipient, m Message) error {
+	if len(to.Push) == 0 {
+		return ErrNoAddress
+	}
+	payload, _ := json.Marshal(m)
+	var firstErr error
+	delivered := false
+	for _, s := range to.Push {
+		err := w.push(ctx, s.Endpoint, s.P256dh, s.Auth, payload)
+		switch {
+		case err == nil:
+			delivered = true
+		case errors.Is(err, ErrGone):
+			if w.OnGone != nil {
+				w.OnGone(s.Endpoint)
+			}
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	if delivered {
+		return nil
+	}
+	if firstErr == nil {
+		return ErrNoAddress // every subscription was gone
+	}
+	return firstErr
+}
+
+func (w *WebPush) push(ctx context.Context, endpoint, p256dh, auth string, payload []byte) error {
+	if err := CheckWebhookURL(endpoint); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoAddress, err)
+	}
+	body, err := encrypt(p256dh, auth, payload)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.Subject,
+	}).SignedString(w.key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Authorization", "vapid t="+tok+", k="+w.public)
+	client := w.Client
+	if client == nil {
+		client = publicClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("push service answered %s", resp.Status)
+	}
+	return nil
+}
+
+// encrypt produces a single-record aes128gcm body for the subscription keys.
+func encrypt(p256dh, auth string, plaintext []byte) ([]byte, error) {
+	uaPub, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	secret, err := decodeKey(auth)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	ua, err := ecdh.P256().NewPublicKey(uaPub)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	as, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := as.ECDH(ua)
+	if err != nil {
+		return nil, err
+	}
+	asPub := as.PublicKey().Bytes()
+	info := append(append([]byte("WebPush: info\x00"), uaPub...), asPub...)
+	ikm, err := expand(hkdf.New(sha256.New, shared, secret, info), 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek, err := expand(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// header: salt | record size | key id length | key id (our public key)
+	out := make([]byte, 0, 86+len(plaintext)+17)
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, 4096)
+	out = append(out, byte(len(asPub)))
+	out = append(out, asPub...)
+	// 0x02 pads and marks the last (only) record
+	return gcm.Seal(out, nonce, append(plaintext, 0x02), nil), nil
+}
+
+func expand(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+// decodeKey accepts base64url with or without padding, as browsers vary.
+func decodeKey(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
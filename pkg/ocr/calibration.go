@@ -0,0 +1,175 @@
+package ocr
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Heuristics that choose the amount, recorded in Result.Heuristic.
+const (
+	HeuristicMatch     = "match"      // best currency-like match
+	HeuristicFuzzy     = "fuzzy"      // reconstructed from noisy currency text
+	HeuristicRibu      = "ribu"       // "400 ribu" notation
+	HeuristicZeroBlock = "zero_block" // zero pattern without a currency marker
+	HeuristicQRIS      = "qris"       // read from a QRIS payment code, see DetectQRIS
+)
+
+// MinCalibrationSamples is how many reviewed extractions of a heuristic a
+// Calibration needs before it replaces that heuristic's raw confidence; it is
+// also the weight of the prior each heuristic and confidence bin is smoothed
+// toward, so a handful of reviews cannot swing a probability to 0 or 1.
+const MinCalibrationSamples = 20
+
+// DefaultCalibrationBins splits the raw confidence range [0, 1].
+const DefaultCalibrationBins = 10
+
+// Sample is one reviewed extraction: the heuristic and raw confidence that
+// chose the amount, and whether the user kept it.
+type Sample struct {
+	Heuristic  string  `json:"heuristic"`
+	Confidence float64 `json:"confidence"`
+	Correct    bool    `json:"correct"`
+}
+
+// CalibrationBin is the share of correct amounts among the samples whose raw
+// confidence is in [Lo, Hi).
+type CalibrationBin struct {
+	Lo          float64 `json:"lo"`
+	Hi          float64 `json:"hi"`
+	Samples     int     `json:"samples"`
+	Correct     int     `json:"correct"`
+	Probability float64 `json:"probability"`
+}
+
+// HeuristicCalibration is the precision of one heuristic and its
+// reliability table.
+type HeuristicCalibration struct {
+	Samples   int              `json:"samples"`
+	Correct   int              `json:"correct"`
+	Precision float64          `json:"precision"`
+	Bins      []CalibrationBin `json:"bins"`
+}
+
+// Calibration maps the raw confidence of a heuristic to the probability that
+// the amount is correct, learnt from reviewed extractions (see Fit).
+type Calibration struct {
+	FittedAt   time.Time                        `json:"fitted_at"`
+	Samples    int                              `json:"samples"`
+	Correct    int                              `json:"correct"`
+	Precision  float64                          `json:"precision"`
+	Heuristics map[string]*HeuristicCalibration `json:"heuristics"`
+}
+
+// Fit builds a Calibration from samples with bins confidence bins (0 or
+// less for DefaultCalibrationBins). Each heuristic's precision is smoothed
+// toward the overall precision, and each bin toward its heuristic's.
+func Fit(samples []Sample, bins int) *Calibration {
+	if bins <= 0 {
+		bins = DefaultCalibrationBins
+	}
+	c := &Calibration{FittedAt: time.Now().UTC(), Heuristics: map[string]*HeuristicCalibration{}}
+	for _, s := range samples {
+		h := c.Heuristics[s.Heuristic]
+		if h == nil {
+			h = &HeuristicCalibration{Bins: make([]CalibrationBin, bins)}
+			for i := range h.Bins {
+				h.Bins[i].Lo, h.Bins[i].Hi = float64(i)/float64(bins), float64(i+1)/float64(bins)
+			}
+			c.Heuristics[s.Heuristic] = h
+		}
+		b := &h.Bins[binIndex(s.Confidence, bins)]
+		c.Samples++
+		h.Samples++
+		b.Samples++
+		if s.Correct {
+			c.Correct++
+			h.Correct++
+			b.Correct++
+		}
+	}
+	// Laplace smoothing keeps the overall precision off 0 and 1 as well
+	c.Precision = (float64(c.Correct) + 1) / (float64(c.Samples) + 2)
+	const k = MinCalibrationSamples
+	for _, h := range c.Heuristics {
+		h.Precision = (float64(h.Correct) + k*c.Precision) / (float64(h.Samples) + k)
+		for i := range h.Bins {
+			b := &h.Bins[i]
+			b.Probability = (float64(b.Correct) + k*h.Precision) / (float64(b.Samples) + k)
+		}
+	}
+	return c
+}
+
+func binIndex(conf float64, bins int) int {
+	i := int(conf * float64(bins))
+	return min(max(i, 0), bins-1)
+}
+
+// Probability returns the calibrated probability that an amount chosen by
+// heuristic with raw confidence conf is correct. ok is false, the raw
+// confidence standing, while c has fewer than MinCalibrationSamples reviews
+// of the heuristic.
+func (c *Calibration) Probability(heuristic string, conf float64) (p float64, ok bool) {
+	if c == nil {
+		return 0, false
+	}
+	h := c.Heuristics[heuristic]
+	if h == nil || h.Samples < MinCalibrationSamples || len(h.Bins) == 0 {
+		return 0, false
+	}
+	return h.Bins[binIndex(conf, len(h.Bins))].Probability, true
+}
+
+// HeuristicNames returns the heuristics of c, sorted.
+func (c *Calibration) HeuristicNames() []string {
+	names := make([]string, 0, len(c.Heuristics))
+	for n := range c.Heuristics {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Calibrated returns the heuristics Probability calibrates, sorted.
+func (c *Calibration) Calibrated() []string {
+	var names []string
+	for _, n := range c.HeuristicNames() {
+		if c.Heuristics[n].Samples >= MinCalibrationSamples {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// Brier returns the mean squared error of the raw confidence and of the
+// calibrated probability over samples (lower is better), to judge a fit
+// against held-back reviews.
+func (c *Calibration) Brier(samples []Sample) (raw, calibrated float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	for _, s := range samples {
+		want := 0.0
+		if s.Correct {
+			want = 1
+		}
+		p, ok := c.Probability(s.Heuristic, s.Confidence)
+		if !ok {
+			p = s.Confidence
+		}
+		raw += (s.Confidence - want) * (s.Confidence - want)
+		calibrated += (p - want) * (p - want)
+	}
+	n := float64(len(samples))
+	return raw / n, calibrated / n
+}
+
+var calibration atomic.Pointer[Calibration]
+
+// SetCalibration installs c for every later extraction; nil goes back to the
+// raw confidence.
+func SetCalibration(c *Calibration) { calibration.Store(c) }
+
+// CurrentCalibration returns the installed Calibration, or nil.
+func CurrentCalibration() *Calibration { return calibration.Load() }
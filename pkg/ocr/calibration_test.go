@@ -0,0 +1,64 @@
+package ocr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitCalibration(t *testing.T) {
+	var samples []Sample
+	// high raw confidence matches are nearly always kept, zero-block
+	// inferences mostly corrected
+	for i := 0; i < 100; i++ {
+		samples = append(samples, Sample{Heuristic: HeuristicMatch, Confidence: 0.9, Correct: i < 95})
+	}
+	for i := 0; i < 40; i++ {
+		samples = append(samples, Sample{Heuristic: HeuristicZeroBlock, Confidence: 0.35, Correct: i < 8})
+	}
+	c := Fit(samples, 0)
+	if c.Samples != 140 || c.Correct != 103 {
+		t.Fatalf("samples %d correct %d", c.Samples, c.Correct)
+	}
+	if names := c.HeuristicNames(); len(names) != 2 || names[0] != HeuristicMatch {
+		t.Fatalf("heuristics %v", names)
+	}
+	hi, ok := c.Probability(HeuristicMatch, 0.92)
+	if !ok || hi < 0.85 || hi > 0.95 {
+		t.Fatalf("match probability %v %v", hi, ok)
+	}
+	lo, _ := c.Probability(HeuristicZeroBlock, 0.35)
+	if lo > 0.4 || lo < 0.2 {
+		t.Fatalf("zero_block probability %v", lo)
+	}
+	// an empty bin falls back to its heuristic's precision
+	if p, _ := c.Probability(HeuristicMatch, 0.1); math.Abs(p-c.Heuristics[HeuristicMatch].Precision) > 1e-9 {
+		t.Fatalf("empty bin %v", p)
+	}
+	if _, ok := c.Probability(HeuristicRibu, 0.5); ok {
+		t.Fatal("unseen heuristic calibrated")
+	}
+	raw, cal := c.Brier(samples)
+	if cal >= raw {
+		t.Fatalf("brier raw %v calibrated %v", raw, cal)
+	}
+	if _, ok := Fit(samples[:MinCalibrationSamples-1], 0).Probability(HeuristicMatch, 0.9); ok {
+		t.Fatal("calibrated below MinCalibrationSamples")
+	}
+}
+
+func TestFinishUsesCalibration(t *testing.T) {
+	defer SetCalibration(nil)
+	var samples []Sample
+	for i := 0; i < 50; i++ {
+		samples = append(samples, Sample{Heuristic: HeuristicMatch, Confidence: 0.85, Correct: i < 10})
+	}
+	r := (&Result{}).finish(15000, 0.85, "Rp 15.000", HeuristicMatch)
+	if r.Confidence != 0.85 || r.NeedsConfirmation {
+		t.Fatalf("uncalibrated %+v", r)
+	}
+	SetCalibration(Fit(samples, 0))
+	r = (&Result{}).finish(15000, 0.85, "Rp 15.000", HeuristicMatch)
+	if r.RawConfidence != 0.85 || r.Confidence >= LowConfidenceThreshold || !r.NeedsConfirmation || r.Heuristic != HeuristicMatch {
+		t.Fatalf("calibrated %+v", r)
+	}
+}
@@ -0,0 +1,121 @@
+package ocr
+
+import (
+	"image"
+	"sync/atomic"
+
+	"github.com/otiai10/gosseract/v2"
+)
+
+// Image kinds told apart by Classify, recorded in Result.ImageKind.
+const (
+	KindScreenshot = "screenshot" // rendered by a phone or computer: flat, crisp
+	KindPhoto      = "photo"      // taken with a camera: sensor noise, uneven light
+	KindUnknown    = "unknown"    // neither clearly; every pass runs
+)
+
+// Bounds of the classifier's statistics (see Classification).
+const (
+	screenshotMinFlat  = 0.55
+	screenshotMaxNoise = 1.0
+	photoMaxFlat       = 0.35
+	photoMinNoise      = 2.0
+	// classifySamples is the number of sample points along the longer side.
+	classifySamples = 384
+)
+
+// Classification is the outcome of Classify with the statistics it rests on.
+type Classification struct {
+	Kind string `json:"kind"`
+	// Flat is the share of neighbouring pixel pairs whose luminance differs
+	// by at most 1: most of a screenshot is exactly flat background, while
+	// sensor noise keeps a photo's pixels apart.
+	Flat float64 `json:"flat"`
+	// Noise is the mean luminance difference of the pairs that are no edge
+	// (differing by less than 16): texture where the image should be smooth.
+	Noise float64 `json:"noise"`
+}
+
+// Classify tells screenshots from camera photos by the edge and noise
+// statistics of neighbouring pixels, sampled on a grid so it costs a few
+// milliseconds whatever the image size.
+func Classify(img image.Image) Classification {
+	b := img.Bounds()
+	step := max(1, max(b.Dx(), b.Dy())/classifySamples)
+	var pairs, flat, smooth, noise int
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x+1 < b.Max.X; x += step {
+			d := luminance(img, x, y) - luminance(img, x+1, y)
+			if d < 0 {
+				d = -d
+			}
+			pairs++
+			if d <= 1 {
+				flat++
+			}
+			if d < 16 {
+				smooth++
+				noise += d
+			}
+		}
+	}
+	c := Classification{Kind: KindUnknown}
+	if pairs == 0 {
+		return c
+	}
+	c.Flat = float64(flat) / float64(pairs)
+	if smooth > 0 {
+		c.Noise = float64(noise) / float64(smooth)
+	}
+	switch {
+	case c.Flat >= screenshotMinFlat && c.Noise < screenshotMaxNoise:
+		c.Kind = KindScreenshot
+	case c.Flat < photoMaxFlat || c.Noise >= photoMinNoise:
+		c.Kind = KindPhoto
+	}
+	return c
+}
+
+// luminance is the 8-bit Rec. 601 luma of the pixel at (x, y).
+func luminance(img image.Image, x, y int) int {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return int((299*r + 587*g + 114*b) / 1000 >> 8)
+}
+
+// passPlan selects the optional passes of runAllOCRPasses; the base, digit,
+// original-image and top-half passes always run.
+type passPlan struct {
+	inverted bool // light text on dark, as in dark-mode apps
+	adaptive bool // adaptive threshold, for uneven lighting
+	slices   bool // vertical slices, for skewed or wide layouts
+	psm      []gosseract.PageSegMode
+}
+
+var allPSM = []gosseract.PageSegMode{gosseract.PSM_SINGLE_BLOCK, gosseract.PSM_SINGLE_LINE, gosseract.PSM_SPARSE_TEXT, gosseract.PSM_SPARSE_TEXT_OSD}
+
+// planFor returns the passes worth running on an image of kind: screenshots
+// skip the passes that fight noise and skew, photos the inverted pass meant
+// for dark-mode screens. Unknown images get every pass.
+func planFor(kind string) passPlan {
+	switch kind {
+	case KindScreenshot:
+		return passPlan{inverted: true, psm: []gosseract.PageSegMode{gosseract.PSM_SINGLE_BLOCK, gosseract.PSM_SPARSE_TEXT}}
+	case KindPhoto:
+		return passPlan{adaptive: true, slices: true, psm: allPSM}
+	default:
+		return passPlan{inverted: true, adaptive: true, slices: true, psm: allPSM}
+	}
+}
+
+var kindCounters struct{ screenshots, photos, unknown atomic.Int64 }
+
+func countKind(kind string) {
+	switch kind {
+	case KindScreenshot:
+		kindCounters.screenshots.Add(1)
+	case KindPhoto:
+		kindCounters.photos.Add(1)
+	default:
+		kindCounters.unknown.Add(1)
+	}
+}
@@ -0,0 +1,87 @@
+package ocr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// screenshotLike is a payment proof as a phone renders it: a coloured header
+// over flat background with a few lines of text, stored as a JPEG.
+func screenshotLike(t *testing.T) image.Image {
+	t.Helper()
+	img := imaging.New(720, 1280, color.NRGBA{246, 247, 249, 255})
+	img = imaging.Paste(img, imaging.New(720, 160, color.NRGBA{0, 96, 175, 255}), image.Pt(0, 0))
+	text := receiptLike(560, 360, 246, 30)
+	img = imaging.Paste(img, text, image.Pt(80, 420))
+	return jpegRoundTrip(t, img)
+}
+
+// photoLike is receiptLike as a camera takes it: unevenly lit, with sensor
+// noise, stored as a JPEG.
+func photoLike(t *testing.T, w, h int) image.Image {
+	t.Helper()
+	img := receiptLike(w, h, 225, 40)
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.NRGBAAt(x, y)
+			v := float64(c.R) - 30*float64(x+y)/float64(w+h) + rng.NormFloat64()*4
+			l := uint8(max(0, min(255, v)))
+			img.SetNRGBA(x, y, color.NRGBA{l, l, l, 255})
+		}
+	}
+	return jpegRoundTrip(t, img)
+}
+
+func jpegRoundTrip(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestClassify(t *testing.T) {
+	if c := Classify(screenshotLike(t)); c.Kind != KindScreenshot {
+		t.Fatalf("screenshot classified %+v", c)
+	}
+	qr, err := imaging.Open("testdata/qris.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := Classify(qr); c.Kind != KindScreenshot {
+		t.Fatalf("qris.png classified %+v", c)
+	}
+	for _, photo := range []image.Image{photoLike(t, 1200, 1600), imaging.Blur(photoLike(t, 1200, 1600), 1)} {
+		if c := Classify(photo); c.Kind != KindPhoto {
+			t.Fatalf("photo classified %+v", c)
+		}
+	}
+	if c := Classify(image.NewGray(image.Rect(0, 0, 1, 1))); c.Kind != KindUnknown {
+		t.Fatalf("1px image classified %+v", c)
+	}
+}
+
+func TestPlanFor(t *testing.T) {
+	all := planFor(KindUnknown)
+	if !all.inverted || !all.adaptive || !all.slices || len(all.psm) != len(allPSM) {
+		t.Fatalf("unknown kind skips passes: %+v", all)
+	}
+	if p := planFor(KindScreenshot); p.adaptive || p.slices || len(p.psm) >= len(allPSM) {
+		t.Fatalf("screenshot plan runs photo passes: %+v", p)
+	}
+	if p := planFor(KindPhoto); p.inverted || !p.adaptive || !p.slices {
+		t.Fatalf("photo plan: %+v", p)
+	}
+}
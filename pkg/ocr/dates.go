@@ -0,0 +1,79 @@
+package ocr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// monthNames maps Indonesian and English month names/abbreviations to months.
+var monthNames = map[string]time.Month{
+	"jan": time.January, "januari": time.January, "january": time.January,
+	"feb": time.February, "februari": time.February, "february": time.February, "peb": time.February,
+	"mar": time.March, "maret": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"mei": time.May, "may": time.May,
+	"jun": time.June, "juni": time.June, "june": time.June,
+	"jul": time.July, "juli": time.July, "july": time.July,
+	"agu": time.August, "agt": time.August, "ags": time.August, "agustus": time.August, "aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"okt": time.October, "oktober": time.October, "oct": time.October, "october": time.October,
+	"nov": time.November, "nop": time.November, "november": time.November,
+	"des": time.December, "desember": time.December, "dec": time.December, "december": time.December,
+}
+
+var (
+	dateISORE     = regexp.MustCompile(`\b(20\d{2})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	dateNumericRE = regexp.MustCompile(`\b(\d{1,2})[-/.](\d{1,2})[-/.](\d{4}|\d{2})\b`)
+	dateNamedRE   = regexp.MustCompile(`(?i)\b(\d{1,2})\s*[-/ ]?\s*([a-z]{3,9})\.?\s*[-/ ]?\s*(\d{4})\b`)
+)
+
+// DetectDate scans OCR text for a transaction date in the formats commonly printed on
+// Indonesian receipts and transfer proofs (02/08/2025, 2025-08-02, 2 Agu 2025, 02 Agustus 2025).
+// Numeric day/month order is assumed to be day-first. Dates outside a plausible window
+// (year 2000 up to tomorrow) are ignored.
+func DetectDate(text string) (time.Time, bool) {
+	now := time.Now()
+	valid := func(y, m, d int) (time.Time, bool) {
+		if m < 1 || m > 12 || d < 1 || d > 31 || y < 2000 {
+			return time.Time{}, false
+		}
+		t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.Local)
+		if t.Day() != d || t.After(now.AddDate(0, 0, 1)) {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	for _, m := range dateNamedRE.FindAllStringSubmatch(text, -1) {
+		mon, ok := monthNames[strings.ToLower(m[2])]
+		if !ok {
+			continue
+		}
+		d, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[3])
+		if t, ok := valid(y, int(mon), d); ok {
+			return t, true
+		}
+	}
+	for _, m := range dateISORE.FindAllStringSubmatch(text, -1) {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if t, ok := valid(y, mo, d); ok {
+			return t, true
+		}
+	}
+	for _, m := range dateNumericRE.FindAllStringSubmatch(text, -1) {
+		d, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		y, _ := strconv.Atoi(m[3])
+		if len(m[3]) == 2 {
+			y += 2000
+		}
+		if t, ok := valid(y, mo, d); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,37 @@
+package ocr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectDate(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"Transfer Berhasil 02/08/2025 14:05 Rp600.000", "2025-08-02"},
+		{"tanggal 2025-07-31 total", "2025-07-31"},
+		{"12 Agu 2025 jumlah Rp 50.000", "2025-08-12"},
+		{"Kamis, 3 Oktober 2024", "2024-10-03"},
+		{"ref 15-01-24", "2024-01-15"},
+	}
+	for _, c := range cases {
+		got, ok := DetectDate(c.text)
+		if !ok {
+			t.Fatalf("no date detected in %q", c.text)
+		}
+		if got.Format("2006-01-02") != c.want {
+			t.Fatalf("text %q: expected %s got %s", c.text, c.want, got.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestDetectDateRejectsImplausible(t *testing.T) {
+	future := time.Now().AddDate(1, 0, 0).Format("02/01/2006")
+	for _, text := range []string{"Rp600.000", "31/02/2025", "99/99/2025", future, "01/01/1999"} {
+		if got, ok := DetectDate(text); ok {
+			t.Fatalf("expected no date for %q, got %s", text, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package ocr
+
+// Engine is the OCR surface used by the API and the watcher. Production code uses
+// TesseractEngine; tests inject a scripted fake (see pkg/ocr/ocrtest) so the
+// upload → watcher → catatan flow runs without tesseract.
+type Engine interface {
+	// Extract returns the best amount plus confidence, date and warnings.
+	Extract(path string) (*Result, error)
+	// FindAllMatches returns every amount-like string found in the image and
+	// whether the image looks like it carries no amount at all (logo, photo).
+	FindAllMatches(path string) (matches []string, likelyNonAmount bool, err error)
+	// Regions returns the text lines found in the image with their boxes.
+	Regions(path string) ([]Region, error)
+	// QRIS returns the QRIS payment code in the image, nil when there is none.
+	QRIS(path string) (*QRIS, error)
+}
+
+// TesseractEngine runs the package's tesseract-based pipeline, configured by
+// Options when set, else by the installed Options.
+type TesseractEngine struct {
+	Options *Options
+}
+
+func (e TesseractEngine) Extract(path string) (*Result, error) {
+	if e.Options != nil {
+		return ExtractWith(path, *e.Options)
+	}
+	return Extract(path)
+}
+
+func (e TesseractEngine) FindAllMatches(path string) ([]string, bool, error) {
+	if e.Options != nil {
+		return findAllMatchesWith(path, *e.Options)
+	}
+	return FindAllMatches(path)
+}
+
+func (TesseractEngine) Regions(path string) ([]Region, error) { return Regions(path) }
+
+func (TesseractEngine) QRIS(path string) (*QRIS, error) { return DetectQRISFile(path) }
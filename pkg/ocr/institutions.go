@@ -0,0 +1,58 @@
+package ocr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// institutionPatterns recognise the bank or e-wallet a transfer proof was issued
+// by. When two match at the same position the earlier entry wins, so specific
+// names come before generic ones (BCA Syariah before BCA).
+var institutionPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+	// notAfter rejects a match preceded by these words ("transfer dana" means
+	// a fund transfer, not the DANA wallet)
+	notAfter *regexp.Regexp
+}{
+	{name: "BCA Syariah", re: regexp.MustCompile(`(?i)\bbca\s*syariah\b`)},
+	{name: "BSI", re: regexp.MustCompile(`(?i)\b(bsi|bank\s+syariah\s+indonesia)\b`)},
+	{name: "BCA", re: regexp.MustCompile(`(?i)\b(bca|klikbca|m-?bca|bank\s+central\s+asia)\b`)},
+	{name: "BRI", re: regexp.MustCompile(`(?i)\b(bri|brimo|bank\s+rakyat\s+indonesia)\b`)},
+	{name: "BNI", re: regexp.MustCompile(`(?i)\b(bni|bank\s+negara\s+indonesia)\b`)},
+	{name: "Mandiri", re: regexp.MustCompile(`(?i)\b(mandiri|livin)\b`)},
+	{name: "CIMB Niaga", re: regexp.MustCompile(`(?i)\bcimb\b`)},
+	{name: "Permata", re: regexp.MustCompile(`(?i)\bpermata\b`)},
+	{name: "Bank Jago", re: regexp.MustCompile(`(?i)\bbank\s+jago\b`)},
+	{name: "SeaBank", re: regexp.MustCompile(`(?i)\bsea\s?bank\b`)},
+	{name: "GoPay", re: regexp.MustCompile(`(?i)\bgo-?pay\b`)},
+	{name: "OVO", re: regexp.MustCompile(`(?i)\bovo\b`)},
+	{name: "DANA", re: regexp.MustCompile(`(?i)\bdana\b`), notAfter: regexp.MustCompile(`(?i)(transfer|kirim|sumber|penarikan|setor|tarik)\s*$`)},
+	{name: "ShopeePay", re: regexp.MustCompile(`(?i)\bshopee\s?pay\b`)},
+	{name: "LinkAja", re: regexp.MustCompile(`(?i)\blink\s?aja\b`)},
+}
+
+// DetectInstitution returns the canonical name of the first bank or e-wallet
+// mentioned in OCR text, or "" when none is recognised.
+func DetectInstitution(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	best, bestAt := "", -1
+	for _, p := range institutionPatterns {
+		var loc []int
+		for _, m := range p.re.FindAllStringIndex(text, -1) {
+			if p.notAfter == nil || !p.notAfter.MatchString(text[:m[0]]) {
+				loc = m
+				break
+			}
+		}
+		if loc == nil {
+			continue
+		}
+		// the issuer's brand is normally printed in the header, before any
+		// counterparty bank in the transfer details
+		if bestAt == -1 || loc[0] < bestAt {
+			best, bestAt = p.name, loc[0]
+		}
+	}
+	return best
+}
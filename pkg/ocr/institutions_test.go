@@ -0,0 +1,22 @@
+package ocr
+
+import "testing"
+
+func TestDetectInstitution(t *testing.T) {
+	cases := map[string]string{
+		"m-BCA Transfer Berhasil Rp 150.000":                "BCA",
+		"BCA Syariah transfer":                              "BCA Syariah",
+		"BRImo Bukti Transfer ke BCA 1234":                  "BRI",
+		"Livin' by Mandiri Transaksi Berhasil":              "Mandiri",
+		"Pembayaran berhasil GoPay Rp 25.000":               "GoPay",
+		"Total Rp 50.000 terima kasih":                      "",
+		"Transfer dana berhasil via DANA":                   "DANA",
+		"Transfer Dana Berhasil Rp 75.000":                  "",
+		"bank syariah indonesia\nbukti transfer Rp 100.000": "BSI",
+	}
+	for text, want := range cases {
+		if got := DetectInstitution(text); got != want {
+			t.Errorf("DetectInstitution(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ocr
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Itemized extraction modes (OCR_ITEMIZED). Line items are experimental:
+// their accuracy varies a lot with the receipt layout, so they are off unless
+// asked for.
+const (
+	ItemizedOff   = "off"   // no line items
+	ItemizedOn    = "on"    // Extract returns line items in Result.Items
+	ItemizedStore = "store" // ... and callers store them with the upload
+)
+
+var itemizedMode atomic.Value
+
+func init() {
+	switch m := strings.ToLower(strings.TrimSpace(os.Getenv("OCR_ITEMIZED"))); m {
+	case ItemizedOn, ItemizedStore:
+		itemizedMode.Store(m)
+	default:
+		itemizedMode.Store(ItemizedOff)
+	}
+}
+
+// ItemizedMode returns the itemized extraction mode.
+func ItemizedMode() string { return itemizedMode.Load().(string) }
+
+// SetItemizedMode overrides OCR_ITEMIZED; unknown modes turn it off.
+func SetItemizedMode(m string) {
+	if m != ItemizedOn && m != ItemizedStore {
+		m = ItemizedOff
+	}
+	itemizedMode.Store(m)
+}
+
+// LineItem is one purchased line of a receipt, in whole currency units.
+type LineItem struct {
+	Name      string `json:"name"`
+	Qty       int    `json:"qty"`
+	UnitPrice int64  `json:"unit_price"`
+	Price     int64  `json:"price"` // line total
+}
+
+const itemMoney = `(?:rp\.?\s*)?(\d{1,3}(?:[.,]\d{3})+(?:[.,]\d{2})?|\d{3,9})`
+
+var (
+	// "2 x Nasi Goreng 50.000"
+	itemQtyFirstRE = regexp.MustCompile(`(?i)^(\d{1,3})\s*x\s+(.+?)\s+` + itemMoney + `$`)
+	// "Aqua 600ml 2 x 3.500 7.000" / "Aqua 600ml 2 3.500 7.000"
+	itemQtyUnitRE = regexp.MustCompile(`(?i)^(.+?)\s+(\d{1,3})\s*x?\s+` + itemMoney + `\s+` + itemMoney + `$`)
+	// "Teh Manis 2x 5.000" (unit price)
+	itemQtyLastRE = regexp.MustCompile(`(?i)^(.+?)\s+(\d{1,3})\s*x\s*` + itemMoney + `$`)
+	// "Es Teh 5.000"
+	itemPlainRE = regexp.MustCompile(`(?i)^(.+?)\s+` + itemMoney + `$`)
+	// the amounts line under a name: "2 x 3.500 7.000" / "2 3.500 7.000"
+	itemAmountsRE = regexp.MustCompile(`(?i)^(\d{1,3})\s*x?\s+` + itemMoney + `\s+` + itemMoney + `$`)
+	// lines that are not purchases (header, charges, payment); the first
+	// total line ends the items
+	itemSkipRE = regexp.MustCompile(`(?i)\b(ppn|pb\s?1|pajak|tax|vat|service|svc|biaya\s+layanan|diskon|discount|potongan|hemat|tunai|cash|kembali(an)?|change|bayar|pembayaran|debit|kredit|credit|kartu|card|dpp|npwp|voucher|poin|point|kasir|cashier|telp?|phone|jl|jalan|no|tgl|tanggal|date|jam|time|struk|receipt|invoice|ref|trx|member)\b`)
+	itemEndRE  = regexp.MustCompile(`(?i)\b(sub\s?total|grand\s?total|total|jumlah)\b`)
+	letterRE   = regexp.MustCompile(`[A-Za-z]{2,}`)
+)
+
+// ParseLineItems reads the purchased lines of a receipt from OCR text with
+// its line breaks kept: a name followed by a price, optionally with a
+// quantity and a unit price, or a name on one line and "qty x unit total" on
+// the next. Parsing stops at the first total line.
+func ParseLineItems(text string) []LineItem {
+	var items []LineItem
+	pending := "" // a name waiting for its amounts line
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if itemEndRE.MatchString(line) {
+			break
+		}
+		if itemSkipRE.MatchString(line) {
+			pending = ""
+			continue
+		}
+		if m := itemAmountsRE.FindStringSubmatch(line); m != nil && pending != "" {
+			if it, ok := lineItem(pending, m[1], m[2], m[3]); ok {
+				items = append(items, it)
+			}
+			pending = ""
+			continue
+		}
+		it, ok := parseItemLine(line)
+		switch {
+		case ok:
+			items = append(items, it)
+			pending = ""
+		case letterRE.MatchString(line):
+			pending = line
+		default:
+			pending = ""
+		}
+	}
+	return items
+}
+
+// parseItemLine parses a line holding a whole item.
+func parseItemLine(line string) (LineItem, bool) {
+	if m := itemQtyFirstRE.FindStringSubmatch(line); m != nil {
+		return lineItem(m[2], m[1], "", m[3])
+	}
+	if m := itemQtyUnitRE.FindStringSubmatch(line); m != nil {
+		return lineItem(m[1], m[2], m[3], m[4])
+	}
+	if m := itemQtyLastRE.FindStringSubmatch(line); m != nil {
+		return lineItem(m[1], m[2], m[3], "")
+	}
+	if m := itemPlainRE.FindStringSubmatch(line); m != nil {
+		return lineItem(m[1], "1", "", m[2])
+	}
+	return LineItem{}, false
+}
+
+// lineItem builds an item from its matched parts; unit or total may be
+// empty and is then derived from the other. A unit price that does not
+// multiply out to the total rejects the line.
+func lineItem(name, qty, unit, total string) (LineItem, bool) {
+	name = strings.Trim(name, " .:-")
+	if !letterRE.MatchString(name) {
+		return LineItem{}, false
+	}
+	it := LineItem{Name: name}
+	it.Qty, _ = strconv.Atoi(qty)
+	if it.Qty <= 0 {
+		return LineItem{}, false
+	}
+	if unit != "" {
+		it.UnitPrice, _ = ParseAmountFromMatch(unit)
+	}
+	if total != "" {
+		it.Price, _ = ParseAmountFromMatch(total)
+	}
+	switch {
+	case it.UnitPrice == 0 && it.Price == 0:
+		return LineItem{}, false
+	case it.UnitPrice == 0:
+		it.UnitPrice = it.Price / int64(it.Qty)
+	case it.Price == 0:
+		it.Price = it.UnitPrice * int64(it.Qty)
+	case it.UnitPrice*int64(it.Qty) != it.Price:
+		return LineItem{}, false
+	}
+	return it, true
+}
@@ -0,0 +1,36 @@
+package ocr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLineItems(t *testing.T) {
+	text := `INDOMARET
+Jl. Sudirman No 123
+Kasir: Budi 0012345
+2 x Nasi Goreng 50.000
+Aqua 600ml 2 3.500 7.000
+Teh Manis 2x 5.000
+Roti Tawar
+1 x 15.500 15.500
+Kerupuk 3 x 2.000 7.000
+Diskon Member 2.000
+SUBTOTAL 87.500
+Es Teh 5.000
+`
+	want := []LineItem{
+		{Name: "Nasi Goreng", Qty: 2, UnitPrice: 25000, Price: 50000},
+		{Name: "Aqua 600ml", Qty: 2, UnitPrice: 3500, Price: 7000},
+		{Name: "Teh Manis", Qty: 2, UnitPrice: 5000, Price: 10000},
+		{Name: "Roti Tawar", Qty: 1, UnitPrice: 15500, Price: 15500},
+	}
+	// "Kerupuk" does not multiply out and is dropped; nothing after the
+	// subtotal is an item
+	if got := ParseLineItems(text); !reflect.DeepEqual(got, want) {
+		t.Fatalf("items =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := ParseLineItems("Total Rp 50.000"); got != nil {
+		t.Fatalf("items of a total-only receipt: %+v", got)
+	}
+}
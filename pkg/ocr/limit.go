@@ -0,0 +1,123 @@
+package ocr
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultMaxMegapixels bounds the image the OCR passes work on unless
+// OCR_MAX_MEGAPIXELS says otherwise. Receipts read as well at 8 MP as at the
+// 12-50 MP of phone cameras, and every pass holds copies of the image.
+const DefaultMaxMegapixels = 8.0
+
+var maxPixels atomic.Int64
+
+func init() {
+	mp, _ := strconv.ParseFloat(strings.TrimSpace(os.Getenv("OCR_MAX_MEGAPIXELS")), 64)
+	SetMaxMegapixels(mp)
+}
+
+// MaxPixels returns the pixel cap of the OCR passes.
+func MaxPixels() int64 { return maxPixels.Load() }
+
+// SetMaxMegapixels overrides OCR_MAX_MEGAPIXELS; 0 or less restores
+// DefaultMaxMegapixels.
+func SetMaxMegapixels(mp float64) {
+	if mp <= 0 {
+		mp = DefaultMaxMegapixels
+	}
+	maxPixels.Store(int64(mp * 1e6))
+}
+
+var pixelCounters struct {
+	images, capped, in, out, peak atomic.Int64
+}
+
+// PixelStats counts the images decoded for OCR since the process started.
+type PixelStats struct {
+	Images int64 `json:"images"`
+	Capped int64 `json:"capped"` // scaled down to MaxPixels
+	// PixelsIn is the decoded size, Pixels what the passes worked on (both
+	// summed); PeakPixels the largest single image after the cap.
+	PixelsIn   int64 `json:"pixels_in"`
+	Pixels     int64 `json:"pixels"`
+	PeakPixels int64 `json:"peak_pixels"`
+	// Screenshots, Photos and Unclassified count the extractions by the kind
+	// Classify found, which selected their passes.
+	Screenshots  int64 `json:"screenshots"`
+	Photos       int64 `json:"photos"`
+	Unclassified int64 `json:"unclassified"`
+}
+
+// Stats returns the pixel totals so far.
+func Stats() PixelStats {
+	return PixelStats{
+		Images: pixelCounters.images.Load(), Capped: pixelCounters.capped.Load(),
+		PixelsIn: pixelCounters.in.Load(), Pixels: pixelCounters.out.Load(), PeakPixels: pixelCounters.peak.Load(),
+		Screenshots: kindCounters.screenshots.Load(), Photos: kindCounters.photos.Load(), Unclassified: kindCounters.unknown.Load(),
+	}
+}
+
+// String formats s for a log line.
+func (s PixelStats) String() string {
+	return fmt.Sprintf("images=%d capped=%d megapixels_in=%.1f megapixels=%.1f peak_megapixels=%.1f screenshots=%d photos=%d unclassified=%d",
+		s.Images, s.Capped, float64(s.PixelsIn)/1e6, float64(s.Pixels)/1e6, float64(s.PeakPixels)/1e6, s.Screenshots, s.Photos, s.Unclassified)
+}
+
+// source is an image decoded and capped once, shared by every OCR pass: img
+// for the passes preprocessing in memory, path for those handing Tesseract
+// the file. path is a copy in work when the image was scaled down; name is
+// the original path, for logs. The passes write their intermediate images to
+// work too, and follow opts.
+type source struct {
+	img        image.Image
+	path, name string
+	work       *workDir
+	opts       Options
+}
+
+// openSource decodes path and scales it down to the pixel cap of opts,
+// keeping the aspect ratio, counting the image in Stats.
+func openSource(path string, opts Options) (*source, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	work, err := newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("ocr working directory: %w", err)
+	}
+	src := &source{img: img, path: path, name: path, work: work, opts: opts}
+	b := img.Bounds()
+	in := int64(b.Dx()) * int64(b.Dy())
+	out := in
+	if limit := opts.maxPixels(); in > limit {
+		scale := math.Sqrt(float64(limit) / float64(in))
+		src.img = imaging.Resize(img, max(1, int(float64(b.Dx())*scale)), 0, imaging.Lanczos)
+		out = int64(src.img.Bounds().Dx()) * int64(src.img.Bounds().Dy())
+		pixelCounters.capped.Add(1)
+		// the passes reading the file get the capped image too; should the
+		// copy fail they fall back to the original
+		if p, err := work.file("src-*.png"); err == nil && imaging.Save(src.img, p) == nil {
+			src.path = p
+		}
+	}
+	pixelCounters.images.Add(1)
+	pixelCounters.in.Add(in)
+	pixelCounters.out.Add(out)
+	for p := pixelCounters.peak.Load(); out > p && !pixelCounters.peak.CompareAndSwap(p, out); p = pixelCounters.peak.Load() {
+	}
+	return src, nil
+}
+
+// Close removes the working directory.
+func (s *source) Close() {
+	s.work.Close()
+}
@@ -0,0 +1,63 @@
+package ocr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestOpenSourceCapsPixels(t *testing.T) {
+	defer SetMaxMegapixels(0)
+	SetMaxMegapixels(1)
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.png")
+	if err := imaging.Save(receiptLike(2000, 1500, 235, 20), big); err != nil {
+		t.Fatal(err)
+	}
+	small := filepath.Join(dir, "small.png")
+	if err := imaging.Save(receiptLike(600, 900, 235, 20), small); err != nil {
+		t.Fatal(err)
+	}
+	before := Stats()
+
+	src, err := openSource(big, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := src.img.Bounds()
+	if px := b.Dx() * b.Dy(); px > 1_000_000 || px < 990_000 || b.Dx() != 1154 {
+		t.Fatalf("capped to %dx%d", b.Dx(), b.Dy())
+	}
+	if src.path == big || src.name != big {
+		t.Fatalf("path %q name %q", src.path, src.name)
+	}
+	if f, err := imaging.Open(src.path); err != nil || f.Bounds() != b {
+		t.Fatalf("capped copy: %v %v", err, f)
+	}
+	src.Close()
+	if _, err := os.Stat(src.path); !os.IsNotExist(err) {
+		t.Fatalf("capped copy left behind: %v", err)
+	}
+
+	src, err = openSource(small, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+	if src.path != small || src.img.Bounds().Dx() != 600 {
+		t.Fatalf("small image changed: %q %v", src.path, src.img.Bounds())
+	}
+	if _, err := os.Stat(small); err != nil {
+		t.Fatalf("original removed: %v", err)
+	}
+
+	s := Stats()
+	if s.Images-before.Images != 2 || s.Capped-before.Capped != 1 || s.PixelsIn-before.PixelsIn != 3_000_000+540_000 {
+		t.Fatalf("stats %+v (before %+v)", s, before)
+	}
+	if s.PeakPixels < 540_000 {
+		t.Fatalf("peak %d", s.PeakPixels)
+	}
+}
@@ -22,3 +22,13 @@ func TestErrNoAmount(t *testing.T) {
 		t.Fatalf("expected ErrNoAmount got %v", er)
 	}
 }
+
+func TestFromText(t *testing.T) {
+	res, err := FromText("BANK BCA\nTransfer Berhasil\nJumlah Transfer Rp 45.000\nRef 231012345678")
+	if err != nil || res.Amount != 45000 || res.Text == "" {
+		t.Fatalf("FromText: %+v %v", res, err)
+	}
+	if _, err := FromText("TERIMA KASIH"); err != ErrNoAmount {
+		t.Fatalf("expected ErrNoAmount got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package ocr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NormalizeAmount converts amt, parsed from the OCR match raw, to whole rupiah. It
+// is the single home of the cents heuristic: when raw ends in a two-digit fraction
+// (",00" / ".50") and amt still carries those digits (e.g. "8.500.000,00" read as
+// 850000000), the fraction is dropped. Amounts already in whole units, amounts not
+// derived from raw's digits, and raw strings without a cents suffix are returned
+// unchanged, so the function is idempotent and safe to call on any result.
+func NormalizeAmount(raw string, amt int64) int64 {
+	raw = strings.TrimSpace(raw)
+	if amt <= 0 || !centsSuffixRE.MatchString(raw) {
+		return amt
+	}
+	intDigits := strings.TrimLeft(onlyDigits(raw[:len(raw)-3]), "0")
+	allDigits := strings.TrimLeft(onlyDigits(raw), "0")
+	if intDigits == "" {
+		intDigits = "0"
+	}
+	if strconv.FormatInt(amt, 10) != allDigits {
+		// already whole units (== intDigits) or not derived from raw
+		return amt
+	}
+	whole, err := strconv.ParseInt(intDigits, 10, 64)
+	if err != nil {
+		return amt
+	}
+	return whole
+}
@@ -0,0 +1,53 @@
+package ocr
+
+import "testing"
+
+func TestNormalizeAmount(t *testing.T) {
+	cases := []struct {
+		raw  string
+		amt  int64
+		want int64
+	}{
+		// cents digits still included -> dropped
+		{"Rp 8.500.000,00", 850000000, 8500000},
+		{"1.000,00", 100000, 1000},
+		{"IDR 125,000.00", 12500000, 125000},
+		{"12,50", 1250, 12},
+		{"  Rp 2.500.000,00  ", 250000000, 2500000},
+		// already whole rupiah (ParseAmountFromMatch strips cents) -> unchanged
+		{"Rp 8.500.000,00", 8500000, 8500000},
+		{"1.000,00", 1000, 1000},
+		// thousands grouping is not cents
+		{"Rp 50.000", 50000, 50000},
+		{"Rp 1.500", 1500, 1500},
+		{"600000", 600000, 600000},
+		// amount not derived from raw (e.g. inferred) -> unchanged
+		{"Rp 8.500.000,00", 123456, 123456},
+		// degenerate input
+		{"", 5000, 5000},
+		{",00", 0, 0},
+		{"Rp 0,50", 50, 0},
+	}
+	for _, c := range cases {
+		if got := NormalizeAmount(c.raw, c.amt); got != c.want {
+			t.Errorf("NormalizeAmount(%q, %d) = %d, want %d", c.raw, c.amt, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeAmountIdempotent(t *testing.T) {
+	raws := []string{"Rp 8.500.000,00", "1.000,00", "Rp 50.000", "12,50", "99.99"}
+	for _, raw := range raws {
+		parsed, err := ParseAmountFromMatch(raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", raw, err)
+		}
+		once := NormalizeAmount(raw, parsed)
+		if twice := NormalizeAmount(raw, once); twice != once {
+			t.Errorf("%q: not idempotent: %d then %d", raw, once, twice)
+		}
+		if once != parsed {
+			t.Errorf("%q: parsed amount %d should already be whole units, got %d", raw, parsed, once)
+		}
+	}
+}
@@ -3,31 +3,97 @@ package ocr
 import (
 	"fmt"
 	"log"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"be03/pkg/logredact"
+
 	"github.com/disintegration/imaging"
 	"github.com/otiai10/gosseract/v2"
 )
 
 // ExtractAmountFromImage performs light preprocessing + Tesseract OCR and attempts
 // to extract a transfer/total amount. Returns amount in whole currency units (e.g. 4010000).
-// If no amount is found returns (0,0,nil).
+// If no amount is found returns ErrNoAmount.
 func ExtractAmountFromImage(path string) (int64, float64, string, error) {
-	variants, err := runAllOCRPasses(path)
+	res, err := Extract(path)
 	if err != nil {
-		return 0, 0, "", fmt.Errorf("ocr passes: %w", err)
+		return 0, 0, "", err
 	}
-	matches, _, err := FindAllMatches(path)
+	return res.Amount, res.Confidence, res.Raw, nil
+}
+
+// Extract runs the full extraction pipeline and returns the chosen amount together with
+// the candidates considered, a detected transaction date and any warnings raised by the
+// heuristics. When no amount is found the partial Result (candidates, date) is returned
+// alongside ErrNoAmount so callers can still surface what was seen. A QRIS payment code
+// carrying an amount takes precedence over OCR (see DetectQRIS).
+func Extract(path string) (*Result, error) {
+	return ExtractWith(path, CurrentOptions())
+}
+
+// ExtractWith is Extract with the pipeline configured by opts instead of the
+// installed Options.
+func ExtractWith(path string, opts Options) (*Result, error) {
+	// decoded and capped once for all passes (see openSource)
+	src, err := openSource(path, opts)
 	if err != nil {
-		return 0, 0, "", err
+		return nil, fmt.Errorf("ocr passes: %w", err)
+	}
+	defer src.Close()
+	// a QRIS code carrying the amount settles it without OCR; a static one
+	// still names the merchant
+	qr := DetectQRIS(src.img)
+	if qr != nil && qr.Amount > 0 {
+		return qr.result(opts.Uncalibrated), nil
 	}
+	// screenshots and photos each get the passes suited to them
+	kind := KindUnknown
+	if opts.Passes != PassesAll {
+		kind = Classify(src.img).Kind
+		countKind(kind)
+	}
+	variants := runAllOCRPasses(src, planFor(kind))
+	matches, _, err := findAllMatches(src)
+	if err != nil {
+		return nil, err
+	}
+	return analyze(&Result{QRIS: qr, ImageKind: kind, uncalibrated: opts.Uncalibrated}, variants, matches)
+}
+
+// FromText runs the heuristics of Extract again on OCR text kept from an
+// earlier run (Result.Text, see pkg/ocrtext) instead of reading the image:
+// the kept text is the aggregate of all passes and stands in for each of them.
+// A QRIS amount is not part of the text and is not found this way.
+func FromText(text string) (*Result, error) {
+	variants := map[string]string{}
+	for _, k := range []string{"text", "textDigits", "textOrig", "aggregate", "linesOrig"} {
+		variants[k] = text
+	}
+	matches, _ := matchesInText(text)
+	return analyze(&Result{uncalibrated: CurrentOptions().Uncalibrated}, variants, matches)
+}
+
+// analyze picks the amount and the other details of res from the texts of the
+// OCR passes and the amount-like matches found in them.
+func analyze(res *Result, variants map[string]string, matches []string) (*Result, error) {
 	text := variants["text"]
 	textDigits := variants["textDigits"]
 	textOrig := variants["textOrig"]
 	allText := variants["aggregate"]
+	res.Text = allText
+	if d, ok := DetectDate(textOrig + " " + allText); ok {
+		res.Date = &d
+	}
+	res.Institution = DetectInstitution(textOrig + " " + allText)
+	res.Reference = DetectReference(textOrig + " " + allText)
+	if res.Reference == "" && res.QRIS != nil {
+		res.Reference, _ = validReference(res.QRIS.Reference)
+	}
+	if ItemizedMode() != ItemizedOff {
+		res.Items = ParseLineItems(variants["linesOrig"])
+	}
 
 	// Attempt inference of amount made of a leading digit + zeros (possibly spaced) when Rp context exists.
 	if infAmt, infRaw := inferZeroAmountFromPattern(allText); infAmt > 0 {
@@ -80,35 +146,47 @@ func ExtractAmountFromImage(path string) (int64, float64, string, error) {
 		}
 	}
 
+	res.Candidates = matches
+
 	if len(matches) == 0 {
 		// Before returning, attempt a 'ribu' (thousand) pattern extraction e.g. "400 ribu" or "400ribu".
 		if amt, raw := extractRibu(text); amt > 0 {
-			return amt, 0.5, raw, nil
+			res.addWarning(WarnRibuNotation)
+			return res.finish(amt, 0.5, raw, HeuristicRibu), nil
 		}
 		// New: attempt zero-block inference without explicit Rp when other signals (e.g. many zeros) present.
 		if zAmt, zRaw := inferStandaloneZeroAmount(allText); zAmt > 0 {
-			log.Printf("OCR fallback zero-block inferred %d raw=%s", zAmt, zRaw)
-			return zAmt, 0.35, zRaw, nil
+			log.Printf("OCR fallback zero-block inferred %s raw=%s", logredact.Amount(zAmt), logredact.Text(zRaw))
+			res.addWarning(WarnZeroBlockInferred)
+			return res.finish(zAmt, 0.35, zRaw, HeuristicZeroBlock), nil
 		} else {
-			log.Printf("OCR fallback zero-block inference failed; text snippet=%q", snippet(allText, 140))
+			log.Printf("OCR fallback zero-block inference failed; text snippet=%q", logredact.Text(snippet(allText, 140)))
 		}
-		return 0, 0, "", ErrNoAmount
+		return res, ErrNoAmount
 	}
 	if amt, raw, ok := BestAmountFromMatches(matches); ok {
+		heuristic := HeuristicMatch
 		// Fuzzy reconstruction: attempt to parse an amount near an Rp marker even if OCR mangled digits.
 		if fAmt, fRaw := fuzzyCurrencyAmount(text + " " + textDigits + " " + textOrig); fAmt > 0 {
 			// Prefer fuzzy if original raw lacks currency hints OR fuzzy differs materially.
 			rawLow := strings.ToLower(raw)
 			if !(strings.Contains(rawLow, "rp") || strings.Contains(rawLow, "idr")) || fAmt != amt {
+				if fAmt != amt {
+					res.addWarning(WarnFuzzyReconstructed)
+				}
 				amt = fAmt
 				raw = fRaw
+				heuristic = HeuristicFuzzy
 			}
 		}
 		fAmtLog, fRawLog := fuzzyCurrencyAmount(text + " " + textDigits + " " + textOrig)
 		if fAmtLog > 0 {
-			log.Printf("OCR debug: raw_text_snippet=%q candidates=%v directAdded=%s fuzzy_recon=%d/%s chosen_raw=%s chosen_amt=%d", snippet(text, 160), matches, directCurrency, fAmtLog, fRawLog, raw, amt)
+			log.Printf("OCR debug: raw_text_snippet=%q candidates=%v directAdded=%s fuzzy_recon=%s/%s chosen_raw=%s chosen_amt=%s",
+				logredact.Text(snippet(text, 160)), logredact.Strings(matches), logredact.Text(directCurrency),
+				logredact.Amount(fAmtLog), logredact.Text(fRawLog), logredact.Text(raw), logredact.Amount(amt))
 		} else {
-			log.Printf("OCR debug: raw_text_snippet=%q candidates=%v directAdded=%s fuzzy_recon=none chosen_raw=%s chosen_amt=%d", snippet(text, 160), matches, directCurrency, raw, amt)
+			log.Printf("OCR debug: raw_text_snippet=%q candidates=%v directAdded=%s fuzzy_recon=none chosen_raw=%s chosen_amt=%s",
+				logredact.Text(snippet(text, 160)), logredact.Strings(matches), logredact.Text(directCurrency), logredact.Text(raw), logredact.Amount(amt))
 		}
 		// Confidence proxy based on substring length vs OCR text size
 		conf := float64(len(raw)) / float64(len(text)+1)
@@ -140,15 +218,20 @@ func ExtractAmountFromImage(path string) (int64, float64, string, error) {
 			// Tighter threshold to avoid flooring legitimate 6-digit grouped values misread.
 			if rem <= 20 || rem >= 980 {
 				amt = amt - rem
+				res.addWarning(WarnFlooredThousand)
 			}
 		}
-		return amt, conf, raw, nil
+		if centsSuffixRE.MatchString(strings.TrimSpace(raw)) {
+			res.addWarning(WarnDecimalsStripped)
+		}
+		return res.finish(amt, conf, raw, heuristic), nil
 	}
 	// Fallback: attempt 'ribu' pattern if numeric matches didn't yield a best amount.
 	if amt, raw := extractRibu(text); amt > 0 {
-		return amt, 0.4, raw, nil
+		res.addWarning(WarnRibuNotation)
+		return res.finish(amt, 0.4, raw, HeuristicRibu), nil
 	}
-	return 0, 0, "", ErrNoAmount
+	return res, ErrNoAmount
 }
 
 // extractRibu finds patterns like "400 ribu", "400ribu", "400 RIBU" meaning 400 * 1000.
@@ -188,23 +271,29 @@ func extractRibu(text string) (int64, string) {
 // logo / non-amount image (very little text and no digits), so callers can surface a different
 // user-facing message.
 func FindAllMatches(path string) ([]string, bool, error) {
-	img, err := imaging.Open(path)
+	return findAllMatchesWith(path, CurrentOptions())
+}
+
+func findAllMatchesWith(path string, opts Options) ([]string, bool, error) {
+	src, err := openSource(path, opts)
 	if err != nil {
-		return nil, false, fmt.Errorf("open image: %w", err)
+		return nil, false, err
 	}
-	gray := imaging.Grayscale(img)
+	defer src.Close()
+	return findAllMatches(src)
+}
+
+// findAllMatches is FindAllMatches of an opened source.
+func findAllMatches(src *source) ([]string, bool, error) {
+	path := src.path
+	gray := imaging.Grayscale(src.img)
 	h := gray.Bounds().Dy()
 	if h < 800 {
 		gray = imaging.Resize(gray, 0, 1200, imaging.Lanczos)
 	}
-	tmpFile, err := os.CreateTemp("", "ocr-*.png")
 	tmp := path
-	if err == nil {
-		tmp = tmpFile.Name()
-		_ = tmpFile.Close()
-		if err := imaging.Save(gray, tmp); err != nil {
-			tmp = path
-		}
+	if p, err := src.work.file("matches-*.png"); err == nil && imaging.Save(gray, p) == nil {
+		tmp = p
 	}
 
 	client := gosseract.NewClient()
@@ -213,16 +302,20 @@ func FindAllMatches(path string) ([]string, bool, error) {
 	_ = client.SetWhitelist("0123456789RpIDRidri.,:()/- ")
 	client.SetImage(tmp)
 	text, err := client.Text()
-	if tmp != path {
-		_ = os.Remove(tmp)
-	}
 	if err != nil {
 		return nil, false, fmt.Errorf("ocr error: %w", err)
 	}
+	log.Printf("OCR RAW %s snippet=%q", src.name, logredact.Text(snippet(normalizeOCRText(text), 180)))
+	out, isLikelyNonAmount := matchesInText(text)
+	return out, isLikelyNonAmount, nil
+}
+
+// matchesInText is the text half of findAllMatches: the amount-like substrings
+// of OCR text, and whether the text looks like a logo rather than a receipt.
+func matchesInText(text string) ([]string, bool) {
 	// Preserve the raw OCR text before normalization for later flexible detection/inference.
 	originalText := text
 	text = normalizeOCRText(text)
-	log.Printf("OCR RAW %s snippet=%q", path, snippet(text, 180))
 
 	// Heuristic: if OCR produced very little text and there are no digits at all,
 	// this is likely a logo/graphic or non-receipt image. We treat this as a
@@ -341,7 +434,7 @@ func FindAllMatches(path string) ([]string, bool, error) {
 			seen[infRaw] = struct{}{}
 		}
 	}
-	return out, isLikelyNonAmount, nil
+	return out, isLikelyNonAmount
 }
 
 // isPlausibleAmount applies lightweight heuristics to decide whether a
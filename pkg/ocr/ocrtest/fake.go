@@ -0,0 +1,119 @@
+// Package ocrtest provides a scripted ocr.Engine for tests.
+package ocrtest
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"be03/pkg/ocr"
+)
+
+// Script is the canned outcome for one file.
+type Script struct {
+	Result *ocr.Result
+	// Matches is returned by FindAllMatches; when nil it defaults to Result.Raw.
+	Matches   []string
+	NonAmount bool
+	// Regions is returned by Regions.
+	Regions []ocr.Region
+	// QRIS is returned by QRIS.
+	QRIS *ocr.QRIS
+	Err  error
+}
+
+// Engine returns scripted results keyed by file base name, which may carry the
+// "<profile id>_" prefix receipts are stored with (see storagepath.DiskName).
+// Unknown files behave like an image without any amount. It records every path
+// it was asked about.
+type Engine struct {
+	mu      sync.Mutex
+	scripts map[string]Script
+	calls   []string
+}
+
+// New returns an empty fake engine.
+func New() *Engine {
+	return &Engine{scripts: map[string]Script{}}
+}
+
+// Set scripts the outcome for a file name.
+func (e *Engine) Set(name string, s Script) *Engine {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts[name] = s
+	return e
+}
+
+// Amount scripts a confident detection of amt (raw is the OCR text it came from).
+func (e *Engine) Amount(name string, amt int64, raw string) *Engine {
+	return e.Set(name, Script{Result: &ocr.Result{Amount: amt, Confidence: 0.9, RawConfidence: 0.9, Heuristic: ocr.HeuristicMatch, Raw: raw, Candidates: []string{raw}}})
+}
+
+// Calls returns the paths passed to the engine so far.
+func (e *Engine) Calls() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.calls...)
+}
+
+func (e *Engine) lookup(path string) Script {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, path)
+	name := filepath.Base(path)
+	if s, ok := e.scripts[name]; ok {
+		return s
+	}
+	if i := strings.IndexByte(name, '_'); i > 0 && strings.Trim(name[:i], "0123456789") == "" {
+		return e.scripts[name[i+1:]]
+	}
+	return Script{}
+}
+
+func (e *Engine) Extract(path string) (*ocr.Result, error) {
+	s := e.lookup(path)
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if s.Result == nil || s.Result.Amount <= 0 {
+		res := &ocr.Result{}
+		if s.Result != nil {
+			cp := *s.Result
+			res = &cp
+		}
+		return res, ocr.ErrNoAmount
+	}
+	cp := *s.Result
+	return &cp, nil
+}
+
+func (e *Engine) FindAllMatches(path string) ([]string, bool, error) {
+	s := e.lookup(path)
+	if s.Err != nil {
+		return nil, false, s.Err
+	}
+	if s.Matches != nil {
+		return s.Matches, s.NonAmount, nil
+	}
+	if s.Result != nil && s.Result.Raw != "" {
+		return []string{s.Result.Raw}, s.NonAmount, nil
+	}
+	return nil, s.NonAmount, nil
+}
+
+func (e *Engine) Regions(path string) ([]ocr.Region, error) {
+	s := e.lookup(path)
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Regions, nil
+}
+
+func (e *Engine) QRIS(path string) (*ocr.QRIS, error) {
+	s := e.lookup(path)
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.QRIS, nil
+}
@@ -0,0 +1,54 @@
+package ocr
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Options configures the extraction pipeline. The zero value is the
+// production default; SetOptions installs the options an experiment promoted
+// (see pkg/ocrexp), and an experiment runs its candidate with others.
+type Options struct {
+	// MaxMegapixels caps the image the passes work on; 0 keeps MaxPixels.
+	MaxMegapixels float64 `json:"max_megapixels,omitempty"`
+	// Uncalibrated keeps the raw confidence even with a Calibration installed.
+	Uncalibrated bool `json:"uncalibrated,omitempty"`
+	// Passes is PassesAll to run every OCR pass on every image; by default
+	// Classify picks the passes suited to a screenshot or a photo.
+	Passes string `json:"passes,omitempty"`
+}
+
+// PassesAll is the Options.Passes value turning pass selection off.
+const PassesAll = "all"
+
+// Validate reports options the pipeline cannot run with.
+func (o Options) Validate() error {
+	if o.MaxMegapixels < 0 || o.MaxMegapixels > 100 {
+		return errors.New("max_megapixels must be between 0 and 100")
+	}
+	if o.Passes != "" && o.Passes != PassesAll {
+		return errors.New(`passes must be empty or "all"`)
+	}
+	return nil
+}
+
+// maxPixels is the pixel cap of o.
+func (o Options) maxPixels() int64 {
+	if o.MaxMegapixels > 0 {
+		return int64(o.MaxMegapixels * 1e6)
+	}
+	return MaxPixels()
+}
+
+var options atomic.Pointer[Options]
+
+// SetOptions installs o for every later extraction that is not given its own.
+func SetOptions(o Options) { options.Store(&o) }
+
+// CurrentOptions returns the installed Options, the zero value by default.
+func CurrentOptions() Options {
+	if o := options.Load(); o != nil {
+		return *o
+	}
+	return Options{}
+}
@@ -7,17 +7,19 @@ import (
 	"strings"
 )
 
+// centsSuffixRE matches a trailing two-digit decimal part such as ",00" or ".50".
+var centsSuffixRE = regexp.MustCompile(`[.,]\d{2}$`)
+
 // ParseAmountFromMatch normalizes a matched substring into an integer amount (whole currency units).
 // It removes a trailing decimal part of exactly two digits (e.g., 10.000,00 -> 10000).
 func ParseAmountFromMatch(found string) (int64, error) {
-	centsRE := regexp.MustCompile(`[.,]\d{2}$`)
 	foundTrim := strings.TrimSpace(found)
 	if foundTrim == "" {
 		return 0, fmt.Errorf("empty")
 	}
 	onlyDigitsLocal := func(s string) string { return onlyDigits(s) }
 	var digits string
-	if centsRE.MatchString(foundTrim) {
+	if centsSuffixRE.MatchString(foundTrim) {
 		lastDot := strings.LastIndex(foundTrim, ".")
 		lastComma := strings.LastIndex(foundTrim, ",")
 		if lastComma > lastDot {
@@ -0,0 +1,184 @@
+package ocr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"be03/pkg/qrcode"
+
+	"github.com/disintegration/imaging"
+)
+
+// QRISConfidence is the raw confidence of an amount read from a QRIS code:
+// the payload is checksummed, so it is only as wrong as the code printed.
+const QRISConfidence = 0.99
+
+// QRIS is a payment code in the EMV merchant-presented format Indonesian
+// wallets and banks print on their payment proofs.
+type QRIS struct {
+	// Dynamic codes are issued for one payment and carry its amount; static
+	// ones are the merchant's sticker and usually carry none.
+	Dynamic  bool   `json:"dynamic"`
+	Merchant string `json:"merchant,omitempty"`
+	City     string `json:"city,omitempty"`
+	Currency string `json:"currency,omitempty"` // ISO 4217 numeric, "360" for rupiah
+	// Amount is the transaction amount in whole rupiah including a fixed or
+	// percentage convenience fee; 0 when the code names none, or another
+	// currency.
+	Amount int64 `json:"amount,omitempty"`
+	// Reference is the reference label of the additional data, else its
+	// bill number.
+	Reference string `json:"reference,omitempty"`
+
+	raw string // the amount as encoded
+}
+
+// ErrNotQRIS wraps the reasons ParseQRIS rejects a payload.
+var ErrNotQRIS = errors.New("not a QRIS payload")
+
+// ParseQRIS parses an EMV merchant-presented payload: two-digit tag, two-digit
+// length and value, repeated, ending in a CRC-16/CCITT-FALSE checksum under
+// tag 63.
+func ParseQRIS(payload string) (*QRIS, error) {
+	if !strings.HasPrefix(payload, "000201") {
+		return nil, fmt.Errorf("%w: no payload format indicator", ErrNotQRIS)
+	}
+	tags, err := parseTLV(payload)
+	if err != nil {
+		return nil, err
+	}
+	crc, ok := tags["63"]
+	if !ok || !strings.HasSuffix(payload, "6304"+crc) {
+		return nil, fmt.Errorf("%w: no trailing checksum", ErrNotQRIS)
+	}
+	if want := fmt.Sprintf("%04X", crc16(payload[:len(payload)-4])); !strings.EqualFold(crc, want) {
+		return nil, fmt.Errorf("%w: checksum %s, computed %s", ErrNotQRIS, crc, want)
+	}
+	q := &QRIS{
+		Dynamic:  tags["01"] == "12",
+		Merchant: strings.TrimSpace(tags["59"]),
+		City:     strings.TrimSpace(tags["60"]),
+		Currency: tags["53"],
+	}
+	if extra, err := parseTLV(tags["62"]); err == nil {
+		q.Reference = strings.TrimSpace(extra["05"])
+		if q.Reference == "" {
+			q.Reference = strings.TrimSpace(extra["01"])
+		}
+	}
+	if q.Currency != "" && q.Currency != "360" {
+		return q, nil
+	}
+	amt, ok := parseEMVAmount(tags["54"])
+	if !ok {
+		return q, nil
+	}
+	switch tags["55"] {
+	case "02":
+		if fee, ok := parseEMVAmount(tags["56"]); ok {
+			amt += fee
+		}
+	case "03":
+		if pct, err := strconv.ParseFloat(tags["57"], 64); err == nil && pct > 0 && pct < 100 {
+			amt += int64(math.Round(float64(amt) * pct / 100))
+		}
+	}
+	q.Amount, q.raw = amt, tags["54"]
+	return q, nil
+}
+
+// parseTLV splits one level of EMV data objects.
+func parseTLV(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for len(s) > 0 {
+		if len(s) < 4 {
+			return nil, fmt.Errorf("%w: truncated data object", ErrNotQRIS)
+		}
+		// Atoi would take a sign ("-1"), and a negative length panics below
+		if s[2] < '0' || s[2] > '9' || s[3] < '0' || s[3] > '9' {
+			return nil, fmt.Errorf("%w: bad length for tag %s", ErrNotQRIS, s[:2])
+		}
+		n := int(s[2]-'0')*10 + int(s[3]-'0')
+		if n > len(s)-4 {
+			return nil, fmt.Errorf("%w: bad length for tag %s", ErrNotQRIS, s[:2])
+		}
+		tags[s[:2]] = s[4 : 4+n]
+		s = s[4+n:]
+	}
+	return tags, nil
+}
+
+// parseEMVAmount reads an EMV amount ("25000", "25000.00") in whole units,
+// rounding a fraction.
+func parseEMVAmount(s string) (int64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 || strings.ContainsAny(s, "eE+-") {
+		return 0, false
+	}
+	return int64(math.Round(f)), true
+}
+
+// crc16 is CRC-16/CCITT-FALSE: polynomial 0x1021, initial value 0xFFFF.
+func crc16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// DetectQRIS returns the first valid QRIS payload among the QR codes in img,
+// nil when there is none.
+func DetectQRIS(img image.Image) *QRIS {
+	texts, err := qrcode.Decode(img)
+	if err != nil {
+		return nil
+	}
+	for _, t := range texts {
+		if q, err := ParseQRIS(t); err == nil {
+			return q
+		}
+	}
+	return nil
+}
+
+// DetectQRISFile is DetectQRIS on the image at path, scaled down to the
+// pixel cap of the installed Options first.
+func DetectQRISFile(path string) (*QRIS, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	b := img.Bounds()
+	if in, limit := int64(b.Dx())*int64(b.Dy()), CurrentOptions().maxPixels(); in > limit {
+		scale := math.Sqrt(float64(limit) / float64(in))
+		img = imaging.Resize(img, max(1, int(float64(b.Dx())*scale)), 0, imaging.Lanczos)
+	}
+	return DetectQRIS(img), nil
+}
+
+// Result is the extraction outcome of a code carrying an amount: no OCR is
+// involved, so it names neither a date nor an institution; its reference is
+// the code's when that looks like a transaction reference.
+func (q *QRIS) Result() *Result {
+	return q.result(CurrentOptions().Uncalibrated)
+}
+
+func (q *QRIS) result(uncalibrated bool) *Result {
+	r := &Result{QRIS: q, Candidates: []string{q.raw}, uncalibrated: uncalibrated}
+	if ref, ok := validReference(q.Reference); ok {
+		r.Reference = ref
+	}
+	return r.finish(q.Amount, QRISConfidence, q.raw, HeuristicQRIS)
+}
@@ -0,0 +1,76 @@
+package ocr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a dynamic QRIS for Rp125.000 at KOPI KENANGAN, as testdata/qris.png encodes it
+const dynamicQRIS = "00020101021226650014ID.CO.QRIS.WWW01189360001400001234560214ID1020000000010303UMI5204581453033605409125000.005802ID5913KOPI KENANGAN6015JAKARTA SELATAN61051219062460115INV-20261018-770516RRN 6281007345120703T016304E6D1"
+
+// withCRC appends the checksum data object to an EMV payload.
+func withCRC(p string) string {
+	p += "6304"
+	return p + fmt.Sprintf("%04X", crc16(p))
+}
+
+func TestCRC16(t *testing.T) {
+	if got := crc16("123456789"); got != 0x29B1 {
+		t.Fatalf("crc16 check value %#x", got)
+	}
+}
+
+func TestParseQRIS(t *testing.T) {
+	q, err := ParseQRIS(dynamicQRIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Dynamic || q.Amount != 125000 || q.Merchant != "KOPI KENANGAN" || q.City != "JAKARTA SELATAN" || q.Reference != "RRN 628100734512" {
+		t.Fatalf("parsed %+v", q)
+	}
+
+	static := withCRC("000201010211520458125303360" + "5802ID5906TOKO A6005BOGOR")
+	if q, err := ParseQRIS(static); err != nil || q.Dynamic || q.Amount != 0 || q.Merchant != "TOKO A" {
+		t.Fatalf("static %+v %v", q, err)
+	}
+	fixed := withCRC("000201010212530336054055000055020256041500")
+	if q, err := ParseQRIS(fixed); err != nil || q.Amount != 51500 {
+		t.Fatalf("fixed fee %+v %v", q, err)
+	}
+	pct := withCRC("0002010102125303360540610000055020357030.7")
+	if q, err := ParseQRIS(pct); err != nil || q.Amount != 100700 {
+		t.Fatalf("percentage fee %+v %v", q, err)
+	}
+	usd := withCRC("000201010212530384054031005802US")
+	if q, err := ParseQRIS(usd); err != nil || q.Amount != 0 {
+		t.Fatalf("foreign currency %+v %v", q, err)
+	}
+
+	for name, p := range map[string]string{
+		"checksum":  strings.Replace(dynamicQRIS, "125000.00", "725000.00", 1),
+		"truncated": dynamicQRIS[:len(dynamicQRIS)-10],
+		"no crc":    "0002010102125303360540550000",
+		"url":       "https://example.com/pay?amount=50000",
+		// signed lengths must not reach the slicing
+		"negative length": "00020101-1" + dynamicQRIS[10:],
+		"plus length":     "00020101+1" + dynamicQRIS[10:],
+		"signed crc":      withCRC("000201010212") + "63-1",
+	} {
+		if _, err := ParseQRIS(p); !errors.Is(err, ErrNotQRIS) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestDetectQRISFile(t *testing.T) {
+	q, err := DetectQRISFile("testdata/qris.png")
+	if err != nil || q == nil || q.Amount != 125000 || q.Merchant != "KOPI KENANGAN" {
+		t.Fatalf("%+v %v", q, err)
+	}
+	res := q.result(true)
+	if res.Heuristic != HeuristicQRIS || res.Confidence != QRISConfidence || res.NeedsConfirmation || res.QRIS != q {
+		t.Fatalf("result %+v", res)
+	}
+}
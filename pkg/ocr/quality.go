@@ -0,0 +1,195 @@
+package ocr
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Quality problem codes, most actionable first.
+const (
+	QualityTooSmall    = "too_small"
+	QualityTooDark     = "too_dark"
+	QualityOverexposed = "overexposed"
+	QualityLowContrast = "low_contrast"
+	QualityBlurry      = "blurry"
+)
+
+// qualityMessages is the feedback shown to the user for each problem.
+var qualityMessages = map[string]string{
+	QualityTooSmall:    "Resolusi gambar terlalu kecil, kirim foto struk yang lebih besar",
+	QualityTooDark:     "Foto terlalu gelap, ambil ulang di tempat yang lebih terang",
+	QualityOverexposed: "Foto terlalu terang atau silau, hindari pantulan cahaya",
+	QualityLowContrast: "Tulisan pada struk kurang jelas, pastikan struk terlihat penuh dan kontras",
+	QualityBlurry:      "Gambar terlalu buram, foto ulang dengan fokus pada struk",
+}
+
+// NoAmountMessage is the generic reason for a failed extraction, used when the
+// image has no quality problem to blame.
+const NoAmountMessage = "Nominal tidak ditemukan, gunakan file lain"
+
+// Thresholds of the quality gate. A soft problem only explains a failed
+// extraction; a severe one rejects the image before OCR runs.
+const (
+	minSideSoft, minSideSevere   = 300, 120 // pixels
+	darkMeanSoft, darkMeanSevere = 70, 35   // mean luminance, 0-255
+	flatStdSoft, flatStdSevere   = 20, 8    // luminance standard deviation
+	blurVarSoft, blurVarSevere   = 50, 10   // variance of the Laplacian
+	// a frame this white and this flat is a blank or blown-out photo
+	overexposedShare = 0.95
+	// images are measured at this width so sharpness is comparable across sizes
+	qualitySampleWidth = 1000
+)
+
+// QualityProblem is one finding of AssessQuality.
+type QualityProblem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Severe  bool   `json:"severe"`
+}
+
+// Quality is the pre-OCR assessment of a receipt image.
+type Quality struct {
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Brightness float64          `json:"brightness"` // mean luminance, 0-255
+	Contrast   float64          `json:"contrast"`   // luminance standard deviation
+	Sharpness  float64          `json:"sharpness"`  // variance of the Laplacian
+	Problems   []QualityProblem `json:"problems"`
+}
+
+// Reject reports whether a severe problem makes OCR pointless.
+func (q *Quality) Reject() bool {
+	for _, p := range q.Problems {
+		if p.Severe {
+			return true
+		}
+	}
+	return false
+}
+
+// Feedback is the message for the most actionable problem, or "" when the
+// image looks fine.
+func (q *Quality) Feedback() string {
+	if len(q.Problems) == 0 {
+		return ""
+	}
+	return q.Problems[0].Message
+}
+
+// FailureReason explains a failed extraction: the quality feedback when there
+// is any, NoAmountMessage otherwise. q may be nil (image not assessed).
+func (q *Quality) FailureReason() string {
+	if q != nil {
+		if f := q.Feedback(); f != "" {
+			return f
+		}
+	}
+	return NoAmountMessage
+}
+
+// AssessFile decodes the image at path and runs AssessQuality.
+func AssessFile(path string) (*Quality, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	return AssessQuality(img), nil
+}
+
+// AssessQuality measures resolution, brightness histogram and sharpness
+// (variance of the Laplacian) of img.
+func AssessQuality(img image.Image) *Quality {
+	b := img.Bounds()
+	q := &Quality{Width: b.Dx(), Height: b.Dy()}
+	if q.Width == 0 || q.Height == 0 {
+		q.add(QualityTooSmall, true)
+		return q
+	}
+	gray := imaging.Grayscale(img)
+	if gray.Bounds().Dx() > qualitySampleWidth {
+		gray = imaging.Resize(gray, qualitySampleWidth, 0, imaging.Box)
+	}
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+	lum := make([]float64, w*h)
+	var sum float64
+	white := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := float64(gray.Pix[y*gray.Stride+x*4])
+			lum[y*w+x] = v
+			sum += v
+			if v >= 250 {
+				white++
+			}
+		}
+	}
+	n := float64(w * h)
+	q.Brightness = sum / n
+	var sq float64
+	for _, v := range lum {
+		sq += (v - q.Brightness) * (v - q.Brightness)
+	}
+	q.Contrast = math.Sqrt(sq / n)
+	q.Sharpness = laplacianVariance(lum, w, h)
+
+	minSide := min(q.Width, q.Height)
+	switch {
+	case minSide < minSideSevere:
+		q.add(QualityTooSmall, true)
+	case minSide < minSideSoft:
+		q.add(QualityTooSmall, false)
+	}
+	switch {
+	case q.Brightness < darkMeanSevere:
+		q.add(QualityTooDark, true)
+	case q.Brightness < darkMeanSoft:
+		q.add(QualityTooDark, false)
+	}
+	overexposed := float64(white)/n > overexposedShare && q.Contrast < flatStdSoft
+	if overexposed {
+		q.add(QualityOverexposed, true)
+	}
+	if overexposed || q.Brightness < darkMeanSevere {
+		return q
+	}
+	// a flat frame has no edges either, so blur is judged only when there is
+	// something to be sharp; blurring also washes out contrast, hence the order
+	switch {
+	case q.Contrast < flatStdSevere:
+		q.add(QualityLowContrast, true)
+	case q.Sharpness < blurVarSevere:
+		q.add(QualityBlurry, true)
+	case q.Sharpness < blurVarSoft:
+		q.add(QualityBlurry, false)
+	case q.Contrast < flatStdSoft:
+		q.add(QualityLowContrast, false)
+	}
+	return q
+}
+
+func (q *Quality) add(code string, severe bool) {
+	q.Problems = append(q.Problems, QualityProblem{Code: code, Message: qualityMessages[code], Severe: severe})
+}
+
+// laplacianVariance is the variance of the 4-neighbour Laplacian over the
+// interior of a w×h luminance plane; sharp edges give high values.
+func laplacianVariance(lum []float64, w, h int) float64 {
+	if w < 3 || h < 3 {
+		return 0
+	}
+	var sum, sq float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			l := lum[i-w] + lum[i+w] + lum[i-1] + lum[i+1] - 4*lum[i]
+			sum += l
+			sq += l * l
+		}
+	}
+	n := float64((w - 2) * (h - 2))
+	mean := sum / n
+	return sq/n - mean*mean
+}
@@ -0,0 +1,57 @@
+package ocr
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// receiptLike draws dark "text" bars on paper of the given luminance.
+func receiptLike(w, h int, paper, ink uint8) *image.NRGBA {
+	img := imaging.New(w, h, color.NRGBA{paper, paper, paper, 255})
+	for y := 20; y+8 < h; y += 24 {
+		for x := 20; x+6 < w-20; x += 10 {
+			for dy := 0; dy < 8; dy++ {
+				for dx := 0; dx < 6; dx++ {
+					img.Set(x+dx, y+dy, color.NRGBA{ink, ink, ink, 255})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func codes(q *Quality) []string {
+	var out []string
+	for _, p := range q.Problems {
+		out = append(out, p.Code)
+	}
+	return out
+}
+
+func TestAssessQuality(t *testing.T) {
+	if q := AssessQuality(receiptLike(600, 900, 235, 20)); len(q.Problems) != 0 {
+		t.Fatalf("clean receipt flagged: %v (%+v)", codes(q), q)
+	}
+
+	blurred := imaging.Blur(receiptLike(600, 900, 235, 20), 6)
+	q := AssessQuality(blurred)
+	if len(q.Problems) == 0 || q.Problems[0].Code != QualityBlurry {
+		t.Fatalf("blurred receipt: %v (%+v)", codes(q), q)
+	}
+	if q.Feedback() != qualityMessages[QualityBlurry] {
+		t.Fatalf("feedback %q", q.Feedback())
+	}
+
+	if q := AssessQuality(receiptLike(600, 900, 25, 5)); !q.Reject() || q.Problems[0].Code != QualityTooDark {
+		t.Fatalf("dark photo: %v", codes(q))
+	}
+	if q := AssessQuality(imaging.New(600, 900, color.NRGBA{255, 255, 255, 255})); !q.Reject() || q.Problems[0].Code != QualityOverexposed {
+		t.Fatalf("blank white photo: %v", codes(q))
+	}
+	if q := AssessQuality(receiptLike(100, 90, 235, 20)); !q.Reject() || q.Problems[0].Code != QualityTooSmall {
+		t.Fatalf("thumbnail: %v", codes(q))
+	}
+}
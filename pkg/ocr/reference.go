@@ -0,0 +1,58 @@
+package ocr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// referencePattern finds a transaction reference after its label: the RRN
+// of card and QRIS payments, the reference or transaction number of bank
+// transfers and e-wallet payments. Banks print long numbers in groups
+// ("2310 1234 5678"), which are taken together.
+var referencePattern = regexp.MustCompile(`(?i)\b(?:rrn|ref(?:erence|erensi)?\.?(?:\s*(?:no|number|id)\b\.?)?|no(?:mor)?\.?\s*ref(?:erensi|erence)?\b\.?|(?:id|no(?:mor)?\.?|kode)\s*transaksi|transaction\s*(?:id|no|number)\b\.?|trx\.?\s*id)\s*[:;#.]?\s*([0-9]{3,6}(?: [0-9]{3,6}){1,5}\b|[A-Z0-9][A-Z0-9/\-]{5,39})`)
+
+// Bounds of a reference, once normalized.
+const (
+	minReferenceLen    = 8
+	maxReferenceLen    = 64
+	minReferenceDigits = 6
+)
+
+// NormalizeReference is the form references are stored and looked up in:
+// upper case letters and digits only, so "ref 2310-1234 5678" and
+// "REF2310 12345678" compare equal.
+func NormalizeReference(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validReference normalizes s and reports whether it looks like a
+// transaction reference: long enough and mostly a number, so that words
+// following a label ("Referensi BERHASIL") are not taken for one.
+func validReference(s string) (string, bool) {
+	s = NormalizeReference(s)
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return s, len(s) >= minReferenceLen && len(s) <= maxReferenceLen && digits >= minReferenceDigits
+}
+
+// DetectReference returns the first labelled transaction reference in OCR
+// text, normalized (see NormalizeReference), or "" when none is found.
+func DetectReference(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	for _, m := range referencePattern.FindAllStringSubmatch(text, -1) {
+		if ref, ok := validReference(m[1]); ok {
+			return ref
+		}
+	}
+	return ""
+}
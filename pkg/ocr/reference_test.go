@@ -0,0 +1,28 @@
+package ocr
+
+import "testing"
+
+func TestDetectReference(t *testing.T) {
+	cases := []struct{ text, want string }{
+		{"Transfer Berhasil Rp 250.000 No. Referensi: 2310 1234 5678 18 Okt 2026", "231012345678"},
+		{"m-BCA TRANSFER REF NO. 0012AB77889900 BERHASIL", "0012AB77889900"},
+		{"QRIS Pembayaran RRN 628100734512 Merchant KOPI", "628100734512"},
+		{"ID Transaksi\n20261018-GP-99887766\nTotal Rp 45.000", "20261018GP99887766"},
+		{"Transaction ID: TRX/2026/10/000123", "TRX202610000123"},
+		{"Kode Transaksi ; 7788990011", "7788990011"},
+		// words after a label are no reference, a later one is
+		{"Referensi BERHASIL Total Rp 10.000 Ref No 99887766554", "99887766554"},
+		// too short, or not a number
+		{"No Ref: 12345", ""},
+		{"Reference: ABCDEFGHIJK", ""},
+		{"Total Rp 1.250.000 terima kasih", ""},
+	}
+	for _, c := range cases {
+		if got := DetectReference(c.text); got != c.want {
+			t.Errorf("DetectReference(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+	if NormalizeReference("ref 2310-1234 5678") != NormalizeReference("REF2310 12345678") {
+		t.Fatal("normalized references differ")
+	}
+}
@@ -0,0 +1,89 @@
+package ocr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/otiai10/gosseract/v2"
+)
+
+// Region is one detected line of text, in pixels of the original image.
+type Region struct {
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"` // 0-100, as reported by tesseract
+}
+
+// Rect is r as an image rectangle.
+func (r Region) Rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+// MaxRegions caps the regions returned for one image.
+const MaxRegions = 50
+
+// MinCropSide is the smallest crop (in pixels, per side) worth running OCR on.
+const MinCropSide = 16
+
+// ErrInvalidCrop means a crop rectangle is empty, too small or outside the image.
+var ErrInvalidCrop = errors.New("crop region is outside the image or too small")
+
+// Regions returns the text lines tesseract finds in the image at path, in
+// reading order, so a client can ask the user to pick the amount.
+func Regions(path string) ([]Region, error) {
+	client := gosseract.NewClient()
+	defer client.Close()
+	_ = client.SetLanguage("eng")
+	if err := client.SetImage(path); err != nil {
+		return nil, err
+	}
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_TEXTLINE)
+	if err != nil {
+		return nil, fmt.Errorf("ocr regions: %w", err)
+	}
+	out := []Region{}
+	for _, b := range boxes {
+		text := strings.TrimSpace(b.Word)
+		if text == "" || b.Box.Empty() {
+			continue
+		}
+		out = append(out, Region{X: b.Box.Min.X, Y: b.Box.Min.Y, Width: b.Box.Dx(), Height: b.Box.Dy(), Text: text, Confidence: b.Confidence})
+		if len(out) == MaxRegions {
+			break
+		}
+	}
+	return out, nil
+}
+
+// CropFile writes the part of the image at path inside rect to a new file
+// with the same base name in a working directory under TempRoot and returns
+// its path; the caller removes the directory (filepath.Dir) when done. It fails with ErrInvalidCrop
+// when rect does not select at least MinCropSide pixels per side of the image.
+func CropFile(path string, rect image.Rectangle) (string, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open image: %w", err)
+	}
+	rect = rect.Canon().Intersect(img.Bounds())
+	if rect.Dx() < MinCropSide || rect.Dy() < MinCropSide {
+		return "", ErrInvalidCrop
+	}
+	work, err := newWorkDir()
+	if err != nil {
+		return "", err
+	}
+	// keeping the name keeps log lines (and scripted test engines) keyed by file
+	out := filepath.Join(work.dir, filepath.Base(path))
+	if err := imaging.Save(imaging.Crop(img, rect), out); err != nil {
+		work.Close()
+		return "", fmt.Errorf("save crop: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package ocr
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestCropFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "struk.png")
+	if err := imaging.Save(receiptLike(300, 400, 235, 20), src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CropFile(src, image.Rect(290, 0, 400, 100)); !errors.Is(err, ErrInvalidCrop) {
+		t.Fatalf("sliver at the edge: %v", err)
+	}
+	out, err := CropFile(src, image.Rect(250, 350, 0, 300)) // corners swapped
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(out))
+	if filepath.Base(out) != "struk.png" {
+		t.Fatalf("crop renamed to %s", out)
+	}
+	img, err := imaging.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 250 || b.Dy() != 50 {
+		t.Fatalf("crop bounds %v", b)
+	}
+}
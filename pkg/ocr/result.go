@@ -0,0 +1,71 @@
+package ocr
+
+import "time"
+
+// LowConfidenceThreshold is the confidence below which callers should ask the
+// user to confirm the extracted amount before trusting it.
+const LowConfidenceThreshold = 0.5
+
+// Warnings attached to a Result when a heuristic altered or guessed the amount.
+const (
+	WarnFlooredThousand    = "amount floored to nearest thousand"
+	WarnDecimalsStripped   = "decimal fraction stripped from amount"
+	WarnFuzzyReconstructed = "amount reconstructed from noisy currency text"
+	WarnRibuNotation       = "amount parsed from 'ribu' notation"
+	WarnZeroBlockInferred  = "amount inferred from zero pattern without currency marker"
+	WarnLowConfidence      = "low confidence, please confirm the amount"
+)
+
+// Result is the detailed outcome of Extract.
+type Result struct {
+	Amount     int64   `json:"amount"`
+	Confidence float64 `json:"confidence"`
+	// RawConfidence is the heuristic's own score, Confidence the calibrated
+	// probability once a Calibration is installed (else the same value);
+	// Heuristic names the path that chose the amount.
+	RawConfidence     float64    `json:"raw_confidence"`
+	Heuristic         string     `json:"heuristic,omitempty"`
+	Raw               string     `json:"raw"`
+	Candidates        []string   `json:"candidates"`
+	Date              *time.Time `json:"date,omitempty"`
+	Institution       string     `json:"institution,omitempty"` // issuing bank / e-wallet, see DetectInstitution
+	Tax               *Tax       `json:"tax,omitempty"`         // itemised tax and service charge, see DetectTax
+	Items             []LineItem `json:"items,omitempty"`       // purchased lines when OCR_ITEMIZED is on, see ParseLineItems
+	QRIS              *QRIS      `json:"qris,omitempty"`        // payment code on the receipt, see DetectQRIS
+	Reference         string     `json:"reference,omitempty"`   // transaction reference, see DetectReference
+	ImageKind         string     `json:"image_kind,omitempty"`  // screenshot or photo, see Classify
+	Warnings          []string   `json:"warnings"`
+	NeedsConfirmation bool       `json:"needs_confirmation"`
+	Quality           *Quality   `json:"quality,omitempty"` // set by callers that ran AssessFile
+	Regions           []Region   `json:"regions,omitempty"` // set by callers when extraction failed, for crop-assist
+	// Text is the normalized aggregate text of every OCR pass; it is stored
+	// with the upload (see pkg/ocrtext) rather than returned to clients.
+	Text string `json:"-"`
+
+	uncalibrated bool // Options.Uncalibrated
+}
+
+func (r *Result) addWarning(w string) {
+	for _, ex := range r.Warnings {
+		if ex == w {
+			return
+		}
+	}
+	r.Warnings = append(r.Warnings, w)
+}
+
+// finish records the chosen amount, calibrates the confidence and derives
+// the confirmation hint.
+func (r *Result) finish(amt int64, conf float64, raw, heuristic string) *Result {
+	r.Amount, r.Raw, r.Heuristic, r.RawConfidence = amt, raw, heuristic, conf
+	if p, ok := CurrentCalibration().Probability(heuristic, conf); ok && !r.uncalibrated {
+		conf = p
+	}
+	r.Confidence = conf
+	r.Tax = DetectTax(r.Text, amt)
+	if conf < LowConfidenceThreshold {
+		r.addWarning(WarnLowConfidence)
+	}
+	r.NeedsConfirmation = conf < LowConfidenceThreshold
+	return r
+}
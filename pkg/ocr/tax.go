@@ -0,0 +1,73 @@
+package ocr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tax is the tax and service charge printed on a receipt, in whole currency
+// units. Restaurant and e-commerce receipts itemise them above the total.
+type Tax struct {
+	Amount  int64   `json:"amount"`            // PPN / VAT / PB1 restaurant tax
+	Rate    float64 `json:"rate,omitempty"`    // percentage printed with it (11 for "PPN 11%")
+	Service int64   `json:"service,omitempty"` // service charge
+}
+
+// Amounts returns the tax and service charge; both are 0 for a nil Tax.
+func (t *Tax) Amounts() (tax, service int64) {
+	if t == nil {
+		return 0, 0
+	}
+	return t.Amount, t.Service
+}
+
+// taxAmount is an amount as itemised on receipts: grouped (4.950, 12,500.00)
+// or at least three plain digits, so a bare rate is never taken for one.
+const taxAmount = `(?:rp\.?\s*|idr\s*)?(\d{1,3}(?:[.,]\d{3})+(?:[.,]\d{2})?|\d{3,9})\b`
+
+// taxRate is an optional percentage; Tesseract often drops the "%" sign, so
+// a whole number followed by a space is accepted too.
+const taxRate = `(?:\(?\s*(\d{1,2}(?:[.,]\d{1,2})?)\s*%\s*\)?\s*|(\d{1,2})\s+)?`
+
+var (
+	taxLineRE     = regexp.MustCompile(`(?i)\b(?:ppn|vat|pb\s?1|pajak(?:\s+restoran)?|tax)\b\s*` + taxRate + `[:=]?\s*` + taxAmount)
+	serviceLineRE = regexp.MustCompile(`(?i)\b(?:service(?:\s+charge)?|svc(?:\s+chg)?|biaya\s+layanan)\b\s*` + taxRate + `[:=]?\s*` + taxAmount)
+)
+
+// DetectTax finds the tax and service charge lines of a receipt whose total
+// is total (0 when unknown), or returns nil when there are none. Amounts of
+// half the total or more are ignored: such lines are totals "incl. tax".
+func DetectTax(text string, total int64) *Tax {
+	text = strings.Join(strings.Fields(text), " ")
+	var t Tax
+	t.Amount, t.Rate = firstTaxLine(taxLineRE, text, total)
+	t.Service, _ = firstTaxLine(serviceLineRE, text, total)
+	if t.Amount == 0 && t.Service == 0 {
+		return nil
+	}
+	if t.Amount == 0 {
+		t.Rate = 0
+	}
+	return &t
+}
+
+// firstTaxLine returns the amount and rate of the first plausible match of re.
+func firstTaxLine(re *regexp.Regexp, text string, total int64) (int64, float64) {
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		amt, err := ParseAmountFromMatch(m[3])
+		if err != nil || amt <= 0 || (total > 0 && amt*2 >= total) {
+			continue
+		}
+		rate := m[1]
+		if rate == "" {
+			rate = m[2]
+		}
+		r, _ := strconv.ParseFloat(strings.Replace(rate, ",", ".", 1), 64)
+		if r <= 0 || r > 30 {
+			r = 0
+		}
+		return amt, r
+	}
+	return 0, 0
+}
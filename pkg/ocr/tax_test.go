@@ -0,0 +1,31 @@
+package ocr
+
+import "testing"
+
+func TestDetectTax(t *testing.T) {
+	cases := []struct {
+		text  string
+		total int64
+		want  *Tax
+	}{
+		{"Subtotal 45.000 PPN 11% 4.950 Total Rp 49.950", 49950, &Tax{Amount: 4950, Rate: 11}},
+		// OCR without the percent sign
+		{"SUBTOTAL 100.000 SERVICE CHARGE 5 5.000 PB1 10 10.500 TOTAL 115.500", 115500, &Tax{Amount: 10500, Rate: 10, Service: 5000}},
+		{"Biaya Layanan Rp 2.000 Pajak Rp1.650 Total Rp 18.650", 18650, &Tax{Amount: 1650, Service: 2000}},
+		{"PPN: 4950 TOTAL 49950", 49950, &Tax{Amount: 4950}},
+		// "incl. tax" totals are not a tax line
+		{"Total incl tax 55.000", 55000, nil},
+		{"Harga sudah termasuk PPN Total Rp 50.000", 50000, nil},
+		{"Total Rp 50.000 terima kasih", 50000, nil},
+	}
+	for _, c := range cases {
+		got := DetectTax(c.text, c.total)
+		if (got == nil) != (c.want == nil) || (got != nil && *got != *c.want) {
+			t.Errorf("DetectTax(%q) = %+v, want %+v", c.text, got, c.want)
+		}
+	}
+	var none *Tax
+	if tax, svc := none.Amounts(); tax != 0 || svc != 0 {
+		t.Fatal("nil Tax has amounts")
+	}
+}
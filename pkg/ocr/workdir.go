@@ -0,0 +1,101 @@
+package ocr
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workDirPrefix names the working directories of extractions, so SweepStale
+// can tell them from other programs' files.
+const workDirPrefix = "be03-ocr-"
+
+// StaleAfter is how old a working directory must be before SweepStale removes
+// it; an extraction takes seconds, so an older one was left by a crash.
+const StaleAfter = time.Hour
+
+// TempRoot is where extractions keep their intermediate images: OCR_TMPDIR
+// (e.g. a tmpfs mount), else the system temporary directory.
+func TempRoot() string {
+	if d := strings.TrimSpace(os.Getenv("OCR_TMPDIR")); d != "" {
+		return d
+	}
+	return os.TempDir()
+}
+
+// workDir is the one directory an extraction writes its intermediate images
+// to; Close removes it with everything in it.
+type workDir struct {
+	dir string
+}
+
+func newWorkDir() (*workDir, error) {
+	root := TempRoot()
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(root, workDirPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &workDir{dir: dir}, nil
+}
+
+// file returns the path of a new empty file in w named after pattern (as in
+// os.CreateTemp).
+func (w *workDir) file(pattern string) (string, error) {
+	f, err := os.CreateTemp(w.dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// Close removes the directory.
+func (w *workDir) Close() {
+	_ = os.RemoveAll(w.dir)
+}
+
+// legacyPatterns are the loose temporary files of versions before working
+// directories, which a crash may have left in the system temporary directory.
+var legacyPatterns = []string{"ocr-*.png", "ocr-crop-*"}
+
+// SweepStale removes the working directories under TempRoot, and the loose
+// files of older versions in the system temporary directory, last modified
+// more than maxAge ago. Run it at startup: the age keeps it off the
+// extractions of other processes sharing the directory. It returns how many
+// entries it removed.
+func SweepStale(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	var candidates []string
+	entries, err := os.ReadDir(TempRoot())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), workDirPrefix) {
+			candidates = append(candidates, filepath.Join(TempRoot(), e.Name()))
+		}
+	}
+	for _, p := range legacyPatterns {
+		m, _ := filepath.Glob(filepath.Join(os.TempDir(), p))
+		candidates = append(candidates, m...)
+	}
+	removed := 0
+	var errs []error
+	for _, p := range candidates {
+		fi, err := os.Lstat(p)
+		if err != nil || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
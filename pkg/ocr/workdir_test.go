@@ -0,0 +1,67 @@
+package ocr
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestWorkDirAndSweep(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("OCR_TMPDIR", filepath.Join(root, "ocr"))
+	t.Setenv("TMPDIR", root)
+
+	img := filepath.Join(root, "struk.png")
+	if err := imaging.Save(receiptLike(400, 300, 235, 20), img); err != nil {
+		t.Fatal(err)
+	}
+	crop, err := CropFile(img, image.Rect(0, 0, 200, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(crop)
+	if filepath.Dir(dir) != TempRoot() || filepath.Base(crop) != "struk.png" {
+		t.Fatalf("crop at %s", crop)
+	}
+
+	old := time.Now().Add(-2 * StaleAfter)
+	stale, err := newWorkDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stale.file("base-*.png"); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(root, "ocr-base-123.png")
+	other := filepath.Join(root, "unrelated.png")
+	for _, p := range []string{legacy, other} {
+		if err := os.WriteFile(p, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{stale.dir, legacy, other} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := SweepStale(StaleAfter)
+	if err != nil || n != 2 {
+		t.Fatalf("swept %d: %v", n, err)
+	}
+	for _, p := range []string{stale.dir, legacy} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("%s left: %v", p, err)
+		}
+	}
+	// the fresh crop directory and other programs' files stay
+	for _, p := range []string{crop, other} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s removed: %v", p, err)
+		}
+	}
+}
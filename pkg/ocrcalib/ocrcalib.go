@@ -0,0 +1,128 @@
+// Package ocrcalib learns the OCR confidence calibration from the amounts
+// users confirmed. Each first confirmation of a catatan read from a receipt
+// is recorded in the audit log (ReviewAction) with the heuristic and raw
+// confidence of the extraction and whether the amount was corrected; ocr.Fit
+// turns those reviews into an ocr.Calibration, stored in the settings table
+// so the API and the watcher share it.
+package ocrcalib
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"be03/models"
+	"be03/pkg/ocr"
+
+	"gorm.io/gorm"
+)
+
+// ReviewAction is the audit action of a reviewed extraction.
+const ReviewAction = "catatan.ocr_reviewed"
+
+const settingKey = "ocr_calibration"
+
+// Review is the audit detail of ReviewAction.
+type Review struct {
+	CatatanID     uint    `json:"catatan_id"`
+	UploadID      uint    `json:"upload_id"`
+	Heuristic     string  `json:"heuristic"`
+	RawConfidence float64 `json:"raw_confidence"`
+	OCRAmount     int64   `json:"ocr_amount"`
+	Amount        int64   `json:"amount"`
+	Corrected     bool    `json:"corrected"`
+}
+
+// Samples reads the reviews recorded since (all of them when nil). Entries
+// whose detail does not parse, e.g. truncated, are skipped.
+func Samples(gdb *gorm.DB, since *time.Time) ([]ocr.Sample, error) {
+	q := gdb.Model(&models.AuditLog{}).Where("action = ?", ReviewAction)
+	if since != nil {
+		q = q.Where("created_at >= ?", *since)
+	}
+	var details []string
+	if err := q.Order("id").Pluck("detail", &details).Error; err != nil {
+		return nil, err
+	}
+	samples := make([]ocr.Sample, 0, len(details))
+	for _, d := range details {
+		var r Review
+		if json.Unmarshal([]byte(d), &r) != nil || r.Heuristic == "" {
+			continue
+		}
+		samples = append(samples, ocr.Sample{Heuristic: r.Heuristic, Confidence: r.RawConfidence, Correct: !r.Corrected})
+	}
+	return samples, nil
+}
+
+// Load reads the stored calibration; nil without one.
+func Load(gdb *gorm.DB) (*ocr.Calibration, error) {
+	var s models.Setting
+	err := gdb.Where("key = ?", settingKey).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c ocr.Calibration
+	if err := json.Unmarshal([]byte(s.Value), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save stores c for every process; nil removes the stored calibration.
+func Save(gdb *gorm.DB, c *ocr.Calibration) error {
+	if c == nil {
+		return gdb.Where("key = ?", settingKey).Delete(&models.Setting{}).Error
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return gdb.Save(&models.Setting{Key: settingKey, Value: string(b)}).Error
+}
+
+// Watch installs the stored calibration now, and again every interval in the
+// background, so a refit by another process is picked up.
+func Watch(gdb *gorm.DB, interval time.Duration) {
+	refresh(gdb)
+	go func() {
+		for {
+			time.Sleep(interval)
+			refresh(gdb)
+		}
+	}()
+}
+
+var installed struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+// refresh installs the stored calibration when it changed; read errors keep
+// the installed one.
+func refresh(gdb *gorm.DB) {
+	c, err := Load(gdb)
+	if err != nil {
+		log.Printf("ocr calibration: %v", err)
+		return
+	}
+	installed.mu.Lock()
+	defer installed.mu.Unlock()
+	var at time.Time
+	if c != nil {
+		at = c.FittedAt
+	}
+	if at.Equal(installed.at) && (c == nil) == (ocr.CurrentCalibration() == nil) {
+		return
+	}
+	installed.at = at
+	ocr.SetCalibration(c)
+	if c != nil {
+		log.Printf("ocr calibration: installed fit of %s (%d reviews)", c.FittedAt.Format(time.RFC3339), c.Samples)
+	}
+}
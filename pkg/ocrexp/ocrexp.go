@@ -0,0 +1,330 @@
+// Package ocrexp runs OCR experiments in shadow mode. An experiment names a
+// candidate pipeline configuration (ocr.Options) and the percentage of
+// receipts it reads as well: the production reading is applied as always,
+// the candidate's is only recorded next to it (models.OCRShadowRun), so a
+// heuristic change can be judged on live traffic — how often it agrees, and
+// who was right where the user confirmed the amount — before Promote makes
+// it the production configuration. Experiments and the promoted options are
+// settings rows shared by the API servers and the watcher.
+package ocrexp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"be03/models"
+	"be03/pkg/ocr"
+
+	"gorm.io/gorm"
+)
+
+const (
+	experimentKey = "ocr_experiment"
+	optionsKey    = "ocr_options"
+)
+
+// Experiment is the running shadow experiment.
+type Experiment struct {
+	Name      string      `json:"name"`
+	Percent   int         `json:"percent"` // of receipts, by file name
+	Candidate ocr.Options `json:"candidate"`
+	StartedAt time.Time   `json:"started_at"`
+	By        string      `json:"by,omitempty"`
+}
+
+// ErrInvalid wraps the validation errors of Start.
+var ErrInvalid = errors.New("invalid experiment")
+
+var nameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Load reads the running experiment; nil when none runs.
+func Load(gdb *gorm.DB) (*Experiment, error) {
+	var e Experiment
+	ok, err := loadSetting(gdb, experimentKey, &e)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Start validates e and makes it the running experiment, replacing any other;
+// the runs of earlier experiments are kept under their names.
+func Start(gdb *gorm.DB, e Experiment) (*Experiment, error) {
+	if !nameRE.MatchString(e.Name) {
+		return nil, fmt.Errorf("%w: name must be 1-64 lower-case letters, digits, '.', '_' or '-'", ErrInvalid)
+	}
+	if e.Percent < 1 || e.Percent > 100 {
+		return nil, fmt.Errorf("%w: percent must be between 1 and 100", ErrInvalid)
+	}
+	if err := e.Candidate.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	e.StartedAt = time.Now().UTC()
+	if err := saveSetting(gdb, experimentKey, e); err != nil {
+		return nil, err
+	}
+	cache.invalidate()
+	return &e, nil
+}
+
+// Stop ends the running experiment; its runs are kept.
+func Stop(gdb *gorm.DB) error {
+	err := gdb.Where("key = ?", experimentKey).Delete(&models.Setting{}).Error
+	cache.invalidate()
+	return err
+}
+
+// ErrNoExperiment is returned by Promote when no experiment runs.
+var ErrNoExperiment = errors.New("no OCR experiment is running")
+
+// Promote makes the candidate of the running experiment the production
+// configuration, installs it in this process and stops the experiment.
+func Promote(gdb *gorm.DB) (*Experiment, error) {
+	e, err := Load(gdb)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrNoExperiment
+	}
+	err = gdb.Transaction(func(tx *gorm.DB) error {
+		if err := saveSetting(tx, optionsKey, e.Candidate); err != nil {
+			return err
+		}
+		return tx.Where("key = ?", experimentKey).Delete(&models.Setting{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	cache.invalidate()
+	ocr.SetOptions(e.Candidate)
+	return e, nil
+}
+
+// LoadOptions reads the production configuration; the zero Options before
+// any promotion.
+func LoadOptions(gdb *gorm.DB) (ocr.Options, error) {
+	var o ocr.Options
+	_, err := loadSetting(gdb, optionsKey, &o)
+	return o, err
+}
+
+// Watch installs the promoted options now, and again every interval in the
+// background, so a promotion by another process is picked up.
+func Watch(gdb *gorm.DB, interval time.Duration) {
+	install := func() {
+		o, err := LoadOptions(gdb)
+		if err != nil {
+			log.Printf("ocr options: %v", err)
+			return
+		}
+		if o != ocr.CurrentOptions() {
+			ocr.SetOptions(o)
+			log.Printf("ocr options: installed %+v", o)
+		}
+	}
+	install()
+	go func() {
+		for {
+			time.Sleep(interval)
+			install()
+		}
+	}()
+}
+
+func loadSetting(gdb *gorm.DB, key string, v any) (bool, error) {
+	var s models.Setting
+	err := gdb.Where("key = ?", key).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(s.Value), v)
+}
+
+func saveSetting(gdb *gorm.DB, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return gdb.Save(&models.Setting{Key: key, Value: string(b)}).Error
+}
+
+// Sampled reports whether e reads the receipt stored as name. It is stable,
+// so a receipt read again is shadowed again, and differs between
+// experiments.
+func (e *Experiment) Sampled(name string) bool {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%s", e.Name, filepath.Base(name))
+	return int(h.Sum32()%100) < e.Percent
+}
+
+// NewCandidate returns the engine reading receipts with a candidate
+// configuration; tests swap in a fake.
+var NewCandidate = func(o ocr.Options) ocr.Engine { return ocr.TesseractEngine{Options: &o} }
+
+// shadowSlots bounds the candidate readings in flight: one, so the shadow
+// never takes more than a core from the production pipeline. Receipts
+// arriving while it is busy are not shadowed (counted as skipped).
+var shadowSlots = make(chan struct{}, 1)
+
+var (
+	running  sync.WaitGroup
+	counters struct{ runs, skipped, failed atomic.Int64 }
+)
+
+// Stats counts the shadow readings of this process.
+type Stats struct {
+	Runs    int64 `json:"runs"`
+	Skipped int64 `json:"skipped"` // sampled while a reading was in flight
+	Failed  int64 `json:"failed"`  // the candidate errored
+}
+
+// CurrentStats returns the counters so far.
+func CurrentStats() Stats {
+	return Stats{Runs: counters.runs.Load(), Skipped: counters.skipped.Load(), Failed: counters.failed.Load()}
+}
+
+// Shadow reads the receipt at path with the candidate of the running
+// experiment, when it samples the receipt, and records the reading next to
+// primary, the one applied (nil when none was found). It returns at once:
+// the file is copied, since the watcher moves it on, and read in the
+// background.
+func Shadow(gdb *gorm.DB, path string, primary *ocr.Result) {
+	e := Current(gdb, 10*time.Second)
+	if e == nil || !e.Sampled(path) {
+		return
+	}
+	select {
+	case shadowSlots <- struct{}{}:
+	default:
+		counters.skipped.Add(1)
+		return
+	}
+	run := models.OCRShadowRun{Experiment: e.Name, FileName: filepath.Base(path)}
+	if id, ok := profileOf(run.FileName); ok {
+		run.ProfileID = &id
+	}
+	if primary != nil {
+		run.PrimaryAmount, run.PrimaryConfidence = primary.Amount, primary.Confidence
+	}
+	// a be03-ocr- directory, so ocr.SweepStale removes it should we crash
+	dir, err := os.MkdirTemp(ocr.TempRoot(), "be03-ocr-shadow-*")
+	if err == nil {
+		err = copyFile(path, filepath.Join(dir, run.FileName))
+	}
+	if err != nil {
+		<-shadowSlots
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+		log.Printf("ocr shadow %s: copy %s: %v", e.Name, run.FileName, err)
+		return
+	}
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		defer func() { <-shadowSlots }()
+		defer os.RemoveAll(dir)
+		start := time.Now()
+		res, err := NewCandidate(e.Candidate).Extract(filepath.Join(dir, run.FileName))
+		run.CandidateMillis = time.Since(start).Milliseconds()
+		if err != nil && !errors.Is(err, ocr.ErrNoAmount) {
+			counters.failed.Add(1)
+			run.CandidateError = truncate(err.Error(), 255)
+		} else if res != nil {
+			run.CandidateAmount, run.CandidateConfidence, run.CandidateHeuristic = res.Amount, res.Confidence, res.Heuristic
+		}
+		run.Agree = run.CandidateError == "" && run.CandidateAmount == run.PrimaryAmount
+		counters.runs.Add(1)
+		if err := gdb.Create(&run).Error; err != nil {
+			log.Printf("ocr shadow %s: record %s: %v", e.Name, run.FileName, err)
+		}
+	}()
+}
+
+// Wait blocks until the shadow readings in flight are recorded.
+func Wait() { running.Wait() }
+
+// profileOf reads the profile id of a disk name (see storagepath.DiskName).
+func profileOf(name string) (uint, bool) {
+	prefix, _, ok := strings.Cut(name, "_")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(prefix, 10, 32)
+	return uint(id), err == nil && id > 0
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Current returns the running experiment, re-reading the database at most
+// every ttl so the per-receipt check stays cheap. Read errors keep the last
+// known experiment.
+func Current(gdb *gorm.DB, ttl time.Duration) *Experiment {
+	return cache.get(gdb, ttl)
+}
+
+var cache experimentCache
+
+type experimentCache struct {
+	mu  sync.Mutex
+	exp *Experiment
+	db  *gorm.DB
+	at  time.Time
+}
+
+func (c *experimentCache) get(gdb *gorm.DB, ttl time.Duration) *Experiment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == gdb && !c.at.IsZero() && time.Since(c.at) < ttl {
+		return c.exp
+	}
+	if e, err := Load(gdb); err == nil {
+		c.exp = e
+	}
+	c.db, c.at = gdb, time.Now()
+	return c.exp
+}
+
+func (c *experimentCache) invalidate() {
+	c.mu.Lock()
+	c.at = time.Time{}
+	c.mu.Unlock()
+}
@@ -0,0 +1,61 @@
+package ocrexp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"be03/pkg/ocr"
+	"be03/pkg/testenv"
+)
+
+func TestSampled(t *testing.T) {
+	e := &Experiment{Name: "mp4", Percent: 25}
+	in := 0
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("public/keu/3_IMG_%04d.jpg", i)
+		if e.Sampled(name) {
+			in++
+		}
+		if e.Sampled(name) != e.Sampled(fmt.Sprintf("public/processed/3_IMG_%04d.jpg", i)) {
+			t.Fatal("sampling depends on the directory")
+		}
+	}
+	if in < 200 || in > 300 {
+		t.Fatalf("25%% experiment sampled %d of 1000 receipts", in)
+	}
+}
+
+func TestStartPromote(t *testing.T) {
+	defer ocr.SetOptions(ocr.Options{})
+	gdb := testenv.OpenDB(t)
+	if _, err := Start(gdb, Experiment{Name: "mp4", Percent: 101}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("percent 101: %v", err)
+	}
+	if _, err := Promote(gdb); !errors.Is(err, ErrNoExperiment) {
+		t.Fatalf("promote without experiment: %v", err)
+	}
+	if _, err := Start(gdb, Experiment{Name: "mp4", Percent: 10, Candidate: ocr.Options{MaxMegapixels: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if e := Current(gdb, 0); e == nil || e.Name != "mp4" || e.StartedAt.IsZero() {
+		t.Fatalf("current %+v", e)
+	}
+	if _, err := Promote(gdb); err != nil {
+		t.Fatal(err)
+	}
+	if e := Current(gdb, 0); e != nil {
+		t.Fatalf("experiment still running after promotion: %+v", e)
+	}
+	if o, err := LoadOptions(gdb); err != nil || o.MaxMegapixels != 4 || ocr.CurrentOptions() != o {
+		t.Fatalf("options %+v %v", o, err)
+	}
+}
+
+func TestProfileOf(t *testing.T) {
+	for name, want := range map[string]uint{"12_struk.jpg": 12, "struk.jpg": 0, "x_struk.jpg": 0, "0_a.jpg": 0} {
+		if got, _ := profileOf(name); got != want {
+			t.Errorf("profileOf(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ocrexp
+
+import (
+	"be03/models"
+	"be03/pkg/storagepath"
+
+	"gorm.io/gorm"
+)
+
+// Summary compares the two readings of an experiment's receipts.
+type Summary struct {
+	Experiment string `json:"experiment"`
+	Runs       int64  `json:"runs"`
+	Agree      int64  `json:"agree"`
+	Disagree   int64  `json:"disagree"`
+	// PrimaryOnly counts receipts only production read an amount from,
+	// CandidateOnly those only the candidate did; CandidateFailed those the
+	// candidate errored on.
+	PrimaryOnly     int64   `json:"primary_only"`
+	CandidateOnly   int64   `json:"candidate_only"`
+	CandidateFailed int64   `json:"candidate_failed"`
+	AgreementRate   float64 `json:"agreement_rate"`
+	AvgCandidateMs  float64 `json:"avg_candidate_ms"`
+	// Reviewed counts the receipts whose amount the user has confirmed since;
+	// PrimaryCorrect and CandidateCorrect how many of them each reading got
+	// right, the figures a promotion should rest on.
+	Reviewed         int64 `json:"reviewed"`
+	PrimaryCorrect   int64 `json:"primary_correct"`
+	CandidateCorrect int64 `json:"candidate_correct"`
+	// RecentDisagreements are the latest runs the readings differ on.
+	RecentDisagreements []models.OCRShadowRun `json:"recent_disagreements"`
+}
+
+// recentDisagreements caps Summary.RecentDisagreements.
+const recentDisagreements = 20
+
+// Summarize compares the readings recorded for the experiment name. A run
+// counts as reviewed when its upload's catatan has been confirmed.
+func Summarize(gdb *gorm.DB, name string) (Summary, error) {
+	s := Summary{Experiment: name, RecentDisagreements: []models.OCRShadowRun{}}
+	var rows []struct {
+		models.OCRShadowRun
+		ConfirmedAmount *int64
+	}
+	err := gdb.Table("ocr_shadow_runs").
+		Select("ocr_shadow_runs.*, catatan_keuangans.amount AS confirmed_amount").
+		Joins("LEFT JOIN uploads ON uploads.profile_id = ocr_shadow_runs.profile_id AND uploads.store_path = ? || ocr_shadow_runs.file_name", storagepath.Pending+"/").
+		Joins("LEFT JOIN catatan_keuangans ON catatan_keuangans.id = uploads.keuangan_id AND catatan_keuangans.confirmed_at IS NOT NULL").
+		Where("ocr_shadow_runs.experiment = ?", name).
+		Order("ocr_shadow_runs.id desc").Scan(&rows).Error
+	if err != nil {
+		return s, err
+	}
+	var millis int64
+	for _, r := range rows {
+		s.Runs++
+		millis += r.CandidateMillis
+		switch {
+		case r.CandidateError != "":
+			s.CandidateFailed++
+		case r.PrimaryAmount > 0 && r.CandidateAmount <= 0:
+			s.PrimaryOnly++
+		case r.PrimaryAmount <= 0 && r.CandidateAmount > 0:
+			s.CandidateOnly++
+		}
+		if r.Agree {
+			s.Agree++
+		} else {
+			s.Disagree++
+			if len(s.RecentDisagreements) < recentDisagreements {
+				s.RecentDisagreements = append(s.RecentDisagreements, r.OCRShadowRun)
+			}
+		}
+		if r.ConfirmedAmount != nil {
+			s.Reviewed++
+			if r.PrimaryAmount == *r.ConfirmedAmount {
+				s.PrimaryCorrect++
+			}
+			if r.CandidateError == "" && r.CandidateAmount == *r.ConfirmedAmount {
+				s.CandidateCorrect++
+			}
+		}
+	}
+	if s.Runs > 0 {
+		s.AgreementRate = float64(s.Agree) / float64(s.Runs)
+		s.AvgCandidateMs = float64(millis) / float64(s.Runs)
+	}
+	return s, nil
+}
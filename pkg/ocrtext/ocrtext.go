@@ -0,0 +1,107 @@
+// Package ocrtext stores the OCR text of uploads compressed in
+// upload_ocr_texts, and the line items read from it in upload_items.
+package ocrtext
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/ocr"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxLength caps the stored text; longer text is truncated.
+const MaxLength = 64 << 10
+
+// Save stores text for uploadID, replacing an earlier run. Empty text is not stored.
+func Save(gdb *gorm.DB, uploadID uint, text string) error {
+	if uploadID == 0 || text == "" {
+		return nil
+	}
+	if len(text) > MaxLength {
+		text = strings.ToValidUTF8(text[:MaxLength], "")
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(text)); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	row := models.UploadOCRText{UploadID: uploadID, Text: buf.Bytes(), Length: len(text)}
+	return gdb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "upload_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"text", "length", "updated_at"}),
+	}).Create(&row).Error
+}
+
+// Load returns the stored text of uploadID; gorm.ErrRecordNotFound when OCR
+// never ran (or ran before texts were kept).
+func Load(gdb *gorm.DB, uploadID uint) (string, error) {
+	var row models.UploadOCRText
+	if err := gdb.Where("upload_id = ?", uploadID).First(&row).Error; err != nil {
+		return "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(row.Text))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	return string(b), err
+}
+
+// SaveResult stores the text of res for uploadID and, when OCR_ITEMIZED is
+// "store", its line items.
+func SaveResult(gdb *gorm.DB, uploadID uint, res *ocr.Result) error {
+	if err := Save(gdb, uploadID, res.Text); err != nil {
+		return err
+	}
+	if ocr.ItemizedMode() != ocr.ItemizedStore {
+		return nil
+	}
+	return SaveItems(gdb, uploadID, res.Items)
+}
+
+// SaveItems replaces the line items stored for uploadID.
+func SaveItems(gdb *gorm.DB, uploadID uint, items []ocr.LineItem) error {
+	if uploadID == 0 {
+		return nil
+	}
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", uploadID).Delete(&models.UploadItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		rows := make([]models.UploadItem, len(items))
+		for i, it := range items {
+			name := it.Name
+			if len(name) > 255 {
+				name = strings.ToValidUTF8(name[:255], "")
+			}
+			rows[i] = models.UploadItem{UploadID: uploadID, Line: i + 1, Name: name, Qty: it.Qty, UnitPrice: it.UnitPrice, Price: it.Price}
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// LoadItems returns the line items stored for uploadID in receipt order.
+func LoadItems(gdb *gorm.DB, uploadID uint) ([]ocr.LineItem, error) {
+	var rows []models.UploadItem
+	if err := gdb.Where("upload_id = ?", uploadID).Order("line").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	items := make([]ocr.LineItem, len(rows))
+	for i, r := range rows {
+		items[i] = ocr.LineItem{Name: r.Name, Qty: r.Qty, UnitPrice: r.UnitPrice, Price: r.Price}
+	}
+	return items, nil
+}
@@ -0,0 +1,54 @@
+package ocrtext
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"be03/pkg/ocr"
+	"be03/pkg/testenv"
+
+	"gorm.io/gorm"
+)
+
+func TestSaveLoad(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	if _, err := Load(gdb, 7); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("missing text: %v", err)
+	}
+	if err := Save(gdb, 7, "TRANSFER BERHASIL Rp 125.000"); err != nil {
+		t.Fatal(err)
+	}
+	// a reprocess replaces the text
+	long := strings.Repeat("TOTAL Rp 250.000 ", 5000)
+	if err := Save(gdb, 7, long); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(gdb, 7)
+	if err != nil || got != strings.ToValidUTF8(long[:MaxLength], "") {
+		t.Fatalf("load: %d bytes, err=%v", len(got), err)
+	}
+}
+
+func TestSaveResultItems(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	t.Cleanup(func() { ocr.SetItemizedMode(ocr.ItemizedOff) })
+	res := &ocr.Result{Text: "Es Teh 5.000\nTOTAL 5.000", Items: []ocr.LineItem{{Name: "Es Teh", Qty: 1, UnitPrice: 5000, Price: 5000}}}
+
+	ocr.SetItemizedMode(ocr.ItemizedOn)
+	if err := SaveResult(gdb, 3, res); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := LoadItems(gdb, 3); err != nil || len(items) != 0 {
+		t.Fatalf("items kept without store: %+v %v", items, err)
+	}
+	ocr.SetItemizedMode(ocr.ItemizedStore)
+	for i := 0; i < 2; i++ { // a reprocess replaces the items
+		if err := SaveResult(gdb, 3, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items, err := LoadItems(gdb, 3); err != nil || len(items) != 1 || items[0] != res.Items[0] {
+		t.Fatalf("items: %+v %v", items, err)
+	}
+}
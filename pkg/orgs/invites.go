@@ -0,0 +1,72 @@
+package orgs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInviteInvalid means an invite token is unknown, expired or already used.
+var ErrInviteInvalid = errors.New("invite is invalid or has expired")
+
+// NewInviteToken returns a random invite token and the hash stored for it.
+func NewInviteToken() (raw, hash string) {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	raw = hex.EncodeToString(b)
+	return raw, HashToken(raw)
+}
+
+// HashToken is the stored form of an invite token.
+func HashToken(raw string) string {
+	h := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(h[:])
+}
+
+// FindInvite returns the pending invite for raw, or ErrInviteInvalid.
+func FindInvite(gdb *gorm.DB, raw string, now time.Time) (models.OrgInvite, error) {
+	var inv models.OrgInvite
+	err := gdb.Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", HashToken(raw), now.UTC()).First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return inv, ErrInviteInvalid
+	}
+	return inv, err
+}
+
+// Accept marks inv used by userID and adds the user to the organization with
+// the invited role. A user who is already a member keeps their role. An invite
+// addressed to another account is ErrInviteInvalid.
+func Accept(gdb *gorm.DB, inv models.OrgInvite, userID uint, now time.Time) (models.OrgMembership, error) {
+	var m models.OrgMembership
+	if inv.UserID != nil && *inv.UserID != userID {
+		return m, ErrInviteInvalid
+	}
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		// the conditional update makes concurrent accepts of one token race safely
+		res := tx.Model(&models.OrgInvite{}).Where("id = ? AND accepted_at IS NULL", inv.ID).
+			Updates(map[string]any{"accepted_at": now, "accepted_by": userID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInviteInvalid
+		}
+		existing, err := Membership(tx, inv.OrgID, userID)
+		if err == nil {
+			m = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		m = models.OrgMembership{OrgID: inv.OrgID, UserID: userID, Role: inv.Role}
+		return tx.Create(&m).Error
+	})
+	return m, err
+}
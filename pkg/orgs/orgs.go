@@ -0,0 +1,120 @@
+// Package orgs holds the organization roles and the roll-up of members'
+// catatan into org-level summaries.
+package orgs
+
+import (
+	"sort"
+	"time"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+
+	"gorm.io/gorm"
+)
+
+// Membership roles. Owners manage the organization; owners and accountants
+// see every member's catatan; members see the totals only.
+const (
+	Owner      = "owner"
+	Accountant = "accountant"
+	Member     = "member"
+)
+
+// ValidRole reports whether r is a membership role.
+func ValidRole(r string) bool { return r == Owner || r == Accountant || r == Member }
+
+// CanViewAll reports whether role may read and export every member's catatan.
+func CanViewAll(role string) bool { return role == Owner || role == Accountant }
+
+// Membership returns userID's membership of orgID, or gorm.ErrRecordNotFound.
+func Membership(gdb *gorm.DB, orgID, userID uint) (models.OrgMembership, error) {
+	var m models.OrgMembership
+	err := gdb.Where("org_id = ? AND user_id = ?", orgID, userID).First(&m).Error
+	return m, err
+}
+
+// MemberIDs returns the user ids of every member of orgID.
+func MemberIDs(gdb *gorm.DB, orgID uint) ([]uint, error) {
+	var ids []uint
+	err := gdb.Model(&models.OrgMembership{}).Where("org_id = ?", orgID).Order("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// MonthTotal is the total of one calendar month (YYYY-MM).
+type MonthTotal struct {
+	Month string `json:"month"`
+	Total int64  `json:"total"`
+	Count int64  `json:"count"`
+}
+
+// MemberTotal is one member's share of a summary.
+type MemberTotal struct {
+	UserID uint  `json:"user_id"`
+	Total  int64 `json:"total"`
+	Count  int64 `json:"count"`
+}
+
+// Summary is the roll-up of the members' catatan.
+type Summary struct {
+	Total    int64         `json:"total"`
+	Count    int64         `json:"count"`
+	ByMonth  []MonthTotal  `json:"by_month"`
+	ByMember []MemberTotal `json:"by_member"`
+}
+
+// Summarize totals the catatan of userIDs dated in [from, to) (either bound
+// may be nil), archived ones included; pending ones and split ones (their
+// line items count instead) are left out. Months are calendar months in loc,
+// oldest first.
+func Summarize(gdb *gorm.DB, userIDs []uint, from, to *time.Time, loc *time.Location) (Summary, error) {
+	s := Summary{ByMonth: []MonthTotal{}, ByMember: []MemberTotal{}}
+	if len(userIDs) == 0 {
+		return s, nil
+	}
+	q := catatanarchive.Catatan(gdb, from).Select("user_id, amount, date").
+		Where("user_id IN ? AND pending = ? AND split = ?", userIDs, false, false)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	var rows []struct {
+		UserID uint
+		Amount int64
+		Date   time.Time
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		return s, err
+	}
+	// bucketed here rather than in SQL so months follow loc on every driver
+	months := map[string]*MonthTotal{}
+	members := map[uint]*MemberTotal{}
+	for _, r := range rows {
+		s.Total += r.Amount
+		s.Count++
+		key := r.Date.In(loc).Format("2006-01")
+		if months[key] == nil {
+			months[key] = &MonthTotal{Month: key}
+		}
+		months[key].Total += r.Amount
+		months[key].Count++
+		if members[r.UserID] == nil {
+			members[r.UserID] = &MemberTotal{UserID: r.UserID}
+		}
+		members[r.UserID].Total += r.Amount
+		members[r.UserID].Count++
+	}
+	for _, m := range months {
+		s.ByMonth = append(s.ByMonth, *m)
+	}
+	sort.Slice(s.ByMonth, func(i, j int) bool { return s.ByMonth[i].Month < s.ByMonth[j].Month })
+	for _, id := range userIDs {
+		if m := members[id]; m != nil {
+			s.ByMember = append(s.ByMember, *m)
+		} else {
+			s.ByMember = append(s.ByMember, MemberTotal{UserID: id})
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,140 @@
+package orgs
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestSummarize(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "ani", Password: "secret1"}, {Username: "budi", Password: "secret2"}, {Username: "cici", Password: "secret3"}},
+		Catatan: []fixtures.Catatan{
+			{User: "ani", FileName: "a.jpg", Amount: 10000, Date: "2025-01-10"},
+			// 23:30 UTC on Jan 31 is already February in Jakarta
+			{User: "budi", FileName: "b.jpg", Amount: 5000, Date: "2025-01-31T23:30:00Z"},
+			{User: "budi", FileName: "p.jpg", Amount: 7000, Date: "2025-01-12"},
+			{User: "cici", FileName: "c.jpg", Amount: 99999, Date: "2025-01-12"},
+		},
+	})
+	ids := map[string]uint{}
+	for _, name := range []string{"ani", "budi"} {
+		var u models.User
+		gdb.Where("username = ?", name).First(&u)
+		ids[name] = u.ID
+	}
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "p.jpg").Update("pending", true)
+
+	jkt := time.FixedZone("WIB", 7*3600)
+	s, err := Summarize(gdb, []uint{ids["ani"], ids["budi"]}, nil, nil, jkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 15000 || s.Count != 2 {
+		t.Fatalf("totals: %+v", s)
+	}
+	if len(s.ByMonth) != 2 || s.ByMonth[0] != (MonthTotal{"2025-01", 10000, 1}) || s.ByMonth[1] != (MonthTotal{"2025-02", 5000, 1}) {
+		t.Fatalf("by month: %+v", s.ByMonth)
+	}
+	if len(s.ByMember) != 2 || s.ByMember[1] != (MemberTotal{ids["budi"], 5000, 1}) {
+		t.Fatalf("by member: %+v", s.ByMember)
+	}
+
+	if s, err = Summarize(gdb, nil, nil, nil, jkt); err != nil || s.Count != 0 {
+		t.Fatalf("empty org: %+v, %v", s, err)
+	}
+}
+
+func TestAcceptInvite(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "ani", Password: "secret1"}}})
+	var ani models.User
+	gdb.Where("username = ?", "ani").First(&ani)
+	org := models.Organization{Name: "Toko"}
+	gdb.Create(&org)
+	now := time.Now()
+	raw, hash := NewInviteToken()
+	gdb.Create(&models.OrgInvite{OrgID: org.ID, Email: "ani@example.com", Role: Accountant, TokenHash: hash, ExpiresAt: now.Add(time.Hour)})
+
+	if _, err := FindInvite(gdb, raw, now.Add(2*time.Hour)); err != ErrInviteInvalid {
+		t.Fatalf("expired invite: %v", err)
+	}
+	inv, err := FindInvite(gdb, raw, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Accept(gdb, inv, ani.ID, now)
+	if err != nil || m.Role != Accountant || m.UserID != ani.ID {
+		t.Fatalf("accept: %+v, %v", m, err)
+	}
+	if _, err := Accept(gdb, inv, ani.ID, now); err != ErrInviteInvalid {
+		t.Fatalf("second accept: %v", err)
+	}
+	if _, err := FindInvite(gdb, raw, now); err != ErrInviteInvalid {
+		t.Fatalf("used invite: %v", err)
+	}
+
+	// an invite addressed to another account is no use to ani
+	other := ani.ID + 1
+	_, hash = NewInviteToken()
+	inv = models.OrgInvite{OrgID: org.ID, Role: Member, TokenHash: hash, UserID: &other, ExpiresAt: now.Add(time.Hour)}
+	gdb.Create(&inv)
+	if _, err := Accept(gdb, inv, ani.ID, now); err != ErrInviteInvalid {
+		t.Fatalf("accepting another account's invite: %v", err)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users:   []fixtures.User{{Username: "ani", Password: "secret1"}, {Username: "budi", Password: "secret2"}},
+		Uploads: []fixtures.Upload{{User: "ani", FileName: "a.jpg"}, {User: "budi", FileName: "b.jpg"}},
+	})
+	ids := map[string]uint{}
+	for _, name := range []string{"ani", "budi"} {
+		var u models.User
+		gdb.Where("username = ?", name).First(&u)
+		ids[name] = u.ID
+	}
+	gdb.Model(&models.Upload{}).Where("1 = 1").Update("size_bytes", 400)
+	org := models.Organization{Name: "Toko", StorageQuotaBytes: 1000, MonthlyOCRQuota: 3}
+	gdb.Create(&org)
+	gdb.Create(&models.OrgMembership{OrgID: org.ID, UserID: ids["ani"], Role: Owner})
+	gdb.Create(&models.OrgMembership{OrgID: org.ID, UserID: ids["budi"], Role: Member})
+	now := time.Now()
+
+	u, err := UsageOf(gdb, org, now)
+	if err != nil || u.StorageBytes != 800 || u.OCRJobs != 2 || len(u.Warnings) != 1 || u.Warnings[0] != ResourceStorage {
+		t.Fatalf("usage: %+v, %v", u, err)
+	}
+	if err := CheckQuota(gdb, ids["budi"], 150, now); err != nil {
+		t.Fatalf("upload within quota: %v", err)
+	}
+	qe, ok := IsQuotaError(CheckQuota(gdb, ids["budi"], 300, now))
+	if !ok || qe.Resource != ResourceStorage || qe.OrgID != org.ID {
+		t.Fatalf("storage over quota: %+v", qe)
+	}
+
+	WarnNearLimit(gdb, ids["budi"], now)
+	WarnNearLimit(gdb, ids["budi"], now)
+	var warned int64
+	gdb.Model(&models.Notification{}).Where("user_id = ? AND kind = ?", ids["ani"], "org_quota").Count(&warned)
+	if warned != 1 {
+		t.Fatalf("owner warnings: %d", warned)
+	}
+	var others int64
+	gdb.Model(&models.Notification{}).Where("user_id = ?", ids["budi"]).Count(&others)
+	if others != 0 {
+		t.Fatalf("members are not warned: %d", others)
+	}
+
+	gdb.Model(&org).Update("monthly_ocr_quota", 2)
+	if qe, ok := IsQuotaError(CheckQuota(gdb, ids["ani"], 0, now)); !ok || qe.Resource != ResourceOCR {
+		t.Fatalf("ocr over quota: %+v", qe)
+	}
+	// jobs count per calendar month
+	if err := CheckQuota(gdb, ids["ani"], 0, now.AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("next month: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package orgs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"be03/models"
+	"be03/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+// Quota resources.
+const (
+	ResourceStorage = "storage"
+	ResourceOCR     = "ocr"
+)
+
+// WarnShare is the share of a quota at which owners are warned.
+const WarnShare = 0.8
+
+// QuotaError is returned by CheckQuota when an upload would exceed a quota of
+// one of the uploader's organizations.
+type QuotaError struct {
+	OrgID    uint
+	Org      string
+	Resource string
+	Limit    int64
+	Used     int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("organization %q has reached its %s quota (%d of %d)", e.Org, e.Resource, e.Used, e.Limit)
+}
+
+// Usage is an organization's consumption against its quotas. OCR jobs are
+// the members' uploads created in Month.
+type Usage struct {
+	OrgID        uint     `json:"org_id"`
+	StorageBytes int64    `json:"storage_bytes"`
+	StorageQuota int64    `json:"storage_quota_bytes"`
+	Month        string   `json:"month"`
+	OCRJobs      int64    `json:"ocr_jobs"`
+	OCRQuota     int64    `json:"ocr_quota"`
+	Warnings     []string `json:"warnings"` // resources at or above WarnShare of their quota
+}
+
+// monthStart is the first instant of now's calendar month in UTC.
+func monthStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// UsageOf measures org at now.
+func UsageOf(gdb *gorm.DB, org models.Organization, now time.Time) (Usage, error) {
+	u := Usage{OrgID: org.ID, StorageQuota: org.StorageQuotaBytes, OCRQuota: int64(org.MonthlyOCRQuota),
+		Month: now.UTC().Format("2006-01"), Warnings: []string{}}
+	profiles := gdb.Model(&models.Profile{}).Select("profiles.id").
+		Joins("JOIN org_memberships ON org_memberships.user_id = profiles.user_id").
+		Where("org_memberships.org_id = ?", org.ID)
+	if err := gdb.Model(&models.Upload{}).Select("COALESCE(SUM(size_bytes), 0)").
+		Where("profile_id IN (?)", profiles).Scan(&u.StorageBytes).Error; err != nil {
+		return u, err
+	}
+	if err := gdb.Model(&models.Upload{}).Where("profile_id IN (?) AND created_at >= ?", profiles, monthStart(now)).
+		Count(&u.OCRJobs).Error; err != nil {
+		return u, err
+	}
+	if near(u.StorageBytes, u.StorageQuota) {
+		u.Warnings = append(u.Warnings, ResourceStorage)
+	}
+	if near(u.OCRJobs, u.OCRQuota) {
+		u.Warnings = append(u.Warnings, ResourceOCR)
+	}
+	return u, nil
+}
+
+func near(used, limit int64) bool {
+	return limit > 0 && float64(used) >= WarnShare*float64(limit)
+}
+
+// ofUser returns the organizations userID belongs to.
+func ofUser(gdb *gorm.DB, userID uint) ([]models.Organization, error) {
+	var out []models.Organization
+	err := gdb.Joins("JOIN org_memberships ON org_memberships.org_id = organizations.id").
+		Where("org_memberships.user_id = ?", userID).Order("organizations.id").Find(&out).Error
+	return out, err
+}
+
+// CheckQuota reports a *QuotaError when a new upload of size bytes by userID
+// would exceed a quota of any of their organizations; size 0 checks the OCR
+// quota only (a retry of an upload already stored).
+func CheckQuota(gdb *gorm.DB, userID uint, size int64, now time.Time) error {
+	list, err := ofUser(gdb, userID)
+	if err != nil {
+		return err
+	}
+	for _, org := range list {
+		if org.StorageQuotaBytes <= 0 && org.MonthlyOCRQuota <= 0 {
+			continue
+		}
+		u, err := UsageOf(gdb, org, now)
+		if err != nil {
+			return err
+		}
+		if u.OCRQuota > 0 && u.OCRJobs >= u.OCRQuota {
+			return &QuotaError{OrgID: org.ID, Org: org.Name, Resource: ResourceOCR, Limit: u.OCRQuota, Used: u.OCRJobs}
+		}
+		if size > 0 && u.StorageQuota > 0 && u.StorageBytes+size > u.StorageQuota {
+			return &QuotaError{OrgID: org.ID, Org: org.Name, Resource: ResourceStorage, Limit: u.StorageQuota, Used: u.StorageBytes}
+		}
+	}
+	return nil
+}
+
+// IsQuotaError reports whether err is a *QuotaError and returns it.
+func IsQuotaError(err error) (*QuotaError, bool) {
+	var qe *QuotaError
+	ok := errors.As(err, &qe)
+	return qe, ok
+}
+
+// WarnNearLimit notifies the owners of userID's organizations whose usage
+// crossed WarnShare of a quota, once per crossing (storage) or month (OCR).
+// Failures are logged; call it after an upload is stored.
+func WarnNearLimit(gdb *gorm.DB, userID uint, now time.Time) {
+	list, err := ofUser(gdb, userID)
+	if err != nil {
+		log.Printf("org quota warning for user=%d: %v", userID, err)
+		return
+	}
+	for _, org := range list {
+		if org.StorageQuotaBytes <= 0 && org.MonthlyOCRQuota <= 0 {
+			continue
+		}
+		u, err := UsageOf(gdb, org, now)
+		if err != nil {
+			log.Printf("org quota warning for org=%d: %v", org.ID, err)
+			continue
+		}
+		storageNear := near(u.StorageBytes, u.StorageQuota)
+		if storageNear && !org.StorageWarned {
+			warnOwners(gdb, org, ResourceStorage, u.StorageBytes, u.StorageQuota)
+		}
+		if storageNear != org.StorageWarned {
+			gdb.Model(&org).Update("storage_warned", storageNear)
+		}
+		if near(u.OCRJobs, u.OCRQuota) && org.OCRWarnedMonth != u.Month {
+			warnOwners(gdb, org, ResourceOCR, u.OCRJobs, u.OCRQuota)
+			gdb.Model(&org).Update("ocr_warned_month", u.Month)
+		}
+	}
+}
+
+func warnOwners(gdb *gorm.DB, org models.Organization, resource string, used, limit int64) {
+	var owners []uint
+	gdb.Model(&models.OrgMembership{}).Where("org_id = ? AND role = ?", org.ID, Owner).Pluck("user_id", &owners)
+	for _, id := range owners {
+		data := map[string]any{"Org": org.Name, "Resource": resource, "Percent": used * 100 / limit, "Used": used, "Limit": limit}
+		if _, err := notify.Notify(gdb, id, notify.KindOrgQuota, data); err != nil {
+			log.Printf("org quota warning for org=%d owner=%d: %v", org.ID, id, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package periodlock implements monthly closing: once a period is closed the
+// user's catatan dated inside it may no longer be created, edited or deleted.
+package periodlock
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrLocked is returned when a change touches a closed period.
+var ErrLocked = errors.New("accounting period is closed")
+
+// Bounds parses "YYYY-MM" and returns the month as [start, end) in loc.
+func Bounds(period string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", period, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must be YYYY-MM: %w", err)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// Close locks period for userID. Closing an already closed period returns the
+// existing lock and created=false.
+func Close(gdb *gorm.DB, userID uint, period string, loc *time.Location, closedBy uint) (lock models.PeriodLock, created bool, err error) {
+	start, end, err := Bounds(period, loc)
+	if err != nil {
+		return lock, false, err
+	}
+	if err := gdb.Where("user_id = ? AND period = ?", userID, period).First(&lock).Error; err == nil {
+		return lock, false, nil
+	}
+	lock = models.PeriodLock{UserID: userID, Period: period, StartsAt: start, EndsAt: end, ClosedBy: closedBy}
+	if err := gdb.Create(&lock).Error; err != nil {
+		return lock, false, err
+	}
+	return lock, true, nil
+}
+
+// Unlock reopens period for userID and reports whether it was closed.
+func Unlock(gdb *gorm.DB, userID uint, period string) (bool, error) {
+	res := gdb.Where("user_id = ? AND period = ?", userID, period).Delete(&models.PeriodLock{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// Check returns ErrLocked when t falls inside a closed period of userID.
+func Check(gdb *gorm.DB, userID uint, t time.Time) error {
+	var n int64
+	if err := gdb.Model(&models.PeriodLock{}).
+		Where("user_id = ? AND starts_at <= ? AND ends_at > ?", userID, t, t).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrLocked
+	}
+	return nil
+}
+
+// ReviewReason is noted on an upload whose receipt is dated in the closed
+// period: no catatan is created for it and it waits for review instead.
+func ReviewReason(period string) string {
+	return "Periode " + period + " sudah ditutup, struk menunggu peninjauan"
+}
+
+// UnlockedCatatan is a condition for queries on catatan_keuangans that excludes
+// rows inside closed periods.
+const UnlockedCatatan = `NOT EXISTS (SELECT 1 FROM period_locks pl
+	WHERE pl.user_id = catatan_keuangans.user_id
+	  AND catatan_keuangans.date >= pl.starts_at AND catatan_keuangans.date < pl.ends_at)`
@@ -0,0 +1,64 @@
+package periodlock_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/periodlock"
+	"be03/pkg/testenv"
+)
+
+func TestCloseCheckUnlock(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	jkt := time.FixedZone("WIB", 7*3600)
+
+	lock, created, err := periodlock.Close(gdb, 1, "2025-08", jkt, 1)
+	if err != nil || !created {
+		t.Fatalf("Close: %v created=%v", err, created)
+	}
+	if _, created, _ := periodlock.Close(gdb, 1, "2025-08", jkt, 1); created {
+		t.Fatal("closing twice created a second lock")
+	}
+	if !lock.StartsAt.Equal(time.Date(2025, 7, 31, 17, 0, 0, 0, time.UTC)) {
+		t.Fatalf("StartsAt = %v, want local midnight", lock.StartsAt)
+	}
+
+	cases := []struct {
+		at     time.Time
+		locked bool
+	}{
+		{time.Date(2025, 8, 15, 0, 0, 0, 0, jkt), true},
+		{time.Date(2025, 8, 1, 0, 0, 0, 0, jkt), true},
+		{time.Date(2025, 9, 1, 0, 0, 0, 0, jkt), false},
+		{time.Date(2025, 7, 31, 23, 0, 0, 0, jkt), false},
+	}
+	for _, c := range cases {
+		err := periodlock.Check(gdb, 1, c.at)
+		if got := errors.Is(err, periodlock.ErrLocked); got != c.locked {
+			t.Errorf("Check(%v) locked = %v, want %v (err %v)", c.at, got, c.locked, err)
+		}
+	}
+	if err := periodlock.Check(gdb, 2, time.Date(2025, 8, 15, 0, 0, 0, 0, jkt)); err != nil {
+		t.Errorf("lock leaked to another user: %v", err)
+	}
+
+	gdb.Create(&models.CatatanKeuangan{UserID: 1, FileName: "in.jpg", Amount: 1, Date: time.Date(2025, 8, 10, 0, 0, 0, 0, jkt)})
+	gdb.Create(&models.CatatanKeuangan{UserID: 1, FileName: "out.jpg", Amount: 1, Date: time.Date(2025, 9, 10, 0, 0, 0, 0, jkt)})
+	var names []string
+	gdb.Model(&models.CatatanKeuangan{}).Where(periodlock.UnlockedCatatan).Pluck("file_name", &names)
+	if len(names) != 1 || names[0] != "out.jpg" {
+		t.Fatalf("UnlockedCatatan matched %v", names)
+	}
+
+	if ok, err := periodlock.Unlock(gdb, 1, "2025-08"); err != nil || !ok {
+		t.Fatalf("Unlock: %v %v", ok, err)
+	}
+	if err := periodlock.Check(gdb, 1, time.Date(2025, 8, 15, 0, 0, 0, 0, jkt)); err != nil {
+		t.Fatalf("still locked after Unlock: %v", err)
+	}
+	if _, _, err := periodlock.Close(gdb, 1, "2025-13", jkt, 1); err == nil {
+		t.Fatal("invalid period accepted")
+	}
+}
@@ -0,0 +1,175 @@
+// Package phash computes perceptual hashes (dHash) of receipt images, so a
+// receipt that was screenshotted again or re-compressed is still recognised,
+// and indexes them in upload_phash_bands for near-duplicate lookups.
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+
+	"be03/models"
+
+	"github.com/disintegration/imaging"
+	"gorm.io/gorm"
+)
+
+// Bands is how many 8-bit bands a hash is indexed by.
+const Bands = 8
+
+// MaxDistance is the largest Hamming distance the band index is guaranteed to
+// find: two hashes closer than Bands bits share at least one band.
+const MaxDistance = Bands - 1
+
+// DefaultDistance is how many differing bits still count as the same receipt.
+const DefaultDistance = 4
+
+// Compute returns the dHash of the image in data: the image is shrunk to 9x8
+// grey pixels and each bit records whether a pixel is darker than its right
+// neighbour. ok is false when data does not decode.
+func Compute(data []byte) (h uint64, ok bool) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return 0, false
+	}
+	return Of(img), true
+}
+
+// Of is the dHash of img.
+func Of(img image.Image) uint64 {
+	small := imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Box)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			l := color.GrayModel.Convert(small.At(x, y)).(color.Gray).Y
+			r := color.GrayModel.Convert(small.At(x+1, y)).(color.Gray).Y
+			h <<= 1
+			if l < r {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// Distance is the number of bits in which a and b differ.
+func Distance(a, b uint64) int { return bits.OnesCount64(a ^ b) }
+
+func band(h uint64, i int) uint8 { return uint8(h >> (8 * i)) }
+
+// Index stores h as the perceptual hash of up, replacing an earlier one, and
+// sets up.PHash so a later save of up keeps it.
+func Index(gdb *gorm.DB, up *models.Upload, h uint64) error {
+	v := int64(h)
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Upload{}).Where("id = ?", up.ID).Update("p_hash", v).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("upload_id = ?", up.ID).Delete(&models.UploadPHashBand{}).Error; err != nil {
+			return err
+		}
+		rows := make([]models.UploadPHashBand, Bands)
+		for i := range rows {
+			rows[i] = models.UploadPHashBand{UploadID: up.ID, Band: uint8(i), Value: band(h, i)}
+		}
+		return tx.Create(&rows).Error
+	})
+	if err == nil {
+		up.PHash = &v
+	}
+	return err
+}
+
+// Match is an upload whose image is visually close to another.
+type Match struct {
+	UploadID  uint   `json:"upload_id"`
+	FileName  string `json:"file_name"`
+	CatatanID *uint  `json:"catatan_id"`
+	Distance  int    `json:"distance"`
+	Hash      int64  `json:"-"`
+	UserID    uint   `json:"-"`
+}
+
+// Similar lists userID's uploads other than uploadID whose hash is within
+// maxDist bits of h (capped at MaxDistance), closest first.
+func Similar(gdb *gorm.DB, userID, uploadID uint, h uint64, maxDist int) ([]Match, error) {
+	if maxDist > MaxDistance {
+		maxDist = MaxDistance
+	}
+	// candidates share at least one band with h
+	anyBand := gdb.Where("band = ? AND value = ?", 0, band(h, 0))
+	for i := 1; i < Bands; i++ {
+		anyBand = anyBand.Or("band = ? AND value = ?", i, band(h, i))
+	}
+	bandQ := gdb.Model(&models.UploadPHashBand{}).Select("upload_id").Where(anyBand)
+	var rows []Match
+	err := gdb.Model(&models.Upload{}).
+		Select("uploads.id AS upload_id, uploads.file_name, uploads.keuangan_id AS catatan_id, uploads.p_hash AS hash").
+		Joins("JOIN profiles ON profiles.id = uploads.profile_id").
+		Where("profiles.user_id = ? AND uploads.id <> ? AND uploads.p_hash IS NOT NULL AND uploads.id IN (?)", userID, uploadID, bandQ).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := rows[:0]
+	for _, m := range rows {
+		if m.Distance = Distance(h, uint64(m.Hash)); m.Distance <= maxDist {
+			out = append(out, m)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Distance < out[j].Distance })
+	return out, nil
+}
+
+// Pair is two uploads of the same user that look alike.
+type Pair struct {
+	UserID   uint  `json:"user_id"`
+	A        Match `json:"a"`
+	B        Match `json:"b"`
+	Distance int   `json:"distance"`
+}
+
+// Duplicates finds pairs of uploads of the same user whose hashes are within
+// maxDist bits, walking users in id order until limit pairs are found.
+func Duplicates(gdb *gorm.DB, maxDist, limit int) ([]Pair, error) {
+	rows, err := gdb.Model(&models.Upload{}).
+		Select("uploads.id AS upload_id, uploads.file_name, uploads.keuangan_id AS catatan_id, uploads.p_hash AS hash, profiles.user_id").
+		Joins("JOIN profiles ON profiles.id = uploads.profile_id").
+		Where("uploads.p_hash IS NOT NULL").
+		Order("profiles.user_id, uploads.id").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pairs := []Pair{}
+	var group []Match
+	flush := func() {
+		for i := 0; i < len(group) && len(pairs) < limit; i++ {
+			for j := i + 1; j < len(group) && len(pairs) < limit; j++ {
+				if d := Distance(uint64(group[i].Hash), uint64(group[j].Hash)); d <= maxDist {
+					a, b := group[i], group[j]
+					a.Distance, b.Distance = d, d
+					pairs = append(pairs, Pair{UserID: a.UserID, A: a, B: b, Distance: d})
+				}
+			}
+		}
+		group = group[:0]
+	}
+	for rows.Next() && len(pairs) < limit {
+		var m Match
+		if err := gdb.ScanRows(rows, &m); err != nil {
+			return nil, err
+		}
+		if len(group) > 0 && group[0].UserID != m.UserID {
+			flush()
+		}
+		group = append(group, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return pairs, nil
+}
@@ -0,0 +1,121 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+
+	"github.com/disintegration/imaging"
+)
+
+// blocks draws a grey image of random dark blocks, like lines of receipt text.
+func blocks(seed int64) *image.Gray {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewGray(image.Rect(0, 0, 360, 480))
+	for i := range img.Pix {
+		img.Pix[i] = 235
+	}
+	for n := 0; n < 40; n++ {
+		x, y := rng.Intn(300), rng.Intn(440)
+		w, h := 20+rng.Intn(60), 10+rng.Intn(40)
+		for yy := y; yy < y+h; yy++ {
+			for xx := x; xx < x+w; xx++ {
+				img.Pix[yy*img.Stride+xx] = uint8(rng.Intn(80))
+			}
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestComputeSurvivesRecompression(t *testing.T) {
+	orig, ok := Compute(encode(t, blocks(1), 95))
+	if !ok {
+		t.Fatal("jpeg did not hash")
+	}
+	// a smaller, heavily compressed copy, as a screenshot of the receipt would be
+	copyHash, _ := Compute(encode(t, imaging.Resize(blocks(1), 270, 0, imaging.Linear), 40))
+	if d := Distance(orig, copyHash); d > DefaultDistance {
+		t.Fatalf("re-compressed copy is %d bits away", d)
+	}
+	other, _ := Compute(encode(t, blocks(2), 95))
+	if d := Distance(orig, other); d <= MaxDistance {
+		t.Fatalf("a different receipt is only %d bits away", d)
+	}
+	if _, ok := Compute([]byte("not an image")); ok {
+		t.Fatal("garbage hashed")
+	}
+}
+
+func TestSimilarAndDuplicates(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "ani", Password: "secret1", Role: "user"}, {Username: "budi", Password: "secret2", Role: "user"}},
+		Uploads: []fixtures.Upload{
+			{User: "ani", FileName: "a.jpg"}, {User: "ani", FileName: "a-screenshot.jpg"}, {User: "ani", FileName: "other.jpg"},
+			{User: "budi", FileName: "b.jpg"},
+		},
+	})
+	ups := map[string]*models.Upload{}
+	var rows []models.Upload
+	gdb.Find(&rows)
+	for i := range rows {
+		ups[rows[i].FileName] = &rows[i]
+	}
+	var ani models.User
+	gdb.Where("username = ?", "ani").First(&ani)
+
+	const h = uint64(0x0123456789abcdef)
+	for name, hash := range map[string]uint64{
+		"a.jpg": h, "a-screenshot.jpg": h ^ 0x8000000000000101, "other.jpg": ^h,
+		"b.jpg": h, // same image, another user
+	} {
+		if err := Index(gdb, ups[name], hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// re-indexing replaces the bands
+	if err := Index(gdb, ups["a.jpg"], h); err != nil {
+		t.Fatal(err)
+	}
+	if ups["a.jpg"].PHash == nil || uint64(*ups["a.jpg"].PHash) != h {
+		t.Fatalf("PHash not set on the upload: %v", ups["a.jpg"].PHash)
+	}
+	var bands int64
+	gdb.Model(&models.UploadPHashBand{}).Where("upload_id = ?", ups["a.jpg"].ID).Count(&bands)
+	if bands != Bands {
+		t.Fatalf("a.jpg has %d bands", bands)
+	}
+
+	similar, err := Similar(gdb, ani.ID, ups["a.jpg"].ID, h, DefaultDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similar) != 1 || similar[0].UploadID != ups["a-screenshot.jpg"].ID || similar[0].Distance != 3 {
+		t.Fatalf("similar = %+v", similar)
+	}
+	if similar, _ := Similar(gdb, ani.ID, ups["a.jpg"].ID, h, 2); len(similar) != 0 {
+		t.Fatalf("similar within 2 bits = %+v", similar)
+	}
+
+	pairs, err := Duplicates(gdb, DefaultDistance, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].UserID != ani.ID || pairs[0].A.UploadID != ups["a.jpg"].ID || pairs[0].B.UploadID != ups["a-screenshot.jpg"].ID {
+		t.Fatalf("pairs = %+v", pairs)
+	}
+}
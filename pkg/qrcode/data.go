@@ -0,0 +1,135 @@
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Segment modes.
+const (
+	modeNumeric      = 1
+	modeAlphanumeric = 2
+	modeStructured   = 3
+	modeByte         = 4
+	modeFNC1First    = 5
+	modeECI          = 7
+	modeKanji        = 8
+	modeFNC1Second   = 9
+)
+
+var errBadData = errors.New("qrcode: malformed data segments")
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+type bitReader struct {
+	b   []byte
+	pos int // in bits
+}
+
+func (r *bitReader) left() int { return len(r.b)*8 - r.pos }
+
+func (r *bitReader) read(n int) (int, bool) {
+	if n > r.left() {
+		return 0, false
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.b[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v, true
+}
+
+// decodeSegments reads the data codewords of a version into text. Byte
+// segments are taken as they are, which is right for the ASCII and UTF-8
+// payloads of payment codes; Kanji segments are not supported.
+func decodeSegments(data []byte, version int) (string, error) {
+	r := &bitReader{b: data}
+	var sb strings.Builder
+	for r.left() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case 0:
+			return sb.String(), nil
+		case modeFNC1First:
+		case modeFNC1Second:
+			if _, ok := r.read(8); !ok {
+				return "", errBadData
+			}
+		case modeStructured:
+			if _, ok := r.read(16); !ok {
+				return "", errBadData
+			}
+		case modeECI:
+			b, ok := r.read(8)
+			switch {
+			case !ok:
+				return "", errBadData
+			case b&0xC0 == 0x80:
+				_, ok = r.read(8)
+			case b&0xE0 == 0xC0:
+				_, ok = r.read(16)
+			}
+			if !ok {
+				return "", errBadData
+			}
+		case modeNumeric, modeAlphanumeric, modeByte:
+			n, ok := r.read(countBits(mode, version))
+			if !ok {
+				return "", errBadData
+			}
+			if err := readSegment(r, &sb, mode, n); err != nil {
+				return "", err
+			}
+		default:
+			return "", errBadData
+		}
+	}
+	return sb.String(), nil
+}
+
+func readSegment(r *bitReader, sb *strings.Builder, mode, n int) error {
+	switch mode {
+	case modeNumeric:
+		for ; n > 0; n -= 3 {
+			digits, bits, limit := 3, 10, 1000
+			if n == 2 {
+				digits, bits, limit = 2, 7, 100
+			} else if n == 1 {
+				digits, bits, limit = 1, 4, 10
+			}
+			v, ok := r.read(bits)
+			if !ok || v >= limit {
+				return errBadData
+			}
+			for d := limit / 10; d > 0 && digits > 0; d, digits = d/10, digits-1 {
+				sb.WriteByte(byte('0' + v/d%10))
+			}
+		}
+	case modeAlphanumeric:
+		for ; n > 1; n -= 2 {
+			v, ok := r.read(11)
+			if !ok || v >= 45*45 {
+				return errBadData
+			}
+			sb.WriteByte(alphanumeric[v/45])
+			sb.WriteByte(alphanumeric[v%45])
+		}
+		if n == 1 {
+			v, ok := r.read(6)
+			if !ok || v >= 45 {
+				return errBadData
+			}
+			sb.WriteByte(alphanumeric[v])
+		}
+	default:
+		for ; n > 0; n-- {
+			v, ok := r.read(8)
+			if !ok {
+				return errBadData
+			}
+			sb.WriteByte(byte(v))
+		}
+	}
+	return nil
+}
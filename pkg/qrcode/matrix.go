@@ -0,0 +1,149 @@
+package qrcode
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+)
+
+var (
+	errFormat  = errors.New("qrcode: unreadable format information")
+	errVersion = errors.New("qrcode: version information disagrees")
+)
+
+// layouts caches the codeword positions per version.
+var layouts sync.Map // int -> [][2]int
+
+func layout(version int) [][2]int {
+	if l, ok := layouts.Load(version); ok {
+		return l.([][2]int)
+	}
+	l := codewordPositions(version, functionModules(version))
+	layouts.Store(version, l)
+	return l
+}
+
+// decodeMatrix reads the text of a sampled symbol: m[row][col] is true for
+// dark modules.
+func decodeMatrix(m [][]bool, version int) (string, error) {
+	n := size(version)
+	level, mask, ok := readFormat(m, n)
+	if !ok {
+		return "", errFormat
+	}
+	if version >= 7 {
+		if v, ok := readVersion(m, n); ok && v != version {
+			return "", errVersion
+		}
+	}
+	pos := layout(version)
+	raw := make([]byte, rawModules(version)/8)
+	for i := range raw {
+		var b byte
+		for j := 0; j < 8; j++ {
+			p := pos[i*8+j]
+			dark := m[p[0]][p[1]] != masked(mask, p[0], p[1])
+			b <<= 1
+			if dark {
+				b |= 1
+			}
+		}
+		raw[i] = b
+	}
+	data, err := correctBlocks(raw, version, level)
+	if err != nil {
+		return "", err
+	}
+	return decodeSegments(data, version)
+}
+
+// readFormat decodes the format information from whichever copy is closer
+// to a valid code, tolerating up to three wrong bits.
+func readFormat(m [][]bool, n int) (level, mask int, ok bool) {
+	var a, b int
+	for i := 0; i < 15; i++ {
+		r1, c1, r2, c2 := formatPositions(n, i)
+		if m[r1][c1] {
+			a |= 1 << i
+		}
+		if m[r2][c2] {
+			b |= 1 << i
+		}
+	}
+	best, bestDist := 0, 16
+	for d := 0; d < 32; d++ {
+		code := formatCode(d>>3, d&7)
+		for _, got := range [2]int{a, b} {
+			if dist := bits.OnesCount(uint(code ^ got)); dist < bestDist {
+				best, bestDist = d, dist
+			}
+		}
+	}
+	return best >> 3, best & 7, bestDist <= 3
+}
+
+// readVersion decodes the version information, tolerating up to three
+// wrong bits.
+func readVersion(m [][]bool, n int) (int, bool) {
+	var a, b int
+	for i := 0; i < 18; i++ {
+		r, c := i/3, n-11+i%3
+		if m[r][c] {
+			a |= 1 << i
+		}
+		if m[c][r] {
+			b |= 1 << i
+		}
+	}
+	best, bestDist := 0, 19
+	for v := 7; v <= 40; v++ {
+		code := versionCode(v)
+		for _, got := range [2]int{a, b} {
+			if dist := bits.OnesCount(uint(code ^ got)); dist < bestDist {
+				best, bestDist = v, dist
+			}
+		}
+	}
+	return best, bestDist <= 3
+}
+
+// correctBlocks de-interleaves the raw codewords into their blocks, corrects
+// each and returns the data codewords in order.
+func correctBlocks(raw []byte, version, level int) ([]byte, error) {
+	li := levelIndex[level]
+	nb, ecc := numBlocks[li][version], eccPerBlock[li][version]
+	short := nb - len(raw)%nb
+	shortLen := len(raw) / nb
+	shortData := shortLen - ecc
+	blocks := make([][]byte, nb)
+	for j := range blocks {
+		l := shortLen
+		if j >= short {
+			l++
+		}
+		blocks[j] = make([]byte, l)
+	}
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for j := range blocks {
+			if i < shortData || j >= short {
+				blocks[j][i] = raw[k]
+				k++
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for j, b := range blocks {
+			blocks[j][len(b)-ecc+i] = raw[k]
+			k++
+		}
+	}
+	var data []byte
+	for _, b := range blocks {
+		if err := rsCorrect(b, ecc); err != nil {
+			return nil, err
+		}
+		data = append(data, b[:len(b)-ecc]...)
+	}
+	return data, nil
+}
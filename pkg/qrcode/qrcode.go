@@ -0,0 +1,364 @@
+// Package qrcode finds and decodes QR codes in images, in pure Go. It is
+// written for payment proofs — app screenshots and scans, where the code is
+// upright or turned in the image plane — and does not undo the perspective
+// of a strongly tilted camera shot.
+//
+// Detection binarizes the image at its Otsu threshold, looks for the
+// 1:1:3:1:1 runs of the three finder patterns, samples the module grid
+// through the affine map they span and decodes it with Reed–Solomon error
+// correction.
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+// ErrNotFound is returned by Decode when no QR code could be read.
+var ErrNotFound = errors.New("qrcode: no QR code found")
+
+// maxCandidates bounds the finder patterns combined into symbols.
+const maxCandidates = 12
+
+// Decode returns the contents of the QR codes readable in img, each once.
+func Decode(img image.Image) ([]string, error) {
+	g := binarize(img)
+	cands := g.findFinders()
+	if len(cands) < 3 {
+		return nil, ErrNotFound
+	}
+	var out []string
+	seen := map[string]bool{}
+	used := make([]bool, len(cands))
+	for _, t := range triples(cands) {
+		if used[t[0]] || used[t[1]] || used[t[2]] {
+			continue
+		}
+		text, ok := g.decodeAt(cands[t[0]], cands[t[1]], cands[t[2]])
+		if !ok {
+			continue
+		}
+		used[t[0]], used[t[1]], used[t[2]] = true, true, true
+		if !seen[text] {
+			seen[text] = true
+			out = append(out, text)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return out, nil
+}
+
+// grid is a binarized image: true for dark pixels.
+type grid struct {
+	w, h int
+	dark []bool
+}
+
+func (g *grid) at(x, y int) bool { return g.dark[y*g.w+x] }
+
+// binarize thresholds img at the Otsu level of its luminance.
+func binarize(img image.Image) *grid {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]uint8, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, gg, bb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			l := uint8((299*r + 587*gg + 114*bb) / 1000 >> 8)
+			lum[y*w+x] = l
+			hist[l]++
+		}
+	}
+	t := otsu(hist, w*h)
+	g := &grid{w: w, h: h, dark: make([]bool, w*h)}
+	for i, l := range lum {
+		g.dark[i] = int(l) <= t
+	}
+	return g
+}
+
+func otsu(hist [256]int, total int) int {
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+	var sumB, wB float64
+	best, bestVar := 127, -1.0
+	for t := 0; t < 256; t++ {
+		wB += float64(hist[t])
+		if wB == 0 {
+			continue
+		}
+		wF := float64(total) - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(t * hist[t])
+		mB, mF := sumB/wB, (sum-sumB)/wF
+		if v := wB * wF * (mB - mF) * (mB - mF); v > bestVar {
+			best, bestVar = t, v
+		}
+	}
+	return best
+}
+
+// finder is a candidate finder pattern centre.
+type finder struct {
+	x, y   float64
+	module float64 // estimated module size in pixels
+	count  int     // rows it was found on
+}
+
+// finderRatio reports whether five run lengths look like the 1:1:3:1:1
+// cross-section of a finder pattern.
+func finderRatio(c [5]int) bool {
+	total := 0
+	for _, n := range c {
+		if n == 0 {
+			return false
+		}
+		total += n
+	}
+	if total < 7 {
+		return false
+	}
+	m := float64(total) / 7
+	v := m / 2
+	return math.Abs(m-float64(c[0])) < v && math.Abs(m-float64(c[1])) < v &&
+		math.Abs(3*m-float64(c[2])) < 3*v &&
+		math.Abs(m-float64(c[3])) < v && math.Abs(m-float64(c[4])) < v
+}
+
+// findFinders scans every row for finder cross-sections, verifies them
+// across the column and again along the row, and merges the hits.
+func (g *grid) findFinders() []finder {
+	var found []finder
+	for y := 0; y < g.h; y++ {
+		var c [5]int
+		state := 0
+		for x := 0; x <= g.w; x++ {
+			dark := x < g.w && g.at(x, y)
+			if dark {
+				if state&1 == 1 {
+					state++
+				}
+				c[state]++
+				continue
+			}
+			if state&1 == 1 {
+				c[state]++
+				continue
+			}
+			if state < 4 {
+				state++
+				c[state]++
+				continue
+			}
+			if finderRatio(c) {
+				found = g.confirm(found, c, x, y)
+			}
+			c = [5]int{c[2], c[3], c[4], 1, 0}
+			state = 3
+		}
+	}
+	var out []finder
+	for _, f := range found {
+		if f.count >= 2 {
+			out = append(out, f)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].count > out[j].count })
+	if len(out) > maxCandidates {
+		out = out[:maxCandidates]
+	}
+	return out
+}
+
+// confirm cross-checks the row hit c ending at x and merges it into found.
+func (g *grid) confirm(found []finder, c [5]int, end, y int) []finder {
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	cx := float64(end-c[4]-c[3]) - float64(c[2])/2
+	cy, vtotal, ok := g.crossCheck(int(cx), y, 0, 1, c[2], total)
+	if !ok {
+		return found
+	}
+	cx, htotal, ok := g.crossCheck(int(cx), int(cy), 1, 0, c[2], total)
+	if !ok {
+		return found
+	}
+	module := float64(total+vtotal+htotal) / 21
+	for i, f := range found {
+		if math.Abs(f.x-cx) <= f.module*2 && math.Abs(f.y-cy) <= f.module*2 &&
+			math.Abs(f.module-module) <= math.Max(1, f.module/2) {
+			n := float64(f.count)
+			found[i] = finder{
+				x:      (f.x*n + cx) / (n + 1),
+				y:      (f.y*n + cy) / (n + 1),
+				module: (f.module*n + module) / (n + 1),
+				count:  f.count + 1,
+			}
+			return found
+		}
+	}
+	return append(found, finder{x: cx, y: cy, module: module, count: 1})
+}
+
+// crossCheck measures the finder cross-section through (x, y) along the
+// direction (dx, dy), returning its centre coordinate along that direction
+// and its length. maxCount bounds the runs, total is the length expected.
+func (g *grid) crossCheck(x, y, dx, dy, maxCount, total int) (float64, int, bool) {
+	if x < 0 || y < 0 || x >= g.w || y >= g.h {
+		return 0, 0, false
+	}
+	pos, n := y, g.h
+	at := func(p int) bool { return g.at(x, p) }
+	if dx != 0 {
+		pos, n = x, g.w
+		at = func(p int) bool { return g.at(p, y) }
+	}
+	var c [5]int
+	p := pos
+	for ; p >= 0 && at(p); p-- {
+		c[2]++
+	}
+	for ; p >= 0 && !at(p) && c[1] <= maxCount; p-- {
+		c[1]++
+	}
+	if p < 0 || c[1] > maxCount {
+		return 0, 0, false
+	}
+	for ; p >= 0 && at(p) && c[0] <= maxCount; p-- {
+		c[0]++
+	}
+	if c[0] > maxCount {
+		return 0, 0, false
+	}
+	p = pos + 1
+	for ; p < n && at(p); p++ {
+		c[2]++
+	}
+	for ; p < n && !at(p) && c[3] <= maxCount; p++ {
+		c[3]++
+	}
+	if p == n || c[3] > maxCount {
+		return 0, 0, false
+	}
+	for ; p < n && at(p) && c[4] <= maxCount; p++ {
+		c[4]++
+	}
+	if c[4] > maxCount {
+		return 0, 0, false
+	}
+	sum := c[0] + c[1] + c[2] + c[3] + c[4]
+	if 5*abs(sum-total) >= 2*total || !finderRatio(c) {
+		return 0, 0, false
+	}
+	return float64(p-c[4]-c[3]) - float64(c[2])/2, sum, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// triples returns the index triples of candidates that could be the finder
+// patterns of one symbol — similar module sizes, two equal legs at a right
+// angle — the best-shaped first.
+func triples(c []finder) [][3]int {
+	type scored struct {
+		t     [3]int
+		score float64
+	}
+	var out []scored
+	for i := 0; i < len(c); i++ {
+		for j := i + 1; j < len(c); j++ {
+			for k := j + 1; k < len(c); k++ {
+				a, b, d := c[i], c[j], c[k]
+				lo := math.Min(a.module, math.Min(b.module, d.module))
+				hi := math.Max(a.module, math.Max(b.module, d.module))
+				if hi > lo*1.5 {
+					continue
+				}
+				// the corner is opposite the longest side
+				t := [3]int{i, j, k}
+				d01, d02, d12 := dist2(a, b), dist2(a, d), dist2(b, d)
+				switch {
+				case d01 >= d02 && d01 >= d12:
+					t = [3]int{k, i, j}
+				case d02 >= d01 && d02 >= d12:
+					t = [3]int{j, i, k}
+				}
+				l1, l2 := dist2(c[t[0]], c[t[1]]), dist2(c[t[0]], c[t[2]])
+				hyp := dist2(c[t[1]], c[t[2]])
+				legs := math.Abs(math.Sqrt(l1)-math.Sqrt(l2)) / math.Max(math.Sqrt(l1), math.Sqrt(l2))
+				angle := math.Abs(hyp-l1-l2) / hyp
+				if legs > 0.25 || angle > 0.25 || math.Sqrt(l1) < 10*lo {
+					continue
+				}
+				out = append(out, scored{t, legs + angle})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].score < out[j].score })
+	ts := make([][3]int, len(out))
+	for i, s := range out {
+		ts[i] = s.t
+	}
+	return ts
+}
+
+func dist2(a, b finder) float64 {
+	return (a.x-b.x)*(a.x-b.x) + (a.y-b.y)*(a.y-b.y)
+}
+
+// decodeAt reads the symbol whose corner finder is tl, trying the versions
+// around the one the finder distance suggests.
+func (g *grid) decodeAt(tl, p, q finder) (string, bool) {
+	// orient: top-right is clockwise from the corner in image coordinates
+	if (p.x-tl.x)*(q.y-tl.y)-(p.y-tl.y)*(q.x-tl.x) < 0 {
+		p, q = q, p
+	}
+	tr, bl := p, q
+	module := (tl.module + tr.module + bl.module) / 3
+	span := (math.Sqrt(dist2(tl, tr)) + math.Sqrt(dist2(tl, bl))) / 2 / module
+	est := int(math.Round((span + 7 - 17) / 4))
+	for _, v := range []int{est, est - 1, est + 1, est - 2, est + 2} {
+		if v < 1 || v > 40 {
+			continue
+		}
+		if text, err := decodeMatrix(g.sample(tl, tr, bl, v), v); err == nil {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// sample reads the modules of a version through the affine map that puts
+// the finder centres at module coordinates (3.5, 3.5), (n-3.5, 3.5) and
+// (3.5, n-3.5).
+func (g *grid) sample(tl, tr, bl finder, version int) [][]bool {
+	n := size(version)
+	span := float64(n) - 7
+	ux, uy := (tr.x-tl.x)/span, (tr.y-tl.y)/span // per module along a row
+	vx, vy := (bl.x-tl.x)/span, (bl.y-tl.y)/span // per module down a column
+	m := make([][]bool, n)
+	for r := range m {
+		m[r] = make([]bool, n)
+		for c := range m[r] {
+			fc, fr := float64(c)+0.5-3.5, float64(r)+0.5-3.5
+			x := int(math.Floor(tl.x + fc*ux + fr*vx))
+			y := int(math.Floor(tl.y + fc*uy + fr*vy))
+			if x >= 0 && y >= 0 && x < g.w && y < g.h {
+				m[r][c] = g.at(x, y)
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,273 @@
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// encode builds the symbol of text in byte mode at the smallest version
+// that holds it; the decoder's tests need codes and there is no encoder to
+// borrow.
+func encode(t *testing.T, text string, level, mask int) ([][]bool, int) {
+	t.Helper()
+	li := levelIndex[level]
+	version := 1
+	for ; version <= 40; version++ {
+		capacity := rawModules(version)/8 - eccPerBlock[li][version]*numBlocks[li][version]
+		if 4+countBits(modeByte, version)+8*len(text) <= capacity*8 {
+			break
+		}
+	}
+	capacity := rawModules(version)/8 - eccPerBlock[li][version]*numBlocks[li][version]
+	var bits []bool
+	put := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	put(modeByte, 4)
+	put(len(text), countBits(modeByte, version))
+	for i := 0; i < len(text); i++ {
+		put(int(text[i]), 8)
+	}
+	put(0, min(4, capacity*8-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+	data := make([]byte, capacity)
+	for i := range data {
+		if i*8 < len(bits) {
+			for j := 0; j < 8; j++ {
+				if bits[i*8+j] {
+					data[i] |= 0x80 >> j
+				}
+			}
+		} else if (i-len(bits)/8)%2 == 0 {
+			data[i] = 0xEC
+		} else {
+			data[i] = 0x11
+		}
+	}
+	raw := interleave(data, version, level)
+
+	n := size(version)
+	fn := functionModules(version)
+	m := make([][]bool, n)
+	for r := range m {
+		m[r] = make([]bool, n)
+	}
+	finder := func(cr, cc int) {
+		for dr := -4; dr <= 4; dr++ {
+			for dc := -4; dc <= 4; dc++ {
+				r, c := cr+dr, cc+dc
+				if r >= 0 && c >= 0 && r < n && c < n {
+					d := max(abs(dr), abs(dc))
+					m[r][c] = d != 2 && d != 4
+				}
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		m[6][i], m[i][6] = i%2 == 0, i%2 == 0
+	}
+	finder(3, 3)
+	finder(3, n-4)
+	finder(n-4, 3)
+	pos := alignmentPositions(version)
+	for i, r := range pos {
+		for j, c := range pos {
+			if i == 0 && j == 0 || i == 0 && j == len(pos)-1 || i == len(pos)-1 && j == 0 {
+				continue
+			}
+			for dr := -2; dr <= 2; dr++ {
+				for dc := -2; dc <= 2; dc++ {
+					m[r+dr][c+dc] = max(abs(dr), abs(dc)) != 1
+				}
+			}
+		}
+	}
+	f := formatCode(level, mask)
+	for i := 0; i < 15; i++ {
+		r1, c1, r2, c2 := formatPositions(n, i)
+		m[r1][c1], m[r2][c2] = f>>i&1 == 1, f>>i&1 == 1
+	}
+	m[n-8][8] = true
+	if version >= 7 {
+		v := versionCode(version)
+		for i := 0; i < 18; i++ {
+			m[i/3][n-11+i%3], m[n-11+i%3][i/3] = v>>i&1 == 1, v>>i&1 == 1
+		}
+	}
+	for i, p := range codewordPositions(version, fn) {
+		bit := i < len(raw)*8 && raw[i/8]>>(7-i%8)&1 == 1
+		m[p[0]][p[1]] = bit != masked(mask, p[0], p[1])
+	}
+	return m, version
+}
+
+func interleave(data []byte, version, level int) []byte {
+	li := levelIndex[level]
+	nb, ecc := numBlocks[li][version], eccPerBlock[li][version]
+	rawLen := rawModules(version) / 8
+	short := nb - rawLen%nb
+	shortData := rawLen/nb - ecc
+	var blocks, eccs [][]byte
+	for j, k := 0, 0; j < nb; j++ {
+		l := shortData
+		if j >= short {
+			l++
+		}
+		blocks = append(blocks, data[k:k+l])
+		eccs = append(eccs, rsEncode(data[k:k+l], ecc))
+		k += l
+	}
+	var raw []byte
+	for i := 0; i <= shortData; i++ {
+		for j, b := range blocks {
+			if i < len(b) {
+				raw = append(raw, blocks[j][i])
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for j := range eccs {
+			raw = append(raw, eccs[j][i])
+		}
+	}
+	return raw
+}
+
+// render draws m at scale pixels per module with a four-module quiet zone.
+func render(m [][]bool, scale int) *image.Gray {
+	n := len(m)
+	side := (n + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for r := range m {
+		for c := range m[r] {
+			if !m[r][c] {
+				continue
+			}
+			for y := 0; y < scale; y++ {
+				for x := 0; x < scale; x++ {
+					img.SetGray((c+4)*scale+x, (r+4)*scale+y, color.Gray{})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func rotate90(src *image.Gray) *image.Gray {
+	b := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetGray(b.Dy()-1-y, x, src.GrayAt(x, y))
+		}
+	}
+	return dst
+}
+
+func TestFormatCode(t *testing.T) {
+	for _, tc := range []struct{ level, mask, want int }{
+		{levelM, 0, 0b101010000010010},
+		{levelL, 0, 0b111011111000100},
+	} {
+		if got := formatCode(tc.level, tc.mask); got != tc.want {
+			t.Errorf("formatCode(%d, %d) = %015b, want %015b", tc.level, tc.mask, got, tc.want)
+		}
+	}
+	if got := versionCode(7); got != 0x07C94 {
+		t.Errorf("versionCode(7) = %#x", got)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	for v := 1; v <= 40; v++ {
+		if got := len(layout(v)); got != rawModules(v) {
+			t.Fatalf("version %d: %d codeword modules, want %d", v, got, rawModules(v))
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD, 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsEncode(data, 10); !bytes.Equal(got, want) {
+		t.Fatalf("ecc %v, want %v", got, want)
+	}
+	block := append(append([]byte{}, data...), want...)
+	for _, i := range []int{0, 7, 20, 25, 3} {
+		block[i] ^= 0x5A
+	}
+	if err := rsCorrect(block, 10); err != nil || !bytes.Equal(block[:16], data) {
+		t.Fatalf("5 errors: %v %v", block[:16], err)
+	}
+	block[1] ^= 1
+	block[2] ^= 1
+	block[4] ^= 1
+	block[5] ^= 1
+	block[6] ^= 1
+	block[8] ^= 1
+	if err := rsCorrect(block, 10); err == nil && bytes.Equal(block[:16], data) {
+		t.Fatal("corrected 6 errors with 10 ecc codewords")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	qris := "00020101021226610016ID.CO.SHOPEE.WWW01189360091800000000000202000303UMI51440014ID.CO.QRIS.WWW0215ID10200000000000303UMI5204581253033605406250005802ID5914WARUNG BU SITI6007JAKARTA61051234062070703A016304ABCD"
+	for _, tc := range []struct {
+		name        string
+		text        string
+		level, mask int
+		scale       int
+		rotate      bool
+	}{
+		{"short", "HELLO WORLD", levelM, 2, 3, false},
+		{"qris", qris, levelM, 5, 2, false},
+		{"qris rotated", qris, levelQ, 3, 4, true},
+		{"large", strings.Repeat("be03 ", 120), levelL, 7, 2, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, version := encode(t, tc.text, tc.level, tc.mask)
+			img := render(m, tc.scale)
+			if tc.rotate {
+				img = rotate90(img)
+			}
+			got, err := Decode(img)
+			if err != nil || len(got) != 1 || got[0] != tc.text {
+				t.Fatalf("version %d: %q %v", version, got, err)
+			}
+		})
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	m, _ := encode(t, "00020101021253033605405150005802ID5906TOKO A6005BOGOR6304ABCD", levelM, 0)
+	n := len(m)
+	// a smudge across the data area, within the M level's correction
+	for r := n - 3; r < n; r++ {
+		for c := n - 6; c < n; c++ {
+			m[r][c] = !m[r][c]
+		}
+	}
+	got, err := Decode(render(m, 4))
+	if err != nil || got[0] != "00020101021253033605405150005802ID5906TOKO A6005BOGOR6304ABCD" {
+		t.Fatalf("%q %v", got, err)
+	}
+}
+
+func TestDecodeNothing(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 120))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	if _, err := Decode(img); err != ErrNotFound {
+		t.Fatalf("noise: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package qrcode
+
+import "errors"
+
+// Reed–Solomon over GF(256) with the QR code field polynomial 0x11D and
+// generator roots α^0…α^(n-1). Polynomials are big-endian: index 0 holds
+// the highest-degree coefficient, as codewords are laid out.
+
+var errUncorrectable = errors.New("qrcode: too many errors in a block")
+
+var gfExp, gfLog = func() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// gfAlpha returns α^p for any integer p.
+func gfAlpha(p int) byte { return gfExp[(p%255+255)%255] }
+
+func gfInverse(a byte) byte { return gfExp[255-int(gfLog[a])] }
+
+func polyScale(p []byte, x byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[i] = gfMul(c, x)
+	}
+	return r
+}
+
+func polyAdd(p, q []byte) []byte {
+	r := make([]byte, max(len(p), len(q)))
+	for i, c := range p {
+		r[i+len(r)-len(p)] = c
+	}
+	for i, c := range q {
+		r[i+len(r)-len(q)] ^= c
+	}
+	return r
+}
+
+func polyMul(p, q []byte) []byte {
+	r := make([]byte, len(p)+len(q)-1)
+	for i, a := range p {
+		for j, b := range q {
+			r[i+j] ^= gfMul(a, b)
+		}
+	}
+	return r
+}
+
+func polyEval(p []byte, x byte) byte {
+	y := p[0]
+	for _, c := range p[1:] {
+		y = gfMul(y, x) ^ c
+	}
+	return y
+}
+
+// polyRem is the remainder of dividend by the monic divisor.
+func polyRem(dividend, divisor []byte) []byte {
+	out := append([]byte(nil), dividend...)
+	for i := 0; i < len(dividend)-(len(divisor)-1); i++ {
+		if coef := out[i]; coef != 0 {
+			for j := 1; j < len(divisor); j++ {
+				out[i+j] ^= gfMul(divisor[j], coef)
+			}
+		}
+	}
+	return out[len(out)-(len(divisor)-1):]
+}
+
+func reversed(p []byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[len(p)-1-i] = c
+	}
+	return r
+}
+
+// rsCorrect corrects the block msg, data followed by nsym error correction
+// codewords, in place: up to nsym/2 wrong codewords.
+func rsCorrect(msg []byte, nsym int) error {
+	synd := make([]byte, nsym+1) // synd[0] pads, as the algorithms below expect
+	clean := true
+	for i := 0; i < nsym; i++ {
+		synd[i+1] = polyEval(msg, gfAlpha(i))
+		clean = clean && synd[i+1] == 0
+	}
+	if clean {
+		return nil
+	}
+	loc, err := errorLocator(synd, nsym)
+	if err != nil {
+		return err
+	}
+	pos, err := errorPositions(reversed(loc), len(msg))
+	if err != nil {
+		return err
+	}
+	if err := correctErrata(msg, synd, pos); err != nil {
+		return err
+	}
+	for i := 0; i < nsym; i++ {
+		if polyEval(msg, gfAlpha(i)) != 0 {
+			return errUncorrectable
+		}
+	}
+	return nil
+}
+
+// errorLocator runs Berlekamp–Massey over the syndromes.
+func errorLocator(synd []byte, nsym int) ([]byte, error) {
+	loc, old := []byte{1}, []byte{1}
+	for i := 0; i < nsym; i++ {
+		k := i + 1
+		delta := synd[k]
+		for j := 1; j < len(loc); j++ {
+			delta ^= gfMul(loc[len(loc)-1-j], synd[k-j])
+		}
+		old = append(old, 0)
+		if delta != 0 {
+			if len(old) > len(loc) {
+				next := polyScale(old, delta)
+				old = polyScale(loc, gfInverse(delta))
+				loc = next
+			}
+			loc = polyAdd(loc, polyScale(old, delta))
+		}
+	}
+	for len(loc) > 1 && loc[0] == 0 {
+		loc = loc[1:]
+	}
+	if 2*(len(loc)-1) > nsym {
+		return nil, errUncorrectable
+	}
+	return loc, nil
+}
+
+// errorPositions finds the roots of the locator by trying every position.
+func errorPositions(locRev []byte, n int) ([]int, error) {
+	errs := len(locRev) - 1
+	var pos []int
+	for i := 0; i < n; i++ {
+		if polyEval(locRev, gfAlpha(i)) == 0 {
+			pos = append(pos, n-1-i)
+		}
+	}
+	if len(pos) != errs {
+		return nil, errUncorrectable
+	}
+	return pos, nil
+}
+
+// correctErrata computes the error magnitudes with Forney's algorithm and
+// removes them from msg.
+func correctErrata(msg, synd []byte, pos []int) error {
+	loc := []byte{1}
+	x := make([]byte, len(pos))
+	for i, p := range pos {
+		coef := len(msg) - 1 - p
+		loc = polyMul(loc, polyAdd([]byte{1}, []byte{gfAlpha(coef), 0}))
+		x[i] = gfAlpha(coef)
+	}
+	divisor := make([]byte, len(loc)+1)
+	divisor[0] = 1
+	eval := polyRem(polyMul(reversed(synd), loc), divisor)
+	for i, xi := range x {
+		inv := gfInverse(xi)
+		prime := byte(1)
+		for j, xj := range x {
+			if j != i {
+				prime = gfMul(prime, 1^gfMul(inv, xj))
+			}
+		}
+		if prime == 0 {
+			return errUncorrectable
+		}
+		y := gfMul(xi, polyEval(eval, inv))
+		msg[pos[i]] ^= gfDiv(y, prime)
+	}
+	return nil
+}
+
+// rsGenerator is the generator polynomial for nsym codewords.
+func rsGenerator(nsym int) []byte {
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		g = polyMul(g, []byte{1, gfAlpha(i)})
+	}
+	return g
+}
+
+// rsEncode returns the nsym error correction codewords of data.
+func rsEncode(data []byte, nsym int) []byte {
+	return polyRem(append(append([]byte(nil), data...), make([]byte, nsym)...), rsGenerator(nsym))
+}
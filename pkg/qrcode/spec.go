@@ -0,0 +1,217 @@
+package qrcode
+
+// The symbol layout of ISO/IEC 18004: versions, error correction blocks,
+// function patterns, format and version information.
+
+// Error correction levels, by their two format-information bits.
+const (
+	levelM = 0
+	levelL = 1
+	levelH = 2
+	levelQ = 3
+)
+
+// levelIndex orders the levels L, M, Q, H as the tables below do.
+var levelIndex = [4]int{levelM: 1, levelL: 0, levelH: 3, levelQ: 2}
+
+// eccPerBlock and numBlocks are indexed [L, M, Q, H][version].
+var eccPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+func size(version int) int { return 17 + 4*version }
+
+// rawModules is the number of modules of a version left for codewords once
+// the function patterns are placed, remainder bits included.
+func rawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// alignmentPositions are the row and column coordinates of the alignment
+// pattern centres of a version.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	}
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, size(version)-7; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// functionModules marks the modules of a version that do not carry
+// codewords: finder patterns with their separators and the format
+// information next to them, timing patterns, alignment patterns and the
+// version information.
+func functionModules(version int) [][]bool {
+	n := size(version)
+	m := make([][]bool, n)
+	for i := range m {
+		m[i] = make([]bool, n)
+	}
+	fill := func(r0, c0, r1, c1 int) {
+		for r := max(r0, 0); r <= min(r1, n-1); r++ {
+			for c := max(c0, 0); c <= min(c1, n-1); c++ {
+				m[r][c] = true
+			}
+		}
+	}
+	fill(0, 0, 8, 8)
+	fill(0, n-8, 8, n-1)
+	fill(n-8, 0, n-1, 8)
+	fill(6, 0, 6, n-1)
+	fill(0, 6, n-1, 6)
+	pos := alignmentPositions(version)
+	for i, r := range pos {
+		for j, c := range pos {
+			if i == 0 && j == 0 || i == 0 && j == len(pos)-1 || i == len(pos)-1 && j == 0 {
+				continue // under a finder pattern
+			}
+			fill(r-2, c-2, r+2, c+2)
+		}
+	}
+	if version >= 7 {
+		fill(0, n-11, 5, n-9)
+		fill(n-11, 0, n-9, 5)
+	}
+	return m
+}
+
+// masked reports whether mask pattern mask inverts the module at row r,
+// column c.
+func masked(mask, r, c int) bool {
+	switch mask {
+	case 0:
+		return (r+c)%2 == 0
+	case 1:
+		return r%2 == 0
+	case 2:
+		return c%3 == 0
+	case 3:
+		return (r+c)%3 == 0
+	case 4:
+		return (c/3+r/2)%2 == 0
+	case 5:
+		return r*c%2+r*c%3 == 0
+	case 6:
+		return (r*c%2+r*c%3)%2 == 0
+	default:
+		return ((r+c)%2+r*c%3)%2 == 0
+	}
+}
+
+// formatCode is the 15-bit format information of level and mask, BCH coded
+// and masked.
+func formatCode(level, mask int) int {
+	data := level<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionCode is the 18-bit version information of version (7 and up).
+func versionCode(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// formatPositions returns the row and column of bit i of the two copies of
+// the format information.
+func formatPositions(n, i int) (r1, c1, r2, c2 int) {
+	switch {
+	case i <= 5:
+		r1, c1 = i, 8
+	case i == 6:
+		r1, c1 = 7, 8
+	case i == 7:
+		r1, c1 = 8, 8
+	case i == 8:
+		r1, c1 = 8, 7
+	default:
+		r1, c1 = 8, 14-i
+	}
+	if i < 8 {
+		r2, c2 = 8, n-1-i
+	} else {
+		r2, c2 = n-15+i, 8
+	}
+	return
+}
+
+// codewordPositions returns the modules carrying codeword bits, in reading
+// order: two-column strips from the right edge, alternately upward and
+// downward, skipping the vertical timing pattern and the function modules.
+func codewordPositions(version int, fn [][]bool) [][2]int {
+	n := size(version)
+	out := make([][2]int, 0, rawModules(version))
+	for right := n - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < n; vert++ {
+			r := vert
+			if upward {
+				r = n - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				c := right - j
+				if !fn[r][c] {
+					out = append(out, [2]int{r, c})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// countBits is the width of the character count of a mode in a version.
+func countBits(mode, version int) int {
+	i := 0
+	switch {
+	case version >= 27:
+		i = 2
+	case version >= 10:
+		i = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return [3]int{10, 12, 14}[i]
+	case modeAlphanumeric:
+		return [3]int{9, 11, 13}[i]
+	case modeByte:
+		return [3]int{8, 16, 16}[i]
+	default: // kanji
+		return [3]int{8, 10, 12}[i]
+	}
+}
@@ -0,0 +1,144 @@
+// Package querylog is a GORM logger that counts queries, logs slow and failing
+// ones with the HTTP request id they ran for, and keeps bound parameters out of
+// the log.
+package querylog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type ctxKey struct{}
+
+// WithRequestID tags ctx so queries run with it can be traced to a request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the id stored by WithRequestID, or "-".
+func RequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return "-"
+}
+
+// maxSQL bounds the statement text written to the log.
+const maxSQL = 500
+
+// Stats is a snapshot of the counters.
+type Stats struct {
+	Queries       int64   `json:"queries"`
+	Slow          int64   `json:"slow"`
+	Errors        int64   `json:"errors"`
+	TotalMillis   float64 `json:"total_ms"`
+	MaxMillis     float64 `json:"max_ms"`
+	SlowThreshold string  `json:"slow_threshold"`
+}
+
+// Logger implements gorm's logger.Interface.
+type Logger struct {
+	SlowThreshold time.Duration
+	level         logger.LogLevel
+	c             *counters
+}
+
+type counters struct {
+	queries, slow, errs    atomic.Int64
+	totalMicros, maxMicros atomic.Int64
+}
+
+// New returns a logger flagging queries at or above slow.
+func New(slow time.Duration) *Logger {
+	return &Logger{SlowThreshold: slow, level: logger.Warn, c: &counters{}}
+}
+
+// LogMode implements logger.Interface. It returns a copy (db.Debug() must not
+// change the level for everyone) that shares the counters.
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	cp := *l
+	cp.level = level
+	return &cp
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Info {
+		log.Printf("db info request_id=%s "+msg, append([]any{RequestID(ctx)}, args...)...)
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Warn {
+		log.Printf("db warn request_id=%s "+msg, append([]any{RequestID(ctx)}, args...)...)
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Error {
+		log.Printf("db error request_id=%s "+msg, append([]any{RequestID(ctx)}, args...)...)
+	}
+}
+
+// ParamsFilter makes gorm render statements with placeholders instead of
+// values, so passwords and personal data never reach the log.
+func (l *Logger) ParamsFilter(_ context.Context, sql string, _ ...any) (string, []any) {
+	return sql, nil
+}
+
+// Trace implements logger.Interface.
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	l.c.queries.Add(1)
+	us := elapsed.Microseconds()
+	l.c.totalMicros.Add(us)
+	for {
+		cur := l.c.maxMicros.Load()
+		if us <= cur || l.c.maxMicros.CompareAndSwap(cur, us) {
+			break
+		}
+	}
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.SlowThreshold > 0 && elapsed >= l.SlowThreshold
+	if failed {
+		l.c.errs.Add(1)
+	}
+	if slow {
+		l.c.slow.Add(1)
+	}
+	if l.level == logger.Silent || (!failed && !slow && l.level < logger.Info) {
+		return
+	}
+	sql, rows := fc()
+	if len(sql) > maxSQL {
+		sql = sql[:maxSQL] + "…"
+	}
+	switch {
+	case failed && l.level >= logger.Error:
+		log.Printf("db query failed request_id=%s elapsed_ms=%.1f rows=%d err=%q sql=%q", RequestID(ctx), ms(elapsed), rows, err.Error(), sql)
+	case slow && l.level >= logger.Warn:
+		log.Printf("db slow query request_id=%s elapsed_ms=%.1f threshold_ms=%.0f rows=%d sql=%q", RequestID(ctx), ms(elapsed), ms(l.SlowThreshold), rows, sql)
+	case l.level >= logger.Info:
+		log.Printf("db query request_id=%s elapsed_ms=%.1f rows=%d sql=%q", RequestID(ctx), ms(elapsed), rows, sql)
+	}
+}
+
+// Stats returns the counters since start.
+func (l *Logger) Stats() Stats {
+	return Stats{
+		Queries:       l.c.queries.Load(),
+		Slow:          l.c.slow.Load(),
+		Errors:        l.c.errs.Load(),
+		TotalMillis:   float64(l.c.totalMicros.Load()) / 1000,
+		MaxMillis:     float64(l.c.maxMicros.Load()) / 1000,
+		SlowThreshold: fmt.Sprint(l.SlowThreshold),
+	}
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
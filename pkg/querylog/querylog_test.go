@@ -0,0 +1,46 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+
+	"gorm.io/gorm/logger"
+)
+
+func TestSlowQueryLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	gdb := testenv.OpenDB(t)
+	l := New(time.Nanosecond) // every query is "slow"
+	gdb.Logger = l
+	ctx := WithRequestID(context.Background(), "req-42")
+	var u models.User
+	gdb.WithContext(ctx).Where("username = ?", "s3cret-name").Find(&u)
+
+	out := buf.String()
+	if !strings.Contains(out, "db slow query request_id=req-42") {
+		t.Fatalf("slow query not logged with request id: %s", out)
+	}
+	if strings.Contains(out, "s3cret-name") {
+		t.Fatalf("bound parameter leaked into the log: %s", out)
+	}
+	if st := l.Stats(); st.Queries != 1 || st.Slow != 1 || st.Errors != 0 {
+		t.Fatalf("stats: %+v", st)
+	}
+
+	// Debug() gets a copy: the shared logger keeps its level, the counters are shared
+	d := l.LogMode(logger.Info).(*Logger)
+	if l.level != logger.Warn || d.c != l.c {
+		t.Fatal("LogMode must copy the level and share the counters")
+	}
+}
@@ -0,0 +1,214 @@
+// Package ratelimit implements per-key token buckets for expensive routes
+// (OCR uploads) and the administrator-managed list of per-user overrides.
+//
+// Buckets live in memory, so each API server enforces its own share; that is
+// enough to keep one user from monopolising the OCR workers of a server.
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Limit allows PerMinute requests per minute with bursts of up to Burst.
+// A zero PerMinute means unlimited.
+type Limit struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+// Unlimited reports whether l never rejects.
+func (l Limit) Unlimited() bool { return l.PerMinute <= 0 }
+
+// Decision is the outcome of one Allow call, with what the quota headers need.
+type Decision struct {
+	Allowed   bool
+	Limit     int           // bucket size (burst)
+	Remaining int           // requests left right now
+	Reset     time.Duration // until the bucket is full again
+	// RetryAfter is the wait for the next token; zero when Allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxIdleBuckets triggers pruning of full buckets.
+const maxIdleBuckets = 10000
+
+// Limiter holds one bucket per key.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// Now is the clock; tests replace it.
+	Now func() time.Time
+}
+
+// New returns an empty limiter.
+func New() *Limiter {
+	return &Limiter{buckets: map[string]*bucket{}, Now: time.Now}
+}
+
+// Allow takes one token from key's bucket under lim.
+func (l *Limiter) Allow(key string, lim Limit) Decision {
+	if lim.Unlimited() {
+		return Decision{Allowed: true}
+	}
+	burst := lim.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	rate := float64(lim.PerMinute) / 60 // tokens per second
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now, rate, burst)
+		}
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	d := Decision{Limit: burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((float64(burst) - b.tokens) / rate)
+	return d
+}
+
+// prune drops buckets that have refilled completely; they carry no state.
+func (l *Limiter) prune(now time.Time, rate float64, burst int) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+// Override gives one user a limit other than the route default; PerMinute 0
+// exempts the user.
+type Override struct {
+	Username string `json:"username"`
+	Limit
+}
+
+// LoadOverrides reads the override list stored under key.
+func LoadOverrides(gdb *gorm.DB, key string) ([]Override, error) {
+	var s models.Setting
+	err := gdb.Where("key = ?", key).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []Override{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Override
+	if err := json.Unmarshal([]byte(s.Value), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SaveOverrides replaces the list stored under key, one entry per username.
+func SaveOverrides(gdb *gorm.DB, key string, list []Override) ([]Override, error) {
+	byUser := map[string]Override{}
+	for _, o := range list {
+		o.Username = strings.TrimSpace(o.Username)
+		if o.Username == "" {
+			return nil, errors.New("override without username")
+		}
+		if o.PerMinute < 0 || o.Burst < 0 {
+			return nil, errors.New("per_minute and burst must not be negative")
+		}
+		byUser[o.Username] = o
+	}
+	out := make([]Override, 0, len(byUser))
+	for _, o := range byUser {
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	b, _ := json.Marshal(out)
+	if err := gdb.Save(&models.Setting{Key: key, Value: string(b)}).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RenameOverride moves the override stored under key from one username to
+// another, for a renamed user. It is a no-op when from has none.
+func RenameOverride(gdb *gorm.DB, key, from, to string) error {
+	list, err := LoadOverrides(gdb, key)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range list {
+		if list[i].Username == from {
+			list[i].Username, found = to, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	_, err = SaveOverrides(gdb, key, list)
+	return err
+}
+
+// OverrideCache serves an override list re-read at most every TTL.
+type OverrideCache struct {
+	Key string
+	TTL time.Duration
+
+	mu   sync.Mutex
+	from *gorm.DB
+	at   time.Time
+	list []Override
+}
+
+// Lookup returns username's override, if any. Read errors keep the last list.
+func (c *OverrideCache) Lookup(gdb *gorm.DB, username string) (Limit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.from != gdb || c.at.IsZero() || time.Since(c.at) >= c.TTL {
+		if list, err := LoadOverrides(gdb, c.Key); err == nil {
+			c.list = list
+		}
+		c.from, c.at = gdb, time.Now()
+	}
+	for _, o := range c.list {
+		if o.Username == username {
+			return o.Limit, true
+		}
+	}
+	return Limit{}, false
+}
+
+// Invalidate forces the next Lookup to re-read the list.
+func (c *OverrideCache) Invalidate() {
+	c.mu.Lock()
+	c.at = time.Time{}
+	c.mu.Unlock()
+}
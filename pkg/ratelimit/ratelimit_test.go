@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"be03/pkg/testenv"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.Now = func() time.Time { return now }
+	lim := Limit{PerMinute: 6, Burst: 2} // one token every 10s
+
+	for i, want := range []bool{true, true, false} {
+		d := l.Allow("u1", lim)
+		if d.Allowed != want {
+			t.Fatalf("request %d: allowed=%v, want %v (%+v)", i, d.Allowed, want, d)
+		}
+		if !want && d.RetryAfter != 10*time.Second {
+			t.Fatalf("retry after %v", d.RetryAfter)
+		}
+	}
+	if d := l.Allow("u2", lim); !d.Allowed || d.Remaining != 1 || d.Limit != 2 {
+		t.Fatalf("keys must not share buckets: %+v", d)
+	}
+	now = now.Add(10 * time.Second)
+	if d := l.Allow("u1", lim); !d.Allowed || d.Remaining != 0 || d.Reset != 20*time.Second {
+		t.Fatalf("after refill: %+v", d)
+	}
+	if d := l.Allow("u1", Limit{}); !d.Allowed {
+		t.Fatal("unlimited must always allow")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	if _, err := SaveOverrides(gdb, "k", []Override{{Username: ""}}); err == nil {
+		t.Fatal("empty username accepted")
+	}
+	list, err := SaveOverrides(gdb, "k", []Override{
+		{Username: "bot", Limit: Limit{}},
+		{Username: "alice", Limit: Limit{PerMinute: 1, Burst: 1}},
+		{Username: "alice", Limit: Limit{PerMinute: 60, Burst: 100}},
+	})
+	if err != nil || len(list) != 2 || list[0].Username != "alice" || list[0].PerMinute != 60 {
+		t.Fatalf("save: %+v %v", list, err)
+	}
+	c := &OverrideCache{Key: "k", TTL: time.Minute}
+	if lim, ok := c.Lookup(gdb, "bot"); !ok || !lim.Unlimited() {
+		t.Fatalf("bot: %+v %v", lim, ok)
+	}
+	if _, ok := c.Lookup(gdb, "carol"); ok {
+		t.Fatal("carol has no override")
+	}
+}
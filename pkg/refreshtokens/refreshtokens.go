@@ -0,0 +1,58 @@
+// Package refreshtokens prunes refresh tokens that can never be used again:
+// those that expired, or were revoked (logout, session revocation, account
+// disabled), before a cutoff. Keeping them for a while after that lets
+// support still see recent sessions.
+package refreshtokens
+
+import (
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultRetentionDays is how long dead tokens are kept.
+const DefaultRetentionDays = 30
+
+// DefaultBatch is the number of rows deleted per statement.
+const DefaultBatch = 1000
+
+// Cutoff returns the instant days before now.
+func Cutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// dead selects tokens that expired, or were revoked, before cutoff. Revoked
+// tokens are dated by their last update, which is the revocation.
+func dead(gdb *gorm.DB, cutoff time.Time) *gorm.DB {
+	return gdb.Model(&models.RefreshToken{}).
+		Where("expires_at < ? OR (revoked = ? AND updated_at < ?)", cutoff, true, cutoff)
+}
+
+// Count returns how many tokens Prune would delete.
+func Count(gdb *gorm.DB, cutoff time.Time) (int64, error) {
+	var n int64
+	err := dead(gdb, cutoff).Count(&n).Error
+	return n, err
+}
+
+// Prune deletes dead tokens in batches of batch rows so a large backlog does
+// not hold a long lock, and returns the number deleted.
+func Prune(gdb *gorm.DB, cutoff time.Time, batch int) (int64, error) {
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+	var total int64
+	for {
+		ids := dead(gdb, cutoff).Select("id").Limit(batch)
+		res := gdb.Where("id IN (?)", ids).Delete(&models.RefreshToken{})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+		if res.RowsAffected < int64(batch) {
+			return total, nil
+		}
+	}
+}
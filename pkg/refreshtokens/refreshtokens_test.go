@@ -0,0 +1,52 @@
+package refreshtokens
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestPrune(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "ani", Password: "secret1", Role: "user"}}})
+	var ani models.User
+	gdb.Where("username = ?", "ani").First(&ani)
+	now := time.Now()
+	cutoff := Cutoff(now, 30)
+	if !cutoff.Equal(now.AddDate(0, 0, -30)) {
+		t.Fatalf("cutoff %v", cutoff)
+	}
+	add := func(name string, expires time.Time, revoked bool, updated time.Time) {
+		rt := models.RefreshToken{UserID: ani.ID, TokenHash: name, ExpiresAt: expires, Revoked: revoked}
+		if err := gdb.Create(&rt).Error; err != nil {
+			t.Fatal(err)
+		}
+		gdb.Model(&rt).UpdateColumn("updated_at", updated)
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("expired-long-ago-%d", i), now.AddDate(0, 0, -40), false, now.AddDate(0, 0, -47))
+	}
+	add("expired-recently", now.AddDate(0, 0, -3), false, now.AddDate(0, 0, -10))
+	add("revoked-long-ago", now.AddDate(0, 0, 20), true, now.AddDate(0, 0, -31))
+	add("revoked-recently", now.AddDate(0, 0, 20), true, now.AddDate(0, 0, -1))
+	add("active", now.AddDate(0, 0, 7), false, now.AddDate(0, 0, -60))
+
+	if n, err := Count(gdb, cutoff); err != nil || n != 6 {
+		t.Fatalf("count = %d, %v", n, err)
+	}
+	// a batch smaller than the backlog takes several rounds
+	if n, err := Prune(gdb, cutoff, 2); err != nil || n != 6 {
+		t.Fatalf("prune = %d, %v", n, err)
+	}
+	var left []string
+	gdb.Model(&models.RefreshToken{}).Order("token_hash").Pluck("token_hash", &left)
+	if fmt.Sprint(left) != "[active expired-recently revoked-recently]" {
+		t.Fatalf("left %v", left)
+	}
+	if n, _ := Prune(gdb, cutoff, 0); n != 0 {
+		t.Fatalf("second prune deleted %d", n)
+	}
+}
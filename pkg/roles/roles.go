@@ -0,0 +1,95 @@
+// Package roles defines the permissions a role can grant and loads the role
+// of a user. The built-in administrator and user roles always hold every
+// permission; administrators may create further roles with a subset of them
+// and per-role limits (see models.Role).
+package roles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Built-in role names.
+const (
+	Administrator = "administrator"
+	User          = "user"
+)
+
+// Permissions a role can grant.
+const (
+	PermUpload       = "upload"        // POST /uploads and region retries
+	PermCatatanWrite = "catatan_write" // manual catatan and confirmations
+	PermExport       = "export"        // GET /me/export
+)
+
+// All lists every permission.
+var All = []string{PermCatatanWrite, PermExport, PermUpload}
+
+// BuiltIn reports whether name is one of the seeded roles, which can be
+// neither renamed nor deleted.
+func BuiltIn(name string) bool { return name == Administrator || name == User }
+
+// Normalize validates perms and returns them in stored form: sorted, without
+// duplicates, comma-separated.
+func Normalize(perms []string) (string, error) {
+	set := map[string]bool{}
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if !valid(p) {
+			return "", fmt.Errorf("unknown permission %q", p)
+		}
+		set[p] = true
+	}
+	out := make([]string, 0, len(set))
+	for p := range set {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ","), nil
+}
+
+func valid(p string) bool {
+	for _, a := range All {
+		if a == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permission set of r.
+func Permissions(r models.Role) []string {
+	if BuiltIn(r.Name) {
+		return append([]string(nil), All...)
+	}
+	if r.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(r.Permissions, ",")
+}
+
+// Has reports whether r grants perm.
+func Has(r models.Role, perm string) bool {
+	for _, p := range Permissions(r) {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Of loads the role of u; users without one get the built-in user role.
+func Of(gdb *gorm.DB, u models.User) (models.Role, error) {
+	var r models.Role
+	q := gdb.Where("name = ?", User)
+	if u.RoleID != nil {
+		q = gdb.Where("id = ?", *u.RoleID)
+	}
+	err := q.First(&r).Error
+	return r, err
+}
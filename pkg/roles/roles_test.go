@@ -0,0 +1,42 @@
+package roles
+
+import (
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestPermissions(t *testing.T) {
+	if _, err := Normalize([]string{"upload", "fly"}); err == nil {
+		t.Fatal("unknown permission accepted")
+	}
+	stored, err := Normalize([]string{"upload", " export", "upload"})
+	if err != nil || stored != "export,upload" {
+		t.Fatalf("Normalize = %q, %v", stored, err)
+	}
+	viewer := models.Role{Name: "viewer", Permissions: "export"}
+	if Has(viewer, PermUpload) || !Has(viewer, PermExport) {
+		t.Fatalf("viewer permissions: %v", Permissions(viewer))
+	}
+	if !Has(models.Role{Name: User}, PermUpload) {
+		t.Fatal("built-in user role must hold every permission")
+	}
+	if len(Permissions(models.Role{Name: "empty"})) != 0 {
+		t.Fatal("a custom role without permissions grants nothing")
+	}
+}
+
+func TestOf(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "ani", Password: "secret1", Role: "user"}}})
+	var u models.User
+	gdb.Where("username = ?", "ani").First(&u)
+	if r, err := Of(gdb, u); err != nil || r.Name != User {
+		t.Fatalf("role of ani = %+v, %v", r, err)
+	}
+	u.RoleID = nil
+	if r, err := Of(gdb, u); err != nil || r.Name != User {
+		t.Fatalf("user without role_id = %+v, %v", r, err)
+	}
+}
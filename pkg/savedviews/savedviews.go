@@ -0,0 +1,114 @@
+// Package savedviews holds the catatan filters users save under a name and
+// apply by id on catatan lists, exports and reports.
+package savedviews
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Limits on one Filter.
+const (
+	MaxCategories = 50
+	MaxAccounts   = 50
+)
+
+// Filter selects catatan. Empty fields select everything.
+type Filter struct {
+	From       string   `json:"from,omitempty"` // YYYY-MM-DD in the user's timezone, inclusive
+	To         string   `json:"to,omitempty"`   // YYYY-MM-DD, inclusive
+	Categories []string `json:"categories,omitempty"`
+	AccountIDs []uint   `json:"account_ids,omitempty"`
+	MinAmount  *int64   `json:"min_amount,omitempty"`
+}
+
+// Parse reads the Filters of a models.SavedView.
+func Parse(s string) (Filter, error) {
+	var f Filter
+	err := json.Unmarshal([]byte(s), &f)
+	return f, err
+}
+
+// String is the JSON stored in models.SavedView.Filters.
+func (f Filter) String() string {
+	b, _ := json.Marshal(f)
+	return string(b)
+}
+
+// Normalize trims the categories, dropping empty and repeated ones (case
+// insensitively), and reports the first invalid field.
+func (f *Filter) Normalize() error {
+	seen := map[string]bool{}
+	cats := f.Categories[:0]
+	for _, c := range f.Categories {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[strings.ToLower(c)] {
+			continue
+		}
+		if len(c) > 64 {
+			return errors.New("categories must be at most 64 characters each")
+		}
+		seen[strings.ToLower(c)] = true
+		cats = append(cats, c)
+	}
+	f.Categories = cats
+	switch {
+	case len(f.Categories) > MaxCategories:
+		return fmt.Errorf("at most %d categories", MaxCategories)
+	case len(f.AccountIDs) > MaxAccounts:
+		return fmt.Errorf("at most %d account_ids", MaxAccounts)
+	}
+	from, to, err := f.Dates(time.UTC)
+	if err != nil {
+		return err
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return errors.New("from is after to")
+	}
+	return nil
+}
+
+// Dates are From and To as half-open [from, to) bounds in loc; nil when unset.
+func (f Filter) Dates(loc *time.Location) (from, to *time.Time, err error) {
+	if f.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", f.From, loc)
+		if err != nil {
+			return nil, nil, errors.New("from must be YYYY-MM-DD")
+		}
+		from = &t
+	}
+	if f.To != "" {
+		t, err := time.ParseInLocation("2006-01-02", f.To, loc)
+		if err != nil {
+			return nil, nil, errors.New("to must be YYYY-MM-DD")
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	return from, to, nil
+}
+
+// Scope limits a catatan query to the categories, accounts and minimum
+// amount of f, for gorm's Scopes; the dates are left to the caller, who may
+// have others. Categories match case-insensitively.
+func (f Filter) Scope(q *gorm.DB) *gorm.DB {
+	if len(f.Categories) > 0 {
+		lower := make([]string, len(f.Categories))
+		for i, c := range f.Categories {
+			lower[i] = strings.ToLower(c)
+		}
+		q = q.Where("LOWER(category) IN ?", lower)
+	}
+	if len(f.AccountIDs) > 0 {
+		q = q.Where("account_id IN ?", f.AccountIDs)
+	}
+	if f.MinAmount != nil {
+		q = q.Where("amount >= ?", *f.MinAmount)
+	}
+	return q
+}
@@ -0,0 +1,64 @@
+package savedviews
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestNormalize(t *testing.T) {
+	f := Filter{Categories: []string{" Makan ", "makan", "", "Transport"}}
+	if err := f.Normalize(); err != nil || len(f.Categories) != 2 || f.Categories[0] != "Makan" {
+		t.Fatalf("categories: %v, %v", f.Categories, err)
+	}
+	for _, bad := range []Filter{{From: "2025-13-01"}, {From: "2025-09-01", To: "2025-08-31"}, {To: "kemarin"}} {
+		if err := bad.Normalize(); err == nil {
+			t.Errorf("%+v: no error", bad)
+		}
+	}
+	if f := (Filter{From: "2025-09-01", To: "2025-09-01"}); f.Normalize() != nil {
+		t.Error("a one-day range is valid")
+	}
+	back, err := Parse(Filter{From: "2025-07-01", AccountIDs: []uint{3}}.String())
+	if err != nil || back.From != "2025-07-01" || back.AccountIDs[0] != 3 {
+		t.Fatalf("round trip: %+v, %v", back, err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}},
+		Catatan: []fixtures.Catatan{
+			{User: "demo", FileName: "a", Amount: 10000, Date: "2025-08-01"},
+			{User: "demo", FileName: "b", Amount: 50000, Date: "2025-08-02"},
+			{User: "demo", FileName: "c", Amount: 70000, Date: "2025-08-03"},
+		},
+	})
+	acct := uint(7)
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name IN ?", []string{"a", "b"}).Update("category", "Makan")
+	gdb.Model(&models.CatatanKeuangan{}).Where("file_name = ?", "b").Update("account_id", acct)
+	min := int64(20000)
+	for _, tc := range []struct {
+		f    Filter
+		want int64
+	}{
+		{Filter{}, 3},
+		{Filter{Categories: []string{"makan"}}, 2},
+		{Filter{Categories: []string{"makan"}, MinAmount: &min}, 1},
+		{Filter{AccountIDs: []uint{acct}}, 1},
+		{Filter{MinAmount: &min}, 2},
+	} {
+		var n int64
+		gdb.Model(&models.CatatanKeuangan{}).Scopes(tc.f.Scope).Count(&n)
+		if n != tc.want {
+			t.Errorf("%+v: %d catatan, want %d", tc.f, n, tc.want)
+		}
+	}
+	from, to, err := Filter{From: "2025-08-01", To: "2025-08-31"}.Dates(time.UTC)
+	if err != nil || !to.Equal(from.AddDate(0, 1, 0)) {
+		t.Fatalf("dates: %v %v %v", from, to, err)
+	}
+}
@@ -0,0 +1,291 @@
+// Package scheduler runs background jobs on cron-style schedules. Before a
+// run a server takes the job's lease in job_locks, so with several replicas a
+// job runs on one of them, once per scheduled time; every run is recorded in
+// job_runs. Runs missed while no server was up are not caught up.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/models"
+	"be03/pkg/errreport"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Func is a job's body. The summary it returns ("pruned 12 tokens") is kept
+// with the run.
+type Func func(ctx context.Context) (string, error)
+
+// Job is a registered job.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    Schedule
+	// Timeout bounds a run: its context is cancelled and the lease expires
+	// after it (default DefaultTimeout).
+	Timeout time.Duration
+	Run     Func
+}
+
+// DefaultTimeout applies to jobs without a Timeout.
+const DefaultTimeout = time.Hour
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Run states.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrUnknownJob = errors.New("scheduler: unknown job")
+	// ErrBusy is returned by Trigger while the job runs somewhere.
+	ErrBusy = errors.New("scheduler: job is running")
+)
+
+var nameRE = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+// Scheduler holds the registered jobs of one server.
+type Scheduler struct {
+	// Owner names this server in leases and runs (default host:pid).
+	Owner string
+	// Retention is how long runs are kept (default 30 days).
+	Retention time.Duration
+
+	db   *gorm.DB
+	mu   sync.Mutex
+	jobs map[string]Job
+	wg   sync.WaitGroup
+	now  func() time.Time
+}
+
+// New returns a scheduler storing leases and runs in gdb.
+func New(gdb *gorm.DB) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{Owner: fmt.Sprintf("%s:%d", host, os.Getpid()), Retention: 30 * 24 * time.Hour, db: gdb, jobs: map[string]Job{}, now: time.Now}
+}
+
+// Register adds j. Names are lower-case identifiers and unique.
+func (s *Scheduler) Register(j Job) error {
+	if !nameRE.MatchString(j.Name) {
+		return fmt.Errorf("scheduler: invalid job name %q", j.Name)
+	}
+	if j.Schedule == nil || j.Run == nil {
+		return fmt.Errorf("scheduler: job %s needs a schedule and a func", j.Name)
+	}
+	if j.Timeout <= 0 {
+		j.Timeout = DefaultTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.jobs[j.Name]; dup {
+		return fmt.Errorf("scheduler: job %s registered twice", j.Name)
+	}
+	s.jobs[j.Name] = j
+	return nil
+}
+
+// Jobs returns the registered jobs by name.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// Job returns the job called name.
+func (s *Scheduler) Job(name string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	return j, ok
+}
+
+// Start runs the jobs on their schedules until ctx is done. Register every
+// job before calling it.
+func (s *Scheduler) Start(ctx context.Context) {
+	jobs := s.Jobs()
+	if len(jobs) == 0 {
+		return
+	}
+	next := make(map[string]time.Time, len(jobs))
+	for _, j := range jobs {
+		next[j.Name] = j.Schedule.Next(s.now())
+	}
+	for {
+		var due time.Time
+		for _, t := range next {
+			if due.IsZero() || t.Before(due) {
+				due = t
+			}
+		}
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, j := range jobs {
+			if slot := next[j.Name]; !slot.After(s.now()) {
+				next[j.Name] = j.Schedule.Next(slot)
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					s.scheduled(ctx, j, slot)
+				}()
+			}
+		}
+	}
+}
+
+// Wait blocks until the runs started by this scheduler have finished.
+func (s *Scheduler) Wait() { s.wg.Wait() }
+
+// scheduled runs j for slot unless another server already claimed it.
+func (s *Scheduler) scheduled(ctx context.Context, j Job, slot time.Time) {
+	ok, err := s.acquire(j, slot.Unix())
+	if err != nil {
+		log.Printf("scheduler: %s: taking the lease failed: %v", j.Name, err)
+		return
+	}
+	if !ok {
+		return // running elsewhere or already done for this slot
+	}
+	run, err := s.begin(j, TriggerSchedule, nil)
+	if err != nil {
+		log.Printf("scheduler: %s: recording the run failed: %v", j.Name, err)
+		s.release(j.Name)
+		return
+	}
+	s.execute(ctx, j, run)
+}
+
+// Trigger starts j now, outside its schedule, and returns the run it
+// recorded. by is the administrator asking for it.
+func (s *Scheduler) Trigger(ctx context.Context, name string, by *uint) (models.JobRun, error) {
+	j, ok := s.Job(name)
+	if !ok {
+		return models.JobRun{}, ErrUnknownJob
+	}
+	ok, err := s.acquire(j, 0)
+	if err != nil {
+		return models.JobRun{}, err
+	}
+	if !ok {
+		return models.JobRun{}, ErrBusy
+	}
+	run, err := s.begin(j, TriggerManual, by)
+	if err != nil {
+		s.release(j.Name)
+		return models.JobRun{}, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		// the run outlives the request that asked for it
+		s.execute(context.WithoutCancel(ctx), j, run)
+	}()
+	return *run, nil
+}
+
+// acquire takes j's lease unless it is held; for a scheduled run (slot > 0)
+// also unless the slot was already claimed.
+func (s *Scheduler) acquire(j Job, slot int64) (bool, error) {
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.JobLock{Name: j.Name}).Error; err != nil {
+		return false, err
+	}
+	now := s.now()
+	q := s.db.Model(&models.JobLock{}).Where("name = ? AND locked_until <= ?", j.Name, now.Unix())
+	set := map[string]any{"owner": s.Owner, "locked_until": now.Add(j.Timeout).Unix()}
+	if slot > 0 {
+		q = q.Where("last_slot < ?", slot)
+		set["last_slot"] = slot
+	}
+	res := q.Updates(set)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *Scheduler) release(name string) {
+	err := s.db.Model(&models.JobLock{}).Where("name = ? AND owner = ?", name, s.Owner).Update("locked_until", 0).Error
+	if err != nil {
+		log.Printf("scheduler: %s: releasing the lease failed: %v", name, err)
+	}
+}
+
+func (s *Scheduler) begin(j Job, trigger string, by *uint) (*models.JobRun, error) {
+	run := &models.JobRun{Job: j.Name, Trigger: trigger, Owner: s.Owner, TriggeredBy: by, StartedAt: s.now(), Status: StatusRunning}
+	return run, s.db.Create(run).Error
+}
+
+// execute runs j under its lease, records the outcome and prunes old runs.
+func (s *Scheduler) execute(ctx context.Context, j Job, run *models.JobRun) {
+	defer s.release(j.Name)
+	ctx, cancel := context.WithTimeout(ctx, j.Timeout)
+	defer cancel()
+	result, err := func() (result string, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return j.Run(ctx)
+	}()
+	finished := s.now()
+	run.FinishedAt, run.Status, run.Result = &finished, StatusSucceeded, truncate(result, 512)
+	if err != nil {
+		run.Status, run.Error = StatusFailed, truncate(err.Error(), 1024)
+		log.Printf("scheduler: %s failed after %s: %v", j.Name, finished.Sub(run.StartedAt).Round(time.Millisecond), err)
+		errreport.Capture(errreport.Event{Message: "job " + j.Name + " failed", Err: err, Tags: map[string]string{"kind": "job", "job": j.Name, "trigger": run.Trigger}})
+	} else if result != "" {
+		log.Printf("scheduler: %s: %s", j.Name, result)
+	}
+	if err := s.db.Select("finished_at", "status", "result", "error").Updates(run).Error; err != nil {
+		log.Printf("scheduler: %s: recording the outcome failed: %v", j.Name, err)
+	}
+	if s.Retention > 0 {
+		s.db.Where("job = ? AND started_at < ?", j.Name, finished.Add(-s.Retention)).Delete(&models.JobRun{})
+	}
+}
+
+// Runs returns the latest runs of a job, newest first.
+func (s *Scheduler) Runs(name string, limit int) ([]models.JobRun, error) {
+	var runs []models.JobRun
+	err := s.db.Where("job = ?", name).Order("started_at DESC, id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// Lock returns the lease row of a job; zero when it never ran.
+func (s *Scheduler) Lock(name string) (models.JobLock, error) {
+	var l models.JobLock
+	err := s.db.Where("name = ?", name).Limit(1).Find(&l).Error
+	return l, err
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+)
+
+func TestParse(t *testing.T) {
+	loc := time.FixedZone("WIB", 7*3600)
+	from := time.Date(2026, 3, 14, 10, 17, 30, 0, loc) // a Saturday
+	cases := []struct{ spec, want string }{
+		{"*/15 * * * *", "2026-03-14 10:30"},
+		{"5 * * * *", "2026-03-14 11:05"},
+		{"0 3 * * *", "2026-03-15 03:00"},
+		{"30 9 * * 1-5", "2026-03-16 09:30"},
+		{"0 0 1 * *", "2026-04-01 00:00"},
+		{"0 12 * * 7", "2026-03-15 12:00"},
+		{"0 8 13 * 5", "2026-03-20 08:00"}, // the 13th or a Friday
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		{"@daily", "2026-03-15 00:00"},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.spec, loc)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.spec, err)
+			continue
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != c.want {
+			t.Errorf("%q.Next = %s, want %s", c.spec, got, c.want)
+		}
+	}
+	every, err := Parse("@every 2h", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := every.Next(time.Unix(7300, 0)); got.Unix() != 14400 {
+		t.Errorf("@every 2h next = %d", got.Unix())
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 31 2 *", "@every 10s", "@yearly-ish"} {
+		if _, err := Parse(bad, loc); err == nil {
+			t.Errorf("Parse(%q) accepted", bad)
+		}
+	}
+}
+
+func newTestScheduler(t *testing.T, owner string, run Func) *Scheduler {
+	t.Helper()
+	s := New(testenv.OpenDB(t))
+	s.Owner = owner
+	every, _ := Parse("@every 1h", nil)
+	if err := s.Register(Job{Name: "sweep", Schedule: every, Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOneRunPerSlotAcrossServers(t *testing.T) {
+	var runs atomic.Int32
+	a := newTestScheduler(t, "a", func(context.Context) (string, error) { runs.Add(1); return "swept", nil })
+	// a second server on the same database
+	b := New(a.db)
+	b.Owner = "b"
+	j, _ := a.Job("sweep")
+	b.Register(j)
+
+	slot := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	a.scheduled(context.Background(), j, slot)
+	b.scheduled(context.Background(), j, slot)
+	if runs.Load() != 1 {
+		t.Fatalf("slot ran %d times", runs.Load())
+	}
+	b.scheduled(context.Background(), j, slot.Add(time.Hour))
+	if runs.Load() != 2 {
+		t.Fatalf("next slot ran %d times in total", runs.Load())
+	}
+	var rows []models.JobRun
+	a.db.Order("id").Find(&rows)
+	if len(rows) != 2 || rows[0].Owner != "a" || rows[1].Owner != "b" || rows[0].Status != StatusSucceeded || rows[0].Result != "swept" || rows[0].FinishedAt == nil {
+		t.Fatalf("runs = %+v", rows)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	release := make(chan struct{})
+	s := newTestScheduler(t, "a", func(ctx context.Context) (string, error) {
+		<-release
+		return "", errors.New("disk full")
+	})
+	admin := uint(1)
+	run, err := s.Trigger(context.Background(), "sweep", &admin)
+	if err != nil || run.Status != StatusRunning || run.Trigger != TriggerManual {
+		t.Fatalf("trigger: %+v %v", run, err)
+	}
+	if _, err := s.Trigger(context.Background(), "sweep", &admin); !errors.Is(err, ErrBusy) {
+		t.Fatalf("second trigger while running: %v", err)
+	}
+	// a scheduled slot during the manual run is skipped, not queued
+	j, _ := s.Job("sweep")
+	s.scheduled(context.Background(), j, time.Now())
+	if _, err := s.Trigger(context.Background(), "nope", nil); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("unknown job: %v", err)
+	}
+	close(release)
+	s.Wait()
+
+	runs, _ := s.Runs("sweep", 10)
+	if len(runs) != 1 || runs[0].Status != StatusFailed || runs[0].Error != "disk full" || *runs[0].TriggeredBy != admin {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if l, _ := s.Lock("sweep"); l.LockedUntil != 0 {
+		t.Fatalf("lease not released: %+v", l)
+	}
+}
+
+func TestPanicAndRetention(t *testing.T) {
+	s := newTestScheduler(t, "a", func(context.Context) (string, error) { panic("nil map") })
+	old := models.JobRun{Job: "sweep", Trigger: TriggerSchedule, StartedAt: time.Now().AddDate(0, -2, 0), Status: StatusSucceeded}
+	s.db.Create(&old)
+	j, _ := s.Job("sweep")
+	s.scheduled(context.Background(), j, time.Now())
+
+	runs, _ := s.Runs("sweep", 10)
+	if len(runs) != 1 || runs[0].Status != StatusFailed || runs[0].Error != "panic: nil map" {
+		t.Fatalf("runs = %+v", runs)
+	}
+}
@@ -0,0 +1,318 @@
+// Package schemadoctor compares a database with the models: missing tables,
+// columns, indexes and foreign keys, columns of another type, and rows that
+// point at rows which are gone. Each finding carries the SQL that fixes it;
+// the additive ones (creating what is missing) are safe to apply, the others
+// change or delete data and are left to an operator.
+package schemadoctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Finding kinds.
+const (
+	MissingTable  = "missing_table"
+	MissingColumn = "missing_column"
+	ColumnType    = "column_type"
+	MissingIndex  = "missing_index"
+	MissingFK     = "missing_fk"
+	Orphans       = "orphans"
+)
+
+// Finding is one difference between the database and the models.
+type Finding struct {
+	Kind   string `json:"kind"`
+	Table  string `json:"table"`
+	Name   string `json:"name,omitempty"` // column, index or constraint
+	Detail string `json:"detail"`
+	Fix    string `json:"fix"`
+	// Safe fixes only create what is missing; Apply runs them.
+	Safe bool `json:"safe"`
+
+	model any
+}
+
+func (f Finding) String() string {
+	name := f.Table
+	if f.Name != "" {
+		name += "." + f.Name
+	}
+	return fmt.Sprintf("%s %s: %s", f.Kind, name, f.Detail)
+}
+
+// Reference is a column holding the id of a row of another table, whether or
+// not the schema declares a foreign key for it; rows whose id is found in
+// none of Refs are orphans.
+type Reference struct {
+	Model  any
+	Column string
+	Refs   []any
+}
+
+// References are the id columns checked for orphans besides the declared
+// foreign keys. Uploads may point at archived catatan; tenant_id 0 is the
+// default tenant and is not a reference.
+var References = []Reference{
+	{&models.CatatanKeuangan{}, "user_id", []any{&models.User{}}},
+	{&models.CatatanKeuangan{}, "account_id", []any{&models.Account{}}},
+	{&models.CatatanArchive{}, "user_id", []any{&models.User{}}},
+	{&models.Upload{}, "keuangan_id", []any{&models.CatatanKeuangan{}, &models.CatatanArchive{}}},
+	{&models.UploadOCRText{}, "upload_id", []any{&models.Upload{}}},
+	{&models.UploadItem{}, "upload_id", []any{&models.Upload{}}},
+	{&models.UploadPHashBand{}, "upload_id", []any{&models.Upload{}}},
+	{&models.UploadNote{}, "upload_id", []any{&models.Upload{}}},
+	{&models.OCRShadowRun{}, "profile_id", []any{&models.Profile{}}},
+	{&models.RefreshToken{}, "user_id", []any{&models.User{}}},
+	{&models.APIToken{}, "user_id", []any{&models.User{}}},
+	{&models.Account{}, "user_id", []any{&models.User{}}},
+	{&models.Goal{}, "user_id", []any{&models.User{}}},
+	{&models.Notification{}, "user_id", []any{&models.User{}}},
+	{&models.NotificationDelivery{}, "notification_id", []any{&models.Notification{}}},
+	{&models.OrgMembership{}, "org_id", []any{&models.Organization{}}},
+	{&models.OrgMembership{}, "user_id", []any{&models.User{}}},
+	{&models.OrgInvite{}, "org_id", []any{&models.Organization{}}},
+	{&models.PeriodLock{}, "user_id", []any{&models.User{}}},
+	{&models.UsernameHistory{}, "user_id", []any{&models.User{}}},
+}
+
+// Check compares the database with the models (see models.All).
+func Check(gdb *gorm.DB, all []any) ([]Finding, error) {
+	var out []Finding
+	orphaned := map[string]bool{} // table.column with orphans
+	for _, r := range references(gdb, all) {
+		if !gdb.Migrator().HasTable(r.table) {
+			continue
+		}
+		f, err := checkOrphans(gdb, r)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			out = append(out, *f)
+			orphaned[r.table+"."+r.column] = true
+		}
+	}
+	for _, m := range all {
+		s, err := parse(gdb, m)
+		if err != nil {
+			return nil, err
+		}
+		mig := gdb.Migrator()
+		if !mig.HasTable(m) {
+			out = append(out, Finding{Kind: MissingTable, Table: s.Table, Detail: "table does not exist", Fix: fixSQL(gdb, func(mg gorm.Migrator) error { return mg.CreateTable(m) }), Safe: true, model: m})
+			continue
+		}
+		types := map[string]string{}
+		if cols, err := mig.ColumnTypes(m); err == nil {
+			for _, c := range cols {
+				types[c.Name()] = c.DatabaseTypeName()
+			}
+		}
+		for _, field := range s.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			have, ok := types[field.DBName]
+			if !ok {
+				out = append(out, Finding{Kind: MissingColumn, Table: s.Table, Name: field.DBName, Detail: "column does not exist", Fix: fixSQL(gdb, func(mg gorm.Migrator) error { return mg.AddColumn(m, field.Name) }), Safe: true, model: m})
+				continue
+			}
+			want := mig.FullDataTypeOf(field).SQL
+			if family(have) != family(want) {
+				out = append(out, Finding{Kind: ColumnType, Table: s.Table, Name: field.DBName,
+					Detail: fmt.Sprintf("column is %s, the model wants %s", strings.ToLower(have), strings.Fields(want)[0]),
+					Fix:    fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", s.Table, field.DBName, strings.Fields(want)[0], field.DBName, strings.Fields(want)[0])})
+			}
+		}
+		for _, idx := range s.ParseIndexes() {
+			if !mig.HasIndex(m, idx.Name) {
+				name := idx.Name
+				out = append(out, Finding{Kind: MissingIndex, Table: s.Table, Name: name, Detail: "index does not exist", Fix: fixSQL(gdb, func(mg gorm.Migrator) error { return mg.CreateIndex(m, name) }), Safe: true, model: m})
+			}
+		}
+		for _, c := range constraints(s) {
+			if mig.HasConstraint(m, c.Name) {
+				continue
+			}
+			name := c.Name
+			f := Finding{Kind: MissingFK, Table: s.Table, Name: name, Detail: fmt.Sprintf("foreign key %s -> %s does not exist", c.ForeignKeys[0].DBName, c.ReferenceSchema.Table), Fix: fixSQL(gdb, func(mg gorm.Migrator) error { return mg.CreateConstraint(m, name) }), Safe: true, model: m}
+			if orphaned[s.Table+"."+c.ForeignKeys[0].DBName] {
+				f.Detail += "; remove the orphans first"
+				f.Safe = false
+			}
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// Apply runs the fixes of the safe findings, tables first, and returns how
+// many it applied.
+func Apply(gdb *gorm.DB, findings []Finding) (int, error) {
+	n := 0
+	for _, kind := range []string{MissingTable, MissingColumn, MissingIndex, MissingFK} {
+		for _, f := range findings {
+			if f.Kind != kind || !f.Safe {
+				continue
+			}
+			var err error
+			mig := gdb.Migrator()
+			switch kind {
+			case MissingTable:
+				err = mig.CreateTable(f.model)
+			case MissingColumn:
+				s, _ := parse(gdb, f.model)
+				err = mig.AddColumn(f.model, s.LookUpField(f.Name).Name)
+			case MissingIndex:
+				err = mig.CreateIndex(f.model, f.Name)
+			case MissingFK:
+				err = mig.CreateConstraint(f.model, f.Name)
+			}
+			if err != nil {
+				return n, fmt.Errorf("%s: %w", f, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func parse(gdb *gorm.DB, m any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: gdb}
+	if err := stmt.Parse(m); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// constraints are the foreign keys AutoMigrate creates for s.
+func constraints(s *schema.Schema) []*schema.Constraint {
+	var out []*schema.Constraint
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field.IgnoreMigration {
+			continue
+		}
+		if c := rel.ParseConstraint(); c != nil && c.Schema == s && len(c.ForeignKeys) == 1 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+type reference struct {
+	table, column string
+	nullable      bool
+	refs          []string // tables, referenced by id
+}
+
+// references are References plus the declared foreign keys.
+func references(gdb *gorm.DB, all []any) []reference {
+	seen := map[string]bool{}
+	var out []reference
+	add := func(s *schema.Schema, column string, refs []string) {
+		if seen[s.Table+"."+column] {
+			return
+		}
+		seen[s.Table+"."+column] = true
+		f := s.LookUpField(column)
+		out = append(out, reference{table: s.Table, column: column, nullable: f != nil && !f.NotNull && !f.PrimaryKey, refs: refs})
+	}
+	for _, m := range all {
+		s, err := parse(gdb, m)
+		if err != nil {
+			continue
+		}
+		for _, c := range constraints(s) {
+			add(s, c.ForeignKeys[0].DBName, []string{c.ReferenceSchema.Table})
+		}
+	}
+	for _, r := range References {
+		s, err := parse(gdb, r.Model)
+		if err != nil {
+			continue
+		}
+		var refs []string
+		for _, m := range r.Refs {
+			if rs, err := parse(gdb, m); err == nil {
+				refs = append(refs, rs.Table)
+			}
+		}
+		add(s, r.Column, refs)
+	}
+	return out
+}
+
+func checkOrphans(gdb *gorm.DB, r reference) (*Finding, error) {
+	cond := fmt.Sprintf("%s IS NOT NULL", r.column)
+	for _, ref := range r.refs {
+		if !gdb.Migrator().HasTable(ref) {
+			return nil, nil
+		}
+		cond += fmt.Sprintf(" AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.id = %s.%s)", ref, r.table, r.column)
+	}
+	var n int64
+	if err := gdb.Table(r.table).Where(cond).Count(&n).Error; err != nil {
+		return nil, fmt.Errorf("orphans in %s.%s: %w", r.table, r.column, err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	fix := fmt.Sprintf("DELETE FROM %s WHERE %s", r.table, cond)
+	if r.nullable {
+		fix = fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s", r.table, r.column, cond)
+	}
+	return &Finding{Kind: Orphans, Table: r.table, Name: r.column, Detail: fmt.Sprintf("%d rows point at no %s row", n, strings.Join(r.refs, " or ")), Fix: fix}, nil
+}
+
+// family groups database types that hold the same kind of value, so
+// spellings (int8, bigint, integer) do not count as a difference.
+func family(t string) string {
+	t = strings.ToLower(t)
+	switch {
+	case strings.Contains(t, "bool"):
+		return "bool"
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		return "int"
+	case strings.Contains(t, "char") || strings.Contains(t, "text") || strings.Contains(t, "clob") || strings.Contains(t, "uuid"):
+		return "string"
+	case strings.Contains(t, "time") || strings.Contains(t, "date"):
+		return "time"
+	case strings.Contains(t, "real") || strings.Contains(t, "double") || strings.Contains(t, "float") || strings.Contains(t, "numeric") || strings.Contains(t, "decimal"):
+		return "number"
+	case strings.Contains(t, "bytea") || strings.Contains(t, "blob"):
+		return "bytes"
+	}
+	return t
+}
+
+// fixSQL is the SQL run executes, captured from a dry-run session.
+func fixSQL(gdb *gorm.DB, run func(gorm.Migrator) error) string {
+	rec := &recorder{}
+	dry := gdb.Session(&gorm.Session{DryRun: true, Logger: rec})
+	if err := run(dry.Migrator()); err != nil && len(rec.sql) == 0 {
+		return "-- " + err.Error()
+	}
+	return strings.Join(rec.sql, ";\n")
+}
+
+// recorder is a logger keeping the statements traced.
+type recorder struct{ sql []string }
+
+func (r *recorder) LogMode(logger.LogLevel) logger.Interface { return r }
+func (r *recorder) Info(context.Context, string, ...any)     {}
+func (r *recorder) Warn(context.Context, string, ...any)     {}
+func (r *recorder) Error(context.Context, string, ...any)    {}
+func (r *recorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	if sql, _ := fc(); sql != "" && !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "SELECT") {
+		r.sql = append(r.sql, sql)
+	}
+}
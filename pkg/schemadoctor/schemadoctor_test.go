@@ -0,0 +1,62 @@
+package schemadoctor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+)
+
+func TestCheckAndApply(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	if findings, err := Check(gdb, models.All()); err != nil || len(findings) != 0 {
+		t.Fatalf("fresh database: %v %v", findings, err)
+	}
+
+	mig := gdb.Migrator()
+	if err := mig.DropIndex(&models.Goal{}, "idx_goals_user_id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mig.DropColumn(&models.Tenant{}, "logo_url"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mig.DropTable(&models.UploadItem{}); err != nil {
+		t.Fatal(err)
+	}
+	gdb.Create(&models.CatatanKeuangan{UserID: 9999, FileName: "ghost.jpg", Amount: 1, Date: time.Now()})
+
+	findings, err := Check(gdb, models.All())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Finding{}
+	for _, f := range findings {
+		got[f.Kind+" "+f.Table+"."+f.Name] = f
+	}
+	// SQLite drops a table's indexes with a column
+	want := []string{"missing_index goals.idx_goals_user_id", "missing_column tenants.logo_url", "missing_index tenants.idx_tenants_slug", "missing_table upload_items.", "orphans catatan_keuangans.user_id"}
+	if len(got) != len(want) {
+		t.Fatalf("findings = %v", findings)
+	}
+	for _, k := range want {
+		if _, ok := got[k]; !ok {
+			t.Fatalf("missing %s in %v", k, findings)
+		}
+	}
+	if f := got["missing_index goals.idx_goals_user_id"]; !f.Safe || !strings.Contains(f.Fix, "CREATE INDEX") {
+		t.Fatalf("index fix = %+v", f)
+	}
+	if f := got["orphans catatan_keuangans.user_id"]; f.Safe || !strings.HasPrefix(f.Fix, "DELETE FROM catatan_keuangans") {
+		t.Fatalf("orphan fix = %+v", f)
+	}
+
+	if n, err := Apply(gdb, findings); err != nil || n != 4 {
+		t.Fatalf("apply = %d, %v", n, err)
+	}
+	findings, _ = Check(gdb, models.All())
+	if len(findings) != 1 || findings[0].Kind != Orphans {
+		t.Fatalf("after apply: %v", findings)
+	}
+}
@@ -0,0 +1,164 @@
+// Package secheaders sets the browser hardening headers on every response:
+// X-Content-Type-Options, X-Frame-Options, Referrer-Policy, HSTS on TLS
+// connections and a Content-Security-Policy. JSON responses get a policy that
+// allows nothing; HTML responses get one that only allows same-origin assets.
+package secheaders
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCSP applies to API responses, which never load anything.
+const DefaultCSP = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// DefaultHTMLCSP applies to HTML pages: same-origin scripts, styles and images
+// only, no plugins, no framing.
+const DefaultHTMLCSP = "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+
+// Config selects the headers; an empty string leaves that header out.
+type Config struct {
+	Disabled       bool
+	FrameOptions   string
+	ReferrerPolicy string
+	// HSTSMaxAge is sent on TLS connections (directly or per
+	// X-Forwarded-Proto); zero disables HSTS.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	CSP                   string
+	HTMLCSP               string
+}
+
+// Default is the configuration without any environment overrides.
+func Default() Config {
+	return Config{
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		CSP:                   DefaultCSP,
+		HTMLCSP:               DefaultHTMLCSP,
+	}
+}
+
+// ConfigFromEnv applies SECURITY_HEADERS (off disables the middleware),
+// SECURITY_FRAME_OPTIONS, SECURITY_REFERRER_POLICY, SECURITY_HSTS_MAX_AGE
+// (seconds, 0 disables), SECURITY_HSTS_SUBDOMAINS, SECURITY_CSP and
+// SECURITY_CSP_HTML to Default. Setting a header variable to "off" drops it.
+func ConfigFromEnv() Config {
+	cfg := Default()
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SECURITY_HEADERS"))) {
+	case "off", "false", "0", "no":
+		cfg.Disabled = true
+	}
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"SECURITY_FRAME_OPTIONS", &cfg.FrameOptions},
+		{"SECURITY_REFERRER_POLICY", &cfg.ReferrerPolicy},
+		{"SECURITY_CSP", &cfg.CSP},
+		{"SECURITY_CSP_HTML", &cfg.HTMLCSP},
+	} {
+		switch s := strings.TrimSpace(os.Getenv(v.name)); {
+		case strings.EqualFold(s, "off"):
+			*v.dst = ""
+		case s != "":
+			*v.dst = s
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("SECURITY_HSTS_MAX_AGE")); err == nil && n >= 0 {
+		cfg.HSTSMaxAge = time.Duration(n) * time.Second
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SECURITY_HSTS_SUBDOMAINS"))) {
+	case "off", "false", "0", "no":
+		cfg.HSTSIncludeSubdomains = false
+	}
+	return cfg
+}
+
+// hsts is the Strict-Transport-Security value of cfg ("" when disabled).
+func (cfg Config) hsts() string {
+	if cfg.HSTSMaxAge <= 0 {
+		return ""
+	}
+	v := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+	if cfg.HSTSIncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	return v
+}
+
+// Middleware sets the headers of cfg before the handler runs; the
+// Content-Security-Policy is switched to HTMLCSP when the handler answers
+// with text/html.
+func Middleware(cfg Config) gin.HandlerFunc {
+	hsts := cfg.hsts()
+	return func(c *gin.Context) {
+		if cfg.Disabled {
+			c.Next()
+			return
+		}
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if cfg.FrameOptions != "" {
+			h.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if hsts != "" && (c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")) {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if cfg.CSP != "" {
+			h.Set("Content-Security-Policy", cfg.CSP)
+		}
+		if cfg.HTMLCSP != cfg.CSP {
+			c.Writer = &htmlWriter{ResponseWriter: c.Writer, csp: cfg.HTMLCSP}
+		}
+		c.Next()
+	}
+}
+
+// htmlWriter swaps in the HTML policy once the response turns out to be HTML.
+// gin only records the status in WriteHeader and sends the headers on the
+// first write, after renderers have set the Content-Type, so that is where
+// the type is checked.
+type htmlWriter struct {
+	gin.ResponseWriter
+	csp     string
+	checked bool
+}
+
+func (w *htmlWriter) check() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		if w.csp == "" {
+			w.Header().Del("Content-Security-Policy")
+		} else {
+			w.Header().Set("Content-Security-Policy", w.csp)
+		}
+	}
+}
+
+func (w *htmlWriter) WriteHeaderNow() {
+	w.check()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *htmlWriter) Write(b []byte) (int, error) {
+	w.check()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *htmlWriter) WriteString(s string) (int, error) {
+	w.check()
+	return w.ResponseWriter.WriteString(s)
+}
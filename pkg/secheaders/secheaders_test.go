@@ -0,0 +1,67 @@
+package secheaders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serve(t *testing.T, cfg Config, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(cfg))
+	r.GET("/json", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/page", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<p>hi</p>")) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	w := serve(t, Default(), httptest.NewRequest(http.MethodGet, "/json", nil))
+	for k, want := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": DefaultCSP,
+	} {
+		if got := w.Header().Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HSTS sent over plain HTTP: %q", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = serve(t, Default(), req)
+	if got := w.Header().Get("Content-Security-Policy"); got != DefaultHTMLCSP {
+		t.Errorf("HTML CSP = %q", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("HSTS = %q", got)
+	}
+
+	w = serve(t, Config{Disabled: true}, httptest.NewRequest(http.MethodGet, "/json", nil))
+	if got := w.Header().Get("X-Content-Type-Options"); got != "" {
+		t.Errorf("disabled middleware still set headers: %q", got)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SECURITY_FRAME_OPTIONS", "off")
+	t.Setenv("SECURITY_CSP", "default-src 'self'")
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "0")
+	cfg := ConfigFromEnv()
+	if cfg.FrameOptions != "" || cfg.CSP != "default-src 'self'" || cfg.hsts() != "" || cfg.ReferrerPolicy != "no-referrer" || cfg.Disabled {
+		t.Fatalf("config = %+v", cfg)
+	}
+	t.Setenv("SECURITY_HEADERS", "off")
+	if !ConfigFromEnv().Disabled {
+		t.Fatal("SECURITY_HEADERS=off did not disable the middleware")
+	}
+}
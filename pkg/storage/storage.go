@@ -0,0 +1,100 @@
+// Package storage reads receipt objects from external object stores
+// (S3, MinIO and compatible services) and signs URLs for clients to upload
+// them directly.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrNotFound is returned when the requested object does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Backend fetches objects by bucket and key.
+type Backend interface {
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// Presigner signs URLs a client can PUT an object to without credentials.
+type Presigner interface {
+	PresignPut(ctx context.Context, bucket, key string, expires time.Duration) (string, error)
+}
+
+// Config describes an S3-compatible endpoint.
+type Config struct {
+	Endpoint  string // host[:port], no scheme
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// ConfigFromEnv reads S3_ENDPOINT, S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION and
+// S3_USE_SSL (default true). ok is false when no endpoint is configured.
+func ConfigFromEnv() (cfg Config, ok bool) {
+	cfg = Config{
+		Endpoint:  strings.TrimSpace(os.Getenv("S3_ENDPOINT")),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		Region:    os.Getenv("S3_REGION"),
+		UseSSL:    true,
+	}
+	switch strings.ToLower(os.Getenv("S3_USE_SSL")) {
+	case "false", "0", "no":
+		cfg.UseSSL = false
+	}
+	return cfg, cfg.Endpoint != ""
+}
+
+// S3 is a Backend and Presigner for S3 and MinIO.
+type S3 struct {
+	client *minio.Client
+}
+
+// NewS3 connects to the endpoint described by cfg. No request is made until Get.
+func NewS3(cfg Config) (*S3, error) {
+	cl, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: cl}, nil
+}
+
+// Get opens the object for reading. The caller must close it.
+func (s *S3) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces missing objects before the caller reads.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// PresignPut returns a URL accepting a PUT of bucket/key until expires has
+// passed. Signing is local; the bucket is not contacted.
+func (s *S3) PresignPut(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, bucket, key, expires)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,48 @@
+// Package storagetest provides an in-memory storage.Backend for tests.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"be03/pkg/storage"
+)
+
+// Memory serves objects from a map keyed by bucket and key.
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// New returns an empty in-memory backend.
+func New() *Memory {
+	return &Memory{objects: map[string][]byte{}}
+}
+
+// Put stores data under bucket/key.
+func (m *Memory) Put(bucket, key string, data []byte) *Memory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[bucket+"/"+key] = data
+	return m
+}
+
+// Get implements storage.Backend.
+func (m *Memory) Get(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// PresignPut implements storage.Presigner with a memory:// URL; tests Put the
+// object themselves.
+func (m *Memory) PresignPut(_ context.Context, bucket, key string, _ time.Duration) (string, error) {
+	return "memory://" + bucket + "/" + key, nil
+}
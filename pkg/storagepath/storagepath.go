@@ -0,0 +1,54 @@
+// Package storagepath decides where receipts live on disk and the store
+// paths their uploads record. The API, the watcher, the importers and the
+// seeding and relocation tools all go through it, so a file one of them
+// writes is where the others look.
+package storagepath
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Receipt directories, slash-separated and relative to the server's working
+// directory.
+const (
+	Root      = "public"
+	Pending   = "public/keu"       // received, waiting for the watcher
+	Processed = "public/processed" // read by the watcher
+	Failed    = "public/failed"    // OCR could not read them
+)
+
+// DiskName is the name a receipt of profileID is stored under in Pending,
+// Processed, Failed and the originals directory: its file name prefixed with
+// the profile id, so two users' IMG_0001.jpg do not overwrite each other.
+// Upload.FileName keeps the name the user sent.
+func DiskName(profileID uint, fileName string) string {
+	return fmt.Sprintf("%d_%s", profileID, filepath.Base(fileName))
+}
+
+// StorePath is the Upload.StorePath of a new receipt: its DiskName in
+// Pending. It keeps that store path once the watcher moves the file on.
+func StorePath(profileID uint, fileName string) string {
+	return path.Join(Pending, DiskName(profileID, fileName))
+}
+
+// Of is the store path of a file in a directory the watcher scans.
+func Of(fullPath string) string {
+	return path.Join(Root, filepath.Base(filepath.Dir(fullPath)), filepath.Base(fullPath))
+}
+
+// Normalize is the store path storePath should have: the receipt's DiskName,
+// in Pending when storePath is in Pending or below it (the hashed
+// sub-directories of early seeding scripts), or else in its directory.
+func Normalize(storePath string, profileID uint, fileName string) string {
+	dir := path.Dir(storePath)
+	if dir == Pending || strings.HasPrefix(dir, Pending+"/") {
+		dir = Pending
+	}
+	return path.Join(dir, DiskName(profileID, fileName))
+}
+
+// File is the local path of a store path.
+func File(storePath string) string { return filepath.FromSlash(storePath) }
@@ -0,0 +1,27 @@
+package storagepath
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	if got := StorePath(12, "dir/IMG 1.jpg"); got != "public/keu/12_IMG 1.jpg" {
+		t.Errorf("StorePath = %q", got)
+	}
+	if got := Of(filepath.Join("data", "keu", "12_a.jpg")); got != "public/keu/12_a.jpg" {
+		t.Errorf("Of = %q", got)
+	}
+	cases := []struct{ in, want string }{
+		{"public/keu/a.jpg", "public/keu/12_a.jpg"},
+		{"public/keu/3f/9c/a.jpg", "public/keu/12_a.jpg"},
+		{"public/keu/12_a.jpg", "public/keu/12_a.jpg"},
+		{"public/processed/a.jpg", "public/processed/12_a.jpg"},
+		{"restore/a.jpg", "restore/12_a.jpg"},
+	}
+	for _, c := range cases {
+		if got := Normalize(c.in, 12, "a.jpg"); got != c.want {
+			t.Errorf("Normalize(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
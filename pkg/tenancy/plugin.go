@@ -0,0 +1,119 @@
+package tenancy
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Plugin enforces tenant isolation in GORM. Statements whose context carries
+// a tenant (see WithTenant) and whose model has a TenantID field only read,
+// update and delete that tenant's rows; created rows get its id. Rows created
+// without a tenant in the context (by the watcher or a job) take the tenant of
+// the user or profile they belong to.
+//
+// Raw SQL and queries on a table name rather than a model are not scoped.
+type Plugin struct{}
+
+func (Plugin) Name() string { return "tenancy" }
+
+func (Plugin) Initialize(gdb *gorm.DB) error {
+	cb := gdb.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenancy:query", scope); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenancy:row", scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenancy:update", scopeWrite); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenancy:delete", scopeWrite); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenancy:create", assign)
+}
+
+func tenantField(stmt *gorm.Statement) *schema.Field {
+	if stmt.Schema == nil {
+		return nil
+	}
+	return stmt.Schema.LookUpField("TenantID")
+}
+
+func scope(tx *gorm.DB) {
+	if tx.Error != nil {
+		return
+	}
+	f := tenantField(tx.Statement)
+	id, ok := FromContext(tx.Statement.Context)
+	if f == nil || !ok {
+		return
+	}
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: id},
+	}})
+}
+
+// scopeWrite scopes updates and deletes that already have conditions; one
+// without is left for GORM to refuse as a global update rather than being
+// turned into an update of the whole tenant.
+func scopeWrite(tx *gorm.DB) {
+	if _, ok := tx.Statement.Clauses["WHERE"]; ok || tx.Statement.AllowGlobalUpdate {
+		scope(tx)
+	}
+}
+
+func assign(tx *gorm.DB) {
+	f := tenantField(tx.Statement)
+	if tx.Error != nil || f == nil {
+		return
+	}
+	ctx := tx.Statement.Context
+	set := func(rv reflect.Value) {
+		if _, zero := f.ValueOf(ctx, rv); !zero {
+			return
+		}
+		id, ok := FromContext(ctx)
+		if !ok {
+			if id, ok = owner(tx, ctx, rv); !ok {
+				return
+			}
+		}
+		if err := f.Set(ctx, rv, id); err != nil {
+			tx.AddError(err)
+		}
+	}
+	switch rv := tx.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+// owner reads the tenant of the user or profile the row rv belongs to.
+func owner(tx *gorm.DB, ctx context.Context, rv reflect.Value) (uint, bool) {
+	for _, ref := range []struct{ field, table string }{{"UserID", "users"}, {"ProfileID", "profiles"}} {
+		f := tx.Statement.Schema.LookUpField(ref.field)
+		if f == nil {
+			continue
+		}
+		v, zero := f.ValueOf(ctx, rv)
+		if zero {
+			continue
+		}
+		var ids []uint
+		err := tx.Session(&gorm.Session{NewDB: true}).Table(ref.table).Where("id = ?", v).Limit(1).Pluck("tenant_id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return 0, false
+		}
+		return ids[0], true
+	}
+	return 0, false
+}
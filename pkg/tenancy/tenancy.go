@@ -0,0 +1,154 @@
+// Package tenancy lets one deployment serve several independent businesses
+// (MULTI_TENANT). Requests name their tenant through a subdomain of
+// TENANT_BASE_DOMAIN or the X-Tenant header; the tenant travels in the request
+// context, and Plugin confines every statement carrying it to the tenant's
+// rows. Tenant 0 is the default tenant: the bare domain, and all data from
+// before multi-tenancy was enabled.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Default is the id of the default tenant.
+const Default uint = 0
+
+type ctxKey struct{}
+
+// WithTenant returns ctx scoped to tenant id.
+func WithTenant(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to; ok is false for contexts
+// that see every tenant (jobs, the watcher, single-tenant deployments).
+func FromContext(ctx context.Context) (id uint, ok bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok = ctx.Value(ctxKey{}).(uint)
+	return id, ok
+}
+
+// Config says whether and how requests are mapped to tenants.
+type Config struct {
+	Enabled bool
+	// BaseDomain is the domain tenants are subdomains of (acme.BaseDomain).
+	BaseDomain string
+	// Header, when present on a request, names the tenant instead of the host.
+	Header string
+}
+
+// ConfigFromEnv reads MULTI_TENANT (default false), TENANT_BASE_DOMAIN and
+// TENANT_HEADER (default X-Tenant).
+func ConfigFromEnv() Config {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("MULTI_TENANT")))
+	c := Config{
+		Enabled:    v == "true" || v == "1" || v == "yes",
+		BaseDomain: strings.ToLower(strings.Trim(strings.TrimSpace(os.Getenv("TENANT_BASE_DOMAIN")), ".")),
+		Header:     strings.TrimSpace(os.Getenv("TENANT_HEADER")),
+	}
+	if c.Header == "" {
+		c.Header = "X-Tenant"
+	}
+	return c
+}
+
+// Slug returns the tenant slug a request names through its header value or
+// host; "" is the default tenant.
+func (c Config) Slug(host, header string) string {
+	if h := strings.ToLower(strings.TrimSpace(header)); h != "" {
+		return h
+	}
+	if c.BaseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	sub, ok := strings.CutSuffix(host, "."+c.BaseDomain)
+	if !ok || sub == "www" {
+		return ""
+	}
+	return sub
+}
+
+var slugRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidSlug reports whether s can name a tenant: a DNS label other than www.
+func ValidSlug(s string) bool {
+	return slugRE.MatchString(s) && s != "www"
+}
+
+var (
+	ErrUnknown  = errors.New("tenancy: unknown tenant")
+	ErrDisabled = errors.New("tenancy: tenant is disabled")
+)
+
+type entry struct {
+	tenant models.Tenant
+	at     time.Time
+}
+
+// Directory looks tenants up by slug, keeping them for TTL so resolving a
+// request does not read the tenants table every time.
+type Directory struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	from    *gorm.DB
+	entries map[string]entry
+}
+
+// NewDirectory returns a directory caching tenants for ttl.
+func NewDirectory(ttl time.Duration) *Directory {
+	return &Directory{TTL: ttl}
+}
+
+// Lookup returns the tenant called slug from gdb: ErrUnknown when there is
+// none, ErrDisabled (with the tenant) while it is suspended.
+func (d *Directory) Lookup(gdb *gorm.DB, slug string) (models.Tenant, error) {
+	d.mu.Lock()
+	e, ok := d.entries[slug]
+	fresh := ok && d.from == gdb && time.Since(e.at) < d.TTL
+	d.mu.Unlock()
+	if !fresh {
+		var rows []models.Tenant
+		if err := gdb.Where("slug = ?", slug).Limit(1).Find(&rows).Error; err != nil {
+			return models.Tenant{}, err
+		}
+		if len(rows) == 0 {
+			return models.Tenant{}, ErrUnknown
+		}
+		e = entry{tenant: rows[0], at: time.Now()}
+		d.mu.Lock()
+		if d.from != gdb || d.entries == nil {
+			d.from, d.entries = gdb, map[string]entry{}
+		}
+		d.entries[slug] = e
+		d.mu.Unlock()
+	}
+	if e.tenant.DisabledAt != nil {
+		return e.tenant, ErrDisabled
+	}
+	return e.tenant, nil
+}
+
+// Forget drops the cached tenants, after one was changed.
+func (d *Directory) Forget() {
+	d.mu.Lock()
+	d.entries = nil
+	d.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/testenv"
+)
+
+func TestSlug(t *testing.T) {
+	c := Config{Enabled: true, BaseDomain: "fekeu.app", Header: "X-Tenant"}
+	cases := []struct{ host, header, want string }{
+		{"acme.fekeu.app", "", "acme"},
+		{"ACME.fekeu.app:8080", "", "acme"},
+		{"fekeu.app", "", ""},
+		{"www.fekeu.app", "", ""},
+		{"acme.example.com", "", ""},
+		{"localhost:8080", " Acme ", "acme"},
+	}
+	for _, tc := range cases {
+		if got := c.Slug(tc.host, tc.header); got != tc.want {
+			t.Errorf("Slug(%q, %q) = %q, want %q", tc.host, tc.header, got, tc.want)
+		}
+	}
+	for s, want := range map[string]bool{"acme": true, "toko-2": true, "www": false, "-acme": false, "Acme": false, "": false} {
+		if ValidSlug(s) != want {
+			t.Errorf("ValidSlug(%q) = %v", s, !want)
+		}
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	if err := gdb.Use(Plugin{}); err != nil {
+		t.Fatal(err)
+	}
+	acme := WithTenant(context.Background(), 7)
+
+	// rows created in a tenant's context belong to it
+	alice := models.User{Username: "alice", HashedPassword: []byte("x")}
+	if err := gdb.WithContext(acme).Create(&alice).Error; err != nil || alice.TenantID != 7 {
+		t.Fatalf("create in tenant: %v tenant=%d", err, alice.TenantID)
+	}
+	// without one (the watcher) they follow their owner
+	ct := models.CatatanKeuangan{UserID: alice.ID, FileName: "a.jpg", Amount: 1000, Date: time.Now()}
+	if err := gdb.Create(&ct).Error; err != nil || ct.TenantID != 7 {
+		t.Fatalf("create for owner: %v tenant=%d", err, ct.TenantID)
+	}
+	prof := models.Profile{UserID: alice.ID, Name: "Alice"}
+	gdb.Create(&prof)
+	ups := []models.Upload{{FileName: "a.jpg", ProfileID: prof.ID}, {FileName: "b.jpg", ProfileID: prof.ID}}
+	if err := gdb.Create(&ups).Error; err != nil || ups[0].TenantID != 7 || ups[1].TenantID != 7 {
+		t.Fatalf("batch create for profile: %v %+v", err, ups)
+	}
+
+	// the default tenant sees none of them
+	def := gdb.WithContext(WithTenant(context.Background(), Default))
+	var n int64
+	def.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("default tenant counted %d of acme's catatan", n)
+	}
+	if err := def.First(&models.CatatanKeuangan{}, ct.ID).Error; err == nil {
+		t.Fatal("default tenant read acme's catatan by id")
+	}
+	if res := def.Model(&models.CatatanKeuangan{}).Where("id = ?", ct.ID).Update("amount", 1); res.RowsAffected != 0 {
+		t.Fatal("default tenant updated acme's catatan")
+	}
+	if res := def.Where("id = ?", ct.ID).Delete(&models.CatatanKeuangan{}); res.RowsAffected != 0 {
+		t.Fatal("default tenant deleted acme's catatan")
+	}
+	var joined []models.Upload
+	def.Joins("Profile").Find(&joined)
+	if len(joined) != 0 {
+		t.Fatalf("joined query leaked %d uploads", len(joined))
+	}
+
+	// acme and unscoped statements see them
+	gdb.WithContext(acme).Model(&models.Upload{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("acme counted %d uploads", n)
+	}
+	gdb.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 1 {
+		t.Fatalf("unscoped count = %d", n)
+	}
+	// a write without conditions is still refused rather than scoped
+	if err := gdb.WithContext(acme).Model(&models.Upload{}).Update("failed", true).Error; err == nil {
+		t.Fatal("global update accepted")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	gdb := testenv.OpenDB(t)
+	now := time.Now()
+	gdb.Create(&models.Tenant{Slug: "acme", Name: "Acme"})
+	gdb.Create(&models.Tenant{Slug: "gone", Name: "Gone", DisabledAt: &now})
+	d := NewDirectory(time.Minute)
+	if tn, err := d.Lookup(gdb, "acme"); err != nil || tn.Name != "Acme" {
+		t.Fatalf("acme: %+v %v", tn, err)
+	}
+	if _, err := d.Lookup(gdb, "nope"); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("unknown: %v", err)
+	}
+	if _, err := d.Lookup(gdb, "gone"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("disabled: %v", err)
+	}
+	gdb.Model(&models.Tenant{}).Where("slug = ?", "acme").Update("name", "Acme Corp")
+	if tn, _ := d.Lookup(gdb, "acme"); tn.Name != "Acme" {
+		t.Fatal("cached tenant was read again")
+	}
+	d.Forget()
+	if tn, _ := d.Lookup(gdb, "acme"); tn.Name != "Acme Corp" {
+		t.Fatal("Forget kept the old tenant")
+	}
+}
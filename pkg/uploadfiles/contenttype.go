@@ -0,0 +1,138 @@
+package uploadfiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnsupportedType is returned by Types.Sniff for a file whose extension or
+// content is not one of the types.
+var ErrUnsupportedType = errors.New("unsupported_type")
+
+// Types maps file extensions (lower case, with the dot) to the content type
+// of the images they name.
+type Types map[string]string
+
+// Receipt types: APITypes are the images the API accepts, ImageTypes those
+// the watcher, the seeding and the content-type fix-up recognise, which
+// includes files dropped into public/keu by hand.
+var (
+	APITypes   = Types{".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png"}
+	ImageTypes = Types{".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png", ".gif": "image/gif", ".webp": "image/webp"}
+)
+
+// sniffBytes is what http.DetectContentType looks at.
+const sniffBytes = 512
+
+// Has reports whether name has one of the extensions.
+func (t Types) Has(name string) bool {
+	return t[strings.ToLower(filepath.Ext(name))] != ""
+}
+
+// List is the sorted content types, for error details.
+func (t Types) List() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, ct := range t {
+		if !seen[ct] {
+			seen[ct] = true
+			out = append(out, ct)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Sniff returns the content type of a file called name starting with head.
+// The extension must be one of t, and the magic bytes of head one of t's
+// content types; the content wins when the two disagree (a PNG named .jpg is
+// image/png). An empty head is unsupported: there is nothing to sniff.
+func (t Types) Sniff(name string, head []byte) (string, error) {
+	byExt := t[strings.ToLower(filepath.Ext(name))]
+	if byExt == "" || len(head) == 0 {
+		return "", ErrUnsupportedType
+	}
+	ct := http.DetectContentType(head[:min(len(head), sniffBytes)])
+	for _, ok := range t {
+		if ct == ok {
+			return ct, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+// SniffFile is Sniff of the file at path.
+func (t Types) SniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, sniffBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return t.Sniff(path, head[:n])
+}
+
+// FixContentTypesResult reports one FixContentTypes.
+type FixContentTypesResult struct {
+	Checked int  `json:"checked"`
+	Fixed   int  `json:"fixed"`
+	DryRun  bool `json:"dry_run,omitempty"`
+	// Missing lists the uploads whose file is gone; their content type is left.
+	Missing []uint `json:"missing,omitempty"`
+	// Unsupported lists the uploads whose file is not an image of ImageTypes;
+	// their content type is cleared.
+	Unsupported []uint `json:"unsupported,omitempty"`
+}
+
+// FixContentTypes sniffs the file of every upload and records the content
+// type found, correcting the application/octet-stream and extension-based
+// guesses of older seeding scripts and watcher versions. Uploads already right
+// are left alone, so it can run more than once.
+func FixContentTypes(gdb *gorm.DB, dryRun bool) (FixContentTypesResult, error) {
+	res := FixContentTypesResult{DryRun: dryRun}
+	var ups []models.Upload
+	// original_path is left out: the type is that of the served file, and
+	// the original may be in another format
+	err := gdb.Select("id", "profile_id", "file_name", "store_path", "content_type").
+		FindInBatches(&ups, 500, func(tx *gorm.DB, _ int) error {
+			for _, up := range ups {
+				res.Checked++
+				p := Locate(up)
+				if p == "" {
+					res.Missing = append(res.Missing, up.ID)
+					continue
+				}
+				ct, err := ImageTypes.SniffFile(p)
+				if errors.Is(err, ErrUnsupportedType) {
+					res.Unsupported = append(res.Unsupported, up.ID)
+				} else if err != nil {
+					return fmt.Errorf("upload %d: %w", up.ID, err)
+				}
+				if ct == up.ContentType {
+					continue
+				}
+				if !dryRun {
+					if err := gdb.Model(&models.Upload{}).Where("id = ?", up.ID).Update("content_type", ct).Error; err != nil {
+						return fmt.Errorf("upload %d: %w", up.ID, err)
+					}
+				}
+				res.Fixed++
+			}
+			return nil
+		}).Error
+	return res, err
+}
@@ -0,0 +1,74 @@
+package uploadfiles
+
+import (
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/storagepath"
+	"be03/pkg/testenv"
+)
+
+func TestSniff(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+	for _, tc := range []struct {
+		name, head string
+		types      Types
+		want       string
+	}{
+		{"a.jpg", string(testenv.JPEG), APITypes, "image/jpeg"},
+		{"a.JPEG", string(testenv.JPEG), APITypes, "image/jpeg"},
+		{"a.jpg", png, APITypes, "image/png"},
+		{"a.jpg", "just some text", APITypes, ""},
+		{"a.jpg", "", APITypes, ""},
+		{"a.gif", "GIF89a\x01\x00", APITypes, ""},
+		{"a.gif", "GIF89a\x01\x00", ImageTypes, "image/gif"},
+		{"a.txt", string(testenv.JPEG), ImageTypes, ""},
+	} {
+		got, err := tc.types.Sniff(tc.name, []byte(tc.head))
+		if got != tc.want || (err != nil) != (tc.want == "") {
+			t.Errorf("Sniff(%s, %q) = %q, %v; want %q", tc.name, tc.head, got, err, tc.want)
+		}
+	}
+}
+
+func TestFixContentTypes(t *testing.T) {
+	testenv.Chdir(t)
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}},
+		Uploads: []fixtures.Upload{
+			{User: "demo", FileName: "seeded.jpg", ContentType: "application/octet-stream"},
+			{User: "demo", FileName: "ok.jpg", ContentType: "image/jpeg"},
+			{User: "demo", FileName: "text.jpg", ContentType: "image/jpeg"},
+			{User: "demo", FileName: "gone.jpg", ContentType: "application/octet-stream"},
+		},
+	})
+	var ups []models.Upload
+	gdb.Order("id").Find(&ups)
+	writeFile(t, "public/processed/"+StoredName(ups[0]), string(testenv.JPEG))
+	writeFile(t, storagepath.File(ups[1].StorePath), string(testenv.JPEG))
+	writeFile(t, "public/failed/"+StoredName(ups[2]), "not an image")
+
+	res, err := FixContentTypes(gdb, true)
+	if err != nil || res.Checked != 4 || res.Fixed != 2 || len(res.Missing) != 1 || len(res.Unsupported) != 1 {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+	var seeded models.Upload
+	if gdb.First(&seeded, ups[0].ID); seeded.ContentType != "application/octet-stream" {
+		t.Fatal("dry run wrote")
+	}
+	res, err = FixContentTypes(gdb, false)
+	if err != nil || res.Fixed != 2 || res.Missing[0] != ups[3].ID || res.Unsupported[0] != ups[2].ID {
+		t.Fatalf("fix = %+v, %v", res, err)
+	}
+	want := []string{"image/jpeg", "image/jpeg", "", "application/octet-stream"}
+	gdb.Order("id").Find(&ups)
+	for i, up := range ups {
+		if up.ContentType != want[i] {
+			t.Errorf("%s: content type %q, want %q", up.FileName, up.ContentType, want[i])
+		}
+	}
+	if res, err := FixContentTypes(gdb, false); err != nil || res.Fixed != 0 {
+		t.Fatalf("second run = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package uploadfiles resolves where an upload's receipt lives on local disk,
+// and keeps the original of receipts the watcher has to compress.
+package uploadfiles
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/storagepath"
+
+	"gorm.io/gorm"
+)
+
+// Candidates lists the places a receipt may be: its store path while pending, or
+// public/processed and public/failed once the watcher has moved it, and last
+// the preserved original, if any.
+func Candidates(up models.Upload) []string {
+	name := StoredName(up)
+	out := []string{}
+	if up.StorePath != "" {
+		out = append(out, filepath.FromSlash(up.StorePath))
+	}
+	out = append(out, filepath.Join(storagepath.File(storagepath.Processed), name), filepath.Join(storagepath.File(storagepath.Failed), name))
+	if up.OriginalPath != "" {
+		out = append(out, filepath.FromSlash(up.OriginalPath))
+	}
+	return out
+}
+
+// LocateOriginal prefers the preserved original over the processed copy, so
+// exports hand back what the user uploaded.
+func LocateOriginal(up models.Upload) string {
+	if up.OriginalPath != "" {
+		if fi, err := os.Stat(filepath.FromSlash(up.OriginalPath)); err == nil && fi.Mode().IsRegular() {
+			return filepath.FromSlash(up.OriginalPath)
+		}
+	}
+	return Locate(up)
+}
+
+// KeepOriginals reports whether KEEP_ORIGINALS asks to preserve images
+// before they are re-encoded for storage.
+func KeepOriginals() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("KEEP_ORIGINALS"))) {
+	case "on", "true", "1", "yes":
+		return true
+	}
+	return false
+}
+
+// OriginalsDir is ORIGINALS_DIR, default public/originals. It is not served.
+func OriginalsDir() string {
+	if d := strings.TrimSpace(os.Getenv("ORIGINALS_DIR")); d != "" {
+		return d
+	}
+	return filepath.Join("public", "originals")
+}
+
+// ProfileAssetsDir is PROFILE_ASSETS_DIR, default public/profile-assets: the
+// resized avatars and business logos served by GET /profile-assets/:name.
+func ProfileAssetsDir() string {
+	if d := strings.TrimSpace(os.Getenv("PROFILE_ASSETS_DIR")); d != "" {
+		return d
+	}
+	return filepath.Join("public", "profile-assets")
+}
+
+// KeepOriginal copies src, byte for byte and with its metadata, to
+// OriginalsDir as name when KeepOriginals is on, and returns the copy's
+// slash-separated path ("" when off).
+func KeepOriginal(src, name string) (string, error) {
+	if !KeepOriginals() {
+		return "", nil
+	}
+	dir := OriginalsDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(name))
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return "", err
+	}
+	return filepath.ToSlash(dst), nil
+}
+
+// RecordOriginal stores path, and the size of the file there, on the upload
+// stored at storePath.
+func RecordOriginal(gdb *gorm.DB, storePath, path string) error {
+	fi, err := os.Stat(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+	return gdb.Model(&models.Upload{}).Where("store_path = ?", storePath).
+		Updates(map[string]any{"original_path": path, "original_size_bytes": fi.Size()}).Error
+}
+
+// Locate returns the first existing candidate, or "" when the file is gone.
+func Locate(up models.Upload) string {
+	for _, p := range Candidates(up) {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p
+		}
+	}
+	return ""
+}
+
+// MoveToFailed moves a receipt that could not be read to public/failed, where
+// Locate still finds it for a retry (e.g. OCR of a user-selected region).
+func MoveToFailed(path string, up models.Upload) error {
+	dir := storagepath.File(storagepath.Failed)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dir, StoredName(up)))
+}
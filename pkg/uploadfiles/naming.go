@@ -0,0 +1,102 @@
+package uploadfiles
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"be03/models"
+	"be03/pkg/storagepath"
+
+	"gorm.io/gorm"
+)
+
+// StoredName is the name up's file has on disk, the base of its store path.
+// Rows stored before storagepath.DiskName existed have the plain file name.
+func StoredName(up models.Upload) string {
+	if up.StorePath != "" {
+		return path.Base(up.StorePath)
+	}
+	return filepath.Base(up.FileName)
+}
+
+// RelocateResult reports one Relocate.
+type RelocateResult struct {
+	Uploads int  `json:"uploads"` // rows whose paths were fixed
+	Moved   int  `json:"moved"`   // files renamed
+	DryRun  bool `json:"dry_run,omitempty"`
+	// Missing lists the uploads whose file is gone, including those whose
+	// file was overwritten by another user's upload of the same name.
+	Missing []uint `json:"missing,omitempty"`
+}
+
+// Relocate brings uploads stored before storagepath.DiskName, or under the
+// hashed sub-directories of public/keu early seeding scripts used, to their
+// normalized store path (see storagepath.Normalize), moving their files and
+// originals along; uploads already there are left alone, so it can run more
+// than once. Uploads sharing a name shared one file, which
+// holds the image of the upload written last: it goes to the most recently
+// updated of them and the others are reported as missing.
+func Relocate(gdb *gorm.DB, dryRun bool) (RelocateResult, error) {
+	res := RelocateResult{DryRun: dryRun}
+	var ups []models.Upload
+	if err := gdb.Where("store_path <> ''").Order("updated_at DESC, id DESC").Find(&ups).Error; err != nil {
+		return res, err
+	}
+	claimed := map[string]bool{}
+	for _, up := range ups {
+		store := storagepath.Normalize(up.StorePath, up.ProfileID, up.FileName)
+		if up.StorePath == store {
+			continue
+		}
+		want := path.Base(store)
+		served := up
+		served.OriginalPath = ""
+		if src := Locate(served); src != "" && !claimed[src] {
+			claimed[src] = true
+			dst := filepath.Join(filepath.Dir(src), want)
+			if filepath.Clean(src) == storagepath.File(up.StorePath) {
+				dst = storagepath.File(store) // a hashed sub-directory flattens
+			}
+			if err := rename(src, dst, dryRun); err != nil {
+				return res, fmt.Errorf("upload %d: %w", up.ID, err)
+			}
+			res.Moved++
+		} else {
+			res.Missing = append(res.Missing, up.ID)
+		}
+		updates := map[string]any{"store_path": store}
+		if up.OriginalPath != "" && path.Base(up.OriginalPath) != want {
+			src := filepath.FromSlash(up.OriginalPath)
+			if _, err := os.Stat(src); err == nil && !claimed[src] {
+				claimed[src] = true
+				if err := rename(src, filepath.Join(filepath.Dir(src), want), dryRun); err != nil {
+					return res, fmt.Errorf("upload %d original: %w", up.ID, err)
+				}
+				res.Moved++
+				updates["original_path"] = path.Join(path.Dir(up.OriginalPath), want)
+			} else {
+				updates["original_path"], updates["original_size_bytes"] = "", 0
+			}
+		}
+		if !dryRun {
+			if err := gdb.Model(&models.Upload{}).Where("id = ?", up.ID).Updates(updates).Error; err != nil {
+				return res, fmt.Errorf("upload %d: %w", up.ID, err)
+			}
+		}
+		res.Uploads++
+	}
+	return res, nil
+}
+
+// rename moves src to dst, refusing to overwrite.
+func rename(src, dst string, dryRun bool) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if dryRun {
+		return nil
+	}
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,101 @@
+package uploadfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/storagepath"
+	"be03/pkg/testenv"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	testenv.Chdir(t)
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Uploads: []fixtures.Upload{
+			{User: "demo", FileName: "a.jpg"},
+			{User: "demo", FileName: "same.jpg"},
+			{User: "ani", FileName: "same.jpg"},
+		},
+	})
+	var ups []models.Upload
+	gdb.Order("id").Find(&ups)
+	a, demoSame, aniSame := ups[0], ups[1], ups[2]
+	// ani's upload of same.jpg came last and overwrote demo's file
+	gdb.Model(&aniSame).UpdateColumn("updated_at", time.Now().Add(time.Hour))
+	gdb.Model(&a).Updates(map[string]any{"original_path": "public/originals/a.jpg", "original_size_bytes": 4})
+	writeFile(t, "public/processed/a.jpg", "a")
+	writeFile(t, "public/originals/a.jpg", "orig")
+	writeFile(t, "public/failed/same.jpg", "ani")
+
+	res, err := Relocate(gdb, true)
+	if err != nil || res.Uploads != 3 || res.Moved != 3 || len(res.Missing) != 1 {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+	if _, err := os.Stat("public/processed/a.jpg"); err != nil {
+		t.Fatal("dry run moved a file")
+	}
+
+	res, err = Relocate(gdb, false)
+	if err != nil || res.Uploads != 3 || res.Moved != 3 || len(res.Missing) != 1 || res.Missing[0] != demoSame.ID {
+		t.Fatalf("relocate = %+v, %v", res, err)
+	}
+	gdb.First(&a, a.ID)
+	if a.StorePath != "public/keu/"+storagepath.DiskName(a.ProfileID, "a.jpg") || a.OriginalPath != "public/originals/"+storagepath.DiskName(a.ProfileID, "a.jpg") {
+		t.Fatalf("a.jpg paths: %q %q", a.StorePath, a.OriginalPath)
+	}
+	if got, _ := os.ReadFile(Locate(a)); string(got) != "a" {
+		t.Fatalf("a.jpg not found after relocation: %q", got)
+	}
+	if got, _ := os.ReadFile(LocateOriginal(a)); string(got) != "orig" {
+		t.Fatalf("a.jpg original not found: %q", got)
+	}
+	gdb.First(&aniSame, aniSame.ID)
+	if got, _ := os.ReadFile(Locate(aniSame)); string(got) != "ani" {
+		t.Fatalf("ani's same.jpg: %q", got)
+	}
+	gdb.First(&demoSame, demoSame.ID)
+	if Locate(demoSame) != "" || demoSame.StorePath == aniSame.StorePath {
+		t.Fatalf("demo's same.jpg: %+v", demoSame)
+	}
+
+	if res, err := Relocate(gdb, false); err != nil || res.Uploads != 0 {
+		t.Fatalf("second run = %+v, %v", res, err)
+	}
+}
+
+func TestRelocateFlattensHashedDirs(t *testing.T) {
+	testenv.Chdir(t)
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users:   []fixtures.User{{Username: "demo", Password: "demo1234"}},
+		Uploads: []fixtures.Upload{{User: "demo", FileName: "a.jpg", StorePath: "public/keu/3f/9c/a.jpg"}},
+	})
+	writeFile(t, "public/keu/3f/9c/a.jpg", "a")
+
+	res, err := Relocate(gdb, false)
+	if err != nil || res.Uploads != 1 || res.Moved != 1 {
+		t.Fatalf("relocate = %+v, %v", res, err)
+	}
+	var up models.Upload
+	gdb.First(&up)
+	if up.StorePath != storagepath.StorePath(up.ProfileID, "a.jpg") {
+		t.Fatalf("store path = %q", up.StorePath)
+	}
+	if got, _ := os.ReadFile(storagepath.File(up.StorePath)); string(got) != "a" {
+		t.Fatalf("file not moved: %q", got)
+	}
+}
@@ -0,0 +1,311 @@
+package uploadfiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/storagepath"
+
+	"gorm.io/gorm"
+)
+
+// SeedOptions configures Seed.
+type SeedOptions struct {
+	// Dir holds the receipts. Files in public/keu, public/processed or
+	// public/failed stay where they are; files anywhere else (including
+	// sub-directories of those) are copied into public/keu under their
+	// storagepath.DiskName.
+	Dir string
+	// Profile owns the seeded uploads.
+	Profile models.Profile
+	// Catatan also creates a catatan of amount 0 for each upload without
+	// one and links it. Otherwise the watcher reads the receipts in
+	// public/keu and records their amounts.
+	Catatan bool
+	// Reconcile points an upload of the same name at the seeded file when
+	// its store path differs and its own file is gone. Without it such
+	// uploads are only reported.
+	Reconcile bool
+	// BatchSize is the number of files written per transaction (default 100).
+	BatchSize int
+	DryRun    bool
+}
+
+// SeedConflict is a file Seed left alone.
+type SeedConflict struct {
+	File      string `json:"file"`
+	UploadID  uint   `json:"upload_id"`
+	StorePath string `json:"store_path"` // of the existing upload
+	Want      string `json:"want"`       // the store path of the file
+	Reason    string `json:"reason"`
+}
+
+// SeedResult reports one Seed.
+type SeedResult struct {
+	Created    int            `json:"created"`    // new uploads
+	Linked     int            `json:"linked"`     // catatan created and linked
+	Reconciled int            `json:"reconciled"` // uploads pointed at the seeded file
+	Unchanged  int            `json:"unchanged"`
+	Conflicts  []SeedConflict `json:"conflicts,omitempty"`
+	DryRun     bool           `json:"dry_run,omitempty"`
+}
+
+func (r SeedResult) String() string {
+	return fmt.Sprintf("%d created, %d linked, %d reconciled, %d unchanged, %d conflicts", r.Created, r.Linked, r.Reconciled, r.Unchanged, len(r.Conflicts))
+}
+
+// seedAction is the change Seed plans for one file.
+type seedAction struct {
+	src      string // file found in Dir
+	copyTo   string // where it is imported to; "" when it stays
+	want     string // store path
+	fileName string // the name the user would have uploaded
+	size     int64
+	upload   *models.Upload // existing upload, nil to create
+	retarget bool           // point upload at want
+}
+
+// Seed registers the receipts in opts.Dir as uploads of opts.Profile. The
+// store path of every upload is in public/keu, the way the API stores them, so Locate finds the file there or in public/processed and
+// public/failed. Existing uploads are matched by store path and by
+// (profile, file name); mismatches are reported as conflicts. Writes happen
+// in transactions of BatchSize files: a failing batch is rolled back, its
+// imported files removed, and Seed stops. Seed can run more than once.
+func Seed(gdb *gorm.DB, opts SeedOptions) (SeedResult, error) {
+	res := SeedResult{DryRun: opts.DryRun}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	files, err := seedFiles(opts.Dir)
+	if err != nil {
+		return res, err
+	}
+	var plan []seedAction
+	planned := map[string]string{}
+	for _, src := range files {
+		a, conflict, err := planSeed(gdb, opts, src)
+		if err != nil {
+			return res, err
+		}
+		if a != nil && planned[a.want] != "" {
+			conflict = &SeedConflict{File: src, Want: a.want, Reason: "same store path as " + planned[a.want]}
+		} else if a != nil {
+			planned[a.want] = src
+		}
+		switch {
+		case conflict != nil:
+			res.Conflicts = append(res.Conflicts, *conflict)
+		case a == nil:
+			res.Unchanged++
+		default:
+			plan = append(plan, *a)
+		}
+	}
+	for start := 0; start < len(plan); start += opts.BatchSize {
+		batch := plan[start:min(start+opts.BatchSize, len(plan))]
+		if opts.DryRun {
+			for _, a := range batch {
+				res.count(a, opts.Catatan)
+			}
+			continue
+		}
+		var copied []string
+		var counted SeedResult
+		err := gdb.Transaction(func(tx *gorm.DB) error {
+			for _, a := range batch {
+				if a.copyTo != "" {
+					if err := copyNew(a.src, a.copyTo); err != nil {
+						return fmt.Errorf("%s: %w", a.src, err)
+					}
+					copied = append(copied, a.copyTo)
+				}
+				counted.count(a, opts.Catatan)
+				if err := applySeed(tx, opts, a); err != nil {
+					return fmt.Errorf("%s: %w", a.src, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, p := range copied {
+				_ = os.Remove(p)
+			}
+			return res, err
+		}
+		res.Created += counted.Created
+		res.Linked += counted.Linked
+		res.Reconciled += counted.Reconciled
+	}
+	return res, nil
+}
+
+func (r *SeedResult) count(a seedAction, catatan bool) {
+	switch {
+	case a.upload == nil:
+		r.Created++
+	case a.retarget:
+		r.Reconciled++
+	}
+	if catatan && (a.upload == nil || a.upload.KeuanganID == nil) {
+		r.Linked++
+	}
+}
+
+// seedFiles lists the receipt images under dir, sorted.
+func seedFiles(dir string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && ImageTypes.Has(p) && !strings.Contains(d.Name(), ".ocr.") {
+			out = append(out, p)
+		}
+		return nil
+	})
+	sort.Strings(out)
+	return out, err
+}
+
+// planSeed decides what to do with src: nil when nothing, or a conflict.
+func planSeed(gdb *gorm.DB, opts SeedOptions, src string) (*seedAction, *SeedConflict, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	a := &seedAction{src: src, size: fi.Size()}
+	base := filepath.Base(src)
+	dir := filepath.Dir(src)
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(dir); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil {
+				dir = rel
+			}
+		}
+	}
+	switch filepath.ToSlash(dir) {
+	case storagepath.Pending, storagepath.Processed, storagepath.Failed:
+		// stored by the API or the watcher, perhaps before DiskName
+		a.want = path.Join(storagepath.Pending, base)
+		a.fileName = strings.TrimPrefix(base, fmt.Sprintf("%d_", opts.Profile.ID))
+	default:
+		a.fileName = base
+		a.want = storagepath.StorePath(opts.Profile.ID, base)
+		a.copyTo = storagepath.File(a.want)
+	}
+
+	var byPath models.Upload
+	err = gdb.Where("store_path = ?", a.want).Limit(1).Find(&byPath).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if byPath.ID != 0 {
+		if byPath.ProfileID != opts.Profile.ID {
+			return nil, &SeedConflict{File: src, UploadID: byPath.ID, StorePath: byPath.StorePath, Want: a.want, Reason: "store path belongs to another profile's upload"}, nil
+		}
+		if !opts.Catatan || byPath.KeuanganID != nil {
+			return nil, nil, nil
+		}
+		a.upload, a.copyTo = &byPath, ""
+		return a, nil, nil
+	}
+	if a.copyTo != "" {
+		if _, err := os.Stat(a.copyTo); err == nil {
+			return nil, &SeedConflict{File: src, Want: a.want, Reason: a.copyTo + " exists without an upload"}, nil
+		}
+	}
+
+	var byName models.Upload
+	err = gdb.Where("profile_id = ? AND file_name = ?", opts.Profile.ID, a.fileName).Limit(1).Find(&byName).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if byName.ID == 0 {
+		return a, nil, nil
+	}
+	c := &SeedConflict{File: src, UploadID: byName.ID, StorePath: byName.StorePath, Want: a.want, Reason: "an upload of the same name has another store path"}
+	if !opts.Reconcile {
+		return nil, c, nil
+	}
+	if p := Locate(byName); p != "" && !sameFile(p, src) {
+		c.Reason = "an upload of the same name has another store path and its file exists"
+		return nil, c, nil
+	}
+	a.upload, a.retarget = &byName, true
+	return a, nil, nil
+}
+
+func sameFile(a, b string) bool {
+	fa, errA := os.Stat(a)
+	fb, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(fa, fb)
+}
+
+// applySeed writes a in tx.
+func applySeed(tx *gorm.DB, opts SeedOptions, a seedAction) error {
+	up := a.upload
+	if up == nil {
+		// a file that is not the image its name says is seeded without a
+		// type; FixContentTypes reports it
+		ct, _ := ImageTypes.SniffFile(a.src)
+		up = &models.Upload{
+			FileName:    a.fileName,
+			StorePath:   a.want,
+			ProfileID:   opts.Profile.ID,
+			ContentType: ct,
+			SizeBytes:   a.size,
+			TenantID:    opts.Profile.TenantID,
+		}
+		if err := tx.Create(up).Error; err != nil {
+			return err
+		}
+	} else if a.retarget {
+		if err := tx.Model(up).Update("store_path", a.want).Error; err != nil {
+			return err
+		}
+	}
+	if !opts.Catatan || up.KeuanganID != nil {
+		return nil
+	}
+	cat := models.CatatanKeuangan{UserID: opts.Profile.UserID, FileName: up.FileName, Date: time.Now(), TenantID: opts.Profile.TenantID}
+	err := tx.Where("user_id = ? AND file_name = ?", cat.UserID, cat.FileName).FirstOrCreate(&cat).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(up).Update("keuangan_id", cat.ID).Error
+}
+
+// copyNew copies src to dst, refusing to overwrite.
+func copyNew(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package uploadfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/storagepath"
+	"be03/pkg/testenv"
+)
+
+func TestSeed(t *testing.T) {
+	testenv.Chdir(t)
+	gdb := testenv.OpenDB(t, &fixtures.Set{
+		Users: []fixtures.User{{Username: "demo", Password: "demo1234"}, {Username: "ani", Password: "ani12345"}},
+		Uploads: []fixtures.Upload{
+			{User: "ani", FileName: "x.jpg"},
+			{User: "demo", FileName: "gone.jpg", StorePath: "public/keu/aa/bb/gone.jpg"},
+			{User: "demo", FileName: "here.jpg", StorePath: "public/keu/cc/dd/here.jpg"},
+		},
+	})
+	var demo models.Profile
+	gdb.Where("user_id = (SELECT id FROM users WHERE username = ?)", "demo").First(&demo)
+	for _, f := range []string{"incoming/new.jpg", "incoming/gone.jpg", "incoming/here.jpg", "public/keu/cc/dd/here.jpg", "public/processed/x.jpg", "public/processed/" + storagepath.DiskName(demo.ID, "done.jpg")} {
+		writeFile(t, f, filepath.Base(f))
+	}
+	writeFile(t, "incoming/notes.txt", "not a receipt")
+	opts := SeedOptions{Dir: "incoming", Profile: demo, Catatan: true, Reconcile: true, BatchSize: 1}
+
+	dry := opts
+	dry.DryRun, dry.Reconcile = true, false
+	res, err := Seed(gdb, dry)
+	if err != nil || res.Created != 1 || res.Linked != 1 || len(res.Conflicts) != 2 {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join("public", "keu", storagepath.DiskName(demo.ID, "new.jpg"))); err == nil {
+		t.Fatal("dry run copied a file")
+	}
+
+	res, err = Seed(gdb, opts)
+	if err != nil || res.Created != 1 || res.Reconciled != 1 || res.Linked != 2 || len(res.Conflicts) != 1 || filepath.Base(res.Conflicts[0].File) != "here.jpg" {
+		t.Fatalf("seed = %+v, %v", res, err)
+	}
+	var gone models.Upload
+	gdb.Where("file_name = ?", "gone.jpg").First(&gone)
+	if gone.StorePath != "public/keu/"+storagepath.DiskName(demo.ID, "gone.jpg") || gone.KeuanganID == nil {
+		t.Fatalf("gone.jpg not reconciled: %+v", gone)
+	}
+	if got, _ := os.ReadFile(Locate(gone)); string(got) != "gone.jpg" {
+		t.Fatalf("gone.jpg file: %q", got)
+	}
+	var n int64
+	gdb.Model(&models.CatatanKeuangan{}).Where("user_id = ? AND amount = 0", demo.UserID).Count(&n)
+	if n != 2 {
+		t.Fatalf("catatan = %d, want 2", n)
+	}
+
+	// files already under public/ keep their place; another profile's store path is a conflict
+	res, err = Seed(gdb, SeedOptions{Dir: "public/processed", Profile: demo})
+	if err != nil || res.Created != 1 || len(res.Conflicts) != 1 || res.Conflicts[0].Reason != "store path belongs to another profile's upload" {
+		t.Fatalf("seed processed = %+v, %v", res, err)
+	}
+	var done models.Upload
+	gdb.Where("file_name = ?", "done.jpg").First(&done)
+	if done.ProfileID != demo.ID || done.StorePath != "public/keu/"+storagepath.DiskName(demo.ID, "done.jpg") || Locate(done) == "" {
+		t.Fatalf("done.jpg = %+v", done)
+	}
+
+	if res, err := Seed(gdb, opts); err != nil || res.Created != 0 || res.Unchanged != 2 {
+		t.Fatalf("second run = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package uploadqueue signals new upload work from the API (and ingestion paths)
+// to the watcher over Postgres LISTEN/NOTIFY, so files are picked up within
+// milliseconds instead of waiting for a filesystem event or a rescan.
+package uploadqueue
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Channel is the NOTIFY channel shared by publishers and the watcher.
+const Channel = "be03_uploads"
+
+// Event announces an upload whose file is stored and awaiting processing.
+type Event struct {
+	UploadID  uint   `json:"upload_id"`
+	FileName  string `json:"file_name"`
+	StorePath string `json:"store_path"`
+}
+
+// Publish sends ev on Channel. On non-Postgres databases (tests) it is a no-op;
+// the watcher's polling fallback covers that case.
+func Publish(gdb *gorm.DB, ev Event) error {
+	if gdb.Dialector.Name() != "postgres" {
+		return nil
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return gdb.Exec("SELECT pg_notify(?, ?)", Channel, string(payload)).Error
+}
+
+// Listen delivers events to handle until ctx is cancelled. After a connection
+// loss notifications may have been missed, so resync is called once the listener
+// reconnects; callers should rescan for pending work.
+func Listen(ctx context.Context, dsn string, handle func(Event), resync func()) error {
+	l := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("uploadqueue: listener event %d: %v", ev, err)
+		}
+	})
+	defer l.Close()
+	if err := l.Listen(Channel); err != nil {
+		return err
+	}
+	log.Printf("uploadqueue: listening on %s", Channel)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-l.Notify:
+			if n == nil { // reconnected
+				resync()
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				log.Printf("uploadqueue: bad payload %q: %v", n.Extra, err)
+				continue
+			}
+			handle(ev)
+		case <-time.After(90 * time.Second):
+			// keep the connection verified; Ping reconnects on failure
+			if err := l.Ping(); err != nil {
+				log.Printf("uploadqueue: ping failed: %v", err)
+			}
+		}
+	}
+}
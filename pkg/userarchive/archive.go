@@ -0,0 +1,221 @@
+// Package userarchive exports a user's complete account (profile, preferences,
+// catatan and receipt images) as a zip archive and restores it into another
+// instance. Archives are self-describing through manifest.json; catatan are also
+// written as CSV for spreadsheet users.
+package userarchive
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+
+	"gorm.io/gorm"
+)
+
+// FormatVersion is bumped on incompatible manifest changes.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	catatanJSON  = "catatan.json"
+	catatanCSV   = "catatan.csv"
+	imagesDir    = "images/"
+)
+
+// Manifest describes everything in the archive.
+type Manifest struct {
+	FormatVersion int          `json:"format_version"`
+	ExportedAt    time.Time    `json:"exported_at"`
+	Username      string       `json:"username"`
+	Profile       Profile      `json:"profile"`
+	Preferences   *Preferences `json:"preferences,omitempty"`
+	Catatan       []Catatan    `json:"catatan"`
+	Uploads       []Upload     `json:"uploads"`
+}
+
+type Profile struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Address    string `json:"address"`
+	Occupation string `json:"occupation"`
+}
+
+type Preferences struct {
+	Currency            string `json:"currency"`
+	Timezone            string `json:"timezone"`
+	Language            string `json:"language"`
+	ReviewLowConfidence bool   `json:"review_low_confidence"`
+	NotifyEmail         bool   `json:"notify_email"`
+	NotifyWebhook       bool   `json:"notify_webhook"`
+	NotifyPush          bool   `json:"notify_push"`
+	WebhookURL          string `json:"webhook_url"`
+}
+
+type Catatan struct {
+	FileName  string    `json:"file_name"`
+	Amount    int64     `json:"amount"`
+	Date      time.Time `json:"date"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Upload records an uploaded receipt; Image is its path inside the archive, empty
+// when the file was no longer on disk at export time.
+type Upload struct {
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Failed       bool      `json:"failed"`
+	FailedReason string    `json:"failed_reason,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Image        string    `json:"image,omitempty"`
+}
+
+// Locator maps an upload row to the receipt file on disk ("" when missing).
+type Locator func(models.Upload) string
+
+// Export writes the archive of userID to w.
+func Export(w io.Writer, gdb *gorm.DB, userID uint, locate Locator) error {
+	var user models.User
+	if err := gdb.First(&user, userID).Error; err != nil {
+		return fmt.Errorf("load user: %w", err)
+	}
+	m := Manifest{FormatVersion: FormatVersion, ExportedAt: time.Now().UTC(), Username: user.Username, Catatan: []Catatan{}, Uploads: []Upload{}}
+
+	var prof models.Profile
+	hasProfile := gdb.Where("user_id = ?", userID).First(&prof).Error == nil
+	if hasProfile {
+		m.Profile = Profile{Name: prof.Name, Email: prof.Email, Phone: prof.Phone, Address: prof.Address, Occupation: prof.Occupation}
+	}
+	var prefs models.Preferences
+	if gdb.Where("user_id = ?", userID).First(&prefs).Error == nil {
+		m.Preferences = &Preferences{Currency: prefs.Currency, Timezone: prefs.Timezone, Language: prefs.Language,
+			ReviewLowConfidence: prefs.ReviewLowConfidence, NotifyEmail: prefs.NotifyEmail, NotifyWebhook: prefs.NotifyWebhook, NotifyPush: prefs.NotifyPush, WebhookURL: prefs.WebhookURL}
+	}
+	var cats []models.CatatanKeuangan
+	if err := catatanarchive.Catatan(gdb, nil).Where("user_id = ?", userID).Order("date, id").Find(&cats).Error; err != nil {
+		return fmt.Errorf("load catatan: %w", err)
+	}
+	for _, c := range cats {
+		m.Catatan = append(m.Catatan, Catatan{FileName: c.FileName, Amount: c.Amount, Date: c.Date, CreatedAt: c.CreatedAt})
+	}
+	var ups []models.Upload
+	if hasProfile {
+		if err := gdb.Where("profile_id = ?", prof.ID).Order("id").Find(&ups).Error; err != nil {
+			return fmt.Errorf("load uploads: %w", err)
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	for _, u := range ups {
+		rec := Upload{FileName: u.FileName, ContentType: u.ContentType, Failed: u.Failed, FailedReason: u.FailedReason, CreatedAt: u.CreatedAt}
+		if p := locate(u); p != "" {
+			name := imagesDir + path.Base(u.FileName)
+			if err := copyIntoZip(zw, name, p); err == nil {
+				rec.Image = name
+			}
+		}
+		m.Uploads = append(m.Uploads, rec)
+	}
+	if err := writeJSON(zw, catatanJSON, m.Catatan); err != nil {
+		return err
+	}
+	if err := writeCSV(zw, m.Catatan); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, manifestName, m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func copyIntoZip(zw *zip.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// receipts are already compressed images; store them as-is
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(zw *zip.Writer, cats []Catatan) error {
+	w, err := zw.Create(catatanCSV)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"file_name", "amount", "date", "created_at"})
+	for _, c := range cats {
+		_ = cw.Write([]string{c.FileName, strconv.FormatInt(c.Amount, 10), c.Date.Format(time.RFC3339), c.CreatedAt.Format(time.RFC3339)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Archive is an opened export.
+type Archive struct {
+	Manifest Manifest
+	files    map[string]*zip.File
+}
+
+// Read opens an archive and validates its manifest.
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	a := &Archive{files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		a.files[f.Name] = f
+	}
+	mf, ok := a.files[manifestName]
+	if !ok {
+		return nil, errors.New("archive has no manifest.json")
+	}
+	rc, err := mf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&a.Manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if a.Manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version %d (want %d)", a.Manifest.FormatVersion, FormatVersion)
+	}
+	return a, nil
+}
+
+// Open returns a reader for a file inside the archive.
+func (a *Archive) Open(name string) (io.ReadCloser, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not in archive", name)
+	}
+	return f.Open()
+}
@@ -0,0 +1,93 @@
+package userarchive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/storagepath"
+	"be03/pkg/testenv"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := testenv.OpenDB(t, &fixtures.Set{
+		Users:   []fixtures.User{{Username: "demo", Password: "demo1234", Role: "user", Profile: &fixtures.Profile{Name: "Demo", Email: "d@example.com"}}},
+		Uploads: []fixtures.Upload{{User: "demo", FileName: "a.jpg", ContentType: "image/jpeg"}, {User: "demo", FileName: "gone.jpg"}},
+		Catatan: []fixtures.Catatan{{User: "demo", FileName: "a.jpg", Amount: 125000, Date: "2025-08-01"}},
+	})
+	imgDir := t.TempDir()
+	img := filepath.Join(imgDir, "a.jpg")
+	if err := os.WriteFile(img, testenv.JPEG, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var demo models.User
+	src.Where("username = ?", "demo").First(&demo)
+
+	var buf bytes.Buffer
+	locate := func(u models.Upload) string {
+		if u.FileName == "a.jpg" {
+			return img
+		}
+		return ""
+	}
+	if err := Export(&buf, src, demo.ID, locate); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	a, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if a.Manifest.Username != "demo" || len(a.Manifest.Catatan) != 1 || len(a.Manifest.Uploads) != 2 {
+		t.Fatalf("unexpected manifest: %+v", a.Manifest)
+	}
+	if _, err := a.Open(catatanCSV); err != nil {
+		t.Fatalf("csv missing: %v", err)
+	}
+
+	dst := testenv.OpenDB(t)
+	restoreDir := t.TempDir()
+	// a stray file under the name the new profile's image would get
+	var last models.Profile
+	dst.Order("id desc").First(&last)
+	stray := filepath.Join(restoreDir, storagepath.DiskName(last.ID+1, "a.jpg"))
+	if err := os.WriteFile(stray, []byte("someone else's"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Import(dst, a, ImportOptions{Username: "demo2", ImageDir: restoreDir})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if !res.CreatedUser || res.GeneratedPass == "" || res.Catatan != 1 || res.Uploads != 2 || res.ImagesRestored != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	var ct models.CatatanKeuangan
+	if err := dst.Where("user_id = ? AND file_name = ?", res.UserID, "a.jpg").First(&ct).Error; err != nil || ct.Amount != 125000 {
+		t.Fatalf("catatan not restored: %v %+v", err, ct)
+	}
+	var up models.Upload
+	dst.Where("file_name = ?", "a.jpg").First(&up)
+	if up.KeuanganID == nil || *up.KeuanganID != ct.ID {
+		t.Fatalf("upload not linked: %+v", up)
+	}
+	// restored under the new profile's stored name
+	if filepath.Dir(filepath.FromSlash(up.StorePath)) != restoreDir || filepath.Base(up.StorePath) == "a.jpg" {
+		t.Fatalf("image stored at %q", up.StorePath)
+	}
+	if got, _ := os.ReadFile(filepath.FromSlash(up.StorePath)); !bytes.Equal(got, testenv.JPEG) {
+		t.Fatal("image not restored")
+	}
+	if got, _ := os.ReadFile(stray); string(got) != "someone else's" || filepath.FromSlash(up.StorePath) == stray {
+		t.Fatalf("existing file reused or overwritten; image stored at %q", up.StorePath)
+	}
+
+	res, err = Import(dst, a, ImportOptions{Username: "demo2", ImageDir: restoreDir})
+	if err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	if res.CreatedUser || res.Catatan != 0 || res.SkippedCatatan != 1 || res.SkippedUploads != 2 {
+		t.Fatalf("re-import should be a no-op: %+v", res)
+	}
+}
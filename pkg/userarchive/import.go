@@ -0,0 +1,191 @@
+package userarchive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"be03/models"
+	"be03/pkg/storagepath"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ImportOptions controls how an archive is restored.
+type ImportOptions struct {
+	// Username overrides the archived username (e.g. when it is taken on the target).
+	Username string
+	// Password for a newly created user; a random one is generated when empty.
+	Password string
+	// ImageDir receives restored receipt images (default public/processed).
+	ImageDir string
+}
+
+// ImportResult summarises a restore.
+type ImportResult struct {
+	UserID          uint
+	Username        string
+	CreatedUser     bool
+	GeneratedPass   string
+	Catatan         int
+	SkippedCatatan  int
+	Uploads         int
+	SkippedUploads  int
+	ImagesRestored  int
+	PreferencesSet  bool
+	ProfileRestored bool
+}
+
+// Import restores the archive. Existing users are merged into: catatan and uploads
+// already present (same file name) are skipped, so importing twice is harmless.
+func Import(gdb *gorm.DB, a *Archive, opts ImportOptions) (*ImportResult, error) {
+	m := a.Manifest
+	username := opts.Username
+	if username == "" {
+		username = m.Username
+	}
+	if username == "" {
+		return nil, errors.New("archive has no username; pass one explicitly")
+	}
+	imageDir := opts.ImageDir
+	if imageDir == "" {
+		imageDir = storagepath.File(storagepath.Processed)
+	}
+	res := &ImportResult{Username: username}
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Where("username = ?", username).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			pw := opts.Password
+			if pw == "" {
+				b := make([]byte, 9)
+				_, _ = rand.Read(b)
+				pw = hex.EncodeToString(b)
+				res.GeneratedPass = pw
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			var role models.Role
+			if err := tx.Where("name = ?", "user").First(&role).Error; err != nil {
+				return fmt.Errorf("role user missing: %w", err)
+			}
+			user = models.User{Username: username, HashedPassword: hash, RoleID: &role.ID}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("create user: %w", err)
+			}
+			res.CreatedUser = true
+		case err != nil:
+			return fmt.Errorf("lookup user: %w", err)
+		}
+		res.UserID = user.ID
+
+		var prof models.Profile
+		if err := tx.Where("user_id = ?", user.ID).First(&prof).Error; err != nil {
+			prof = models.Profile{UserID: user.ID, Name: username}
+		}
+		if m.Profile.Name != "" {
+			prof.Name, prof.Email, prof.Phone, prof.Address, prof.Occupation = m.Profile.Name, m.Profile.Email, m.Profile.Phone, m.Profile.Address, m.Profile.Occupation
+			res.ProfileRestored = true
+		}
+		if err := tx.Save(&prof).Error; err != nil {
+			return fmt.Errorf("save profile: %w", err)
+		}
+
+		if p := m.Preferences; p != nil {
+			prefs := models.DefaultPreferences(user.ID)
+			_ = tx.Where("user_id = ?", user.ID).First(&prefs).Error
+			prefs.Currency, prefs.Timezone, prefs.Language = p.Currency, p.Timezone, p.Language
+			prefs.ReviewLowConfidence, prefs.NotifyEmail, prefs.NotifyWebhook, prefs.NotifyPush, prefs.WebhookURL = p.ReviewLowConfidence, p.NotifyEmail, p.NotifyWebhook, p.NotifyPush, p.WebhookURL
+			if err := tx.Save(&prefs).Error; err != nil {
+				return fmt.Errorf("save preferences: %w", err)
+			}
+			res.PreferencesSet = true
+		}
+
+		catIDs := map[string]uint{}
+		for _, c := range m.Catatan {
+			var existing models.CatatanKeuangan
+			if tx.Where("user_id = ? AND file_name = ?", user.ID, c.FileName).First(&existing).Error == nil {
+				catIDs[c.FileName] = existing.ID
+				res.SkippedCatatan++
+				continue
+			}
+			ct := models.CatatanKeuangan{UserID: user.ID, FileName: c.FileName, Amount: c.Amount, Date: c.Date}
+			if err := tx.Create(&ct).Error; err != nil {
+				return fmt.Errorf("create catatan %s: %w", c.FileName, err)
+			}
+			catIDs[c.FileName] = ct.ID
+			res.Catatan++
+		}
+
+		for _, u := range m.Uploads {
+			var cnt int64
+			tx.Model(&models.Upload{}).Where("profile_id = ? AND file_name = ?", prof.ID, u.FileName).Count(&cnt)
+			if cnt > 0 {
+				res.SkippedUploads++
+				continue
+			}
+			up := models.Upload{ProfileID: prof.ID, FileName: u.FileName, ContentType: u.ContentType, Failed: u.Failed, FailedReason: u.FailedReason}
+			if id, ok := catIDs[u.FileName]; ok {
+				up.KeuanganID = &id
+			}
+			if u.Image != "" {
+				dst, err := restoreImage(a, u.Image, imageDir, prof.ID, u.FileName)
+				if err != nil {
+					return fmt.Errorf("restore image %s: %w", u.Image, err)
+				}
+				up.StorePath = filepath.ToSlash(dst)
+				res.ImagesRestored++
+			}
+			if err := tx.Create(&up).Error; err != nil {
+				return fmt.Errorf("create upload %s: %w", u.FileName, err)
+			}
+			res.Uploads++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// restoreImage writes the archived image name into dir as a new file and
+// returns its path: profileID's disk name for fileName, or a random variant of
+// it when that is taken. A file already there is never reused or overwritten,
+// whoever it belongs to.
+func restoreImage(a *Archive, name, dir string, profileID uint, fileName string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	rc, err := a.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	dst := filepath.Join(dir, storagepath.DiskName(profileID, fileName))
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	for i := 0; errors.Is(err, os.ErrExist) && i < 5; i++ {
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		dst = filepath.Join(dir, storagepath.DiskName(profileID, hex.EncodeToString(b)+"_"+fileName))
+		f, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		_ = f.Close()
+		_ = os.Remove(dst)
+		return "", err
+	}
+	return dst, f.Close()
+}
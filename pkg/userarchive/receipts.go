@@ -0,0 +1,83 @@
+package userarchive
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+
+	"gorm.io/gorm"
+)
+
+const receiptsIndex = "index.csv"
+
+// ExportReceipts writes a zip of userID's receipt images for catatan dated in
+// [from, to) (nil bounds are open) to w, with index.csv listing every catatan
+// and the image that belongs to it. Images are copied straight from disk into
+// the stream, so memory use does not grow with the archive. Dates in the index
+// are in loc.
+func ExportReceipts(w io.Writer, gdb *gorm.DB, userID uint, from, to *time.Time, loc *time.Location, locate Locator) error {
+	q := catatanarchive.Catatan(gdb, from).Where("user_id = ?", userID)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	var cats []models.CatatanKeuangan
+	if err := q.Order("date, id").Find(&cats).Error; err != nil {
+		return fmt.Errorf("load catatan: %w", err)
+	}
+	ids := make([]uint, 0, len(cats))
+	for _, c := range cats {
+		ids = append(ids, c.ID)
+	}
+	uploads := map[uint]models.Upload{}
+	if len(ids) > 0 {
+		var ups []models.Upload
+		err := gdb.Joins("JOIN profiles ON profiles.id = uploads.profile_id").
+			Where("profiles.user_id = ? AND uploads.keuangan_id IN ?", userID, ids).Order("uploads.id").Find(&ups).Error
+		if err != nil {
+			return fmt.Errorf("load uploads: %w", err)
+		}
+		for _, u := range ups {
+			if _, seen := uploads[*u.KeuanganID]; !seen {
+				uploads[*u.KeuanganID] = u
+			}
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	rows := make([][]string, 0, len(cats))
+	for _, c := range cats {
+		image := ""
+		if u, ok := uploads[c.ID]; ok {
+			if p := locate(u); p != "" {
+				// prefixed so receipts of different profiles never collide
+				name := fmt.Sprintf("%s%s_%d_%s", imagesDir, c.Date.In(loc).Format("2006-01-02"), c.ID, path.Base(u.FileName))
+				if err := copyIntoZip(zw, name, p); err == nil {
+					image = name
+				}
+			}
+		}
+		rows = append(rows, []string{strconv.FormatUint(uint64(c.ID), 10), c.Date.In(loc).Format("2006-01-02"),
+			strconv.FormatInt(c.Amount, 10), c.FileName, image})
+	}
+	iw, err := zw.Create(receiptsIndex)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(iw)
+	_ = cw.Write([]string{"catatan_id", "date", "amount", "file_name", "image"})
+	_ = cw.WriteAll(rows)
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
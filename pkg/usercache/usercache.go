@@ -0,0 +1,100 @@
+// Package usercache keeps the users that recently presented an access token
+// in memory, so authenticating a request does not read the users table every
+// time. Handlers that change a user call Invalidate; changes made by another
+// process (a second API instance, the reset_password script) are picked up
+// once the entry is older than the TTL.
+package usercache
+
+import (
+	"sync"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMax bounds the number of cached users.
+const DefaultMax = 10000
+
+type entry struct {
+	user models.User
+	at   time.Time
+}
+
+// Cache maps user IDs to their rows. A zero TTL disables caching.
+type Cache struct {
+	TTL time.Duration
+	Max int
+
+	mu      sync.Mutex
+	from    *gorm.DB
+	entries map[uint]entry
+}
+
+// New returns a cache holding users for ttl.
+func New(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl, Max: DefaultMax}
+}
+
+// Get returns user id with its Role, reading it from gdb when it is not cached
+// or the entry has expired. Lookup errors (including a deleted user) are not
+// cached.
+func (c *Cache) Get(gdb *gorm.DB, id uint) (models.User, error) {
+	if c.TTL > 0 {
+		c.mu.Lock()
+		e, ok := c.entries[id]
+		fresh := ok && c.from == gdb && time.Since(e.at) < c.TTL
+		c.mu.Unlock()
+		if fresh {
+			return e.user, nil
+		}
+	}
+	var u models.User
+	if err := gdb.Preload("Role").First(&u, id).Error; err != nil {
+		c.Invalidate(id)
+		return models.User{}, err
+	}
+	if c.TTL > 0 {
+		c.put(gdb, u)
+	}
+	return u, nil
+}
+
+func (c *Cache) put(gdb *gorm.DB, u models.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || c.from != gdb {
+		c.entries, c.from = map[uint]entry{}, gdb
+	}
+	if max := c.Max; max > 0 && len(c.entries) >= max {
+		now := time.Now()
+		for id, e := range c.entries {
+			if now.Sub(e.at) >= c.TTL {
+				delete(c.entries, id)
+			}
+		}
+		// still full: drop arbitrary entries, they are re-read on demand
+		for id := range c.entries {
+			if len(c.entries) < max {
+				break
+			}
+			delete(c.entries, id)
+		}
+	}
+	c.entries[u.ID] = entry{user: u, at: time.Now()}
+}
+
+// Invalidate drops id so the next Get reads it again.
+func (c *Cache) Invalidate(id uint) {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+}
+
+// Len reports the number of cached users.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,72 @@
+package usercache
+
+import (
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+
+	"gorm.io/gorm"
+)
+
+func TestGetCachesUntilInvalidated(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{{Username: "ani", Password: "secret1", Role: "user"}}})
+	var ani models.User
+	gdb.Where("username = ?", "ani").First(&ani)
+	reads := 0
+	gdb.Callback().Query().Before("gorm:query").Register("count_user_reads", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			reads++
+		}
+	})
+
+	c := New(time.Minute)
+	for i := 0; i < 3; i++ {
+		if u, err := c.Get(gdb, ani.ID); err != nil || u.Username != "ani" || u.Role.Name != "user" {
+			t.Fatalf("get: %+v %v", u, err)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("%d reads for three lookups", reads)
+	}
+
+	gdb.Model(&models.User{}).Where("id = ?", ani.ID).Update("token_version", 3)
+	if u, _ := c.Get(gdb, ani.ID); u.TokenVersion != 0 {
+		t.Fatal("cached entry should still be served")
+	}
+	c.Invalidate(ani.ID)
+	if u, _ := c.Get(gdb, ani.ID); u.TokenVersion != 3 || reads != 2 {
+		t.Fatalf("after invalidate: version %d, %d reads", u.TokenVersion, reads)
+	}
+
+	if _, err := c.Get(gdb, 9999); err == nil || c.Len() != 1 {
+		t.Fatalf("missing user: %v, %d cached", err, c.Len())
+	}
+
+	off := New(0)
+	off.Get(gdb, ani.ID)
+	off.Get(gdb, ani.ID)
+	if reads != 5 || off.Len() != 0 {
+		t.Fatalf("disabled cache: %d reads, %d cached", reads, off.Len())
+	}
+}
+
+func TestGetBoundsEntries(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "a", Password: "secret1", Role: "user"}, {Username: "b", Password: "secret1", Role: "user"},
+		{Username: "c", Password: "secret1", Role: "user"},
+	}})
+	var users []models.User
+	gdb.Find(&users)
+	c := &Cache{TTL: time.Minute, Max: 2}
+	for _, u := range users {
+		if _, err := c.Get(gdb, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("%d cached, max 2", c.Len())
+	}
+}
@@ -0,0 +1,122 @@
+// Package usernames renames users. Every rename is kept in UsernameHistory,
+// which Resolve uses to find an account by a name it no longer has, and a
+// cooldown limits how often a user may rename.
+package usernames
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"be03/models"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned by Change.
+var (
+	ErrInvalid = errors.New("usernames: 3-32 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	ErrSame    = errors.New("usernames: new username equals the current one")
+	ErrTaken   = errors.New("usernames: username is taken")
+)
+
+// CooldownError is returned while the user's last rename is more recent
+// than the cooldown.
+type CooldownError struct {
+	Next time.Time // earliest time of the next rename
+}
+
+func (e *CooldownError) Error() string {
+	return "usernames: renamed too recently; next change at " + e.Next.UTC().Format(time.RFC3339)
+}
+
+var validRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{2,31}$`)
+
+// Valid reports whether name may be chosen in a rename. Registration is
+// more lenient, so existing accounts may have names that do not pass.
+func Valid(name string) bool { return validRE.MatchString(name) }
+
+// Cooldown is USERNAME_CHANGE_COOLDOWN (a Go duration, default 720h): the
+// minimum time between two renames of one user. 0 disables it.
+func Cooldown() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("USERNAME_CHANGE_COOLDOWN"))); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// LastChange returns the time of the user's most recent rename, zero when
+// there is none.
+func LastChange(gdb *gorm.DB, userID uint) (time.Time, error) {
+	var h models.UsernameHistory
+	err := gdb.Where("user_id = ?", userID).Order("changed_at DESC").Limit(1).Find(&h).Error
+	return h.ChangedAt, err
+}
+
+// Change renames user to name and records the old one. A name is taken when
+// another account has it (ignoring case) or had it before, so history stays
+// unambiguous; users may return to a name they had themselves.
+func Change(gdb *gorm.DB, user models.User, name string, cooldown time.Duration, now time.Time) (models.UsernameHistory, error) {
+	h := models.UsernameHistory{UserID: user.ID, OldUsername: user.Username, NewUsername: name, ChangedAt: now.UTC()}
+	switch {
+	case name == user.Username:
+		return h, ErrSame
+	case !Valid(name):
+		return h, ErrInvalid
+	}
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		if cooldown > 0 {
+			last, err := LastChange(tx, user.ID)
+			if err != nil {
+				return err
+			}
+			if next := last.Add(cooldown); !last.IsZero() && now.Before(next) {
+				return &CooldownError{Next: next}
+			}
+		}
+		var n int64
+		if err := tx.Model(&models.User{}).Where("LOWER(username) = ? AND id <> ?", strings.ToLower(name), user.ID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			if err := tx.Model(&models.UsernameHistory{}).Where("LOWER(old_username) = ? AND user_id <> ?", strings.ToLower(name), user.ID).Count(&n).Error; err != nil {
+				return err
+			}
+		}
+		if n > 0 {
+			return ErrTaken
+		}
+		// the unique index still guards against a concurrent rename to name
+		res := tx.Model(&models.User{}).Where("id = ? AND username = ?", user.ID, user.Username).Update("username", name)
+		if res.Error != nil {
+			return ErrTaken
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&h).Error
+	})
+	return h, err
+}
+
+// Resolve finds the user currently named name or, failing that, the user who
+// most recently gave it up.
+func Resolve(gdb *gorm.DB, name string) (models.User, error) {
+	var u models.User
+	err := gdb.Where("username = ?", name).First(&u).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, err
+	}
+	var h models.UsernameHistory
+	if err := gdb.Where("old_username = ?", name).Order("changed_at DESC").First(&h).Error; err != nil {
+		return u, err
+	}
+	return u, gdb.First(&u, h.UserID).Error
+}
+
+// ResolveSQL is a condition for raw SQL tools matching users u by name the way
+// Resolve does (Postgres placeholders); the name is $1.
+const ResolveSQL = `(u.username = $1 OR u.id = (SELECT h.user_id FROM username_histories h WHERE h.old_username = $1 ` +
+	`AND NOT EXISTS (SELECT 1 FROM users cur WHERE cur.username = $1) ORDER BY h.changed_at DESC LIMIT 1))`
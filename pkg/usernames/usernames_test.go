@@ -0,0 +1,60 @@
+package usernames
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/testenv"
+)
+
+func TestChangeAndResolve(t *testing.T) {
+	gdb := testenv.OpenDB(t, &fixtures.Set{Users: []fixtures.User{
+		{Username: "ani", Password: "secret1", Role: "user"},
+		{Username: "budi", Password: "secret2", Role: "user"},
+	}})
+	var ani, budi models.User
+	gdb.Where("username = ?", "ani").First(&ani)
+	gdb.Where("username = ?", "budi").First(&budi)
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for name, want := range map[string]error{"ani": ErrSame, "a": ErrInvalid, "ani smith": ErrInvalid, "BUDI": ErrTaken} {
+		if _, err := Change(gdb, ani, name, time.Hour, now); !errors.Is(err, want) {
+			t.Errorf("Change(%q) = %v, want %v", name, err, want)
+		}
+	}
+	h, err := Change(gdb, ani, "ani.store", time.Hour, now)
+	if err != nil || h.OldUsername != "ani" || h.NewUsername != "ani.store" {
+		t.Fatalf("rename: %+v %v", h, err)
+	}
+	ani.Username = "ani.store"
+
+	var cd *CooldownError
+	if _, err := Change(gdb, ani, "ani2", time.Hour, now.Add(30*time.Minute)); !errors.As(err, &cd) || !cd.Next.Equal(now.Add(time.Hour)) {
+		t.Fatalf("cooldown: %v", err)
+	}
+	// the name ani gave up is not free for others
+	if _, err := Change(gdb, budi, "ani", time.Hour, now); !errors.Is(err, ErrTaken) {
+		t.Fatalf("former name: %v", err)
+	}
+
+	for _, name := range []string{"ani", "ani.store"} {
+		u, err := Resolve(gdb, name)
+		if err != nil || u.ID != ani.ID {
+			t.Errorf("Resolve(%q) = %d %v", name, u.ID, err)
+		}
+	}
+	if _, err := Resolve(gdb, "nobody"); err == nil {
+		t.Error("Resolve found an unknown name")
+	}
+
+	// a user may return to a former name of their own once the cooldown passed
+	if _, err := Change(gdb, ani, "ani", time.Hour, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("rename back: %v", err)
+	}
+	if last, _ := LastChange(gdb, ani.ID); !last.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("LastChange = %v", last)
+	}
+}
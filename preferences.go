@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- preferences --------------------
+
+var currencyRE = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// supportedLanguages are the locales the frontend ships translations for.
+var supportedLanguages = map[string]struct{}{"id": {}, "en": {}}
+
+type preferencesView struct {
+	Currency            string `json:"currency"`
+	Timezone            string `json:"timezone"`
+	Language            string `json:"language"`
+	ReviewLowConfidence bool   `json:"review_low_confidence"`
+	NotifyEmail         bool   `json:"notify_email"`
+	NotifyWebhook       bool   `json:"notify_webhook"`
+	NotifyPush          bool   `json:"notify_push"`
+	WebhookURL          string `json:"webhook_url"`
+	ExifLocation        bool   `json:"exif_location"`
+}
+
+func viewPreferences(p models.Preferences) preferencesView {
+	return preferencesView{
+		Currency:            p.Currency,
+		Timezone:            p.Timezone,
+		Language:            p.Language,
+		ReviewLowConfidence: p.ReviewLowConfidence,
+		NotifyEmail:         p.NotifyEmail,
+		NotifyWebhook:       p.NotifyWebhook,
+		NotifyPush:          p.NotifyPush,
+		WebhookURL:          p.WebhookURL,
+		ExifLocation:        !p.SkipExifLocation,
+	}
+}
+
+// loadPreferences returns the stored preferences of userID or the defaults.
+func loadPreferences(userID uint) models.Preferences {
+	var p models.Preferences
+	if err := db.Where("user_id = ?", userID).First(&p).Error; err != nil {
+		return models.DefaultPreferences(userID)
+	}
+	return p
+}
+
+func getPreferencesHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, viewPreferences(loadPreferences(user.ID)))
+}
+
+// updatePreferencesHandler applies a partial update; omitted fields keep their value.
+func updatePreferencesHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Currency            *string `json:"currency"`
+		Timezone            *string `json:"timezone"`
+		Language            *string `json:"language"`
+		ReviewLowConfidence *bool   `json:"review_low_confidence"`
+		NotifyEmail         *bool   `json:"notify_email"`
+		NotifyWebhook       *bool   `json:"notify_webhook"`
+		NotifyPush          *bool   `json:"notify_push"`
+		WebhookURL          *string `json:"webhook_url"`
+		ExifLocation        *bool   `json:"exif_location"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	p := loadPreferences(user.ID)
+	if req.Currency != nil {
+		cur := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyRE.MatchString(cur) {
+			writeError(c, apierr.InvalidBody, "currency must be an ISO 4217 code", gin.H{"field": "currency"})
+			return
+		}
+		p.Currency = cur
+	}
+	if req.Timezone != nil {
+		tz := strings.TrimSpace(*req.Timezone)
+		if _, err := time.LoadLocation(tz); err != nil || tz == "" || tz == "Local" {
+			writeError(c, apierr.InvalidBody, "timezone must be an IANA zone such as Asia/Jakarta", gin.H{"field": "timezone"})
+			return
+		}
+		p.Timezone = tz
+	}
+	if req.Language != nil {
+		lang := strings.ToLower(strings.TrimSpace(*req.Language))
+		if _, ok := supportedLanguages[lang]; !ok {
+			writeError(c, apierr.InvalidBody, "unsupported language", gin.H{"field": "language", "supported": []string{"id", "en"}})
+			return
+		}
+		p.Language = lang
+	}
+	if req.ReviewLowConfidence != nil {
+		p.ReviewLowConfidence = *req.ReviewLowConfidence
+	}
+	if req.NotifyEmail != nil {
+		p.NotifyEmail = *req.NotifyEmail
+	}
+	if req.NotifyWebhook != nil {
+		p.NotifyWebhook = *req.NotifyWebhook
+	}
+	if req.NotifyPush != nil {
+		p.NotifyPush = *req.NotifyPush
+	}
+	if req.WebhookURL != nil {
+		p.WebhookURL = strings.TrimSpace(*req.WebhookURL)
+	}
+	if req.ExifLocation != nil {
+		p.SkipExifLocation = !*req.ExifLocation
+	}
+	if p.WebhookURL != "" {
+		if err := notify.CheckWebhookURL(p.WebhookURL); err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "webhook_url"})
+			return
+		}
+	}
+	if p.NotifyWebhook && p.WebhookURL == "" {
+		writeError(c, apierr.InvalidBody, "notify_webhook requires webhook_url", gin.H{"field": "webhook_url"})
+		return
+	}
+	if err := db.Save(&p).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, viewPreferences(p))
+}
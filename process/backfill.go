@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"be03/models"
+	"be03/pkg/anomaly"
+	"be03/pkg/logredact"
+	"be03/pkg/ocr"
+	"be03/pkg/ocrtext"
+	"be03/pkg/periodlock"
+	"be03/pkg/storagepath"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/usernames"
+)
+
+// -------------------- backfill --------------------
+
+// Directories a backfill reprocesses (--reprocess-processed, --reprocess-failed).
+const (
+	backfillProcessed = storagepath.Processed
+	backfillFailed    = storagepath.Failed
+)
+
+// backfillFilter selects the files a backfill reprocesses. Dates apply to
+// the upload's creation; Until is exclusive.
+type backfillFilter struct {
+	Since, Until time.Time
+	UserID       uint
+	// ZeroAmount keeps processed receipts recorded with amount 0; failed
+	// receipts never got an amount, so it keeps all of them.
+	ZeroAmount bool
+	// IgnoreCache runs OCR again on receipts whose OCR text is already stored
+	// (see pkg/ocrtext). By default only the heuristics run again, on the
+	// stored text (ocr.FromText): OCR would read the image the same way.
+	IgnoreCache bool
+}
+
+// backfillItem is a file chosen for reprocessing.
+type backfillItem struct {
+	Name    string // on disk, in the directory reprocessed
+	Upload  models.Upload
+	Catatan *models.CatatanKeuangan // processed receipts only
+	Text    string                  // stored OCR text; empty with IgnoreCache
+}
+
+// parseBackfillFilter builds the filter from the command line values.
+func parseBackfillFilter(since, until, user string, zero, noCache bool) (backfillFilter, error) {
+	f := backfillFilter{ZeroAmount: zero, IgnoreCache: noCache}
+	if since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			return f, fmt.Errorf("--since: %w", err)
+		}
+		f.Since = t
+	}
+	if until != "" {
+		t, err := time.ParseInLocation("2006-01-02", until, time.Local)
+		if err != nil {
+			return f, fmt.Errorf("--until: %w", err)
+		}
+		f.Until = t.AddDate(0, 0, 1) // the whole day
+	}
+	if user != "" {
+		// a renamed user is still found by a former name
+		u, err := usernames.Resolve(db, user)
+		if err != nil {
+			return f, fmt.Errorf("--user %s: %w", user, err)
+		}
+		f.UserID = u.ID
+	}
+	return f, nil
+}
+
+// backfillCandidates returns the files in src whose upload matches f,
+// sorted by name. Files without an upload are left alone: they have no owner.
+func backfillCandidates(src string, f backfillFilter) ([]backfillItem, error) {
+	q := db.Model(&models.Upload{})
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+	if f.UserID != 0 {
+		q = q.Where("profile_id IN (SELECT id FROM profiles WHERE user_id = ?)", f.UserID)
+	}
+	if src == backfillFailed {
+		q = q.Where("failed = ? AND keuangan_id IS NULL", true)
+	} else {
+		q = q.Where("keuangan_id IS NOT NULL")
+	}
+	var ups []models.Upload
+	if err := q.Find(&ups).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Upload, len(ups))
+	for _, u := range ups {
+		byName[uploadfiles.StoredName(u)] = u
+	}
+	var out []backfillItem
+	for _, name := range listImageFiles(storagepath.File(src)) {
+		up, ok := byName[name]
+		if !ok {
+			continue
+		}
+		it := backfillItem{Name: name, Upload: up}
+		if !f.IgnoreCache {
+			it.Text, _ = ocrtext.Load(db, up.ID)
+		}
+		if src == backfillProcessed {
+			var cat models.CatatanKeuangan
+			if err := db.First(&cat, *up.KeuanganID).Error; err != nil {
+				logV("SKIP %s: catatan %d not found", name, *up.KeuanganID)
+				continue
+			}
+			if f.ZeroAmount && cat.Amount != 0 {
+				continue
+			}
+			it.Catatan = &cat
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+// runBackfill reprocesses the matching files of src. Failed receipts
+// are reset and moved back into dir, where the worker pool handles them like
+// new uploads; processed receipts are read again in place and their catatan
+// corrected. With dryRun it only lists them.
+func runBackfill(dir, src string, f backfillFilter, workers int, dryRun bool) error {
+	items, err := backfillCandidates(src, f)
+	if err != nil {
+		return err
+	}
+	log.Printf("Backfill: %d files in %s match", len(items), src)
+	if dryRun {
+		for _, it := range items {
+			if it.Catatan != nil {
+				fmt.Printf("%s upload=%d catatan=%d amount=%d\n", it.Name, it.Upload.ID, it.Catatan.ID, it.Catatan.Amount)
+			} else {
+				fmt.Printf("%s upload=%d reason=%q\n", it.Name, it.Upload.ID, it.Upload.FailedReason)
+			}
+		}
+		return nil
+	}
+	if src == backfillFailed {
+		return requeueFailed(dir, items, workers)
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		updated int
+		jobs    = make(chan backfillItem)
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				if reprocessProcessed(it) {
+					mu.Lock()
+					updated++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, it := range items {
+		jobs <- it
+	}
+	close(jobs)
+	wg.Wait()
+	log.Printf("Backfill: %d of %d catatan corrected", updated, len(items))
+	return nil
+}
+
+// requeueFailed clears the failure of each upload, moves its file back into
+// dir and runs the worker pool over them. A receipt whose stored OCR text
+// still yields no amount stays where it is.
+func requeueFailed(dir string, items []backfillItem, workers int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	var names []string
+	for _, it := range items {
+		if it.Text != "" {
+			if res, err := ocr.FromText(it.Text); err != nil || res.Amount <= 0 {
+				logV("SKIP %s: stored OCR text of upload %d still has no amount", it.Name, it.Upload.ID)
+				continue
+			}
+		}
+		src := filepath.Join(storagepath.File(backfillFailed), it.Name)
+		dst := filepath.Join(dir, it.Name)
+		if _, err := os.Stat(dst); err == nil {
+			log.Printf("SKIP %s: already waiting in %s", it.Name, dir)
+			continue
+		}
+		err := db.Model(&models.Upload{}).Where("id = ?", it.Upload.ID).
+			Updates(map[string]any{"failed": false, "failed_reason": "", "processed_at": nil}).Error
+		if err != nil {
+			log.Printf("ERROR resetting upload %d: %v", it.Upload.ID, err)
+			continue
+		}
+		if err := os.Rename(src, dst); err != nil {
+			if err := copyRemove(src, dst); err != nil {
+				log.Printf("ERROR moving %s back to %s: %v", it.Name, dir, err)
+				continue
+			}
+		}
+		names = append(names, it.Name)
+	}
+	log.Printf("Backfill: requeued %d failed files (workers=%d)", len(names), workers)
+	runWorkerPool(dir, nil, preloadAll(dir, nil), names, workers)
+	return nil
+}
+
+// reprocessProcessed reads a processed receipt again, from its stored OCR
+// text when there is one, and corrects its catatan when another amount is
+// found. Catatan the owner confirmed or split are theirs and left unchanged,
+// and so are catatan in a closed period. It reports whether the catatan changed.
+func reprocessProcessed(it backfillItem) bool {
+	cat := it.Catatan
+	if cat.ConfirmedAt != nil || cat.Split {
+		logV("SKIP %s: catatan %d confirmed or split by its owner", it.Name, cat.ID)
+		return false
+	}
+	if err := periodlock.Check(db, cat.UserID, cat.Date); err != nil {
+		if errors.Is(err, periodlock.ErrLocked) {
+			logV("SKIP %s: catatan %d is in a closed period", it.Name, cat.ID)
+		} else {
+			log.Printf("ERROR checking the period of catatan %d for %s: %v", cat.ID, it.Name, err)
+		}
+		return false
+	}
+	var (
+		res *ocr.Result
+		err error
+	)
+	if it.Text != "" {
+		res, err = ocr.FromText(it.Text)
+	} else {
+		res, err = ocrEngine.Extract(filepath.Join(storagepath.File(backfillProcessed), it.Name))
+	}
+	if err != nil && !errors.Is(err, ocr.ErrNoAmount) {
+		reportFileError("ocr", it.Name, cat.UserID, err)
+		return false
+	}
+	if res != nil {
+		featureFlags.GateOCR(db, cat.UserID, res)
+		if it.Text == "" {
+			if err := ocrtext.SaveResult(db, it.Upload.ID, res); err != nil {
+				log.Printf("WARN storing OCR text for %s: %v", it.Name, err)
+			}
+		}
+	}
+	if err != nil || res.Amount <= 0 || res.Amount == cat.Amount {
+		logV("UNCHANGED %s: catatan %d keeps %s", it.Name, cat.ID, logredact.Amount(cat.Amount))
+		return false
+	}
+	old := cat.Amount
+	cat.Amount = res.Amount
+	cat.Tax, cat.ServiceCharge = res.Tax.Amounts()
+	if v := anomaly.Apply(db, cat); v.Suspect {
+		log.Printf("SUSPECT amount for %s owner=%d: %s", it.Name, cat.UserID, logredact.Digits(v.Reason))
+	}
+	if err := db.Select("amount", "tax", "service_charge", "suspect", "suspect_reason").Updates(cat).Error; err != nil {
+		log.Printf("ERROR updating catatan %d for %s: %v", cat.ID, it.Name, err)
+		return false
+	}
+	db.Model(&models.Upload{}).Where("id = ?", it.Upload.ID).Updates(map[string]any{
+		"ocr_confidence": res.Confidence, "ocr_heuristic": res.Heuristic, "ocr_raw_confidence": res.RawConfidence,
+		"reference": res.Reference,
+	})
+	log.Printf("REPROCESSED %s catatan=%d amount %s -> %s", it.Name, cat.ID, logredact.Amount(old), logredact.Amount(cat.Amount))
+	return true
+}
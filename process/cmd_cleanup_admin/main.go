@@ -2,14 +2,20 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 
+	"be03/pkg/usernames"
+
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	admin := flag.String("username", "admin", "username of the admin account to clean up")
+	flag.Parse()
+
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
 		log.Fatal("DB_DSN not set")
@@ -21,7 +27,7 @@ func main() {
 	defer db.Close()
 
 	var adminID sql.NullInt64
-	if err := db.QueryRow(`SELECT id FROM users WHERE username='admin' LIMIT 1`).Scan(&adminID); err != nil {
+	if err := db.QueryRow(`SELECT u.id FROM users u WHERE `+usernames.ResolveSQL+` LIMIT 1`, *admin).Scan(&adminID); err != nil {
 		log.Fatalf("find admin: %v", err)
 	}
 	if !adminID.Valid {
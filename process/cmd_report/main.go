@@ -9,10 +9,20 @@ import (
 )
 
 func main() {
-	username := flag.String("username", "fardiluser", "username to report for")
-	month := flag.String("month", "2025-08", "month to report (YYYY-MM)")
-	list := flag.Bool("list", false, "list matching rows")
+	var q report.Query
+	flag.StringVar(&q.Username, "username", "fardiluser", "username to report for")
+	flag.BoolVar(&q.AllUsers, "all-users", false, "report every user, with a section per user")
+	flag.StringVar(&q.Month, "month", "", "month to report (YYYY-MM); default 2025-08 without --from/--to")
+	flag.StringVar(&q.From, "from", "", "first day (YYYY-MM-DD)")
+	flag.StringVar(&q.To, "to", "", "last day (YYYY-MM-DD)")
+	flag.StringVar(&q.Category, "category", "", "only catatan in this category")
+	flag.StringVar(&q.Account, "account", "", "only catatan on the account with this name")
+	flag.BoolVar(&q.List, "list", false, "list matching rows")
+	format := flag.String("format", report.FormatTable, "output format: table, json or csv")
 	flag.Parse()
+	if q.Month == "" && q.From == "" && q.To == "" {
+		q.Month = "2025-08"
+	}
 
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
@@ -20,5 +30,6 @@ func main() {
 		os.Exit(2)
 	}
 
-	report.RunReport(*username, *month, *list)
+	// exits with report.ExitEmpty when no catatan matched
+	os.Exit(report.RunReport(q, *format))
 }
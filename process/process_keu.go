@@ -1,56 +1,84 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
-	"math"
-	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/disintegration/imaging"
 	"github.com/fsnotify/fsnotify"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
 	"be03/models"
+	"be03/pkg/accounts"
+	"be03/pkg/anomaly"
+	"be03/pkg/catatanstore"
+	"be03/pkg/dbhealth"
+	"be03/pkg/errreport"
+	"be03/pkg/exifmeta"
+	"be03/pkg/featureflags"
+	"be03/pkg/hooks"
+	"be03/pkg/imgcompress"
+	"be03/pkg/logredact"
+	"be03/pkg/maintenance"
+	"be03/pkg/notify"
 	"be03/pkg/ocr"
+	"be03/pkg/ocrcalib"
+	"be03/pkg/ocrexp"
+	"be03/pkg/ocrtext"
+	"be03/pkg/orgs"
+	"be03/pkg/periodlock"
+	"be03/pkg/phash"
+	"be03/pkg/storagepath"
+	"be03/pkg/tenancy"
+	"be03/pkg/uploadfiles"
+	"be03/pkg/uploadqueue"
 )
 
-var centsRE = regexp.MustCompile(`[.,]\d{2}$`)
-
 // Global DB handle for helper funcs
 var db *gorm.DB
 
+// ocrEngine performs OCR for processSingleFile; tests swap in a scripted fake.
+var ocrEngine ocr.Engine = ocr.TesseractEngine{}
+
+// featureFlags gates OCR features per receipt owner, as on the API servers.
+var featureFlags = &featureflags.Cache{TTL: 5 * time.Second}
+
 // global flags (parsed in main)
 var (
 	verbose     bool
 	simulateOCR bool
 )
 
-// (no global status server)
+// compressor re-encodes receipts over the storage budget in moveToProcessed;
+// main sizes it from --compress-workers and sets the options.
+var (
+	compressor      = imgcompress.NewPool(1)
+	compressOptions = imgcompress.Options{MaxBytes: imgcompress.DefaultMaxBytes, Format: imgcompress.FormatAuto}
+)
 
-// MIME mapping to avoid opening files repeatedly
-var extMime = map[string]string{
-	".jpg":  "image/jpeg",
-	".jpeg": "image/jpeg",
-	".png":  "image/png",
-	".gif":  "image/gif",
-	".webp": "image/webp",
-	".txt":  "text/plain",
-}
+// (no global status server)
 
 // preload caches
 type preloadState struct {
-	uploadsByFile map[string]*models.Upload          // fileName -> upload
-	catByFile     map[string]*models.CatatanKeuangan // fileName -> catatan
+	uploadsByFile map[string]*models.Upload          // stored (on-disk) name -> upload
+	catByFile     map[string]*models.CatatanKeuangan // catKey(userID, fileName) -> catatan
+	ownerByProf   map[uint]uint                      // profileID -> userID
+	adminUsers    map[uint]bool                      // userID -> has administrator role
+	inFlight      map[string]bool                    // fileName -> currently being processed
 	mu            sync.RWMutex
 }
 
@@ -58,9 +86,34 @@ func newPreloadState() *preloadState {
 	return &preloadState{
 		uploadsByFile: make(map[string]*models.Upload, 1024),
 		catByFile:     make(map[string]*models.CatatanKeuangan, 1024),
+		ownerByProf:   make(map[uint]uint, 64),
+		adminUsers:    make(map[uint]bool, 64),
+		inFlight:      make(map[string]bool, 64),
 	}
 }
 
+// begin marks name as in flight; it reports false when another worker already has it.
+func (ps *preloadState) begin(name string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.inFlight[name] {
+		return false
+	}
+	ps.inFlight[name] = true
+	return true
+}
+
+func (ps *preloadState) end(name string) {
+	ps.mu.Lock()
+	delete(ps.inFlight, name)
+	ps.mu.Unlock()
+}
+
+// catKey scopes catatan cache entries by owner since file names are only unique per user.
+func catKey(userID uint, name string) string {
+	return fmt.Sprintf("%d/%s", userID, name)
+}
+
 func (ps *preloadState) getUpload(name string) (*models.Upload, bool) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
@@ -69,44 +122,192 @@ func (ps *preloadState) getUpload(name string) (*models.Upload, bool) {
 }
 func (ps *preloadState) putUpload(u *models.Upload) {
 	ps.mu.Lock()
-	ps.uploadsByFile[u.FileName] = u
+	ps.uploadsByFile[uploadfiles.StoredName(*u)] = u
 	ps.mu.Unlock()
 }
-func (ps *preloadState) getCat(name string) (*models.CatatanKeuangan, bool) {
+func (ps *preloadState) getCat(userID uint, name string) (*models.CatatanKeuangan, bool) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
-	c, ok := ps.catByFile[name]
+	c, ok := ps.catByFile[catKey(userID, name)]
 	return c, ok
 }
 func (ps *preloadState) putCat(c *models.CatatanKeuangan) {
 	ps.mu.Lock()
-	ps.catByFile[c.FileName] = c
+	ps.catByFile[catKey(c.UserID, c.FileName)] = c
+	ps.mu.Unlock()
+}
+
+// ownerOf resolves the user owning a profile, caching the lookup.
+func (ps *preloadState) ownerOf(profileID uint) (uint, bool) {
+	ps.mu.RLock()
+	uid, ok := ps.ownerByProf[profileID]
+	ps.mu.RUnlock()
+	if ok {
+		return uid, true
+	}
+	var p models.Profile
+	if err := db.First(&p, profileID).Error; err != nil {
+		return 0, false
+	}
+	ps.mu.Lock()
+	ps.ownerByProf[profileID] = p.UserID
+	ps.mu.Unlock()
+	return p.UserID, true
+}
+
+// isAdministrator reports whether the user holds the administrator role (cached).
+func (ps *preloadState) isAdministrator(userID uint) bool {
+	ps.mu.RLock()
+	admin, ok := ps.adminUsers[userID]
+	ps.mu.RUnlock()
+	if ok {
+		return admin
+	}
+	var cnt int64
+	db.Table("users").Joins("JOIN roles ON roles.id = users.role_id").
+		Where("users.id = ? AND roles.name = ?", userID, "administrator").Count(&cnt)
+	ps.mu.Lock()
+	ps.adminUsers[userID] = cnt > 0
 	ps.mu.Unlock()
+	return cnt > 0
 }
 
-func mustInitDBFromEnv() *gorm.DB {
+// mustInitDBFromEnv opens DB_DSN; readOnly has Postgres refuse every write of
+// the session, as a safety net for simulations.
+func mustInitDBFromEnv(readOnly bool) *gorm.DB {
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
 		log.Fatalf("DB_DSN must be set in environment to run this tool")
 	}
-	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if readOnly {
+		dsn = readOnlyDSN(dsn)
+	}
+	var gdb *gorm.DB
+	err := dbhealth.Retry("postgres", dbhealth.BackoffFromEnv(), func() error {
+		var err error
+		gdb, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		return err
+	})
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
+	dbBreaker = dbhealth.BreakerFromEnv()
+	dbBreaker.OnChange = func(open bool, err error) {
+		if open {
+			log.Printf("database unreachable: pausing until it answers again (%v)", err)
+			errreport.Capture(errreport.Event{Message: "database unreachable", Err: err, Tags: map[string]string{"kind": "db", "service": "watcher"}})
+		} else {
+			log.Printf("database reachable again: resuming")
+		}
+	}
+	if err := dbhealth.Watch(gdb, dbBreaker); err != nil {
+		log.Printf("database health callbacks: %v", err)
+	}
+	// with MULTI_TENANT the rows the watcher creates take their owner's tenant
+	if tenancy.ConfigFromEnv().Enabled {
+		if err := gdb.Use(tenancy.Plugin{}); err != nil {
+			log.Fatalf("tenancy plugin: %v", err)
+		}
+	}
+	// amounts are read with the confidence calibration the API refits and
+	// the pipeline options an experiment promoted
+	ocrcalib.Watch(gdb, time.Minute)
+	ocrexp.Watch(gdb, time.Minute)
 	return gdb
 }
 
+// readOnlyDSN adds default_transaction_read_only to a URL or key=value DSN;
+// pgx passes it to the server as a session parameter.
+func readOnlyDSN(dsn string) string {
+	const param = "default_transaction_read_only"
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + param + "=on"
+	}
+	return strings.TrimSpace(dsn) + " " + param + "=on"
+}
+
 // Main: scans a directory of image receipts, creates Upload rows, runs OCR to create/link CatatanKeuangan, optional watch mode.
 func main() {
 	dirFlag := flag.String("dir", "public/keu", "directory to scan for receipt images")
-	profileID := flag.Uint("profile-id", 0, "Profile ID to assign uploads to (if omitted attempts admin profile)")
+	profileID := flag.Uint("profile-id", 0, "Profile ID that owns files without an existing upload row (if omitted, only files already registered via the API are processed)")
 	dryRun := flag.Bool("dry-run", false, "Skip all DB queries and writes; just list / optionally OCR (see --simulate-ocr)")
 	watch := flag.Bool("watch", false, "Watch directory for new files")
 	workers := flag.Int("workers", 0, "Worker pool size (default NumCPU)")
+	listen := flag.Bool("listen", true, "In watch mode: LISTEN for upload notifications from the API (Postgres)")
+	poll := flag.Duration("poll", 30*time.Second, "In watch mode: rescan interval as a fallback for missed events (0 disables)")
 	flag.BoolVar(&verbose, "verbose", false, "Verbose per-file logging")
 	flag.BoolVar(&simulateOCR, "simulate-ocr", false, "In dry-run: actually run OCR to show potential amounts")
+	withDB := flag.Bool("with-db", false, "In dry-run: read the DB (read-only session) and report the full decision per file as JSON")
+	report := flag.String("report", "", "With --with-db: write the JSON report to this file instead of stdout")
+	compressWorkers := flag.Int("compress-workers", 0, "Images re-encoded at once when over the 1 MB budget (default half of NumCPU)")
+	flag.StringVar(&compressOptions.Format, "format", imgcompress.FormatAuto, "Format of re-encoded images: auto (JPEG for photos), jpeg, png or webp (needs cwebp)")
+	redoProcessed := flag.Bool("reprocess-processed", false, "Backfill: read the receipts in public/processed again and correct their catatan, then exit")
+	redoFailed := flag.Bool("reprocess-failed", false, "Backfill: move the receipts in public/failed back into --dir and process them again, then exit")
+	since := flag.String("since", "", "Backfill: only uploads created on or after this date (YYYY-MM-DD)")
+	until := flag.String("until", "", "Backfill: only uploads created on or before this date (YYYY-MM-DD)")
+	user := flag.String("user", "", "Backfill: only this user's uploads (current or former username)")
+	zeroAmount := flag.Bool("zero-amount", false, "Backfill: only processed receipts recorded with amount 0")
+	noOCRCache := flag.Bool("no-ocr-cache", false, "Backfill: run OCR again on receipts whose OCR text is already stored, instead of rescoring that text")
 	flag.Parse()
 
+	if *compressWorkers <= 0 {
+		*compressWorkers = max(1, runtime.NumCPU()/2)
+	}
+	compressor = imgcompress.NewPool(*compressWorkers)
+	// intermediate OCR images of extractions cut short by a crash
+	if n, err := ocr.SweepStale(ocr.StaleAfter); n > 0 || err != nil {
+		log.Printf("ocr temp sweep: removed=%d err=%v", n, err)
+	}
+	if compressOptions.Format == imgcompress.FormatWebP && !imgcompress.WebPAvailable() {
+		log.Printf("WARN --format=webp but cwebp is not on PATH; using auto")
+		compressOptions.Format = imgcompress.FormatAuto
+	}
+
+	if *redoProcessed || *redoFailed {
+		if *redoProcessed && *redoFailed {
+			log.Fatal("--reprocess-processed and --reprocess-failed are separate runs")
+		}
+		src := backfillFailed
+		if *redoProcessed {
+			src = backfillProcessed
+		}
+		db = mustInitDBFromEnv(*dryRun)
+		f, err := parseBackfillFilter(*since, *until, *user, *zeroAmount, *noOCRCache)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runBackfill(*dirFlag, src, f, effectiveWorkers(*workers), *dryRun); err != nil {
+			log.Fatalf("backfill: %v", err)
+		}
+		return
+	}
+
+	if *dryRun && *withDB {
+		db = mustInitDBFromEnv(true)
+		profile := resolveProfile(*profileID)
+		ps := preloadAll(*dirFlag, profile)
+		files := listImageFiles(*dirFlag)
+		log.Printf("Simulating %d files against the database (read-only)", len(files))
+		out := io.Writer(os.Stdout)
+		if *report != "" {
+			f, err := os.Create(*report)
+			if err != nil {
+				log.Fatalf("report: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		rep := simulateAll(*dirFlag, profile, ps, files, effectiveWorkers(*workers))
+		if err := writeSimulationReport(out, rep); err != nil {
+			log.Fatalf("report: %v", err)
+		}
+		log.Printf("Simulation: %v", rep.Summary)
+		return
+	}
 	if *dryRun {
 		// fast dry-run path (no DB) unless profile-id required for parity; we only need DB if not dry-run
 		log.Printf("Dry-run: scanning %s (no DB interaction)", *dirFlag)
@@ -115,25 +316,29 @@ func main() {
 		if simulateOCR {
 			for _, f := range files {
 				if amt, conf, found, err := ocr.ExtractAmountFromImage(filepath.Join(*dirFlag, f)); err == nil && amt > 0 {
-					if found != "" {
-						lf := strings.TrimSpace(found)
-						if strings.Contains(lf, ".") || strings.HasSuffix(lf, ",00") || strings.HasSuffix(lf, ".00") {
-							if amt%100 == 0 {
-								amt = amt / 100
-							}
-						}
-					}
-					logV("OCR %s amount=%d conf=%.2f found=%s", f, amt, conf, found)
+					amt = ocr.NormalizeAmount(found, amt)
+					logV("OCR %s amount=%s conf=%.2f found=%s", f, logredact.Amount(amt), conf, logredact.Text(found))
 				}
 			}
 		}
 		return
 	}
 
-	db = mustInitDBFromEnv()
+	db = mustInitDBFromEnv(false)
+	if r, err := errreport.FromEnv("watcher"); err != nil {
+		log.Fatalf("error reporting: %v", err)
+	} else {
+		errreport.Set(r)
+		defer errreport.Flush(10 * time.Second)
+	}
+	if w, ok := hooks.WebhookFromEnv(); ok {
+		w.Start()
+		// a one-off scan exits once the queued events are sent
+		defer w.Stop(30 * time.Second)
+	}
 	profile := resolveProfile(*profileID)
 	// preload all uploads & catatan
-	ps := preloadAll(profile)
+	ps := preloadAll(*dirFlag, profile)
 	// no global status server
 	log.Printf("Preloaded: uploads=%d catatan=%d", len(ps.uploadsByFile), len(ps.catByFile))
 
@@ -141,15 +346,41 @@ func main() {
 	files := listImageFiles(*dirFlag)
 	log.Printf("Scanning %d files (workers=%d)", len(files), effectiveWorkers(*workers))
 	runWorkerPool(*dirFlag, profile, ps, files, effectiveWorkers(*workers))
+	if s := compressor.Stats(); s.Images > 0 {
+		log.Printf("Compression: %s", s)
+	}
+	if s := ocr.Stats(); s.Images > 0 {
+		log.Printf("OCR pixels: %s", s)
+	}
 
 	if *watch {
+		go logCompressionStats(10 * time.Minute)
+		var extra []<-chan string
+		if *listen {
+			extra = append(extra, listenForUploads(*dirFlag))
+		}
+		if *poll > 0 {
+			extra = append(extra, pollDirectory(*dirFlag, *poll))
+		}
 		// start watching without exposing HTTP status server
-		if err := watchDirectory(*dirFlag, profile, ps, effectiveWorkers(*workers)); err != nil {
+		if err := watchDirectory(*dirFlag, profile, ps, effectiveWorkers(*workers), extra...); err != nil {
 			log.Fatalf("watch failed: %v", err)
 		}
 	}
 }
 
+// logCompressionStats logs the compressor's totals every interval in which
+// it compressed something.
+func logCompressionStats(interval time.Duration) {
+	last := compressor.Stats().Images
+	for range time.Tick(interval) {
+		if s := compressor.Stats(); s.Images != last {
+			last = s.Images
+			log.Printf("Compression: %s", s)
+		}
+	}
+}
+
 func effectiveWorkers(w int) int {
 	if w <= 0 {
 		return runtime.NumCPU()
@@ -181,9 +412,7 @@ func chooseBestAmount(matches []string) (best int64, bestRaw string) {
 		if err != nil || amt <= 0 {
 			continue
 		}
-		if centsRE.MatchString(raw) && amt%100 == 0 {
-			amt /= 100
-		}
+		amt = ocr.NormalizeAmount(raw, amt)
 		if amt < 1000 {
 			continue
 		}
@@ -204,9 +433,7 @@ func chooseBestAmount(matches []string) (best int64, bestRaw string) {
 		if err != nil || amt <= 0 {
 			continue
 		}
-		if centsRE.MatchString(raw) && amt%100 == 0 {
-			amt /= 100
-		}
+		amt = ocr.NormalizeAmount(raw, amt)
 		if amt < 1000 {
 			continue
 		}
@@ -224,9 +451,7 @@ func chooseBestAmount(matches []string) (best int64, bestRaw string) {
 		if err != nil || amt <= 0 {
 			continue
 		}
-		if centsRE.MatchString(raw) && amt%100 == 0 {
-			amt /= 100
-		}
+		amt = ocr.NormalizeAmount(raw, amt)
 		if amt < 1000 {
 			continue
 		}
@@ -238,42 +463,49 @@ func chooseBestAmount(matches []string) (best int64, bestRaw string) {
 }
 
 // preloadAll fetches existing uploads and catatan to minimize per-file queries.
-func preloadAll(profile models.Profile) *preloadState {
+// Uploads are scoped to the default profile when one is configured, otherwise to
+// every upload stored under the watched directory.
+func preloadAll(dir string, profile *models.Profile) *preloadState {
 	ps := newPreloadState()
 	var ups []models.Upload
-	if err := db.Where("profile_id = ?", profile.ID).Find(&ups).Error; err == nil {
+	q := db.Model(&models.Upload{})
+	if profile != nil {
+		q = q.Where("profile_id = ?", profile.ID)
+	} else {
+		q = q.Where("store_path LIKE ?", "public/"+filepath.Base(dir)+"/%")
+	}
+	if err := q.Find(&ups).Error; err == nil {
 		for i := range ups {
 			u := ups[i]
-			ps.uploadsByFile[u.FileName] = &u
+			ps.uploadsByFile[uploadfiles.StoredName(u)] = &u
 		}
 	}
 	var cats []models.CatatanKeuangan
-	if err := db.Where("user_id = ?", profile.UserID).Find(&cats).Error; err == nil {
+	cq := db.Model(&models.CatatanKeuangan{})
+	if profile != nil {
+		cq = cq.Where("user_id = ?", profile.UserID)
+	}
+	if err := cq.Find(&cats).Error; err == nil {
 		for i := range cats {
 			c := cats[i]
-			ps.catByFile[c.FileName] = &c
+			ps.catByFile[catKey(c.UserID, c.FileName)] = &c
 		}
 	}
 	return ps
 }
 
-// resolveProfile finds the profile either by explicit id or by admin username.
-func resolveProfile(id uint) models.Profile {
-	var p models.Profile
-	if id != 0 {
-		if err := db.First(&p, id).Error; err != nil {
-			log.Fatalf("failed to find profile id %d: %v", id, err)
-		}
-		return p
-	}
-	var admin models.User
-	if err := db.Where("username = ?", "admin").First(&admin).Error; err != nil {
-		log.Fatalf("no --profile-id provided and admin user not found: %v", err)
+// resolveProfile loads the explicitly configured default profile. Without --profile-id
+// there is no default owner: files are attributed through their Upload row only.
+func resolveProfile(id uint) *models.Profile {
+	if id == 0 {
+		log.Printf("no --profile-id given: only files with an existing upload row will be processed")
+		return nil
 	}
-	if err := db.Where("user_id = ?", admin.ID).First(&p).Error; err != nil {
-		log.Fatalf("admin profile not found: %v", err)
+	var p models.Profile
+	if err := db.First(&p, id).Error; err != nil {
+		log.Fatalf("failed to find profile id %d: %v", id, err)
 	}
-	return p
+	return &p
 }
 
 func listImageFiles(dir string) []string {
@@ -297,7 +529,44 @@ func listImageFiles(dir string) []string {
 	return out
 }
 
-func watchDirectory(dir string, profile models.Profile, ps *preloadState, workers int) error {
+// listenForUploads relays API upload notifications for files stored under dir.
+// A reconnect triggers a full rescan since notifications may have been lost.
+func listenForUploads(dir string) <-chan string {
+	ch := make(chan string, 256)
+	prefix := "public/" + filepath.Base(dir) + "/"
+	go func() {
+		err := uploadqueue.Listen(context.Background(), os.Getenv("DB_DSN"), func(ev uploadqueue.Event) {
+			if strings.HasPrefix(ev.StorePath, prefix) {
+				logV("NOTIFY upload id=%d file=%s", ev.UploadID, ev.FileName)
+				ch <- filepath.Base(ev.StorePath)
+			}
+		}, func() {
+			for _, f := range listImageFiles(dir) {
+				ch <- f
+			}
+		})
+		log.Printf("upload listener stopped: %v (falling back to fsnotify/polling)", err)
+	}()
+	return ch
+}
+
+// pollDirectory rescans dir every interval so files are never stranded when both
+// fsnotify and LISTEN miss an event.
+func pollDirectory(dir string, interval time.Duration) <-chan string {
+	ch := make(chan string, 256)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for range t.C {
+			for _, f := range listImageFiles(dir) {
+				ch <- f
+			}
+		}
+	}()
+	return ch
+}
+
+func watchDirectory(dir string, profile *models.Profile, ps *preloadState, workers int, extra ...<-chan string) error {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -349,7 +618,7 @@ func watchDirectory(dir string, profile models.Profile, ps *preloadState, worker
 	}()
 
 	// Use worker pool for watch events too
-	go runWorkerPool(dir, profile, ps, nil, workers, fileCh)
+	go runWorkerPool(dir, profile, ps, nil, workers, append([]<-chan string{fileCh}, extra...)...)
 	// block forever (Ctrl+C to exit)
 	select {}
 }
@@ -367,9 +636,30 @@ func isSupportedExt(name string) bool {
 	return false
 }
 
+// dbBreaker opens after repeated database connection failures; workers leave
+// files alone while it is open (one per cooldown goes through as a probe) and
+// the poller offers them again.
+var dbBreaker = &dbhealth.Breaker{}
+
+// maintenanceWasOn remembers the last state so pauses are logged once.
+var maintenanceWasOn atomic.Bool
+
+// maintenancePaused reports whether maintenance mode is on (re-checked every 10s).
+func maintenancePaused() bool {
+	on := maintenance.Current(db, 10*time.Second).Enabled
+	if maintenanceWasOn.Swap(on) != on {
+		if on {
+			log.Printf("maintenance mode on: not claiming new files")
+		} else {
+			log.Printf("maintenance mode off: resuming")
+		}
+	}
+	return on
+}
+
 // processSingleFile executes idempotent logic to create/fill Upload & Catatan.
 // worker pool orchestrator
-func runWorkerPool(dir string, profile models.Profile, ps *preloadState, initial []string, workers int, extraCh ...<-chan string) {
+func runWorkerPool(dir string, profile *models.Profile, ps *preloadState, initial []string, workers int, extraCh ...<-chan string) {
 	fileCh := make(chan string, 1024)
 	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
@@ -377,7 +667,17 @@ func runWorkerPool(dir string, profile models.Profile, ps *preloadState, initial
 		go func() {
 			defer wg.Done()
 			for name := range fileCh {
-				processSingleFile(dir, name, profile, ps)
+				// files left alone during maintenance or a database outage
+				// are picked up again by the poller
+				if ok, _ := dbBreaker.Allow(); !ok || maintenancePaused() {
+					continue
+				}
+				// the same name can arrive from fsnotify, LISTEN and polling at once
+				if !ps.begin(name) {
+					continue
+				}
+				processRecovered(dir, name, profile, ps)
+				ps.end(name)
 			}
 		}()
 	}
@@ -404,15 +704,48 @@ func runWorkerPool(dir string, profile models.Profile, ps *preloadState, initial
 	}
 }
 
+// processRecovered runs processSingleFile, reporting a panic instead of
+// taking the whole watcher down with it.
+func processRecovered(dir, name string, profile *models.Profile, ps *preloadState) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("PANIC processing %s: %v", name, p)
+			errreport.Capture(errreport.Event{
+				Level:   "fatal",
+				Message: "panic processing receipt",
+				Err:     fmt.Errorf("%v", p),
+				Stack:   string(debug.Stack()),
+				Tags:    map[string]string{"kind": "panic", "stage": "process"},
+				Extra:   map[string]any{"file": name},
+			})
+		}
+	}()
+	processSingleFile(dir, name, profile, ps)
+}
+
+// reportFileError reports a failure processing a receipt; stage names the
+// step ("ocr", "create_upload", "create_catatan").
+func reportFileError(stage, name string, owner uint, err error) {
+	kind := "watcher"
+	if stage == "ocr" {
+		kind = "ocr"
+	}
+	errreport.Capture(errreport.Event{
+		Message: "watcher " + stage + " failed",
+		Err:     err,
+		Tags:    map[string]string{"kind": kind, "stage": stage},
+		Extra:   map[string]any{"file": name},
+		UserID:  owner,
+	})
+}
+
 // processSingleFile processes a single filename using preloaded maps & minimal queries.
-func processSingleFile(dir, name string, profile models.Profile, ps *preloadState) {
-	storePath := filepath.ToSlash(filepath.Join("public", filepath.Base(dir), name))
+// The owner always comes from the Upload row: either the one the API created, or one
+// created here under the explicitly configured default profile.
+func processSingleFile(dir, name string, profile *models.Profile, ps *preloadState) {
 	filePath := filepath.Join(dir, name)
+	storePath := storagepath.Of(filePath)
 
-	if _, ok := ps.getCat(name); ok { // catatan already exists
-		logV("SKIP catatan exists %s", name)
-		return
-	}
 	up, upExists := ps.getUpload(name)
 	// Retry a few times to allow API handler to create Upload row before watcher races to create its own
 	if !upExists {
@@ -432,31 +765,66 @@ func processSingleFile(dir, name string, profile models.Profile, ps *preloadStat
 		return
 	}
 
-	// Only run OCR if no catatan & (no upload OR upload without linkage)
-	var amt int64
-	var bestRaw string
-	// defer heavy OCR until after we know we might need it
-	needOCR := true
+	// Without an upload row the only possible owner is the configured default profile.
+	if !upExists && profile == nil {
+		log.Printf("SKIP no owner for %s: no upload row and no --profile-id configured", name)
+		return
+	}
+
+	// Resolve owner before any OCR work so unattributable files cost nothing.
+	ownerProfileID := uint(0)
+	if upExists {
+		ownerProfileID = up.ProfileID
+	} else {
+		ownerProfileID = profile.ID
+	}
+	ownerUserID, ok := ps.ownerOf(ownerProfileID)
+	if !ok || ownerUserID == 0 {
+		log.Printf("SKIP unknown owner for %s: profile %d not found; not creating catatan", name, ownerProfileID)
+		return
+	}
+	// name is the file on disk (see storagepath.DiskName); catatan carry the
+	// name the user uploaded
+	fileName := name
+	if upExists {
+		fileName = up.FileName
+	}
+	if _, ok := ps.getCat(ownerUserID, fileName); ok { // catatan already exists
+		logV("SKIP catatan exists %s", name)
+		return
+	}
 
-	// if extension is not supported (e.g., .pdf handled elsewhere or .exe/text),
-	// create upload and mark as not recognized so front-end sees the proper message.
-	if !isSupportedExt(name) {
-		// create upload if not exists (above logic will create it), but if it exists
-		// we still set Failed/FailedReason accordingly.
-		// Note: proceed to create upload by leaving upExists handling unchanged.
+	// Never attribute receipts to administrator accounts per business rule.
+	if ps.isAdministrator(ownerUserID) {
+		log.Printf("SKIP administrator ownership for %s: not creating catatan for admin user id=%d", name, ownerUserID)
+		if err := moveToProcessed(filepath.Join(dir, name), name); err != nil {
+			log.Printf("WARN failed to move processed file %s: %v", name, err)
+		}
+		return
 	}
 
-	// If upload doesn't exist, create it (DB write). Do not create under admin profile.
+	// If upload doesn't exist, create it under the default profile (DB write),
+	// unless that would exceed a quota of the owner's organizations.
 	if !upExists {
-		if profile.UserID == 1 {
-			log.Printf("SKIP creating upload for admin profile (user_id=1) file=%s", name)
-			if err := moveToProcessed(filepath.Join(dir, name), name); err != nil {
-				log.Printf("WARN failed to move processed file %s: %v", name, err)
+		var size int64
+		if fi, err := os.Stat(filePath); err == nil {
+			size = fi.Size()
+		}
+		if err := orgs.CheckQuota(db, ownerUserID, size, time.Now()); err != nil {
+			log.Printf("SKIP %s: %v; moving file to failed", name, err)
+			if err := moveToFailed(filePath, name); err != nil {
+				log.Printf("WARN failed to move %s to failed: %v", name, err)
 			}
 			return
 		}
-		newUp := models.Upload{ProfileID: profile.ID, FileName: name, StorePath: storePath}
-		if ct := mimeFromExt(name); ct != "" {
+		newUp := models.Upload{ProfileID: profile.ID, FileName: name, StorePath: storePath, SizeBytes: size}
+		// the EXIF is stripped on the way to processed; its wall-clock time is read in the owner's timezone
+		prefs := models.DefaultPreferences(ownerUserID)
+		db.Where("user_id = ?", ownerUserID).First(&prefs)
+		if t, ok := exifmeta.CaptureTimeFile(filePath, prefs.Location(), time.Now()); ok {
+			newUp.CapturedAt = &t
+		}
+		if ct, err := uploadfiles.ImageTypes.SniffFile(filePath); err == nil {
 			newUp.ContentType = ct
 		}
 		if err := db.Create(&newUp).Error; err != nil {
@@ -467,65 +835,132 @@ func processSingleFile(dir, name string, profile models.Profile, ps *preloadStat
 				}
 			} else {
 				log.Printf("ERROR create upload %s: %v", storePath, err)
+				reportFileError("create_upload", name, ownerUserID, err)
 				return
 			}
+		} else {
+			hooks.EmitUploadStored(context.Background(), hooks.UploadStored{Upload: newUp, UserID: ownerUserID, Source: hooks.SourceWatcher})
 		}
 		ps.putUpload(&newUp)
 		up = &newUp
 		log.Printf("NEW upload id=%d file=%s", newUp.ID, name)
+		if data, err := os.ReadFile(filePath); err == nil {
+			if h, ok := phash.Compute(data); ok {
+				if err := phash.Index(db, &newUp, h); err != nil {
+					log.Printf("WARN phash of %s: %v", name, err)
+				}
+			}
+		}
+		orgs.WarnNearLimit(db, ownerUserID, time.Now())
 	}
 
-	// Fill missing content type cheaply
+	// uploads of older versions may lack the content type
 	if up.ContentType == "" {
-		if ct := mimeFromExt(name); ct != "" {
+		if ct, err := uploadfiles.ImageTypes.SniffFile(filePath); err == nil {
 			up.ContentType = ct
 			_ = db.Save(up).Error
 		}
 	}
 
-	if needOCR {
+	// photos too dark, blurry or small to read are failed without running OCR
+	quality, _ := ocr.AssessFile(filePath)
+	if quality != nil && quality.Reject() {
+		log.Printf("POOR IMAGE %s (%v): marking upload failed and moving file to failed", name, quality.Problems)
+		processedAt := time.Now()
+		up.ProcessedAt = &processedAt
+		up.Failed = true
+		up.FailedReason = quality.FailureReason()
+		_ = db.Save(up).Error
+		_ = moveToFailed(filePath, name)
+		notifyOCRFailed(ownerUserID, fileName)
+		return
+	}
+
+	var amt int64
+	var bestRaw, institution, merchant string
+	var tax *ocr.Tax
+	var printedDate *time.Time
+	// a QRIS payment code carrying the amount is read instead of running OCR
+	qr, qErr := ocrEngine.QRIS(filePath)
+	if qErr != nil {
+		logV("QRIS fail %s: %v", name, qErr)
+	}
+	if qr != nil {
+		merchant = qr.Merchant
+	}
+	var matches []string
+	var isLikelyNonAmount bool
+	if qr == nil || qr.Amount <= 0 {
 		// Use FindAllMatches to detect zero / multiple matches cases
-		matches, isLikelyNonAmount, mErr := ocr.FindAllMatches(filePath)
+		var mErr error
+		matches, isLikelyNonAmount, mErr = ocrEngine.FindAllMatches(filePath)
 		if mErr != nil {
 			logV("OCR fail %s: %v", name, mErr)
+			reportFileError("ocr", name, ownerUserID, mErr)
 			return
 		}
-		if len(matches) == 0 {
-			// no amount: differentiate logo-like images vs generic no-digits
-			up.Failed = true
-			if isLikelyNonAmount {
-				log.Printf("NO AMOUNT / likely non-amount for %s: marking upload failed and moving file to failed", name)
-				up.FailedReason = "File tidak dikenali, gunakan file lain!"
-				_ = db.Save(up).Error
-				_ = moveToFailed(filePath, name)
-				return
-			}
-			log.Printf("NO AMOUNT found for %s: marking upload failed and moving file to failed", name)
-			up.FailedReason = "Nominal tidak ditemukan, gunakan file lain"
+	}
+	processedAt := time.Now()
+	up.ProcessedAt = &processedAt
+	if qr != nil && qr.Amount > 0 {
+		res := qr.Result()
+		amt, bestRaw = res.Amount, res.Raw
+		conf, raw := res.Confidence, res.RawConfidence
+		up.OCRConfidence = &conf
+		up.OCRHeuristic, up.OCRRawConfidence, up.Reference = res.Heuristic, &raw, res.Reference
+	} else if len(matches) == 0 {
+		// no amount: differentiate logo-like images vs generic no-digits
+		up.Failed = true
+		if isLikelyNonAmount {
+			log.Printf("NO AMOUNT / likely non-amount for %s: marking upload failed and moving file to failed", name)
+			up.FailedReason = "File tidak dikenali, gunakan file lain!"
 			_ = db.Save(up).Error
 			_ = moveToFailed(filePath, name)
+			notifyOCRFailed(ownerUserID, fileName)
 			return
 		}
-		// Choose the best amount from all matches
-		if bAmt, bRaw := chooseBestAmount(matches); bAmt > 0 {
-			amt, bestRaw = bAmt, bRaw
-		} else {
-			// Fallback: try a full-image extraction which may catch the primary amount
-			if fAmt, _, fFound, ferr := ocr.ExtractAmountFromImage(filePath); ferr == nil && fAmt > 0 {
-				amt, bestRaw = fAmt, fFound
-			} else {
-				// Could not determine amount
-				up.Failed = true
-				up.FailedReason = "Nominal tidak ditemukan, gunakan file lain"
-				_ = db.Save(up).Error
-				_ = moveToFailed(filePath, name)
-				return
+		log.Printf("NO AMOUNT found for %s: marking upload failed and moving file to failed", name)
+		up.FailedReason = quality.FailureReason()
+		_ = db.Save(up).Error
+		_ = moveToFailed(filePath, name)
+		notifyOCRFailed(ownerUserID, fileName)
+		return
+	} else if bAmt, bRaw := chooseBestAmount(matches); bAmt > 0 {
+		// the best amount from all matches
+		amt, bestRaw = bAmt, bRaw
+	} else {
+		// Fallback: try a full-image extraction which may catch the primary amount
+		res, ferr := ocrEngine.Extract(filePath)
+		if ferr != nil && !errors.Is(ferr, ocr.ErrNoAmount) {
+			reportFileError("ocr", name, ownerUserID, ferr)
+		}
+		if res != nil {
+			featureFlags.GateOCR(db, ownerUserID, res)
+			if err := ocrtext.SaveResult(db, up.ID, res); err != nil {
+				log.Printf("WARN storing OCR text for %s: %v", name, err)
+			}
+		}
+		if ferr == nil && res.Amount > 0 {
+			amt, bestRaw, institution, printedDate, tax = res.Amount, res.Raw, res.Institution, res.Date, res.Tax
+			if res.QRIS != nil && merchant == "" {
+				merchant = res.QRIS.Merchant
 			}
+			conf, raw := res.Confidence, res.RawConfidence
+			up.OCRConfidence = &conf
+			up.OCRHeuristic, up.OCRRawConfidence, up.Reference = res.Heuristic, &raw, res.Reference
+		} else {
+			// Could not determine amount
+			up.Failed = true
+			up.FailedReason = quality.FailureReason()
+			_ = db.Save(up).Error
+			_ = moveToFailed(filePath, name)
+			notifyOCRFailed(ownerUserID, fileName)
+			return
 		}
 	}
 
 	// Re-check if catatan created concurrently
-	if _, ok := ps.getCat(name); ok {
+	if _, ok := ps.getCat(ownerUserID, fileName); ok {
 		return
 	}
 
@@ -533,68 +968,59 @@ func processSingleFile(dir, name string, profile models.Profile, ps *preloadStat
 	if amt <= 0 {
 		return
 	}
-
-	// Resolve owner from Upload (retry if needed). Do NOT default to admin; determine from upload/profile.
-	var ownerUserID uint = 0
-	for i := 0; i < 3 && up == nil; i++ { // small retry to avoid race
-		if !upExists {
-			var dbUp models.Upload
-			if err := db.Where("store_path = ? OR file_name = ?", storePath, name).First(&dbUp).Error; err == nil {
-				up = &dbUp
-				upExists = true
-				ps.putUpload(up)
-			}
-		}
-		if up != nil {
-			var ownerProfile models.Profile
-			if err := db.First(&ownerProfile, up.ProfileID).Error; err == nil {
-				ownerUserID = ownerProfile.UserID
-			}
-			break
-		}
-		time.Sleep(300 * time.Millisecond)
+	var conf float64
+	if up.OCRConfidence != nil {
+		conf = *up.OCRConfidence
 	}
+	ocrexp.Shadow(db, filePath, &ocr.Result{Amount: amt, Confidence: conf})
+	hooks.EmitAmountExtracted(context.Background(), hooks.AmountExtracted{Upload: *up, UserID: ownerUserID, Amount: amt, Confidence: conf, Source: hooks.SourceWatcher})
 
-	// If owner couldn't be determined, as a safety do not attribute to admin implicitly.
-	if ownerUserID == 0 {
-		log.Printf("SKIP unknown owner for %s: no upload owner resolved; not creating catatan", name)
+	// Create or fetch catatan for the correct owner
+	txDate, dateSource := catatanstore.TransactionDate(printedDate, up.CapturedAt, time.Now())
+	// a closed period takes no new catatan: the upload waits for review and the
+	// file moves on so the next scan does not read it again
+	if err := periodlock.Check(db, ownerUserID, txDate); err != nil {
+		holdForReview(up, ownerUserID, txDate, err)
 		if err := moveToProcessed(filepath.Join(dir, name), name); err != nil {
-			log.Printf("WARN failed to move processed file %s: %v", name, err)
+			log.Printf("WARN failed to move held file %s: %v", name, err)
 		}
 		return
 	}
-
-	// Never attribute to admin (user_id=1) per business rule.
-	if ownerUserID == 1 {
-		log.Printf("SKIP admin ownership for %s: not creating catatan for admin (user_id=1)", name)
-		if err := moveToProcessed(filepath.Join(dir, name), name); err != nil {
-			log.Printf("WARN failed to move processed file %s: %v", name, err)
-		}
+	cat := models.CatatanKeuangan{UserID: ownerUserID, FileName: fileName, Amount: amt, Date: txDate, DateSource: dateSource,
+		Merchant: merchant, Reference: catatanstore.Reference(up.Reference)}
+	cat.AccountID = accounts.Match(db, ownerUserID, institution)
+	cat.Tax, cat.ServiceCharge = tax.Amounts()
+	if v := anomaly.Apply(db, &cat); v.Suspect {
+		log.Printf("SUSPECT amount for %s owner=%d: %s", name, ownerUserID, logredact.Digits(v.Reason))
+	}
+	// owners who review low-confidence readings confirm them first
+	if up.OCRConfidence != nil && conf < ocr.LowConfidenceThreshold {
+		db.Model(&models.Preferences{}).Select("review_low_confidence").Where("user_id = ?", ownerUserID).Scan(&cat.Pending)
+	}
+	cat.ContentHash = catatanstore.HashFile(filePath)
+	created, err := catatanstore.Create(db, &cat)
+	if err != nil {
+		log.Printf("ERROR creating catatan for %s owner=%d: %v", name, ownerUserID, err)
+		reportFileError("create_catatan", name, ownerUserID, err)
 		return
 	}
-
-	// Create or fetch catatan for the correct owner
-	cat := models.CatatanKeuangan{UserID: ownerUserID, FileName: name, Amount: amt, Date: time.Now()}
-	if err := db.Create(&cat).Error; err != nil {
-		var existing models.CatatanKeuangan
-		if err2 := db.Where("user_id = ? AND file_name = ?", ownerUserID, name).First(&existing).Error; err2 == nil {
-			// Optionally update amount if new detection is clearly larger (e.g., fix from 20285 -> 600000)
-			if amt > existing.Amount && amt >= existing.Amount*2 {
-				existing.Amount = amt
-				_ = db.Save(&existing).Error
-			}
-			cat = existing
-		} else {
-			log.Printf("ERROR creating catatan for %s owner=%d: %v", name, ownerUserID, err)
-			return
+	if created {
+		hooks.EmitCatatanCreated(context.Background(), hooks.CatatanCreated{Catatan: cat, Source: hooks.SourceWatcher})
+	}
+	if !created && cat.FileName == fileName {
+		// Optionally update amount if new detection is clearly larger (e.g., fix from 20285 -> 600000)
+		if amt > cat.Amount && amt >= cat.Amount*2 {
+			cat.Amount = amt
+			_ = db.Save(&cat).Error
 		}
 	}
-	// Link upload if present
-	if up != nil && up.KeuanganID == nil {
+	ps.putCat(&cat)
+	// Link upload
+	if up.KeuanganID == nil {
 		up.KeuanganID = &cat.ID
-		_ = db.Save(up).Error
 	}
-	log.Printf("Pencatatan Sukses amount=%d raw=%q owner=%d file=%s", amt, bestRaw, ownerUserID, name)
+	_ = db.Save(up).Error
+	log.Printf("Pencatatan Sukses amount=%s raw=%q owner=%d file=%s", logredact.Amount(amt), logredact.Text(bestRaw), ownerUserID, name)
 	// Move the processed file out of public/keu into public/processed so new images are processed only once
 	if err := moveToProcessed(filepath.Join(dir, name), name); err != nil {
 		log.Printf("WARN failed to move processed file %s: %v", name, err)
@@ -603,32 +1029,211 @@ func processSingleFile(dir, name string, profile models.Profile, ps *preloadStat
 	}
 }
 
-// fillUpload ensures ContentType and KeuanganID present (creates Catatan if OCR finds amount)
-// legacy fillUpload removed (logic integrated in processSingleFile with preload state)
+// -------------------- simulation --------------------
 
-// sniffContentType reads first 512 bytes and returns MIME type.
-func sniffContentType(path string) string { // fallback only
-	f, err := os.Open(path)
-	if err != nil {
-		return ""
+// Simulated actions, one per file.
+const (
+	simSkip     = "skip"              // left alone (see reason)
+	simFail     = "fail"              // upload marked failed, file moved to public/failed
+	simCreate   = "create_catatan"    // new catatan, upload linked, file moved to public/processed
+	simLink     = "link_catatan"      // the owner already has this file or image: linked to that catatan
+	simNoRecord = "move_to_processed" // administrator owner: moved without a catatan
+	simHold     = "hold_for_review"   // dated in a closed period: moved without a catatan, upload noted
+)
+
+// simulation is the decision processSingleFile would take for one file.
+type simulation struct {
+	File           string     `json:"file"`
+	Action         string     `json:"action"`
+	Reason         string     `json:"reason,omitempty"`
+	UploadID       uint       `json:"upload_id,omitempty"`
+	CreateUpload   bool       `json:"create_upload,omitempty"`
+	OwnerProfileID uint       `json:"owner_profile_id,omitempty"`
+	OwnerUserID    uint       `json:"owner_user_id,omitempty"`
+	Amount         int64      `json:"amount,omitempty"`
+	Raw            string     `json:"raw,omitempty"`
+	Confidence     *float64   `json:"confidence,omitempty"`
+	Date           *time.Time `json:"date,omitempty"`
+	DateSource     string     `json:"date_source,omitempty"`
+	AccountID      *uint      `json:"account_id,omitempty"`
+	Tax            *ocr.Tax   `json:"tax,omitempty"`
+	Suspect        bool       `json:"suspect,omitempty"`
+	SuspectReason  string     `json:"suspect_reason,omitempty"`
+	CatatanID      uint       `json:"catatan_id,omitempty"` // the catatan linked to
+}
+
+// simulationReport is the JSON written by --dry-run --with-db.
+type simulationReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Dir         string         `json:"dir"`
+	Summary     map[string]int `json:"summary"`
+	Files       []simulation   `json:"files"`
+}
+
+// simulateAll decides every file with workers goroutines, keeping the order
+// of files in the report.
+func simulateAll(dir string, profile *models.Profile, ps *preloadState, files []string, workers int) simulationReport {
+	rep := simulationReport{GeneratedAt: time.Now().UTC(), Dir: dir, Summary: map[string]int{}, Files: make([]simulation, len(files))}
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				rep.Files[i] = simulateFile(dir, files[i], profile, ps)
+			}
+		}()
+	}
+	for i := range files {
+		idx <- i
 	}
-	defer f.Close()
-	buf := make([]byte, 512)
-	n, _ := f.Read(buf)
-	if n == 0 {
-		return ""
+	close(idx)
+	wg.Wait()
+	for _, f := range rep.Files {
+		rep.Summary[f.Action]++
 	}
-	return http.DetectContentType(buf[:n])
+	return rep
 }
 
-func mimeFromExt(name string) string {
-	ext := strings.ToLower(filepath.Ext(name))
-	if m, ok := extMime[ext]; ok {
-		return m
+func writeSimulationReport(w io.Writer, rep simulationReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// simulateFile follows processSingleFile's decisions for name without writing
+// to the database or moving files: OCR runs, everything else is read only.
+func simulateFile(dir, name string, profile *models.Profile, ps *preloadState) simulation {
+	sim := simulation{File: name, Action: simSkip}
+	filePath := filepath.Join(dir, name)
+	storePath := storagepath.Of(filePath)
+
+	up, upExists := ps.getUpload(name)
+	if !upExists {
+		var dbUp models.Upload
+		if err := db.Where("store_path = ? OR file_name = ?", storePath, name).First(&dbUp).Error; err == nil {
+			up, upExists = &dbUp, true
+		}
+	}
+	if upExists {
+		sim.UploadID = up.ID
+		if up.KeuanganID != nil {
+			sim.Reason, sim.CatatanID = "upload already linked", *up.KeuanganID
+			return sim
+		}
+		sim.OwnerProfileID = up.ProfileID
+	} else if profile == nil {
+		sim.Reason = "no upload row and no --profile-id"
+		return sim
+	} else {
+		sim.OwnerProfileID = profile.ID
+	}
+	ownerUserID, ok := ps.ownerOf(sim.OwnerProfileID)
+	if !ok || ownerUserID == 0 {
+		sim.Reason = fmt.Sprintf("profile %d not found", sim.OwnerProfileID)
+		return sim
+	}
+	sim.OwnerUserID = ownerUserID
+	fileName := name
+	if upExists {
+		fileName = up.FileName
+	}
+	if c, ok := ps.getCat(ownerUserID, fileName); ok {
+		sim.Reason, sim.CatatanID = "catatan exists", c.ID
+		return sim
 	}
-	return "" // sniff later if needed
+	if ps.isAdministrator(ownerUserID) {
+		sim.Action, sim.Reason = simNoRecord, "administrator owner"
+		return sim
+	}
+
+	var captured *time.Time
+	if upExists {
+		captured = up.CapturedAt
+	} else {
+		var size int64
+		if fi, err := os.Stat(filePath); err == nil {
+			size = fi.Size()
+		}
+		if err := orgs.CheckQuota(db, ownerUserID, size, time.Now()); err != nil {
+			sim.Action, sim.Reason = simFail, err.Error()
+			return sim
+		}
+		sim.CreateUpload = true
+		prefs := models.DefaultPreferences(ownerUserID)
+		db.Where("user_id = ?", ownerUserID).First(&prefs)
+		if t, ok := exifmeta.CaptureTimeFile(filePath, prefs.Location(), time.Now()); ok {
+			captured = &t
+		}
+	}
+
+	quality, _ := ocr.AssessFile(filePath)
+	if quality != nil && quality.Reject() {
+		sim.Action, sim.Reason = simFail, quality.FailureReason()
+		return sim
+	}
+	var institution string
+	var printedDate *time.Time
+	// a QRIS payment code carrying the amount is read instead of running OCR
+	if qr, _ := ocrEngine.QRIS(filePath); qr != nil && qr.Amount > 0 {
+		res := qr.Result()
+		conf := res.Confidence
+		sim.Amount, sim.Raw, sim.Confidence = res.Amount, res.Raw, &conf
+	} else {
+		matches, isLikelyNonAmount, err := ocrEngine.FindAllMatches(filePath)
+		if err != nil {
+			sim.Reason = "ocr error: " + err.Error()
+			return sim
+		}
+		if len(matches) == 0 {
+			sim.Action, sim.Reason = simFail, quality.FailureReason()
+			if isLikelyNonAmount {
+				sim.Reason = "File tidak dikenali, gunakan file lain!"
+			}
+			return sim
+		}
+		if amt, raw := chooseBestAmount(matches); amt > 0 {
+			sim.Amount, sim.Raw = amt, raw
+		} else {
+			res, err := ocrEngine.Extract(filePath)
+			if err != nil || res.Amount <= 0 {
+				sim.Action, sim.Reason = simFail, quality.FailureReason()
+				return sim
+			}
+			featureFlags.GateOCR(db, ownerUserID, res)
+			conf := res.Confidence
+			sim.Amount, sim.Raw, sim.Confidence, institution, printedDate = res.Amount, res.Raw, &conf, res.Institution, res.Date
+			sim.Tax = res.Tax
+		}
+	}
+
+	txDate, dateSource := catatanstore.TransactionDate(printedDate, captured, time.Now())
+	sim.Date, sim.DateSource = &txDate, dateSource
+	if err := periodlock.Check(db, ownerUserID, txDate); err != nil {
+		sim.Action, sim.Reason = simHold, err.Error()
+		return sim
+	}
+	sim.AccountID = accounts.Match(db, ownerUserID, institution)
+	v := anomaly.Evaluate(db, ownerUserID, sim.Amount)
+	sim.Suspect, sim.SuspectReason = v.Suspect, v.Reason
+	// catatanstore.Create links to an existing catatan of the same name or image
+	q := db.Where("user_id = ? AND file_name = ?", ownerUserID, fileName)
+	if h := catatanstore.HashFile(filePath); h != nil {
+		q = db.Where("user_id = ? AND (file_name = ? OR content_hash = ?)", ownerUserID, fileName, *h)
+	}
+	var existing models.CatatanKeuangan
+	if q.Order("id").First(&existing).Error == nil {
+		sim.Action, sim.CatatanID = simLink, existing.ID
+		return sim
+	}
+	sim.Action = simCreate
+	return sim
 }
 
+// fillUpload ensures ContentType and KeuanganID present (creates Catatan if OCR finds amount)
+// legacy fillUpload removed (logic integrated in processSingleFile with preload state)
+
 func isUniqueConstraintError(err error) bool {
 	if err == nil {
 		return false
@@ -639,9 +1244,13 @@ func isUniqueConstraintError(err error) bool {
 
 // moveToProcessed moves a file from public/keu to public/processed/<name>.
 // It attempts an atomic rename and falls back to copy+remove when necessary.
+// Files over the budget are re-encoded on the compressor pool, which may
+// change their format (see imgcompress) but not their name; with
+// KEEP_ORIGINALS on, the file as received is first copied to the originals
+// directory and recorded on its upload.
 func moveToProcessed(srcFullPath, name string) error {
-	const maxBytes = 1_000_000 // 1 MB budget
-	processedDir := filepath.Join("public", "processed")
+	maxBytes := compressOptions.MaxBytes
+	processedDir := storagepath.File(storagepath.Processed)
 	if err := os.MkdirAll(processedDir, 0o755); err != nil {
 		return err
 	}
@@ -651,53 +1260,37 @@ func moveToProcessed(srcFullPath, name string) error {
 	if err != nil {
 		return err
 	}
-	// Fast path: already small enough -> attempt rename/copy
+	// Fast path: already small enough -> strip EXIF (location, device) and attempt rename/copy
 	if fi.Size() <= maxBytes {
-		if err := os.Rename(srcFullPath, dst); err == nil {
-			return nil
+		if err := exifmeta.StripFile(srcFullPath); err != nil {
+			log.Printf("WARN stripping EXIF of %s: %v", name, err)
 		}
-		return copyRemove(srcFullPath, dst)
-	}
-	// Need compression / resizing
-	img, err := imaging.Open(srcFullPath)
-	if err != nil { // fallback to raw move if cannot decode
 		if err := os.Rename(srcFullPath, dst); err == nil {
 			return nil
 		}
 		return copyRemove(srcFullPath, dst)
 	}
-	// Estimate scale factor based on sqrt(max/current) (size roughly scales with area)
-	scale := math.Sqrt(float64(maxBytes) / float64(fi.Size()))
-	if scale > 0.95 { // still enforce some small reduction to help container formats
-		scale = 0.95
-	}
-	if scale < 0.1 { // avoid absurd downscale
-		scale = 0.1
-	}
-	if scale < 1 {
-		w := img.Bounds().Dx()
-		h := img.Bounds().Dy()
-		newW := int(math.Max(1, math.Round(float64(w)*scale)))
-		newH := int(math.Max(1, math.Round(float64(h)*scale)))
-		img = imaging.Resize(img, newW, newH, imaging.Lanczos)
+	if orig, err := uploadfiles.KeepOriginal(srcFullPath, name); err != nil {
+		log.Printf("WARN keeping original of %s: %v", name, err)
+	} else if orig != "" {
+		if err := uploadfiles.RecordOriginal(db, storagepath.Of(srcFullPath), orig); err != nil {
+			log.Printf("WARN recording original of %s: %v", name, err)
+		}
 	}
-	// Save to dst (overwrite if exists)
-	if err := imaging.Save(img, dst); err != nil {
-		// fallback to original move
+	res, err := compressor.CompressFile(srcFullPath, dst, compressOptions)
+	if err != nil { // fallback to raw move if it cannot be decoded or encoded
+		log.Printf("WARN compressing %s: %v; storing it as is", name, err)
 		if err := os.Rename(srcFullPath, dst); err == nil {
 			return nil
 		}
 		return copyRemove(srcFullPath, dst)
 	}
-	// Remove original after successful save
 	_ = os.Remove(srcFullPath)
-	// If still > maxBytes, try one more uniform 80% scale pass
-	if fi2, err2 := os.Stat(dst); err2 == nil && fi2.Size() > maxBytes {
-		img2, errOpen2 := imaging.Open(dst)
-		if errOpen2 == nil {
-			img2 = imaging.Resize(img2, int(float64(img2.Bounds().Dx())*0.8), 0, imaging.Lanczos)
-			_ = imaging.Save(img2, dst)
-		}
+	logV("compressed %s: %d -> %d bytes (%s q=%d %dx%d, %d passes)", name, fi.Size(), len(res.Data), res.Format, res.Quality, res.Width, res.Height, res.Passes)
+	// the name is kept so it still matches the upload and catatan rows, but
+	// the format may have changed
+	if err := db.Model(&models.Upload{}).Where("store_path = ?", storagepath.Of(srcFullPath)).Update("content_type", res.ContentType()).Error; err != nil {
+		log.Printf("WARN recording content type of %s: %v", name, err)
 	}
 	return nil
 }
@@ -724,10 +1317,33 @@ func copyRemove(src, dst string) error {
 	return nil
 }
 
+// notifyOCRFailed tells the owner that a receipt was not recognised; the API
+// server delivers it through the channels they opted into.
+// holdForReview keeps up without a catatan because its receipt is dated in a
+// closed period of userID (or the lock could not be checked), notes why on the
+// upload and tells the owner, as the API does.
+func holdForReview(up *models.Upload, userID uint, date time.Time, err error) {
+	prefs := models.DefaultPreferences(userID)
+	db.Where("user_id = ?", userID).First(&prefs)
+	period := date.In(prefs.Location()).Format("2006-01")
+	log.Printf("HOLD %s owner=%d dated in period %s: %v", up.FileName, userID, period, err)
+	up.FailedReason = periodlock.ReviewReason(period)
+	_ = db.Save(up).Error
+	if _, err := notify.Notify(db, userID, notify.KindPeriodLocked, map[string]any{"FileName": up.FileName, "Period": period}); err != nil {
+		log.Printf("WARN notify %s owner=%d: %v", up.FileName, userID, err)
+	}
+}
+
+func notifyOCRFailed(userID uint, name string) {
+	if _, err := notify.Notify(db, userID, notify.KindOCRFailed, map[string]any{"FileName": name}); err != nil {
+		log.Printf("WARN notify %s owner=%d: %v", name, userID, err)
+	}
+}
+
 // moveToFailed moves a file to public/failed preserving the original filename.
 // It behaves similarly to moveToProcessed but without image re-encoding.
 func moveToFailed(srcFullPath, name string) error {
-	failedDir := filepath.Join("public", "failed")
+	failedDir := storagepath.File(storagepath.Failed)
 	if err := os.MkdirAll(failedDir, 0o755); err != nil {
 		return err
 	}
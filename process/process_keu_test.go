@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/fixtures"
+	"be03/pkg/ocr"
+	"be03/pkg/ocr/ocrtest"
+	"be03/pkg/ocrtext"
+	"be03/pkg/periodlock"
+	"be03/pkg/testenv"
+)
+
+// setupWatcher points the watcher at an in-memory database seeded with the given
+// fixtures, a scripted OCR engine and an empty public/keu in a temp working dir.
+func setupWatcher(t *testing.T, files []string, sets ...*fixtures.Set) (string, *ocrtest.Engine) {
+	t.Helper()
+	testenv.Chdir(t)
+	prevDB, prevEngine := db, ocrEngine
+	db = testenv.OpenDB(t, sets...)
+	fake := ocrtest.New()
+	ocrEngine = fake
+	t.Cleanup(func() { db, ocrEngine = prevDB, prevEngine })
+	dir := filepath.Join("public", "keu")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), testenv.JPEG, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, fake
+}
+
+func demoSet(uploads ...string) *fixtures.Set {
+	set := &fixtures.Set{Users: []fixtures.User{{Username: "demo", Password: "demo1234", Role: "user"}}}
+	for _, u := range uploads {
+		set.Uploads = append(set.Uploads, fixtures.Upload{User: "demo", FileName: u, ContentType: "image/jpeg"})
+	}
+	return set
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestWatcherCreatesCatatanForUploadOwner(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"r1.jpg"}, demoSet("r1.jpg"))
+	fake.Amount("r1.jpg", 50000, "Rp 50.000")
+
+	ps := preloadAll(dir, nil)
+	processSingleFile(dir, "r1.jpg", nil, ps)
+
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	var ct models.CatatanKeuangan
+	if err := db.Where("user_id = ? AND file_name = ?", demo.ID, "r1.jpg").First(&ct).Error; err != nil {
+		t.Fatalf("catatan not created for upload owner: %v", err)
+	}
+	if ct.Amount != 50000 {
+		t.Fatalf("amount = %d, want 50000", ct.Amount)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "r1.jpg").First(&up)
+	if up.KeuanganID == nil || *up.KeuanganID != ct.ID {
+		t.Fatalf("upload not linked: %+v", up)
+	}
+	if exists(filepath.Join(dir, "r1.jpg")) || !exists(filepath.Join("public", "processed", "r1.jpg")) {
+		t.Fatal("file was not moved to public/processed")
+	}
+
+	// a second pass over the same name is a no-op
+	processSingleFile(dir, "r1.jpg", nil, ps)
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 1 {
+		t.Fatalf("expected 1 catatan after re-run, got %d", n)
+	}
+}
+
+func TestWatcherNamespacedFiles(t *testing.T) {
+	set := demoSet()
+	set.Uploads = []fixtures.Upload{{User: "demo", FileName: "r1.jpg", StorePath: "public/keu/1_r1.jpg", ContentType: "image/jpeg"}}
+	dir, fake := setupWatcher(t, []string{"1_r1.jpg"}, set)
+	fake.Amount("r1.jpg", 50000, "Rp 50.000")
+
+	processSingleFile(dir, "1_r1.jpg", nil, preloadAll(dir, nil))
+
+	var ct models.CatatanKeuangan
+	if err := db.Where("file_name = ?", "r1.jpg").First(&ct).Error; err != nil {
+		t.Fatalf("catatan not created under the uploaded name: %v", err)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "r1.jpg").First(&up)
+	if up.KeuanganID == nil || *up.KeuanganID != ct.ID {
+		t.Fatalf("upload not linked: %+v", up)
+	}
+	if !exists(filepath.Join("public", "processed", "1_r1.jpg")) {
+		t.Fatal("file was not moved under its stored name")
+	}
+}
+
+func TestWatcherReadsQRIS(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"dyn.jpg", "static.jpg"}, demoSet("dyn.jpg", "static.jpg"))
+	// the code's amount wins over what OCR would read
+	fake.Set("dyn.jpg", ocrtest.Script{
+		QRIS:   &ocr.QRIS{Dynamic: true, Amount: 125000, Merchant: "KOPI KENANGAN", Reference: "RRN 628100734512"},
+		Result: &ocr.Result{Amount: 9000, Raw: "Rp 9.000"},
+	})
+	// a static code names the merchant only
+	fake.Set("static.jpg", ocrtest.Script{
+		QRIS:   &ocr.QRIS{Merchant: "TOKO A"},
+		Result: &ocr.Result{Amount: 20000, Raw: "Rp 20.000"},
+	})
+	// another image, not a duplicate of dyn.jpg
+	if err := os.WriteFile(filepath.Join(dir, "static.jpg"), append(append([]byte{}, testenv.JPEG...), 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := preloadAll(dir, nil)
+	processSingleFile(dir, "dyn.jpg", nil, ps)
+	processSingleFile(dir, "static.jpg", nil, ps)
+
+	got := map[string]models.CatatanKeuangan{}
+	var cats []models.CatatanKeuangan
+	db.Find(&cats)
+	for _, c := range cats {
+		got[c.FileName] = c
+	}
+	if c := got["dyn.jpg"]; c.Amount != 125000 || c.Merchant != "KOPI KENANGAN" || c.Pending || c.Reference == nil || *c.Reference != "RRN628100734512" {
+		t.Fatalf("dynamic code: %+v", c)
+	}
+	if c := got["static.jpg"]; c.Amount != 20000 || c.Merchant != "TOKO A" {
+		t.Fatalf("static code: %+v", c)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "dyn.jpg").First(&up)
+	if up.OCRHeuristic != ocr.HeuristicQRIS || up.OCRConfidence == nil || *up.OCRConfidence != ocr.QRISConfidence {
+		t.Fatalf("upload %+v", up)
+	}
+}
+
+func TestWatcherMarksUploadFailedWithoutAmount(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"logo.jpg"}, demoSet("logo.jpg"))
+	fake.Set("logo.jpg", ocrtest.Script{NonAmount: true})
+
+	processSingleFile(dir, "logo.jpg", nil, preloadAll(dir, nil))
+
+	var up models.Upload
+	db.Where("file_name = ?", "logo.jpg").First(&up)
+	if !up.Failed || up.FailedReason == "" || up.KeuanganID != nil {
+		t.Fatalf("expected failed upload, got %+v", up)
+	}
+	if !exists(filepath.Join("public", "failed", "logo.jpg")) {
+		t.Fatal("file was not moved to public/failed")
+	}
+}
+
+func TestWatcherHoldsReceiptsOfClosedPeriods(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"r1.jpg"}, demoSet("r1.jpg"))
+	fake.Amount("r1.jpg", 50000, "Rp 50.000")
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	// without a printed or capture date the receipt is dated now
+	if _, _, err := periodlock.Close(db, demo.ID, time.Now().UTC().Format("2006-01"), time.UTC, demo.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	processSingleFile(dir, "r1.jpg", nil, preloadAll(dir, nil))
+
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("%d catatan written into a closed period", n)
+	}
+	var up models.Upload
+	db.Where("file_name = ?", "r1.jpg").First(&up)
+	if up.KeuanganID != nil || up.Failed || up.FailedReason == "" {
+		t.Fatalf("upload not held for review: %+v", up)
+	}
+	if !exists(filepath.Join("public", "processed", "r1.jpg")) {
+		t.Fatal("held file stays in public/keu and would be read again")
+	}
+	db.Model(&models.Notification{}).Where("user_id = ? AND kind = ?", demo.ID, "period_locked").Count(&n)
+	if n != 1 {
+		t.Fatalf("%d period_locked notifications", n)
+	}
+}
+
+func TestWatcherSkipsFilesWithoutOwner(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"orphan.jpg"}, demoSet())
+	fake.Amount("orphan.jpg", 75000, "Rp 75.000")
+
+	processSingleFile(dir, "orphan.jpg", nil, preloadAll(dir, nil))
+
+	var n int64
+	db.Model(&models.CatatanKeuangan{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("expected no catatan without an owner, got %d", n)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("OCR should not run for unattributable files, calls=%v", fake.Calls())
+	}
+	if !exists(filepath.Join(dir, "orphan.jpg")) {
+		t.Fatal("orphan file should stay in place")
+	}
+}
+
+func TestWatcherUsesDefaultProfileForNewFiles(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"drop.jpg"}, demoSet())
+	fake.Set("drop.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 20000, Raw: "20.000"}})
+
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	var prof models.Profile
+	db.Where("user_id = ?", demo.ID).First(&prof)
+
+	processSingleFile(dir, "drop.jpg", &prof, preloadAll(dir, &prof))
+
+	var up models.Upload
+	if err := db.Where("file_name = ?", "drop.jpg").First(&up).Error; err != nil {
+		t.Fatalf("upload not created under default profile: %v", err)
+	}
+	if up.ProfileID != prof.ID || up.KeuanganID == nil {
+		t.Fatalf("unexpected upload %+v", up)
+	}
+}
+
+func TestWatcherEnforcesOrgQuota(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"drop.jpg"}, demoSet())
+	fake.Set("drop.jpg", ocrtest.Script{Result: &ocr.Result{Amount: 20000, Raw: "20.000"}})
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	var prof models.Profile
+	db.Where("user_id = ?", demo.ID).First(&prof)
+	org := models.Organization{Name: "Toko", StorageQuotaBytes: 10}
+	db.Create(&org)
+	db.Create(&models.OrgMembership{OrgID: org.ID, UserID: demo.ID, Role: "owner"})
+
+	processSingleFile(dir, "drop.jpg", &prof, preloadAll(dir, &prof))
+
+	var n int64
+	db.Model(&models.Upload{}).Where("file_name = ?", "drop.jpg").Count(&n)
+	if n != 0 || !exists(filepath.Join("public", "failed", "drop.jpg")) {
+		t.Fatalf("over-quota file: uploads=%d, moved to failed=%v", n, exists(filepath.Join("public", "failed", "drop.jpg")))
+	}
+}
+
+func TestWatcherKeepsOriginalOfCompressedReceipts(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"r1.jpg"}, demoSet("big.jpg", "r1.jpg"))
+	t.Setenv("KEEP_ORIGINALS", "on")
+	fake.Amount("big.jpg", 75000, "Rp 75.000")
+	fake.Amount("r1.jpg", 50000, "Rp 50.000")
+	// noise does not compress: well over the 1 MB budget
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 1200))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() <= 1_000_000 {
+		t.Fatalf("fixture is only %d bytes", buf.Len())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.jpg"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	processSingleFile(dir, "big.jpg", nil, preloadAll(dir, nil))
+
+	var up models.Upload
+	db.Where("file_name = ?", "big.jpg").First(&up)
+	if up.OriginalPath != "public/originals/big.jpg" || up.OriginalSizeBytes != int64(buf.Len()) {
+		t.Fatalf("original not recorded: path=%q size=%d", up.OriginalPath, up.OriginalSizeBytes)
+	}
+	if orig, err := os.ReadFile(up.OriginalPath); err != nil || !bytes.Equal(orig, buf.Bytes()) {
+		t.Fatalf("original not kept as received: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join("public", "processed", "big.jpg"))
+	if err != nil || fi.Size() >= int64(buf.Len()) {
+		t.Fatalf("processed copy not compressed: %v", err)
+	}
+
+	// small receipts are moved as they are and keep no original
+	processSingleFile(dir, "r1.jpg", nil, preloadAll(dir, nil))
+	var small models.Upload
+	db.Where("file_name = ?", "r1.jpg").First(&small)
+	if !exists(filepath.Join("public", "processed", "r1.jpg")) || small.OriginalPath != "" || exists(filepath.Join("public", "originals", "r1.jpg")) {
+		t.Fatalf("small receipt kept an original: %q", small.OriginalPath)
+	}
+}
+
+func TestSimulationWritesNothing(t *testing.T) {
+	dir, fake := setupWatcher(t, []string{"r1.jpg", "logo.jpg", "orphan.jpg", "done.jpg"}, demoSet("r1.jpg", "logo.jpg", "done.jpg"))
+	fake.Amount("r1.jpg", 50000, "Rp 50.000")
+	fake.Set("logo.jpg", ocrtest.Script{NonAmount: true})
+	fake.Amount("orphan.jpg", 75000, "Rp 75.000")
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	done := models.CatatanKeuangan{UserID: demo.ID, FileName: "done.jpg", Amount: 1000}
+	db.Create(&done)
+
+	var buf bytes.Buffer
+	rep := simulateAll(dir, nil, preloadAll(dir, nil), listImageFiles(dir), 2)
+	if err := writeSimulationReport(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	var got simulationReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	byFile := map[string]simulation{}
+	for _, f := range got.Files {
+		byFile[f.File] = f
+	}
+	if f := byFile["r1.jpg"]; f.Action != simCreate || f.Amount != 50000 || f.OwnerUserID != demo.ID || f.Date == nil {
+		t.Errorf("r1: %+v", f)
+	}
+	if f := byFile["logo.jpg"]; f.Action != simFail || f.Reason == "" {
+		t.Errorf("logo: %+v", f)
+	}
+	if f := byFile["orphan.jpg"]; f.Action != simSkip || f.CreateUpload {
+		t.Errorf("orphan: %+v", f)
+	}
+	if f := byFile["done.jpg"]; f.Action != simSkip || f.CatatanID != done.ID {
+		t.Errorf("done: %+v", f)
+	}
+	if got.Summary[simSkip] != 2 || got.Summary[simCreate] != 1 || got.Summary[simFail] != 1 {
+		t.Errorf("summary %v", got.Summary)
+	}
+
+	var cats, failed int64
+	db.Model(&models.CatatanKeuangan{}).Count(&cats)
+	db.Model(&models.Upload{}).Where("failed = ? OR processed_at IS NOT NULL", true).Count(&failed)
+	if cats != 1 || failed != 0 {
+		t.Fatalf("simulation wrote: catatan=%d touched uploads=%d", cats, failed)
+	}
+	for _, f := range []string{"r1.jpg", "logo.jpg", "orphan.jpg"} {
+		if !exists(filepath.Join(dir, f)) {
+			t.Fatalf("%s was moved", f)
+		}
+	}
+}
+
+func TestReadOnlyDSN(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"host=db user=be03 dbname=be03":           "host=db user=be03 dbname=be03 default_transaction_read_only=on",
+		"postgres://be03@db/be03":                 "postgres://be03@db/be03?default_transaction_read_only=on",
+		"postgres://be03@db/be03?sslmode=disable": "postgres://be03@db/be03?sslmode=disable&default_transaction_read_only=on",
+	} {
+		if got := readOnlyDSN(dsn); got != want {
+			t.Errorf("readOnlyDSN(%q) = %q", dsn, got)
+		}
+	}
+}
+
+func TestPreloadStateInFlight(t *testing.T) {
+	ps := newPreloadState()
+	if !ps.begin("a.jpg") {
+		t.Fatal("first begin should succeed")
+	}
+	if ps.begin("a.jpg") {
+		t.Fatal("second begin for the same file should be refused while in flight")
+	}
+	ps.end("a.jpg")
+	if !ps.begin("a.jpg") {
+		t.Fatal("begin should succeed again after end")
+	}
+}
+
+func TestWatcherBackfill(t *testing.T) {
+	set := demoSet("zero.jpg", "ok.jpg", "cached.jpg", "rescored.jpg", "locked.jpg")
+	set.Uploads = append(set.Uploads,
+		fixtures.Upload{User: "demo", FileName: "bad.jpg", ContentType: "image/jpeg", Failed: true, FailedReason: "File tidak dikenali, gunakan file lain!"},
+		fixtures.Upload{User: "demo", FileName: "blank.jpg", ContentType: "image/jpeg", Failed: true, FailedReason: "File tidak dikenali, gunakan file lain!"})
+	set.Catatan = []fixtures.Catatan{
+		{User: "demo", FileName: "zero.jpg", Amount: 0},
+		{User: "demo", FileName: "ok.jpg", Amount: 20000},
+		{User: "demo", FileName: "cached.jpg", Amount: 0},
+		{User: "demo", FileName: "rescored.jpg", Amount: 0},
+		{User: "demo", FileName: "locked.jpg", Amount: 0, Date: "2025-01-15T10:00:00+07:00"},
+	}
+	dir, fake := setupWatcher(t, nil, set)
+	for _, f := range []string{"processed/zero.jpg", "processed/ok.jpg", "processed/cached.jpg", "processed/rescored.jpg", "processed/locked.jpg", "failed/bad.jpg", "failed/blank.jpg"} {
+		path := filepath.Join("public", f)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, testenv.JPEG, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the stored OCR text is scored again instead of reading the image
+	for name, text := range map[string]string{"cached.jpg": "TOTAL Rp 0", "rescored.jpg": "Jumlah Transfer Rp 45.000", "blank.jpg": "TERIMA KASIH"} {
+		var up models.Upload
+		db.Where("file_name = ?", name).First(&up)
+		if err := ocrtext.Save(db, up.ID, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var demo models.User
+	db.Where("username = ?", "demo").First(&demo)
+	if _, _, err := periodlock.Close(db, demo.ID, "2025-01", time.Local, demo.ID); err != nil {
+		t.Fatal(err)
+	}
+	fake.Amount("zero.jpg", 50000, "Rp 50.000").Amount("cached.jpg", 70000, "Rp 70.000").Amount("bad.jpg", 30000, "Rp 30.000").
+		Amount("locked.jpg", 90000, "Rp 90.000")
+
+	// filters: nothing was uploaded tomorrow
+	f, err := parseBackfillFilter(time.Now().AddDate(0, 0, 1).Format("2006-01-02"), "", "demo", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := backfillCandidates(backfillProcessed, f); len(items) != 0 {
+		t.Fatalf("future --since matched %d files", len(items))
+	}
+
+	f, _ = parseBackfillFilter("", "", "demo", true, false)
+	if err := runBackfill(dir, backfillProcessed, f, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	amounts := map[string]int64{}
+	var cats []models.CatatanKeuangan
+	db.Find(&cats)
+	for _, c := range cats {
+		amounts[c.FileName] = c.Amount
+	}
+	if amounts["zero.jpg"] != 50000 || amounts["ok.jpg"] != 20000 || amounts["cached.jpg"] != 0 || amounts["rescored.jpg"] != 45000 || amounts["locked.jpg"] != 0 {
+		t.Fatalf("after processed backfill: %v", amounts)
+	}
+	for _, c := range fake.Calls() {
+		if filepath.Base(c) != "zero.jpg" {
+			t.Fatalf("OCR ran on %s; only zero.jpg matches, is not cached and is in an open period", c)
+		}
+	}
+
+	if err := runBackfill(dir, backfillFailed, f, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	var bad models.Upload
+	db.Where("file_name = ?", "bad.jpg").First(&bad)
+	if bad.Failed || bad.KeuanganID == nil {
+		t.Fatalf("failed upload not reprocessed: %+v", bad)
+	}
+	if exists(filepath.Join("public", "failed", "bad.jpg")) || !exists(filepath.Join("public", "processed", "bad.jpg")) {
+		t.Fatal("bad.jpg was not moved from public/failed to public/processed")
+	}
+	// its stored text still has no amount
+	if !exists(filepath.Join("public", "failed", "blank.jpg")) {
+		t.Fatal("blank.jpg was requeued")
+	}
+}
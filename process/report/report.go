@@ -1,18 +1,113 @@
+// Package report summarises catatan over a date range, for one user or all of
+// them, for operators and for scripts: as a table, or as JSON or CSV with the
+// totals per user, category and day. It reads catatan the way the HTTP reports
+// do (catatanarchive.Catatan), archived ones included.
 package report
 
 import (
-	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"be03/models"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/usernames"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// ExitEmpty is the exit status of a report that found no catatan, so scripts
+// can tell it from a failure (1) or a usage error (2).
+const ExitEmpty = 3
+
+// Query selects the catatan of a report.
+type Query struct {
+	// Username names the user (a former name works too); AllUsers reports
+	// every user instead, each in a section of their own.
+	Username string
+	AllUsers bool
+	// Month (YYYY-MM) or From and To (YYYY-MM-DD, both inclusive; either may
+	// be empty for an open end) bound the dates, in each user's timezone.
+	Month, From, To string
+	// Category and Account (an account name) keep only matching catatan;
+	// both ignore case.
+	Category, Account string
+	// List adds the catatan themselves.
+	List bool
+}
+
+// Bucket totals the catatan sharing a category or a day.
+type Bucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Total int64  `json:"total"`
+}
+
+// Row is one catatan, listed on request.
+type Row struct {
+	ID       uint   `json:"id"`
+	Date     string `json:"date"` // RFC 3339 in the user's timezone
+	FileName string `json:"file_name"`
+	Category string `json:"category"`
+	Amount   int64  `json:"amount"`
+	Pending  bool   `json:"pending"`
+	Split    bool   `json:"split"`
+}
+
+// Totals are the sums of a user or of the whole report. They leave out
+// pending catatan and receipts split into items (their items count instead),
+// as the API does; listed rows include them.
+type Totals struct {
+	Records    int64    `json:"records"`
+	Total      int64    `json:"total"`
+	Categories []Bucket `json:"categories"` // largest total first; "" is uncategorised
+	Days       []Bucket `json:"days"`       // YYYY-MM-DD, days without catatan left out
+}
+
+// Section is the part of a report about one user.
+type Section struct {
+	Username    string `json:"username"`
+	RenamedFrom string `json:"renamed_from,omitempty"`
+	Timezone    string `json:"timezone"`
+	Currency    string `json:"currency"`
+	Totals
+	Catatan []Row `json:"catatan,omitempty"`
+}
+
+// Report holds a section per user and the totals over all of them; with
+// several users in different currencies those sums mix them.
+type Report struct {
+	From     string `json:"from,omitempty"` // first day, inclusive
+	To       string `json:"to,omitempty"`   // last day, inclusive
+	Category string `json:"category,omitempty"`
+	Account  string `json:"account,omitempty"`
+	Totals
+	Users []Section `json:"users"`
+}
+
+// Empty reports whether no catatan matched.
+func (r Report) Empty() bool { return r.Records == 0 }
+
+// ValidFormat reports whether f is an output format.
+func ValidFormat(f string) bool {
+	return f == FormatTable || f == FormatJSON || f == FormatCSV
+}
+
 func mustDBFromEnv() *gorm.DB {
 	dsn := os.Getenv("DB_DSN")
 	if dsn == "" {
@@ -25,39 +120,291 @@ func mustDBFromEnv() *gorm.DB {
 	return gdb
 }
 
-// RunReport prints a month-bounded report for username (month in YYYY-MM) and
-// optionally lists matching catatan_keuangan rows.
-func RunReport(username, month string, list bool) {
-	gdb := mustDBFromEnv()
-
-	var user models.User
-	if err := gdb.Where("username = ?", username).First(&user).Error; err != nil {
-		log.Fatalf("user not found: %v", err)
+// dayRange is the date range of q as day strings: first day and last day,
+// inclusive, empty for an open end.
+func (q Query) dayRange() (from, to string, err error) {
+	if q.Month != "" {
+		if q.From != "" || q.To != "" {
+			return "", "", errors.New("use either a month or a from/to range")
+		}
+		t, err := time.Parse("2006-01", q.Month)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid month format, expected YYYY-MM: %w", err)
+		}
+		return t.Format("2006-01-02"), t.AddDate(0, 1, -1).Format("2006-01-02"), nil
 	}
+	for _, d := range []string{q.From, q.To} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return "", "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+	if q.From != "" && q.To != "" && q.To < q.From {
+		return "", "", errors.New("to is before from")
+	}
+	return q.From, q.To, nil
+}
 
-	t, err := time.Parse("2006-01", month)
+// Build computes the report q asks for.
+func Build(gdb *gorm.DB, q Query) (Report, error) {
+	from, to, err := q.dayRange()
 	if err != nil {
-		log.Fatalf("invalid month format, expected YYYY-MM: %v", err)
+		return Report{}, err
+	}
+	var users []models.User
+	switch {
+	case q.AllUsers:
+		if err := gdb.Where("deleted_at IS NULL").Order("username").Find(&users).Error; err != nil {
+			return Report{}, fmt.Errorf("query failed: %w", err)
+		}
+	case q.Username != "":
+		user, err := usernames.Resolve(gdb, q.Username)
+		if err != nil {
+			return Report{}, fmt.Errorf("user not found: %w", err)
+		}
+		users = append(users, user)
+	default:
+		return Report{}, errors.New("a username or all users is required")
+	}
+
+	r := Report{From: from, To: to, Category: q.Category, Account: q.Account, Totals: newTotals(), Users: []Section{}}
+	all := newIndex()
+	for _, u := range users {
+		s, err := section(gdb, q, u, from, to, all, &r.Totals)
+		if err != nil {
+			return r, err
+		}
+		if u.Username != q.Username && !q.AllUsers {
+			s.RenamedFrom = q.Username
+		}
+		// all-users reports leave out users without catatan in the range
+		if !q.AllUsers || s.Records > 0 || len(s.Catatan) > 0 {
+			r.Users = append(r.Users, s)
+		}
+	}
+	sortCategories(r.Categories)
+	sort.Slice(r.Days, func(i, j int) bool { return r.Days[i].Key < r.Days[j].Key })
+	return r, nil
+}
+
+// section totals user's catatan, adding them to the report's totals too.
+func section(gdb *gorm.DB, q Query, u models.User, from, to string, all *index, sum *Totals) (Section, error) {
+	prefs := models.DefaultPreferences(u.ID)
+	_ = gdb.Where("user_id = ?", u.ID).First(&prefs).Error
+	loc := prefs.Location()
+	s := Section{Username: u.Username, Timezone: loc.String(), Currency: prefs.Currency, Totals: newTotals()}
+
+	var start *time.Time
+	if from != "" {
+		t, _ := time.ParseInLocation("2006-01-02", from, loc)
+		start = &t
+	}
+	query := catatanarchive.Catatan(gdb, start).Where("user_id = ?", u.ID)
+	if start != nil {
+		query = query.Where("date >= ?", start.UTC())
+	}
+	if to != "" {
+		end, _ := time.ParseInLocation("2006-01-02", to, loc)
+		query = query.Where("date < ?", end.AddDate(0, 0, 1).UTC())
+	}
+	if q.Category != "" {
+		query = query.Where("LOWER(category) = LOWER(?)", q.Category)
+	}
+	if q.Account != "" {
+		query = query.Where("account_id IN (?)", gdb.Model(&models.Account{}).Select("id").
+			Where("user_id = ? AND LOWER(name) = LOWER(?)", u.ID, q.Account))
+	}
+	var rows []models.CatatanKeuangan
+	if err := query.Order("date, id").Find(&rows).Error; err != nil {
+		return s, fmt.Errorf("query failed: %w", err)
+	}
+	own := newIndex()
+	for _, c := range rows {
+		if q.List {
+			s.Catatan = append(s.Catatan, Row{ID: c.ID, Date: c.Date.In(loc).Format(time.RFC3339), FileName: c.FileName, Category: c.Category, Amount: c.Amount, Pending: c.Pending, Split: c.Split})
+		}
+		if c.Pending || c.Split {
+			continue
+		}
+		day := c.Date.In(loc).Format("2006-01-02")
+		own.add(&s.Totals, c.Category, day, c.Amount)
+		all.add(sum, c.Category, day, c.Amount)
+	}
+	sortCategories(s.Categories)
+	return s, nil
+}
+
+func newTotals() Totals { return Totals{Categories: []Bucket{}, Days: []Bucket{}} }
+
+// index locates the buckets of a Totals by key.
+type index struct{ cats, days map[string]int }
+
+func newIndex() *index { return &index{cats: map[string]int{}, days: map[string]int{}} }
+
+func (x *index) add(t *Totals, category, day string, amount int64) {
+	t.Records++
+	t.Total += amount
+	for _, b := range []struct {
+		pos  map[string]int
+		list *[]Bucket
+		key  string
+	}{{x.cats, &t.Categories, category}, {x.days, &t.Days, day}} {
+		i, ok := b.pos[b.key]
+		if !ok {
+			i = len(*b.list)
+			b.pos[b.key] = i
+			*b.list = append(*b.list, Bucket{Key: b.key})
+		}
+		(*b.list)[i].Count++
+		(*b.list)[i].Total += amount
+	}
+}
+
+func sortCategories(cats []Bucket) {
+	sort.SliceStable(cats, func(i, j int) bool {
+		a, b := cats[i], cats[j]
+		return a.Total > b.Total || a.Total == b.Total && a.Key < b.Key
+	})
+}
+
+// Write prints r in format. CSV has the columns user,kind,key,count,total:
+// per user a "total" line then the "category" and "day" lines, and for
+// several users the same for all of them under the user "*". With listed
+// rows it is those rows instead.
+func Write(w io.Writer, r Report, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatCSV:
+		return writeCSV(w, r)
+	case FormatTable:
+		return writeTable(w, r)
 	}
-	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
-	end := start.AddDate(0, 1, 0)
+	return fmt.Errorf("unknown format %q (want table, json or csv)", format)
+}
 
-	var total sql.NullFloat64
-	var cnt int64
-	if err := gdb.Raw(`SELECT COALESCE(SUM(amount),0) AS total, COUNT(*) AS cnt FROM catatan_keuangans WHERE user_id = ? AND date >= ? AND date < ?`, user.ID, start, end).Row().Scan(&total, &cnt); err != nil {
-		log.Fatalf("query failed: %v", err)
+// span describes the report's date range.
+func (r Report) span() string {
+	switch {
+	case r.From == "" && r.To == "":
+		return "all dates"
+	case r.To == "":
+		return "from " + r.From
+	case r.From == "":
+		return "until " + r.To
 	}
+	return r.From + " to " + r.To
+}
 
-	fmt.Printf("Report for user=%s month=%s (UTC):\n", user.Username, month)
-	fmt.Printf("  records=%d total_amount=%.2f\n", cnt, total.Float64)
+func listed(r Report) bool {
+	for _, s := range r.Users {
+		if s.Catatan != nil {
+			return true
+		}
+	}
+	return false
+}
 
-	if list {
-		var rows []models.CatatanKeuangan
-		if err := gdb.Where("user_id = ? AND date >= ? AND date < ?", user.ID, start, end).Order("id").Find(&rows).Error; err != nil {
-			log.Fatalf("fetch rows failed: %v", err)
+func writeCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+	if listed(r) {
+		cw.Write([]string{"user", "id", "date", "file_name", "category", "amount", "pending", "split"})
+		for _, s := range r.Users {
+			for _, c := range s.Catatan {
+				cw.Write([]string{s.Username, strconv.FormatUint(uint64(c.ID), 10), c.Date, c.FileName, c.Category, itoa(c.Amount), strconv.FormatBool(c.Pending), strconv.FormatBool(c.Split)})
+			}
 		}
-		for _, r := range rows {
-			fmt.Printf("%d|%s|%d|%s|%s\n", r.ID, r.FileName, r.Amount, r.Date.Format(time.RFC3339), r.CreatedAt.Format(time.RFC3339))
+		cw.Flush()
+		return cw.Error()
+	}
+	cw.Write([]string{"user", "kind", "key", "count", "total"})
+	totals := func(user string, t Totals) {
+		cw.Write([]string{user, "total", r.span(), itoa(t.Records), itoa(t.Total)})
+		for _, b := range t.Categories {
+			cw.Write([]string{user, "category", b.Key, itoa(b.Count), itoa(b.Total)})
 		}
+		for _, b := range t.Days {
+			cw.Write([]string{user, "day", b.Key, itoa(b.Count), itoa(b.Total)})
+		}
+	}
+	for _, s := range r.Users {
+		totals(s.Username, s.Totals)
+	}
+	if len(r.Users) > 1 {
+		totals("*", r.Totals)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTable(w io.Writer, r Report) error {
+	filter := ""
+	if r.Category != "" {
+		filter += " category=" + r.Category
+	}
+	if r.Account != "" {
+		filter += " account=" + r.Account
+	}
+	totals := func(t Totals, currency string) {
+		fmt.Fprintf(w, "  records=%d total_amount=%d %s\n", t.Records, t.Total, currency)
+		if len(t.Categories) == 0 {
+			return
+		}
+		fmt.Fprintln(w, "  By category:")
+		for _, b := range t.Categories {
+			key := b.Key
+			if key == "" {
+				key = "(none)"
+			}
+			fmt.Fprintf(w, "    %-24s %5d %14d\n", key, b.Count, b.Total)
+		}
+		fmt.Fprintln(w, "  By day:")
+		for _, b := range t.Days {
+			fmt.Fprintf(w, "    %-24s %5d %14d\n", b.Key, b.Count, b.Total)
+		}
+	}
+	for _, s := range r.Users {
+		if s.RenamedFrom != "" {
+			fmt.Fprintf(w, "%s was renamed to %s\n", s.RenamedFrom, s.Username)
+		}
+		fmt.Fprintf(w, "Report for user=%s %s (%s)%s:\n", s.Username, r.span(), s.Timezone, filter)
+		totals(s.Totals, s.Currency)
+		for _, c := range s.Catatan {
+			fmt.Fprintf(w, "  %d|%s|%d|%s|%s\n", c.ID, c.FileName, c.Amount, c.Date, c.Category)
+		}
+	}
+	if len(r.Users) != 1 {
+		fmt.Fprintf(w, "All %d users %s%s:\n", len(r.Users), r.span(), filter)
+		totals(r.Totals, "")
+	}
+	return nil
+}
+
+// RunReport prints the report q asks for in format to stdout and returns the
+// process exit status: 0, ExitEmpty when no catatan matched, 1 on failure
+// and 2 for an invalid query or format.
+func RunReport(q Query, format string) int {
+	if !ValidFormat(format) {
+		fmt.Fprintf(os.Stderr, "unknown format %q (want table, json or csv)\n", format)
+		return 2
+	}
+	if _, _, err := q.dayRange(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	r, err := Build(mustDBFromEnv(), q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := Write(os.Stdout, r, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if r.Empty() {
+		return ExitEmpty
 	}
+	return 0
 }
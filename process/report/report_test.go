@@ -0,0 +1,141 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"be03/models"
+	"be03/pkg/catatanarchive"
+	"be03/pkg/testenv"
+
+	"gorm.io/gorm"
+)
+
+func seed(t *testing.T) *gorm.DB {
+	t.Helper()
+	gdb := testenv.OpenDB(t)
+	jkt, _ := time.LoadLocation("Asia/Jakarta")
+	day := func(m time.Month, d, h int) time.Time { return time.Date(2025, m, d, h, 0, 0, 0, jkt) }
+	siti := models.User{Username: "siti", HashedPassword: []byte("x")}
+	budi := models.User{Username: "budi", HashedPassword: []byte("x")}
+	gdb.Create(&siti)
+	gdb.Create(&budi)
+	bca := models.Account{UserID: siti.ID, Name: "BCA", Type: models.AccountBank}
+	gdb.Create(&bca)
+	for _, c := range []models.CatatanKeuangan{
+		{UserID: siti.ID, FileName: "a.jpg", Amount: 20000, Date: day(8, 1, 9), Category: "food"},
+		{UserID: siti.ID, FileName: "b.jpg", Amount: 50000, Date: day(8, 1, 23), Category: "transport", AccountID: &bca.ID},
+		{UserID: siti.ID, FileName: "c.jpg", Amount: 15000, Date: day(8, 3, 12), Category: "Food"},
+		{UserID: siti.ID, FileName: "d.jpg", Amount: 99000, Date: day(8, 4, 8), Pending: true},
+		{UserID: siti.ID, FileName: "e.jpg", Amount: 7000, Date: day(8, 31, 23).Add(2 * time.Hour)}, // September in Jakarta
+		{UserID: budi.ID, FileName: "f.jpg", Amount: 30000, Date: day(8, 3, 10), Category: "food"},
+		{UserID: budi.ID, FileName: "old.jpg", Amount: 1000, Date: time.Date(2020, 1, 5, 0, 0, 0, 0, jkt), Category: "food"},
+	} {
+		gdb.Create(&c)
+	}
+	// the oldest catatan is archived; reports still see it
+	if _, err := catatanarchive.Run(gdb, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 0); err != nil {
+		t.Fatal(err)
+	}
+	return gdb
+}
+
+func TestMonthReport(t *testing.T) {
+	gdb := seed(t)
+	r, err := Build(gdb, Query{Username: "siti", Month: "2025-08"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Records != 3 || r.Total != 85000 || r.Empty() || len(r.Users) != 1 || r.Users[0].Total != 85000 {
+		t.Fatalf("totals: %+v", r)
+	}
+	if c := r.Categories; len(c) != 3 || c[0] != (Bucket{"transport", 1, 50000}) {
+		t.Fatalf("categories: %+v", c)
+	}
+	if d := r.Days; len(d) != 2 || d[0] != (Bucket{"2025-08-01", 2, 70000}) || d[1] != (Bucket{"2025-08-03", 1, 15000}) {
+		t.Fatalf("days: %+v", d)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, r, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(buf.String(), "\n"); lines[0] != "user,kind,key,count,total" || lines[1] != "siti,total,2025-08-01 to 2025-08-31,3,85000" {
+		t.Fatalf("csv:\n%s", buf.String())
+	}
+	buf.Reset()
+	Write(&buf, r, FormatJSON)
+	var decoded struct {
+		Records int64
+		Users   []struct {
+			Username string
+			Timezone string
+			Total    int64
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Records != 3 || decoded.Users[0].Timezone != "Asia/Jakarta" || decoded.Users[0].Total != 85000 {
+		t.Fatalf("json: %v %s", err, buf.String())
+	}
+	if err := Write(&buf, r, "xml"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+
+	// listed rows include pending catatan
+	r, _ = Build(gdb, Query{Username: "siti", Month: "2025-08", List: true})
+	buf.Reset()
+	Write(&buf, r, FormatCSV)
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 5 || !strings.HasSuffix(lines[4], ",99000,true,false") || !strings.HasPrefix(lines[4], "siti,") {
+		t.Fatalf("listed csv:\n%s", buf.String())
+	}
+
+	if r, err := Build(gdb, Query{Username: "siti", Month: "2025-07"}); err != nil || !r.Empty() {
+		t.Fatalf("empty month: %+v %v", r, err)
+	}
+	if _, err := Build(gdb, Query{Username: "nobody", Month: "2025-08"}); err == nil {
+		t.Fatal("unknown user accepted")
+	}
+}
+
+func TestRangeUsersAndFilters(t *testing.T) {
+	gdb := seed(t)
+	r, err := Build(gdb, Query{AllUsers: true, From: "2025-08-01", To: "2025-09-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// admin has no catatan and gets no section
+	if len(r.Users) != 2 || r.Users[0].Username != "budi" || r.Users[0].Total != 30000 || r.Users[1].Total != 92000 || r.Total != 122000 {
+		t.Fatalf("all users: %+v", r.Users)
+	}
+	if d := r.Days; len(d) != 3 || d[1] != (Bucket{"2025-08-03", 2, 45000}) || d[2].Key != "2025-09-01" {
+		t.Fatalf("days: %+v", d)
+	}
+	var buf bytes.Buffer
+	Write(&buf, r, FormatCSV)
+	if !strings.Contains(buf.String(), "\n*,total,2025-08-01 to 2025-09-01,5,122000\n") {
+		t.Fatalf("csv without overall totals:\n%s", buf.String())
+	}
+
+	// archived catatan count, as in the API reports
+	if r, _ := Build(gdb, Query{Username: "budi", To: "2020-12-31"}); r.Total != 1000 {
+		t.Fatalf("archived: %+v", r)
+	}
+	if r, _ := Build(gdb, Query{AllUsers: true, Month: "2025-08", Category: "FOOD"}); r.Records != 3 || r.Total != 65000 {
+		t.Fatalf("category filter: %+v", r.Totals)
+	}
+	if r, _ := Build(gdb, Query{Username: "siti", Account: "bca"}); r.Records != 1 || r.Total != 50000 {
+		t.Fatalf("account filter: %+v", r.Totals)
+	}
+	for _, q := range []Query{
+		{Username: "siti", Month: "2025-08", From: "2025-08-01"},
+		{Username: "siti", From: "2025-08-10", To: "2025-08-01"},
+		{Username: "siti", From: "10/08/2025"},
+		{Month: "2025-08"},
+	} {
+		if _, err := Build(gdb, q); err == nil {
+			t.Errorf("%+v accepted", q)
+		}
+	}
+}
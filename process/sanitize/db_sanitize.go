@@ -10,9 +10,8 @@ import (
 	"strings"
 	"time"
 
-	"be03/models"
+	"be03/pkg/fixtures"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -104,29 +103,11 @@ func Run() {
 }
 
 func reseedRolesAndAdmin(gdb *gorm.DB) error {
-	roles := []models.Role{{Name: "administrator", Description: "full access"}, {Name: "user", Description: "regular user"}}
-	for _, r := range roles {
-		if err := gdb.Where("name = ?", r.Name).FirstOrCreate(&r).Error; err != nil {
-			return fmt.Errorf("failed to ensure role %s: %w", r.Name, err)
-		}
-	}
-	var role models.Role
-	if err := gdb.Where("name = ?", "administrator").First(&role).Error; err != nil {
-		return fmt.Errorf("failed to find administrator role: %w", err)
-	}
-	rid := role.ID
-	hashed, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
+	st, err := fixtures.Apply(gdb, fixtures.Default())
 	if err != nil {
-		return fmt.Errorf("failed to hash admin password: %w", err)
-	}
-	admin := models.User{Username: "admin", HashedPassword: hashed, RoleID: &rid}
-	if err := gdb.Create(&admin).Error; err != nil {
-		return fmt.Errorf("failed to create admin user: %w", err)
-	}
-	profile := models.Profile{UserID: admin.ID, Name: "Administrator", Email: "admin@example.com"}
-	if err := gdb.Create(&profile).Error; err != nil {
-		return fmt.Errorf("failed to create admin profile: %w", err)
+		return fmt.Errorf("failed to apply default fixtures: %w", err)
 	}
+	log.Printf("reseed: %s", st)
 	return nil
 }
 
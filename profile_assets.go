@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/uploadfiles"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- profile assets --------------------
+
+// profileAsset describes one image a profile can carry.
+type profileAsset struct {
+	column string // Profile column holding the file name
+	// avatars are cropped to a square; logos keep their aspect ratio
+	square        bool
+	width, height int
+}
+
+var profileAssets = map[string]profileAsset{
+	"avatar": {column: "avatar_file", square: true, width: 256, height: 256},
+	"logo":   {column: "logo_file", width: 600, height: 300},
+}
+
+// profileAssetName matches the names handed out by putProfileAssetHandler, so
+// nothing else in the directory can be served.
+var profileAssetName = regexp.MustCompile(`^\d+-(avatar|logo)-[0-9a-f]{16}\.(jpg|png)$`)
+
+// profileAssetURL is the public URL of an asset file, absolute when
+// PUBLIC_BASE_URL is set; "" when there is none.
+func profileAssetURL(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/") + apiPrefix + "/profile-assets/" + name
+}
+
+// profileView is a profile as returned by the API, with its images as URLs.
+type profileView struct {
+	models.Profile
+	AvatarURL string `json:"avatar_url,omitempty"`
+	LogoURL   string `json:"logo_url,omitempty"`
+}
+
+func newProfileView(p models.Profile) profileView {
+	return profileView{Profile: p, AvatarURL: profileAssetURL(p.AvatarFile), LogoURL: profileAssetURL(p.LogoFile)}
+}
+
+// resizeProfileAsset decodes an uploaded image (already sniffed as JPEG or
+// PNG), scales it down to the asset's bounds and re-encodes it. PNG logos stay
+// PNG to keep their transparency; everything else becomes JPEG, which also
+// drops the EXIF block.
+func resizeProfileAsset(a profileAsset, mime string, b []byte) ([]byte, string, error) {
+	img, err := imaging.Decode(bytes.NewReader(b), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, "", err
+	}
+	var out image.Image
+	if a.square {
+		out = imaging.Fill(img, a.width, a.height, imaging.Center, imaging.Lanczos)
+	} else {
+		out = imaging.Fit(img, a.width, a.height, imaging.Lanczos)
+	}
+	var buf bytes.Buffer
+	if mime == "image/png" && !a.square {
+		err = imaging.Encode(&buf, out, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+		return buf.Bytes(), "png", err
+	}
+	err = imaging.Encode(&buf, out, imaging.JPEG, imaging.JPEGQuality(85))
+	return buf.Bytes(), "jpg", err
+}
+
+// putProfileAssetHandler stores the caller's avatar or business logo from the
+// multipart "file" field, with the same size and type checks as receipts. The
+// image is resized and saved under a fresh unguessable name; the previous one
+// is removed. It returns the updated profile.
+func putProfileAssetHandler(c *gin.Context) {
+	kind := c.Param("kind")
+	asset, ok := profileAssets[kind]
+	if !ok {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var p models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&p).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		writeError(c, apierr.MissingFile, "file missing", nil)
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		writeError(c, apierr.OpenFailed, "", nil)
+		return
+	}
+	mime, b, verr := func() (string, []byte, error) { defer src.Close(); return validateAndSniff(src, file) }()
+	if verr != nil {
+		switch verr.Error() {
+		case "too_large":
+			writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
+		case "unsupported_type":
+			writeError(c, apierr.UnsupportedType, "", gin.H{"allowed": uploadfiles.APITypes.List()})
+		default:
+			writeError(c, apierr.InvalidFile, "", nil)
+		}
+		return
+	}
+	out, ext, err := resizeProfileAsset(asset, mime, b)
+	if err != nil {
+		writeError(c, apierr.InvalidFile, "image could not be decoded", nil)
+		return
+	}
+	dir := uploadfiles.ProfileAssetsDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		writeError(c, apierr.MkdirFailed, "", nil)
+		return
+	}
+	name := fmt.Sprintf("%d-%s-%s.%s", p.ID, kind, randomHex(8), ext)
+	if err := os.WriteFile(filepath.Join(dir, name), out, 0o644); err != nil {
+		writeError(c, apierr.SaveFailed, "", nil)
+		return
+	}
+	prev := p.AvatarFile
+	if kind == "logo" {
+		prev = p.LogoFile
+	}
+	if err := db.Model(&p).Update(asset.column, name).Error; err != nil {
+		os.Remove(filepath.Join(dir, name))
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	if prev != "" {
+		os.Remove(filepath.Join(dir, filepath.Base(prev)))
+	}
+	db.First(&p, p.ID)
+	c.JSON(http.StatusOK, newProfileView(p))
+}
+
+// deleteProfileAssetHandler removes the caller's avatar or logo.
+func deleteProfileAssetHandler(c *gin.Context) {
+	kind := c.Param("kind")
+	asset, ok := profileAssets[kind]
+	if !ok {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var p models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&p).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	prev := p.AvatarFile
+	if kind == "logo" {
+		prev = p.LogoFile
+	}
+	if prev == "" {
+		writeError(c, apierr.NotFound, "no "+kind+" set", nil)
+		return
+	}
+	if err := db.Model(&p).Update(asset.column, "").Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	os.Remove(filepath.Join(uploadfiles.ProfileAssetsDir(), filepath.Base(prev)))
+	c.Status(http.StatusNoContent)
+}
+
+// profileAssetFileHandler serves an avatar or logo without authentication,
+// so reports and mail clients can embed them. Names carry a random part and
+// change on every upload, which lets them be cached for good.
+func profileAssetFileHandler(c *gin.Context) {
+	name := c.Param("name")
+	if !profileAssetName.MatchString(name) {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	path := filepath.Join(uploadfiles.ProfileAssetsDir(), name)
+	if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.File(path)
+}
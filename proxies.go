@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- client IP --------------------
+
+// defaultTrustedProxies covers a reverse proxy on the same host.
+var defaultTrustedProxies = []string{"127.0.0.1", "::1"}
+
+// trustedPlatforms maps TRUSTED_PLATFORM to the header the platform puts the
+// client address in.
+var trustedPlatforms = map[string]string{
+	"cloudflare":        gin.PlatformCloudflare,
+	"google-app-engine": gin.PlatformGoogleAppEngine,
+	"fly":               gin.PlatformFlyIO,
+}
+
+// configureClientIP decides whose X-Forwarded-For / X-Real-IP headers
+// c.ClientIP() believes, which the rate limiter and the audit log key on:
+// TRUSTED_PROXIES (comma separated IPs or CIDRs, default loopback, "none"
+// trusts no proxy) and TRUSTED_PLATFORM (cloudflare, google-app-engine or fly)
+// for a CDN that reports the client in its own header. Requests from anyone
+// else are attributed to the connecting address.
+func configureClientIP(r *gin.Engine) {
+	proxies := defaultTrustedProxies
+	switch v := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES")); strings.ToLower(v) {
+	case "":
+	case "none", "off":
+		proxies = nil
+	default:
+		proxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				proxies = append(proxies, p)
+			}
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Printf("client ip: TRUSTED_PROXIES: %v; trusting no proxy", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+	if p := strings.ToLower(strings.TrimSpace(os.Getenv("TRUSTED_PLATFORM"))); p != "" {
+		if header, ok := trustedPlatforms[p]; ok {
+			r.TrustedPlatform = header
+		} else {
+			log.Printf("client ip: unknown TRUSTED_PLATFORM %q", p)
+		}
+	}
+}
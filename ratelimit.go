@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"be03/pkg/apierr"
+	"be03/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- rate limiting --------------------
+
+// uploadOverrides is the administrator-managed list of per-user upload limits.
+var uploadOverrides = &ratelimit.OverrideCache{Key: "upload_rate_overrides", TTL: 5 * time.Second}
+
+// uploadLimitFromEnv is the default POST /uploads limit: UPLOAD_RATE_PER_MINUTE
+// (default 10, 0 disables) with bursts of UPLOAD_RATE_BURST (default 20).
+func uploadLimitFromEnv() ratelimit.Limit {
+	lim := ratelimit.Limit{PerMinute: 10, Burst: 20}
+	if n, err := strconv.Atoi(os.Getenv("UPLOAD_RATE_PER_MINUTE")); err == nil && n >= 0 {
+		lim.PerMinute = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("UPLOAD_RATE_BURST")); err == nil && n > 0 {
+		lim.Burst = n
+	}
+	return lim
+}
+
+// authLimitFromEnv limits login, registration and invite-accept attempts per client IP:
+// AUTH_RATE_PER_MINUTE (default 20, 0 disables) with bursts of
+// AUTH_RATE_BURST (default 10).
+func authLimitFromEnv() ratelimit.Limit {
+	lim := ratelimit.Limit{PerMinute: 20, Burst: 10}
+	if n, err := strconv.Atoi(os.Getenv("AUTH_RATE_PER_MINUTE")); err == nil && n >= 0 {
+		lim.PerMinute = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("AUTH_RATE_BURST")); err == nil && n > 0 {
+		lim.Burst = n
+	}
+	return lim
+}
+
+// apiLimits are the rate limiters of the API routes. They are built once and
+// shared by every mount of the API, so /api/v1 and its legacy aliases draw on
+// one quota.
+type apiLimits struct {
+	auth    gin.HandlerFunc
+	uploads gin.HandlerFunc
+}
+
+func newAPILimits() apiLimits {
+	return apiLimits{
+		auth:    rateLimit("auth", authLimitFromEnv(), nil),
+		uploads: rateLimit("uploads", uploadLimitFromEnv(), uploadOverrides),
+	}
+}
+
+// rateLimit limits each user to def on the route it guards, unless overrides
+// (optional) has an entry for them; anonymous requests are limited per client
+// IP (see configureClientIP). Responses carry X-RateLimit-* quota headers;
+// rejected requests get 429 with Retry-After.
+func rateLimit(name string, def ratelimit.Limit, overrides *ratelimit.OverrideCache) gin.HandlerFunc {
+	lim := ratelimit.New()
+	return func(c *gin.Context) {
+		l, key := def, "ip:"+c.ClientIP()
+		if user, ok := getUserFromContext(c); ok {
+			key = strconv.FormatUint(uint64(user.ID), 10)
+			if overrides != nil {
+				if o, ok := overrides.Lookup(db, user.Username); ok {
+					l = o
+				}
+			}
+		}
+		if l.Unlimited() {
+			c.Next()
+			return
+		}
+		d := lim.Allow(name+":"+key, l)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(int(d.Reset/time.Second)))
+		if !d.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(d.RetryAfter/time.Second)))
+			writeError(c, apierr.RateLimited, "", gin.H{"limit_per_minute": l.PerMinute, "burst": l.Burst})
+			return
+		}
+		c.Next()
+	}
+}
+
+// getRateLimitsHandler shows the default upload limit and the per-user overrides.
+func getRateLimitsHandler(c *gin.Context) {
+	list, err := ratelimit.LoadOverrides(db, uploadOverrides.Key)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"uploads": gin.H{"default": uploadLimitFromEnv(), "overrides": list}})
+}
+
+// setRateLimitsHandler replaces the upload overrides; per_minute 0 exempts a user.
+func setRateLimitsHandler(c *gin.Context) {
+	var req struct {
+		Overrides []ratelimit.Override `json:"overrides"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	list, err := ratelimit.SaveOverrides(db, uploadOverrides.Key, req.Overrides)
+	if err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "overrides"})
+		return
+	}
+	uploadOverrides.Invalidate()
+	recordAudit(c, "rate_limits.update", gin.H{"overrides": list})
+	c.JSON(http.StatusOK, gin.H{"uploads": gin.H{"default": uploadLimitFromEnv(), "overrides": list}})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/roles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- roles --------------------
+
+// requirePermission rejects callers whose role does not grant perm.
+func requirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := getUserFromContext(c)
+		if !ok {
+			writeError(c, apierr.Unauthorized, "", nil)
+			return
+		}
+		r, err := roles.Of(db, user)
+		if err != nil {
+			writeError(c, apierr.QueryFailed, "", nil)
+			return
+		}
+		if !roles.Has(r, perm) {
+			writeError(c, apierr.Forbidden, "your role does not allow this", gin.H{"permission": perm})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkUploadQuota enforces the tenant's monthly upload limit and the role's
+// uploads-per-day limit for profile, counting from midnight in the user's
+// timezone.
+func checkUploadQuota(c *gin.Context, user models.User, profile models.Profile) bool {
+	if !checkTenantUploadLimit(c) {
+		return false
+	}
+	r, err := roles.Of(db, user)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	if r.UploadsPerDay <= 0 {
+		return true
+	}
+	now := time.Now().In(loadPreferences(user.ID).Location())
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var used int64
+	if err := db.Model(&models.Upload{}).Where("profile_id = ? AND created_at >= ?", profile.ID, midnight.UTC()).Count(&used).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	if used >= int64(r.UploadsPerDay) {
+		writeError(c, apierr.QuotaExceeded, "daily upload quota reached", gin.H{"limit": r.UploadsPerDay, "used": used, "role": r.Name})
+		return false
+	}
+	return true
+}
+
+// checkProfileLimit enforces the role's max_profiles limit before a profile is created.
+func checkProfileLimit(c *gin.Context, user models.User) bool {
+	r, err := roles.Of(db, user)
+	if err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	if r.MaxProfiles <= 0 {
+		return true
+	}
+	var n int64
+	db.Model(&models.Profile{}).Where("user_id = ?", user.ID).Count(&n)
+	if n >= int64(r.MaxProfiles) {
+		writeError(c, apierr.QuotaExceeded, "profile limit reached", gin.H{"limit": r.MaxProfiles, "role": r.Name})
+		return false
+	}
+	return true
+}
+
+type roleView struct {
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Permissions   []string `json:"permissions"`
+	UploadsPerDay int      `json:"uploads_per_day"`
+	MaxProfiles   int      `json:"max_profiles"`
+	BuiltIn       bool     `json:"built_in"`
+	Users         int64    `json:"users"`
+}
+
+func viewRole(r models.Role) roleView {
+	v := roleView{ID: r.ID, Name: r.Name, Description: r.Description, Permissions: roles.Permissions(r),
+		UploadsPerDay: r.UploadsPerDay, MaxProfiles: r.MaxProfiles, BuiltIn: roles.BuiltIn(r.Name)}
+	db.Model(&models.User{}).Where("role_id = ?", r.ID).Count(&v.Users)
+	return v
+}
+
+// roleRequest is the body of POST and PUT /admin/roles; on PUT, omitted
+// fields keep their value.
+type roleRequest struct {
+	Name          *string   `json:"name"`
+	Description   *string   `json:"description"`
+	Permissions   *[]string `json:"permissions"`
+	UploadsPerDay *int      `json:"uploads_per_day"`
+	MaxProfiles   *int      `json:"max_profiles"`
+}
+
+// apply copies req onto r, validating as it goes.
+func (req roleRequest) apply(c *gin.Context, r *models.Role) bool {
+	builtIn := r.ID != 0 && roles.BuiltIn(r.Name)
+	if req.Name != nil {
+		name := strings.ToLower(strings.TrimSpace(*req.Name))
+		if name == "" || len(name) > 32 {
+			writeError(c, apierr.InvalidBody, "name must be 1-32 characters", gin.H{"field": "name"})
+			return false
+		}
+		if name != r.Name && (builtIn || roles.BuiltIn(name)) {
+			writeError(c, apierr.InvalidBody, "built-in roles cannot be renamed or reused", gin.H{"field": "name"})
+			return false
+		}
+		r.Name = name
+	}
+	if req.Description != nil {
+		r.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Permissions != nil {
+		if builtIn {
+			writeError(c, apierr.InvalidBody, "built-in roles hold every permission", gin.H{"field": "permissions"})
+			return false
+		}
+		perms, err := roles.Normalize(*req.Permissions)
+		if err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "permissions", "allowed": roles.All})
+			return false
+		}
+		r.Permissions = perms
+	}
+	for _, l := range []struct {
+		field string
+		src   *int
+		dst   *int
+	}{{"uploads_per_day", req.UploadsPerDay, &r.UploadsPerDay}, {"max_profiles", req.MaxProfiles, &r.MaxProfiles}} {
+		if l.src == nil {
+			continue
+		}
+		if *l.src < 0 {
+			writeError(c, apierr.InvalidBody, l.field+" must not be negative", gin.H{"field": l.field})
+			return false
+		}
+		*l.dst = *l.src
+	}
+	return true
+}
+
+// listRolesHandler lists every role with its permissions, limits and user count.
+func listRolesHandler(c *gin.Context) {
+	var rows []models.Role
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]roleView, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, viewRole(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": out, "permissions": roles.All})
+}
+
+// createRoleHandler adds a custom role.
+func createRoleHandler(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if req.Name == nil {
+		writeError(c, apierr.InvalidBody, "name is required", gin.H{"field": "name"})
+		return
+	}
+	var r models.Role
+	if !req.apply(c, &r) {
+		return
+	}
+	var n int64
+	db.Model(&models.Role{}).Where("name = ?", r.Name).Count(&n)
+	if n > 0 {
+		writeError(c, apierr.Duplicate, "role already exists", gin.H{"field": "name"})
+		return
+	}
+	if err := db.Create(&r).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "admin.role.create", viewRole(r))
+	c.JSON(http.StatusCreated, viewRole(r))
+}
+
+// updateRoleHandler changes a role; built-in roles only take a new
+// description and limits.
+func updateRoleHandler(c *gin.Context) {
+	var r models.Role
+	if err := db.First(&r, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	prevName := r.Name
+	if !req.apply(c, &r) {
+		return
+	}
+	if r.Name != prevName {
+		var n int64
+		db.Model(&models.Role{}).Where("name = ? AND id <> ?", r.Name, r.ID).Count(&n)
+		if n > 0 {
+			writeError(c, apierr.Duplicate, "role already exists", gin.H{"field": "name"})
+			return
+		}
+	}
+	if err := db.Save(&r).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "admin.role.update", viewRole(r))
+	c.JSON(http.StatusOK, viewRole(r))
+}
+
+// deleteRoleHandler removes a custom role nobody holds any more.
+func deleteRoleHandler(c *gin.Context) {
+	var r models.Role
+	if err := db.First(&r, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if roles.BuiltIn(r.Name) {
+		writeError(c, apierr.Forbidden, "built-in roles cannot be deleted", nil)
+		return
+	}
+	if v := viewRole(r); v.Users > 0 {
+		writeError(c, apierr.Duplicate, "role is still assigned to users", gin.H{"users": v.Users})
+		return
+	}
+	if err := db.Delete(&r).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	recordAudit(c, "admin.role.delete", gin.H{"id": r.ID, "name": r.Name})
+	c.Status(http.StatusNoContent)
+}
+
+// setUserRoleHandler assigns a role to a user by username. It applies to the
+// user's next request, including with access tokens issued before.
+func setUserRoleHandler(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	var u models.User
+	if err := reqDB(c).Where("username = ?", c.Param("username")).First(&u).Error; err != nil {
+		writeError(c, apierr.NotFound, "user not found", nil)
+		return
+	}
+	var r models.Role
+	if err := db.Where("name = ?", req.Role).First(&r).Error; err != nil {
+		writeError(c, apierr.NotFound, "role not found", gin.H{"field": "role"})
+		return
+	}
+	if err := db.Model(&u).Update("role_id", r.ID).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	userCache.Invalidate(u.ID)
+	recordAudit(c, "admin.user.role", gin.H{"username": u.Username, "role": r.Name})
+	c.JSON(http.StatusOK, gin.H{"username": u.Username, "role": r.Name})
+}
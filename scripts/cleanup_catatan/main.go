@@ -1,11 +1,17 @@
+// Command cleanup_catatan deletes catatan (unlinking uploads first) for one user or
+// for everyone. Prefer POST /api/v1/admin/cleanup, which supports finer scopes and
+// writes an audit entry; this tool remains for shell access and shares its logic.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 
+	"be03/pkg/cleanup"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -14,6 +20,8 @@ func main() {
 	user := flag.String("user", "", "Username to clean (optional). If empty, cleans all users.")
 	dry := flag.Bool("dry-run", true, "Preview actions without modifying the DB")
 	yes := flag.Bool("yes", false, "Confirm destructive action when dry-run=false")
+	zero := flag.Bool("zero-only", false, "Only catatan with amount 0")
+	failed := flag.Bool("failed-only", false, "Only catatan linked to uploads marked failed")
 	flag.Parse()
 
 	dsn := os.Getenv("DB_DSN")
@@ -25,52 +33,25 @@ func main() {
 		log.Fatalf("failed to connect db: %v", err)
 	}
 
-	if *user == "" {
-		fmt.Println("Planned actions:")
-		fmt.Println(" - Set uploads.keuangan_id = NULL for ALL uploads")
-		fmt.Println(" - DELETE FROM catatan_keuangans (all rows)")
-		if *dry {
-			fmt.Println("dry-run: no changes made. Use --dry-run=false --yes to execute.")
-			return
-		}
-		if !*yes {
-			fmt.Println("Destructive! Pass --yes to proceed.")
-			return
-		}
-		if err := db.Exec("UPDATE uploads SET keuangan_id=NULL WHERE keuangan_id IS NOT NULL").Error; err != nil {
-			log.Fatalf("unlink uploads failed: %v", err)
-		}
-		if err := db.Exec("DELETE FROM catatan_keuangans").Error; err != nil {
-			log.Fatalf("delete catatan failed: %v", err)
-		}
-		fmt.Println("cleanup done (global)")
+	scope := cleanup.Scope{Username: *user, ZeroAmountOnly: *zero, FailedOnly: *failed}
+	if !*dry && !*yes {
+		fmt.Println("Destructive! Pass --yes to proceed.")
 		return
 	}
-
-	// Per-user cleanup: unlink uploads for profiles of this user, then delete catatan rows for this user
-	var userID int64
-	if err := db.Raw("SELECT id FROM users WHERE username = ?", *user).Row().Scan(&userID); err != nil {
-		log.Fatalf("user lookup failed for %s: %v", *user, err)
+	res, err := cleanup.Run(db, scope, *dry)
+	if err != nil {
+		if errors.Is(err, cleanup.ErrUserNotFound) {
+			log.Fatalf("user lookup failed for %s: %v", *user, err)
+		}
+		log.Fatalf("cleanup failed: %v", err)
 	}
-
-	fmt.Printf("Planned actions for user %s (id=%d):\n", *user, userID)
-	fmt.Println(" - Set uploads.keuangan_id = NULL for uploads whose profile belongs to this user")
-	fmt.Println(" - DELETE FROM catatan_keuangans WHERE user_id = $userID")
-	if *dry {
-		fmt.Println("dry-run: no changes made. Use --dry-run=false --yes to execute.")
-		return
+	target := "all users"
+	if *user != "" {
+		target = *user
 	}
-	if !*yes {
-		fmt.Println("Destructive! Pass --yes to proceed.")
+	if res.DryRun {
+		fmt.Printf("dry-run for %s: would delete %d catatan and unlink %d uploads. Use --dry-run=false --yes to execute.\n", target, res.Catatan, res.UploadsUnlinked)
 		return
 	}
-	// Unlink uploads for this user
-	if err := db.Exec(`UPDATE uploads SET keuangan_id=NULL WHERE profile_id IN (SELECT id FROM profiles WHERE user_id=?)`, userID).Error; err != nil {
-		log.Fatalf("unlink uploads for user failed: %v", err)
-	}
-	// Delete catatan for this user
-	if err := db.Exec(`DELETE FROM catatan_keuangans WHERE user_id=?`, userID).Error; err != nil {
-		log.Fatalf("delete catatan for user failed: %v", err)
-	}
-	fmt.Printf("cleanup done for %s\n", *user)
+	fmt.Printf("cleanup done for %s: deleted %d catatan, unlinked %d uploads\n", target, res.Catatan, res.UploadsUnlinked)
 }
@@ -25,7 +25,7 @@ PORT="${SERVER_PORT:-${PORT:-8081}}"
 
 echo "[e2e] logging in as $USERN ..."
 RESP=$(curl -s -H 'Content-Type: application/json' -H 'Origin: http://localhost:5173' \
-  -X POST "http://127.0.0.1:${PORT}/login" \
+  -X POST "http://127.0.0.1:${PORT}/api/v1/login" \
   --data "{\"username\":\"${USERN}\",\"password\":\"${PASSW}\"}")
 
 ACCESS_TOKEN=""
@@ -46,7 +46,7 @@ BN=$(basename -- "$FILE")
 echo "[e2e] uploading $BN ... (forced to public/keu)"
 URESP=$(curl -s -H "Authorization: Bearer $ACCESS_TOKEN" \
   -F "file=@${FILE}" \
-  "http://127.0.0.1:${PORT}/uploads")
+  "http://127.0.0.1:${PORT}/api/v1/uploads")
 echo "[e2e] upload response: $URESP"
 
 echo "[e2e] polling DB for OCR result on file_name=$BN ..."
@@ -47,9 +47,15 @@ func main() {
 	if err != nil {
 		log.Fatalf("bcrypt: %v", err)
 	}
-	if err := db.Model(&user).Update("hashed_password", hash).Error; err != nil {
+	// bumping the token version rejects access tokens issued with the old
+	// password; revoking refresh tokens ends the sessions for good
+	err = db.Model(&user).Updates(map[string]any{"hashed_password": hash, "token_version": gorm.Expr("token_version + 1")}).Error
+	if err != nil {
 		log.Fatalf("update failed: %v", err)
 	}
+	if err := db.Table("refresh_tokens").Where("user_id = ?", user.ID).Update("revoked", true).Error; err != nil {
+		log.Printf("revoking sessions failed: %v", err)
+	}
 	fmt.Printf("Password reset for user %s\n", user.Username)
 }
 
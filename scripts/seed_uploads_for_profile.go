@@ -1,6 +0,0 @@
-package scripts
-
-// placeholder to allow `go build ./...` to succeed.
-// Original seeding logic can be restored here if needed.
-
-func SeedUploadsForProfilePlaceholder() {}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// -------------------- server --------------------
+
+// tlsSettings configure HTTPS when the server faces clients without a
+// reverse proxy in front.
+type tlsSettings struct {
+	CertFile, KeyFile string
+	// Domains get certificates from Let's Encrypt, cached in CacheDir.
+	Domains  []string
+	CacheDir string
+	Email    string
+	// RedirectAddr serves plain HTTP redirecting to HTTPS (and ACME
+	// challenges); empty disables it.
+	RedirectAddr string
+}
+
+// tlsSettingsFromEnv reads TLS_CERT_FILE / TLS_KEY_FILE, or
+// TLS_AUTOCERT_DOMAINS (comma separated) with TLS_AUTOCERT_CACHE (default
+// certs) and TLS_AUTOCERT_EMAIL, plus HTTP_REDIRECT_ADDR (default :80, "off"
+// disables). ok is false when TLS is not configured.
+func tlsSettingsFromEnv() (s tlsSettings, ok bool) {
+	s = tlsSettings{
+		CertFile:     strings.TrimSpace(os.Getenv("TLS_CERT_FILE")),
+		KeyFile:      strings.TrimSpace(os.Getenv("TLS_KEY_FILE")),
+		CacheDir:     strings.TrimSpace(os.Getenv("TLS_AUTOCERT_CACHE")),
+		Email:        strings.TrimSpace(os.Getenv("TLS_AUTOCERT_EMAIL")),
+		RedirectAddr: strings.TrimSpace(os.Getenv("HTTP_REDIRECT_ADDR")),
+	}
+	for _, d := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			s.Domains = append(s.Domains, d)
+		}
+	}
+	if s.CacheDir == "" {
+		s.CacheDir = "certs"
+	}
+	switch strings.ToLower(s.RedirectAddr) {
+	case "":
+		s.RedirectAddr = ":80"
+	case "off", "false", "0", "no":
+		s.RedirectAddr = ""
+	}
+	return s, (s.CertFile != "" && s.KeyFile != "") || len(s.Domains) > 0
+}
+
+// httpsRedirect sends plain HTTP requests to the same URL on HTTPS; httpsPort
+// is added to the host unless it is 443.
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// listenAddr is where the API listens: LISTEN_ADDR ("host:port", ":port" or
+// "unix:/path/to/socket"), else ":" + PORT (or SERVER_PORT), default :8080.
+func listenAddr() string {
+	if a := strings.TrimSpace(os.Getenv("LISTEN_ADDR")); a != "" {
+		return a
+	}
+	port := strings.TrimSpace(os.Getenv("PORT"))
+	if port == "" {
+		port = strings.TrimSpace(os.Getenv("SERVER_PORT"))
+	}
+	if port == "" {
+		port = "8080"
+	}
+	return ":" + port
+}
+
+// listen opens addr (see listenAddr). A socket passed by systemd socket
+// activation (LISTEN_FDS) is used instead when present. A stale Unix socket
+// file is replaced and the new one gets UNIX_SOCKET_MODE (octal, default
+// 0660) so a reverse proxy in the same group can connect.
+func listen(addr string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) && os.Getenv("LISTEN_FDS") != "" {
+		if n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err == nil && n >= 1 {
+			// the first passed descriptor is always 3
+			return net.FileListener(os.NewFile(3, "systemd-socket"))
+		}
+	}
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0o660)
+	if m, err := strconv.ParseUint(os.Getenv("UNIX_SOCKET_MODE"), 8, 32); err == nil {
+		mode = os.FileMode(m)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serve runs h on addr: plain HTTP, or HTTPS with HTTP/2 when TLS is
+// configured (see tlsSettingsFromEnv), in which case a second listener
+// redirects HTTP to HTTPS.
+func serve(h http.Handler, addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	if ln.Addr().Network() == "unix" {
+		// only local processes reach the socket; present them as loopback so
+		// the proxy in front is trusted like one on 127.0.0.1
+		srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = "127.0.0.1:0"
+			h.ServeHTTP(w, r)
+		})
+	}
+	s, ok := tlsSettingsFromEnv()
+	if !ok {
+		log.Printf("listening on %s %s (http)", ln.Addr().Network(), ln.Addr())
+		return srv.Serve(ln)
+	}
+	// net/http negotiates HTTP/2 over TLS on its own
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	httpsPort := ""
+	if _, port, err := net.SplitHostPort(ln.Addr().String()); err == nil {
+		httpsPort = port
+	}
+	redirect := httpsRedirect(httpsPort)
+	certFile, keyFile := s.CertFile, s.KeyFile
+	if certFile == "" || keyFile == "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.Domains...),
+			Cache:      autocert.DirCache(s.CacheDir),
+			Email:      s.Email,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		// HTTP-01 challenges arrive on the redirect listener
+		redirect = m.HTTPHandler(redirect)
+		log.Printf("tls: certificates for %s from Let's Encrypt, cached in %s", strings.Join(s.Domains, ", "), s.CacheDir)
+	}
+	if s.RedirectAddr != "" {
+		go func() {
+			rs := &http.Server{Addr: s.RedirectAddr, Handler: redirect, ReadHeaderTimeout: 10 * time.Second}
+			if err := rs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("http redirect listener on %s: %v", s.RedirectAddr, err)
+			}
+		}()
+	}
+	log.Printf("listening on %s %s (https, http/2)", ln.Addr().Network(), ln.Addr())
+	return srv.ServeTLS(ln, certFile, keyFile)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- sessions --------------------
+
+// refreshTTL is the lifetime of a refresh token from a normal login.
+const refreshTTL = 7 * 24 * time.Hour
+
+// rememberMeTTLs returns how far each refresh extends a remember-me token
+// (REMEMBER_ME_TTL_DAYS, default 30) and its absolute lifetime from login
+// (REMEMBER_ME_MAX_DAYS, default 90).
+func rememberMeTTLs() (ttl, lifetime time.Duration) {
+	days, maxDays := 30, 90
+	if n, err := strconv.Atoi(os.Getenv("REMEMBER_ME_TTL_DAYS")); err == nil && n > 0 {
+		days = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REMEMBER_ME_MAX_DAYS")); err == nil && n > 0 {
+		maxDays = n
+	}
+	if days > maxDays {
+		days = maxDays
+	}
+	return time.Duration(days) * 24 * time.Hour, time.Duration(maxDays) * 24 * time.Hour
+}
+
+// deviceHash hashes the fingerprint a client sends as device_id; the raw value
+// is never stored.
+func deviceHash(deviceID string) string {
+	h := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(h[:])
+}
+
+// newSession prepares the refresh token row of a login from c; rememberMe
+// binds it to deviceID with the longer remember-me lifetime.
+func newSession(c *gin.Context, rememberMe bool, deviceID string) *models.RefreshToken {
+	now := time.Now()
+	name := c.Request.UserAgent()
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	rt := &models.RefreshToken{ExpiresAt: now.Add(refreshTTL), DeviceName: name, LastUsedAt: &now}
+	if rememberMe {
+		ttl, lifetime := rememberMeTTLs()
+		limit := now.Add(lifetime)
+		rt.RememberMe, rt.DeviceHash, rt.ExpiresAt, rt.MaxExpiresAt = true, deviceHash(deviceID), now.Add(ttl), &limit
+	}
+	return rt
+}
+
+// touchSession checks a remember-me token against the presenting device and
+// extends it; every token records its last use. It reports false when the
+// device does not match.
+func touchSession(rt *models.RefreshToken, deviceID string) bool {
+	now := time.Now()
+	if rt.RememberMe {
+		if deviceID == "" || subtle.ConstantTimeCompare([]byte(deviceHash(deviceID)), []byte(rt.DeviceHash)) != 1 {
+			return false
+		}
+		ttl, _ := rememberMeTTLs()
+		rt.ExpiresAt = now.Add(ttl)
+		if rt.MaxExpiresAt != nil && rt.ExpiresAt.After(*rt.MaxExpiresAt) {
+			rt.ExpiresAt = *rt.MaxExpiresAt
+		}
+	}
+	rt.LastUsedAt = &now
+	db.Save(rt)
+	return true
+}
+
+// sessionView is one signed-in device in the sessions list.
+type sessionView struct {
+	ID         uint       `json:"id"`
+	DeviceName string     `json:"device_name"`
+	RememberMe bool       `json:"remember_me"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// listSessionsHandler lists the caller's active refresh tokens, newest first.
+func listSessionsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var rows []models.RefreshToken
+	if err := db.Where("user_id = ? AND revoked = ? AND expires_at > ?", user.ID, false, time.Now().UTC()).
+		Order("id desc").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]sessionView, 0, len(rows))
+	for _, rt := range rows {
+		out = append(out, sessionView{ID: rt.ID, DeviceName: rt.DeviceName, RememberMe: rt.RememberMe, CreatedAt: rt.CreatedAt, LastUsedAt: rt.LastUsedAt, ExpiresAt: rt.ExpiresAt})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// revokeSessionHandler signs one of the caller's devices out.
+func revokeSessionHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Model(&models.RefreshToken{}).Where("id = ? AND user_id = ? AND revoked = ?", c.Param("id"), user.ID, false).Update("revoked", true)
+	if res.Error != nil {
+		writeError(c, apierr.RevokeFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// revokeRememberedSessionsHandler forgets every remember-me device of the
+// caller; ordinary sessions stay signed in.
+func revokeRememberedSessionsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Model(&models.RefreshToken{}).Where("user_id = ? AND remember_me = ? AND revoked = ?", user.ID, true, false).Update("revoked", true)
+	if res.Error != nil {
+		writeError(c, apierr.RevokeFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": res.RowsAffected})
+}
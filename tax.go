@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/catatanarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- tax (PPN) --------------------
+
+// checkTax validates the tax and service charge entered for a catatan of
+// amount: neither is negative and together they are part of the amount.
+func checkTax(c *gin.Context, amount int64, tax, service *int64) bool {
+	var t, s int64
+	if tax != nil {
+		t = *tax
+	}
+	if service != nil {
+		s = *service
+	}
+	if t < 0 || s < 0 {
+		writeError(c, apierr.InvalidBody, "tax and service_charge must not be negative", gin.H{"field": "tax"})
+		return false
+	}
+	if amount < 0 {
+		amount = -amount
+	}
+	if amount > 0 && t+s > amount {
+		writeError(c, apierr.InvalidBody, "tax and service_charge must not exceed the amount", gin.H{"field": "tax", "amount": amount})
+		return false
+	}
+	return true
+}
+
+// taxSummaryHandler totals the tax and service charge of the caller's
+// confirmed catatan per month (in the user's timezone), optionally limited by
+// from / to (YYYY-MM-DD, inclusive) or a saved ?view=, for users who reclaim
+// or report VAT.
+func taxSummaryHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	loc := loadPreferences(user.ID).Location()
+	from, to, scope, ok := catatanRange(c, user.ID, loc)
+	if !ok {
+		return
+	}
+	q := catatanarchive.Catatan(reportDB(c), from).
+		Where("user_id = ? AND pending = ? AND (tax <> 0 OR service_charge <> 0)", user.ID, false)
+	if from != nil {
+		q = q.Where("date >= ?", from.UTC())
+	}
+	if to != nil {
+		q = q.Where("date < ?", to.UTC())
+	}
+	var rows []models.CatatanKeuangan
+	if err := q.Scopes(scope).Select("amount", "date", "tax", "service_charge").Order("date").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	type month struct {
+		Month         string `json:"month"`
+		Tax           int64  `json:"tax"`
+		ServiceCharge int64  `json:"service_charge"`
+		TaxedAmount   int64  `json:"taxed_amount"` // amount of the catatan carrying tax
+		Count         int64  `json:"count"`
+	}
+	months := []month{}
+	var total month
+	for _, r := range rows {
+		key := r.Date.In(loc).Format("2006-01")
+		if len(months) == 0 || months[len(months)-1].Month != key {
+			months = append(months, month{Month: key})
+		}
+		for _, m := range []*month{&months[len(months)-1], &total} {
+			m.Tax += r.Tax
+			m.ServiceCharge += r.ServiceCharge
+			if r.Tax != 0 {
+				m.TaxedAmount += r.Amount
+			}
+			m.Count++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tax":            total.Tax,
+		"service_charge": total.ServiceCharge,
+		"taxed_amount":   total.TaxedAmount,
+		"count":          total.Count,
+		"months":         months,
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- tenants --------------------
+
+// tenancyCfg is the MULTI_TENANT configuration; initTenancy reads it. While
+// disabled every request belongs to the default tenant and nothing is scoped.
+var tenancyCfg tenancy.Config
+
+var tenantDir = tenancy.NewDirectory(30 * time.Second)
+
+// initTenancy reads the tenancy settings and, when enabled, installs the
+// GORM plugin that confines statements to the request's tenant.
+func initTenancy() {
+	tenancyCfg = tenancy.ConfigFromEnv()
+	if !tenancyCfg.Enabled {
+		return
+	}
+	if err := db.Use(tenancy.Plugin{}); err != nil {
+		log.Fatalf("tenancy plugin: %v", err)
+	}
+	log.Printf("multi-tenant mode on (base domain %q, header %s)", tenancyCfg.BaseDomain, tenancyCfg.Header)
+}
+
+// tenantMiddleware resolves the tenant a request is for from its host or
+// tenant header and scopes the request context, and with it reqDB, to it.
+// Unknown tenants get 404, suspended ones 403.
+func tenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tenancyCfg.Enabled || strings.HasSuffix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+		var t models.Tenant
+		if slug := tenancyCfg.Slug(c.Request.Host, c.GetHeader(tenancyCfg.Header)); slug != "" {
+			var err error
+			t, err = tenantDir.Lookup(db, slug)
+			switch {
+			case errors.Is(err, tenancy.ErrUnknown):
+				writeError(c, apierr.TenantNotFound, "", gin.H{"tenant": slug})
+				return
+			case errors.Is(err, tenancy.ErrDisabled):
+				writeError(c, apierr.TenantDisabled, "", gin.H{"tenant": slug})
+				return
+			case err != nil:
+				writeError(c, apierr.QueryFailed, "", nil)
+				return
+			}
+		}
+		c.Set("tenant", t)
+		c.Request = c.Request.WithContext(tenancy.WithTenant(c.Request.Context(), t.ID))
+		c.Next()
+	}
+}
+
+// currentTenant is the request's tenant; the zero Tenant is the default one.
+func currentTenant(c *gin.Context) models.Tenant {
+	t, _ := c.Get("tenant")
+	tn, _ := t.(models.Tenant)
+	return tn
+}
+
+// wrongTenant reports whether user belongs to another tenant than the
+// request. Such users are treated as unknown, so a token or password is only
+// good on its own tenant's domain.
+func wrongTenant(c *gin.Context, user models.User) bool {
+	return tenancyCfg.Enabled && user.TenantID != currentTenant(c).ID
+}
+
+// requirePlatformAdmin keeps the deployment-wide admin endpoints for the
+// administrators of the default tenant; a tenant's own administrators manage
+// only their users and data.
+func requirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, _ := getUserFromContext(c); tenancyCfg.Enabled && user.TenantID != tenancy.Default {
+			writeError(c, apierr.Forbidden, "platform administrator required", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkTenantUserLimit enforces the tenant's max_users before an account is
+// created in it.
+func checkTenantUserLimit(c *gin.Context) bool {
+	t := currentTenant(c)
+	if t.MaxUsers <= 0 {
+		return true
+	}
+	var n int64
+	if err := reqDB(c).Model(&models.User{}).Where("deleted_at IS NULL").Count(&n).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	if n >= int64(t.MaxUsers) {
+		writeError(c, apierr.QuotaExceeded, "the tenant's user limit is reached", gin.H{"tenant": t.Slug, "resource": "users", "limit": t.MaxUsers, "used": n})
+		return false
+	}
+	return true
+}
+
+// checkTenantUploadLimit enforces the tenant's uploads-per-calendar-month
+// limit (UTC).
+func checkTenantUploadLimit(c *gin.Context) bool {
+	t := currentTenant(c)
+	if t.MaxUploadsPerMonth <= 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var n int64
+	if err := reqDB(c).Model(&models.Upload{}).Where("created_at >= ?", month).Count(&n).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return false
+	}
+	if n >= int64(t.MaxUploadsPerMonth) {
+		writeError(c, apierr.QuotaExceeded, "the tenant's monthly upload limit is reached", gin.H{"tenant": t.Slug, "resource": "uploads", "limit": t.MaxUploadsPerMonth, "used": n})
+		return false
+	}
+	return true
+}
+
+// getTenantHandler returns the branding of the request's tenant for the
+// frontend; the default tenant has none.
+func getTenantHandler(c *gin.Context) {
+	t := currentTenant(c)
+	c.JSON(http.StatusOK, gin.H{"multi_tenant": tenancyCfg.Enabled, "slug": t.Slug, "name": t.Name, "logo_url": t.LogoURL, "primary_color": t.PrimaryColor})
+}
+
+var colorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// tenantRequest is the body of the tenant admin endpoints; absent fields are
+// left unchanged on update.
+type tenantRequest struct {
+	Slug               string  `json:"slug"`
+	Name               *string `json:"name"`
+	LogoURL            *string `json:"logo_url"`
+	PrimaryColor       *string `json:"primary_color"`
+	MaxUsers           *int    `json:"max_users"`
+	MaxUploadsPerMonth *int    `json:"max_uploads_per_month"`
+	Disabled           *bool   `json:"disabled"`
+}
+
+// apply copies req onto t; it returns the offending field when invalid.
+func (req tenantRequest) apply(t *models.Tenant) (string, string) {
+	if req.Name != nil {
+		t.Name = strings.TrimSpace(*req.Name)
+	}
+	if t.Name == "" || len(t.Name) > 255 {
+		return "name", "name is required (at most 255 characters)"
+	}
+	if req.LogoURL != nil {
+		t.LogoURL = strings.TrimSpace(*req.LogoURL)
+	}
+	if t.LogoURL != "" && (len(t.LogoURL) > 512 || !strings.HasPrefix(t.LogoURL, "https://") && !strings.HasPrefix(t.LogoURL, "http://")) {
+		return "logo_url", "logo_url must be an http(s) URL of at most 512 characters"
+	}
+	if req.PrimaryColor != nil {
+		t.PrimaryColor = strings.ToLower(strings.TrimSpace(*req.PrimaryColor))
+	}
+	if t.PrimaryColor != "" && !colorRE.MatchString(t.PrimaryColor) {
+		return "primary_color", "primary_color must look like #1a2b3c"
+	}
+	if req.MaxUsers != nil {
+		t.MaxUsers = *req.MaxUsers
+	}
+	if req.MaxUploadsPerMonth != nil {
+		t.MaxUploadsPerMonth = *req.MaxUploadsPerMonth
+	}
+	if t.MaxUsers < 0 || t.MaxUploadsPerMonth < 0 {
+		return "limits", "limits must be 0 (unlimited) or more"
+	}
+	if req.Disabled != nil {
+		switch {
+		case !*req.Disabled:
+			t.DisabledAt = nil
+		case t.DisabledAt == nil:
+			now := time.Now()
+			t.DisabledAt = &now
+		}
+	}
+	return "", ""
+}
+
+func listTenantsHandler(c *gin.Context) {
+	var rows []models.Tenant
+	if err := db.Order("slug").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": rows})
+}
+
+func createTenantHandler(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	t := models.Tenant{Slug: strings.ToLower(strings.TrimSpace(req.Slug))}
+	if !tenancy.ValidSlug(t.Slug) {
+		writeError(c, apierr.InvalidBody, "slug must be a lower-case DNS label other than www", gin.H{"field": "slug"})
+		return
+	}
+	if field, msg := req.apply(&t); field != "" {
+		writeError(c, apierr.InvalidBody, msg, gin.H{"field": field})
+		return
+	}
+	if err := db.Create(&t).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			writeError(c, apierr.Duplicate, "slug taken", gin.H{"field": "slug"})
+			return
+		}
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	tenantDir.Forget()
+	recordAudit(c, "tenant.create", gin.H{"tenant_id": t.ID, "slug": t.Slug})
+	c.JSON(http.StatusCreated, t)
+}
+
+// updateTenantHandler changes a tenant's name, branding, limits or
+// suspension. The slug is fixed once created.
+func updateTenantHandler(c *gin.Context) {
+	var t models.Tenant
+	if err := db.First(&t, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "tenant not found", nil)
+		return
+	}
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if field, msg := req.apply(&t); field != "" {
+		writeError(c, apierr.InvalidBody, msg, gin.H{"field": field})
+		return
+	}
+	if err := db.Select("*").Omit("created_at").Updates(&t).Error; err != nil {
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	tenantDir.Forget()
+	recordAudit(c, "tenant.update", gin.H{"tenant_id": t.ID, "slug": t.Slug, "disabled": t.DisabledAt != nil})
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"be03/pkg/refreshtokens"
+	"be03/pkg/scheduler"
+)
+
+// -------------------- refresh token janitor --------------------
+
+// tokenJanitorStats are reported by /debug/vars.
+var tokenJanitorStats struct {
+	runs, pruned, lastPruned, lastRunUnix atomic.Int64
+}
+
+// tokenRetentionDays is REFRESH_TOKEN_RETENTION_DAYS (default 30): dead
+// refresh tokens are kept this long. 0 disables the janitor.
+func tokenRetentionDays() int {
+	if n, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_RETENTION_DAYS")); err == nil && n >= 0 {
+		return n
+	}
+	return refreshtokens.DefaultRetentionDays
+}
+
+// pruneRefreshTokens runs one janitor pass and records it in tokenJanitorStats.
+func pruneRefreshTokens(now time.Time, days int) (int64, error) {
+	n, err := refreshtokens.Prune(db, refreshtokens.Cutoff(now, days), refreshtokens.DefaultBatch)
+	tokenJanitorStats.runs.Add(1)
+	tokenJanitorStats.pruned.Add(n)
+	tokenJanitorStats.lastPruned.Store(n)
+	tokenJanitorStats.lastRunUnix.Store(now.Unix())
+	return n, err
+}
+
+// pruneTokensJob is the token_janitor job: it deletes expired and revoked
+// refresh tokens older than days.
+func pruneTokensJob(days int) scheduler.Func {
+	return func(context.Context) (string, error) {
+		n, err := pruneRefreshTokens(time.Now(), days)
+		return fmt.Sprintf("pruned %d refresh tokens dead for more than %d days", n, days), err
+	}
+}
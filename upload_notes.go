@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"be03/models"
+	"be03/pkg/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- upload notes --------------------
+
+// maxUploadNotes caps the notes of one upload.
+const maxUploadNotes = 100
+
+// noteUpload loads the upload of :id for its notes: administrators reach
+// every upload, other users their own.
+func noteUpload(c *gin.Context) (models.Upload, bool) {
+	var up models.Upload
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return up, false
+	}
+	var profile models.Profile
+	db.Where("user_id = ?", user.ID).First(&profile)
+	if err := reqDB(c).First(&up, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return up, false
+	}
+	if role != "administrator" && up.ProfileID != profile.ID {
+		writeError(c, apierr.Forbidden, "", nil)
+		return up, false
+	}
+	return up, true
+}
+
+// listUploadNotesHandler returns the notes of an upload, oldest first.
+func listUploadNotesHandler(c *gin.Context) {
+	up, ok := noteUpload(c)
+	if !ok {
+		return
+	}
+	notes := []models.UploadNote{}
+	if err := reqDB(c).Where("upload_id = ?", up.ID).Order("id").Find(&notes).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// createUploadNoteHandler adds {note} to an upload, e.g. "blurred, asked the
+// user to re-upload", so support keeps its history with the receipt. The
+// note is recorded in the audit log as well.
+func createUploadNoteHandler(c *gin.Context) {
+	up, ok := noteUpload(c)
+	if !ok {
+		return
+	}
+	user, _ := getUserFromContext(c)
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	body := strings.TrimSpace(req.Note)
+	if body == "" || len(body) > 1000 {
+		writeError(c, apierr.InvalidBody, "note is required (max 1000 characters)", gin.H{"field": "note"})
+		return
+	}
+	var n int64
+	db.Model(&models.UploadNote{}).Where("upload_id = ?", up.ID).Count(&n)
+	if n >= maxUploadNotes {
+		writeError(c, apierr.InvalidBody, "too many notes on this upload", gin.H{"max": maxUploadNotes})
+		return
+	}
+	note := models.UploadNote{UploadID: up.ID, UserID: user.ID, Username: user.Username, Body: body, TenantID: up.TenantID}
+	if err := db.Create(&note).Error; err != nil {
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	recordAudit(c, "upload.note", gin.H{"upload_id": up.ID, "note_id": note.ID, "note": body})
+	c.JSON(http.StatusCreated, note)
+}
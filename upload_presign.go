@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/orgs"
+	"be03/pkg/storage"
+	"be03/pkg/uploadfiles"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -------------------- direct uploads --------------------
+
+// presignTTL is how long a signed upload URL, and its upload token, stay valid.
+const presignTTL = 15 * time.Minute
+
+// presignBucket returns the bucket clients upload to directly
+// (S3_UPLOAD_BUCKET) and its signer; ok is false, direct uploads off, without
+// the bucket or S3_ENDPOINT.
+func presignBucket() (bucket string, p storage.Presigner, ok bool) {
+	bucket = os.Getenv("S3_UPLOAD_BUCKET")
+	p, ok = objectStore.(storage.Presigner)
+	return bucket, p, ok && bucket != ""
+}
+
+// presignUploadHandler starts a direct upload of {file_name, size}: it returns
+// a signed URL the client PUTs the image to, bypassing the API, and an
+// upload_token for POST /uploads/complete. size is optional but lets oversized
+// files be refused before they are sent.
+func presignUploadHandler(c *gin.Context) {
+	bucket, presigner, ok := presignBucket()
+	if !ok {
+		writeError(c, apierr.IngestDisabled, "set S3_ENDPOINT and S3_UPLOAD_BUCKET to enable direct uploads", nil)
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var profile models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	var req struct {
+		FileName string `json:"file_name"`
+		Size     int64  `json:"size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	name := filepath.Base(strings.TrimSpace(req.FileName))
+	if name == "." || name == "/" || len(name) > 255 {
+		writeError(c, apierr.InvalidBody, "file_name is required", gin.H{"field": "file_name"})
+		return
+	}
+	if !uploadfiles.APITypes.Has(name) {
+		writeError(c, apierr.UnsupportedType, "File tidak dikenali, gunakan file lain!", gin.H{"allowed": uploadfiles.APITypes.List()})
+		return
+	}
+	if req.Size > maxUploadBytes {
+		writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
+		return
+	}
+	if !checkUploadQuota(c, user, profile) || !checkOrgQuota(c, user, req.Size) {
+		return
+	}
+	// a key of its own per attempt, outside the <username>/ keys of bucket ingestion
+	key := fmt.Sprintf("direct/%d/%s/%s", user.ID, randomHex(8), name)
+	expires := time.Now().Add(presignTTL)
+	putURL, err := presigner.PresignPut(c.Request.Context(), bucket, key, presignTTL)
+	if err != nil {
+		log.Printf("presign %s/%s: %v", bucket, key, err)
+		writeError(c, apierr.TokenFailed, "", nil)
+		return
+	}
+	// no uid claim: the token cannot pass for an access token
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":   "upload",
+		"owner": user.ID,
+		"key":   key,
+		"name":  name,
+		"exp":   expires.Unix(),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		writeError(c, apierr.TokenFailed, "", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":          putURL,
+		"method":       http.MethodPut,
+		"headers":      gin.H{"Content-Type": uploadfiles.APITypes[strings.ToLower(filepath.Ext(name))]},
+		"upload_token": token,
+		"expires_at":   expires.UTC(),
+	})
+}
+
+// completeUploadHandler finishes a direct upload: {upload_token} names the
+// object PUT to the signed URL, which is fetched, checked like a form upload
+// and queued for OCR. The object stays in the bucket; expire it there with a
+// lifecycle rule on the direct/ prefix.
+func completeUploadHandler(c *gin.Context) {
+	bucket, _, ok := presignBucket()
+	if !ok {
+		writeError(c, apierr.IngestDisabled, "set S3_ENDPOINT and S3_UPLOAD_BUCKET to enable direct uploads", nil)
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var profile models.Profile
+	if err := db.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "profile missing", nil)
+		return
+	}
+	var req struct {
+		UploadToken string `json:"upload_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(req.UploadToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return jwtSecret, nil
+	})
+	owner, _ := claims["owner"].(float64)
+	key, _ := claims["key"].(string)
+	name, _ := claims["name"].(string)
+	if err != nil || claims["typ"] != "upload" || uint(owner) != user.ID || key == "" || name == "" {
+		writeError(c, apierr.InvalidBody, "invalid or expired upload token", gin.H{"field": "upload_token"})
+		return
+	}
+	if !checkUploadQuota(c, user, profile) {
+		return
+	}
+	rc, err := objectStore.Get(c.Request.Context(), bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(c, apierr.NotFound, "nothing was uploaded to the signed url", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("direct upload: fetch %s/%s: %v", bucket, key, err)
+		writeError(c, apierr.OpenFailed, "", nil)
+		return
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, rc, maxUploadBytes+1); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("direct upload: fetch %s/%s: %v", bucket, key, err)
+		writeError(c, apierr.OpenFailed, "", nil)
+		return
+	}
+	id, err := ingestFile(profile, name, buf.Bytes())
+	if qe, ok := orgs.IsQuotaError(err); ok {
+		writeError(c, apierr.QuotaExceeded, qe.Error(), gin.H{"org_id": qe.OrgID, "resource": qe.Resource, "limit": qe.Limit, "used": qe.Used})
+		return
+	}
+	if err != nil {
+		switch err.Error() {
+		case "file too large":
+			writeError(c, apierr.FileTooLarge, "file too large (max 1MB)", nil)
+		case "unsupported file type":
+			writeError(c, apierr.UnsupportedType, "File tidak dikenali, gunakan file lain!", gin.H{"allowed": uploadfiles.APITypes.List()})
+		case "already processed":
+			writeError(c, apierr.Duplicate, "file already recorded", nil)
+		default:
+			log.Printf("direct upload %s/%s: %v", bucket, key, err)
+			writeError(c, apierr.SaveFailed, "", nil)
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"upload_id": id, "status": "queued"})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/logredact"
+	"be03/pkg/ocr"
+	"be03/pkg/uploadfiles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- crop-assist --------------------
+
+// regionRequest selects part of an upload's image, in pixels of the original
+// (the coordinate space of the regions returned with amount_not_found).
+type regionRequest struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width" binding:"required"`
+	Height int `json:"height" binding:"required"`
+	// ConfirmRequired creates the catatan pending, as on upload.
+	ConfirmRequired bool `json:"confirm_required"`
+}
+
+// uploadRegionHandler re-runs OCR on the region of a failed upload the user
+// selected and, when an amount is found there, links the upload to a catatan
+// exactly like a successful upload would.
+func uploadRegionHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var profile models.Profile
+	reqDB(c).Where("user_id = ?", user.ID).First(&profile)
+	var up models.Upload
+	if err := reqDB(c).First(&up, c.Param("id")).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	if role != "administrator" && up.ProfileID != profile.ID {
+		writeError(c, apierr.Forbidden, "", nil)
+		return
+	}
+	if up.KeuanganID != nil {
+		writeError(c, apierr.Duplicate, "upload already has a catatan", gin.H{"catatan_id": *up.KeuanganID})
+		return
+	}
+	if !checkOrgQuota(c, user, 0) {
+		return
+	}
+	var req regionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, "x, y, width and height are required", nil)
+		return
+	}
+	path := uploadfiles.Locate(up)
+	if path == "" {
+		writeError(c, apierr.NotFound, "receipt file is no longer stored, upload it again", nil)
+		return
+	}
+	crop, err := ocr.CropFile(path, image.Rect(req.X, req.Y, req.X+req.Width, req.Y+req.Height))
+	if errors.Is(err, ocr.ErrInvalidCrop) {
+		writeError(c, apierr.InvalidBody, err.Error(), gin.H{"min_side": ocr.MinCropSide})
+		return
+	}
+	if err != nil {
+		writeError(c, apierr.InvalidFile, "", nil)
+		return
+	}
+	defer os.RemoveAll(filepath.Dir(crop))
+
+	res, err := extractOCR(crop)
+	if errors.Is(err, ocr.ErrNoAmount) {
+		writeError(c, apierr.AmountNotFound, "Nominal tidak ditemukan pada area yang dipilih", gin.H{"ocr": res})
+		return
+	}
+	if err != nil {
+		log.Printf("OCR: region of upload=%d: %v", up.ID, err)
+		writeError(c, apierr.OCRError, "", nil)
+		return
+	}
+	log.Printf("OCR: region of upload=%d amount=%s conf=%.2f", up.ID, logredact.Amount(res.Amount), res.Confidence)
+
+	// the catatan belongs to the upload's owner, who may not be the caller
+	var owner models.Profile
+	if err := reqDB(c).First(&owner, up.ProfileID).Error; err != nil {
+		writeError(c, apierr.ProfileMissing, "", nil)
+		return
+	}
+	var ownerUser models.User
+	reqDB(c).Preload("Role").First(&ownerUser, owner.UserID)
+	now, conf, raw := time.Now(), res.Confidence, res.RawConfidence
+	up.ProcessedAt, up.OCRConfidence = &now, &conf
+	up.OCRHeuristic, up.OCRRawConfidence = res.Heuristic, &raw
+	up.Failed, up.FailedReason = false, ""
+	if res.Reference != "" {
+		up.Reference = res.Reference
+	}
+	suspect := linkRecognized(&up, owner, path, res, ownerUser.Role.Name != "administrator", req.ConfirmRequired)
+	c.JSON(http.StatusOK, gin.H{"id": up.ID, "catatan_id": up.KeuanganID, "ocr": res, "suspect": suspect})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/ratelimit"
+	"be03/pkg/usernames"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------- username change --------------------
+
+// changeUsernameHandler renames the caller after confirming the password.
+// The new name must be free (also among names other users gave up) and the
+// previous rename older than USERNAME_CHANGE_COOLDOWN. Access and refresh
+// tokens stay valid; the old name is kept in the user's username history.
+func changeUsernameHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, "username and password confirmation required", nil)
+		return
+	}
+	if !checkPassword(user.HashedPassword, req.Password) {
+		writeError(c, apierr.InvalidCredentials, "", nil)
+		return
+	}
+	name := strings.TrimSpace(req.Username)
+	cooldown := usernames.Cooldown()
+	h, err := usernames.Change(db, user, name, cooldown, time.Now())
+	var cd *usernames.CooldownError
+	switch {
+	case errors.As(err, &cd):
+		retry := time.Until(cd.Next).Round(time.Second)
+		c.Header("Retry-After", strconv.Itoa(int(retry/time.Second)))
+		writeError(c, apierr.UsernameCooldown, "", gin.H{"next_change_at": cd.Next})
+		return
+	case errors.Is(err, usernames.ErrSame):
+		writeError(c, apierr.InvalidBody, "username is unchanged", gin.H{"field": "username"})
+		return
+	case errors.Is(err, usernames.ErrInvalid):
+		writeError(c, apierr.InvalidBody, "username must be 3-32 letters, digits, '.', '_' or '-', starting with a letter or digit", gin.H{"field": "username"})
+		return
+	case errors.Is(err, usernames.ErrTaken):
+		writeError(c, apierr.Duplicate, "username taken", gin.H{"field": "username"})
+		return
+	case err != nil:
+		writeError(c, apierr.DBSaveFailed, "", nil)
+		return
+	}
+	userCache.Invalidate(user.ID)
+	// rate limit overrides are keyed by username
+	if err := ratelimit.RenameOverride(db, uploadOverrides.Key, h.OldUsername, h.NewUsername); err != nil {
+		log.Printf("username change user=%d: moving rate limit override failed: %v", user.ID, err)
+	}
+	uploadOverrides.Invalidate()
+	user.Username = h.NewUsername
+	c.Set("user", user)
+	recordAudit(c, "user.username_changed", gin.H{"from": h.OldUsername, "to": h.NewUsername})
+	resp := gin.H{"username": h.NewUsername, "previous": h.OldUsername, "changed_at": h.ChangedAt}
+	if cooldown > 0 {
+		resp["next_change_at"] = h.ChangedAt.Add(cooldown)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// usernameHistoryHandler lists the caller's previous usernames, newest first.
+func usernameHistoryHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var rows []models.UsernameHistory
+	if err := db.Where("user_id = ?", user.ID).Order("changed_at DESC").Find(&rows).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	type item struct {
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+		ChangedAt time.Time `json:"changed_at"`
+	}
+	items := make([]item, len(rows))
+	for i, r := range rows {
+		items[i] = item{From: r.OldUsername, To: r.NewUsername, ChangedAt: r.ChangedAt}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
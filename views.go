@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"be03/models"
+	"be03/pkg/apierr"
+	"be03/pkg/savedviews"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// -------------------- saved views --------------------
+
+// maxSavedViews caps the views of one user.
+const maxSavedViews = 100
+
+type savedView struct {
+	ID        uint              `json:"id"`
+	Name      string            `json:"name"`
+	Filters   savedviews.Filter `json:"filters"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func viewSavedView(v models.SavedView) savedView {
+	f, _ := savedviews.Parse(v.Filters)
+	return savedView{ID: v.ID, Name: v.Name, Filters: f, UpdatedAt: v.UpdatedAt}
+}
+
+// catatanRange is dateRange for the catatan lists, exports and reports
+// taking ?view=: the saved view's dates apply unless from / to are given, and
+// its other filters come back as a scope for the catatan query (a no-op
+// without a view).
+func catatanRange(c *gin.Context, userID uint, loc *time.Location) (from, to *time.Time, scope func(*gorm.DB) *gorm.DB, ok bool) {
+	scope = func(q *gorm.DB) *gorm.DB { return q }
+	from, to, ok = dateRange(c, loc)
+	if !ok || c.Query("view") == "" {
+		return from, to, scope, ok
+	}
+	var v models.SavedView
+	id, err := strconv.ParseUint(c.Query("view"), 10, 64)
+	if err != nil || db.Where("id = ? AND user_id = ?", id, userID).First(&v).Error != nil {
+		writeError(c, apierr.NotFound, "view not found", gin.H{"field": "view"})
+		return nil, nil, nil, false
+	}
+	f, err := savedviews.Parse(v.Filters)
+	if err != nil {
+		writeError(c, apierr.Internal, "", nil)
+		return nil, nil, nil, false
+	}
+	vFrom, vTo, _ := f.Dates(loc)
+	if c.Query("from") == "" {
+		from = vFrom
+	}
+	if c.Query("to") == "" {
+		to = vTo
+	}
+	return from, to, f.Scope, true
+}
+
+// savedViewRequest is shared by create and update.
+type savedViewRequest struct {
+	Name    *string            `json:"name"`
+	Filters *savedviews.Filter `json:"filters"`
+}
+
+// apply copies the set fields onto v and validates the result.
+func (r savedViewRequest) apply(c *gin.Context, v *models.SavedView) bool {
+	if r.Name != nil {
+		v.Name = strings.TrimSpace(*r.Name)
+	}
+	if v.Name == "" || len(v.Name) > 128 {
+		writeError(c, apierr.InvalidBody, "name is required (max 128 characters)", gin.H{"field": "name"})
+		return false
+	}
+	if r.Filters != nil {
+		f := *r.Filters
+		if err := f.Normalize(); err != nil {
+			writeError(c, apierr.InvalidBody, err.Error(), gin.H{"field": "filters"})
+			return false
+		}
+		v.Filters = f.String()
+	}
+	if v.Filters == "" {
+		v.Filters = savedviews.Filter{}.String()
+	}
+	return true
+}
+
+// saveView writes v, answering duplicate for a name already taken.
+func saveView(c *gin.Context, v *models.SavedView, status int) {
+	var taken int64
+	db.Model(&models.SavedView{}).Where("user_id = ? AND name = ? AND id <> ?", v.UserID, v.Name, v.ID).Count(&taken)
+	if taken > 0 {
+		writeError(c, apierr.Duplicate, "a view of that name exists", gin.H{"field": "name"})
+		return
+	}
+	if err := db.Save(v).Error; err != nil {
+		if isUniqueConstraintError(err) { // created concurrently
+			writeError(c, apierr.Duplicate, "a view of that name exists", gin.H{"field": "name"})
+			return
+		}
+		writeError(c, apierr.CreateFailed, "", nil)
+		return
+	}
+	c.JSON(status, viewSavedView(*v))
+}
+
+// listViewsHandler lists the caller's saved views by name.
+func listViewsHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var list []models.SavedView
+	if err := db.Where("user_id = ?", user.ID).Order("name").Find(&list).Error; err != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	out := make([]savedView, 0, len(list))
+	for _, v := range list {
+		out = append(out, viewSavedView(v))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// createViewHandler saves a named filter set: {name, filters: {from, to,
+// categories, account_ids, min_amount}}. Apply it with ?view=<id> on
+// GET /catatan, the exports and the reports.
+func createViewHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var req savedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	var n int64
+	db.Model(&models.SavedView{}).Where("user_id = ?", user.ID).Count(&n)
+	if n >= maxSavedViews {
+		writeError(c, apierr.InvalidBody, "too many saved views", gin.H{"max": maxSavedViews})
+		return
+	}
+	v := models.SavedView{UserID: user.ID}
+	if !req.apply(c, &v) {
+		return
+	}
+	saveView(c, &v, http.StatusCreated)
+}
+
+// updateViewHandler renames a view or replaces its filters.
+func updateViewHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	var v models.SavedView
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&v).Error; err != nil {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	var req savedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, apierr.InvalidBody, err.Error(), nil)
+		return
+	}
+	if !req.apply(c, &v) {
+		return
+	}
+	saveView(c, &v, http.StatusOK)
+}
+
+func deleteViewHandler(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		writeError(c, apierr.Unauthorized, "", nil)
+		return
+	}
+	res := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.SavedView{})
+	if res.Error != nil {
+		writeError(c, apierr.QueryFailed, "", nil)
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(c, apierr.NotFound, "", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}